@@ -0,0 +1,118 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"istio.io/istio/istioctl/pkg/clioptions"
+	caserver "istio.io/istio/security/pkg/server/ca"
+)
+
+func caAuditCmd() *cobra.Command {
+	var opts clioptions.ControlPlaneOptions
+	var identity, serial string
+	var all bool
+
+	cmd := &cobra.Command{
+		Use:   "ca-audit",
+		Short: "Lists the certificates recently issued by the Istiod CA",
+		Long: `
+Lists the certificates recently issued by the CA of each Istiod replica, with the identity which requested them,
+how it was authenticated and where the request came from.
+Only the records kept in memory by Istiod are listed, unless --all is set to search the complete log in the
+CA_AUDIT_LOG_FILE files of Istiod.
+`,
+		Example: `  # List the certificates issued to the default service account of the default namespace
+  istioctl x ca-audit --identity spiffe://cluster.local/ns/default/sa/default
+
+  # Show the issuance of the certificate with a serial number
+  istioctl x ca-audit --serial 3f1ba2c4e8b1d6a2c7bfc1b0a8b1e2d4
+
+  # Search the audit log files for the certificates issued to a service account
+  istioctl x ca-audit --all --identity spiffe://cluster.local/ns/default/sa/default`,
+		Args: cobra.NoArgs,
+		RunE: func(c *cobra.Command, args []string) error {
+			kubeClient, err := kubeClientWithRevision(kubeconfig, configContext, opts.Revision)
+			if err != nil {
+				return err
+			}
+			query := url.Values{}
+			if identity != "" {
+				query.Set("identity", identity)
+			}
+			if serial != "" {
+				query.Set("serial", serial)
+			}
+			if all {
+				query.Set("all", "true")
+			}
+			path := "/debug/ca/audit"
+			if len(query) > 0 {
+				path += "?" + query.Encode()
+			}
+			responses, err := kubeClient.AllDiscoveryDo(context.TODO(), istioNamespace, path)
+			if err != nil {
+				return fmt.Errorf("unable to query the CA audit log: %v", err)
+			}
+			records := []*caserver.AuditRecord{}
+			for istiod, response := range responses {
+				var istiodRecords []*caserver.AuditRecord
+				if err := json.Unmarshal(response, &istiodRecords); err != nil {
+					return fmt.Errorf("unable to parse the CA audit log of %s (is the CA audit log enabled?): %v", istiod, err)
+				}
+				records = append(records, istiodRecords...)
+			}
+			sort.SliceStable(records, func(i, j int) bool {
+				return records[i].Time.Before(records[j].Time)
+			})
+			return printCAAudit(c.OutOrStdout(), records)
+		},
+	}
+
+	cmd.Flags().StringVar(&identity, "identity", "",
+		"Only list the certificates issued to or requested by this identity, such as a SPIFFE ID")
+	cmd.Flags().StringVar(&serial, "serial", "", "Only list the certificate with this hex serial number")
+	cmd.Flags().BoolVar(&all, "all", false,
+		"Search the CA audit log files of Istiod, set by CA_AUDIT_LOG_FILE, instead of the recent records kept in memory")
+	opts.AttachControlPlaneFlags(cmd)
+	cmd.Long += "\n\n" + ExperimentalMsg
+	return cmd
+}
+
+func printCAAudit(writer io.Writer, records []*caserver.AuditRecord) error {
+	if len(records) == 0 {
+		_, err := fmt.Fprintln(writer, "No certificates found.")
+		return err
+	}
+	w := new(tabwriter.Writer).Init(writer, 0, 8, 1, ' ', 0)
+	fmt.Fprintln(w, "TIME\tSERIAL\tSUBJECT ALT NAMES\tREQUESTER\tAUTHENTICATOR\tTTL\tSOURCE")
+	for _, r := range records {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%v\t%s\n", r.Time.UTC().Format(time.RFC3339), r.SerialNumber,
+			strings.Join(r.SubjectAltNames, ","), strings.Join(r.Requester, ","), r.Authenticator,
+			time.Duration(r.TTL)*time.Second, r.SourceIP)
+	}
+	return w.Flush()
+}
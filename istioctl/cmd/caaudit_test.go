@@ -0,0 +1,79 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	caserver "istio.io/istio/security/pkg/server/ca"
+)
+
+func TestCAAudit(t *testing.T) {
+	records := func(records ...*caserver.AuditRecord) []byte {
+		b, _ := json.Marshal(records)
+		return b
+	}
+	istiodRecords := map[string][]byte{
+		"istiod-1": records(&caserver.AuditRecord{
+			Time:            time.Date(2021, 10, 1, 10, 0, 0, 0, time.UTC),
+			SerialNumber:    "2b",
+			SubjectAltNames: []string{"spiffe://cluster.local/ns/default/sa/default"},
+			Requester:       []string{"spiffe://cluster.local/ns/default/sa/default"},
+			Authenticator:   "KubeJWTAuthenticator",
+			TTL:             86400,
+			SourceIP:        "10.0.0.2",
+		}),
+		"istiod-2": records(&caserver.AuditRecord{
+			Time:            time.Date(2021, 10, 1, 9, 0, 0, 0, time.UTC),
+			SerialNumber:    "1a",
+			SubjectAltNames: []string{"spiffe://cluster.local/ns/default/sa/default"},
+			Requester:       []string{"spiffe://cluster.local/ns/default/sa/default"},
+			Authenticator:   "ClientCertAuthenticator",
+			TTL:             3600,
+			SourceIP:        "10.0.0.1",
+		}),
+	}
+
+	cases := []execTestCase{
+		{
+			execClientConfig: istiodRecords,
+			args:             strings.Split("x ca-audit --identity spiffe://cluster.local/ns/default/sa/default", " "),
+			expectedOutput: "TIME                 SERIAL SUBJECT ALT NAMES                            " +
+				"REQUESTER                                    AUTHENTICATOR           TTL     SOURCE\n" +
+				"2021-10-01T09:00:00Z 1a     spiffe://cluster.local/ns/default/sa/default " +
+				"spiffe://cluster.local/ns/default/sa/default ClientCertAuthenticator 1h0m0s  10.0.0.1\n" +
+				"2021-10-01T10:00:00Z 2b     spiffe://cluster.local/ns/default/sa/default " +
+				"spiffe://cluster.local/ns/default/sa/default KubeJWTAuthenticator    24h0m0s 10.0.0.2\n",
+		},
+		{
+			execClientConfig: map[string][]byte{"istiod-1": []byte("[]")},
+			args:             strings.Split("x ca-audit --serial 3c", " "),
+			expectedOutput:   "No certificates found.\n",
+		},
+		{
+			execClientConfig: map[string][]byte{"istiod-1": []byte("404 page not found")},
+			args:             strings.Split("x ca-audit", " "),
+			wantException:    true,
+		},
+	}
+	for _, c := range cases {
+		t.Run(strings.Join(c.args, " "), func(t *testing.T) {
+			verifyExecTestOutput(t, c)
+		})
+	}
+}
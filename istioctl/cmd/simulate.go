@@ -0,0 +1,316 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"text/tabwriter"
+
+	cluster "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	listener "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
+	route "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	"github.com/spf13/cobra"
+
+	"istio.io/istio/istioctl/pkg/util/configdump"
+	"istio.io/istio/pilot/pkg/config/kube/crd"
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/simulation"
+	"istio.io/istio/pkg/config"
+)
+
+type simulateArgs struct {
+	configDumpFile string
+	configFiles    []string
+
+	proxyType      string
+	proxyNamespace string
+	proxyIP        string
+	proxyLabels    []string
+
+	call    simulation.Call
+	headers []string
+	output  string
+}
+
+func simulateCmd() *cobra.Command {
+	sa := &simulateArgs{}
+	cmd := &cobra.Command{
+		Use:   "simulate [<type>/]<name>[.<namespace>]",
+		Short: "Traces the path a request takes through the proxy configuration",
+		Long: `Traces a request through the listeners, filter chains, routes and clusters of a proxy,
+printing each match along with the TLS decisions made, or the reason the request would fail.
+
+The configuration is read from the Envoy in the specified pod, from an Envoy config dump file, or
+generated locally from a set of Istio configuration files without access to a cluster.`,
+		Example: `  # Trace an HTTP request from a pod to reviews on port 9080
+  istioctl x simulate productpage-v1-123456-abcde.default --address 10.0.0.1 --port 9080 --host reviews:9080
+
+  # Trace a request using a config dump fetched without the Kubernetes API
+  ssh <user@hostname> 'curl localhost:15000/config_dump' > envoy-config.json
+  istioctl x simulate --file envoy-config.json --port 9080 --host reviews:9080 --path /api
+
+  # Trace an inbound mTLS request using configuration generated from local files
+  istioctl x simulate --config-file service-entries.yaml --config-file policies.yaml \
+    --proxy-labels app=reviews --proxy-ip 10.0.0.2 --mode inbound --tls mtls --port 9080
+`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			sources := 0
+			if len(args) == 1 {
+				sources++
+			}
+			if sa.configDumpFile != "" {
+				sources++
+			}
+			if len(sa.configFiles) > 0 {
+				sources++
+			}
+			if len(args) > 1 || sources != 1 {
+				cmd.Println(cmd.UsageString())
+				return fmt.Errorf("simulate requires exactly one of pod name, --file or --config-file")
+			}
+			if sa.output != jsonOutput && sa.output != summaryOutput {
+				return fmt.Errorf("output format %q not supported", sa.output)
+			}
+			return nil
+		},
+		RunE: func(c *cobra.Command, args []string) error {
+			tracer, err := sa.tracer(args)
+			if err != nil {
+				return err
+			}
+			call := sa.call
+			call.Headers = http.Header{}
+			for _, h := range sa.headers {
+				k, v := splitEqual(h)
+				call.Headers.Add(k, v)
+			}
+			trace, err := tracer.Trace(call)
+			if err != nil {
+				return fmt.Errorf("failed to evaluate configuration: %v", err)
+			}
+			if sa.output == jsonOutput {
+				return printTraceJSON(c.OutOrStdout(), trace)
+			}
+			printTrace(c.OutOrStdout(), trace)
+			return nil
+		},
+	}
+
+	flags := cmd.PersistentFlags()
+	flags.StringVarP(&sa.configDumpFile, "file", "f", "", "Envoy config dump JSON file")
+	flags.StringSliceVar(&sa.configFiles, "config-file", nil,
+		"Istio configuration files to generate the proxy configuration from, instead of reading it from a proxy")
+	flags.StringVar(&sa.proxyType, "proxy-type", string(model.SidecarProxy),
+		"Type of the proxy to generate configuration for when using --config-file: one of sidecar|router")
+	flags.StringVar(&sa.proxyNamespace, "proxy-namespace", "default",
+		"Namespace of the proxy to generate configuration for when using --config-file")
+	flags.StringVar(&sa.proxyIP, "proxy-ip", "", "IP address of the proxy to generate configuration for when using --config-file")
+	flags.StringSliceVar(&sa.proxyLabels, "proxy-labels", nil,
+		"Labels of the proxy to generate configuration for when using --config-file; e.g. --proxy-labels app=reviews,version=v1")
+
+	flags.StringVar(&sa.call.Address, "address", "", "Destination IP address of the request")
+	flags.IntVar(&sa.call.Port, "port", 80, "Destination port of the request")
+	flags.StringVar(&sa.call.Path, "path", "/", "HTTP path of the request")
+	flags.StringVar(&sa.call.HostHeader, "host", "", "Host header of the request")
+	flags.StringSliceVar(&sa.headers, "header", nil, "Additional request headers; e.g. --header x-user=admin")
+	flags.StringVar((*string)(&sa.call.Protocol), "protocol", string(simulation.HTTP), "Protocol of the request: one of http|http2|tcp")
+	flags.StringVar((*string)(&sa.call.TLS), "tls", string(simulation.Plaintext), "TLS mode of the request: one of plaintext|tls|mtls")
+	flags.StringVar(&sa.call.Sni, "sni", "", "SNI of the request. Defaults to the host header for TLS requests")
+	flags.StringVar(&sa.call.Alpn, "alpn", "", "ALPN of the request. Defaults based on protocol for TLS requests")
+	flags.StringVar((*string)(&sa.call.CallMode), "mode", string(simulation.CallModeOutbound),
+		"How the request reaches the proxy: one of outbound|inbound|gateway")
+	flags.StringVarP(&sa.output, "output", "o", summaryOutput, "Output format: one of json|short")
+
+	return cmd
+}
+
+func (sa *simulateArgs) tracer(args []string) (*simulation.Tracer, error) {
+	if len(sa.configFiles) > 0 {
+		return sa.tracerFromConfigFiles()
+	}
+	var dump []byte
+	var err error
+	if len(args) == 1 {
+		podName, podNamespace, err := getPodName(args[0])
+		if err != nil {
+			return nil, err
+		}
+		if dump, err = extractConfigDump(podName, podNamespace); err != nil {
+			return nil, err
+		}
+	} else if dump, err = readFile(sa.configDumpFile); err != nil {
+		return nil, err
+	}
+	return tracerFromConfigDump(dump)
+}
+
+func (sa *simulateArgs) tracerFromConfigFiles() (*simulation.Tracer, error) {
+	var configs []config.Config
+	for _, f := range sa.configFiles {
+		b, err := readFile(f)
+		if err != nil {
+			return nil, err
+		}
+		cfgs, _, err := crd.ParseInputs(string(b))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %v", f, err)
+		}
+		for _, c := range cfgs {
+			if c.Namespace == "" {
+				c.Namespace = sa.proxyNamespace
+			}
+			configs = append(configs, c)
+		}
+	}
+	nodeType := model.NodeType(sa.proxyType)
+	if !model.IsApplicationNodeType(nodeType) {
+		return nil, fmt.Errorf("invalid proxy type %q", sa.proxyType)
+	}
+	proxy := &model.Proxy{
+		Type:            nodeType,
+		ConfigNamespace: sa.proxyNamespace,
+		Metadata: &model.NodeMetadata{
+			Labels: convertToStringMap(sa.proxyLabels),
+		},
+	}
+	if sa.proxyIP != "" {
+		proxy.IPAddresses = []string{sa.proxyIP}
+	}
+	return simulation.NewTracerFromConfig(configs, nil, proxy)
+}
+
+func tracerFromConfigDump(dump []byte) (*simulation.Tracer, error) {
+	cd := &configdump.Wrapper{}
+	if err := cd.UnmarshalJSON(dump); err != nil {
+		return nil, fmt.Errorf("failed to parse config dump: %v", err)
+	}
+
+	listenerDump, err := cd.GetDynamicListenerDump(true)
+	if err != nil {
+		return nil, err
+	}
+	listeners := make([]*listener.Listener, 0, len(listenerDump.DynamicListeners))
+	for _, l := range listenerDump.DynamicListeners {
+		ll := &listener.Listener{}
+		if err := l.ActiveState.Listener.UnmarshalTo(ll); err != nil {
+			return nil, err
+		}
+		listeners = append(listeners, ll)
+	}
+
+	clusterDump, err := cd.GetDynamicClusterDump(true)
+	if err != nil {
+		return nil, err
+	}
+	clusters := make([]*cluster.Cluster, 0, len(clusterDump.DynamicActiveClusters))
+	for _, c := range clusterDump.DynamicActiveClusters {
+		cc := &cluster.Cluster{}
+		if err := c.Cluster.UnmarshalTo(cc); err != nil {
+			return nil, err
+		}
+		clusters = append(clusters, cc)
+	}
+
+	routeDump, err := cd.GetDynamicRouteDump(true)
+	if err != nil {
+		return nil, err
+	}
+	routes := make([]*route.RouteConfiguration, 0, len(routeDump.DynamicRouteConfigs))
+	for _, r := range routeDump.DynamicRouteConfigs {
+		rc := &route.RouteConfiguration{}
+		if err := r.RouteConfig.UnmarshalTo(rc); err != nil {
+			return nil, err
+		}
+		routes = append(routes, rc)
+	}
+	return simulation.NewTracer(listeners, clusters, routes), nil
+}
+
+func printTrace(out io.Writer, trace *simulation.Trace) {
+	w := new(tabwriter.Writer).Init(out, 0, 8, 1, ' ', 0)
+	res := trace.Result
+	row := func(name, value string) {
+		if value != "" {
+			_, _ = fmt.Fprintf(w, "%s:\t%s\n", name, value)
+		}
+	}
+	row("Listener", res.ListenerMatched)
+	row("Filter Chain", res.FilterChainMatched)
+	if res.FilterChainMatched != "" && res.Error != simulation.ErrTLSError && res.Error != simulation.ErrMTLSError {
+		row("Downstream TLS", string(trace.DownstreamTLS))
+	}
+	row("Route Config", res.RouteConfigMatched)
+	row("Virtual Host", res.VirtualHostMatched)
+	row("Route", res.RouteMatched)
+	row("Cluster", res.ClusterMatched)
+	row("Weighted Clusters", strings.Join(trace.WeightedClusters, ","))
+	if trace.Cluster != nil {
+		upstream := string(trace.UpstreamTLS)
+		if trace.UpstreamAutoMTLS {
+			upstream += " (when supported by the endpoint, plaintext otherwise)"
+		}
+		row("Upstream TLS", upstream)
+	} else if res.ClusterMatched != "" {
+		row("Upstream TLS", "unknown, cluster not found")
+	}
+	if res.Error != nil {
+		row("Error", res.Error.Error())
+	}
+	_ = w.Flush()
+}
+
+func printTraceJSON(out io.Writer, trace *simulation.Trace) error {
+	res := trace.Result
+	errString := ""
+	if res.Error != nil {
+		errString = res.Error.Error()
+	}
+	b, err := json.MarshalIndent(struct {
+		Listener         string          `json:"listener,omitempty"`
+		FilterChain      string          `json:"filterChain,omitempty"`
+		DownstreamTLS    string          `json:"downstreamTLS,omitempty"`
+		RouteConfig      string          `json:"routeConfig,omitempty"`
+		VirtualHost      string          `json:"virtualHost,omitempty"`
+		Route            string          `json:"route,omitempty"`
+		Cluster          string          `json:"cluster,omitempty"`
+		WeightedClusters []string        `json:"weightedClusters,omitempty"`
+		UpstreamTLS      string          `json:"upstreamTLS,omitempty"`
+		UpstreamAutoMTLS bool            `json:"upstreamAutoMTLS,omitempty"`
+		Error            string          `json:"error,omitempty"`
+		Call             simulation.Call `json:"call"`
+	}{
+		Listener:         res.ListenerMatched,
+		FilterChain:      res.FilterChainMatched,
+		DownstreamTLS:    string(trace.DownstreamTLS),
+		RouteConfig:      res.RouteConfigMatched,
+		VirtualHost:      res.VirtualHostMatched,
+		Route:            res.RouteMatched,
+		Cluster:          res.ClusterMatched,
+		WeightedClusters: trace.WeightedClusters,
+		UpstreamTLS:      string(trace.UpstreamTLS),
+		UpstreamAutoMTLS: trace.UpstreamAutoMTLS,
+		Error:            errString,
+		Call:             trace.Call,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(out, string(b))
+	return err
+}
@@ -0,0 +1,57 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestSimulate(t *testing.T) {
+	cases := []execTestCase{
+		{ // no configuration source
+			args:           strings.Split("x simulate --port 80", " "),
+			expectedString: "simulate requires exactly one of pod name, --file or --config-file",
+			wantException:  true,
+		},
+		{ // multiple configuration sources
+			args:           strings.Split("x simulate --file foo.json --config-file testdata/simulate/serviceentry.yaml", " "),
+			expectedString: "simulate requires exactly one of pod name, --file or --config-file",
+			wantException:  true,
+		},
+		{ // invalid output
+			args:           strings.Split("x simulate --config-file testdata/simulate/serviceentry.yaml -o yaml", " "),
+			expectedString: `output format "yaml" not supported`,
+			wantException:  true,
+		},
+		{ // route matched
+			args: strings.Split("x simulate --config-file testdata/simulate/serviceentry.yaml "+
+				"--port 80 --host foo.example.com --path /api/v1", " "),
+			expectedString: "outbound|80||foo.example.com",
+		},
+		{ // no route matched
+			args: strings.Split("x simulate --config-file testdata/simulate/serviceentry.yaml "+
+				"--port 80 --host foo.example.com --path /other -o json", " "),
+			expectedString: `"error": "no route matched"`,
+		},
+	}
+
+	for i, c := range cases {
+		t.Run(fmt.Sprintf("case %d %s", i, strings.Join(c.args, " ")), func(t *testing.T) {
+			verifyExecTestOutput(t, c)
+		})
+	}
+}
@@ -36,6 +36,7 @@ func NewAgentOptions(proxy *model.Proxy) *istioagent.AgentOptions {
 		ProxyType:                proxy.Type,
 		EnableDynamicProxyConfig: enableProxyConfigXdsEnv,
 		ProxyIPAddresses:         proxy.IPAddresses,
+		WasmModuleCacheMaxSize:   int64(wasmModuleCacheMaxSize),
 	}
 	extractXDSHeadersFromEnv(o)
 	if proxyXDSViaAgent {
@@ -19,6 +19,7 @@ import (
 
 	"istio.io/istio/pilot/cmd/pilot-agent/status"
 	"istio.io/istio/pkg/jwt"
+	"istio.io/istio/pkg/wasm"
 	"istio.io/pkg/env"
 )
 
@@ -76,10 +77,37 @@ var (
 		"The grace period ratio for the cert rotation, by default 0.5.").Get()
 	pkcs8KeysEnv = env.RegisterBoolVar("PKCS8_KEY", false,
 		"Whether to generate PKCS#8 private keys").Get()
-	eccSigAlgEnv        = env.RegisterStringVar("ECC_SIGNATURE_ALGORITHM", "", "The type of ECC signature algorithm to use when generating private keys").Get()
+	eccSigAlgEnv = env.RegisterStringVar("ECC_SIGNATURE_ALGORITHM", "",
+		"The type of signature algorithm to use when generating private keys: ECDSA (P256), or RSA_PSS for RSA "+
+			"keys signing with RSA-PSS. If empty, RSA is used. ECDSA_P384 and ED25519 are rejected, as Envoy does "+
+			"not support them for workload certificates.").Get()
+	csrDNSNamesEnv = env.RegisterStringVar("CSR_DNS_NAMES", "",
+		"A comma separated list of DNS names requested as SANs of the workload certificate, in addition to its "+
+			"SPIFFE identity, such as for ingress gateways. It can be set with the proxyMetadata of the proxy config. "+
+			"The CA only issues the DNS names allowed by the CSR policy of the namespace").Get()
+	keyProviderEnv = env.RegisterStringVar("KEY_PROVIDER", "",
+		"The key provider of the workload private keys. If empty, keys are held in memory. pkcs11 generates the keys "+
+			"on the PKCS#11 token set by PKCS11_MODULE and PKCS11_TOKEN_LABEL, and envelope encrypts the keys "+
+			"written to disk with the key encryption key in KEY_ENCRYPTION_KEY_FILE. With pkcs11, the agent must be "+
+			"built with a PKCS#11 binding, and Envoy with the pkcs11 private key provider it signs through").Get()
+	pkcs11ModuleEnv = env.RegisterStringVar("PKCS11_MODULE", "",
+		"The path of the PKCS#11 module used by the pkcs11 key provider").Get()
+	pkcs11TokenLabelEnv = env.RegisterStringVar("PKCS11_TOKEN_LABEL", "",
+		"The label of the PKCS#11 token used by the pkcs11 key provider").Get()
+	pkcs11PinFileEnv = env.RegisterStringVar("PKCS11_PIN_FILE", "",
+		"The file holding the user PIN of the PKCS#11 token used by the pkcs11 key provider").Get()
+	keyEncryptionKeyFileEnv = env.RegisterStringVar("KEY_ENCRYPTION_KEY_FILE", "",
+		"The file holding the AES-256 key encryption key, raw or base64 encoded, used by the envelope key provider").Get()
+	namedSecretsEnv = env.RegisterStringVar("NAMED_SECRETS", "",
+		"The secrets served over SDS by name, in addition to the workload certificate, as a JSON object mapping each "+
+			"name to its files {\"certificate\", \"privateKey\", \"caCertificates\"} or to the Kubernetes Secret "+
+			"{\"kubernetesSecret\"} in the namespace of the pod. They are requested as named://<name> and "+
+			"named://<name>-cacert, such as with the credentialName named://<name> of a DestinationRule or Gateway. "+
+			"Names must not end with -cacert").Get()
 	fileMountedCertsEnv = env.RegisterBoolVar("FILE_MOUNTED_CERTS", false, "").Get()
 	credFetcherTypeEnv  = env.RegisterStringVar("CREDENTIAL_FETCHER_TYPE", "",
-		"The type of the credential fetcher. Currently supported types include GoogleComputeEngine").Get()
+		"The type of the credential fetcher. Currently supported types include GoogleComputeEngine, AmazonEC2, "+
+			"AzureVM and JWTFile, which reads a rotated OIDC token from the JWT path").Get()
 	credIdentityProvider = env.RegisterStringVar("CREDENTIAL_IDENTITY_PROVIDER", "GoogleComputeEngine",
 		"The identity provider for credential. Currently default supported identity provider is GoogleComputeEngine").Get()
 	proxyXDSViaAgent = env.RegisterBoolVar("PROXY_XDS_VIA_AGENT", true,
@@ -92,4 +120,8 @@ var (
 	// Ability of istio-agent to retrieve proxyConfig via XDS for dynamic configuration updates
 	enableProxyConfigXdsEnv = env.RegisterBoolVar("PROXY_CONFIG_XDS_AGENT", false,
 		"If set to true, agent retrieves dynamic proxy-config updates via xds channel").Get()
+
+	wasmModuleCacheMaxSize = env.RegisterIntVar("WASM_MODULE_CACHE_MAX_SIZE", wasm.DefaultWasmModuleCacheMaxSize,
+		"Maximum total size in bytes of the Wasm modules cached by the agent. Least recently used modules are "+
+			"evicted when it is exceeded. Zero uses the default size, and a negative value removes the limit.").Get()
 )
@@ -15,6 +15,7 @@
 package options
 
 import (
+	"encoding/json"
 	"fmt"
 	"strings"
 
@@ -25,6 +26,7 @@ import (
 	"istio.io/istio/pkg/security"
 	"istio.io/istio/security/pkg/credentialfetcher"
 	"istio.io/istio/security/pkg/nodeagent/plugin/providers/google/stsclient"
+	pkiutil "istio.io/istio/security/pkg/pki/util"
 	"istio.io/istio/security/pkg/stsservice/tokenmanager"
 	"istio.io/pkg/log"
 )
@@ -45,9 +47,15 @@ func NewSecurityOptions(proxyConfig *meshconfig.ProxyConfig, stsPort int, tokenM
 		TrustDomain:                    trustDomainEnv,
 		Pkcs8Keys:                      pkcs8KeysEnv,
 		ECCSigAlg:                      eccSigAlgEnv,
+		CSRDNSNames:                    parseCSRDNSNames(csrDNSNamesEnv),
 		SecretTTL:                      secretTTLEnv,
 		FileDebounceDuration:           fileDebounceDuration,
 		SecretRotationGracePeriodRatio: secretRotationGracePeriodRatioEnv,
+		KeyProvider:                    keyProviderEnv,
+		PKCS11Module:                   pkcs11ModuleEnv,
+		PKCS11TokenLabel:               pkcs11TokenLabelEnv,
+		PKCS11PinFile:                  pkcs11PinFileEnv,
+		KeyEncryptionKeyFile:           keyEncryptionKeyFileEnv,
 	}
 
 	o, err := SetupSecurityOptions(proxyConfig, o, jwtPolicy.Get(),
@@ -55,6 +63,9 @@ func NewSecurityOptions(proxyConfig *meshconfig.ProxyConfig, stsPort int, tokenM
 	if err != nil {
 		return o, err
 	}
+	if o.NamedSecrets, err = parseNamedSecrets(namedSecretsEnv); err != nil {
+		return o, err
+	}
 
 	var tokenManager security.TokenManager
 	if stsPort > 0 || xdsAuthProvider.Get() != "" {
@@ -67,6 +78,36 @@ func NewSecurityOptions(proxyConfig *meshconfig.ProxyConfig, stsPort int, tokenM
 	return o, err
 }
 
+func parseCSRDNSNames(dnsNames string) []string {
+	var names []string
+	for _, name := range strings.Split(dnsNames, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func parseNamedSecrets(namedSecrets string) (map[string]security.NamedSecret, error) {
+	if namedSecrets == "" {
+		return nil, nil
+	}
+	secrets := map[string]security.NamedSecret{}
+	if err := json.Unmarshal([]byte(namedSecrets), &secrets); err != nil {
+		return nil, fmt.Errorf("invalid options: NAMED_SECRETS: %v", err)
+	}
+	for name, secret := range secrets {
+		if name == "" || strings.HasSuffix(name, security.NamedSecretRootSuffix) {
+			return nil, fmt.Errorf("invalid options: NAMED_SECRETS: invalid secret name %q, names must not be empty "+
+				"or end with %s", name, security.NamedSecretRootSuffix)
+		}
+		if err := secret.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid options: NAMED_SECRETS: secret %s: %v", name, err)
+		}
+	}
+	return secrets, nil
+}
+
 func SetupSecurityOptions(proxyConfig *meshconfig.ProxyConfig, secOpt *security.Options, jwtPolicy,
 	credFetcherTypeEnv, credIdentityProvider string) (*security.Options, error) {
 	var jwtPath string
@@ -88,9 +129,10 @@ func SetupSecurityOptions(proxyConfig *meshconfig.ProxyConfig, secOpt *security.
 		o.CAEndpoint = proxyConfig.DiscoveryAddress
 	}
 
-	// TODO (liminw): CredFetcher is a general interface. In 1.7, we limit the use on GCE only because
-	// GCE is the only supported plugin at the moment.
-	if credFetcherTypeEnv == security.GCE {
+	// CredFetcher is a general interface, limited to the platforms of VMs, where the credential is not
+	// provisioned by Kubernetes.
+	switch credFetcherTypeEnv {
+	case security.GCE, security.AWS, security.Azure, security.JWTFile:
 		o.CredIdentityProvider = credIdentityProvider
 		credFetcher, err := credentialfetcher.NewCredFetcher(credFetcherTypeEnv, o.TrustDomain, jwtPath, o.CredIdentityProvider)
 		if err != nil {
@@ -107,5 +149,13 @@ func SetupSecurityOptions(proxyConfig *meshconfig.ProxyConfig, secOpt *security.
 	if o.ProvCert != "" && o.FileMountedCerts {
 		return nil, fmt.Errorf("invalid options: PROV_CERT and FILE_MOUNTED_CERTS are mutually exclusive")
 	}
+	sigAlg := pkiutil.SupportedECSignatureAlgorithms(o.ECCSigAlg)
+	if err := pkiutil.ValidateSigAlg(sigAlg); err != nil {
+		return nil, fmt.Errorf("invalid options: ECC_SIGNATURE_ALGORITHM: %v", err)
+	}
+	// Envoy only serves RSA and ECDSA P-256 certificates.
+	if sigAlg == pkiutil.EcdsaP384SigAlg || sigAlg == pkiutil.Ed25519SigAlg {
+		return nil, fmt.Errorf("invalid options: ECC_SIGNATURE_ALGORITHM: Envoy does not support %s workload certificates", sigAlg)
+	}
 	return o, nil
 }
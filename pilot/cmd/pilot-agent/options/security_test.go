@@ -0,0 +1,78 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package options
+
+import (
+	"reflect"
+	"testing"
+
+	meshconfig "istio.io/api/mesh/v1alpha1"
+	"istio.io/istio/pkg/security"
+)
+
+func TestSetupSecurityOptionsSigAlg(t *testing.T) {
+	tests := []struct {
+		sigAlg  string
+		wantErr bool
+	}{
+		{sigAlg: "", wantErr: false},
+		{sigAlg: "ECDSA", wantErr: false},
+		{sigAlg: "RSA_PSS", wantErr: false},
+		{sigAlg: "ECDSA_P384", wantErr: true},
+		{sigAlg: "ED25519", wantErr: true},
+		{sigAlg: "DSA", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.sigAlg, func(t *testing.T) {
+			_, err := SetupSecurityOptions(&meshconfig.ProxyConfig{}, &security.Options{ECCSigAlg: tt.sigAlg}, "", "", "")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseCSRDNSNames(t *testing.T) {
+	if got := parseCSRDNSNames(""); got != nil {
+		t.Errorf("expected no DNS names, got %v", got)
+	}
+	got, want := parseCSRDNSNames(" a.example.com, ,b.example.com,"), []string{"a.example.com", "b.example.com"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestParseNamedSecrets(t *testing.T) {
+	tests := []struct {
+		name    string
+		secrets string
+		wantErr bool
+	}{
+		{name: "empty", secrets: "", wantErr: false},
+		{name: "files", secrets: `{"partner":{"certificate":"/cert.pem","privateKey":"/key.pem"}}`, wantErr: false},
+		{name: "kubernetes", secrets: `{"partner":{"kubernetesSecret":"partner"}}`, wantErr: false},
+		{name: "root suffix", secrets: `{"partner-cacert":{"kubernetesSecret":"partner"}}`, wantErr: true},
+		{name: "empty name", secrets: `{"":{"kubernetesSecret":"partner"}}`, wantErr: true},
+		{name: "invalid source", secrets: `{"partner":{}}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseNamedSecrets(tt.secrets)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -108,8 +108,16 @@ func init() {
 	// Process commandline args.
 	discoveryCmd.PersistentFlags().StringSliceVar(&serverArgs.RegistryOptions.Registries, "registries",
 		[]string{string(serviceregistry.Kubernetes)},
-		fmt.Sprintf("Comma separated list of platform service registries to read from (choose one or more from {%s, %s})",
-			serviceregistry.Kubernetes, serviceregistry.Mock))
+		fmt.Sprintf("Comma separated list of platform service registries to read from (choose one or more from {%s, %s, %s, %s, %s})",
+			serviceregistry.Kubernetes, serviceregistry.Mock, serviceregistry.File, serviceregistry.Consul, serviceregistry.Snapshot))
+	discoveryCmd.PersistentFlags().StringVar(&serverArgs.RegistryOptions.FileRegistryDir, "fileRegistryDir", "",
+		fmt.Sprintf("Directory of the YAML and JSON files describing the services of the %s registry. "+
+			"Its subdirectories are ignored", serviceregistry.File))
+	discoveryCmd.PersistentFlags().StringVar(&serverArgs.RegistryOptions.ConsulServerAddr, "consulserverURL", "",
+		fmt.Sprintf("URL of the HTTP API of the catalog of the %s registry", serviceregistry.Consul))
+	discoveryCmd.PersistentFlags().StringVar(&serverArgs.RegistryOptions.SnapshotFile, "snapshot", "",
+		fmt.Sprintf("Snapshot archive, exported from /debug/snapshot, to read the configs and the services of the %s registry from",
+			serviceregistry.Snapshot))
 	discoveryCmd.PersistentFlags().StringVar(&serverArgs.RegistryOptions.ClusterRegistriesNamespace, "clusterRegistriesNamespace",
 		serverArgs.RegistryOptions.ClusterRegistriesNamespace, "Namespace for ConfigMap which stores clusters configs")
 	discoveryCmd.PersistentFlags().StringVar(&serverArgs.RegistryOptions.KubeConfig, "kubeconfig", "",
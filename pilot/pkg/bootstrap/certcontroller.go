@@ -167,6 +167,15 @@ func (s *Server) initDNSCerts(hostname, customHost, namespace string) error {
 			if err != nil {
 				return fmt.Errorf("failed reading %s: %v", path.Join(LocalCertDir.Get(), "root-cert.pem"), err)
 			}
+			if s.CA.PluggedCertRotationStatus() != nil {
+				s.addStartFunc(func(stop <-chan struct{}) error {
+					go func() {
+						// regenerate istiod key cert when the plugged-in cert is rotated.
+						s.watchRootCertAndGenKeyCert(names, stop)
+					}()
+					return nil
+				})
+			}
 		}
 	} else {
 		log.Infof("User specified cert provider: %v", features.PilotCertProvider.Get())
@@ -178,15 +187,16 @@ func (s *Server) initDNSCerts(hostname, customHost, namespace string) error {
 
 // TODO(hzxuzonghu): support async notification instead of polling the CA root cert.
 func (s *Server) watchRootCertAndGenKeyCert(names []string, stop <-chan struct{}) {
-	caBundle := s.CA.GetCAKeyCertBundle().GetRootCertPem()
+	signingCert, _, _, caBundle := s.CA.GetCAKeyCertBundle().GetAllPem()
 	for {
 		select {
 		case <-stop:
 			return
 		case <-time.After(controller.NamespaceResyncPeriod):
-			newRootCert := s.CA.GetCAKeyCertBundle().GetRootCertPem()
-			if !bytes.Equal(caBundle, newRootCert) {
-				caBundle = newRootCert
+			// The signing cert of a plugged-in CA may be rotated without a root cert change.
+			newSigningCert, _, _, newRootCert := s.CA.GetCAKeyCertBundle().GetAllPem()
+			if !bytes.Equal(caBundle, newRootCert) || !bytes.Equal(signingCert, newSigningCert) {
+				signingCert, caBundle = newSigningCert, newRootCert
 				certChain, keyPEM, err := s.CA.GenKeyCert(names, SelfSignedCACertTTL.Get(), false)
 				if err != nil {
 					log.Errorf("failed generating istiod key cert %v", err)
@@ -60,7 +60,11 @@ const (
 func (s *Server) initConfigController(args *PilotArgs) error {
 	s.initStatusController(args, features.EnableStatus)
 	meshConfig := s.environment.Mesh()
-	if len(meshConfig.ConfigSources) > 0 {
+	if s.snapshot != nil {
+		// The configs of the snapshot - they were validated by the istiod they were captured from,
+		// and the config sources of its mesh config are ignored.
+		s.ConfigStores = append(s.ConfigStores, s.makeSnapshotConfigStore())
+	} else if len(meshConfig.ConfigSources) > 0 {
 		// Using MCP for config.
 		if err := s.initConfigSources(args); err != nil {
 			return err
@@ -171,6 +175,15 @@ func (s *Server) initK8SConfigStore(args *PilotArgs) error {
 		return err
 	}
 	s.XDSServer.WorkloadEntryController = workloadentry.NewController(configController, args.PodName, args.KeepaliveOptions.MaxServerConnectionAge)
+	if features.WorkloadEntryActiveHealthChecks {
+		s.addTerminatingStartFunc(func(stop <-chan struct{}) error {
+			leaderelection.
+				NewLeaderElection(args.Namespace, args.PodName, leaderelection.WorkloadEntryHealthController, s.kubeClient).
+				AddRunFunction(workloadentry.NewActiveHealthChecker(configController).Run).
+				Run(stop)
+			return nil
+		})
+	}
 	return nil
 }
 
@@ -332,3 +345,20 @@ func (s *Server) makeFileMonitor(fileDir string, domainSuffix string, configCont
 
 	return nil
 }
+
+// makeSnapshotConfigStore creates an in-memory config store of the configs of the snapshot.
+func (s *Server) makeSnapshotConfigStore() model.ConfigStoreCache {
+	schemas := collections.Pilot
+	if features.EnableServiceApis {
+		schemas = collections.PilotServiceApi
+	}
+	// The store is filled before the controller is created, as the events of the controller are not
+	// processed until it runs.
+	store := memory.MakeSkipValidation(schemas)
+	for _, cfg := range s.snapshot.Configs {
+		if _, err := store.Create(cfg); err != nil {
+			log.Warnf("failed to load %v %s/%s of snapshot: %v", cfg.GroupVersionKind, cfg.Namespace, cfg.Name, err)
+		}
+	}
+	return memory.NewController(store)
+}
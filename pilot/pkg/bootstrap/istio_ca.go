@@ -20,6 +20,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"net/http"
 	"os"
 	"path"
 	"strings"
@@ -40,6 +41,7 @@ import (
 	"istio.io/istio/security/pkg/cmd"
 	"istio.io/istio/security/pkg/pki/ca"
 	"istio.io/istio/security/pkg/pki/ra"
+	"istio.io/istio/security/pkg/pki/util"
 	caserver "istio.io/istio/security/pkg/server/ca"
 	"istio.io/istio/security/pkg/server/ca/authenticate"
 	"istio.io/pkg/env"
@@ -116,6 +118,20 @@ var (
 			"Jitter selects a backoff time in seconds to start root cert rotator, "+
 			"and the back off time is below root cert check interval.")
 
+	pluggedCertCheckInterval = env.RegisterDurationVar("CITADEL_PLUGGED_CERT_CHECK_INTERVAL", time.Minute,
+		"The interval that the plugged-in CA certs are read at, in addition to the file events, to rotate them "+
+			"without restarting istiod. Setting this interval to zero or a negative value disables the rotation.")
+
+	pluggedRootCertPropagation = env.RegisterDurationVar("CITADEL_PLUGGED_ROOT_CERT_PROPAGATION", cmd.DefaultWorkloadCertTTL,
+		"When the roots of the plugged-in CA certs change, the time the new roots are distributed to workloads "+
+			"before the new CA cert signs their certificates. It should not be shorter than the workload cert TTL, "+
+			"since workloads get the new roots when their certificates are rotated. Setting it to zero uses the new "+
+			"CA cert right away.")
+
+	pluggedRootCertOverlap = env.RegisterDurationVar("CITADEL_PLUGGED_ROOT_CERT_OVERLAP", cmd.DefaultWorkloadCertTTL,
+		"When the roots of the plugged-in CA certs change, the time the previous roots are still distributed "+
+			"after the new CA cert signs workload certificates. It should not be shorter than the workload cert TTL.")
+
 	k8sInCluster = env.RegisterStringVar("KUBERNETES_SERVICE_HOST", "",
 		"Kuberenetes service host, set automatically when running in-cluster")
 
@@ -129,14 +145,74 @@ var (
 	caRSAKeySize = env.RegisterIntVar("CITADEL_SELF_SIGNED_CA_RSA_KEY_SIZE", 2048,
 		"Specify the RSA key size to use for self-signed Istio CA certificates.")
 
+	caKeyAlgorithm = env.RegisterStringVar("CITADEL_SELF_SIGNED_CA_KEY_ALGORITHM", "",
+		"The key algorithm of self-signed Istio CA certificates: ECDSA (P256), ECDSA_P384, ED25519 or RSA_PSS. "+
+			"If empty, RSA keys of CITADEL_SELF_SIGNED_CA_RSA_KEY_SIZE signing with PKCS#1 v1.5 are used. "+
+			"The algorithm of an existing CA is not changed.")
+
+	awsIdentities = env.RegisterStringVar("AWS_IAM_IDENTITIES", "",
+		"Comma separated list of <IAM role ARN>=<namespace>/<service account>, e.g. "+
+			"arn:aws:iam::123456789012:role/web=vm/web, mapping the IAM roles of VMs to the identity of their "+
+			"workloads. If set, VMs using the AmazonEC2 credential fetcher are authenticated by sending the "+
+			"STS GetCallerIdentity requests presigned by their agent to STS.")
+
+	azureIdentityJwtRule = env.RegisterStringVar("AZURE_MANAGED_IDENTITY_JWT_RULE", "",
+		"The JWTRule verifying the managed identity tokens of VMs using the AzureVM credential fetcher, e.g. "+
+			`{"issuer": "https://sts.windows.net/<tenant ID>/", "audiences": ["<resource>"]}. `+
+			"The identities are mapped by AZURE_MANAGED_IDENTITIES.")
+
+	azureIdentities = env.RegisterStringVar("AZURE_MANAGED_IDENTITIES", "",
+		"Comma separated list of <identity resource ID or principal ID>=<namespace>/<service account>, "+
+			"mapping Azure managed identities to the identity of the workloads of their VMs.")
+
+	enableCACRL = env.RegisterBoolVar("CITADEL_ENABLE_CRL", false,
+		"If true, the Istio CA maintains a certificate revocation list, which is distributed to workloads "+
+			"with the root cert so that revoked peer certificates are rejected.")
+
+	caCRLValidity = env.RegisterDurationVar("CITADEL_CRL_VALIDITY", ca.DefaultCRLValidity,
+		"The validity of the certificate revocation list signed by the Istio CA. The list is signed again "+
+			"after half of it.")
+
 	// TODO: Likely to be removed and added to mesh config
 	externalCaType = env.RegisterStringVar("EXTERNAL_CA", "",
-		"External CA Integration Type. Permitted Values are ISTIOD_RA_KUBERNETES_API or "+
-			"ISTIOD_RA_ISTIO_API").Get()
+		"External CA Integration Type. Permitted Values are ISTIOD_RA_KUBERNETES_API, "+
+			"ISTIOD_RA_ISTIO_API, ISTIOD_RA_VAULT_API, ISTIOD_RA_ACME or ISTIOD_RA_EXEC").Get()
 
 	// TODO: Likely to be removed and added to mesh config
 	k8sSigner = env.RegisterStringVar("K8S_SIGNER", "",
 		"Kubernates CA Signer type. Valid from Kubernates 1.18").Get()
+
+	externalCaAddr = env.RegisterStringVar("EXTERNAL_CA_ADDR", "",
+		"Address of the external CA: the Vault server URL for ISTIOD_RA_VAULT_API, the ACME directory URL "+
+			"for ISTIOD_RA_ACME, or the gRPC address of the signer, such as unix:///path, for ISTIOD_RA_ISTIO_API").Get()
+
+	externalCaServerRootCert = env.RegisterStringVar("EXTERNAL_CA_SERVER_ROOT_CERT", "",
+		"File containing the root certificates verifying the TLS certificate of EXTERNAL_CA_ADDR. "+
+			"The system roots are used for HTTPS if not set, and plaintext is used for gRPC.").Get()
+
+	externalCaVaultTokenFile = env.RegisterStringVar("EXTERNAL_CA_VAULT_TOKEN_FILE", "",
+		"File containing the Vault token, which is read again for every request").Get()
+
+	externalCaVaultPKIPath = env.RegisterStringVar("EXTERNAL_CA_VAULT_PKI_PATH", ra.DefaultVaultPKIPath,
+		"Mount path of the Vault PKI secrets engine").Get()
+
+	externalCaVaultRole = env.RegisterStringVar("EXTERNAL_CA_VAULT_ROLE", "",
+		"Vault PKI role signing the workload certificates").Get()
+
+	externalCaACMEEABKeyID = env.RegisterStringVar("EXTERNAL_CA_ACME_EAB_KEY_ID", "",
+		"Key identifier of the ACME external account binding, if required by the ACME server").Get()
+
+	externalCaACMEEABKeyFile = env.RegisterStringVar("EXTERNAL_CA_ACME_EAB_KEY_FILE", "",
+		"File containing the base64url encoded HMAC key of the ACME external account binding").Get()
+
+	externalCaACMEAccountKeyFile = env.RegisterStringVar("EXTERNAL_CA_ACME_ACCOUNT_KEY_FILE", "",
+		"File containing the PEM encoded P-256 key of the ACME account, required for ISTIOD_RA_ACME. The key is "+
+			"generated and written to the file if it does not exist, so the same account is used across restarts.").Get()
+
+	externalCaExecCommand = env.RegisterStringVar("EXTERNAL_CA_EXEC_COMMAND", "",
+		"Command of the signer plugin for ISTIOD_RA_EXEC, with space separated arguments. The plugin reads a JSON "+
+			"request with the csr, subjectIDs, ttlSeconds and forCA fields on stdin, and writes the PEM encoded "+
+			"certificate chain on stdout.").Get()
 )
 
 // EnableCA returns whether CA functionality is enabled in istiod.
@@ -199,6 +275,8 @@ func (s *Server) RunCA(grpc *grpc.Server, ca caserver.CertificateAuthority, opts
 	if startErr != nil {
 		log.Fatalf("failed to create istio ca server: %v", startErr)
 	}
+	caServer.AuditLog = s.caAuditLog
+	caServer.CSRAuthorizer = s.caCSRAuthorizer
 
 	// TODO: if not set, parse Istiod's own token (if present) and get the issuer. The same issuer is used
 	// for all tokens - no need to configure twice. The token may also include cluster info to auto-configure
@@ -222,6 +300,41 @@ func (s *Server) RunCA(grpc *grpc.Server, ca caserver.CertificateAuthority, opts
 	log.Info("Istiod CA has started")
 }
 
+// initPlatformAuthenticators returns the authenticators of the credentials fetched by the agents of
+// VMs from AWS STS and the Azure metadata service.
+func initPlatformAuthenticators(trustDomain string) ([]security.Authenticator, error) {
+	var authenticators []security.Authenticator
+	if mapping := awsIdentities.Get(); mapping != "" {
+		identities, err := authenticate.ParsePlatformIdentities(mapping)
+		if err != nil {
+			return nil, err
+		}
+		log.Infof("Istiod authenticating the VMs of %d IAM roles", len(identities))
+		authenticators = append(authenticators, authenticate.NewAWSIdentityAuthenticator(identities, trustDomain))
+	}
+	if rule := azureIdentityJwtRule.Get(); rule != "" {
+		jwtRule := v1beta1.JWTRule{}
+		if err := json.Unmarshal([]byte(rule), &jwtRule); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal the Azure JWT rule: %v", err)
+		}
+		identities, err := authenticate.ParsePlatformIdentities(azureIdentities.Get())
+		if err != nil {
+			return nil, err
+		}
+		azureAuthn, err := authenticate.NewAzureIdentityAuthenticator(&jwtRule, identities, trustDomain)
+		if err != nil {
+			return nil, err
+		}
+		log.Infof("Istiod authenticating Azure managed identities issued by %s", jwtRule.Issuer)
+		authenticators = append(authenticators, azureAuthn)
+	}
+	return authenticators, nil
+}
+
+func (s *Server) caRotationz(w http.ResponseWriter, _ *http.Request) {
+	writeCAJSON(w, s.CA.PluggedCertRotationStatus())
+}
+
 // detectAuthEnv will use the JWT token that is mounted in istiod to set the default audience
 // and trust domain for Istiod, if not explicitly defined.
 // K8S will use the same kind of tokens for the pods, and the value in istiod's own token is
@@ -319,7 +432,8 @@ func (s *Server) createIstioCA(client corev1.CoreV1Interface, opts *caOptions) (
 			selfSignedRootCertCheckInterval.Get(), workloadCertTTL.Get(),
 			maxWorkloadCertTTL.Get(), opts.TrustDomain, true,
 			opts.Namespace, -1, client, rootCertFile,
-			enableJitterForRootCertRotator.Get(), caRSAKeySize.Get())
+			enableJitterForRootCertRotator.Get(), caRSAKeySize.Get(),
+			util.SupportedECSignatureAlgorithms(caKeyAlgorithm.Get()))
 		if err != nil {
 			return nil, fmt.Errorf("failed to create a self-signed istiod CA: %v", err)
 		}
@@ -338,7 +452,13 @@ func (s *Server) createIstioCA(client corev1.CoreV1Interface, opts *caOptions) (
 		if err != nil {
 			return nil, fmt.Errorf("failed to create an istiod CA: %v", err)
 		}
+		if caOpts.PluggedCertRotatorConfig != nil {
+			caOpts.PluggedCertRotatorConfig.CheckInterval = pluggedCertCheckInterval.Get()
+			caOpts.PluggedCertRotatorConfig.RootCertPropagation = pluggedRootCertPropagation.Get()
+			caOpts.PluggedCertRotatorConfig.RootCertOverlap = pluggedRootCertOverlap.Get()
+		}
 	}
+	caOpts.CRLValidity = caCRLValidity.Get()
 	istioCA, err := ca.NewIstioCA(caOpts)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create an istiod CA: %v", err)
@@ -346,7 +466,7 @@ func (s *Server) createIstioCA(client corev1.CoreV1Interface, opts *caOptions) (
 	// TODO: provide an endpoint returning all the roots. SDS can only pull a single root in current impl.
 	// ca.go saves or uses the secret, but also writes to the configmap "istio-security", under caTLSRootCert
 	// rootCertRotatorChan channel accepts signals to stop root cert rotator for
-	// self-signed CA.
+	// self-signed CA, or the plugged-in cert rotator.
 	rootCertRotatorChan := make(chan struct{})
 	// Start root cert rotator in a separate goroutine.
 	istioCA.Run(rootCertRotatorChan)
@@ -368,8 +488,20 @@ func (s *Server) createIstioRA(client kubelib.Client,
 		CaSigner:       opts.ExternalCASigner,
 		CaCertFile:     caCertFile,
 		VerifyAppendCA: true,
-		K8sClient:      client.CertificatesV1beta1(),
 		TrustDomain:    opts.TrustDomain,
+
+		CaAddress:            externalCaAddr,
+		CaServerRootCertFile: externalCaServerRootCert,
+		VaultTokenFile:       externalCaVaultTokenFile,
+		VaultPKIPath:         externalCaVaultPKIPath,
+		VaultRole:            externalCaVaultRole,
+		ACMEEABKeyID:         externalCaACMEEABKeyID,
+		ACMEEABKeyFile:       externalCaACMEEABKeyFile,
+		ACMEAccountKeyFile:   externalCaACMEAccountKeyFile,
+		PluginCommand:        strings.Fields(externalCaExecCommand),
+	}
+	if client != nil {
+		raOpts.K8sClient = client.CertificatesV1beta1()
 	}
 	return ra.NewIstioRA(raOpts)
 }
@@ -0,0 +1,78 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstrap
+
+import (
+	"fmt"
+	"net/http"
+
+	caserver "istio.io/istio/security/pkg/server/ca"
+	"istio.io/pkg/env"
+	"istio.io/pkg/log"
+)
+
+var (
+	caAuditLogFile = env.RegisterStringVar("CA_AUDIT_LOG_FILE", "",
+		"The file the records of the certificates issued by the CA, or the RA, are appended to as JSON lines. "+
+			"If empty, the records are only kept in memory.")
+
+	caAuditLogMaxSize = env.RegisterIntVar("CA_AUDIT_LOG_MAX_SIZE_MB", 100,
+		"The size, in megabytes, the CA audit log file is rotated at.")
+
+	caAuditLogMaxBackups = env.RegisterIntVar("CA_AUDIT_LOG_MAX_BACKUPS", 5,
+		"The number of rotated CA audit log files kept. At least one is kept.")
+
+	caAuditLogRecentRecords = env.RegisterIntVar("CA_AUDIT_LOG_RECENT_RECORDS", 10000,
+		"The number of records of the most recently issued certificates kept in memory, to be queried "+
+			"through the /debug/ca/audit endpoint. Setting it to zero or a negative value disables the audit log.")
+)
+
+// initCAAuditLog creates the log recording the certificates issued by the CA or RA server.
+func (s *Server) initCAAuditLog() error {
+	if caAuditLogRecentRecords.Get() <= 0 {
+		return nil
+	}
+	var sinks []caserver.AuditSink
+	if path := caAuditLogFile.Get(); path != "" {
+		sink, err := caserver.NewFileAuditSink(path, int64(caAuditLogMaxSize.Get())*1024*1024, caAuditLogMaxBackups.Get())
+		if err != nil {
+			return err
+		}
+		sinks = append(sinks, sink)
+		log.Infof("recording the certificates issued by the CA in %s", path)
+	}
+	s.caAuditLog = caserver.NewAuditLog(caAuditLogRecentRecords.Get(), sinks...)
+	s.addTerminatingStartFunc(func(stop <-chan struct{}) error {
+		<-stop
+		if err := s.caAuditLog.Close(); err != nil {
+			log.Warnf("failed to close the CA audit log: %v", err)
+		}
+		return nil
+	})
+	return nil
+}
+
+// caAuditz returns the recent records of the issued certificates, filtered by ?identity=<SPIFFE ID>
+// or ?serial=<hex serial>. With ?all=true, the audit log file is searched instead.
+func (s *Server) caAuditz(w http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	records, err := s.caAuditLog.Query(query.Get("identity"), query.Get("serial"), query.Get("all") == "true")
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(fmt.Sprintf("%v\n", err)))
+		return
+	}
+	writeCAJSON(w, records)
+}
@@ -0,0 +1,248 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstrap
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"path"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+
+	"istio.io/istio/security/pkg/pki/ca"
+	"istio.io/pkg/log"
+)
+
+const (
+	// caCRLSecretName is the Secret holding the certificates revoked by the Istio CA, shared by the
+	// istiod replicas.
+	caCRLSecretName = "istio-ca-crl"
+
+	// parentCRLFile is the optional file in the 'cacerts' Secret with the CRLs of the CAs above a
+	// plugged in intermediate CA.
+	parentCRLFile = "root-crl.pem"
+
+	crlSyncInterval = time.Minute
+)
+
+// initCACRL shares the certificates revoked by this replica of the Istio CA with the other replicas,
+// through a Secret in the CA namespace.
+func (s *Server) initCACRL(namespace string) {
+	if _, err := s.fetchCACRL(); err != nil {
+		log.Warnf("the CA revocation list will not be distributed: %v", err)
+	}
+	if s.kubeClient == nil {
+		return
+	}
+	s.caCRLNamespace = namespace
+	s.addStartFunc(func(stop <-chan struct{}) error {
+		go func() {
+			ticker := time.NewTicker(crlSyncInterval)
+			defer ticker.Stop()
+			for {
+				if err := s.syncCACRL(); err != nil {
+					log.Warnf("failed to sync the CA revocation list: %v", err)
+				}
+				select {
+				case <-stop:
+					return
+				case <-ticker.C:
+				}
+			}
+		}()
+		return nil
+	})
+}
+
+// syncCACRL merges the certificates revoked in the Secret with the ones revoked by this replica, and
+// writes the result back if the Secret was missing any.
+func (s *Server) syncCACRL() error {
+	secrets := s.kubeClient.CoreV1().Secrets(s.caCRLNamespace)
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		secret, err := secrets.Get(context.TODO(), caCRLSecretName, metav1.GetOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		found := err == nil
+		var stored map[string]struct{}
+		if found {
+			if _, err := s.CA.MergeCRL(secret.Data[ca.CRLID]); err != nil {
+				return err
+			}
+			if stored, err = revokedSerials(secret.Data[ca.CRLID]); err != nil {
+				return err
+			}
+		}
+		revoked := s.CA.RevokedCerts()
+		if len(revoked) == len(stored) {
+			// The CA has every certificate in the Secret, so they are the same.
+			return nil
+		}
+		crl, err := s.CA.GetCRLPem()
+		if err != nil {
+			return err
+		}
+		if !found {
+			_, err = secrets.Create(context.TODO(), &v1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: caCRLSecretName, Namespace: s.caCRLNamespace},
+				Data:       map[string][]byte{ca.CRLID: crl},
+			}, metav1.CreateOptions{})
+			return err
+		}
+		secret.Data = map[string][]byte{ca.CRLID: crl}
+		_, err = secrets.Update(context.TODO(), secret, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+// revokedSerials returns the hex encoded serial numbers listed by PEM encoded CRLs.
+func revokedSerials(crlPEM []byte) (map[string]struct{}, error) {
+	serials := map[string]struct{}{}
+	for rest := crlPEM; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			return serials, nil
+		}
+		crl, err := x509.ParseCRL(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse CRL: %v", err)
+		}
+		for _, rc := range crl.TBSCertList.RevokedCertificates {
+			serials[rc.SerialNumber.Text(16)] = struct{}{}
+		}
+	}
+}
+
+// fetchCACRL returns the certificate revocation lists distributed with the root cert: the CRL of the
+// Istio CA, followed by the CRLs of its parents when it is a plugged in intermediate CA. Envoy rejects
+// certificates issued by a CA without a CRL, so the CRL is not distributed if the parent CRLs are missing.
+func (s *Server) fetchCACRL() ([]byte, error) {
+	crl, err := s.CA.GetCRLPem()
+	if err != nil {
+		return nil, err
+	}
+	signingCert, _, _, _ := s.CA.GetCAKeyCertBundle().GetAll()
+	if bytes.Equal(signingCert.RawIssuer, signingCert.RawSubject) {
+		return crl, nil
+	}
+	parentCRL, err := ioutil.ReadFile(path.Join(LocalCertDir.Get(), parentCRLFile))
+	if err != nil {
+		return nil, fmt.Errorf("the CA is an intermediate CA, but the CRLs of its parents are missing: %v", err)
+	}
+	out := make([]byte, 0, len(crl)+len(parentCRL))
+	return append(append(out, crl...), parentCRL...), nil
+}
+
+// addCADebugHandlers adds the debug handlers listing and revoking the certificates issued by the Istio CA,
+// and showing the rotation of its plugged-in certificates.
+func (s *Server) addCADebugHandlers(mux *http.ServeMux) {
+	if s.caAuditLog != nil {
+		s.XDSServer.AddDebugHandler(mux, "/debug/ca/audit",
+			"The recently issued certificates, with ?identity=<SPIFFE ID> or ?serial=<hex serial> to filter them, "+
+				"and ?all=true to search the CA_AUDIT_LOG_FILE files", s.caAuditz)
+	}
+	if s.CA == nil {
+		return
+	}
+	if s.CA.PluggedCertRotationStatus() != nil {
+		s.XDSServer.AddDebugHandler(mux, "/debug/ca/rotation",
+			"The rotation phase, signing cert and trusted roots of the plugged-in Istio CA certificates", s.caRotationz)
+	}
+	if !enableCACRL.Get() {
+		return
+	}
+	s.XDSServer.AddDebugHandler(mux, "/debug/ca/crl", "The certificates revoked by the Istio CA", s.caCRLz)
+	s.XDSServer.AddDebugHandler(mux, "/debug/ca/revoke",
+		"Revokes certificates issued by the Istio CA, with POST and ?serial=<hex serial> or ?identity=<SPIFFE ID>. "+
+			"Only allowed from localhost, such as with 'pilot-discovery request POST'", s.caRevoke)
+}
+
+func (s *Server) caCRLz(w http.ResponseWriter, _ *http.Request) {
+	writeCAJSON(w, s.CA.RevokedCerts())
+}
+
+func (s *Server) caRevoke(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		_, _ = w.Write([]byte("only POST is allowed\n"))
+		return
+	}
+	// Revoking is not authenticated, so only callers with access to the istiod pod are allowed.
+	if host, _, err := net.SplitHostPort(req.RemoteAddr); err != nil || !net.ParseIP(host).IsLoopback() {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte("revoking is only allowed from localhost\n"))
+		return
+	}
+
+	var serials []*big.Int
+	var err error
+	serial, identity := req.URL.Query().Get("serial"), req.URL.Query().Get("identity")
+	switch {
+	case serial != "" && identity == "":
+		sn, ok := new(big.Int).SetString(serial, 16)
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(fmt.Sprintf("invalid hex serial number %q\n", serial)))
+			return
+		}
+		serials = []*big.Int{sn}
+		err = s.CA.Revoke(sn)
+	case identity != "" && serial == "":
+		serials, err = s.CA.RevokeIdentity(identity)
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte("exactly one of serial or identity must be set\n"))
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte(fmt.Sprintf("failed to revoke: %v\n", err)))
+		return
+	}
+	if s.caCRLNamespace != "" {
+		if err := s.syncCACRL(); err != nil {
+			log.Warnf("failed to sync the CA revocation list: %v", err)
+		}
+	}
+
+	revoked := make([]string, 0, len(serials))
+	for _, sn := range serials {
+		revoked = append(revoked, sn.Text(16))
+	}
+	writeCAJSON(w, revoked)
+}
+
+func writeCAJSON(w http.ResponseWriter, obj interface{}) {
+	b, err := json.MarshalIndent(obj, "", "  ")
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(b)
+}
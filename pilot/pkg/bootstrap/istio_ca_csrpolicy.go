@@ -0,0 +1,85 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstrap
+
+import (
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	caserver "istio.io/istio/security/pkg/server/ca"
+	"istio.io/pkg/env"
+	"istio.io/pkg/log"
+)
+
+var caCSRPolicyFile = env.RegisterStringVar("CA_CSR_POLICY_FILE", "",
+	"The YAML file of the policies authorizing the CSRs of the workloads of each namespace: the allowed SAN "+
+		"patterns, the max TTL, the allowed key types and whether DNS SANs are allowed. The file is reloaded "+
+		"when it changes. If empty, the CSRs are only authenticated.")
+
+// initCSRAuthorizer loads the CSR policies of the CA or RA server, and reloads them when the file changes.
+func (s *Server) initCSRAuthorizer() error {
+	file := caCSRPolicyFile.Get()
+	if file == "" {
+		return nil
+	}
+	policies, err := loadCSRPolicies(file)
+	if err != nil {
+		return err
+	}
+	s.caCSRAuthorizer = caserver.NewCSRAuthorizer(policies)
+	log.Infof("authorizing the CSRs with the policies of %s", file)
+
+	if err := s.fileWatcher.Add(file); err != nil {
+		return fmt.Errorf("could not watch %v: %v", file, err)
+	}
+	s.addStartFunc(func(stop <-chan struct{}) error {
+		go func() {
+			var reloadTimerC <-chan time.Time
+			for {
+				select {
+				case <-reloadTimerC:
+					reloadTimerC = nil
+					// The previous policies are kept if the file is invalid.
+					policies, err := loadCSRPolicies(file)
+					if err != nil {
+						log.Errorf("failed to reload the CSR policies: %v", err)
+						continue
+					}
+					s.caCSRAuthorizer.SetPolicies(policies)
+					log.Infof("reloaded the CSR policies of %s", file)
+				case <-s.fileWatcher.Events(file):
+					if reloadTimerC == nil {
+						reloadTimerC = time.After(watchDebounceDelay)
+					}
+				case err := <-s.fileWatcher.Errors(file):
+					log.Errorf("error watching %v: %v", file, err)
+				case <-stop:
+					return
+				}
+			}
+		}()
+		return nil
+	})
+	return nil
+}
+
+func loadCSRPolicies(file string) (*caserver.CSRPolicies, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the CSR policies: %v", err)
+	}
+	return caserver.ParseCSRPolicies(b)
+}
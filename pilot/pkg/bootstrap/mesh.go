@@ -45,6 +45,8 @@ const (
 // - if a file exist, load it - will be merged
 // - if istio-REVISION exists, will be used, even if the file is present.
 // - the SHARED_MESH_CONFIG config map will also be loaded and merged.
+//
+// If istiod is started from a snapshot with a mesh config, the mesh config of the snapshot is used.
 func (s *Server) initMeshConfiguration(args *PilotArgs, fileWatcher filewatcher.FileWatcher) {
 	log.Info("initializing mesh configuration ", args.MeshConfigFile)
 	defer func() {
@@ -57,6 +59,12 @@ func (s *Server) initMeshConfiguration(args *PilotArgs, fileWatcher filewatcher.
 		}
 	}()
 
+	if s.snapshot != nil && s.snapshot.MeshConfig != nil {
+		s.environment.Watcher = mesh.NewFixedWatcher(s.snapshot.MeshConfig)
+		log.Warnf("Using mesh config of snapshot %s, file and in cluster configs ignored", args.RegistryOptions.SnapshotFile)
+		return
+	}
+
 	// Watcher will be merging more than one mesh config source?
 	multiWatch := features.SharedMeshConfig != ""
 
@@ -107,6 +115,11 @@ func (s *Server) initMeshNetworks(args *PilotArgs, fileWatcher filewatcher.FileW
 		return
 	}
 	log.Info("initializing mesh networks")
+	if s.snapshot != nil && s.snapshot.MeshNetworks != nil {
+		log.Infof("initializing mesh networks from snapshot %s", args.RegistryOptions.SnapshotFile)
+		s.environment.NetworksWatcher = mesh.NewFixedNetworksWatcher(s.snapshot.MeshNetworks)
+		return
+	}
 	if args.NetworksConfigFile != "" {
 		var err error
 		s.environment.NetworksWatcher, err = mesh.NewNetworksWatcher(fileWatcher, args.NetworksConfigFile)
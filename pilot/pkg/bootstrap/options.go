@@ -36,6 +36,16 @@ type RegistryOptions struct {
 
 	Registries []string
 
+	// FileRegistryDir is the directory of the services of the File registry
+	FileRegistryDir string
+
+	// ConsulServerAddr is the URL of the HTTP API of the catalog of the Consul registry
+	ConsulServerAddr string
+
+	// SnapshotFile is the snapshot archive the configs, and the services of the Snapshot registry, are read from.
+	// If set, the configs are not read from Kubernetes or FileDir.
+	SnapshotFile string
+
 	// Kubernetes controller options
 	KubeOptions kubecontroller.Options
 	// ClusterRegistriesNamespace specifies where the multi-cluster secret resides
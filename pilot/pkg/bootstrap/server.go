@@ -53,6 +53,7 @@ import (
 	"istio.io/istio/pilot/pkg/serviceregistry/aggregate"
 	kubecontroller "istio.io/istio/pilot/pkg/serviceregistry/kube/controller"
 	"istio.io/istio/pilot/pkg/serviceregistry/serviceentry"
+	"istio.io/istio/pilot/pkg/snapshot"
 	"istio.io/istio/pilot/pkg/status"
 	tb "istio.io/istio/pilot/pkg/trustbundle"
 	"istio.io/istio/pilot/pkg/xds"
@@ -70,6 +71,7 @@ import (
 	"istio.io/istio/security/pkg/k8s/chiron"
 	"istio.io/istio/security/pkg/pki/ca"
 	"istio.io/istio/security/pkg/pki/ra"
+	caserver "istio.io/istio/security/pkg/server/ca"
 	"istio.io/istio/security/pkg/server/ca/authenticate"
 	"istio.io/istio/security/pkg/server/ca/authenticate/kubeauth"
 	"istio.io/pkg/ctrlz"
@@ -124,6 +126,9 @@ type Server struct {
 	ConfigStores      []model.ConfigStoreCache
 	serviceEntryStore *serviceentry.ServiceEntryStore
 
+	// snapshot is the snapshot istiod is started from, if any.
+	snapshot *snapshot.Snapshot
+
 	httpServer       *http.Server // debug, monitoring and readiness Server.
 	httpsServer      *http.Server // webhooks HTTPS Server.
 	httpsReadyClient *http.Client
@@ -156,6 +161,12 @@ type Server struct {
 	certController *chiron.WebhookController
 	CA             *ca.IstioCA
 	RA             ra.RegistrationAuthority
+	// caCRLNamespace is the namespace of the Secret sharing the certificates revoked by the CA.
+	caCRLNamespace string
+	// caAuditLog records the certificates issued by the CA or RA server.
+	caAuditLog *caserver.AuditLog
+	// caCSRAuthorizer authorizes the CSRs of the CA or RA server.
+	caCSRAuthorizer *caserver.CSRAuthorizer
 
 	// TrustAnchors for workload to workload mTLS
 	workloadTrustBundle     *tb.TrustBundle
@@ -227,9 +238,14 @@ func NewServer(args *PilotArgs, initFuncs ...func(*Server)) (*Server, error) {
 	} else {
 		args.RegistryOptions.KubeOptions.EndpointMode = kubecontroller.EndpointsOnly
 	}
+	args.RegistryOptions.KubeOptions.EnableMCSServiceDiscovery = features.EnableMCSServiceDiscovery
 
 	prometheus.EnableHandlingTimeHistogram()
 
+	if err := s.initSnapshot(args); err != nil {
+		return nil, fmt.Errorf("error reading snapshot: %v", err)
+	}
+
 	// Apply the arguments to the configuration.
 	if err := s.initKubeClient(args); err != nil {
 		return nil, fmt.Errorf("error initializing kube client: %v", err)
@@ -331,6 +347,11 @@ func NewServer(args *PilotArgs, initFuncs ...func(*Server)) (*Server, error) {
 		}
 		authenticators = append(authenticators, jwtAuthn)
 	}
+	platformAuthn, err := initPlatformAuthenticators(s.environment.Mesh().TrustDomain)
+	if err != nil {
+		return nil, fmt.Errorf("error initializing VM platform authenticators: %v", err)
+	}
+	authenticators = append(authenticators, platformAuthn...)
 	// The k8s JWT authenticator requires the multicluster registry to be initialized,
 	// so we build it later.
 	authenticators = append(authenticators,
@@ -533,6 +554,7 @@ func (s *Server) initSDSServer(args *PilotArgs) {
 					})
 				})
 				s.XDSServer.Generators[v3.SecretType] = xds.NewSecretGen(sc, s.XDSServer.Cache)
+				s.XDSServer.Generators[v3.ExtensionConfigurationType] = &xds.EcdsGenerator{Server: s.XDSServer, SecretController: sc}
 				s.secretsController = sc
 				return nil
 			})
@@ -540,13 +562,31 @@ func (s *Server) initSDSServer(args *PilotArgs) {
 	}
 }
 
+// initSnapshot reads the snapshot istiod is started from, if set.
+func (s *Server) initSnapshot(args *PilotArgs) error {
+	if args.RegistryOptions.SnapshotFile == "" {
+		return nil
+	}
+	snap, err := snapshot.ReadFile(args.RegistryOptions.SnapshotFile)
+	if err != nil {
+		return err
+	}
+	log.Infof("starting from snapshot %s, captured at %v from istiod %s",
+		args.RegistryOptions.SnapshotFile, snap.Time, snap.IstiodVersion)
+	if snap.DomainSuffix != "" {
+		s.environment.DomainSuffix = snap.DomainSuffix
+	}
+	s.snapshot = snap
+	return nil
+}
+
 // initKubeClient creates the k8s client if running in an k8s environment.
 // This is determined by the presence of a kube registry, which
 // uses in-context k8s, or a config source of type k8s.
 func (s *Server) initKubeClient(args *PilotArgs) error {
 	hasK8SConfigStore := false
-	if args.RegistryOptions.FileDir == "" {
-		// If file dir is set - config controller will just use file.
+	if args.RegistryOptions.FileDir == "" && s.snapshot == nil {
+		// If file dir or snapshot is set - config controller will just use them.
 		if _, err := os.Stat(args.MeshConfigFile); !os.IsNotExist(err) {
 			meshConfig, err := mesh.ReadMeshConfig(args.MeshConfigFile)
 			if err != nil {
@@ -618,11 +658,13 @@ func (s *Server) initIstiodAdminServer(args *PilotArgs, whc func() map[string]st
 
 	// Debug Server.
 	s.XDSServer.InitDebug(s.monitoringMux, s.ServiceController(), args.ServerOptions.EnableProfiling, whc)
+	s.addCADebugHandlers(s.monitoringMux)
 
 	// Debug handlers are currently added on monitoring mux and readiness mux.
 	// If monitoring addr is empty, the mux is shared and we only add it once on the shared mux .
 	if !shouldMultiplex {
 		s.XDSServer.AddDebugHandlers(s.httpMux, args.ServerOptions.EnableProfiling, whc)
+		s.addCADebugHandlers(s.httpMux)
 	}
 
 	// Monitoring Server.
@@ -879,7 +921,7 @@ func (s *Server) initRegistryEventHandlers() {
 			}: {}},
 			Reason: []model.TriggerReason{model.ServiceUpdate},
 		}
-		s.XDSServer.ConfigUpdate(pushReq)
+		s.XDSServer.ConfigUpdate(pushReq.Traced("registry/" + svc.Attributes.ServiceRegistry))
 	}
 	s.ServiceController().AppendServiceHandler(serviceHandler)
 
@@ -894,7 +936,7 @@ func (s *Server) initRegistryEventHandlers() {
 				}: {}},
 				Reason: []model.TriggerReason{model.ConfigUpdate},
 			}
-			s.XDSServer.ConfigUpdate(pushReq)
+			s.XDSServer.ConfigUpdate(pushReq.Traced("config"))
 			if event != model.EventDelete {
 				s.statusReporter.AddInProgressResource(curr)
 			} else {
@@ -1057,11 +1099,25 @@ func (s *Server) maybeCreateCA(caOpts *caOptions) error {
 		if s.CA, err = s.createIstioCA(corev1, caOpts); err != nil {
 			return fmt.Errorf("failed to create CA: %v", err)
 		}
+		if s.CA != nil {
+			s.CA.SetPluggedRootCertsHandler(s.updatePluggedRootCerts)
+		}
+		if enableCACRL.Get() {
+			s.initCACRL(caOpts.Namespace)
+		}
 		if caOpts.ExternalCAType != "" {
 			if s.RA, err = s.createIstioRA(s.kubeClient, caOpts); err != nil {
 				return fmt.Errorf("failed to create RA: %v", err)
 			}
 		}
+		if s.CA != nil || s.RA != nil {
+			if err := s.initCAAuditLog(); err != nil {
+				return fmt.Errorf("failed to create the CA audit log: %v", err)
+			}
+			if err := s.initCSRAuthorizer(); err != nil {
+				return fmt.Errorf("failed to load the CSR policies: %v", err)
+			}
+		}
 	}
 	return nil
 }
@@ -1098,9 +1154,17 @@ func (s *Server) fetchCARoot() map[string]string {
 		return nil
 	}
 
-	return map[string]string{
+	data := map[string]string{
 		constants.CACertNamespaceConfigMapDataName: string(s.CA.GetCAKeyCertBundle().GetRootCertPem()),
 	}
+	if enableCACRL.Get() {
+		if crl, err := s.fetchCACRL(); err == nil {
+			data[constants.CACRLNamespaceConfigMapDataName] = string(crl)
+		} else {
+			log.Debugf("not distributing the CA revocation list: %v", err)
+		}
+	}
+	return data
 }
 
 // initMeshHandlers initializes mesh and network handlers.
@@ -1110,16 +1174,18 @@ func (s *Server) initMeshHandlers() {
 	s.environment.AddMeshHandler(func() {
 		spiffe.SetTrustDomain(s.environment.Mesh().GetTrustDomain())
 		s.XDSServer.ConfigGenerator.MeshConfigChanged(s.environment.Mesh())
-		s.XDSServer.ConfigUpdate(&model.PushRequest{
+		pushReq := &model.PushRequest{
 			Full:   true,
 			Reason: []model.TriggerReason{model.GlobalUpdate},
-		})
+		}
+		s.XDSServer.ConfigUpdate(pushReq.Traced("meshconfig"))
 	})
 	s.environment.AddNetworksHandler(func() {
-		s.XDSServer.ConfigUpdate(&model.PushRequest{
+		pushReq := &model.PushRequest{
 			Full:   true,
 			Reason: []model.TriggerReason{model.GlobalUpdate},
-		})
+		}
+		s.XDSServer.ConfigUpdate(pushReq.Traced("meshnetworks"))
 	})
 }
 
@@ -1141,13 +1207,34 @@ func (s *Server) addIstioCAToTrustBundle(args *PilotArgs) error {
 	return nil
 }
 
+// updatePluggedRootCerts distributes the roots trusted by the CA when the rotation of the plugged-in certs
+// changes them: the new roots are trusted before the CA signs with them, and the previous roots until the
+// overlap ends. Workloads get the roots with their certificates and from the istio-ca-root-cert ConfigMaps,
+// which are reconciled every NamespaceResyncPeriod, and from the trust bundle when it is enabled.
+func (s *Server) updatePluggedRootCerts(rootCertPEM []byte) {
+	if err := s.workloadTrustBundle.UpdateTrustAnchor(&tb.TrustAnchorUpdate{
+		TrustAnchorConfig: tb.TrustAnchorConfig{Certs: []string{string(rootCertPEM)}},
+		Source:            tb.SourceIstioCA,
+	}); err != nil {
+		log.Errorf("unable to update the rotated CA roots as trustAnchor: %v", err)
+	}
+}
+
 func (s *Server) initWorkloadTrustBundle(args *PilotArgs) error {
 	var err error
 
-	if !features.MultiRootMesh.Get() {
+	if !features.MultiRootMesh.Get() && features.SpiffeFederationBundleEndpoints == "" {
 		return nil
 	}
 
+	if features.SpiffeFederationBundleEndpoints != "" {
+		endpoints, err := spiffe.ParseBundleEndpoints(features.SpiffeFederationBundleEndpoints)
+		if err != nil {
+			return fmt.Errorf("invalid SPIFFE federation bundle endpoints: %v", err)
+		}
+		s.workloadTrustBundle.SetFederatedTrustDomains(endpoints)
+	}
+
 	s.workloadTrustBundle.UpdateCb(func() {
 		pushReq := &model.PushRequest{
 			Full:   true,
@@ -20,14 +20,34 @@ import (
 	"istio.io/istio/pilot/pkg/model"
 	"istio.io/istio/pilot/pkg/serviceregistry"
 	"istio.io/istio/pilot/pkg/serviceregistry/aggregate"
+	"istio.io/istio/pilot/pkg/serviceregistry/consul"
+	"istio.io/istio/pilot/pkg/serviceregistry/file"
 	kubecontroller "istio.io/istio/pilot/pkg/serviceregistry/kube/controller"
 	"istio.io/istio/pilot/pkg/serviceregistry/mock"
 	"istio.io/istio/pilot/pkg/serviceregistry/serviceentry"
+	"istio.io/istio/pilot/pkg/snapshot"
 	"istio.io/istio/pkg/config/host"
 	"istio.io/istio/pkg/kube/secretcontroller"
+	"istio.io/pkg/env"
 	"istio.io/pkg/log"
 )
 
+// The credentials of the catalog of the Consul registry are read from the environment variables of the
+// Consul CLI, rather than flags, so that the ACL token is not visible in the command line.
+var (
+	consulToken = env.RegisterStringVar("CONSUL_HTTP_TOKEN", "",
+		"The ACL token of the requests to the catalog of the Consul registry").Get()
+	consulTokenFile = env.RegisterStringVar("CONSUL_HTTP_TOKEN_FILE", "",
+		"The file holding the ACL token of the requests to the catalog of the Consul registry. "+
+			"It is read on every request, and takes precedence over CONSUL_HTTP_TOKEN").Get()
+	consulCACert = env.RegisterStringVar("CONSUL_CACERT", "",
+		"The file of the CA certificates verifying the certificate of the catalog of the Consul registry").Get()
+	consulClientCert = env.RegisterStringVar("CONSUL_CLIENT_CERT", "",
+		"The file of the client certificate presented to the catalog of the Consul registry").Get()
+	consulClientKey = env.RegisterStringVar("CONSUL_CLIENT_KEY", "",
+		"The file of the key of the client certificate presented to the catalog of the Consul registry").Get()
+)
+
 func (s *Server) ServiceController() *aggregate.Controller {
 	return s.environment.ServiceDiscovery.(*aggregate.Controller)
 }
@@ -58,6 +78,18 @@ func (s *Server) initServiceControllers(args *PilotArgs) error {
 			}
 		case serviceregistry.Mock:
 			s.initMockRegistry()
+		case serviceregistry.File:
+			if err := s.initFileRegistry(args); err != nil {
+				return err
+			}
+		case serviceregistry.Consul:
+			if err := s.initConsulRegistry(args); err != nil {
+				return err
+			}
+		case serviceregistry.Snapshot:
+			if err := s.initSnapshotRegistry(); err != nil {
+				return err
+			}
 		default:
 			return fmt.Errorf("service registry %s is not supported", r)
 		}
@@ -123,6 +155,50 @@ func (s *Server) initKubeRegistry(args *PilotArgs) (err error) {
 	return
 }
 
+// initFileRegistry creates the service registry of the services described by the files of a directory
+func (s *Server) initFileRegistry(args *PilotArgs) error {
+	if args.RegistryOptions.FileRegistryDir == "" {
+		return fmt.Errorf("the %s registry requires a directory of services", serviceregistry.File)
+	}
+	s.ServiceController().AddRegistry(file.NewServiceDiscovery(file.Options{
+		Dir:        args.RegistryOptions.FileRegistryDir,
+		ClusterID:  s.clusterID,
+		XDSUpdater: s.XDSServer,
+	}))
+	return nil
+}
+
+// initConsulRegistry creates the service registry of the services of a Consul catalog
+func (s *Server) initConsulRegistry(args *PilotArgs) error {
+	if args.RegistryOptions.ConsulServerAddr == "" {
+		return fmt.Errorf("the %s registry requires the URL of the catalog", serviceregistry.Consul)
+	}
+	controller, err := consul.NewController(consul.Options{
+		ServerAddr:     args.RegistryOptions.ConsulServerAddr,
+		ClusterID:      s.clusterID,
+		XDSUpdater:     s.XDSServer,
+		Token:          consulToken,
+		TokenFile:      consulTokenFile,
+		CACertFile:     consulCACert,
+		ClientCertFile: consulClientCert,
+		ClientKeyFile:  consulClientKey,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create the %s registry: %v", serviceregistry.Consul, err)
+	}
+	s.ServiceController().AddRegistry(controller)
+	return nil
+}
+
+// initSnapshotRegistry creates the service registry of the services of the snapshot istiod is started from
+func (s *Server) initSnapshotRegistry() error {
+	if s.snapshot == nil {
+		return fmt.Errorf("the %s registry requires a snapshot", serviceregistry.Snapshot)
+	}
+	s.ServiceController().AddRegistry(snapshot.NewRegistry(s.snapshot, s.clusterID, s.XDSServer))
+	return nil
+}
+
 func (s *Server) initMockRegistry() {
 	// MemServiceDiscovery implementation
 	discovery := mock.NewDiscovery(map[host.Name]*model.Service{}, 2)
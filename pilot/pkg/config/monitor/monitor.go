@@ -54,8 +54,9 @@ func NewMonitor(name string, delegateStore model.ConfigStore, getSnapshotFunc fu
 
 const watchDebounceDelay = 50 * time.Millisecond
 
-// Trigger notifications when a file is mutated
-func fileTrigger(path string, ch chan struct{}, stop <-chan struct{}) error {
+// FileTrigger sends a notification on ch, debounced, whenever the file or directory path is mutated,
+// until stop is closed.
+func FileTrigger(path string, ch chan struct{}, stop <-chan struct{}) error {
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
 		return err
@@ -95,7 +96,7 @@ func (m *Monitor) Start(stop <-chan struct{}) {
 
 	c := make(chan struct{}, 1)
 	m.updateCh = c
-	if err := fileTrigger(m.root, m.updateCh, stop); err != nil {
+	if err := FileTrigger(m.root, m.updateCh, stop); err != nil {
 		log.Errorf("Unable to setup FileTrigger for %s: %v", m.root, err)
 	}
 	// Run the close loop asynchronously.
@@ -0,0 +1,291 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package workloadentry
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cenkalti/backoff"
+	"github.com/gogo/protobuf/types"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"istio.io/api/meta/v1alpha1"
+	"istio.io/api/networking/v1alpha3"
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/model/status"
+	"istio.io/istio/pkg/config/schema/gvk"
+	"istio.io/istio/pkg/istio-agent/health"
+)
+
+const (
+	// activeHealthCheckResyncPeriod is the period at which the probes are reconciled with the WorkloadEntries.
+	activeHealthCheckResyncPeriod = 10 * time.Second
+
+	// maxHealthUpdateRetries is the number of times the health status of a WorkloadEntry is written
+	// before the update is dropped.
+	maxHealthUpdateRetries = 5
+)
+
+// ActiveHealthCheck is the probe of a WorkloadEntry declared by status.WorkloadEntryActiveHealthCheckAnnotation.
+// It has the format of the probe of a WorkloadGroup, with an additional grpc method. Exactly one method
+// must be set, and the probes are sent to the address of the WorkloadEntry, on one of its declared ports.
+type ActiveHealthCheck struct {
+	InitialDelaySeconds int32 `json:"initialDelaySeconds,omitempty"`
+	TimeoutSeconds      int32 `json:"timeoutSeconds,omitempty"`
+	PeriodSeconds       int32 `json:"periodSeconds,omitempty"`
+	SuccessThreshold    int32 `json:"successThreshold,omitempty"`
+	FailureThreshold    int32 `json:"failureThreshold,omitempty"`
+
+	HTTPGet   *HTTPHealthCheck `json:"httpGet,omitempty"`
+	TCPSocket *TCPHealthCheck  `json:"tcpSocket,omitempty"`
+	GRPC      *GRPCHealthCheck `json:"grpc,omitempty"`
+}
+
+type HTTPHealthCheck struct {
+	Path   string `json:"path,omitempty"`
+	Port   uint32 `json:"port"`
+	Scheme string `json:"scheme,omitempty"`
+}
+
+type TCPHealthCheck struct {
+	Port uint32 `json:"port"`
+}
+
+type GRPCHealthCheck struct {
+	Port uint32 `json:"port"`
+	// Service is the name of the service to check, or empty for the overall health of the server.
+	Service string `json:"service,omitempty"`
+}
+
+// ActiveHealthChecker probes the addresses of the WorkloadEntries declaring an active health check, and
+// writes their Healthy condition. It is meant to run on a single, leader elected, istiod.
+type ActiveHealthChecker struct {
+	store        model.ConfigStoreCache
+	resyncPeriod time.Duration
+
+	mutex sync.Mutex
+	// probes stores namespace/name ==> running probe of the WorkloadEntry
+	probes map[string]*activeProbe
+}
+
+type activeProbe struct {
+	address string
+	ports   map[string]uint32
+	spec    string
+	quit    chan struct{}
+}
+
+// NewActiveHealthChecker creates a health checker of the WorkloadEntries of store.
+func NewActiveHealthChecker(store model.ConfigStoreCache) *ActiveHealthChecker {
+	return &ActiveHealthChecker{
+		store:        store,
+		resyncPeriod: activeHealthCheckResyncPeriod,
+		probes:       map[string]*activeProbe{},
+	}
+}
+
+// Run probes the WorkloadEntries until stop is closed. The probes are periodically reconciled with the
+// WorkloadEntries and their annotation.
+func (c *ActiveHealthChecker) Run(stop <-chan struct{}) {
+	log.Infof("starting active health checks of WorkloadEntries")
+	c.sync()
+	ticker := time.NewTicker(c.resyncPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.sync()
+		case <-stop:
+			c.mutex.Lock()
+			for key, p := range c.probes {
+				close(p.quit)
+				delete(c.probes, key)
+			}
+			c.mutex.Unlock()
+			return
+		}
+	}
+}
+
+// sync starts the probes of the new or changed WorkloadEntries, and stops the probes of the WorkloadEntries
+// which were deleted or no longer declare an active health check.
+func (c *ActiveHealthChecker) sync() {
+	wles, err := c.store.List(gvk.WorkloadEntry, metav1.NamespaceAll)
+	if err != nil {
+		log.Warnf("error listing WorkloadEntry for active health checks: %v", err)
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	seen := make(map[string]struct{}, len(c.probes))
+	for _, wle := range wles {
+		spec, f := wle.Annotations[status.WorkloadEntryActiveHealthCheckAnnotation]
+		if !f {
+			continue
+		}
+		entry := wle.Spec.(*v1alpha3.WorkloadEntry)
+		key := wle.Namespace + "/" + wle.Name
+		seen[key] = struct{}{}
+		if p, f := c.probes[key]; f {
+			if p.address == entry.Address && reflect.DeepEqual(p.ports, entry.Ports) && p.spec == spec {
+				continue
+			}
+			close(p.quit)
+			delete(c.probes, key)
+		}
+		p, err := c.startProbe(wle.Name, wle.Namespace, entry, spec)
+		if err != nil {
+			log.Warnf("invalid active health check of WorkloadEntry %s: %v", key, err)
+			continue
+		}
+		c.probes[key] = p
+	}
+	for key, p := range c.probes {
+		if _, f := seen[key]; !f {
+			close(p.quit)
+			delete(c.probes, key)
+		}
+	}
+}
+
+func (c *ActiveHealthChecker) startProbe(name, namespace string, entry *v1alpha3.WorkloadEntry, spec string) (*activeProbe, error) {
+	hc := &ActiveHealthCheck{}
+	if err := json.Unmarshal([]byte(spec), hc); err != nil {
+		return nil, err
+	}
+	prober, err := newActiveProber(entry, hc)
+	if err != nil {
+		return nil, err
+	}
+	checker := health.NewProberHealthChecker(&v1alpha3.ReadinessProbe{
+		InitialDelaySeconds: hc.InitialDelaySeconds,
+		TimeoutSeconds:      hc.TimeoutSeconds,
+		PeriodSeconds:       hc.PeriodSeconds,
+		SuccessThreshold:    hc.SuccessThreshold,
+		FailureThreshold:    hc.FailureThreshold,
+	}, prober)
+
+	p := &activeProbe{address: entry.Address, ports: entry.Ports, spec: spec, quit: make(chan struct{})}
+	go checker.PerformApplicationHealthCheck(func(event *health.ProbeEvent) {
+		select {
+		case <-p.quit:
+			// the probe was stopped or replaced while running
+			return
+		default:
+		}
+		c.updateHealth(name, namespace, event)
+	}, p.quit)
+	log.Debugf("started active health check of WorkloadEntry %s/%s", namespace, name)
+	return p, nil
+}
+
+// newActiveProber creates the prober of the method of hc, sending the probes to the address of entry.
+// As istiod runs the probes from its own network, they are limited to the ports declared by entry,
+// and no custom headers can be set.
+func newActiveProber(entry *v1alpha3.WorkloadEntry, hc *ActiveHealthCheck) (health.Prober, error) {
+	address := entry.Address
+	if address == "" || strings.HasPrefix(address, model.UnixAddressPrefix) {
+		return nil, fmt.Errorf("the WorkloadEntry has no IP or DNS address")
+	}
+	switch {
+	case hc.HTTPGet != nil && hc.TCPSocket == nil && hc.GRPC == nil:
+		if err := validateProbePort(entry, hc.HTTPGet.Port); err != nil {
+			return nil, fmt.Errorf("httpGet: %v", err)
+		}
+		cfg := &v1alpha3.HTTPHealthCheckConfig{
+			Path:   hc.HTTPGet.Path,
+			Port:   hc.HTTPGet.Port,
+			Host:   address,
+			Scheme: strings.ToLower(hc.HTTPGet.Scheme),
+		}
+		if cfg.Path == "" {
+			cfg.Path = "/"
+		}
+		transport := &http.Transport{DisableKeepAlives: true}
+		switch cfg.Scheme {
+		case "", "http":
+			cfg.Scheme = "http"
+		case "https":
+			transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+		default:
+			return nil, fmt.Errorf("httpGet: unsupported scheme %q", hc.HTTPGet.Scheme)
+		}
+		return &health.HTTPProber{Config: cfg, Transport: transport}, nil
+	case hc.TCPSocket != nil && hc.HTTPGet == nil && hc.GRPC == nil:
+		if err := validateProbePort(entry, hc.TCPSocket.Port); err != nil {
+			return nil, fmt.Errorf("tcpSocket: %v", err)
+		}
+		return &health.TCPProber{Config: &v1alpha3.TCPHealthCheckConfig{Host: address, Port: hc.TCPSocket.Port}}, nil
+	case hc.GRPC != nil && hc.HTTPGet == nil && hc.TCPSocket == nil:
+		if err := validateProbePort(entry, hc.GRPC.Port); err != nil {
+			return nil, fmt.Errorf("grpc: %v", err)
+		}
+		return &health.GRPCProber{Host: address, Port: hc.GRPC.Port, Service: hc.GRPC.Service}, nil
+	default:
+		return nil, fmt.Errorf("exactly one of httpGet, tcpSocket or grpc must be set")
+	}
+}
+
+// validateProbePort checks that port is one of the ports declared by entry.
+func validateProbePort(entry *v1alpha3.WorkloadEntry, port uint32) error {
+	if port == 0 {
+		return fmt.Errorf("port is required")
+	}
+	for _, p := range entry.Ports {
+		if p == port {
+			return nil
+		}
+	}
+	return fmt.Errorf("port %d is not a port of the WorkloadEntry", port)
+}
+
+// updateHealth writes the Healthy condition of the WorkloadEntry, retrying on conflicts.
+func (c *ActiveHealthChecker) updateHealth(name, namespace string, event *health.ProbeEvent) {
+	cond := &v1alpha1.IstioCondition{
+		Type: status.ConditionHealthy,
+		// last probe and transition are the same because
+		// the health checker only reports transitions
+		LastProbeTime:      types.TimestampNow(),
+		LastTransitionTime: types.TimestampNow(),
+		Status:             status.StatusTrue,
+	}
+	if !event.Healthy {
+		cond.Status = status.StatusFalse
+		cond.Message = event.UnhealthyMessage
+	}
+
+	op := func() error {
+		cfg := c.store.Get(gvk.WorkloadEntry, name, namespace)
+		if cfg == nil {
+			// the WorkloadEntry was deleted, its probe will be stopped on the next sync
+			return nil
+		}
+		_, err := c.store.UpdateStatus(status.UpdateConfigCondition(*cfg, cond))
+		return err
+	}
+	if err := backoff.Retry(op, backoff.WithMaxRetries(backoff.NewExponentialBackOff(), maxHealthUpdateRetries)); err != nil {
+		log.Errorf("error while updating WorkloadEntry health status for %s/%s: %v", namespace, name, err)
+		return
+	}
+	log.Debugf("updated health status of WorkloadEntry %s/%s to %v", namespace, name, cond)
+}
@@ -0,0 +1,137 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package workloadentry
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"go.uber.org/atomic"
+
+	"istio.io/api/networking/v1alpha3"
+	"istio.io/istio/pilot/pkg/config/memory"
+	"istio.io/istio/pilot/pkg/model/status"
+	"istio.io/istio/pkg/config"
+	"istio.io/istio/pkg/config/schema/collections"
+	"istio.io/istio/pkg/config/schema/gvk"
+	"istio.io/istio/pkg/test/util/retry"
+)
+
+func TestActiveHealthChecker(t *testing.T) {
+	healthy := atomic.NewBool(true)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/healthz" || !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+	portNum, _ := strconv.Atoi(port)
+
+	store := memory.NewController(memory.Make(collections.All))
+	wle := config.Config{
+		Meta: config.Meta{
+			GroupVersionKind: gvk.WorkloadEntry,
+			Namespace:        "a",
+			Name:             "vm-1",
+			Annotations: map[string]string{
+				status.WorkloadEntryActiveHealthCheckAnnotation: `{"periodSeconds": 1, "httpGet": {"path": "/healthz", "port": ` + port + `}}`,
+			},
+		},
+		Spec: &v1alpha3.WorkloadEntry{Address: "127.0.0.1", Ports: map[string]uint32{"http": uint32(portNum)}},
+	}
+	createOrFail(t, store, wle)
+
+	c := NewActiveHealthChecker(store)
+	c.resyncPeriod = 100 * time.Millisecond
+	stop := make(chan struct{})
+	defer close(stop)
+	go c.Run(stop)
+
+	checkHealth := func(expected bool) {
+		t.Helper()
+		retry.UntilSuccessOrFail(t, func() error {
+			cfg := store.Get(gvk.WorkloadEntry, wle.Name, wle.Namespace)
+			if cfg == nil || cfg.Status == nil {
+				return fmt.Errorf("no health status")
+			}
+			if got := status.GetBoolConditionFromSpec(*cfg, status.ConditionHealthy, !expected); got != expected {
+				return fmt.Errorf("expected healthy %v, got %v", expected, got)
+			}
+			return nil
+		}, retry.Timeout(5*time.Second))
+	}
+
+	checkHealth(true)
+	healthy.Store(false)
+	checkHealth(false)
+	healthy.Store(true)
+	checkHealth(true)
+
+	// the probe is stopped once the WorkloadEntry no longer declares an active health check
+	cfg := store.Get(gvk.WorkloadEntry, wle.Name, wle.Namespace)
+	cfg.Annotations = nil
+	if _, err := store.Update(*cfg); err != nil {
+		t.Fatal(err)
+	}
+	retry.UntilSuccessOrFail(t, func() error {
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		if len(c.probes) != 0 {
+			return fmt.Errorf("expected the probe to be stopped, got %v", c.probes)
+		}
+		return nil
+	}, retry.Timeout(5*time.Second))
+}
+
+func TestNewActiveProber(t *testing.T) {
+	entry := &v1alpha3.WorkloadEntry{
+		Address: "10.0.0.1",
+		Ports:   map[string]uint32{"http": 8080, "https": 8443, "mysql": 3306, "grpc": 9090},
+	}
+	cases := []struct {
+		name  string
+		entry *v1alpha3.WorkloadEntry
+		check *ActiveHealthCheck
+		valid bool
+	}{
+		{"http", entry, &ActiveHealthCheck{HTTPGet: &HTTPHealthCheck{Port: 8080}}, true},
+		{"https", entry, &ActiveHealthCheck{HTTPGet: &HTTPHealthCheck{Port: 8443, Scheme: "HTTPS"}}, true},
+		{"tcp", entry, &ActiveHealthCheck{TCPSocket: &TCPHealthCheck{Port: 3306}}, true},
+		{"grpc", entry, &ActiveHealthCheck{GRPC: &GRPCHealthCheck{Port: 9090, Service: "echo"}}, true},
+		{"no method", entry, &ActiveHealthCheck{}, false},
+		{"two methods", entry, &ActiveHealthCheck{TCPSocket: &TCPHealthCheck{Port: 3306}, GRPC: &GRPCHealthCheck{Port: 9090}}, false},
+		{"missing port", entry, &ActiveHealthCheck{GRPC: &GRPCHealthCheck{}}, false},
+		{"undeclared port", entry, &ActiveHealthCheck{TCPSocket: &TCPHealthCheck{Port: 22}}, false},
+		{"no ports", &v1alpha3.WorkloadEntry{Address: "10.0.0.1"}, &ActiveHealthCheck{TCPSocket: &TCPHealthCheck{Port: 3306}}, false},
+		{"no address", &v1alpha3.WorkloadEntry{Ports: entry.Ports}, &ActiveHealthCheck{TCPSocket: &TCPHealthCheck{Port: 3306}}, false},
+		{"unix address", &v1alpha3.WorkloadEntry{Address: "unix:///var/run/app.sock", Ports: entry.Ports},
+			&ActiveHealthCheck{TCPSocket: &TCPHealthCheck{Port: 3306}}, false},
+		{"invalid scheme", entry, &ActiveHealthCheck{HTTPGet: &HTTPHealthCheck{Port: 8080, Scheme: "ftp"}}, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := newActiveProber(tc.entry, tc.check)
+			if valid := err == nil; valid != tc.valid {
+				t.Fatalf("expected valid %v, got error %v", tc.valid, err)
+			}
+		})
+	}
+}
@@ -16,6 +16,7 @@ package dns
 
 import (
 	"net"
+	"sort"
 	"strings"
 	"sync/atomic"
 
@@ -63,6 +64,13 @@ type LookupTable struct {
 	// The cname records here (comprised of different variants of the hosts above,
 	// expanded by the search namespaces) pointing to the actual host.
 	cname map[string][]dns.RR
+	// The srv records for the named ports of each host. These are keyed both by the host itself and by
+	// the _port._proto.host. form defined in RFC 2782, matching the behavior of kube-dns.
+	srv map[string][]dns.RR
+	// The ptr records for reverse lookups, keyed by the reverse name of the IP (like 4.3.2.1.in-addr.arpa.)
+	ptr map[string][]dns.RR
+	// The hosts that have srv records. Queries for other ports of these hosts are answered with NXDOMAIN.
+	srvHosts map[string]struct{}
 }
 
 const (
@@ -133,6 +141,9 @@ func (h *LocalDNSServer) UpdateLookupTable(nt *nds.NameTable) {
 		name4:    map[string][]dns.RR{},
 		name6:    map[string][]dns.RR{},
 		cname:    map[string][]dns.RR{},
+		srv:      map[string][]dns.RR{},
+		ptr:      map[string][]dns.RR{},
+		srvHosts: map[string]struct{}{},
 	}
 	for host, ni := range nt.Table {
 		// Given a host
@@ -151,6 +162,14 @@ func (h *LocalDNSServer) UpdateLookupTable(nt *nds.NameTable) {
 			continue
 		}
 		lookupTable.buildDNSAnswers(altHosts, ipv4, ipv6, h.searchNamespaces)
+		lookupTable.buildSRVAnswers(altHosts, ni.Ports)
+		lookupTable.buildPTRAnswers(strings.ToLower(host)+".", ipv4, ipv6)
+	}
+	// Multiple hosts may share an IP; keep the response stable regardless of the map iteration order above.
+	for _, records := range lookupTable.ptr {
+		sort.Slice(records, func(i, j int) bool {
+			return records[i].(*dns.PTR).Ptr < records[j].(*dns.PTR).Ptr
+		})
 	}
 	h.lookupTable.Store(lookupTable)
 	log.Debugf("updated lookup table with %d hosts", len(lookupTable.allHosts))
@@ -192,6 +211,17 @@ func (h *LocalDNSServer) ServeDNS(proxy *dnsProxy, w dns.ResponseWriter, req *dn
 	// This name will always end in a dot
 	answers, hostFound := lookupTable.lookupHost(req.Question[0].Qtype, hostname)
 
+	if !hostFound && lookupTable.isUnknownPort(hostname) {
+		// The name is a SRV name for a host we are authoritative for, but the port does not exist.
+		response = new(dns.Msg)
+		response.SetReply(req)
+		response.Authoritative = true
+		response.Rcode = dns.RcodeNameError
+		log.Debugf("response for hostname %q (unknown port): %v", hostname, response)
+		_ = w.WriteMsg(response)
+		return
+	}
+
 	if hostFound {
 		response = new(dns.Msg)
 		response.SetReply(req)
@@ -355,6 +385,20 @@ func generateAltHosts(hostname string, nameinfo *nds.NameTable_NameInfo, proxyNa
 	return out
 }
 
+// isUnknownPort returns true if the hostname is a RFC 2782 SRV name (_port._proto.host.) for a host with
+// known ports, but does not match any of them.
+func (table *LookupTable) isUnknownPort(hostname string) bool {
+	if !strings.HasPrefix(hostname, "_") {
+		return false
+	}
+	parts := strings.SplitN(hostname, ".", 3)
+	if len(parts) != 3 || !strings.HasPrefix(parts[1], "_") {
+		return false
+	}
+	_, f := table.srvHosts[parts[2]]
+	return f
+}
+
 // Given a host, this function first decides if the host is part of our service registry.
 // If it is not part of the registry, return nil so that caller queries upstream. If it is part
 // of registry, we will look it up in one of our tables, failing which we will return NXDOMAIN.
@@ -380,9 +424,16 @@ func (table *LookupTable) lookupHost(qtype uint16, hostname string) ([]dns.RR, b
 		ipAnswers = table.name4[hostname]
 	case dns.TypeAAAA:
 		ipAnswers = table.name6[hostname]
+	case dns.TypeSRV:
+		ipAnswers = table.srv[hostname]
+	case dns.TypePTR:
+		ipAnswers = table.ptr[hostname]
+	case dns.TypeCNAME:
+		// The cname itself is the answer; there is nothing to chain.
+		return cn, hostFound
 	default:
-		// TODO: handle PTR records for reverse dns lookups
-		return nil, false
+		// We know the host, but not any records of this type. Return an empty answer (NODATA) rather
+		// than forwarding upstream, which may not know about the host at all.
 	}
 
 	if len(ipAnswers) > 0 {
@@ -445,6 +496,49 @@ func (table *LookupTable) buildDNSAnswers(altHosts map[string]struct{}, ipv4 []n
 	}
 }
 
+// buildSRVAnswers stores the SRV records for the named ports of each host. A query for the host itself
+// returns all ports, while a query for _port._proto.host. returns only the matching port.
+func (table *LookupTable) buildSRVAnswers(altHosts map[string]struct{}, ports []*nds.NameTable_NameInfo_Port) {
+	for h := range altHosts {
+		h = strings.ToLower(h)
+		for _, port := range ports {
+			if port.Name == "" {
+				// RFC 2782 names cannot be built for unnamed ports
+				continue
+			}
+			name := "_" + strings.ToLower(port.Name) + "." + srvProto(port.Protocol) + "." + h
+			record := srv(name, h, port.Number)
+			table.srv[name] = append(table.srv[name], record...)
+			table.srv[h] = append(table.srv[h], srv(h, h, port.Number)...)
+			table.allHosts[name] = struct{}{}
+			table.srvHosts[h] = struct{}{}
+		}
+	}
+}
+
+// buildPTRAnswers stores the PTR records pointing each IP back to the host.
+func (table *LookupTable) buildPTRAnswers(host string, ipv4 []net.IP, ipv6 []net.IP) {
+	for _, ips := range [][]net.IP{ipv4, ipv6} {
+		for _, ip := range ips {
+			name, err := dns.ReverseAddr(ip.String())
+			if err != nil {
+				log.Debugf("ignoring IP address %v for reverse lookups: %v", ip, err)
+				continue
+			}
+			table.ptr[name] = append(table.ptr[name], ptr(name, host)...)
+			table.allHosts[name] = struct{}{}
+		}
+	}
+}
+
+// srvProto returns the RFC 2782 protocol label for an Istio port protocol.
+func srvProto(protocol string) string {
+	if strings.EqualFold(protocol, "UDP") {
+		return "_udp"
+	}
+	return "_tcp"
+}
+
 // Borrowed from https://github.com/coredns/coredns/blob/master/plugin/hosts/hosts.go
 // a takes a slice of net.IPs and returns a slice of A RRs.
 func a(host string, ips []net.IP) []dns.RR {
@@ -482,6 +576,34 @@ func cname(host string, targetHost string) []dns.RR {
 	return []dns.RR{answer}
 }
 
+func srv(host string, target string, port uint32) []dns.RR {
+	answer := new(dns.SRV)
+	answer.Hdr = dns.RR_Header{
+		Name:   host,
+		Rrtype: dns.TypeSRV,
+		Class:  dns.ClassINET,
+		Ttl:    defaultTTLInSeconds,
+	}
+	// Matches kube-dns, which answers with a single target per service port
+	answer.Priority = 0
+	answer.Weight = 100
+	answer.Port = uint16(port)
+	answer.Target = target
+	return []dns.RR{answer}
+}
+
+func ptr(host string, targetHost string) []dns.RR {
+	answer := new(dns.PTR)
+	answer.Hdr = dns.RR_Header{
+		Name:   host,
+		Rrtype: dns.TypePTR,
+		Class:  dns.ClassINET,
+		Ttl:    defaultTTLInSeconds,
+	}
+	answer.Ptr = targetHost
+	return []dns.RR{answer}
+}
+
 // Size returns if buffer size *advertised* in the requests OPT record.
 // Or when the request was over TCP, we return the maximum allowed size of 64K.
 func size(proto string, r *dns.Msg) int {
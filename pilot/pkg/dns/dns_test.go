@@ -38,6 +38,7 @@ func TestDNS(t *testing.T) {
 		host                     string
 		id                       int
 		queryAAAA                bool
+		qtype                    uint16
 		expected                 []dns.RR
 		expectResolutionFailure  int
 		expectExternalResolution bool
@@ -156,6 +157,69 @@ func TestDNS(t *testing.T) {
 			host:      "ipv4.localhost.",
 			queryAAAA: true,
 		},
+		{
+			name:  "success: SRV query for named port",
+			host:  "_http._tcp.productpage.ns1.svc.cluster.local.",
+			qtype: dns.TypeSRV,
+			expected: srv("_http._tcp.productpage.ns1.svc.cluster.local.",
+				"productpage.ns1.svc.cluster.local.", 9080),
+		},
+		{
+			name:     "success: SRV query for UDP port",
+			host:     "_dns._udp.productpage.",
+			qtype:    dns.TypeSRV,
+			expected: srv("_dns._udp.productpage.", "productpage.", 53),
+		},
+		{
+			name:  "success: SRV query for host returns all ports",
+			host:  "productpage.ns1.svc.cluster.local.",
+			qtype: dns.TypeSRV,
+			expected: append(srv("productpage.ns1.svc.cluster.local.", "productpage.ns1.svc.cluster.local.", 9080),
+				srv("productpage.ns1.svc.cluster.local.", "productpage.ns1.svc.cluster.local.", 53)...),
+		},
+		{
+			name:                    "failure: SRV query for unknown port of known host",
+			host:                    "_grpc._tcp.productpage.ns1.svc.cluster.local.",
+			qtype:                   dns.TypeSRV,
+			expectResolutionFailure: dns.RcodeNameError,
+		},
+		{
+			// This is not a NXDOMAIN, but empty response
+			name: "success: A query for SRV name",
+			host: "_http._tcp.productpage.ns1.svc.cluster.local.",
+		},
+		{
+			// This is not a NXDOMAIN, but empty response
+			name:  "success: unsupported type for known host",
+			host:  "productpage.ns1.svc.cluster.local.",
+			qtype: dns.TypeTXT,
+		},
+		{
+			name:     "success: PTR query for IPv4",
+			host:     "9.9.9.9.in-addr.arpa.",
+			qtype:    dns.TypePTR,
+			expected: ptr("9.9.9.9.in-addr.arpa.", "productpage.ns1.svc.cluster.local."),
+		},
+		{
+			name:  "success: PTR query for IP shared by multiple hosts",
+			host:  "2.2.2.2.in-addr.arpa.",
+			qtype: dns.TypePTR,
+			expected: append(ptr("2.2.2.2.in-addr.arpa.", "dual.localhost."),
+				ptr("2.2.2.2.in-addr.arpa.", "ipv4.localhost.")...),
+		},
+		{
+			name:  "success: PTR query for IPv6",
+			host:  "9.2.3.8.2.4.0.0.0.0.f.f.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa.",
+			qtype: dns.TypePTR,
+			expected: append(ptr("9.2.3.8.2.4.0.0.0.0.f.f.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa.", "dual.localhost."),
+				ptr("9.2.3.8.2.4.0.0.0.0.f.f.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa.", "ipv6.localhost.")...),
+		},
+		{
+			name:                    "failure: PTR query for unknown IP is sent upstream",
+			host:                    "8.8.8.8.in-addr.arpa.",
+			qtype:                   dns.TypePTR,
+			expectResolutionFailure: dns.RcodeNameError,
+		},
 		{
 			name: "udp: large request",
 			host: "giant.",
@@ -213,6 +277,9 @@ func TestDNS(t *testing.T) {
 				if tt.queryAAAA {
 					q = dns.TypeAAAA
 				}
+				if tt.qtype != 0 {
+					q = tt.qtype
+				}
 				m.SetQuestion(tt.host, q)
 				if tt.modifyReq != nil {
 					tt.modifyReq(m)
@@ -417,6 +484,10 @@ func initDNS(t test.Failer) *LocalDNSServer {
 				Registry:  "Kubernetes",
 				Namespace: "ns1",
 				Shortname: "productpage",
+				Ports: []*nds.NameTable_NameInfo_Port{
+					{Name: "http", Number: 9080, Protocol: "HTTP"},
+					{Name: "dns", Number: 53, Protocol: "UDP"},
+				},
 			},
 			"example.ns2.svc.cluster.local": {
 				Ips:       []string{"10.10.10.10"},
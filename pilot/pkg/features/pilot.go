@@ -216,6 +216,13 @@ var (
 		"If enabled, Pilot will generate MCS ServiceExport objects for every non cluster-local service in the cluster",
 	).Get()
 
+	EnableMCSServiceDiscovery = env.RegisterBoolVar(
+		"PILOT_ENABLE_MCS_SERVICE_DISCOVERY",
+		false,
+		"If enabled, Pilot will watch MCS ServiceImport objects and generate a service for the clusterset.local hostname "+
+			"of every imported service, with the endpoints of all the clusters exporting it",
+	).Get()
+
 	EnableSDSServer = env.RegisterBoolVar(
 		"ISTIOD_ENABLE_SDS_SERVER",
 		true,
@@ -326,6 +333,13 @@ var (
 			"Use || between <trustdomain, endpoint> tuples. Use | as delimiter between trust domain and endpoint in "+
 			"each tuple. For example: foo|https://url/for/foo||bar|https://url/for/bar").Get()
 
+	SpiffeFederationBundleEndpoints = env.RegisterStringVar("SPIFFE_FEDERATION_BUNDLE_ENDPOINTS", "",
+		"The SPIFFE bundle trust domain to endpoint mappings of the trust domains federated with the mesh. Istiod "+
+			"periodically fetches the bundle of each trust domain from its endpoint, authenticated with the web PKI "+
+			"(https_web profile), and configures the proxies to verify the certificates of each trust domain with its "+
+			"own roots, so that the mesh can use mTLS with other meshes without sharing a root certificate. Uses the "+
+			"format of SPIFFE_BUNDLE_ENDPOINTS, for example: foo|https://url/for/foo||bar|https://url/for/bar").Get()
+
 	EnableXDSCaching = env.RegisterBoolVar("PILOT_ENABLE_XDS_CACHE", true,
 		"If true, Pilot will cache XDS responses.").Get()
 
@@ -335,6 +349,28 @@ var (
 	XDSCacheMaxSize = env.RegisterIntVar("PILOT_XDS_CACHE_SIZE", 20000,
 		"The maximum number of cache entries for the XDS cache.").Get()
 
+	XDSCacheMaxBytes = env.RegisterIntVar("PILOT_XDS_CACHE_MAX_BYTES", 0,
+		"If set to a positive value, the XDS cache is bounded by the total serialized size of the cached resources, "+
+			"in bytes, instead of by the number of entries configured by PILOT_XDS_CACHE_SIZE.").Get()
+
+	PushHistorySize = env.RegisterIntVar(
+		"PILOT_PUSH_HISTORY_SIZE",
+		100,
+		"The number of recent pushes, with the events that triggered them, kept for /debug/push_history.",
+	).Get()
+
+	XDSRecordingDir = env.RegisterStringVar("PILOT_XDS_RECORDING_DIR", "",
+		"If set, the xDS streams of the proxies selected by PILOT_XDS_RECORD_PROXIES or the /debug/recordz endpoint "+
+			"are recorded to files in this directory.").Get()
+
+	XDSRecordProxies = env.RegisterStringVar("PILOT_XDS_RECORD_PROXIES", "",
+		"Comma separated list of proxy IDs, such as pod-name.namespace, whose xDS streams are recorded "+
+			"to PILOT_XDS_RECORDING_DIR.").Get()
+
+	XDSCacheShardByType = env.RegisterBoolVar("PILOT_XDS_CACHE_SHARD_BY_TYPE", false,
+		"If true, the XDS cache is sharded by resource type to reduce lock contention. "+
+			"Only applies when PILOT_XDS_CACHE_MAX_BYTES is set.").Get()
+
 	AllowMetadataCertsInMutualTLS = env.RegisterBoolVar("PILOT_ALLOW_METADATA_CERTS_DR_MUTUAL_TLS", false,
 		"If true, Pilot will allow certs specified in Metadata to override DR certs in MUTUAL TLS mode. "+
 			"This is only enabled for migration and will be removed soon.").Get()
@@ -374,6 +410,13 @@ var (
 	WorkloadEntryHealthChecks = env.RegisterBoolVar("PILOT_ENABLE_WORKLOAD_ENTRY_HEALTHCHECKS", true,
 		"Enables automatic health checks of WorkloadEntries based on the config provided in the associated WorkloadGroup").Get()
 
+	WorkloadEntryActiveHealthChecks = env.RegisterBoolVar("PILOT_ENABLE_WORKLOAD_ENTRY_ACTIVE_HEALTHCHECKS", false,
+		"If enabled, the leader istiod probes the addresses of the WorkloadEntries with the "+
+			"proxy.istio.io/active-health-check annotation, for the workloads without an agent reporting their health. "+
+			"The probes are sent from the network of istiod, to the address and declared ports of the WorkloadEntry: as "+
+			"anyone able to write a WorkloadEntry can make istiod connect to any of these targets, only enable it when "+
+			"the writers of WorkloadEntries are trusted.").Get()
+
 	WorkloadEntryCrossCluster = env.RegisterBoolVar("PILOT_ENABLE_CROSS_CLUSTER_WORKLOAD_ENTRY", false,
 		"If enabled, pilot will read WorkloadEntry from other clusters, selectable by Services in that cluster.").Get()
 
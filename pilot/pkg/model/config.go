@@ -42,6 +42,10 @@ type ConfigKey struct {
 	Namespace string
 }
 
+func (key ConfigKey) String() string {
+	return key.Kind.Kind + "/" + key.Namespace + "/" + key.Name
+}
+
 func (key ConfigKey) HashCode() uint32 {
 	var result uint32
 	result = 31*result + crc32.ChecksumIEEE([]byte(key.Kind.Kind))
@@ -181,6 +181,24 @@ type XdsResourceGenerator interface {
 	Generate(proxy *Proxy, push *PushContext, w *WatchedResource, updates *PushRequest) (Resources, error)
 }
 
+// DeltaResources is an alias for array of named resources, as sent in Delta XDS responses.
+type DeltaResources = []*discovery.Resource
+
+// DeletedResources is an alias for array of names of resources which were removed.
+type DeletedResources = []string
+
+// XdsDeltaResourceGenerator is implemented by generators that can generate only the resources affected by
+// a push, for Delta XDS. Generators that do not implement it always generate all resources.
+type XdsDeltaResourceGenerator interface {
+	XdsResourceGenerator
+	// GenerateDeltas returns the resources which may have changed based on updates.ConfigsUpdated, and the names
+	// of the resources which were removed. If usedDelta is false, the generator was not able to scope the changes
+	// and returned all resources; the removed resources are then computed by the caller. As with Generate, nil
+	// resources means no push is required.
+	GenerateDeltas(proxy *Proxy, push *PushContext, updates *PushRequest, w *WatchedResource) (
+		res DeltaResources, deleted DeletedResources, usedDelta bool, err error)
+}
+
 // Proxy contains information about an specific instance of a proxy (envoy sidecar, gateway,
 // etc). The Proxy is initialized when a sidecar connects to Pilot, and populated from
 // 'node' info in the protocol as well as data extracted from registries.
@@ -300,6 +318,10 @@ type WatchedResource struct {
 	// LastSize tracks the size of the last update
 	LastSize int
 
+	// ResourceVersions tracks the version of each resource the client holds, keyed by resource name.
+	// It is only used for Delta XDS, to avoid sending resources which did not change.
+	ResourceVersions map[string]string
+
 	// Last request contains the last DiscoveryRequest received for
 	// this type. Generators are called immediately after each request,
 	// and may use the information in DiscoveryRequest.
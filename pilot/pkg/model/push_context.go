@@ -34,6 +34,7 @@ import (
 	"istio.io/istio/pkg/config/protocol"
 	"istio.io/istio/pkg/config/schema/gvk"
 	"istio.io/istio/pkg/config/visibility"
+	"istio.io/istio/pkg/spiffe"
 	"istio.io/pkg/monitoring"
 )
 
@@ -189,6 +190,10 @@ type PushContext struct {
 	// Mesh configuration for the mesh.
 	Mesh *meshconfig.MeshConfig `json:"-"`
 
+	// TrustDomainBundles are the trust anchors of each trust domain, keyed by trust domain, when trust domains
+	// are federated with the mesh. The certificates of each trust domain are verified with its own trust anchors.
+	TrustDomainBundles map[string][]string `json:"-"`
+
 	// Discovery interface for listing services and instances.
 	ServiceDiscovery `json:"-"`
 
@@ -305,6 +310,13 @@ type PushRequest struct {
 	// There should only be multiple reasons if the push request is the result of two distinct triggers, rather than
 	// classifying a single trigger as having multiple reasons.
 	Reason []TriggerReason
+
+	// Trace holds the events that caused the request, in the order they were received. Requests merged
+	// while debouncing keep the events of all of them, up to MaxPushTrace events.
+	Trace []PushTrigger
+
+	// TraceDropped is the number of events that were not kept in Trace, as it was full.
+	TraceDropped int
 }
 
 type TriggerReason string
@@ -356,6 +368,19 @@ func (pr *PushRequest) Merge(other *PushRequest) *PushRequest {
 
 		// Merge the two reasons. Note that we shouldn't deduplicate here, or we would under count
 		Reason: reason,
+
+		TraceDropped: pr.TraceDropped + other.TraceDropped,
+	}
+
+	// Keep the oldest events, as they explain why the push started
+	if len(pr.Trace) > 0 || len(other.Trace) > 0 {
+		merged.Trace = make([]PushTrigger, 0, len(pr.Trace)+len(other.Trace))
+		merged.Trace = append(merged.Trace, pr.Trace...)
+		merged.Trace = append(merged.Trace, other.Trace...)
+		if len(merged.Trace) > MaxPushTrace {
+			merged.TraceDropped += len(merged.Trace) - MaxPushTrace
+			merged.Trace = merged.Trace[:MaxPushTrace]
+		}
 	}
 
 	// Do not merge when any one is empty
@@ -980,6 +1005,8 @@ func (ps *PushContext) InitContext(env *Environment, oldPushContext *PushContext
 
 	ps.clusterLocalHosts = env.ClusterLocal().GetClusterLocalHosts()
 
+	ps.initTrustDomainBundles(env)
+
 	ps.initDone.Store(true)
 	return nil
 }
@@ -1740,6 +1767,30 @@ func (ps *PushContext) mergeGateways(proxy *Proxy) *MergedGateway {
 	return MergeGateways(out...)
 }
 
+// initTrustDomainBundles computes the trust anchors of the trust domain of the mesh, and of the trust domains
+// federated with it.
+func (ps *PushContext) initTrustDomainBundles(env *Environment) {
+	if env.TrustBundle == nil {
+		return
+	}
+	federated := env.TrustBundle.GetFederatedTrustBundles()
+	if len(federated) == 0 {
+		return
+	}
+	local := env.TrustBundle.GetTrustBundle()
+	if len(local) == 0 {
+		log.Warnf("no trust anchors for the trust domain %s, ignoring the federated trust domains", spiffe.GetTrustDomain())
+		return
+	}
+	ps.TrustDomainBundles = map[string][]string{spiffe.GetTrustDomain(): local}
+	for _, alias := range ps.Mesh.GetTrustDomainAliases() {
+		ps.TrustDomainBundles[alias] = local
+	}
+	for trustDomain, certs := range federated {
+		ps.TrustDomainBundles[trustDomain] = certs
+	}
+}
+
 // pre computes gateways for each network
 func (ps *PushContext) initMeshNetworks(meshNetworks *meshconfig.MeshNetworks) {
 	ps.networksMu.Lock()
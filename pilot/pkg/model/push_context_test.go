@@ -114,6 +114,18 @@ func TestMergeUpdateRequest(t *testing.T) {
 			}: {}}},
 			PushRequest{Full: true, ConfigsUpdated: nil, Reason: []TriggerReason{}},
 		},
+		{
+			"merge trace",
+			&PushRequest{Trace: []PushTrigger{{Source: "a"}}},
+			&PushRequest{Trace: []PushTrigger{{Source: "b"}}, TraceDropped: 2},
+			PushRequest{Reason: []TriggerReason{}, Trace: []PushTrigger{{Source: "a"}, {Source: "b"}}, TraceDropped: 2},
+		},
+		{
+			"merge trace: full",
+			&PushRequest{Trace: make([]PushTrigger, MaxPushTrace)},
+			&PushRequest{Trace: []PushTrigger{{Source: "b"}}},
+			PushRequest{Reason: []TriggerReason{}, Trace: make([]PushTrigger, MaxPushTrace), TraceDropped: 1},
+		},
 	}
 
 	for _, tt := range cases {
@@ -126,6 +138,45 @@ func TestMergeUpdateRequest(t *testing.T) {
 	}
 }
 
+func TestPushRequestTraced(t *testing.T) {
+	req := &PushRequest{
+		Reason: []TriggerReason{ConfigUpdate},
+		ConfigsUpdated: map[ConfigKey]struct{}{
+			{Kind: config.GroupVersionKind{Kind: "VirtualService"}, Namespace: "ns2", Name: "b"}: {},
+			{Kind: config.GroupVersionKind{Kind: "VirtualService"}, Namespace: "ns1", Name: "a"}: {},
+		},
+	}
+	req.Traced("config")
+	if len(req.Trace) != 1 {
+		t.Fatalf("expected a single event, got %v", req.Trace)
+	}
+	got := req.Trace[0]
+	if got.Reason != ConfigUpdate || got.Source != "config" || got.Time.IsZero() {
+		t.Fatalf("unexpected event %+v", got)
+	}
+	if want := []string{"VirtualService/ns1/a", "VirtualService/ns2/b"}; !reflect.DeepEqual(got.Resources, want) {
+		t.Fatalf("expected resources %v, got %v", want, got.Resources)
+	}
+
+	// An existing trace is kept
+	req.Traced("other")
+	if len(req.Trace) != 1 || req.Trace[0].Source != "config" {
+		t.Fatalf("trace should not change, got %v", req.Trace)
+	}
+
+	many := &PushRequest{ConfigsUpdated: map[ConfigKey]struct{}{}}
+	for i := 0; i < maxTriggerResources+5; i++ {
+		many.ConfigsUpdated[ConfigKey{Name: fmt.Sprint(i)}] = struct{}{}
+	}
+	resources := many.Traced("").Trace[0].Resources
+	if len(resources) != maxTriggerResources+1 || resources[maxTriggerResources] != "and 5 more" {
+		t.Fatalf("expected resources to be truncated, got %v", resources)
+	}
+	if many.Trace[0].Reason != UnknownTrigger {
+		t.Fatalf("expected unknown reason, got %v", many.Trace[0].Reason)
+	}
+}
+
 func TestConcurrentMerge(t *testing.T) {
 	reqA := &PushRequest{Reason: make([]TriggerReason, 0, 100)}
 	reqB := &PushRequest{Reason: []TriggerReason{ServiceUpdate, ProxyUpdate}}
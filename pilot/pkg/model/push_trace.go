@@ -0,0 +1,67 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+const (
+	// MaxPushTrace is the maximum number of events kept in the trace of a push request.
+	MaxPushTrace = 100
+
+	// maxTriggerResources is the maximum number of resources listed in a single event.
+	maxTriggerResources = 20
+)
+
+// PushTrigger is an event that caused a push request, such as a config change or a registry update.
+// Triggers are kept for debugging, to attribute pushes to the changes that caused them.
+type PushTrigger struct {
+	Time   time.Time     `json:"time"`
+	Reason TriggerReason `json:"reason"`
+	// Source is the component that reported the event, such as "config" or "registry/<cluster>".
+	Source string `json:"source,omitempty"`
+	// Resources are the configs that changed, formatted as kind/namespace/name.
+	Resources []string `json:"resources,omitempty"`
+}
+
+// Traced records the request as the single event in its trace, attributed to source. It does nothing if
+// the request already has a trace. It returns the request, so it can be used when passing a new request.
+func (pr *PushRequest) Traced(source string) *PushRequest {
+	if len(pr.Trace) > 0 {
+		return pr
+	}
+	reason := UnknownTrigger
+	if len(pr.Reason) > 0 {
+		reason = pr.Reason[0]
+	}
+	keys := make([]string, 0, len(pr.ConfigsUpdated))
+	for key := range pr.ConfigsUpdated {
+		keys = append(keys, key.String())
+	}
+	sort.Strings(keys)
+	if len(keys) > maxTriggerResources {
+		keys = append(keys[:maxTriggerResources], fmt.Sprintf("and %d more", len(keys)-maxTriggerResources))
+	}
+	pr.Trace = []PushTrigger{{
+		Time:      time.Now(),
+		Reason:    reason,
+		Source:    source,
+		Resources: keys,
+	}}
+	return pr
+}
@@ -21,6 +21,13 @@ const (
 	// should be treated as unhealthy and not sent to proxies
 	WorkloadEntryHealthCheckAnnotation = "proxy.istio.io/health-checks-enabled"
 
+	// WorkloadEntryActiveHealthCheckAnnotation is the annotation holding, in JSON, the probe istiod runs
+	// against the address of a workload entry without an agent reporting its health. The probe has the
+	// format of the probe of a WorkloadGroup, without custom HTTP headers and with an additional grpc
+	// health check method. Its port must be one of the ports of the workload entry.
+	// If this annotation is present, the workload entry is treated as with WorkloadEntryHealthCheckAnnotation.
+	WorkloadEntryActiveHealthCheckAnnotation = "proxy.istio.io/active-health-check"
+
 	// ConditionHealthy defines a status field to declare if a WorkloadEntry is healthy or not
 	ConditionHealthy = "Healthy"
 )
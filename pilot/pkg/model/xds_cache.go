@@ -18,6 +18,7 @@ import (
 	"fmt"
 	"sync"
 
+	"github.com/golang/protobuf/proto"
 	"github.com/golang/protobuf/ptypes/any"
 	"github.com/google/go-cmp/cmp"
 	"github.com/hashicorp/golang-lru/simplelru"
@@ -34,6 +35,7 @@ func init() {
 	monitoring.MustRegister(xdsCacheReads)
 	monitoring.MustRegister(xdsCacheEvictions)
 	monitoring.MustRegister(xdsCacheSize)
+	monitoring.MustRegister(xdsCacheBytes)
 }
 
 var (
@@ -53,6 +55,11 @@ var (
 		"Current size of xds cache",
 	)
 
+	xdsCacheBytes = monitoring.NewGauge(
+		"xds_cache_bytes",
+		"Current size of xds cache in bytes, when the cache is bounded by bytes.",
+	)
+
 	xdsCacheHits   = xdsCacheReads.With(typeTag.Value("hit"))
 	xdsCacheMisses = xdsCacheReads.With(typeTag.Value("miss"))
 )
@@ -81,6 +88,12 @@ func size(cs int) {
 	}
 }
 
+func sizeBytes(b int64) {
+	if features.EnableXDSCacheMetrics {
+		xdsCacheBytes.Record(float64(b))
+	}
+}
+
 func indexConfig(configIndex map[ConfigKey]sets.Set, k string, entry XdsCacheEntry) {
 	for _, config := range entry.DependentConfigs() {
 		if configIndex[config] == nil {
@@ -104,6 +117,8 @@ func indexType(typeIndex map[config.GroupVersionKind]sets.Set, k string, entry X
 type XdsCacheEntry interface {
 	// Key is the key to be used in cache.
 	Key() string
+	// ResourceType is the xDS type URL of the cached resource. It is used to shard the cache by type.
+	ResourceType() string
 	// DependentTypes are config types that this cache key is dependant on.
 	// Whenever any configs of this type changes, we should invalidate this cache entry.
 	// Note: DependentConfigs should be preferred wherever possible.
@@ -144,10 +159,30 @@ type XdsCache interface {
 	ClearAll()
 	// Keys returns all currently configured keys. This is for testing/debug only
 	Keys() []string
+	// Stats returns the occupancy of the cache, keyed by the type URL of the cached values. This is
+	// for testing/debug only
+	Stats() map[string]XdsCacheStats
 }
 
-// NewXdsCache returns an instance of a cache.
+// XdsCacheStats describes the cache occupancy of a single type of resource.
+type XdsCacheStats struct {
+	// Entries is the number of cached values.
+	Entries int `json:"entries"`
+	// Bytes is the total serialized size of the cached values.
+	Bytes int64 `json:"bytes"`
+}
+
+func (s *XdsCacheStats) add(value *any.Any) {
+	s.Entries++
+	s.Bytes += int64(proto.Size(value))
+}
+
+// NewXdsCache returns an instance of a cache. The cache is bounded by the number of entries, unless
+// PILOT_XDS_CACHE_MAX_BYTES is set, in which case it is bounded by the total size of the cached values.
 func NewXdsCache() XdsCache {
+	if features.XDSCacheMaxBytes > 0 {
+		return NewByteXdsCache(int64(features.XDSCacheMaxBytes), features.XDSCacheShardByType)
+	}
 	return &lruCache{
 		enableAssertions: features.EnableUnsafeAssertions,
 		store:            newLru(),
@@ -199,17 +234,15 @@ func newLru() simplelru.LRUCache {
 // because multiple writers may get cache misses concurrently, but they ought to generate identical
 // configuration. This also checks that our XDS config generation is deterministic, which is a very
 // important property.
-func (l *lruCache) assertUnchanged(existing *any.Any, replacement *any.Any) {
-	if l.enableAssertions {
-		if existing == nil {
-			// This is a new addition, not an update
-			return
-		}
-		if !cmp.Equal(existing, replacement, protocmp.Transform()) {
-			warning := fmt.Errorf("assertion failed, cache entry changed but not cleared: %v\n%v\n%v",
-				cmp.Diff(existing, replacement, protocmp.Transform()), existing, replacement)
-			panic(warning)
-		}
+func assertUnchanged(existing *any.Any, replacement *any.Any) {
+	if existing == nil {
+		// This is a new addition, not an update
+		return
+	}
+	if !cmp.Equal(existing, replacement, protocmp.Transform()) {
+		warning := fmt.Errorf("assertion failed, cache entry changed but not cleared: %v\n%v\n%v",
+			cmp.Diff(existing, replacement, protocmp.Transform()), existing, replacement)
+		panic(warning)
 	}
 }
 
@@ -240,7 +273,7 @@ func (l *lruCache) Add(entry XdsCacheEntry, token CacheToken, value *any.Any) {
 		if toWrite.token == 0 {
 			panic("token cannot be empty. was Get() called before Add()?")
 		}
-		l.assertUnchanged(cur.(cacheValue).value, value)
+		assertUnchanged(cur.(cacheValue).value, value)
 	}
 	l.store.Add(k, toWrite)
 	indexConfig(l.configIndex, k, entry)
@@ -319,6 +352,23 @@ func (l *lruCache) Keys() []string {
 	return keys
 }
 
+func (l *lruCache) Stats() map[string]XdsCacheStats {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	res := map[string]XdsCacheStats{}
+	for _, k := range l.store.Keys() {
+		v, f := l.store.Peek(k)
+		if !f || v.(cacheValue).value == nil {
+			continue
+		}
+		value := v.(cacheValue).value
+		st := res[value.TypeUrl]
+		st.add(value)
+		res[value.TypeUrl] = st
+	}
+	return res
+}
+
 // DisabledCache is a cache that is always empty
 type DisabledCache struct{}
 
@@ -335,3 +385,5 @@ func (d DisabledCache) Clear(configsUpdated map[ConfigKey]struct{}) {}
 func (d DisabledCache) ClearAll() {}
 
 func (d DisabledCache) Keys() []string { return nil }
+
+func (d DisabledCache) Stats() map[string]XdsCacheStats { return nil }
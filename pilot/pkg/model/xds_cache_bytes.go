@@ -0,0 +1,347 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/any"
+	"go.uber.org/atomic"
+
+	"istio.io/istio/pilot/pkg/features"
+	"istio.io/istio/pilot/pkg/util/sets"
+	"istio.io/istio/pkg/config"
+)
+
+// NewByteXdsCache returns a cache bounded by the total serialized size of the cached values, in bytes.
+// If shardByType is set, each resource type is stored in its own shard with its own lock.
+func NewByteXdsCache(maxBytes int64, shardByType bool) XdsCache {
+	return newByteCache(maxBytes, shardByType, features.EnableUnsafeAssertions)
+}
+
+// NewLenientByteXdsCache returns a byte bounded cache that does not enable assertions.
+func NewLenientByteXdsCache(maxBytes int64, shardByType bool) XdsCache {
+	return newByteCache(maxBytes, shardByType, false)
+}
+
+// byteCache is an XdsCache that evicts least recently used entries once the serialized size of
+// all cached values exceeds maxBytes. This keeps memory usage bounded regardless of how large the
+// individual resources are, unlike lruCache which bounds the number of entries.
+//
+// When sharded by type, eviction starts with the shard that was written to, so a type with large
+// resources, such as routes, pushes out its own entries before those of other types.
+//
+// The tokens stored by Get before a value is added also count against the budget, so entries that
+// are read but never written cannot grow the cache without bound.
+type byteCache struct {
+	enableAssertions bool
+	maxBytes         int64
+	shardByType      bool
+	// nextToken stores the next token to use. The content here doesn't matter, we just need a cheap
+	// unique identifier.
+	nextToken *atomic.Uint64
+	// bytes and entries are the totals across all shards.
+	bytes   *atomic.Int64
+	entries *atomic.Int64
+
+	mu     sync.RWMutex
+	shards map[string]*byteCacheShard
+}
+
+var _ XdsCache = &byteCache{}
+
+type byteCacheShard struct {
+	mu sync.Mutex
+	// lru holds *byteCacheItem, with the most recently used item at the front.
+	lru         *list.List
+	items       map[string]*list.Element
+	configIndex map[ConfigKey]sets.Set
+	typesIndex  map[config.GroupVersionKind]sets.Set
+}
+
+type byteCacheItem struct {
+	cacheValue
+	key  string
+	size int64
+}
+
+// tokenOverhead approximates the memory held by an entry without a value, besides its key: the
+// item, its list element and its map entry.
+const tokenOverhead = 128
+
+// tokenSize returns the size counted against the budget for the token of the entry with key k.
+func tokenSize(k string) int64 {
+	return int64(len(k)) + tokenOverhead
+}
+
+func newByteCache(maxBytes int64, shardByType bool, enableAssertions bool) *byteCache {
+	return &byteCache{
+		enableAssertions: enableAssertions,
+		maxBytes:         maxBytes,
+		shardByType:      shardByType,
+		nextToken:        atomic.NewUint64(0),
+		bytes:            atomic.NewInt64(0),
+		entries:          atomic.NewInt64(0),
+		shards:           map[string]*byteCacheShard{},
+	}
+}
+
+func newByteCacheShard() *byteCacheShard {
+	return &byteCacheShard{
+		lru:         list.New(),
+		items:       map[string]*list.Element{},
+		configIndex: map[ConfigKey]sets.Set{},
+		typesIndex:  map[config.GroupVersionKind]sets.Set{},
+	}
+}
+
+// shard returns the shard that stores entry, creating it if needed.
+func (l *byteCache) shard(entry XdsCacheEntry) *byteCacheShard {
+	t := ""
+	if l.shardByType {
+		t = entry.ResourceType()
+	}
+	l.mu.RLock()
+	s := l.shards[t]
+	l.mu.RUnlock()
+	if s != nil {
+		return s
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if s = l.shards[t]; s == nil {
+		s = newByteCacheShard()
+		l.shards[t] = s
+	}
+	return s
+}
+
+func (l *byteCache) allShards() []*byteCacheShard {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	shards := make([]*byteCacheShard, 0, len(l.shards))
+	for _, s := range l.shards {
+		shards = append(shards, s)
+	}
+	return shards
+}
+
+func (l *byteCache) Add(entry XdsCacheEntry, token CacheToken, value *any.Any) {
+	if !entry.Cacheable() {
+		return
+	}
+	s := l.shard(entry)
+	k := entry.Key()
+	sz := int64(proto.Size(value))
+
+	s.mu.Lock()
+	e, f := s.items[k]
+	if !f {
+		// This is our first time seeing this; this means it was invalidated recently and this is our
+		// first write, or we forgot to call Get before.
+		s.mu.Unlock()
+		return
+	}
+	item := e.Value.(*byteCacheItem)
+	if token != item.token {
+		// entry may be stale, we need to drop it. This can happen when the cache is invalidated
+		// after we call Get.
+		s.mu.Unlock()
+		return
+	}
+	if l.enableAssertions {
+		if item.token == 0 {
+			s.mu.Unlock()
+			panic("token cannot be empty. was Get() called before Add()?")
+		}
+		assertUnchanged(item.value, value)
+	}
+	if sz > l.maxBytes {
+		// The value can never fit; rather than evicting everything else, do not cache it at all.
+		l.removeLocked(s, e)
+		s.mu.Unlock()
+		evict(k, value)
+		return
+	}
+	l.bytes.Add(sz - item.size)
+	item.value = value
+	item.size = sz
+	s.lru.MoveToFront(e)
+	indexConfig(s.configIndex, k, entry)
+	indexType(s.typesIndex, k, entry)
+	s.mu.Unlock()
+
+	l.evictOverBudget(s)
+	size(int(l.entries.Load()))
+	sizeBytes(l.bytes.Load())
+}
+
+func (l *byteCache) Get(entry XdsCacheEntry) (*any.Any, CacheToken, bool) {
+	if !entry.Cacheable() {
+		return nil, 0, false
+	}
+	s := l.shard(entry)
+	k := entry.Key()
+
+	s.mu.Lock()
+	e, ok := s.items[k]
+	if !ok {
+		miss()
+		// If the entry is not found at all, this is our first read of it. We will generate and store
+		// a new token. Subsequent writes must include it.
+		tok := CacheToken(l.nextToken.Inc())
+		sz := tokenSize(k)
+		s.items[k] = s.lru.PushFront(&byteCacheItem{cacheValue: cacheValue{token: tok}, key: k, size: sz})
+		l.entries.Inc()
+		l.bytes.Add(sz)
+		indexConfig(s.configIndex, k, entry)
+		indexType(s.typesIndex, k, entry)
+		s.mu.Unlock()
+
+		l.evictOverBudget(s)
+		return nil, tok, false
+	}
+	defer s.mu.Unlock()
+	s.lru.MoveToFront(e)
+	item := e.Value.(*byteCacheItem)
+	if item.value == nil {
+		miss()
+		// We have generated a token previously, so return that, but this is still a cache miss as
+		// no value is stored.
+		return nil, item.token, false
+	}
+	hit()
+	return item.value, item.token, true
+}
+
+// evictOverBudget evicts least recently used values, starting with the written shard, until the
+// cache is within its budget. Only one shard is locked at a time.
+func (l *byteCache) evictOverBudget(written *byteCacheShard) {
+	if l.bytes.Load() <= l.maxBytes {
+		return
+	}
+	if l.evictFrom(written) {
+		return
+	}
+	for _, s := range l.allShards() {
+		if s != written && l.evictFrom(s) {
+			return
+		}
+	}
+}
+
+// evictFrom evicts entries from s until the cache is within its budget. It returns false if s ran
+// out of entries first. Evicting an entry without a value drops its token, so the in-flight write
+// holding it is not cached.
+func (l *byteCache) evictFrom(s *byteCacheShard) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for e := s.lru.Back(); e != nil; {
+		if l.bytes.Load() <= l.maxBytes {
+			return true
+		}
+		prev := e.Prev()
+		item := e.Value.(*byteCacheItem)
+		l.removeLocked(s, e)
+		evict(item.key, item.value)
+		e = prev
+	}
+	return l.bytes.Load() <= l.maxBytes
+}
+
+// removeLocked removes e from s. The shard lock must be held.
+func (l *byteCache) removeLocked(s *byteCacheShard, e *list.Element) {
+	item := e.Value.(*byteCacheItem)
+	s.lru.Remove(e)
+	delete(s.items, item.key)
+	l.bytes.Sub(item.size)
+	l.entries.Dec()
+}
+
+func (l *byteCache) Clear(configs map[ConfigKey]struct{}) {
+	for _, s := range l.allShards() {
+		s.mu.Lock()
+		for ckey := range configs {
+			referenced := s.configIndex[ckey]
+			delete(s.configIndex, ckey)
+			for key := range referenced {
+				if e, f := s.items[key]; f {
+					l.removeLocked(s, e)
+				}
+			}
+			tReferenced := s.typesIndex[ckey.Kind]
+			delete(s.typesIndex, ckey.Kind)
+			for key := range tReferenced {
+				if e, f := s.items[key]; f {
+					l.removeLocked(s, e)
+				}
+			}
+		}
+		s.mu.Unlock()
+	}
+	size(int(l.entries.Load()))
+	sizeBytes(l.bytes.Load())
+}
+
+func (l *byteCache) ClearAll() {
+	for _, s := range l.allShards() {
+		s.mu.Lock()
+		for e := s.lru.Front(); e != nil; e = e.Next() {
+			item := e.Value.(*byteCacheItem)
+			l.bytes.Sub(item.size)
+			l.entries.Dec()
+		}
+		s.lru.Init()
+		s.items = map[string]*list.Element{}
+		s.configIndex = map[ConfigKey]sets.Set{}
+		s.typesIndex = map[config.GroupVersionKind]sets.Set{}
+		s.mu.Unlock()
+	}
+	size(int(l.entries.Load()))
+	sizeBytes(l.bytes.Load())
+}
+
+func (l *byteCache) Keys() []string {
+	var keys []string
+	for _, s := range l.allShards() {
+		s.mu.Lock()
+		for k := range s.items {
+			keys = append(keys, k)
+		}
+		s.mu.Unlock()
+	}
+	return keys
+}
+
+func (l *byteCache) Stats() map[string]XdsCacheStats {
+	res := map[string]XdsCacheStats{}
+	for _, s := range l.allShards() {
+		s.mu.Lock()
+		for _, e := range s.items {
+			item := e.Value.(*byteCacheItem)
+			if item.value == nil {
+				continue
+			}
+			st := res[item.value.TypeUrl]
+			st.Entries++
+			st.Bytes += item.size
+			res[item.value.TypeUrl] = st
+		}
+		s.mu.Unlock()
+	}
+	return res
+}
@@ -37,6 +37,12 @@ type ConfigGenerator interface {
 	// BuildClusters returns the list of clusters for the given proxy. This is the CDS output
 	BuildClusters(node *model.Proxy, push *model.PushContext) []*cluster.Cluster
 
+	// BuildDeltaClusters returns the clusters affected by the updates, and the names of the clusters that were
+	// removed. If the updates cannot be scoped to a subset of clusters, it returns all clusters and usedDelta is false.
+	// This is the Delta CDS output.
+	BuildDeltaClusters(node *model.Proxy, push *model.PushContext, updates *model.PushRequest,
+		watched *model.WatchedResource) (clusters []*cluster.Cluster, removed []string, usedDelta bool)
+
 	// BuildHTTPRoutes returns the list of HTTP routes for the given proxy. This is the RDS output
 	BuildHTTPRoutes(node *model.Proxy, push *model.PushContext, routeNames []string) []*route.RouteConfiguration
 
@@ -36,6 +36,7 @@ import (
 	"istio.io/istio/pilot/pkg/serviceregistry"
 	"istio.io/istio/pkg/config/host"
 	"istio.io/istio/pkg/config/protocol"
+	"istio.io/istio/pkg/config/schema/gvk"
 	"istio.io/istio/pkg/util/gogo"
 )
 
@@ -84,7 +85,7 @@ func (configgen *ConfigGeneratorImpl) BuildClusters(proxy *model.Proxy, push *mo
 	case model.SidecarProxy:
 		// Setup outbound clusters
 		outboundPatcher := clusterPatcher{envoyFilterPatches, networking.EnvoyFilter_SIDECAR_OUTBOUND}
-		clusters = append(clusters, configgen.buildOutboundClusters(cb, outboundPatcher)...)
+		clusters = append(clusters, configgen.buildOutboundClusters(cb, outboundPatcher, outboundServices(proxy, push))...)
 		// Add a blackhole and passthrough cluster for catching traffic to unresolved routes
 		clusters = outboundPatcher.conditionallyAppend(clusters, nil, cb.buildBlackHoleCluster(), cb.buildDefaultPassthroughCluster())
 		clusters = append(clusters, outboundPatcher.insertedClusters()...)
@@ -97,7 +98,7 @@ func (configgen *ConfigGeneratorImpl) BuildClusters(proxy *model.Proxy, push *mo
 		clusters = append(clusters, inboundPatcher.insertedClusters()...)
 	default: // Gateways
 		patcher := clusterPatcher{envoyFilterPatches, networking.EnvoyFilter_GATEWAY}
-		clusters = append(clusters, configgen.buildOutboundClusters(cb, patcher)...)
+		clusters = append(clusters, configgen.buildOutboundClusters(cb, patcher, outboundServices(proxy, push))...)
 		// Gateways do not require the default passthrough cluster as they do not have original dst listeners.
 		clusters = patcher.conditionallyAppend(clusters, nil, cb.buildBlackHoleCluster())
 		if proxy.Type == model.Router && proxy.GetRouterMode() == model.SniDnatRouter {
@@ -109,16 +110,85 @@ func (configgen *ConfigGeneratorImpl) BuildClusters(proxy *model.Proxy, push *mo
 	return cb.normalizeClusters(clusters)
 }
 
-func (configgen *ConfigGeneratorImpl) buildOutboundClusters(cb *ClusterBuilder, cp clusterPatcher) []*cluster.Cluster {
+// BuildDeltaClusters returns the clusters of the services updated by the push, and the names of the clusters of
+// these services which no longer exist. Only sidecars with service updates, and without cluster EnvoyFilter patches
+// which could apply to any cluster, are supported; otherwise all clusters are built and usedDelta is false.
+func (configgen *ConfigGeneratorImpl) BuildDeltaClusters(proxy *model.Proxy, push *model.PushContext, updates *model.PushRequest,
+	watched *model.WatchedResource) ([]*cluster.Cluster, []string, bool) {
+	updatedServices := deltaClusterServices(proxy, push, updates, watched)
+	if updatedServices == nil {
+		return configgen.BuildClusters(proxy, push), nil, false
+	}
+
+	services := make([]*model.Service, 0, len(updatedServices))
+	for hostname := range updatedServices {
+		// The service may have been removed, or may not be visible to the proxy anymore.
+		if svc := push.ServiceForHostname(proxy, hostname); svc != nil {
+			services = append(services, svc)
+		}
+	}
+	cb := NewClusterBuilder(proxy, push)
+	clusters := cb.normalizeClusters(configgen.buildOutboundClusters(cb, NilClusterPatcher, services))
+
+	built := make(map[string]struct{}, len(clusters))
+	for _, c := range clusters {
+		built[c.Name] = struct{}{}
+	}
+	removed := make([]string, 0)
+	for _, name := range watched.ResourceNames {
+		direction, _, hostname, _ := model.ParseSubsetKey(name)
+		if direction != model.TrafficDirectionOutbound {
+			continue
+		}
+		if _, f := updatedServices[hostname]; !f {
+			continue
+		}
+		if _, f := built[name]; !f {
+			removed = append(removed, name)
+		}
+	}
+	return clusters, removed, true
+}
+
+// deltaClusterServices returns the hostnames of the services updated by the push, or nil if the clusters
+// affected by the push cannot be determined from them.
+func deltaClusterServices(proxy *model.Proxy, push *model.PushContext, updates *model.PushRequest,
+	watched *model.WatchedResource) map[host.Name]struct{} {
+	if proxy.Type != model.SidecarProxy || updates == nil || !updates.Full || len(updates.ConfigsUpdated) == 0 || watched == nil {
+		return nil
+	}
+	// Patches may match any cluster, including the ones we would not rebuild.
+	if efw := push.EnvoyFilters(proxy); efw != nil && len(efw.Patches[networking.EnvoyFilter_CLUSTER]) > 0 {
+		return nil
+	}
+	hostnames := make(map[host.Name]struct{}, len(updates.ConfigsUpdated))
+	for key := range updates.ConfigsUpdated {
+		if key.Kind != gvk.ServiceEntry {
+			return nil
+		}
+		hostnames[host.Name(key.Name)] = struct{}{}
+	}
+	// Inbound clusters are built from the proxy's own services.
+	for _, si := range proxy.ServiceInstances {
+		if _, f := hostnames[si.Service.Hostname]; f {
+			return nil
+		}
+	}
+	return hostnames
+}
+
+// outboundServices returns the services the proxy has outbound clusters for.
+func outboundServices(proxy *model.Proxy, push *model.PushContext) []*model.Service {
+	if features.FilterGatewayClusterConfig && proxy.Type == model.Router {
+		return push.GatewayServices(proxy)
+	}
+	return push.Services(proxy)
+}
+
+func (configgen *ConfigGeneratorImpl) buildOutboundClusters(cb *ClusterBuilder, cp clusterPatcher, services []*model.Service) []*cluster.Cluster {
 	clusters := make([]*cluster.Cluster, 0)
 	networkView := model.GetNetworkView(cb.proxy)
 
-	var services []*model.Service
-	if features.FilterGatewayClusterConfig && cb.proxy.Type == model.Router {
-		services = cb.push.GatewayServices(cb.proxy)
-	} else {
-		services = cb.push.Services(cb.proxy)
-	}
 	for _, service := range services {
 		for _, port := range service.Ports {
 			if port.Protocol == protocol.UDP {
@@ -715,8 +715,8 @@ func (cb *ClusterBuilder) buildUpstreamClusterTLSContext(opts *buildClusterOpts,
 	proxy := opts.proxy
 
 	// Hack to avoid egress sds cluster config generation for sidecar when
-	// CredentialName is set in DestinationRule
-	if tls.CredentialName != "" && proxy.Type == model.SidecarProxy {
+	// CredentialName is set in DestinationRule, unless it is a named secret served by the agent
+	if tls.CredentialName != "" && proxy.Type == model.SidecarProxy && !authn_model.IsNamedSecretCredential(tls.CredentialName) {
 		if tls.Mode == networking.ClientTLSSettings_SIMPLE || tls.Mode == networking.ClientTLSSettings_MUTUAL {
 			return nil, nil
 		}
@@ -759,6 +759,10 @@ func (cb *ClusterBuilder) buildUpstreamClusterTLSContext(opts *buildClusterOpts,
 					authn_model.SDSRootResourceName), proxy),
 			},
 		}
+		// Federated trust domains are only verified with the roots of the mesh, not with the root certificate mounted in the pod.
+		if cb.push != nil && !metadataSDS.IsRootCertificate() {
+			authn_model.ApplyTrustDomainBundles(tlsContext.CommonTlsContext, cb.push.TrustDomainBundles)
+		}
 		// Set default SNI of cluster name for istio_mutual if sni is not set.
 		if len(tls.Sni) == 0 {
 			tlsContext.Sni = c.cluster.Name
@@ -131,6 +131,7 @@ func (configgen *ConfigGeneratorImpl) BuildNameTable(node *model.Proxy, push *mo
 		nameInfo := &nds.NameTable_NameInfo{
 			Ips:      addressList,
 			Registry: svc.Attributes.ServiceRegistry,
+			Ports:    nameTablePorts(svc.Ports),
 		}
 		if svc.Attributes.ServiceRegistry == string(serviceregistry.Kubernetes) {
 			// The agent will take care of resolving a, a.ns, a.ns.svc, etc.
@@ -142,3 +143,16 @@ func (configgen *ConfigGeneratorImpl) BuildNameTable(node *model.Proxy, push *mo
 	}
 	return out
 }
+
+// nameTablePorts converts the service ports so the agent can answer SRV queries.
+func nameTablePorts(ports model.PortList) []*nds.NameTable_NameInfo_Port {
+	out := make([]*nds.NameTable_NameInfo_Port, 0, len(ports))
+	for _, port := range ports {
+		out = append(out, &nds.NameTable_NameInfo_Port{
+			Name:     port.Name,
+			Number:   uint32(port.Port),
+			Protocol: string(port.Protocol),
+		})
+	}
+	return out
+}
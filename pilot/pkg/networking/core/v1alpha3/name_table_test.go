@@ -112,6 +112,9 @@ func TestNameTable(t *testing.T) {
 						Registry:  "Kubernetes",
 						Shortname: "headless-svc",
 						Namespace: "testns",
+						Ports: []*nds.NameTable_NameInfo_Port{
+							{Name: "tcp-port", Number: 9000, Protocol: "TCP"},
+						},
 					},
 				},
 			},
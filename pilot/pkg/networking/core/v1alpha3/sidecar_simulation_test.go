@@ -399,7 +399,7 @@ func TestInboundClusters(t *testing.T) {
 				Instances: tt.instances,
 				Configs:   tt.configs,
 			})
-			sim := simulation.NewSimulationFromConfigGen(t, s, s.SetupProxy(tt.proxy))
+			sim := newSimulationFromConfigGen(t, s, s.SetupProxy(tt.proxy))
 
 			clusters := xdstest.FilterClusters(sim.Clusters, func(c *cluster.Cluster) bool {
 				return strings.HasPrefix(c.Name, "inbound")
@@ -440,12 +440,12 @@ func TestInboundClusters(t *testing.T) {
 						}
 					}
 				}
-				sim.Run(simulation.Call{
+				matchResult(t, sim.Run(simulation.Call{
 					Port:     port,
 					Protocol: simulation.HTTP,
 					Address:  "1.2.3.4",
 					CallMode: simulation.CallModeInbound,
-				}).Matches(t, simulation.Result{
+				}), simulation.Result{
 					ClusterMatched: cname,
 				})
 			}
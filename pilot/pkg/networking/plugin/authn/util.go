@@ -15,13 +15,20 @@
 package authn
 
 import (
-	meshconfig "istio.io/api/mesh/v1alpha1"
 	"istio.io/istio/pilot/pkg/features"
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/util/sets"
 )
 
-func trustDomainsForValidation(meshConfig *meshconfig.MeshConfig) []string {
+func trustDomainsForValidation(push *model.PushContext) []string {
 	if features.SkipValidateTrustDomain.Get() {
 		return nil
 	}
-	return append([]string{meshConfig.TrustDomain}, meshConfig.TrustDomainAliases...)
+	trustDomains := append([]string{push.Mesh.TrustDomain}, push.Mesh.TrustDomainAliases...)
+	// The certificates of federated trust domains are accepted as well, verified with their own trust anchors.
+	federated := sets.NewSet()
+	for trustDomain := range push.TrustDomainBundles {
+		federated.Insert(trustDomain)
+	}
+	return append(trustDomains, federated.Delete(trustDomains...).SortedList()...)
 }
@@ -135,6 +135,17 @@ func (a *AggregateController) GetCaCert(name, namespace string) (cert []byte) {
 	return nil
 }
 
+func (a *AggregateController) GetDockerCredential(name, namespace string) (cred []byte) {
+	// Search through all clusters, find first non-empty result
+	for _, c := range a.controllers {
+		k := c.GetDockerCredential(name, namespace)
+		if k != nil {
+			return k
+		}
+	}
+	return nil
+}
+
 func (a *AggregateController) Authorize(serviceAccount, namespace string) error {
 	return a.authController.Authorize(serviceAccount, namespace)
 }
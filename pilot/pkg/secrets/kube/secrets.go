@@ -204,6 +204,15 @@ func (s *SecretsController) GetCaCert(name, namespace string) (cert []byte) {
 	return rootCert
 }
 
+// GetDockerCredential returns the Docker config.json of a kubernetes.io/dockerconfigjson secret.
+func (s *SecretsController) GetDockerCredential(name, namespace string) (cred []byte) {
+	k8sSecret, err := s.secrets.Lister().Secrets(namespace).Get(name)
+	if err != nil || k8sSecret.Type != v1.SecretTypeDockerConfigJson {
+		return nil
+	}
+	return k8sSecret.Data[v1.DockerConfigJsonKey]
+}
+
 // extractKeyAndCert extracts server key, certificate
 func extractKeyAndCert(scrt *v1.Secret) (key, cert []byte) {
 	if len(scrt.Data[GenericScrtCert]) > 0 {
@@ -128,6 +128,26 @@ func TestSecretsController(t *testing.T) {
 	}
 }
 
+func TestGetDockerCredential(t *testing.T) {
+	pullSecret := makeSecret("pull", map[string]string{corev1.DockerConfigJsonKey: `{"auths":{}}`})
+	pullSecret.Type = corev1.SecretTypeDockerConfigJson
+	opaque := makeSecret("opaque", map[string]string{corev1.DockerConfigJsonKey: `{"auths":{}}`})
+	client := kube.NewFakeClient(pullSecret, opaque)
+	sc := NewSecretsController(client, "")
+	client.RunAndWait(make(chan struct{}))
+
+	if got := sc.GetDockerCredential("pull", "default"); string(got) != `{"auths":{}}` {
+		t.Errorf("got docker credential %q", string(got))
+	}
+	// Only kubernetes.io/dockerconfigjson secrets are accepted
+	if got := sc.GetDockerCredential("opaque", "default"); got != nil {
+		t.Errorf("expected no docker credential for an opaque secret, got %q", string(got))
+	}
+	if got := sc.GetDockerCredential("pull", "wrong-namespace"); got != nil {
+		t.Errorf("expected no docker credential in another namespace, got %q", string(got))
+	}
+}
+
 func allowIdentities(c kube.Client, identities ...string) {
 	allowed := sets.NewSet(identities...)
 	c.Kube().(*fake.Clientset).Fake.PrependReactor("create", "subjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
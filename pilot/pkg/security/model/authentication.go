@@ -15,6 +15,8 @@
 package model
 
 import (
+	"sort"
+	"strings"
 	"time"
 
 	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
@@ -53,6 +55,10 @@ const (
 	// SdsCaSuffix is the suffix of the sds resource name for root CA.
 	SdsCaSuffix = "-cacert"
 
+	// SPIFFECertValidatorName is the name of the Envoy certificate validator verifying the certificates of
+	// each SPIFFE trust domain with its own trust bundle.
+	SPIFFECertValidatorName = "envoy.tls.cert_validator.spiffe"
+
 	// EnvoyJwtFilterName is the name of the Envoy JWT filter. This should be the same as the name defined
 	// in https://github.com/envoyproxy/envoy/blob/v1.9.1/source/extensions/filters/http/well_known_names.h#L48
 	EnvoyJwtFilterName = "envoy.filters.http.jwt_authn"
@@ -65,6 +71,10 @@ const (
 	// KubernetesSecretType is the name of a SDS secret stored in Kubernetes
 	KubernetesSecretType    = "kubernetes"
 	KubernetesSecretTypeURI = KubernetesSecretType + "://"
+
+	// NamedSecretTypeURI is the prefix of the credential names of the named secrets served by the SDS server of
+	// the agent, as configured with NAMED_SECRETS, rather than by Istiod.
+	NamedSecretTypeURI = "named://"
 )
 
 var SDSAdsConfig = &core.ConfigSource{
@@ -80,11 +90,14 @@ var SDSAdsConfig = &core.ConfigSource{
 // ConstructSdsSecretConfigForCredential constructs SDS secret configuration used
 // from certificates referenced by credentialName in DestinationRule or Gateway.
 // Currently this is served by a local SDS server, but in the future replaced by
-// Istiod SDS server.
+// Istiod SDS server. Named secrets are always served by the SDS server of the agent.
 func ConstructSdsSecretConfigForCredential(name string) *tls.SdsSecretConfig {
 	if name == "" {
 		return nil
 	}
+	if IsNamedSecretCredential(name) {
+		return ConstructSdsSecretConfig(name, nil)
+	}
 
 	return &tls.SdsSecretConfig{
 		Name:      KubernetesSecretTypeURI + name,
@@ -92,6 +105,11 @@ func ConstructSdsSecretConfigForCredential(name string) *tls.SdsSecretConfig {
 	}
 }
 
+// IsNamedSecretCredential returns whether credentialName refers to a named secret of the agent.
+func IsNamedSecretCredential(credentialName string) bool {
+	return strings.HasPrefix(credentialName, NamedSecretTypeURI)
+}
+
 // Preconfigured SDS configs to avoid excessive memory allocations
 var (
 	// set the fetch timeout to 0 here in legacyDefaultSDSConfig and rootSDSConfig
@@ -285,6 +303,37 @@ func ApplyToCommonTLSContext(tlsContext *tls.CommonTlsContext, proxy *model.Prox
 	}
 }
 
+// ApplyTrustDomainBundles configures the SPIFFE certificate validator on the combined validation context of
+// tlsContext, so that the peer certificates of each trust domain of trustDomainBundles are verified with the
+// trust anchors of that trust domain only. It does nothing without trust domain bundles.
+func ApplyTrustDomainBundles(tlsContext *tls.CommonTlsContext, trustDomainBundles map[string][]string) {
+	combined := tlsContext.GetCombinedValidationContext()
+	if len(trustDomainBundles) == 0 || combined == nil {
+		return
+	}
+	trustDomains := make([]string, 0, len(trustDomainBundles))
+	for trustDomain := range trustDomainBundles {
+		trustDomains = append(trustDomains, trustDomain)
+	}
+	sort.Strings(trustDomains)
+	validatorConfig := &tls.SPIFFECertValidatorConfig{}
+	for _, trustDomain := range trustDomains {
+		validatorConfig.TrustDomains = append(validatorConfig.TrustDomains, &tls.SPIFFECertValidatorConfig_TrustDomain{
+			Name: trustDomain,
+			TrustBundle: &core.DataSource{
+				Specifier: &core.DataSource_InlineString{InlineString: strings.Join(trustDomainBundles[trustDomain], "\n")},
+			},
+		})
+	}
+	if combined.DefaultValidationContext == nil {
+		combined.DefaultValidationContext = &tls.CertificateValidationContext{}
+	}
+	combined.DefaultValidationContext.CustomValidatorConfig = &core.TypedExtensionConfig{
+		Name:        SPIFFECertValidatorName,
+		TypedConfig: util.MessageToAny(validatorConfig),
+	}
+}
+
 // ApplyCustomSDSToClientCommonTLSContext applies the customized sds to CommonTlsContext
 // Used for building upstream TLS context for egress gateway's TLS/mTLS origination
 func ApplyCustomSDSToClientCommonTLSContext(tlsContext *tls.CommonTlsContext, tlsOpts *networking.ClientTLSSettings) {
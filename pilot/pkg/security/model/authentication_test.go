@@ -27,6 +27,7 @@ import (
 	"google.golang.org/protobuf/types/known/durationpb"
 
 	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/networking/util"
 	"istio.io/istio/pkg/spiffe"
 )
 
@@ -76,6 +77,20 @@ func TestConstructSdsSecretConfig(t *testing.T) {
 	}
 }
 
+func TestConstructSdsSecretConfigForCredential(t *testing.T) {
+	if got, want := ConstructSdsSecretConfigForCredential("cred"), (&auth.SdsSecretConfig{
+		Name:      "kubernetes://cred",
+		SdsConfig: SDSAdsConfig,
+	}); !cmp.Equal(got, want, protocmp.Transform()) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	// Named secrets are served by the agent
+	if got, want := ConstructSdsSecretConfigForCredential("named://cred"),
+		ConstructSdsSecretConfig("named://cred", nil); !cmp.Equal(got, want, protocmp.Transform()) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
 func TestConstructValidationContext(t *testing.T) {
 	testCases := []struct {
 		name            string
@@ -487,3 +502,36 @@ func TestApplyToCommonTLSContext(t *testing.T) {
 		})
 	}
 }
+
+func TestApplyTrustDomainBundles(t *testing.T) {
+	tlsContext := &auth.CommonTlsContext{}
+	ApplyToCommonTLSContext(tlsContext, &model.Proxy{Metadata: &model.NodeMetadata{}}, []string{}, []string{}, true)
+	ApplyTrustDomainBundles(tlsContext, nil)
+	if tlsContext.GetCombinedValidationContext().DefaultValidationContext.CustomValidatorConfig != nil {
+		t.Fatalf("expected no certificate validator without trust domain bundles")
+	}
+
+	ApplyTrustDomainBundles(tlsContext, map[string][]string{
+		"foo.com":       {"foo-root-1", "foo-root-2"},
+		"cluster.local": {"root"},
+	})
+	expected := &core.TypedExtensionConfig{
+		Name: SPIFFECertValidatorName,
+		TypedConfig: util.MessageToAny(&auth.SPIFFECertValidatorConfig{
+			TrustDomains: []*auth.SPIFFECertValidatorConfig_TrustDomain{
+				{
+					Name:        "cluster.local",
+					TrustBundle: &core.DataSource{Specifier: &core.DataSource_InlineString{InlineString: "root"}},
+				},
+				{
+					Name:        "foo.com",
+					TrustBundle: &core.DataSource{Specifier: &core.DataSource_InlineString{InlineString: "foo-root-1\nfoo-root-2"}},
+				},
+			},
+		}),
+	}
+	got := tlsContext.GetCombinedValidationContext().DefaultValidationContext.CustomValidatorConfig
+	if diff := cmp.Diff(expected, got, protocmp.Transform()); diff != "" {
+		t.Errorf("unexpected certificate validator: %v", diff)
+	}
+}
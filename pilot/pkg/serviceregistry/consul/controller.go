@@ -0,0 +1,648 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package consul
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/atomic"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/serviceregistry"
+	"istio.io/istio/pkg/config/host"
+	"istio.io/istio/pkg/config/labels"
+	istiolog "istio.io/pkg/log"
+)
+
+var log = istiolog.RegisterScope("consul", "consul service registry controller", 0)
+
+const (
+	// defaultWaitTime is the maximum duration of the blocking queries of the catalog.
+	defaultWaitTime = 5 * time.Minute
+	// defaultMaxConcurrentReads is the default maximum number of services read from the catalog at once.
+	defaultMaxConcurrentReads = 8
+	// retryDelay is the delay before retrying a failed query of the catalog.
+	retryDelay = time.Second
+	// maxRetryDelay is the maximum delay between the retries of the reads of services which keep failing.
+	maxRetryDelay = time.Minute
+	// tokenHeader is the header of the ACL token of the requests to the catalog.
+	tokenHeader = "X-Consul-Token"
+)
+
+// Options stores the configurable attributes of a Controller.
+type Options struct {
+	// ServerAddr is the URL of the HTTP API of the catalog, such as http://127.0.0.1:8500.
+	ServerAddr string
+
+	// ClusterID identifies the registry.
+	ClusterID string
+
+	// XDSUpdater will push changes to the xDS server.
+	XDSUpdater model.XDSUpdater
+
+	// WaitTime is the maximum duration of the blocking queries, 5 minutes by default.
+	WaitTime time.Duration
+
+	// MaxConcurrentReads is the maximum number of services read from the catalog at once, 8 by default.
+	MaxConcurrentReads int
+
+	// Token is the ACL token of the requests to the catalog.
+	Token string
+
+	// TokenFile is the file holding the ACL token of the requests to the catalog. It is read on every
+	// request, so that the token can be rotated, and takes precedence over Token.
+	TokenFile string
+
+	// CACertFile is the file of the CA certificates verifying the certificate of the catalog. If empty,
+	// the system roots are used.
+	CACertFile string
+
+	// ClientCertFile and ClientKeyFile are the files of the client certificate and key presented to
+	// the catalog, if it verifies the certificates of its clients.
+	ClientCertFile string
+	ClientKeyFile  string
+}
+
+// Controller is a service registry reading the services of a Consul catalog through its HTTP API.
+// Two blocking queries watch the whole catalog, whatever its number of services: one the list of
+// services and the other the health checks. When the list changes, all the services are read again,
+// since the catalog does not tell which one changed, and when health checks change, only the
+// services of the checks are. The services are read by at most MaxConcurrentReads workers, and
+// their endpoints pushed incrementally. Services which fail to be read are read again with a
+// backoff, and the registry is synced once every service has been read.
+type Controller struct {
+	serverAddr string
+	clusterID  string
+	xdsUpdater model.XDSUpdater
+	waitTime   time.Duration
+	maxReads   int
+	token      string
+	tokenFile  string
+	client     *http.Client
+
+	mutex    sync.RWMutex
+	services map[host.Name]*model.Service
+	// instances stores hostname ==> instances of the healthy endpoints of the service
+	instances map[host.Name][]*model.ServiceInstance
+	// indexes stores the name ==> index of the last read of the catalog services, to discard the
+	// results of older reads completing after newer ones
+	indexes map[string]uint64
+	// nodes stores the name ==> nodes of the instances of the catalog services, to read them again
+	// when the checks of their nodes change
+	nodes map[string]map[string]struct{}
+	// failed stores the names of the catalog services whose last read failed, which are read again
+	// with a backoff
+	failed map[string]struct{}
+
+	handlers []func(*model.Service, model.Event)
+	// listed is set once the list of services of the catalog is first read
+	listed *atomic.Bool
+	synced *atomic.Bool
+}
+
+var _ serviceregistry.Instance = &Controller{}
+
+// NewController creates a catalog service registry. The catalog is watched once Run is called.
+func NewController(options Options) (*Controller, error) {
+	waitTime := options.WaitTime
+	if waitTime == 0 {
+		waitTime = defaultWaitTime
+	}
+	maxReads := options.MaxConcurrentReads
+	if maxReads <= 0 {
+		maxReads = defaultMaxConcurrentReads
+	}
+	tlsConfig, err := newTLSConfig(options)
+	if err != nil {
+		return nil, err
+	}
+	return &Controller{
+		serverAddr: strings.TrimSuffix(options.ServerAddr, "/"),
+		clusterID:  options.ClusterID,
+		xdsUpdater: options.XDSUpdater,
+		waitTime:   waitTime,
+		maxReads:   maxReads,
+		token:      options.Token,
+		tokenFile:  options.TokenFile,
+		// The catalog holds the blocking queries for up to the wait time, plus a random jitter of up
+		// to 1/16 of it.
+		client: &http.Client{
+			Timeout:   waitTime + waitTime/16 + 10*time.Second,
+			Transport: &http.Transport{Proxy: http.ProxyFromEnvironment, TLSClientConfig: tlsConfig},
+		},
+		services:  make(map[host.Name]*model.Service),
+		instances: make(map[host.Name][]*model.ServiceInstance),
+		indexes:   make(map[string]uint64),
+		nodes:     make(map[string]map[string]struct{}),
+		failed:    make(map[string]struct{}),
+		listed:    atomic.NewBool(false),
+		synced:    atomic.NewBool(false),
+	}, nil
+}
+
+func newTLSConfig(options Options) (*tls.Config, error) {
+	if options.CACertFile == "" && options.ClientCertFile == "" && options.ClientKeyFile == "" {
+		return nil, nil
+	}
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if options.CACertFile != "" {
+		caCerts, err := ioutil.ReadFile(options.CACertFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the CA certificates of the catalog: %v", err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(caCerts) {
+			return nil, fmt.Errorf("no CA certificate found in %s", options.CACertFile)
+		}
+	}
+	if options.ClientCertFile != "" || options.ClientKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(options.ClientCertFile, options.ClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load the client certificate of the catalog: %v", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+func (c *Controller) Provider() serviceregistry.ProviderID {
+	return serviceregistry.Consul
+}
+
+func (c *Controller) Cluster() string {
+	return c.clusterID
+}
+
+// AppendServiceHandler implements a service catalog operation
+func (c *Controller) AppendServiceHandler(f func(*model.Service, model.Event)) {
+	c.mutex.Lock()
+	c.handlers = append(c.handlers, f)
+	c.mutex.Unlock()
+}
+
+// AppendWorkloadHandler is a no-op: the catalog has no workloads other than the instances of its
+// services.
+func (c *Controller) AppendWorkloadHandler(func(*model.WorkloadInstance, model.Event)) {}
+
+// HasSynced returns true once all the services of the catalog have been read successfully.
+func (c *Controller) HasSynced() bool {
+	return c.synced.Load()
+}
+
+// Run watches the catalog until stop is closed.
+func (c *Controller) Run(stop <-chan struct{}) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-stop
+		cancel()
+	}()
+
+	// The health checks are read first, so that the changes made while the services are read are
+	// not missed.
+	checksRead := make(chan struct{})
+	go c.watchChecks(ctx, checksRead)
+	select {
+	case <-checksRead:
+	case <-ctx.Done():
+		return
+	}
+
+	go c.retryFailed(ctx)
+
+	var index uint64
+	for {
+		var names map[string][]string
+		newIndex, err := c.query(ctx, "/v1/catalog/services", index, &names)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Warnf("failed to read the services of the catalog %s: %v", c.serverAddr, err)
+			if !sleep(ctx, retryDelay) {
+				return
+			}
+			index = 0
+			continue
+		}
+		if newIndex == index {
+			// The blocking query timed out without any change.
+			continue
+		}
+		index = nextIndex(index, newIndex)
+		c.updateServices(ctx, names)
+		c.listed.Store(true)
+		c.updateSynced()
+	}
+}
+
+// updateSynced marks the registry synced once the list of services is read, and every service in it
+// has been read successfully.
+func (c *Controller) updateSynced() {
+	if c.synced.Load() || !c.listed.Load() {
+		return
+	}
+	c.mutex.RLock()
+	failed := len(c.failed)
+	c.mutex.RUnlock()
+	if failed == 0 {
+		c.synced.Store(true)
+	}
+}
+
+// retryFailed reads again the services whose last read failed, with an exponential backoff while
+// reads keep failing, until ctx is cancelled.
+func (c *Controller) retryFailed(ctx context.Context) {
+	delay := retryDelay
+	for sleep(ctx, delay) {
+		names := c.failedServices()
+		if len(names) == 0 {
+			delay = retryDelay
+			continue
+		}
+		c.readServices(ctx, names)
+		if len(c.failedServices()) == 0 {
+			delay = retryDelay
+			c.updateSynced()
+			continue
+		}
+		if delay *= 2; delay > maxRetryDelay {
+			delay = maxRetryDelay
+		}
+	}
+}
+
+func (c *Controller) failedServices() []string {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	out := make([]string, 0, len(c.failed))
+	for name := range c.failed {
+		out = append(out, name)
+	}
+	return out
+}
+
+// updateServices deletes the services removed from the catalog, and reads all the others again.
+func (c *Controller) updateServices(ctx context.Context, names map[string][]string) {
+	c.mutex.Lock()
+	removed := make([]string, 0)
+	for name := range c.indexes {
+		if _, ok := names[name]; !ok {
+			delete(c.indexes, name)
+			delete(c.nodes, name)
+			delete(c.failed, name)
+			removed = append(removed, name)
+		}
+	}
+	all := make([]string, 0, len(names))
+	for name := range names {
+		if _, ok := c.indexes[name]; !ok {
+			c.indexes[name] = 0
+		}
+		all = append(all, name)
+	}
+	c.mutex.Unlock()
+
+	for _, name := range removed {
+		c.setService(name, 0, nil)
+	}
+	c.readServices(ctx, all)
+}
+
+// watchChecks reads again the services of the health checks which change, until ctx is cancelled.
+// read is closed once the checks are first read.
+func (c *Controller) watchChecks(ctx context.Context, read chan struct{}) {
+	var index uint64
+	var checks map[string]*healthCheck
+	for {
+		var list []*healthCheck
+		newIndex, err := c.query(ctx, "/v1/health/state/any", index, &list)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Warnf("failed to read the health checks of the catalog %s: %v", c.serverAddr, err)
+			if !sleep(ctx, retryDelay) {
+				return
+			}
+			index = 0
+			continue
+		}
+		if newIndex == index {
+			continue
+		}
+		index = nextIndex(index, newIndex)
+
+		current := make(map[string]*healthCheck, len(list))
+		for _, check := range list {
+			current[check.Node+"/"+check.CheckID] = check
+		}
+		if checks == nil {
+			checks = current
+			close(read)
+			continue
+		}
+		changed := make([]*healthCheck, 0)
+		for key, check := range current {
+			if prev, ok := checks[key]; !ok || prev.Status != check.Status || prev.ServiceName != check.ServiceName {
+				changed = append(changed, check)
+			}
+		}
+		for key, prev := range checks {
+			if _, ok := current[key]; !ok {
+				changed = append(changed, prev)
+			}
+		}
+		checks = current
+		if len(changed) > 0 {
+			c.readServices(ctx, c.checkedServices(changed))
+		}
+	}
+}
+
+// checkedServices returns the names of the services whose instances are checked by checks: the
+// service of a service check, or all the services on the node of a node check.
+func (c *Controller) checkedServices(checks []*healthCheck) []string {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	names := make(map[string]struct{})
+	for _, check := range checks {
+		if check.ServiceName != "" {
+			if _, ok := c.indexes[check.ServiceName]; ok {
+				names[check.ServiceName] = struct{}{}
+			}
+			continue
+		}
+		for name, nodes := range c.nodes {
+			if _, ok := nodes[check.Node]; ok {
+				names[name] = struct{}{}
+			}
+		}
+	}
+	out := make([]string, 0, len(names))
+	for name := range names {
+		out = append(out, name)
+	}
+	return out
+}
+
+// readServices reads the services names, at most maxReads at once, and returns once they are all read.
+// The services which fail to be read are retried by retryFailed.
+func (c *Controller) readServices(ctx context.Context, names []string) {
+	sem := make(chan struct{}, c.maxReads)
+	wg := sync.WaitGroup{}
+	for _, name := range names {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return
+		}
+		wg.Add(1)
+		go func(name string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			var entries []*healthEntry
+			index, err := c.query(ctx, serviceHealthPath(name), 0, &entries)
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Warnf("failed to read the service %s of the catalog %s: %v", name, c.serverAddr, err)
+					c.mutex.Lock()
+					if _, ok := c.indexes[name]; ok {
+						c.failed[name] = struct{}{}
+					}
+					c.mutex.Unlock()
+				}
+				return
+			}
+			c.mutex.Lock()
+			delete(c.failed, name)
+			c.mutex.Unlock()
+			c.setService(name, index, entries)
+		}(name)
+	}
+	wg.Wait()
+}
+
+// setService sets the service name from its entries read at index, or deletes it if entries is nil,
+// and notifies its changes.
+func (c *Controller) setService(name string, index uint64, entries []*healthEntry) {
+	svc, instances := convertService(name, entries)
+	hostname := serviceHostname(name)
+	c.mutex.Lock()
+	if entries != nil {
+		prevIndex, ok := c.indexes[name]
+		if !ok || index < prevIndex {
+			// The service was removed from the catalog, or read again, while it was read.
+			c.mutex.Unlock()
+			return
+		}
+		c.indexes[name] = index
+		nodes := make(map[string]struct{}, len(entries))
+		for _, entry := range entries {
+			nodes[entry.Node.Node] = struct{}{}
+		}
+		c.nodes[name] = nodes
+	}
+	prev, prevInstances := c.services[hostname], c.instances[hostname]
+	if svc == nil {
+		delete(c.services, hostname)
+		delete(c.instances, hostname)
+	} else {
+		c.services[hostname] = svc
+		c.instances[hostname] = instances
+	}
+	handlers := c.handlers
+	c.mutex.Unlock()
+
+	switch {
+	case svc == nil && prev != nil:
+		c.notifyService(prev, nil, model.EventDelete, handlers)
+	case svc == nil:
+	case prev == nil:
+		c.notifyService(svc, instances, model.EventAdd, handlers)
+	case !reflect.DeepEqual(prev, svc):
+		c.notifyService(svc, instances, model.EventUpdate, handlers)
+	case !reflect.DeepEqual(prevInstances, instances):
+		// Only the endpoints changed: push them incrementally.
+		c.xdsUpdater.EDSUpdate(c.clusterID, string(hostname), svc.Attributes.Namespace, endpoints(instances))
+	}
+}
+
+func (c *Controller) notifyService(svc *model.Service, instances []*model.ServiceInstance, event model.Event,
+	handlers []func(*model.Service, model.Event)) {
+	if event != model.EventDelete {
+		c.xdsUpdater.EDSCacheUpdate(c.clusterID, string(svc.Hostname), svc.Attributes.Namespace, endpoints(instances))
+	}
+	c.xdsUpdater.SvcUpdate(c.clusterID, string(svc.Hostname), svc.Attributes.Namespace, event)
+	for _, f := range handlers {
+		f(svc, event)
+	}
+}
+
+// query runs a blocking query of the catalog, returning once the index of the result of path is
+// greater than index, or after the wait time. If index is 0, the query returns right away. The
+// result is decoded to out.
+func (c *Controller) query(ctx context.Context, path string, index uint64, out interface{}) (uint64, error) {
+	params := url.Values{}
+	if index != 0 {
+		params.Set("index", strconv.FormatUint(index, 10))
+		params.Set("wait", fmt.Sprintf("%ds", int(c.waitTime.Seconds())))
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.serverAddr+path+"?"+params.Encode(), nil)
+	if err != nil {
+		return 0, err
+	}
+	token := c.token
+	if c.tokenFile != "" {
+		b, err := ioutil.ReadFile(c.tokenFile)
+		if err != nil {
+			return 0, fmt.Errorf("failed to read the ACL token: %v", err)
+		}
+		token = strings.TrimSpace(string(b))
+	}
+	if token != "" {
+		req.Header.Set(tokenHeader, token)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return 0, err
+	}
+	newIndex, err := strconv.ParseUint(resp.Header.Get("X-Consul-Index"), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid index %q: %v", resp.Header.Get("X-Consul-Index"), err)
+	}
+	return newIndex, nil
+}
+
+// nextIndex returns the index of the next blocking query. The index is reset if it went backwards,
+// such as when the catalog is restored from a snapshot.
+func nextIndex(prev, index uint64) uint64 {
+	if index < prev {
+		return 0
+	}
+	return index
+}
+
+func serviceHealthPath(name string) string {
+	return "/v1/health/service/" + url.PathEscape(name)
+}
+
+// sleep waits for d, returning false if ctx is cancelled first.
+func sleep(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-time.After(d):
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func endpoints(instances []*model.ServiceInstance) []*model.IstioEndpoint {
+	out := make([]*model.IstioEndpoint, 0, len(instances))
+	for _, instance := range instances {
+		out = append(out, instance.Endpoint)
+	}
+	return out
+}
+
+// Services implements a service catalog operation
+func (c *Controller) Services() ([]*model.Service, error) {
+	c.mutex.RLock()
+	out := make([]*model.Service, 0, len(c.services))
+	for _, svc := range c.services {
+		out = append(out, svc)
+	}
+	c.mutex.RUnlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].Hostname < out[j].Hostname })
+	return out, nil
+}
+
+// GetService implements a service catalog operation
+func (c *Controller) GetService(hostname host.Name) (*model.Service, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.services[hostname], nil
+}
+
+// InstancesByPort implements a service catalog operation
+func (c *Controller) InstancesByPort(svc *model.Service, port int, labels labels.Collection) []*model.ServiceInstance {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	out := make([]*model.ServiceInstance, 0)
+	for _, instance := range c.instances[svc.Hostname] {
+		if instance.ServicePort.Port == port && labels.HasSubsetOf(instance.Endpoint.Labels) {
+			out = append(out, instance)
+		}
+	}
+	return out
+}
+
+// GetProxyServiceInstances returns the service instances of the endpoints with the IP addresses of the proxy.
+func (c *Controller) GetProxyServiceInstances(node *model.Proxy) []*model.ServiceInstance {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	out := make([]*model.ServiceInstance, 0)
+	for _, instances := range c.instances {
+		for _, instance := range instances {
+			for _, ip := range node.IPAddresses {
+				if instance.Endpoint.Address == ip {
+					out = append(out, instance)
+					break
+				}
+			}
+		}
+	}
+	return out
+}
+
+func (c *Controller) GetProxyWorkloadLabels(proxy *model.Proxy) labels.Collection {
+	out := make(labels.Collection, 0)
+	for _, instance := range c.GetProxyServiceInstances(proxy) {
+		out = append(out, instance.Endpoint.Labels)
+	}
+	return out
+}
+
+// GetIstioServiceAccounts implements model.ServiceAccounts operation
+func (c *Controller) GetIstioServiceAccounts(svc *model.Service, ports []int) []string {
+	return model.GetServiceAccounts(svc, ports, c)
+}
+
+func (c *Controller) NetworkGateways() map[string][]*model.Gateway {
+	return nil
+}
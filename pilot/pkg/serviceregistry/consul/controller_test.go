@@ -0,0 +1,340 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package consul
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pkg/config/labels"
+	"istio.io/istio/pkg/config/protocol"
+	"istio.io/istio/pkg/test/util/retry"
+)
+
+// fakeCatalog is a stand-in for the HTTP API of a Consul catalog, supporting blocking queries.
+type fakeCatalog struct {
+	mutex    sync.Mutex
+	index    uint64
+	services map[string][]*healthEntry
+	// token is the ACL token the requests must have, if set
+	token string
+	// failures stores the name ==> number of the next reads of the service which fail
+	failures map[string]int
+	// changed is closed, and replaced, whenever the catalog changes
+	changed chan struct{}
+}
+
+func newFakeCatalog() *fakeCatalog {
+	return &fakeCatalog{
+		index:    1,
+		services: make(map[string][]*healthEntry),
+		failures: make(map[string]int),
+		changed:  make(chan struct{}),
+	}
+}
+
+// set sets, or deletes if entries is nil, the instances of the service name.
+func (f *fakeCatalog) set(name string, entries ...*healthEntry) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if entries == nil {
+		delete(f.services, name)
+	} else {
+		f.services[name] = entries
+	}
+	f.index++
+	close(f.changed)
+	f.changed = make(chan struct{})
+}
+
+func (f *fakeCatalog) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if f.token != "" && r.Header.Get(tokenHeader) != f.token {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	index, _ := strconv.ParseUint(r.URL.Query().Get("index"), 10, 64)
+	f.mutex.Lock()
+	if index >= f.index {
+		changed := f.changed
+		f.mutex.Unlock()
+		select {
+		case <-changed:
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+		}
+		f.mutex.Lock()
+	}
+	defer f.mutex.Unlock()
+
+	var out interface{}
+	switch {
+	case r.URL.Path == "/v1/catalog/services":
+		names := make(map[string][]string, len(f.services))
+		for name := range f.services {
+			names[name] = []string{}
+		}
+		out = names
+	case strings.HasPrefix(r.URL.Path, "/v1/health/service/"):
+		name := strings.TrimPrefix(r.URL.Path, "/v1/health/service/")
+		if f.failures[name] > 0 {
+			f.failures[name]--
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		entries := f.services[name]
+		if entries == nil {
+			entries = []*healthEntry{}
+		}
+		out = entries
+	case r.URL.Path == "/v1/health/state/any":
+		checks := make([]healthCheck, 0)
+		for _, entries := range f.services {
+			for _, entry := range entries {
+				checks = append(checks, entry.Checks...)
+			}
+		}
+		out = checks
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.Header().Set("X-Consul-Index", strconv.FormatUint(f.index, 10))
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+func instance(id, addr string, port int, status string, tags ...string) *healthEntry {
+	return &healthEntry{
+		Node:    catalogNode{Node: "node-" + id, Address: addr, Datacenter: "dc1"},
+		Service: catalogService{ID: id, Tags: tags, Port: port, Meta: map[string]string{"protocol": "http"}},
+		Checks:  []healthCheck{{Node: "node-" + id, CheckID: "serfHealth", Status: status}},
+	}
+}
+
+type event struct {
+	kind      string
+	host      string
+	endpoints int
+}
+
+type fakeXdsUpdater struct {
+	events chan event
+}
+
+var _ model.XDSUpdater = &fakeXdsUpdater{}
+
+func (fx *fakeXdsUpdater) EDSUpdate(_, hostname string, _ string, entry []*model.IstioEndpoint) {
+	fx.events <- event{kind: "eds", host: hostname, endpoints: len(entry)}
+}
+
+func (fx *fakeXdsUpdater) EDSCacheUpdate(_, hostname string, _ string, entry []*model.IstioEndpoint) {
+	fx.events <- event{kind: "edscache", host: hostname, endpoints: len(entry)}
+}
+
+func (fx *fakeXdsUpdater) SvcUpdate(_, hostname string, _ string, e model.Event) {
+	fx.events <- event{kind: "svc" + e.String(), host: hostname}
+}
+
+func (fx *fakeXdsUpdater) ConfigUpdate(*model.PushRequest) {}
+
+func (fx *fakeXdsUpdater) ProxyUpdate(_, _ string) {}
+
+// wait waits for the event of kind for the hostname, skipping the other events.
+func (fx *fakeXdsUpdater) wait(t *testing.T, kind, hostname string) event {
+	t.Helper()
+	for {
+		select {
+		case e := <-fx.events:
+			if e.kind == kind && e.host == hostname {
+				return e
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for %s event for %s", kind, hostname)
+		}
+	}
+}
+
+func TestController(t *testing.T) {
+	catalog := newFakeCatalog()
+	catalog.set("web",
+		instance("web-1", "10.0.0.1", 8080, "passing", "version=v1"),
+		instance("web-2", "10.0.0.2", 8080, "critical", "version=v2"))
+	catalog.set("db", &healthEntry{
+		Node:    catalogNode{Node: "node-db", Address: "10.0.1.1"},
+		Service: catalogService{ID: "db-1", Address: "10.0.1.2", Port: 5432},
+	})
+	catalog.token = "secret"
+	server := httptest.NewServer(catalog)
+	defer server.Close()
+
+	fx := &fakeXdsUpdater{events: make(chan event, 100)}
+	c, err := NewController(Options{ServerAddr: server.URL, ClusterID: "consul", XDSUpdater: fx, WaitTime: time.Second,
+		Token: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	go c.Run(stop)
+	retry.UntilSuccessOrFail(t, func() error {
+		if !c.HasSynced() {
+			return fmt.Errorf("not synced")
+		}
+		return nil
+	}, retry.Timeout(5*time.Second))
+
+	services, _ := c.Services()
+	if len(services) != 2 || services[0].Hostname != "db.service.consul" || services[1].Hostname != "web.service.consul" {
+		t.Fatalf("unexpected services %v", services)
+	}
+	if port, _ := services[1].Ports.GetByPort(8080); port == nil || port.Name != "http-8080" || port.Protocol != protocol.HTTP {
+		t.Fatalf("unexpected ports %v", services[1].Ports)
+	}
+	if port, _ := services[0].Ports.GetByPort(5432); port == nil || port.Name != "tcp-5432" || port.Protocol != protocol.TCP {
+		t.Fatalf("unexpected ports %v", services[0].Ports)
+	}
+	instances := c.InstancesByPort(services[1], 8080, nil)
+	if len(instances) != 1 || instances[0].Endpoint.Address != "10.0.0.1" || instances[0].Endpoint.Labels["version"] != "v1" {
+		t.Fatalf("unexpected instances %v", instances)
+	}
+	if instances := c.InstancesByPort(services[1], 8080, labels.Collection{{"version": "v2"}}); len(instances) != 0 {
+		t.Fatalf("unexpected unhealthy instances %v", instances)
+	}
+	if instances := c.GetProxyServiceInstances(&model.Proxy{IPAddresses: []string{"10.0.1.2"}}); len(instances) != 1 {
+		t.Fatalf("unexpected proxy instances %v", instances)
+	}
+
+	t.Run("health change", func(t *testing.T) {
+		catalog.set("web",
+			instance("web-1", "10.0.0.1", 8080, "passing", "version=v1"),
+			instance("web-2", "10.0.0.2", 8080, "warning", "version=v2"))
+		if e := fx.wait(t, "eds", "web.service.consul"); e.endpoints != 2 {
+			t.Fatalf("expected 2 endpoints, got %v", e)
+		}
+	})
+
+	t.Run("service add", func(t *testing.T) {
+		catalog.set("cache", instance("cache-1", "10.0.2.1", 6379, "passing"))
+		fx.wait(t, "svcadd", "cache.service.consul")
+		if svc, _ := c.GetService("cache.service.consul"); svc == nil {
+			t.Fatal("expected the service to be added")
+		}
+	})
+
+	t.Run("service delete", func(t *testing.T) {
+		catalog.set("db")
+		fx.wait(t, "svcdelete", "db.service.consul")
+		if svc, _ := c.GetService("db.service.consul"); svc != nil {
+			t.Fatalf("expected the service to be deleted, got %v", svc)
+		}
+	})
+}
+
+func TestControllerRetry(t *testing.T) {
+	catalog := newFakeCatalog()
+	catalog.set("web", instance("web-1", "10.0.0.1", 8080, "passing"))
+	catalog.set("db", instance("db-1", "10.0.1.1", 5432, "passing"))
+	catalog.failures["web"] = 2
+	server := httptest.NewServer(catalog)
+	defer server.Close()
+
+	fx := &fakeXdsUpdater{events: make(chan event, 100)}
+	c, err := NewController(Options{ServerAddr: server.URL, ClusterID: "consul", XDSUpdater: fx, WaitTime: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	go c.Run(stop)
+
+	fx.wait(t, "svcadd", "db.service.consul")
+	if c.HasSynced() {
+		t.Fatal("expected the registry not to be synced before all the services are read")
+	}
+	retry.UntilSuccessOrFail(t, func() error {
+		if !c.HasSynced() {
+			return fmt.Errorf("not synced")
+		}
+		return nil
+	}, retry.Timeout(10*time.Second))
+	if svc, _ := c.GetService("web.service.consul"); svc == nil {
+		t.Fatal("expected the service failing to be read to be read again")
+	}
+}
+
+func TestConvertServicePorts(t *testing.T) {
+	svc, instances := convertService("web", []*healthEntry{
+		instance("web-1", "10.0.0.1", 8080, "passing"),
+		instance("web-2", "10.0.0.2", 9090, "passing"),
+	})
+	if len(svc.Ports) != 2 || svc.Ports[0].Name != "http-8080" || svc.Ports[1].Name != "http-9090" {
+		t.Fatalf("expected a uniquely named port per instance port, got %v", svc.Ports)
+	}
+	for _, instance := range instances {
+		if instance.Endpoint.ServicePortName != instance.ServicePort.Name ||
+			instance.Endpoint.EndpointPort != uint32(instance.ServicePort.Port) {
+			t.Errorf("endpoint %v does not match its port %v", instance.Endpoint, instance.ServicePort)
+		}
+	}
+}
+
+func TestControllerToken(t *testing.T) {
+	catalog := newFakeCatalog()
+	catalog.token = "secret"
+	server := httptest.NewServer(catalog)
+	defer server.Close()
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := ioutil.WriteFile(tokenFile, []byte("secret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for name, options := range map[string]Options{
+		"token":      {ServerAddr: server.URL, Token: "secret"},
+		"token file": {ServerAddr: server.URL, Token: "ignored", TokenFile: tokenFile},
+	} {
+		t.Run(name, func(t *testing.T) {
+			c, err := NewController(options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var names map[string][]string
+			if _, err := c.query(context.Background(), "/v1/catalog/services", 0, &names); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+	c, err := NewController(Options{ServerAddr: server.URL, Token: "wrong"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names map[string][]string
+	if _, err := c.query(context.Background(), "/v1/catalog/services", 0, &names); err == nil {
+		t.Fatal("expected an error with the wrong token")
+	}
+
+	if _, err := NewController(Options{ServerAddr: server.URL, CACertFile: tokenFile}); err == nil {
+		t.Fatal("expected an error for a CA file without certificates")
+	}
+}
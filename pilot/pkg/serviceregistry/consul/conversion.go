@@ -0,0 +1,178 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package consul
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/serviceregistry"
+	"istio.io/istio/pkg/config/constants"
+	"istio.io/istio/pkg/config/host"
+	"istio.io/istio/pkg/config/labels"
+	"istio.io/istio/pkg/config/protocol"
+)
+
+const (
+	// serviceSuffix is the domain of the hostnames of the catalog services.
+	serviceSuffix = "service.consul"
+
+	// protocolMeta is the key of the service metadata holding the protocol of the service.
+	protocolMeta = "protocol"
+
+	// healthCritical is the status of the failing health checks of the catalog.
+	healthCritical = "critical"
+)
+
+// healthEntry is an instance of a service, as returned by the health endpoint of the catalog.
+type healthEntry struct {
+	Node    catalogNode
+	Service catalogService
+	Checks  []healthCheck
+}
+
+type catalogNode struct {
+	Node       string
+	Address    string
+	Datacenter string
+}
+
+type catalogService struct {
+	ID      string
+	Service string
+	Tags    []string
+	Address string
+	Meta    map[string]string
+	Port    int
+}
+
+type healthCheck struct {
+	Node        string
+	CheckID     string
+	Status      string
+	ServiceName string
+}
+
+// serviceHostname returns the hostname of the catalog service name.
+func serviceHostname(name string) host.Name {
+	return host.Name(name + "." + serviceSuffix)
+}
+
+// convertService converts the instances of the catalog service name to the service and the
+// instances of its healthy endpoints. The ports of the service are the ports of its instances,
+// named <protocol>-<port> after the protocol of the service. It returns nil if the service has no
+// instances.
+func convertService(name string, entries []*healthEntry) (*model.Service, []*model.ServiceInstance) {
+	if len(entries) == 0 {
+		return nil, nil
+	}
+
+	proto := protocol.TCP
+	for _, entry := range entries {
+		if p := entry.Service.Meta[protocolMeta]; p != "" {
+			if proto = protocol.Parse(p); proto == protocol.Unsupported {
+				proto = protocol.TCP
+			}
+			break
+		}
+	}
+
+	portsByNumber := make(map[int]*model.Port)
+	for _, entry := range entries {
+		if _, ok := portsByNumber[entry.Service.Port]; !ok {
+			portsByNumber[entry.Service.Port] = &model.Port{
+				Name:     fmt.Sprintf("%s-%d", strings.ToLower(string(proto)), entry.Service.Port),
+				Port:     entry.Service.Port,
+				Protocol: proto,
+			}
+		}
+	}
+	ports := make(model.PortList, 0, len(portsByNumber))
+	for _, port := range portsByNumber {
+		ports = append(ports, port)
+	}
+	sort.Slice(ports, func(i, j int) bool { return ports[i].Port < ports[j].Port })
+
+	svc := &model.Service{
+		Hostname:   serviceHostname(name),
+		Address:    constants.UnspecifiedIP,
+		Ports:      ports,
+		Resolution: model.ClientSideLB,
+		Attributes: model.ServiceAttributes{
+			ServiceRegistry: string(serviceregistry.Consul),
+			Name:            name,
+			Namespace:       model.IstioDefaultConfigNamespace,
+		},
+	}
+
+	instances := make([]*model.ServiceInstance, 0, len(entries))
+	for _, entry := range entries {
+		if !isHealthy(entry) {
+			continue
+		}
+		addr := entry.Service.Address
+		if addr == "" {
+			addr = entry.Node.Address
+		}
+		port := portsByNumber[entry.Service.Port]
+		instances = append(instances, &model.ServiceInstance{
+			Service:     svc,
+			ServicePort: port,
+			Endpoint: &model.IstioEndpoint{
+				Address:         addr,
+				EndpointPort:    uint32(entry.Service.Port),
+				ServicePortName: port.Name,
+				Labels:          convertLabels(entry.Service.Tags),
+				Locality: model.Locality{
+					Label: entry.Node.Datacenter,
+				},
+				WorkloadName: entry.Service.ID,
+				Namespace:    model.IstioDefaultConfigNamespace,
+			},
+		})
+	}
+	sort.Slice(instances, func(i, j int) bool {
+		return instances[i].Endpoint.WorkloadName < instances[j].Endpoint.WorkloadName
+	})
+	return svc, instances
+}
+
+// isHealthy returns true unless a health check of the instance is critical. Instances with warnings
+// still receive traffic.
+func isHealthy(entry *healthEntry) bool {
+	for _, check := range entry.Checks {
+		if check.Status == healthCritical {
+			return false
+		}
+	}
+	return true
+}
+
+// convertLabels converts the tags of an instance to labels: key=value tags are converted to the
+// label key, and the other tags to a label with an empty value.
+func convertLabels(tags []string) labels.Instance {
+	out := make(labels.Instance, len(tags))
+	for _, tag := range tags {
+		kv := strings.SplitN(tag, "=", 2)
+		if len(kv) == 2 {
+			out[kv[0]] = kv[1]
+		} else {
+			out[tag] = ""
+		}
+	}
+	return out
+}
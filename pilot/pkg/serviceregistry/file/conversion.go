@@ -0,0 +1,226 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+
+	kubeyaml "k8s.io/apimachinery/pkg/util/yaml"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/serviceregistry"
+	"istio.io/istio/pkg/config/constants"
+	"istio.io/istio/pkg/config/host"
+	"istio.io/istio/pkg/config/protocol"
+	"istio.io/istio/pkg/spiffe"
+)
+
+var supportedExtensions = map[string]bool{
+	".yaml": true,
+	".yml":  true,
+	".json": true,
+}
+
+// Service is a service of the file registry, with its endpoints. A file may contain several
+// services, as a YAML stream.
+type Service struct {
+	// Hostname of the service, such as reviews.bookinfo.svc.cluster.local.
+	Hostname string `json:"hostname"`
+	// Namespace of the service, default if not set.
+	Namespace string `json:"namespace,omitempty"`
+	// Address is the virtual IP of the service, if any.
+	Address string `json:"address,omitempty"`
+	// Ports of the service.
+	Ports []Port `json:"ports"`
+	// Labels of the service.
+	Labels map[string]string `json:"labels,omitempty"`
+	// ServiceAccounts are the service accounts, in the namespace of the service, running the service.
+	ServiceAccounts []string `json:"serviceAccounts,omitempty"`
+	// Endpoints of the service.
+	Endpoints []Endpoint `json:"endpoints,omitempty"`
+}
+
+// Port is a port of a service.
+type Port struct {
+	Name string `json:"name"`
+	Port int    `json:"port"`
+	// Protocol of the port, TCP if not set.
+	Protocol string `json:"protocol,omitempty"`
+}
+
+// Endpoint is an endpoint of a service.
+type Endpoint struct {
+	// Address is the IP address of the endpoint.
+	Address string `json:"address"`
+	// Ports maps the names of the ports of the service to the ports of the endpoint. The port of the
+	// service is used if a port is not mapped.
+	Ports map[string]uint32 `json:"ports,omitempty"`
+	// Labels of the endpoint.
+	Labels map[string]string `json:"labels,omitempty"`
+	// ServiceAccount running the endpoint, in the namespace of the service.
+	ServiceAccount string `json:"serviceAccount,omitempty"`
+	// Network of the endpoint.
+	Network string `json:"network,omitempty"`
+	// Locality of the endpoint, as region/zone/subzone.
+	Locality string `json:"locality,omitempty"`
+	// Weight of the endpoint for the load balancing.
+	Weight uint32 `json:"weight,omitempty"`
+}
+
+// readServiceFiles parses the YAML and JSON files of the directory root, and returns the services they
+// describe. Subdirectories are not read, since only the directory itself is watched.
+func readServiceFiles(root string) ([]*Service, error) {
+	infos, err := ioutil.ReadDir(root)
+	if err != nil {
+		return nil, err
+	}
+	var result []*Service
+	for _, info := range infos {
+		path := filepath.Join(root, info.Name())
+		if !supportedExtensions[filepath.Ext(path)] || (info.Mode()&os.ModeType) != 0 {
+			continue
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		services, err := parseServices(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+		}
+		result = append(result, services...)
+	}
+	return result, nil
+}
+
+// parseServices parses a YAML stream or JSON document of services.
+func parseServices(data []byte) ([]*Service, error) {
+	var result []*Service
+	decoder := kubeyaml.NewYAMLOrJSONDecoder(bytes.NewReader(data), 512*1024)
+	for {
+		svc := &Service{}
+		err := decoder.Decode(svc)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if reflect.DeepEqual(svc, &Service{}) {
+			continue
+		}
+		result = append(result, svc)
+	}
+	return result, nil
+}
+
+// convertService converts a service of the file registry to the service and its instances.
+func convertService(svc *Service) (*model.Service, []*model.ServiceInstance, error) {
+	if svc.Hostname == "" {
+		return nil, nil, fmt.Errorf("service has no hostname")
+	}
+	if len(svc.Ports) == 0 {
+		return nil, nil, fmt.Errorf("service %s has no ports", svc.Hostname)
+	}
+	namespace := svc.Namespace
+	if namespace == "" {
+		namespace = "default"
+	}
+	addr := constants.UnspecifiedIP
+	if svc.Address != "" {
+		if net.ParseIP(svc.Address) == nil {
+			return nil, nil, fmt.Errorf("service %s has an invalid address %s", svc.Hostname, svc.Address)
+		}
+		addr = svc.Address
+	}
+
+	ports := make(model.PortList, 0, len(svc.Ports))
+	for _, port := range svc.Ports {
+		proto := protocol.TCP
+		if port.Protocol != "" {
+			if proto = protocol.Parse(port.Protocol); proto == protocol.Unsupported {
+				return nil, nil, fmt.Errorf("service %s has an unsupported protocol %s", svc.Hostname, port.Protocol)
+			}
+		}
+		ports = append(ports, &model.Port{
+			Name:     port.Name,
+			Port:     port.Port,
+			Protocol: proto,
+		})
+	}
+
+	serviceAccounts := make([]string, 0, len(svc.ServiceAccounts))
+	for _, sa := range svc.ServiceAccounts {
+		serviceAccounts = append(serviceAccounts, spiffe.MustGenSpiffeURI(namespace, sa))
+	}
+	sort.Strings(serviceAccounts)
+
+	service := &model.Service{
+		Hostname:        host.Name(svc.Hostname),
+		Address:         addr,
+		Ports:           ports,
+		ServiceAccounts: serviceAccounts,
+		Resolution:      model.ClientSideLB,
+		Attributes: model.ServiceAttributes{
+			ServiceRegistry: string(serviceregistry.File),
+			Name:            svc.Hostname,
+			Namespace:       namespace,
+			Labels:          svc.Labels,
+		},
+	}
+
+	instances := make([]*model.ServiceInstance, 0, len(svc.Endpoints)*len(ports))
+	for _, ep := range svc.Endpoints {
+		if net.ParseIP(ep.Address) == nil {
+			return nil, nil, fmt.Errorf("service %s has an endpoint with an invalid address %q", svc.Hostname, ep.Address)
+		}
+		sa := ""
+		if ep.ServiceAccount != "" {
+			sa = spiffe.MustGenSpiffeURI(namespace, ep.ServiceAccount)
+		}
+		for _, port := range ports {
+			endpointPort := ep.Ports[port.Name]
+			if endpointPort == 0 {
+				endpointPort = uint32(port.Port)
+			}
+			instances = append(instances, &model.ServiceInstance{
+				Service:     service,
+				ServicePort: port,
+				Endpoint: &model.IstioEndpoint{
+					Address:         ep.Address,
+					EndpointPort:    endpointPort,
+					ServicePortName: port.Name,
+					Labels:          ep.Labels,
+					ServiceAccount:  sa,
+					Network:         ep.Network,
+					Locality: model.Locality{
+						Label: ep.Locality,
+					},
+					LbWeight:  ep.Weight,
+					Namespace: namespace,
+				},
+			})
+		}
+	}
+	return service, instances, nil
+}
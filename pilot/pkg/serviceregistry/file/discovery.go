@@ -0,0 +1,262 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+
+	"go.uber.org/atomic"
+
+	"istio.io/istio/pilot/pkg/config/monitor"
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/serviceregistry"
+	"istio.io/istio/pkg/config/host"
+	"istio.io/istio/pkg/config/labels"
+	istiolog "istio.io/pkg/log"
+)
+
+var log = istiolog.RegisterScope("fileregistry", "file service registry", 0)
+
+// Options stores the configurable attributes of a ServiceDiscovery.
+type Options struct {
+	// Dir is the directory of the YAML and JSON files describing the services. Its subdirectories
+	// are ignored.
+	Dir string
+
+	// ClusterID identifies the registry.
+	ClusterID string
+
+	// XDSUpdater will push changes to the xDS server.
+	XDSUpdater model.XDSUpdater
+}
+
+// ServiceDiscovery is a service registry reading the services, and their endpoints, from the files
+// of a directory. The directory is watched: the services are updated, and their endpoints pushed
+// incrementally, when the files change.
+type ServiceDiscovery struct {
+	dir        string
+	clusterID  string
+	xdsUpdater model.XDSUpdater
+
+	mutex    sync.RWMutex
+	services map[host.Name]*model.Service
+	// instances stores hostname ==> instances of the service
+	instances map[host.Name][]*model.ServiceInstance
+	// ip2instance stores ip ==> instances of the workload, for the proxies
+	ip2instance map[string][]*model.ServiceInstance
+
+	handlers []func(*model.Service, model.Event)
+	synced   *atomic.Bool
+}
+
+var _ serviceregistry.Instance = &ServiceDiscovery{}
+
+// NewServiceDiscovery creates a file service registry. The files are read once Run is called.
+func NewServiceDiscovery(options Options) *ServiceDiscovery {
+	return &ServiceDiscovery{
+		dir:         options.Dir,
+		clusterID:   options.ClusterID,
+		xdsUpdater:  options.XDSUpdater,
+		services:    make(map[host.Name]*model.Service),
+		instances:   make(map[host.Name][]*model.ServiceInstance),
+		ip2instance: make(map[string][]*model.ServiceInstance),
+		synced:      atomic.NewBool(false),
+	}
+}
+
+func (s *ServiceDiscovery) Provider() serviceregistry.ProviderID {
+	return serviceregistry.File
+}
+
+func (s *ServiceDiscovery) Cluster() string {
+	return s.clusterID
+}
+
+// AppendServiceHandler implements a service catalog operation
+func (s *ServiceDiscovery) AppendServiceHandler(f func(*model.Service, model.Event)) {
+	s.mutex.Lock()
+	s.handlers = append(s.handlers, f)
+	s.mutex.Unlock()
+}
+
+// AppendWorkloadHandler is a no-op: the file registry has no workloads other than the endpoints of
+// its services.
+func (s *ServiceDiscovery) AppendWorkloadHandler(func(*model.WorkloadInstance, model.Event)) {}
+
+// Run reads the files, and then watches the directory until stop is closed.
+func (s *ServiceDiscovery) Run(stop <-chan struct{}) {
+	if err := s.reload(); err != nil {
+		log.Errorf("failed to read the services of %s: %v", s.dir, err)
+	}
+	s.synced.Store(true)
+
+	ch := make(chan struct{}, 1)
+	if err := monitor.FileTrigger(s.dir, ch, stop); err != nil {
+		log.Errorf("unable to watch the services of %s: %v", s.dir, err)
+		return
+	}
+	for {
+		select {
+		case <-ch:
+			log.Infof("reloading the services of %s", s.dir)
+			if err := s.reload(); err != nil {
+				log.Errorf("failed to read the services of %s, keeping the previous services: %v", s.dir, err)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// HasSynced returns true once the files have been read.
+func (s *ServiceDiscovery) HasSynced() bool {
+	return s.synced.Load()
+}
+
+// reload reads the files, and notifies the services, and the endpoints, which changed.
+func (s *ServiceDiscovery) reload() error {
+	files, err := readServiceFiles(s.dir)
+	if err != nil {
+		return err
+	}
+	services := make(map[host.Name]*model.Service, len(files))
+	instances := make(map[host.Name][]*model.ServiceInstance, len(files))
+	ip2instance := make(map[string][]*model.ServiceInstance)
+	for _, f := range files {
+		svc, svcInstances, err := convertService(f)
+		if err != nil {
+			return err
+		}
+		if _, exists := services[svc.Hostname]; exists {
+			return fmt.Errorf("service %s is defined more than once", svc.Hostname)
+		}
+		services[svc.Hostname] = svc
+		instances[svc.Hostname] = svcInstances
+		for _, instance := range svcInstances {
+			ip2instance[instance.Endpoint.Address] = append(ip2instance[instance.Endpoint.Address], instance)
+		}
+	}
+
+	s.mutex.Lock()
+	prevServices, prevInstances := s.services, s.instances
+	s.services, s.instances, s.ip2instance = services, instances, ip2instance
+	handlers := s.handlers
+	s.mutex.Unlock()
+
+	for hostname, svc := range prevServices {
+		if _, f := services[hostname]; !f {
+			s.notifyService(svc, nil, model.EventDelete, handlers)
+		}
+	}
+	for hostname, svc := range services {
+		prev, f := prevServices[hostname]
+		switch {
+		case !f:
+			s.notifyService(svc, instances[hostname], model.EventAdd, handlers)
+		case !reflect.DeepEqual(prev, svc):
+			s.notifyService(svc, instances[hostname], model.EventUpdate, handlers)
+		case !reflect.DeepEqual(prevInstances[hostname], instances[hostname]):
+			// Only the endpoints changed: push them incrementally.
+			s.xdsUpdater.EDSUpdate(s.clusterID, string(hostname), svc.Attributes.Namespace, endpoints(instances[hostname]))
+		}
+	}
+	return nil
+}
+
+func (s *ServiceDiscovery) notifyService(svc *model.Service, instances []*model.ServiceInstance, event model.Event,
+	handlers []func(*model.Service, model.Event)) {
+	if event != model.EventDelete && len(instances) > 0 {
+		s.xdsUpdater.EDSCacheUpdate(s.clusterID, string(svc.Hostname), svc.Attributes.Namespace, endpoints(instances))
+	}
+	s.xdsUpdater.SvcUpdate(s.clusterID, string(svc.Hostname), svc.Attributes.Namespace, event)
+	for _, f := range handlers {
+		f(svc, event)
+	}
+}
+
+func endpoints(instances []*model.ServiceInstance) []*model.IstioEndpoint {
+	out := make([]*model.IstioEndpoint, 0, len(instances))
+	for _, instance := range instances {
+		out = append(out, instance.Endpoint)
+	}
+	return out
+}
+
+// Services implements a service catalog operation
+func (s *ServiceDiscovery) Services() ([]*model.Service, error) {
+	s.mutex.RLock()
+	out := make([]*model.Service, 0, len(s.services))
+	for _, svc := range s.services {
+		out = append(out, svc)
+	}
+	s.mutex.RUnlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].Hostname < out[j].Hostname })
+	return out, nil
+}
+
+// GetService implements a service catalog operation
+func (s *ServiceDiscovery) GetService(hostname host.Name) (*model.Service, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.services[hostname], nil
+}
+
+// InstancesByPort implements a service catalog operation
+func (s *ServiceDiscovery) InstancesByPort(svc *model.Service, port int, labels labels.Collection) []*model.ServiceInstance {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	out := make([]*model.ServiceInstance, 0)
+	for _, instance := range s.instances[svc.Hostname] {
+		if instance.ServicePort.Port == port && labels.HasSubsetOf(instance.Endpoint.Labels) {
+			out = append(out, instance)
+		}
+	}
+	return out
+}
+
+// GetProxyServiceInstances returns the service instances of the endpoints with the IP addresses of the proxy.
+func (s *ServiceDiscovery) GetProxyServiceInstances(node *model.Proxy) []*model.ServiceInstance {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	out := make([]*model.ServiceInstance, 0)
+	for _, ip := range node.IPAddresses {
+		out = append(out, s.ip2instance[ip]...)
+	}
+	return out
+}
+
+func (s *ServiceDiscovery) GetProxyWorkloadLabels(proxy *model.Proxy) labels.Collection {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	out := make(labels.Collection, 0)
+	for _, ip := range proxy.IPAddresses {
+		for _, instance := range s.ip2instance[ip] {
+			out = append(out, instance.Endpoint.Labels)
+		}
+	}
+	return out
+}
+
+// GetIstioServiceAccounts implements model.ServiceAccounts operation
+func (s *ServiceDiscovery) GetIstioServiceAccounts(svc *model.Service, ports []int) []string {
+	return model.GetServiceAccounts(svc, ports, s)
+}
+
+func (s *ServiceDiscovery) NetworkGateways() map[string][]*model.Gateway {
+	return nil
+}
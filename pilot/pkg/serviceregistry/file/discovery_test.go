@@ -0,0 +1,210 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pkg/config/labels"
+	"istio.io/istio/pkg/config/protocol"
+)
+
+const reviewsYAML = `
+hostname: reviews.bookinfo.svc.cluster.local
+namespace: bookinfo
+address: 10.0.0.1
+ports:
+- name: http
+  port: 9080
+  protocol: HTTP
+- name: grpc
+  port: 9090
+  protocol: GRPC
+endpoints:
+- address: 10.1.0.1
+  labels:
+    version: v1
+  serviceAccount: reviews
+- address: 10.1.0.2
+  ports:
+    http: 8080
+  labels:
+    version: v2
+---
+hostname: ratings.bookinfo.svc.cluster.local
+namespace: bookinfo
+ports:
+- name: tcp
+  port: 9080
+`
+
+const detailsJSON = `{
+  "hostname": "details.bookinfo.svc.cluster.local",
+  "namespace": "bookinfo",
+  "ports": [{"name": "http", "port": 9080, "protocol": "HTTP"}],
+  "endpoints": [{"address": "10.2.0.1"}]
+}`
+
+type event struct {
+	kind      string
+	host      string
+	endpoints int
+}
+
+type fakeXdsUpdater struct {
+	mutex  sync.Mutex
+	events []event
+}
+
+var _ model.XDSUpdater = &fakeXdsUpdater{}
+
+func (fx *fakeXdsUpdater) record(e event) {
+	fx.mutex.Lock()
+	fx.events = append(fx.events, e)
+	fx.mutex.Unlock()
+}
+
+func (fx *fakeXdsUpdater) EDSUpdate(_, hostname string, _ string, entry []*model.IstioEndpoint) {
+	fx.record(event{kind: "eds", host: hostname, endpoints: len(entry)})
+}
+
+func (fx *fakeXdsUpdater) EDSCacheUpdate(_, hostname string, _ string, entry []*model.IstioEndpoint) {
+	fx.record(event{kind: "edscache", host: hostname, endpoints: len(entry)})
+}
+
+func (fx *fakeXdsUpdater) SvcUpdate(_, hostname string, _ string, e model.Event) {
+	fx.record(event{kind: "svc" + e.String(), host: hostname})
+}
+
+func (fx *fakeXdsUpdater) ConfigUpdate(*model.PushRequest) {}
+
+func (fx *fakeXdsUpdater) ProxyUpdate(_, _ string) {}
+
+func (fx *fakeXdsUpdater) take() []event {
+	fx.mutex.Lock()
+	defer fx.mutex.Unlock()
+	events := fx.events
+	fx.events = nil
+	return events
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := ioutil.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestServiceDiscovery(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "reviews.yaml"), reviewsYAML)
+	writeFile(t, filepath.Join(dir, "details.json"), detailsJSON)
+	writeFile(t, filepath.Join(dir, "README.md"), "not a service")
+	// Subdirectories are not watched, so their files are not read.
+	if err := os.Mkdir(filepath.Join(dir, "backup"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "backup", "reviews.yaml"), reviewsYAML)
+
+	fx := &fakeXdsUpdater{}
+	sd := NewServiceDiscovery(Options{Dir: dir, ClusterID: "file", XDSUpdater: fx})
+	if err := sd.reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	services, _ := sd.Services()
+	if len(services) != 3 {
+		t.Fatalf("expected 3 services, got %v", services)
+	}
+	reviews, _ := sd.GetService("reviews.bookinfo.svc.cluster.local")
+	if reviews == nil || reviews.Address != "10.0.0.1" || reviews.Attributes.Namespace != "bookinfo" {
+		t.Fatalf("unexpected service %v", reviews)
+	}
+	if port, _ := reviews.Ports.Get("grpc"); port == nil || port.Protocol != protocol.GRPC {
+		t.Fatalf("unexpected ports %v", reviews.Ports)
+	}
+	ratings, _ := sd.GetService("ratings.bookinfo.svc.cluster.local")
+	if port, _ := ratings.Ports.Get("tcp"); port == nil || port.Protocol != protocol.TCP {
+		t.Fatalf("unexpected ports %v", ratings.Ports)
+	}
+
+	instances := sd.InstancesByPort(reviews, 9080, labels.Collection{{"version": "v2"}})
+	if len(instances) != 1 || instances[0].Endpoint.Address != "10.1.0.2" || instances[0].Endpoint.EndpointPort != 8080 {
+		t.Fatalf("unexpected instances %v", instances)
+	}
+	instances = sd.GetProxyServiceInstances(&model.Proxy{IPAddresses: []string{"10.1.0.1"}})
+	if len(instances) != 2 || instances[0].Endpoint.ServiceAccount != "spiffe://cluster.local/ns/bookinfo/sa/reviews" {
+		t.Fatalf("unexpected proxy instances %v", instances)
+	}
+	if got := sd.GetProxyWorkloadLabels(&model.Proxy{IPAddresses: []string{"10.1.0.1"}}); len(got) != 2 || got[0]["version"] != "v1" {
+		t.Fatalf("unexpected proxy labels %v", got)
+	}
+
+	events := fx.take()
+	if len(events) != 5 {
+		t.Fatalf("unexpected events %v", events)
+	}
+
+	t.Run("endpoints update", func(t *testing.T) {
+		writeFile(t, filepath.Join(dir, "details.json"), `{
+  "hostname": "details.bookinfo.svc.cluster.local",
+  "namespace": "bookinfo",
+  "ports": [{"name": "http", "port": 9080, "protocol": "HTTP"}],
+  "endpoints": [{"address": "10.2.0.1"}, {"address": "10.2.0.2"}]
+}`)
+		if err := sd.reload(); err != nil {
+			t.Fatal(err)
+		}
+		expected := []event{{kind: "eds", host: "details.bookinfo.svc.cluster.local", endpoints: 2}}
+		if events := fx.take(); !reflect.DeepEqual(events, expected) {
+			t.Fatalf("expected events %v, got %v", expected, events)
+		}
+	})
+
+	t.Run("invalid file", func(t *testing.T) {
+		writeFile(t, filepath.Join(dir, "invalid.yaml"), "hostname: invalid.bookinfo.svc.cluster.local\n")
+		if err := sd.reload(); err == nil {
+			t.Fatal("expected an error for a service without ports")
+		}
+		if services, _ := sd.Services(); len(services) != 3 {
+			t.Fatalf("expected the previous services to be kept, got %v", services)
+		}
+		if err := os.Remove(filepath.Join(dir, "invalid.yaml")); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("service delete", func(t *testing.T) {
+		if err := os.Remove(filepath.Join(dir, "details.json")); err != nil {
+			t.Fatal(err)
+		}
+		if err := sd.reload(); err != nil {
+			t.Fatal(err)
+		}
+		expected := []event{{kind: "svcdelete", host: "details.bookinfo.svc.cluster.local"}}
+		if events := fx.take(); !reflect.DeepEqual(events, expected) {
+			t.Fatalf("expected events %v, got %v", expected, events)
+		}
+		if svc, _ := sd.GetService("details.bookinfo.svc.cluster.local"); svc != nil {
+			t.Fatalf("expected the service to be deleted, got %v", svc)
+		}
+	})
+}
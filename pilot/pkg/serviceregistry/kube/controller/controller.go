@@ -133,6 +133,9 @@ type Options struct {
 	// EndpointMode decides what source to use to get endpoint information
 	EndpointMode EndpointMode
 
+	// EnableMCSServiceDiscovery enables the discovery of the MCS ServiceImports of the cluster.
+	EnableMCSServiceDiscovery bool
+
 	// Maximum QPS when communicating with kubernetes API
 	KubernetesAPIQPS float32
 
@@ -214,6 +217,9 @@ type Controller struct {
 
 	endpoints kubeEndpointsController
 
+	// imports watches the MCS ServiceImports, if the discovery of the multi-cluster services is enabled.
+	imports *serviceImportCache
+
 	// Used to watch node accessible from remote cluster.
 	// In multi-cluster(shared control plane multi-networks) scenario, ingress gateway service can be of nodePort type.
 	// With this, we can populate mesh's gateway address with the node ips.
@@ -347,6 +353,14 @@ func NewController(kubeClient kubelib.Client, options Options) *Controller {
 	c.nodeLister = kubeClient.KubeInformer().Core().V1().Nodes().Lister()
 	c.registerHandlers(c.nodeInformer, "Nodes", c.onNodeEvent, nil)
 
+	if options.EnableMCSServiceDiscovery {
+		serviceImportInformer := filter.NewFilteredSharedIndexInformer(
+			c.discoveryNamespacesFilter.Filter,
+			kubeClient.MCSApisInformer().Multicluster().V1alpha1().ServiceImports().Informer(),
+		)
+		c.imports = newServiceImportCache(c, serviceImportInformer)
+	}
+
 	podInformer := filter.NewFilteredSharedIndexInformer(c.discoveryNamespacesFilter.Filter, kubeClient.KubeInformer().Core().V1().Pods().Informer())
 	c.pods = newPodCache(c, podInformer, func(key string) {
 		item, exists, err := c.endpoints.getInformer().GetIndexer().GetByKey(key)
@@ -616,7 +630,8 @@ func (c *Controller) informersSynced() bool {
 		!c.serviceInformer.HasSynced() ||
 		!c.endpoints.HasSynced() ||
 		!c.pods.informer.HasSynced() ||
-		!c.nodeInformer.HasSynced() {
+		!c.nodeInformer.HasSynced() ||
+		(c.imports != nil && !c.imports.HasSynced()) {
 		return false
 	}
 	return true
@@ -648,6 +663,14 @@ func (c *Controller) SyncAll() error {
 		err = multierror.Append(err, c.onServiceEvent(s, model.EventAdd))
 	}
 
+	if c.imports != nil {
+		serviceImports := c.imports.informer.GetIndexer().List()
+		log.Debugf("initializing %d service imports", len(serviceImports))
+		for _, si := range serviceImports {
+			err = multierror.Append(err, c.imports.onServiceImportEvent(si, model.EventAdd))
+		}
+	}
+
 	err = multierror.Append(err, c.syncPods())
 	err = multierror.Append(err, c.syncEndpoints())
 
@@ -684,6 +707,10 @@ func (c *Controller) Run(stop <-chan struct{}) {
 	if c.systemNsInformer != nil {
 		go c.systemNsInformer.Run(stop)
 	}
+	if c.imports != nil {
+		// The informers of the MCS APIs are not started with the other informers of the client.
+		go c.imports.informer.Run(stop)
+	}
 	c.informerInit.Store(true)
 	kubelib.WaitForCacheSyncInterval(stop, c.syncInterval, c.informersSynced)
 	// after informer caches sync the first time, process resources in order
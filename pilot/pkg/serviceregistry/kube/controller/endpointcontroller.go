@@ -110,6 +110,9 @@ func updateEDS(c *Controller, epc kubeEndpointsController, ep interface{}, event
 	}
 
 	c.xdsUpdater.EDSUpdate(c.clusterID, string(host), ns, endpoints)
+	if c.imports != nil {
+		c.imports.updateEDS(svcName, ns, endpoints)
+	}
 }
 
 // getPod fetches a pod by name or IP address.
@@ -21,6 +21,7 @@ import (
 	v1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	listerv1 "k8s.io/client-go/listers/core/v1"
 	"k8s.io/client-go/tools/cache"
@@ -130,6 +131,32 @@ func (nc *NamespaceController) Run(stopCh <-chan struct{}) {
 	cache.WaitForCacheSync(stopCh, nc.namespacesInformer.HasSynced, nc.configMapInformer.HasSynced)
 	log.Infof("Namespace controller started")
 	go nc.queue.Run(stopCh)
+	go nc.resync(stopCh)
+}
+
+// resync reconciles the config map of every namespace each NamespaceResyncPeriod, as the data, such as
+// the revocation list of the CA, may change without any event.
+func (nc *NamespaceController) resync(stopCh <-chan struct{}) {
+	ticker := time.NewTicker(NamespaceResyncPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+		}
+		namespaces, err := nc.namespaceLister.List(labels.Everything())
+		if err != nil {
+			log.Errorf("failed to list namespaces: %v", err)
+			continue
+		}
+		for _, ns := range namespaces {
+			ns := ns
+			nc.queue.Push(func() error {
+				return nc.namespaceChange(ns)
+			})
+		}
+	}
 }
 
 // insertDataForNamespace will add data into the configmap for the specified namespace
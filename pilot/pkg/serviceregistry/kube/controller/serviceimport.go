@@ -0,0 +1,145 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"fmt"
+
+	"k8s.io/client-go/tools/cache"
+	mcsapi "sigs.k8s.io/mcs-api/pkg/apis/v1alpha1"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/serviceregistry/kube"
+	"istio.io/istio/pilot/pkg/serviceregistry/kube/controller/filter"
+)
+
+// serviceImportCache watches the MCS ServiceImports of the cluster. For each of them, it generates a
+// service for the clusterset.local hostname, with the virtual IP of the ServiceImport in the cluster.
+// The endpoints of the service in the cluster are published for the clusterset.local hostname as well
+// when the cluster exports it, so that the aggregate controller merges the endpoints of all the
+// clusters exporting the service.
+type serviceImportCache struct {
+	c        *Controller
+	informer filter.FilteredSharedIndexInformer
+}
+
+func newServiceImportCache(c *Controller, informer filter.FilteredSharedIndexInformer) *serviceImportCache {
+	ic := &serviceImportCache{
+		c:        c,
+		informer: informer,
+	}
+	c.registerHandlers(informer, "ServiceImports", ic.onServiceImportEvent, nil)
+	return ic
+}
+
+func (ic *serviceImportCache) onServiceImportEvent(obj interface{}, event model.Event) error {
+	si, err := convertToServiceImport(obj)
+	if err != nil {
+		log.Errorf(err)
+		return nil
+	}
+
+	log.Debugf("Handle event %s for service import %s in namespace %s", event, si.Name, si.Namespace)
+
+	c := ic.c
+	svcConv := kube.ConvertServiceImport(si, c.clusterID)
+	switch event {
+	case model.EventDelete:
+		c.Lock()
+		delete(c.servicesMap, svcConv.Hostname)
+		c.Unlock()
+		// Drop the endpoints published for the clusterset.local hostname.
+		c.xdsUpdater.EDSUpdate(c.clusterID, string(svcConv.Hostname), si.Namespace, nil)
+	default:
+		c.Lock()
+		c.servicesMap[svcConv.Hostname] = svcConv
+		c.Unlock()
+
+		if ic.isExported(si) {
+			endpoints := c.endpoints.buildIstioEndpointsWithService(si.Name, si.Namespace, svcConv.Hostname)
+			if len(endpoints) > 0 {
+				c.xdsUpdater.EDSCacheUpdate(c.clusterID, string(svcConv.Hostname), si.Namespace, endpoints)
+			}
+		} else {
+			// The cluster no longer exports the service, so its endpoints must not be kept for the hostname.
+			c.xdsUpdater.EDSCacheUpdate(c.clusterID, string(svcConv.Hostname), si.Namespace, nil)
+		}
+	}
+
+	c.xdsUpdater.SvcUpdate(c.clusterID, string(svcConv.Hostname), si.Namespace, event)
+	// Notify service handlers.
+	for _, f := range c.serviceHandlers {
+		f(svcConv, event)
+	}
+
+	return nil
+}
+
+// updateEDS publishes the endpoints of the service name in namespace for its clusterset.local
+// hostname, if the service is imported and exported by the cluster.
+func (ic *serviceImportCache) updateEDS(name, namespace string, endpoints []*model.IstioEndpoint) {
+	si := ic.getServiceImport(name, namespace)
+	if si == nil || !ic.isExported(si) {
+		return
+	}
+	hostname := kube.ServiceClusterSetHostname(name, namespace)
+	ic.c.xdsUpdater.EDSUpdate(ic.c.clusterID, string(hostname), namespace, endpoints)
+}
+
+// isExported returns true if the service of the ServiceImport is exported by the cluster. The
+// clusters exporting the service are listed in the status of the ServiceImport; when the status is
+// not reported, the service is assumed to be exported by every cluster where it exists.
+func (ic *serviceImportCache) isExported(si *mcsapi.ServiceImport) bool {
+	if len(si.Status.Clusters) == 0 {
+		return true
+	}
+	for _, cluster := range si.Status.Clusters {
+		if cluster.Cluster == ic.c.clusterID {
+			return true
+		}
+	}
+	return false
+}
+
+func (ic *serviceImportCache) getServiceImport(name, namespace string) *mcsapi.ServiceImport {
+	obj, exists, err := ic.informer.GetIndexer().GetByKey(namespace + "/" + name)
+	if err != nil || !exists {
+		return nil
+	}
+	si, ok := obj.(*mcsapi.ServiceImport)
+	if !ok {
+		return nil
+	}
+	return si
+}
+
+func (ic *serviceImportCache) HasSynced() bool {
+	return ic.informer.HasSynced()
+}
+
+func convertToServiceImport(obj interface{}) (*mcsapi.ServiceImport, error) {
+	si, ok := obj.(*mcsapi.ServiceImport)
+	if !ok {
+		tombstone, ok := obj.(cache.DeletedFinalStateUnknown)
+		if !ok {
+			return nil, fmt.Errorf("couldn't get object from tombstone %#v", obj)
+		}
+		si, ok = tombstone.Obj.(*mcsapi.ServiceImport)
+		if !ok {
+			return nil, fmt.Errorf("tombstone contained object that is not a ServiceImport %#v", obj)
+		}
+	}
+	return si, nil
+}
@@ -0,0 +1,116 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	coreV1 "k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	mcsapi "sigs.k8s.io/mcs-api/pkg/apis/v1alpha1"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/serviceregistry/kube"
+	kubelib "istio.io/istio/pkg/kube"
+	"istio.io/istio/pkg/test/util/retry"
+)
+
+func TestServiceImport(t *testing.T) {
+	client := kubelib.NewFakeClient()
+	controller, fx := NewFakeControllerWithOptions(FakeControllerOptions{
+		Client:                    client,
+		ClusterID:                 "cluster1",
+		EnableMCSServiceDiscovery: true,
+	})
+	defer controller.Stop()
+
+	createService(controller, "svc1", "nsA", nil, []int32{8080}, map[string]string{"app": "prod-app"}, t)
+	if ev := fx.Wait("service"); ev == nil {
+		t.Fatal("Timeout creating service")
+	}
+
+	si := &mcsapi.ServiceImport{
+		ObjectMeta: metaV1.ObjectMeta{Name: "svc1", Namespace: "nsA"},
+		Spec: mcsapi.ServiceImportSpec{
+			Type:  mcsapi.ClusterSetIP,
+			IPs:   []string{"240.0.0.1"},
+			Ports: []mcsapi.ServicePort{{Name: "tcp-port", Port: 8080, Protocol: coreV1.ProtocolTCP}},
+		},
+	}
+	if _, err := client.MCSApis().MulticlusterV1alpha1().ServiceImports("nsA").Create(context.TODO(), si, metaV1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	hostname := kube.ServiceClusterSetHostname("svc1", "nsA")
+	retry.UntilSuccessOrFail(t, func() error {
+		svc, _ := controller.GetService(hostname)
+		if svc == nil {
+			return fmt.Errorf("service %s not found", hostname)
+		}
+		if svc.Address != "240.0.0.1" || svc.ClusterVIPs["cluster1"] != "240.0.0.1" {
+			return fmt.Errorf("unexpected address %s, cluster VIPs %v", svc.Address, svc.ClusterVIPs)
+		}
+		if len(svc.Ports) != 1 || svc.Ports[0].Port != 8080 {
+			return fmt.Errorf("unexpected ports %v", svc.Ports)
+		}
+		if svc.Resolution != model.ClientSideLB {
+			return fmt.Errorf("unexpected resolution %v", svc.Resolution)
+		}
+		return nil
+	}, serviceExportTimeout)
+
+	// The endpoints of the exported service are published for both hostnames.
+	fx.Clear()
+	createEndpoints(controller, "svc1", "nsA", []string{"tcp-port"}, []string{"172.0.1.1"}, nil, t)
+	published := map[string]bool{}
+	for len(published) < 2 {
+		ev := fx.Wait("eds")
+		if ev == nil {
+			t.Fatalf("Timeout waiting for endpoints, got %v", published)
+		}
+		if len(ev.Endpoints) != 1 || ev.Endpoints[0].Address != "172.0.1.1" {
+			t.Fatalf("unexpected endpoints %v for %s", ev.Endpoints, ev.ID)
+		}
+		published[ev.ID] = true
+	}
+	if !published[string(hostname)] || !published["svc1.nsA.svc.company.com"] {
+		t.Fatalf("unexpected endpoints hostnames %v", published)
+	}
+
+	// A cluster missing from the status of the ServiceImport does not export the service.
+	si.Status.Clusters = []mcsapi.ClusterStatus{{Cluster: "cluster2"}}
+	if _, err := client.MCSApis().MulticlusterV1alpha1().ServiceImports("nsA").Update(context.TODO(), si, metaV1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	retry.UntilSuccessOrFail(t, func() error {
+		got := controller.imports.getServiceImport("svc1", "nsA")
+		if got == nil || controller.imports.isExported(got) {
+			return fmt.Errorf("service import not updated")
+		}
+		return nil
+	}, serviceExportTimeout)
+
+	if err := client.MCSApis().MulticlusterV1alpha1().ServiceImports("nsA").Delete(context.TODO(), "svc1", metaV1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	retry.UntilSuccessOrFail(t, func() error {
+		if svc, _ := controller.GetService(hostname); svc != nil {
+			return fmt.Errorf("service %s not deleted", hostname)
+		}
+		return nil
+	}, serviceExportTimeout)
+}
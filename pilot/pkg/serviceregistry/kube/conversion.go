@@ -20,6 +20,7 @@ import (
 	"strings"
 
 	coreV1 "k8s.io/api/core/v1"
+	mcsapi "sigs.k8s.io/mcs-api/pkg/apis/v1alpha1"
 
 	"istio.io/api/annotation"
 	"istio.io/istio/pilot/pkg/model"
@@ -41,6 +42,9 @@ const (
 	// that can be used to select a subset of nodes from the pool of k8s nodes
 	// It is used for multi-cluster scenario, and with nodePort type gateway service.
 	NodeSelectorAnnotation = "traffic.istio.io/nodeSelector"
+
+	// ClusterSetDomainSuffix is the domain suffix of the multi-cluster services imported by MCS ServiceImports.
+	ClusterSetDomainSuffix = "clusterset.local"
 )
 
 func convertPort(port coreV1.ServicePort) *model.Port {
@@ -186,6 +190,53 @@ func ServiceHostname(name, namespace, domainSuffix string) host.Name {
 	return host.Name(name + "." + namespace + "." + "svc" + "." + domainSuffix) // Format: "%s.%s.svc.%s"
 }
 
+// ConvertServiceImport converts a MCS ServiceImport to the service of its clusterset.local hostname.
+// The service has the virtual IP of the ServiceImport in the cluster, and is resolved as a headless
+// service if the ServiceImport is headless.
+func ConvertServiceImport(si *mcsapi.ServiceImport, clusterID string) *model.Service {
+	addr := constants.UnspecifiedIP
+	if si.Spec.Type != mcsapi.Headless && len(si.Spec.IPs) > 0 {
+		addr = si.Spec.IPs[0]
+	}
+
+	resolution := model.ClientSideLB
+	if addr == constants.UnspecifiedIP {
+		resolution = model.Passthrough
+	}
+
+	ports := make([]*model.Port, 0, len(si.Spec.Ports))
+	for _, port := range si.Spec.Ports {
+		ports = append(ports, convertPort(coreV1.ServicePort{
+			Name:        port.Name,
+			Protocol:    port.Protocol,
+			AppProtocol: port.AppProtocol,
+			Port:        port.Port,
+		}))
+	}
+
+	return &model.Service{
+		Hostname:        ServiceClusterSetHostname(si.Name, si.Namespace),
+		Ports:           ports,
+		Address:         addr,
+		ServiceAccounts: make([]string, 0),
+		Resolution:      resolution,
+		CreationTime:    si.CreationTimestamp.Time,
+		ClusterVIPs:     map[string]string{clusterID: addr},
+		Attributes: model.ServiceAttributes{
+			ServiceRegistry: string(serviceregistry.Kubernetes),
+			Name:            si.Name,
+			Namespace:       si.Namespace,
+			Labels:          si.Labels,
+			UID:             formatUID(si.Namespace, si.Name),
+		},
+	}
+}
+
+// ServiceClusterSetHostname produces the FQDN of the multi-cluster service imported by a MCS ServiceImport.
+func ServiceClusterSetHostname(name, namespace string) host.Name {
+	return ServiceHostname(name, namespace, ClusterSetDomainSuffix)
+}
+
 // kubeToIstioServiceAccount converts a K8s service account to an Istio service account
 func kubeToIstioServiceAccount(saname string, ns string) string {
 	return spiffe.MustGenSpiffeURI(ns, saname)
@@ -23,8 +23,11 @@ import (
 
 	coreV1 "k8s.io/api/core/v1"
 	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	mcsapi "sigs.k8s.io/mcs-api/pkg/apis/v1alpha1"
 
 	"istio.io/api/annotation"
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pkg/config/constants"
 	"istio.io/istio/pkg/config/kube"
 	"istio.io/istio/pkg/config/protocol"
 	"istio.io/istio/pkg/spiffe"
@@ -406,6 +409,57 @@ func TestLBServiceConversion(t *testing.T) {
 	}
 }
 
+func TestServiceImportConversion(t *testing.T) {
+	cases := []struct {
+		name       string
+		spec       mcsapi.ServiceImportSpec
+		address    string
+		resolution model.Resolution
+	}{
+		{
+			name:       "clusterset ip",
+			spec:       mcsapi.ServiceImportSpec{Type: mcsapi.ClusterSetIP, IPs: []string{"240.0.0.1"}},
+			address:    "240.0.0.1",
+			resolution: model.ClientSideLB,
+		},
+		{
+			name:       "headless",
+			spec:       mcsapi.ServiceImportSpec{Type: mcsapi.Headless},
+			address:    constants.UnspecifiedIP,
+			resolution: model.Passthrough,
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.spec.Ports = []mcsapi.ServicePort{
+				{Name: "http", Port: 80, Protocol: coreV1.ProtocolTCP},
+				{Name: "tcp", Port: 9000, Protocol: coreV1.ProtocolTCP},
+			}
+			si := &mcsapi.ServiceImport{
+				ObjectMeta: metaV1.ObjectMeta{Name: "service1", Namespace: "default"},
+				Spec:       tt.spec,
+			}
+
+			service := ConvertServiceImport(si, clusterID)
+			if service.Hostname != "service1.default.svc.clusterset.local" {
+				t.Fatalf("unexpected hostname %s", service.Hostname)
+			}
+			if service.Address != tt.address || service.ClusterVIPs[clusterID] != tt.address {
+				t.Fatalf("unexpected address %s, cluster VIPs %v", service.Address, service.ClusterVIPs)
+			}
+			if service.Resolution != tt.resolution {
+				t.Fatalf("unexpected resolution %v", service.Resolution)
+			}
+			if len(service.Ports) != 2 || service.Ports[0].Protocol != protocol.HTTP || service.Ports[1].Protocol != protocol.TCP {
+				t.Fatalf("unexpected ports %v", service.Ports)
+			}
+			if service.Attributes.Name != "service1" || service.Attributes.Namespace != "default" {
+				t.Fatalf("unexpected attributes %v", service.Attributes)
+			}
+		})
+	}
+}
+
 func TestSecureNamingSAN(t *testing.T) {
 	pod := &coreV1.Pod{}
 
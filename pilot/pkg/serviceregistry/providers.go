@@ -24,4 +24,10 @@ const (
 	Kubernetes ProviderID = "Kubernetes"
 	// External is a service registry for externally provided ServiceEntries
 	External = "External"
+	// File is a service registry backed by a directory of YAML and JSON files
+	File ProviderID = "File"
+	// Consul is a service registry backed by the HTTP API of a Consul catalog
+	Consul ProviderID = "Consul"
+	// Snapshot is a service registry serving the services of a snapshot of istiod
+	Snapshot ProviderID = "Snapshot"
 )
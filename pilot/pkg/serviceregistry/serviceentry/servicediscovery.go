@@ -238,7 +238,7 @@ func (s *ServiceEntryStore) workloadEntryHandler(old, curr config.Config, event
 		Reason:         []model.TriggerReason{model.EndpointUpdate},
 	}
 	// trigger a full push
-	s.XdsUpdater.ConfigUpdate(pushReq)
+	s.XdsUpdater.ConfigUpdate(pushReq.Traced("serviceentry"))
 }
 
 // getUpdatedConfigs returns related service entries when full push
@@ -374,7 +374,7 @@ func (s *ServiceEntryStore) serviceEntryHandler(old, curr config.Config, event m
 		ConfigsUpdated: configsUpdated,
 		Reason:         []model.TriggerReason{model.ServiceUpdate},
 	}
-	s.XdsUpdater.ConfigUpdate(pushReq)
+	s.XdsUpdater.ConfigUpdate(pushReq.Traced("serviceentry"))
 }
 
 // WorkloadInstanceHandler defines the handler for service instances generated by other registries
@@ -938,7 +938,7 @@ func makeConfigKey(svc *model.Service) model.ConfigKey {
 // isHealthy checks that the provided WorkloadEntry is healthy. If health checks are not enabled,
 // it is assumed to always be healthy
 func isHealthy(cfg config.Config) bool {
-	if parseHealthAnnotation(cfg.Annotations[status.WorkloadEntryHealthCheckAnnotation]) {
+	if parseHealthAnnotation(cfg.Annotations[status.WorkloadEntryHealthCheckAnnotation]) || isActivelyHealthChecked(cfg) {
 		// We default to false if the condition is not set. This ensures newly created WorkloadEntries
 		// are treated as unhealthy until we prove they are healthy by probe success.
 		return status.GetBoolConditionFromSpec(cfg, status.ConditionHealthy, false)
@@ -947,6 +947,15 @@ func isHealthy(cfg config.Config) bool {
 	return true
 }
 
+// isActivelyHealthChecked returns true if istiod probes the provided WorkloadEntry.
+func isActivelyHealthChecked(cfg config.Config) bool {
+	if !features.WorkloadEntryActiveHealthChecks {
+		return false
+	}
+	_, f := cfg.Annotations[status.WorkloadEntryActiveHealthCheckAnnotation]
+	return f
+}
+
 func parseHealthAnnotation(s string) bool {
 	if s == "" {
 		return false
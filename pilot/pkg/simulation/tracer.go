@@ -0,0 +1,258 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package simulation
+
+import (
+	"fmt"
+
+	cluster "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	listener "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
+	route "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	hcm "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+	tcpproxy "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/tcp_proxy/v3"
+	tls "github.com/envoyproxy/go-control-plane/envoy/extensions/transport_sockets/tls/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/wellknown"
+
+	meshconfig "istio.io/api/mesh/v1alpha1"
+	"istio.io/istio/pilot/pkg/config/memory"
+	"istio.io/istio/pilot/pkg/model"
+	networkingcore "istio.io/istio/pilot/pkg/networking/core"
+	"istio.io/istio/pilot/pkg/networking/plugin"
+	"istio.io/istio/pilot/pkg/serviceregistry/aggregate"
+	"istio.io/istio/pilot/pkg/serviceregistry/serviceentry"
+	"istio.io/istio/pkg/config"
+	"istio.io/istio/pkg/config/mesh"
+	"istio.io/istio/pkg/config/schema/collections"
+)
+
+// Tracer evaluates calls against a fixed set of xDS resources, such as a live config dump or the
+// configuration generated for a proxy.
+type Tracer struct {
+	Listeners []*listener.Listener
+	Clusters  []*cluster.Cluster
+	Routes    []*route.RouteConfiguration
+}
+
+// NewTracer builds a Tracer from the resources sent to a single proxy.
+func NewTracer(listeners []*listener.Listener, clusters []*cluster.Cluster, routes []*route.RouteConfiguration) *Tracer {
+	return &Tracer{
+		Listeners: listeners,
+		Clusters:  clusters,
+		Routes:    routes,
+	}
+}
+
+// NewTracerFromConfig generates the configuration of proxy from configs, without a Kubernetes API
+// server, and returns a Tracer for it. The services are the ServiceEntries of configs, and the
+// configuration is built by the config generator of istiod from a full PushContext.
+func NewTracerFromConfig(configs []config.Config, meshConfig *meshconfig.MeshConfig, proxy *model.Proxy) (*Tracer, error) {
+	store := memory.MakeSkipValidation(collections.Pilot)
+	for _, cfg := range configs {
+		if _, err := store.Create(cfg); err != nil {
+			return nil, fmt.Errorf("failed to add %s %s/%s: %v", cfg.GroupVersionKind.Kind, cfg.Namespace, cfg.Name, err)
+		}
+	}
+	configStore := model.MakeIstioStore(store)
+
+	serviceDiscovery := aggregate.NewController(aggregate.Options{})
+	// the ServiceEntry registry reads the ServiceEntries and WorkloadEntries from the store when
+	// its services are listed, so it does not need a controller
+	serviceDiscovery.AddRegistry(serviceentry.NewServiceDiscovery(nil, configStore, &noopXdsUpdater{}))
+
+	if meshConfig == nil {
+		m := mesh.DefaultMeshConfig()
+		meshConfig = &m
+	}
+	env := &model.Environment{
+		ServiceDiscovery: serviceDiscovery,
+		IstioConfigStore: configStore,
+		Watcher:          mesh.NewFixedWatcher(meshConfig),
+		NetworksWatcher:  mesh.NewFixedNetworksWatcher(nil),
+	}
+	env.Init()
+	push := model.NewPushContext()
+	if err := push.InitContext(env, nil, nil); err != nil {
+		return nil, fmt.Errorf("failed to initialize push context: %v", err)
+	}
+	env.PushContext = push
+
+	proxy = setupProxy(proxy)
+	proxy.SetServiceInstances(serviceDiscovery)
+	proxy.SetSidecarScope(push)
+	proxy.SetGatewaysForProxy(push)
+	proxy.DiscoverIPVersions()
+
+	cg := networkingcore.NewConfigGenerator([]string{plugin.AuthzCustom, plugin.Authn, plugin.Authz}, &model.DisabledCache{})
+	listeners := cg.BuildListeners(proxy, push)
+	routeNames, err := extractRouteNames(listeners)
+	if err != nil {
+		return nil, err
+	}
+	return NewTracer(listeners, cg.BuildClusters(proxy, push), cg.BuildHTTPRoutes(proxy, push, routeNames)), nil
+}
+
+// setupProxy fills in the fields of proxy that are normally set from the node metadata of Envoy.
+func setupProxy(p *model.Proxy) *model.Proxy {
+	if p == nil {
+		p = &model.Proxy{}
+	}
+	if p.Metadata == nil {
+		p.Metadata = &model.NodeMetadata{}
+	}
+	if p.IstioVersion == nil {
+		p.IstioVersion = model.ParseIstioVersion(p.Metadata.IstioVersion)
+	}
+	if p.Type == "" {
+		p.Type = model.SidecarProxy
+	}
+	if p.ConfigNamespace == "" {
+		p.ConfigNamespace = "default"
+	}
+	if p.Metadata.Namespace == "" {
+		p.Metadata.Namespace = p.ConfigNamespace
+	}
+	if p.ID == "" {
+		p.ID = "simulation." + p.ConfigNamespace
+	}
+	if p.DNSDomain == "" {
+		p.DNSDomain = p.ConfigNamespace + ".svc.cluster.local"
+	}
+	if len(p.IPAddresses) == 0 {
+		p.IPAddresses = []string{"127.0.0.1"}
+	}
+	return p
+}
+
+// extractRouteNames returns the names of the RDS route configurations referenced by listeners.
+func extractRouteNames(listeners []*listener.Listener) ([]string, error) {
+	var names []string
+	for _, l := range listeners {
+		for _, fc := range l.FilterChains {
+			h, err := extractHTTPConnectionManager(fc)
+			if err != nil {
+				return nil, err
+			}
+			if rds := h.GetRds(); rds != nil {
+				names = append(names, rds.RouteConfigName)
+			}
+		}
+	}
+	return names, nil
+}
+
+// noopXdsUpdater drops the updates of the registries, as the configuration is generated only once.
+type noopXdsUpdater struct{}
+
+var _ model.XDSUpdater = &noopXdsUpdater{}
+
+func (*noopXdsUpdater) ConfigUpdate(*model.PushRequest) {}
+
+func (*noopXdsUpdater) EDSUpdate(_, _, _ string, _ []*model.IstioEndpoint) {}
+
+func (*noopXdsUpdater) EDSCacheUpdate(_, _, _ string, _ []*model.IstioEndpoint) {}
+
+func (*noopXdsUpdater) SvcUpdate(_, _, _ string, _ model.Event) {}
+
+func (*noopXdsUpdater) ProxyUpdate(_, _ string) {}
+
+// Trace describes the path a Call took through the proxy configuration.
+type Trace struct {
+	// Call is the input, with defaults filled in.
+	Call Call
+	// Result holds the names of each matched resource, and the reason the call failed, if it did.
+	Result Result
+
+	Listener    *listener.Listener
+	FilterChain *listener.FilterChain
+	RouteConfig *route.RouteConfiguration
+	VirtualHost *route.VirtualHost
+	Route       *route.Route
+	Cluster     *cluster.Cluster
+	// WeightedClusters is set instead of Result.ClusterMatched when traffic is split between clusters.
+	WeightedClusters []string
+
+	// DownstreamTLS is the TLS mode the matched filter chain terminated.
+	DownstreamTLS TLSMode
+	// UpstreamTLS is the TLS mode used when connecting to the matched cluster.
+	UpstreamTLS TLSMode
+	// UpstreamAutoMTLS is set when the cluster only uses mTLS for endpoints that are labeled as
+	// supporting it, and plaintext otherwise. In this case UpstreamTLS is MTLS.
+	UpstreamAutoMTLS bool
+}
+
+func (tr *Trace) setCluster(c *cluster.Cluster) {
+	tr.Cluster = c
+	tr.UpstreamTLS = Plaintext
+	if c == nil {
+		return
+	}
+	if c.GetTransportSocket() != nil {
+		tr.UpstreamTLS = upstreamTLSMode(c.GetTransportSocket())
+		return
+	}
+	for _, m := range c.GetTransportSocketMatches() {
+		if upstreamTLSMode(m.GetTransportSocket()) == MTLS {
+			tr.UpstreamTLS = MTLS
+			tr.UpstreamAutoMTLS = len(m.GetMatch().GetFields()) > 0
+			return
+		}
+	}
+}
+
+// upstreamTLSMode classifies a cluster transport socket. Presenting a client certificate is treated
+// as mTLS; this matches both Istio mTLS (the "default" SDS certificate) and DestinationRule MUTUAL.
+func upstreamTLSMode(ts *core.TransportSocket) TLSMode {
+	t := &tls.UpstreamTlsContext{}
+	if ts.GetTypedConfig() == nil || ts.GetTypedConfig().UnmarshalTo(t) != nil {
+		// Not a TLS transport socket, for example raw_buffer
+		return Plaintext
+	}
+	ctx := t.GetCommonTlsContext()
+	if len(ctx.GetTlsCertificateSdsSecretConfigs()) > 0 || len(ctx.GetTlsCertificates()) > 0 {
+		return MTLS
+	}
+	return TLS
+}
+
+func extractHTTPConnectionManager(fcs *listener.FilterChain) (*hcm.HttpConnectionManager, error) {
+	for _, fc := range fcs.Filters {
+		if fc.Name == wellknown.HTTPConnectionManager {
+			h := &hcm.HttpConnectionManager{}
+			if fc.GetTypedConfig() != nil {
+				if err := fc.GetTypedConfig().UnmarshalTo(h); err != nil {
+					return nil, fmt.Errorf("filter chain %q: failed to unmarshal hcm: %v", fcs.Name, err)
+				}
+			}
+			return h, nil
+		}
+	}
+	return nil, nil
+}
+
+func extractTCPProxy(fcs *listener.FilterChain) (*tcpproxy.TcpProxy, error) {
+	for _, fc := range fcs.Filters {
+		if fc.Name == wellknown.TCPProxy {
+			tcpProxy := &tcpproxy.TcpProxy{}
+			if fc.GetTypedConfig() != nil {
+				if err := fc.GetTypedConfig().UnmarshalTo(tcpProxy); err != nil {
+					return nil, fmt.Errorf("filter chain %q: failed to unmarshal tcp proxy: %v", fcs.Name, err)
+				}
+			}
+			return tcpProxy, nil
+		}
+	}
+	return nil, nil
+}
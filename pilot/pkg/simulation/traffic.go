@@ -21,25 +21,17 @@ import (
 	"net/http"
 	"regexp"
 	"strings"
-	"testing"
 
-	cluster "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
 	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
 	listener "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
 	route "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
 	tls "github.com/envoyproxy/go-control-plane/envoy/extensions/transport_sockets/tls/v3"
-	"github.com/google/go-cmp/cmp"
-	"github.com/google/go-cmp/cmp/cmpopts"
 	"github.com/yl2chen/cidranger"
 
-	"istio.io/istio/pilot/pkg/model"
 	"istio.io/istio/pilot/pkg/networking/core/v1alpha3"
 	"istio.io/istio/pilot/pkg/util/sets"
-	"istio.io/istio/pilot/pkg/xds"
 	xdsfilters "istio.io/istio/pilot/pkg/xds/filters"
-	"istio.io/istio/pilot/test/xdstest"
 	"istio.io/istio/pkg/config/host"
-	"istio.io/istio/pkg/test"
 )
 
 type Protocol string
@@ -162,109 +154,74 @@ type Result struct {
 	// if we pass the test. This is to ensure that if the behavior changes, we still capture it; the skip
 	// just ensures we notice a test is wrong
 	Skip string
-	t    test.Failer
 }
 
-func (r Result) Matches(t *testing.T, want Result) {
-	r.StrictMatch = want.StrictMatch // to make diff pass
-	r.Skip = want.Skip               // to make diff pass
-	diff := cmp.Diff(want, r, cmpopts.IgnoreUnexported(Result{}), cmpopts.EquateErrors())
-	if want.StrictMatch && diff != "" {
-		t.Errorf("Diff: %v", diff)
-		return
-	}
-	if want.Error != r.Error {
-		t.Errorf("want error %v got %v", want.Error, r.Error)
-	}
-	if want.ListenerMatched != "" && want.ListenerMatched != r.ListenerMatched {
-		t.Errorf("want listener matched %q got %q", want.ListenerMatched, r.ListenerMatched)
-	}
-	if want.FilterChainMatched != "" && want.FilterChainMatched != r.FilterChainMatched {
-		t.Errorf("want filter chain matched %q got %q", want.FilterChainMatched, r.FilterChainMatched)
-	}
-	if want.RouteMatched != "" && want.RouteMatched != r.RouteMatched {
-		t.Errorf("want route matched %q got %q", want.RouteMatched, r.RouteMatched)
-	}
-	if want.RouteConfigMatched != "" && want.RouteConfigMatched != r.RouteConfigMatched {
-		t.Errorf("want route config matched %q got %q", want.RouteConfigMatched, r.RouteConfigMatched)
-	}
-	if want.VirtualHostMatched != "" && want.VirtualHostMatched != r.VirtualHostMatched {
-		t.Errorf("want virtual host matched %q got %q", want.VirtualHostMatched, r.VirtualHostMatched)
-	}
-	if want.ClusterMatched != "" && want.ClusterMatched != r.ClusterMatched {
-		t.Errorf("want cluster matched %q got %q", want.ClusterMatched, r.ClusterMatched)
-	}
-	if t.Failed() {
-		t.Logf("Diff: %+v", diff)
-	} else if want.Skip != "" {
-		t.Skip(fmt.Sprintf("Known bug: %v", r.Skip))
-	}
-}
-
-type Simulation struct {
-	t         *testing.T
-	Listeners []*listener.Listener
-	Clusters  []*cluster.Cluster
-	Routes    []*route.RouteConfiguration
-}
-
-func NewSimulationFromConfigGen(t *testing.T, s *v1alpha3.ConfigGenTest, proxy *model.Proxy) *Simulation {
-	sim := &Simulation{
-		t:         t,
-		Listeners: s.Listeners(proxy),
-		Clusters:  s.Clusters(proxy),
-		Routes:    s.Routes(proxy),
-	}
-	return sim
-}
-
-func NewSimulation(t *testing.T, s *xds.FakeDiscoveryServer, proxy *model.Proxy) *Simulation {
-	return NewSimulationFromConfigGen(t, s.ConfigGenTest, proxy)
-}
-
-// withT swaps out the testing struct. This allows executing sub tests.
-func (sim *Simulation) withT(t *testing.T) *Simulation {
-	cpy := *sim
-	cpy.t = t
-	return &cpy
-}
-
-func (sim *Simulation) RunExpectations(es []Expect) {
-	for _, e := range es {
-		sim.t.Run(e.Name, func(t *testing.T) {
-			sim.withT(t).Run(e.Call).Matches(t, e.Result)
-		})
+func hasFilterOnPort(l *listener.Listener, filter string, port int) (bool, error) {
+	for _, lf := range l.ListenerFilters {
+		if lf.Name != filter {
+			continue
+		}
+		if lf.FilterDisabled == nil {
+			return true, nil
+		}
+		disabled, err := evaluateListenerFilterPredicates(lf.FilterDisabled, port)
+		return !disabled, err
 	}
+	return false, nil
 }
 
-func hasFilterOnPort(l *listener.Listener, filter string, port int) bool {
-	got, f := xdstest.ExtractListenerFilters(l)[filter]
-	if !f {
-		return false
-	}
-	if got.FilterDisabled == nil {
-		return true
+// evaluateListenerFilterPredicates runs through the ListenerFilterChainMatchPredicate logic.
+func evaluateListenerFilterPredicates(predicate *listener.ListenerFilterChainMatchPredicate, port int) (bool, error) {
+	if predicate == nil {
+		return false, nil
+	}
+	switch r := predicate.Rule.(type) {
+	case *listener.ListenerFilterChainMatchPredicate_NotMatch:
+		matches, err := evaluateListenerFilterPredicates(r.NotMatch, port)
+		return !matches, err
+	case *listener.ListenerFilterChainMatchPredicate_OrMatch:
+		matches := false
+		for _, r := range r.OrMatch.Rules {
+			m, err := evaluateListenerFilterPredicates(r, port)
+			if err != nil {
+				return false, err
+			}
+			matches = matches || m
+		}
+		return matches, nil
+	case *listener.ListenerFilterChainMatchPredicate_DestinationPortRange:
+		return int32(port) >= r.DestinationPortRange.GetStart() && int32(port) < r.DestinationPortRange.GetEnd(), nil
+	default:
+		return false, fmt.Errorf("unsupported listener filter predicate %T", r)
 	}
-	return !xdstest.EvaluateListenerFilterPredicates(got.FilterDisabled, port)
 }
 
-func (sim *Simulation) Run(input Call) (result Result) {
-	result = Result{t: sim.t}
+// Trace walks the call through the listeners, filter chains, virtual hosts and routes of the Tracer.
+// Failures to match, such as ErrNoRoute, are reported in Trace.Result.Error. The returned error is
+// reserved for configuration that cannot be evaluated at all, such as an invalid regex.
+func (tr *Tracer) Trace(input Call) (*Trace, error) {
+	res := &Trace{}
+	result := &res.Result
 	input = input.FillDefaults()
+	res.Call = input
 	if input.Alpn != "" && input.TLS == Plaintext {
 		result.Error = fmt.Errorf("invalid call, ALPN can only be sent in TLS requests")
-		return result
+		return res, nil
 	}
 
 	// First we will match a listener
-	l := matchListener(sim.Listeners, input)
+	l := matchListener(tr.Listeners, input)
 	if l == nil {
 		result.Error = ErrNoListener
-		return
+		return res, nil
 	}
+	res.Listener = l
 	result.ListenerMatched = l.Name
 
-	hasTLSInspector := hasFilterOnPort(l, xdsfilters.TLSInspector.Name, input.Port)
+	hasTLSInspector, err := hasFilterOnPort(l, xdsfilters.TLSInspector.Name, input.Port)
+	if err != nil {
+		return nil, err
+	}
 	if !hasTLSInspector {
 		// Without tls inspector, Envoy would not read the ALPN in the TLS handshake
 		// HTTP inspector still may set it though
@@ -272,98 +229,148 @@ func (sim *Simulation) Run(input Call) (result Result) {
 	}
 
 	// Apply listener filters
-	if hasFilterOnPort(l, xdsfilters.HTTPInspector.Name, input.Port) {
+	hasHTTPInspector, err := hasFilterOnPort(l, xdsfilters.HTTPInspector.Name, input.Port)
+	if err != nil {
+		return nil, err
+	}
+	if hasHTTPInspector {
 		if alpn := protocolToAlpn(input.Protocol); alpn != "" && input.TLS == Plaintext {
 			input.Alpn = alpn
 		}
 	}
 
-	fc, err := sim.matchFilterChain(l.FilterChains, l.DefaultFilterChain, input, hasTLSInspector)
+	fc, err := tr.matchFilterChain(l.FilterChains, l.DefaultFilterChain, input, hasTLSInspector)
 	if err != nil {
-		result.Error = err
-		return
+		if errors.Is(err, ErrNoFilterChain) || errors.Is(err, ErrMultipleFilterChain) {
+			result.Error = err
+			return res, nil
+		}
+		return nil, err
 	}
+	res.FilterChain = fc
 	result.FilterChainMatched = fc.Name
 	// Plaintext to TLS is an error
 	if fc.TransportSocket != nil && input.TLS == Plaintext {
 		result.Error = ErrTLSError
-		return
+		return res, nil
 	}
 	// mTLS listener will only accept mTLS traffic
-	if fc.TransportSocket != nil && sim.requiresMTLS(fc) != (input.TLS == MTLS) {
-		// If there is no tls inspector, then
-		result.Error = ErrMTLSError
-		return
+	if fc.TransportSocket != nil {
+		mtls, err := requiresMTLS(fc)
+		if err != nil {
+			return nil, err
+		}
+		if mtls != (input.TLS == MTLS) {
+			// If there is no tls inspector, then
+			result.Error = ErrMTLSError
+			return res, nil
+		}
+		res.DownstreamTLS = input.TLS
+	} else {
+		res.DownstreamTLS = Plaintext
 	}
 
-	if hcm := xdstest.ExtractHTTPConnectionManager(sim.t, fc); hcm != nil {
+	h, err := extractHTTPConnectionManager(fc)
+	if err != nil {
+		return nil, err
+	}
+	if h != nil {
 		// We matched HCM and didn't terminate TLS, but we are sending TLS traffic - decoding will fail
 		if input.TLS != Plaintext && fc.TransportSocket == nil {
 			result.Error = ErrProtocolError
-			return
+			return res, nil
 		}
 		// TCP to HCM is invalid
 		if input.Protocol != HTTP && input.Protocol != HTTP2 {
 			result.Error = ErrProtocolError
-			return
+			return res, nil
 		}
 
 		// Fetch inline route
-		rc := hcm.GetRouteConfig()
+		rc := h.GetRouteConfig()
 		if rc == nil {
 			// If not set, fallback to RDS
-			routeName := hcm.GetRds().RouteConfigName
+			routeName := h.GetRds().RouteConfigName
 			result.RouteConfigMatched = routeName
-			rc = xdstest.ExtractRouteConfigurations(sim.Routes)[routeName]
+			for _, r := range tr.Routes {
+				if r.Name == routeName {
+					rc = r
+				}
+			}
 		}
+		res.RouteConfig = rc
 		hostHeader := ""
 		if len(input.Headers["Host"]) > 0 {
 			hostHeader = input.Headers["Host"][0]
 		}
-		vh := sim.matchVirtualHost(rc, hostHeader)
+		vh := matchVirtualHost(rc, hostHeader)
 		if vh == nil {
 			result.Error = ErrNoVirtualHost
-			return
+			return res, nil
 		}
+		res.VirtualHost = vh
 		result.VirtualHostMatched = vh.Name
 		if vh.RequireTls == route.VirtualHost_ALL && input.TLS == Plaintext {
 			result.Error = ErrTLSRedirect
-			return
+			return res, nil
 		}
 
-		r := sim.matchRoute(vh, input)
+		r, err := matchRoute(vh, input)
+		if err != nil {
+			return nil, err
+		}
 		if r == nil {
 			result.Error = ErrNoRoute
-			return
+			return res, nil
 		}
+		res.Route = r
 		result.RouteMatched = r.Name
 		switch t := r.GetAction().(type) {
 		case *route.Route_Route:
 			result.ClusterMatched = t.Route.GetCluster()
+			for _, wc := range t.Route.GetWeightedClusters().GetClusters() {
+				res.WeightedClusters = append(res.WeightedClusters, wc.GetName())
+			}
+		}
+	} else {
+		tcp, err := extractTCPProxy(fc)
+		if err != nil {
+			return nil, err
+		}
+		if tcp != nil {
+			result.ClusterMatched = tcp.GetCluster()
+			for _, wc := range tcp.GetWeightedClusters().GetClusters() {
+				res.WeightedClusters = append(res.WeightedClusters, wc.GetName())
+			}
+		}
+	}
+	if result.ClusterMatched != "" {
+		for _, c := range tr.Clusters {
+			if c.Name == result.ClusterMatched {
+				res.setCluster(c)
+			}
 		}
-	} else if tcp := xdstest.ExtractTCPProxy(sim.t, fc); tcp != nil {
-		result.ClusterMatched = tcp.GetCluster()
 	}
-	return
+	return res, nil
 }
 
-func (sim *Simulation) requiresMTLS(fc *listener.FilterChain) bool {
+func requiresMTLS(fc *listener.FilterChain) (bool, error) {
 	if fc.TransportSocket == nil {
-		return false
+		return false, nil
 	}
 	t := &tls.DownstreamTlsContext{}
 	if err := fc.GetTransportSocket().GetTypedConfig().UnmarshalTo(t); err != nil {
-		sim.t.Fatal(err)
+		return false, fmt.Errorf("filter chain %q: invalid downstream tls context: %v", fc.Name, err)
 	}
 
 	if len(t.GetCommonTlsContext().GetTlsCertificateSdsSecretConfigs()) == 0 {
-		return false
+		return false, nil
 	}
 	// This is a lazy heuristic, we could check for explicit default resource or spiffe if it becomes necessary
-	return t.GetCommonTlsContext().GetTlsCertificateSdsSecretConfigs()[0].Name == "default"
+	return t.GetCommonTlsContext().GetTlsCertificateSdsSecretConfigs()[0].Name == "default", nil
 }
 
-func (sim *Simulation) matchRoute(vh *route.VirtualHost, input Call) *route.Route {
+func matchRoute(vh *route.VirtualHost, input Call) (*route.Route, error) {
 	for _, r := range vh.Routes {
 		// check path
 		switch pt := r.Match.GetPathSpecifier().(type) {
@@ -378,25 +385,25 @@ func (sim *Simulation) matchRoute(vh *route.VirtualHost, input Call) *route.Rout
 		case *route.RouteMatch_SafeRegex:
 			r, err := regexp.Compile(pt.SafeRegex.GetRegex())
 			if err != nil {
-				sim.t.Fatalf("invalid regex %v: %v", r, err)
+				return nil, fmt.Errorf("invalid regex %v: %v", pt.SafeRegex.GetRegex(), err)
 			}
 			if !r.MatchString(input.Path) {
 				continue
 			}
 		default:
-			sim.t.Fatalf("unknown route path type")
+			return nil, fmt.Errorf("route %q: unknown route path type %T", r.Name, pt)
 		}
 
 		// TODO this only handles path - we need to add headers, query params, etc to be complete.
 
-		return r
+		return r, nil
 	}
-	return nil
+	return nil, nil
 }
 
-func (sim *Simulation) matchVirtualHost(rc *route.RouteConfiguration, host string) *route.VirtualHost {
+func matchVirtualHost(rc *route.RouteConfiguration, host string) *route.VirtualHost {
 	// Exact match
-	for _, vh := range rc.VirtualHosts {
+	for _, vh := range rc.GetVirtualHosts() {
 		for _, d := range vh.Domains {
 			if d == host {
 				return vh
@@ -406,7 +413,7 @@ func (sim *Simulation) matchVirtualHost(rc *route.RouteConfiguration, host strin
 	// prefix match
 	var bestMatch *route.VirtualHost
 	longest := 0
-	for _, vh := range rc.VirtualHosts {
+	for _, vh := range rc.GetVirtualHosts() {
 		for _, d := range vh.Domains {
 			if d[0] != '*' {
 				continue
@@ -422,7 +429,7 @@ func (sim *Simulation) matchVirtualHost(rc *route.RouteConfiguration, host strin
 	}
 	// Suffix match
 	longest = 0
-	for _, vh := range rc.VirtualHosts {
+	for _, vh := range rc.GetVirtualHosts() {
 		for _, d := range vh.Domains {
 			if d[len(d)-1] != '*' {
 				continue
@@ -437,7 +444,7 @@ func (sim *Simulation) matchVirtualHost(rc *route.RouteConfiguration, host strin
 		return bestMatch
 	}
 	// wildcard match
-	for _, vh := range rc.VirtualHosts {
+	for _, vh := range rc.GetVirtualHosts() {
 		for _, d := range vh.Domains {
 			if d == "*" {
 				return vh
@@ -453,13 +460,14 @@ func (sim *Simulation) matchVirtualHost(rc *route.RouteConfiguration, host strin
 // Envoy algorithm - at each level we will filter out all FilterChains that do
 // not match. This means an empty match (`{}`) may not match if another chain
 // matches one criteria but not another.
-func (sim *Simulation) matchFilterChain(chains []*listener.FilterChain, defaultChain *listener.FilterChain,
+func (tr *Tracer) matchFilterChain(chains []*listener.FilterChain, defaultChain *listener.FilterChain,
 	input Call, hasTLSInspector bool) (*listener.FilterChain, error) {
 	chains = filter(chains, func(fc *listener.FilterChainMatch) bool {
 		return fc.GetDestinationPort() == nil
 	}, func(fc *listener.FilterChainMatch) bool {
 		return int(fc.GetDestinationPort().GetValue()) == input.Port
 	})
+	var matchErr error
 	chains = filter(chains, func(fc *listener.FilterChainMatch) bool {
 		return fc.GetPrefixRanges() == nil
 	}, func(fc *listener.FilterChainMatch) bool {
@@ -468,18 +476,24 @@ func (sim *Simulation) matchFilterChain(chains []*listener.FilterChain, defaultC
 			s := fmt.Sprintf("%s/%d", a.AddressPrefix, a.GetPrefixLen().GetValue())
 			_, cidr, err := net.ParseCIDR(s)
 			if err != nil {
-				sim.t.Fatalf("failed to parse cidr %v: %v", s, err)
+				matchErr = fmt.Errorf("failed to parse cidr %v: %v", s, err)
+				return false
 			}
 			if err := ranger.Insert(cidranger.NewBasicRangerEntry(*cidr)); err != nil {
-				sim.t.Fatalf("failed to insert cidr %v: %v", cidr, err)
+				matchErr = fmt.Errorf("failed to insert cidr %v: %v", cidr, err)
+				return false
 			}
 		}
 		f, err := ranger.Contains(net.ParseIP(input.Address))
 		if err != nil {
-			sim.t.Fatalf("cidr containers %v failed: %v", input.Address, err)
+			matchErr = fmt.Errorf("cidr containers %v failed: %v", input.Address, err)
+			return false
 		}
 		return f
 	})
+	if matchErr != nil {
+		return nil, matchErr
+	}
 	chains = filter(chains, func(fc *listener.FilterChainMatch) bool {
 		return fc.GetServerNames() == nil
 	}, func(fc *listener.FilterChainMatch) bool {
@@ -591,7 +605,12 @@ func protocolToAlpn(s Protocol) string {
 
 func matchListener(listeners []*listener.Listener, input Call) *listener.Listener {
 	if input.CallMode == CallModeInbound {
-		return xdstest.ExtractListener(v1alpha3.VirtualInboundListenerName, listeners)
+		for _, l := range listeners {
+			if l.Name == v1alpha3.VirtualInboundListenerName {
+				return l
+			}
+		}
+		return nil
 	}
 	// First find exact match for the IP/Port, then fallback to wildcard IP/Port
 	// There is no wildcard port
@@ -0,0 +1,157 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snapshot
+
+import (
+	"sort"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/serviceregistry"
+	"istio.io/istio/pkg/config/host"
+	"istio.io/istio/pkg/config/labels"
+)
+
+// Registry is a service registry serving the services, and their endpoints, of a snapshot. The services
+// never change: the endpoints are pushed once, by Run or ResyncEDS.
+type Registry struct {
+	clusterID  string
+	xdsUpdater model.XDSUpdater
+
+	services map[host.Name]*model.Service
+	// instances stores hostname ==> instances of the service
+	instances map[host.Name][]*model.ServiceInstance
+	// ip2instance stores ip ==> instances of the workload, for the proxies
+	ip2instance     map[string][]*model.ServiceInstance
+	networkGateways map[string][]*model.Gateway
+}
+
+var _ serviceregistry.Instance = &Registry{}
+
+// NewRegistry creates a registry of the services of the snapshot. Endpoints are pushed to xdsUpdater in
+// the cluster they were captured in, or in clusterID if it is unknown.
+func NewRegistry(snap *Snapshot, clusterID string, xdsUpdater model.XDSUpdater) *Registry {
+	r := &Registry{
+		clusterID:       clusterID,
+		xdsUpdater:      xdsUpdater,
+		services:        make(map[host.Name]*model.Service, len(snap.Services)),
+		instances:       make(map[host.Name][]*model.ServiceInstance, len(snap.Services)),
+		ip2instance:     make(map[string][]*model.ServiceInstance),
+		networkGateways: snap.NetworkGateways,
+	}
+	for _, svc := range snap.Services {
+		r.services[svc.Service.Hostname] = svc.Service
+		instances := svc.instances()
+		r.instances[svc.Service.Hostname] = instances
+		for _, instance := range instances {
+			r.ip2instance[instance.Endpoint.Address] = append(r.ip2instance[instance.Endpoint.Address], instance)
+		}
+	}
+	return r
+}
+
+func (r *Registry) Provider() serviceregistry.ProviderID {
+	return serviceregistry.Snapshot
+}
+
+func (r *Registry) Cluster() string {
+	return r.clusterID
+}
+
+// AppendServiceHandler is a no-op: the services of a snapshot never change.
+func (r *Registry) AppendServiceHandler(func(*model.Service, model.Event)) {}
+
+// AppendWorkloadHandler is a no-op: the workloads of a snapshot never change.
+func (r *Registry) AppendWorkloadHandler(func(*model.WorkloadInstance, model.Event)) {}
+
+// Run pushes the endpoints of the services.
+func (r *Registry) Run(<-chan struct{}) {
+	r.ResyncEDS()
+}
+
+// HasSynced always returns true, as the services are known upfront.
+func (r *Registry) HasSynced() bool {
+	return true
+}
+
+// ResyncEDS pushes the endpoints of all the services, in the clusters they were captured in.
+func (r *Registry) ResyncEDS() {
+	for hostname, svc := range r.services {
+		byCluster := map[string][]*model.IstioEndpoint{}
+		for _, instance := range r.instances[hostname] {
+			cluster := instance.Endpoint.Locality.ClusterID
+			if cluster == "" {
+				cluster = r.clusterID
+			}
+			byCluster[cluster] = append(byCluster[cluster], instance.Endpoint)
+		}
+		for cluster, endpoints := range byCluster {
+			r.xdsUpdater.EDSUpdate(cluster, string(hostname), svc.Attributes.Namespace, endpoints)
+		}
+	}
+}
+
+// Services implements a service catalog operation
+func (r *Registry) Services() ([]*model.Service, error) {
+	out := make([]*model.Service, 0, len(r.services))
+	for _, svc := range r.services {
+		out = append(out, svc)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Hostname < out[j].Hostname })
+	return out, nil
+}
+
+// GetService implements a service catalog operation
+func (r *Registry) GetService(hostname host.Name) (*model.Service, error) {
+	return r.services[hostname], nil
+}
+
+// InstancesByPort implements a service catalog operation
+func (r *Registry) InstancesByPort(svc *model.Service, port int, labels labels.Collection) []*model.ServiceInstance {
+	out := make([]*model.ServiceInstance, 0)
+	for _, instance := range r.instances[svc.Hostname] {
+		if instance.ServicePort.Port == port && labels.HasSubsetOf(instance.Endpoint.Labels) {
+			out = append(out, instance)
+		}
+	}
+	return out
+}
+
+// GetProxyServiceInstances returns the service instances of the endpoints with the IP addresses of the proxy.
+func (r *Registry) GetProxyServiceInstances(node *model.Proxy) []*model.ServiceInstance {
+	out := make([]*model.ServiceInstance, 0)
+	for _, ip := range node.IPAddresses {
+		out = append(out, r.ip2instance[ip]...)
+	}
+	return out
+}
+
+func (r *Registry) GetProxyWorkloadLabels(proxy *model.Proxy) labels.Collection {
+	out := make(labels.Collection, 0)
+	for _, ip := range proxy.IPAddresses {
+		for _, instance := range r.ip2instance[ip] {
+			out = append(out, instance.Endpoint.Labels)
+		}
+	}
+	return out
+}
+
+// GetIstioServiceAccounts implements model.ServiceAccounts operation
+func (r *Registry) GetIstioServiceAccounts(svc *model.Service, ports []int) []string {
+	return model.GetServiceAccounts(svc, ports, r)
+}
+
+func (r *Registry) NetworkGateways() map[string][]*model.Gateway {
+	return r.networkGateways
+}
@@ -0,0 +1,322 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package snapshot captures the state seen by istiod, its configs and the services of its registries,
+// into a single archive, so istiod can be started again from the same state without a Kubernetes API
+// server.
+//
+// An archive is a gzip compressed JSON document. Configs are stored as Kubernetes objects, as in
+// /debug/configz, and services with their endpoints, as in /debug/registryz and /debug/endpointz.
+package snapshot
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	meshconfig "istio.io/api/mesh/v1alpha1"
+	"istio.io/api/meta/v1alpha1"
+	"istio.io/istio/pilot/pkg/config/kube/crd"
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/serviceregistry"
+	"istio.io/istio/pkg/config"
+	"istio.io/istio/pkg/config/schema/collections"
+	"istio.io/istio/pkg/util/gogoprotomarshal"
+	"istio.io/pkg/version"
+)
+
+// Version is the version of the archive format. Archives of other versions are rejected by Read.
+const Version = "v1alpha1"
+
+// Snapshot is the state seen by istiod at a point in time.
+type Snapshot struct {
+	// Version is the version of the archive format.
+	Version string
+	// Time is when the snapshot was captured.
+	Time time.Time
+	// IstiodVersion is the version of the istiod the snapshot was captured from.
+	IstiodVersion string
+
+	DomainSuffix string
+	MeshConfig   *meshconfig.MeshConfig
+	MeshNetworks *meshconfig.MeshNetworks
+
+	// Configs are the configs of all the config stores.
+	Configs []config.Config
+	// Services are the services of the registries, except the services of ServiceEntries which are
+	// derived from the configs.
+	Services        []*Service
+	NetworkGateways map[string][]*model.Gateway
+}
+
+// Service is a service of a registry, with its endpoints in all clusters.
+type Service struct {
+	Service   *model.Service         `json:"service"`
+	Endpoints []*model.IstioEndpoint `json:"endpoints,omitempty"`
+}
+
+// snapshotJSON is the serialized form of a Snapshot.
+type snapshotJSON struct {
+	Version         string                      `json:"version"`
+	Time            time.Time                   `json:"time"`
+	IstiodVersion   string                      `json:"istiodVersion,omitempty"`
+	DomainSuffix    string                      `json:"domainSuffix,omitempty"`
+	MeshConfig      json.RawMessage             `json:"meshConfig,omitempty"`
+	MeshNetworks    json.RawMessage             `json:"meshNetworks,omitempty"`
+	Configs         []*crd.IstioKind            `json:"configs"`
+	Services        []*Service                  `json:"services"`
+	NetworkGateways map[string][]*model.Gateway `json:"networkGateways,omitempty"`
+}
+
+// endpointKey identifies an endpoint of a service.
+type endpointKey struct {
+	cluster  string
+	portName string
+	address  string
+	port     uint32
+}
+
+// Capture captures the configs and the services of the environment.
+func Capture(env *model.Environment) (*Snapshot, error) {
+	snap := &Snapshot{
+		Version:         Version,
+		Time:            time.Now(),
+		IstiodVersion:   version.Info.Version,
+		DomainSuffix:    env.DomainSuffix,
+		MeshConfig:      env.Mesh(),
+		MeshNetworks:    env.Networks(),
+		NetworkGateways: env.ServiceDiscovery.NetworkGateways(),
+	}
+
+	for _, schema := range env.IstioConfigStore.Schemas().All() {
+		configs, err := env.IstioConfigStore.List(schema.Resource().GroupVersionKind(), model.NamespaceAll)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %v: %v", schema.Resource().GroupVersionKind(), err)
+		}
+		snap.Configs = append(snap.Configs, configs...)
+	}
+
+	services, err := env.ServiceDiscovery.Services()
+	if err != nil {
+		return nil, err
+	}
+	for _, svc := range services {
+		if svc.Attributes.ServiceRegistry == string(serviceregistry.External) {
+			// Captured as ServiceEntry and WorkloadEntry configs.
+			continue
+		}
+		out := &Service{Service: svc.DeepCopy()}
+		// Ports sharing a number, e.g. TCP and UDP, return the same instances.
+		seen := map[endpointKey]bool{}
+		for _, port := range svc.Ports {
+			for _, instance := range env.ServiceDiscovery.InstancesByPort(svc, port.Port, nil) {
+				key := endpointKey{
+					cluster:  instance.Endpoint.Locality.ClusterID,
+					portName: instance.Endpoint.ServicePortName,
+					address:  instance.Endpoint.Address,
+					port:     instance.Endpoint.EndpointPort,
+				}
+				if seen[key] {
+					continue
+				}
+				seen[key] = true
+				ep := *instance.Endpoint
+				// The Envoy endpoint is a cache built from the other fields.
+				ep.EnvoyEndpoint = nil
+				out.Endpoints = append(out.Endpoints, &ep)
+			}
+		}
+		snap.Services = append(snap.Services, out)
+	}
+	return snap, nil
+}
+
+func (s *Snapshot) MarshalJSON() ([]byte, error) {
+	out := snapshotJSON{
+		Version:         s.Version,
+		Time:            s.Time,
+		IstiodVersion:   s.IstiodVersion,
+		DomainSuffix:    s.DomainSuffix,
+		Configs:         make([]*crd.IstioKind, 0, len(s.Configs)),
+		Services:        s.Services,
+		NetworkGateways: s.NetworkGateways,
+	}
+	if s.MeshConfig != nil {
+		js, err := gogoprotomarshal.ToJSON(s.MeshConfig)
+		if err != nil {
+			return nil, err
+		}
+		out.MeshConfig = json.RawMessage(js)
+	}
+	if s.MeshNetworks != nil {
+		js, err := gogoprotomarshal.ToJSON(s.MeshNetworks)
+		if err != nil {
+			return nil, err
+		}
+		out.MeshNetworks = json.RawMessage(js)
+	}
+	for _, cfg := range s.Configs {
+		obj, err := crd.ConvertConfig(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert %v %s/%s: %v", cfg.GroupVersionKind, cfg.Namespace, cfg.Name, err)
+		}
+		out.Configs = append(out.Configs, obj.(*crd.IstioKind))
+	}
+	return json.Marshal(out)
+}
+
+func (s *Snapshot) UnmarshalJSON(b []byte) error {
+	in := snapshotJSON{}
+	if err := json.Unmarshal(b, &in); err != nil {
+		return err
+	}
+	if in.Version != Version {
+		return fmt.Errorf("unsupported snapshot version %q, expected %q", in.Version, Version)
+	}
+	out := Snapshot{
+		Version:         in.Version,
+		Time:            in.Time,
+		IstiodVersion:   in.IstiodVersion,
+		DomainSuffix:    in.DomainSuffix,
+		Services:        in.Services,
+		NetworkGateways: in.NetworkGateways,
+	}
+	if len(in.MeshConfig) > 0 {
+		out.MeshConfig = &meshconfig.MeshConfig{}
+		if err := gogoprotomarshal.ApplyJSON(string(in.MeshConfig), out.MeshConfig); err != nil {
+			return fmt.Errorf("invalid mesh config: %v", err)
+		}
+	}
+	if len(in.MeshNetworks) > 0 {
+		out.MeshNetworks = &meshconfig.MeshNetworks{}
+		if err := gogoprotomarshal.ApplyJSON(string(in.MeshNetworks), out.MeshNetworks); err != nil {
+			return fmt.Errorf("invalid mesh networks: %v", err)
+		}
+	}
+	for _, obj := range in.Configs {
+		cfg, err := convertObject(obj, in.DomainSuffix)
+		if err != nil {
+			return err
+		}
+		out.Configs = append(out.Configs, *cfg)
+	}
+	*s = out
+	return nil
+}
+
+// convertObject converts a config of an archive back to the internal configuration model.
+func convertObject(obj *crd.IstioKind, domain string) (*config.Config, error) {
+	gvk := obj.GroupVersionKind()
+	schema, f := collections.All.FindByGroupVersionKind(config.GroupVersionKind{
+		Group:   gvk.Group,
+		Version: gvk.Version,
+		Kind:    gvk.Kind,
+	})
+	if !f {
+		return nil, fmt.Errorf("unknown config type %s for %s/%s", obj.APIVersion+"/"+obj.Kind, obj.Namespace, obj.Name)
+	}
+	// The status is converted separately, as crd.ConvertObject does not decode the timestamps of the
+	// Istio status.
+	status := obj.Status
+	obj = obj.DeepCopy()
+	obj.Status = nil
+	cfg, err := crd.ConvertObject(schema, obj, domain)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s %s/%s: %v", obj.Kind, obj.Namespace, obj.Name, err)
+	}
+	// Only the status of Istio configs is restored.
+	if status != nil && strings.HasSuffix(schema.Resource().Group(), "istio.io") {
+		js, err := json.Marshal(status)
+		if err != nil {
+			return nil, err
+		}
+		istioStatus := &v1alpha1.IstioStatus{}
+		if err := gogoprotomarshal.ApplyJSON(string(js), istioStatus); err != nil {
+			return nil, fmt.Errorf("invalid status of %s %s/%s: %v", obj.Kind, obj.Namespace, obj.Name, err)
+		}
+		cfg.Status = istioStatus
+	}
+	return cfg, nil
+}
+
+// Write writes the snapshot to w as an archive.
+func (s *Snapshot) Write(w io.Writer) error {
+	gz := gzip.NewWriter(w)
+	if err := json.NewEncoder(gz).Encode(s); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// WriteFile writes the snapshot to the archive at path. As the configs may contain sensitive data, the
+// file is only readable by its owner.
+func (s *Snapshot) WriteFile(path string) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if err := s.Write(f); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Read reads a snapshot from an archive. Uncompressed JSON documents are accepted too, so archives
+// can be edited by hand.
+func Read(r io.Reader) (*Snapshot, error) {
+	br := bufio.NewReader(r)
+	var in io.Reader = br
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		in = gz
+	}
+	snap := &Snapshot{}
+	if err := json.NewDecoder(in).Decode(snap); err != nil {
+		return nil, err
+	}
+	return snap, nil
+}
+
+// ReadFile reads a snapshot from the archive at path.
+func ReadFile(path string) (*Snapshot, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Read(f)
+}
+
+// instances returns the service instances of the endpoints of the service.
+func (s *Service) instances() []*model.ServiceInstance {
+	out := make([]*model.ServiceInstance, 0, len(s.Endpoints))
+	for _, ep := range s.Endpoints {
+		port, f := s.Service.Ports.Get(ep.ServicePortName)
+		if !f {
+			continue
+		}
+		out = append(out, &model.ServiceInstance{Service: s.Service, ServicePort: port, Endpoint: ep})
+	}
+	return out
+}
@@ -0,0 +1,265 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snapshot
+
+import (
+	"bytes"
+	"compress/gzip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/gogo/protobuf/types"
+
+	"istio.io/api/meta/v1alpha1"
+	"istio.io/api/networking/v1alpha3"
+	"istio.io/istio/pilot/pkg/config/memory"
+	"istio.io/istio/pilot/pkg/model"
+	memregistry "istio.io/istio/pilot/pkg/serviceregistry/memory"
+	"istio.io/istio/pkg/config"
+	"istio.io/istio/pkg/config/labels"
+	"istio.io/istio/pkg/config/mesh"
+	"istio.io/istio/pkg/config/protocol"
+	"istio.io/istio/pkg/config/schema/collections"
+	"istio.io/istio/pkg/config/schema/gvk"
+)
+
+func testSnapshot() *Snapshot {
+	m := mesh.DefaultMeshConfig()
+	svc := &model.Service{
+		Hostname: "app.default.svc.cluster.local",
+		Address:  "10.0.0.1",
+		Ports:    model.PortList{{Name: "http", Port: 80, Protocol: protocol.HTTP}},
+		Attributes: model.ServiceAttributes{
+			ServiceRegistry: "Kubernetes",
+			Name:            "app",
+			Namespace:       "default",
+		},
+	}
+	return &Snapshot{
+		Version:      Version,
+		Time:         time.Unix(1600000000, 0).UTC(),
+		DomainSuffix: "cluster.local",
+		MeshConfig:   &m,
+		Configs: []config.Config{
+			{
+				Meta: config.Meta{
+					GroupVersionKind: gvk.VirtualService,
+					Namespace:        "default",
+					Name:             "app",
+					Domain:           "cluster.local",
+				},
+				Spec: &v1alpha3.VirtualService{
+					Hosts: []string{"app"},
+					Http: []*v1alpha3.HTTPRoute{{
+						Route: []*v1alpha3.HTTPRouteDestination{{Destination: &v1alpha3.Destination{Host: "app"}}},
+					}},
+				},
+			},
+			{
+				Meta: config.Meta{
+					GroupVersionKind: gvk.WorkloadEntry,
+					Namespace:        "default",
+					Name:             "vm",
+					Domain:           "cluster.local",
+				},
+				Spec: &v1alpha3.WorkloadEntry{Address: "10.1.0.1", Labels: map[string]string{"app": "vm"}},
+				Status: &v1alpha1.IstioStatus{Conditions: []*v1alpha1.IstioCondition{{
+					Type:               "Healthy",
+					Status:             "True",
+					LastTransitionTime: &types.Timestamp{Seconds: 1600000000},
+				}}},
+			},
+		},
+		Services: []*Service{{
+			Service: svc,
+			Endpoints: []*model.IstioEndpoint{
+				{
+					Address:         "1.2.3.4",
+					EndpointPort:    8080,
+					ServicePortName: "http",
+					Labels:          labels.Instance{"version": "v1"},
+					Locality:        model.Locality{ClusterID: "remote"},
+				},
+				{
+					Address:         "1.2.3.5",
+					EndpointPort:    8080,
+					ServicePortName: "http",
+					Labels:          labels.Instance{"version": "v2"},
+				},
+			},
+		}},
+	}
+}
+
+func TestWriteRead(t *testing.T) {
+	in := testSnapshot()
+	buf := &bytes.Buffer{}
+	if err := in.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+	out, err := Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if out.Version != Version || !out.Time.Equal(in.Time) || out.DomainSuffix != in.DomainSuffix {
+		t.Errorf("unexpected metadata %v %v %v", out.Version, out.Time, out.DomainSuffix)
+	}
+	if !proto.Equal(out.MeshConfig, in.MeshConfig) {
+		t.Errorf("mesh config mismatch: got %v, want %v", out.MeshConfig, in.MeshConfig)
+	}
+	if len(out.Configs) != len(in.Configs) {
+		t.Fatalf("expected %d configs, got %v", len(in.Configs), out.Configs)
+	}
+	for i, cfg := range out.Configs {
+		want := in.Configs[i]
+		if cfg.GroupVersionKind != want.GroupVersionKind || cfg.Name != want.Name || cfg.Namespace != want.Namespace {
+			t.Errorf("config mismatch: got %v, want %v", cfg.Meta, want.Meta)
+		}
+		if !proto.Equal(cfg.Spec.(proto.Message), want.Spec.(proto.Message)) {
+			t.Errorf("spec mismatch of %s: got %v, want %v", cfg.Name, cfg.Spec, want.Spec)
+		}
+		if want.Status != nil && !proto.Equal(cfg.Status.(proto.Message), want.Status.(proto.Message)) {
+			t.Errorf("status mismatch of %s: got %v, want %v", cfg.Name, cfg.Status, want.Status)
+		}
+	}
+	if len(out.Services) != 1 || out.Services[0].Service.Hostname != "app.default.svc.cluster.local" ||
+		len(out.Services[0].Endpoints) != 2 || out.Services[0].Endpoints[0].Locality.ClusterID != "remote" {
+		t.Errorf("unexpected services %v", out.Services)
+	}
+}
+
+func TestRead(t *testing.T) {
+	t.Run("plain json", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		if err := testSnapshot().Write(buf); err != nil {
+			t.Fatal(err)
+		}
+		gz, err := gzip.NewReader(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Read(gz); err != nil {
+			t.Fatal(err)
+		}
+	})
+	t.Run("unsupported version", func(t *testing.T) {
+		_, err := Read(strings.NewReader(`{"version": "v0", "configs": [], "services": []}`))
+		if err == nil || !strings.Contains(err.Error(), "unsupported snapshot version") {
+			t.Fatalf("expected a version error, got %v", err)
+		}
+	})
+	t.Run("unknown config type", func(t *testing.T) {
+		_, err := Read(strings.NewReader(`{"version": "` + Version + `", "configs": [{"apiVersion": "example.com/v1", ` +
+			`"kind": "Unknown", "metadata": {"name": "a", "namespace": "b"}, "spec": {}}]}`))
+		if err == nil || !strings.Contains(err.Error(), "unknown config type") {
+			t.Fatalf("expected an unknown type error, got %v", err)
+		}
+	})
+}
+
+func TestCapture(t *testing.T) {
+	m := mesh.DefaultMeshConfig()
+	svc := &model.Service{
+		Hostname: "dns.default.svc.cluster.local",
+		Address:  "10.0.0.2",
+		Ports: model.PortList{
+			{Name: "tcp-dns", Port: 53, Protocol: protocol.TCP},
+			{Name: "udp-dns", Port: 53, Protocol: protocol.UDP},
+		},
+		Attributes: model.ServiceAttributes{Name: "dns", Namespace: "default"},
+	}
+	sd := memregistry.NewServiceDiscovery(nil)
+	sd.AddService(svc.Hostname, svc)
+	for _, port := range svc.Ports {
+		sd.AddInstance(svc.Hostname, &model.ServiceInstance{
+			ServicePort: port,
+			Endpoint:    &model.IstioEndpoint{Address: "1.2.3.4", EndpointPort: 53, ServicePortName: port.Name},
+		})
+	}
+	env := &model.Environment{
+		ServiceDiscovery: sd,
+		IstioConfigStore: model.MakeIstioStore(memory.Make(collections.Pilot)),
+		Watcher:          mesh.NewFixedWatcher(&m),
+		DomainSuffix:     "cluster.local",
+	}
+
+	snap, err := Capture(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snap.Services) != 1 {
+		t.Fatalf("expected 1 service, got %v", snap.Services)
+	}
+	// both ports return the instances of port 53, which are captured once
+	if got := snap.Services[0].Endpoints; len(got) != 2 {
+		t.Errorf("expected an endpoint per port, got %v", got)
+	}
+}
+
+type edsUpdate struct {
+	cluster   string
+	endpoints int
+}
+
+type fakeXdsUpdater struct {
+	model.XDSUpdater
+	updates map[string]edsUpdate
+}
+
+func (fx *fakeXdsUpdater) EDSUpdate(cluster, hostname string, _ string, entry []*model.IstioEndpoint) {
+	fx.updates[hostname+"/"+cluster] = edsUpdate{cluster: cluster, endpoints: len(entry)}
+}
+
+func TestRegistry(t *testing.T) {
+	fx := &fakeXdsUpdater{updates: map[string]edsUpdate{}}
+	r := NewRegistry(testSnapshot(), "local", fx)
+
+	services, _ := r.Services()
+	if len(services) != 1 {
+		t.Fatalf("unexpected services %v", services)
+	}
+	svc, _ := r.GetService("app.default.svc.cluster.local")
+	if svc == nil {
+		t.Fatal("expected the service of the snapshot")
+	}
+	if instances := r.InstancesByPort(svc, 80, nil); len(instances) != 2 {
+		t.Errorf("expected 2 instances, got %v", instances)
+	}
+	if instances := r.InstancesByPort(svc, 80, labels.Collection{{"version": "v2"}}); len(instances) != 1 ||
+		instances[0].Endpoint.Address != "1.2.3.5" {
+		t.Errorf("unexpected instances of v2 %v", instances)
+	}
+	if instances := r.GetProxyServiceInstances(&model.Proxy{IPAddresses: []string{"1.2.3.4"}}); len(instances) != 1 {
+		t.Errorf("unexpected proxy instances %v", instances)
+	}
+
+	r.ResyncEDS()
+	// the endpoints are pushed in the cluster they were captured in
+	want := map[string]edsUpdate{
+		"app.default.svc.cluster.local/remote": {cluster: "remote", endpoints: 1},
+		"app.default.svc.cluster.local/local":  {cluster: "local", endpoints: 1},
+	}
+	if len(fx.updates) != len(want) {
+		t.Fatalf("unexpected updates %v", fx.updates)
+	}
+	for k, v := range want {
+		if fx.updates[k] != v {
+			t.Errorf("update %s: got %v, want %v", k, fx.updates[k], v)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trustbundle
+
+import (
+	"encoding/pem"
+	"fmt"
+	"sort"
+
+	"istio.io/istio/pkg/spiffe"
+)
+
+// SetFederatedTrustDomains sets the SPIFFE bundle endpoints of the trust domains federated with the mesh,
+// keyed by trust domain. Unlike the SPIFFE bundle endpoints of MeshConfig, whose roots are trusted for the
+// trust domain of the mesh, the roots fetched from these endpoints are only trusted for their trust domain.
+func (tb *TrustBundle) SetFederatedTrustDomains(endpoints map[string]string) {
+	federated := make(map[string]string, len(endpoints))
+	for trustDomain, endpoint := range endpoints {
+		if trustDomain == spiffe.GetTrustDomain() {
+			trustBundleLog.Warnf("ignoring the bundle endpoint %s of the trust domain of the mesh %s", endpoint, trustDomain)
+			continue
+		}
+		federated[trustDomain] = endpoint
+	}
+
+	removed := false
+	tb.federationMutex.Lock()
+	tb.federatedEndpoints = federated
+	for trustDomain := range tb.federatedCerts {
+		if _, ok := federated[trustDomain]; !ok {
+			delete(tb.federatedCerts, trustDomain)
+			removed = true
+		}
+	}
+	tb.federationMutex.Unlock()
+	trustBundleLog.Infof("updated federated trust domains: %v", federated)
+
+	if removed && tb.updatecb != nil {
+		tb.updatecb()
+	}
+
+	select {
+	case tb.endpointUpdateChan <- struct{}{}:
+	default:
+	}
+}
+
+// GetFederatedTrustBundles returns the trust anchors of each federated trust domain, keyed by trust domain.
+// Trust domains whose bundle has not been fetched yet are not included.
+func (tb *TrustBundle) GetFederatedTrustBundles() map[string][]string {
+	tb.federationMutex.RLock()
+	defer tb.federationMutex.RUnlock()
+	bundles := make(map[string][]string, len(tb.federatedCerts))
+	for trustDomain, certs := range tb.federatedCerts {
+		bundles[trustDomain] = append([]string(nil), certs...)
+	}
+	return bundles
+}
+
+// fetchFederatedTrustAnchors fetches the bundle of each federated trust domain. The endpoints follow the
+// https_web profile of SPIFFE federation: they are authenticated with the web PKI roots of remoteCaCertPool.
+// The last bundle of a trust domain is kept when its endpoint cannot be reached, so that an outage of the
+// endpoint does not break the traffic with the trust domain.
+func (tb *TrustBundle) fetchFederatedTrustAnchors() {
+	tb.federationMutex.RLock()
+	endpoints := make(map[string]string, len(tb.federatedEndpoints))
+	for trustDomain, endpoint := range tb.federatedEndpoints {
+		endpoints[trustDomain] = endpoint
+	}
+	tb.federationMutex.RUnlock()
+
+	fetched := map[string][]string{}
+	for trustDomain, endpoint := range endpoints {
+		certs, err := tb.fetchTrustDomainBundle(trustDomain, endpoint)
+		if err != nil {
+			trustBundleLog.Errorf("unable to fetch the bundle of trust domain %s from endpoint %s: %v", trustDomain, endpoint, err)
+			continue
+		}
+		fetched[trustDomain] = certs
+	}
+
+	changed := false
+	tb.federationMutex.Lock()
+	for trustDomain, certs := range fetched {
+		// The endpoints may have been updated while fetching.
+		if tb.federatedEndpoints[trustDomain] != endpoints[trustDomain] {
+			continue
+		}
+		if !isEqSliceStr(tb.federatedCerts[trustDomain], certs) {
+			trustBundleLog.Infof("updating the bundle of trust domain %s with %d trust anchors", trustDomain, len(certs))
+			tb.federatedCerts[trustDomain] = certs
+			changed = true
+		}
+	}
+	tb.federationMutex.Unlock()
+
+	if changed && tb.updatecb != nil {
+		tb.updatecb()
+	}
+}
+
+func (tb *TrustBundle) fetchTrustDomainBundle(trustDomain, endpoint string) ([]string, error) {
+	trustDomainAnchorMap, err := spiffe.RetrieveSpiffeBundleRootCerts(
+		map[string]string{trustDomain: endpoint}, tb.remoteCaCertPool, remoteTimeout)
+	if err != nil {
+		return nil, err
+	}
+	certs := []string{}
+	for _, cert := range trustDomainAnchorMap[trustDomain] {
+		certStr := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}))
+		if err := verifyTrustAnchor(certStr); err != nil {
+			return nil, fmt.Errorf("invalid trust anchor %v: %v", cert.Subject, err)
+		}
+		certs = append(certs, certStr)
+	}
+	sort.Strings(certs)
+	return certs, nil
+}
@@ -0,0 +1,74 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trustbundle
+
+import (
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"istio.io/istio/pkg/spiffe"
+)
+
+func TestFederatedTrustDomains(t *testing.T) {
+	bundle := validSpiffeX509Bundle
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/foo" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(bundle))
+	}))
+	defer server.Close()
+
+	caCertPool := x509.NewCertPool()
+	caCertPool.AddCert(server.Certificate())
+	tb := NewTrustBundle(caCertPool)
+	updates := 0
+	tb.UpdateCb(func() { updates++ })
+	remoteTimeout = 300 * time.Millisecond
+
+	tb.SetFederatedTrustDomains(map[string]string{
+		"foo.com":               server.Listener.Addr().String() + "/foo",
+		"bar.com":               server.Listener.Addr().String() + "/bar",
+		spiffe.GetTrustDomain(): server.Listener.Addr().String() + "/foo",
+	})
+	tb.fetchFederatedTrustAnchors()
+	bundles := tb.GetFederatedTrustBundles()
+	if len(bundles) != 1 || len(bundles["foo.com"]) != 1 || updates != 1 {
+		t.Fatalf("expected only the bundle of foo.com, got %v after %d updates", bundles, updates)
+	}
+	if err := verifyTrustAnchor(bundles["foo.com"][0]); err != nil {
+		t.Errorf("invalid trust anchor of foo.com: %v", err)
+	}
+	if len(tb.GetTrustBundle()) != 0 {
+		t.Errorf("expected the federated roots not to be trusted for the trust domain of the mesh")
+	}
+
+	// The bundle is not updated when it has not changed, or when the endpoint fails.
+	tb.fetchFederatedTrustAnchors()
+	bundle = "invalid"
+	tb.fetchFederatedTrustAnchors()
+	if bundles := tb.GetFederatedTrustBundles(); len(bundles["foo.com"]) != 1 || updates != 1 {
+		t.Errorf("expected the last bundle of foo.com to be kept, got %v after %d updates", bundles, updates)
+	}
+
+	tb.SetFederatedTrustDomains(map[string]string{})
+	if bundles := tb.GetFederatedTrustBundles(); len(bundles) != 0 || updates != 2 {
+		t.Errorf("expected the bundle of foo.com to be removed, got %v after %d updates", bundles, updates)
+	}
+}
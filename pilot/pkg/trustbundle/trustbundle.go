@@ -48,6 +48,12 @@ type TrustBundle struct {
 	endpoints          []string
 	endpointUpdateChan chan struct{}
 	remoteCaCertPool   *x509.CertPool
+
+	federationMutex sync.RWMutex
+	// federatedEndpoints are the SPIFFE bundle endpoints of the federated trust domains, keyed by trust domain.
+	federatedEndpoints map[string]string
+	// federatedCerts are the trust anchors of the federated trust domains, keyed by trust domain.
+	federatedCerts map[string][]string
 }
 
 var (
@@ -90,6 +96,8 @@ func NewTrustBundle(remoteCaCertPool *x509.CertPool) *TrustBundle {
 		updatecb:           nil,
 		endpointUpdateChan: make(chan struct{}, 1),
 		endpoints:          []string{},
+		federatedEndpoints: map[string]string{},
+		federatedCerts:     map[string][]string{},
 	}
 	if remoteCaCertPool == nil {
 		tb.remoteCaCertPool, err = x509.SystemCertPool()
@@ -269,11 +277,13 @@ func (tb *TrustBundle) ProcessRemoteTrustAnchors(stop <-chan struct{}, pollInter
 		case <-ticker.C:
 			trustBundleLog.Infof("waking up to perform periodic checks")
 			tb.fetchRemoteTrustAnchors()
+			tb.fetchFederatedTrustAnchors()
 		case <-stop:
 			trustBundleLog.Infof("stop processing endpoint trustAnchor pdates")
 			return
 		case <-tb.endpointUpdateChan:
 			tb.fetchRemoteTrustAnchors()
+			tb.fetchFederatedTrustAnchors()
 			trustBundleLog.Infof("processing endpoint trustAnchor Updates for config change")
 		}
 	}
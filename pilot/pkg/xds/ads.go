@@ -201,6 +201,7 @@ func (s *DiscoveryServer) receive(con *Connection, reqChannel chan *discovery.Di
 // handles 'push' requests and close - the code will eventually call the 'push' code, and it needs more mutex
 // protection. Original code avoided the mutexes by doing both 'push' and 'process requests' in same thread.
 func (s *DiscoveryServer) processRequest(req *discovery.DiscoveryRequest, con *Connection) error {
+	s.recorder.record(con, req)
 	if !s.preProcessRequest(con.proxy, req) {
 		return nil
 	}
@@ -516,6 +517,8 @@ func (s *DiscoveryServer) initConnection(node *core.Node, con *Connection) error
 	// context between initializeProxy and addCon, we would not get any pushes triggered for the new
 	// push context, leading the proxy to have a stale state until the next full push.
 	s.addCon(con.ConID, con)
+	// Start recording before the first request is processed, so the recording holds the complete stream.
+	s.recorder.openConnection(con)
 	// Register that initialization is complete. This triggers to calls that it is safe to access the
 	// proxy
 	defer close(con.initialized)
@@ -537,6 +540,7 @@ func (s *DiscoveryServer) closeConnection(con *Connection) {
 		return
 	}
 	s.removeCon(con.ConID)
+	s.recorder.closeConnection(con)
 	if s.StatusGen != nil {
 		s.StatusGen.OnDisconnect(con)
 	}
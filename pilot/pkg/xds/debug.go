@@ -38,6 +38,7 @@ import (
 	"istio.io/istio/pilot/pkg/serviceregistry"
 	"istio.io/istio/pilot/pkg/serviceregistry/aggregate"
 	"istio.io/istio/pilot/pkg/serviceregistry/memory"
+	"istio.io/istio/pilot/pkg/snapshot"
 	v3 "istio.io/istio/pilot/pkg/xds/v3"
 	"istio.io/istio/pkg/config"
 	"istio.io/istio/pkg/config/schema/collection"
@@ -176,8 +177,11 @@ func (s *DiscoveryServer) AddDebugHandlers(mux *http.ServeMux, enableProfiling b
 	s.addDebugHandler(mux, "/debug/registryz", "Debug support for registry", s.registryz)
 	s.addDebugHandler(mux, "/debug/endpointz", "Debug support for endpoints", s.endpointz)
 	s.addDebugHandler(mux, "/debug/endpointShardz", "Info about the endpoint shards", s.endpointShardz)
-	s.addDebugHandler(mux, "/debug/cachez", "Info about the internal XDS caches", s.cachez)
+	s.addDebugHandler(mux, "/debug/cachez", "Info about the internal XDS caches. Use ?sizes=true for the number of entries "+
+		"and bytes used by each type", s.cachez)
 	s.addDebugHandler(mux, "/debug/configz", "Debug support for config", s.configz)
+	s.addDebugHandler(mux, "/debug/snapshot", "Export the configs and services as a snapshot archive to start istiod from", s.exportSnapshot)
+	s.addDebugHandler(mux, "/debug/recordz", "Start (?proxyID=) or stop (?proxyID=&stop=true) recording the xDS streams of a proxy", s.recordz)
 	s.addDebugHandler(mux, "/debug/sidecarz", "Debug sidecar scope for a proxy", s.sidecarz)
 	s.addDebugHandler(mux, "/debug/resourcesz", "Debug support for watched resources", s.resourcez)
 	s.addDebugHandler(mux, "/debug/instancesz", "Debug support for service instances", s.instancesz)
@@ -186,6 +190,8 @@ func (s *DiscoveryServer) AddDebugHandlers(mux *http.ServeMux, enableProfiling b
 	s.addDebugHandler(mux, "/debug/telemetryz", "Debug Telemetry configuration", s.telemetryz)
 	s.addDebugHandler(mux, "/debug/config_dump", "ConfigDump in the form of the Envoy admin config dump API for passed in proxyID", s.ConfigDump)
 	s.addDebugHandler(mux, "/debug/push_status", "Last PushContext Details", s.PushStatusHandler)
+	s.addDebugHandler(mux, "/debug/push_history", "Recent pushes with the events that triggered them, "+
+		"and the resources triggering the most pushes (?top=)", s.pushHistoryz)
 	s.addDebugHandler(mux, "/debug/pushcontext", "Debug support for current push context", s.PushContextHandler)
 	s.addDebugHandler(mux, "/debug/connections", "Info about the connected XDS clients", s.ConnectionsHandler)
 
@@ -194,6 +200,16 @@ func (s *DiscoveryServer) AddDebugHandlers(mux *http.ServeMux, enableProfiling b
 	s.addDebugHandler(mux, "/debug/networkz", "List cross-network gateways", s.networkz)
 }
 
+// AddDebugHandler adds a debug handler served by the mux and listed by /debug, such as the handlers of
+// other istiod components.
+func (s *DiscoveryServer) AddDebugHandler(mux *http.ServeMux, path string, help string,
+	handler func(http.ResponseWriter, *http.Request)) {
+	if !features.EnableDebugOnHTTP {
+		return
+	}
+	s.addDebugHandler(mux, path, help, handler)
+}
+
 func (s *DiscoveryServer) addDebugHandler(mux *http.ServeMux, path string, help string,
 	handler func(http.ResponseWriter, *http.Request)) {
 	s.debugHandlers[path] = help
@@ -264,10 +280,19 @@ func (s *DiscoveryServer) endpointShardz(w http.ResponseWriter, req *http.Reques
 	_, _ = w.Write(out)
 }
 
+// cachez returns the keys of the XDS cache. If the sizes parameter is set, the number of entries and
+// bytes used by each type is returned instead.
 func (s *DiscoveryServer) cachez(w http.ResponseWriter, req *http.Request) {
-	keys := s.Cache.Keys()
-	sort.Strings(keys)
-	bytes, err := json.Marshal(keys)
+	_ = req.ParseForm()
+	var out interface{}
+	if req.Form.Get("sizes") != "" {
+		out = s.Cache.Stats()
+	} else {
+		keys := s.Cache.Keys()
+		sort.Strings(keys)
+		out = keys
+	}
+	bytes, err := json.Marshal(out)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		_, _ = fmt.Fprintf(w, "unable to marshal syncedVersion information: %v", err)
@@ -417,6 +442,22 @@ func (s *DiscoveryServer) configz(w http.ResponseWriter, req *http.Request) {
 	_, _ = w.Write(b)
 }
 
+// exportSnapshot writes a snapshot archive of the configs and services, which istiod, or a
+// FakeDiscoveryServer, can be started from.
+func (s *DiscoveryServer) exportSnapshot(w http.ResponseWriter, req *http.Request) {
+	snap, err := snapshot.Capture(s.Env)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte(err.Error()))
+		return
+	}
+	w.Header().Add("Content-Type", "application/gzip")
+	w.Header().Add("Content-Disposition", `attachment; filename="istiod-snapshot.json.gz"`)
+	if err := snap.Write(w); err != nil {
+		log.Warnf("failed to write snapshot: %v", err)
+	}
+}
+
 // SidecarScope debugging
 func (s *DiscoveryServer) sidecarz(w http.ResponseWriter, req *http.Request) {
 	proxyID := req.URL.Query().Get("proxyID")
@@ -17,6 +17,8 @@ package xds
 import (
 	"errors"
 	"fmt"
+	"hash/fnv"
+	"strconv"
 	"time"
 
 	cluster "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
@@ -27,6 +29,7 @@ import (
 	tls "github.com/envoyproxy/go-control-plane/envoy/extensions/transport_sockets/tls/v3"
 	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
 	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/ptypes/any"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
@@ -308,6 +311,7 @@ func (conn *Connection) sendDelta(res *discovery.DeltaDiscoveryResponse) error {
 // handles 'push' requests and close - the code will eventually call the 'push' code, and it needs more mutex
 // protection. Original code avoided the mutexes by doing both 'push' and 'process requests' in same thread.
 func (s *DiscoveryServer) processDeltaRequest(req *discovery.DeltaDiscoveryRequest, con *Connection) error {
+	s.recorder.record(con, req)
 	if !s.preProcessRequest(con.proxy, deltaToSotwRequest(req)) {
 		return nil
 	}
@@ -381,6 +385,9 @@ func (s *DiscoveryServer) shouldRespondDelta(con *Connection, request *discovery
 			TypeUrl:       request.TypeUrl,
 			ResourceNames: deltaWatchedResources(nil, request),
 			LastRequest:   deltaToSotwRequest(request),
+			// On reconnect, the client tells us the versions of the resources it already holds, so
+			// unchanged resources are not sent again.
+			ResourceVersions: initialResourceVersions(request),
 		}
 		con.proxy.Unlock()
 		return true
@@ -409,6 +416,10 @@ func (s *DiscoveryServer) shouldRespondDelta(con *Connection, request *discovery
 	con.proxy.WatchedResources[request.TypeUrl].NonceNacked = ""
 	con.proxy.WatchedResources[request.TypeUrl].ResourceNames = deltaWatchedResources(previousResources, request)
 	con.proxy.WatchedResources[request.TypeUrl].LastRequest = deltaToSotwRequest(request)
+	for _, name := range request.ResourceNamesUnsubscribe {
+		// The client drops unsubscribed resources, so they must be sent in full if subscribed again.
+		delete(con.proxy.WatchedResources[request.TypeUrl].ResourceVersions, name)
+	}
 	con.proxy.Unlock()
 
 	oldAck := listEqualUnordered(previousResources, con.proxy.WatchedResources[request.TypeUrl].ResourceNames)
@@ -447,7 +458,19 @@ func (s *DiscoveryServer) pushDeltaXds(con *Connection, push *model.PushContext,
 
 	t0 := time.Now()
 
-	res, err := gen.Generate(con.proxy, push, w, req)
+	var res model.DeltaResources
+	var deleted model.DeletedResources
+	var err error
+	usedDelta := false
+	if dgen, ok := gen.(model.XdsDeltaResourceGenerator); ok && subscribe == nil {
+		res, deleted, usedDelta, err = dgen.GenerateDeltas(con.proxy, push, req, w)
+	} else {
+		var sotwRes model.Resources
+		sotwRes, err = gen.Generate(con.proxy, push, w, req)
+		if sotwRes != nil {
+			res = convertResponseToDelta(sotwRes)
+		}
+	}
 	if err != nil || res == nil {
 		// If we have nothing to send, report that we got an ACK for this version.
 		if s.StatusReporter != nil {
@@ -457,47 +480,94 @@ func (s *DiscoveryServer) pushDeltaXds(con *Connection, push *model.PushContext,
 	}
 	defer func() { recordPushTime(w.TypeUrl, time.Since(t0)) }()
 
-	deltaResponse := convertResponseToDelta(currentVersion, res)
-	originalResponse := deltaResponse
+	con.proxy.RLock()
+	watched := sets.NewSet(w.ResourceNames...)
+	versions := make(map[string]string, len(w.ResourceVersions))
+	for name, version := range w.ResourceVersions {
+		versions[name] = version
+	}
+	con.proxy.RUnlock()
+
+	var removed []string
+	if usedDelta {
+		removed = deleted
+	} else {
+		// We take the set of watched resources and anything not in the response is sent as RemovedResources
+		// This is similar to SotW, but done on the server side instead of the client.
+		removed = watched.Difference(sets.NewSet(extractNames(res)...)).SortedList()
+	}
+
+	var subres sets.Set
 	if subscribe != nil {
 		// If subscribe is set, client is requesting specific resources. We should just give it the
 		// new resources it needs, rather than the entire set of known resources.
-		subres := sets.NewSet(subscribe...)
-		filteredResponse := []*discovery.Resource{}
-		for _, r := range deltaResponse {
-			if subres.Contains(r.Name) {
-				filteredResponse = append(filteredResponse, r)
-			} else {
-				log.Debugf("ADS:%v SKIP %v", v3.GetShortType(w.TypeUrl), r.Name)
-			}
+		subres = sets.NewSet(subscribe...)
+	}
+	deltaResponse := make([]*discovery.Resource, 0, len(res))
+	for _, r := range res {
+		if subres != nil && !subres.Contains(r.Name) {
+			log.Debugf("ADS:%v SKIP %v", v3.GetShortType(w.TypeUrl), r.Name)
+			continue
 		}
-		deltaResponse = filteredResponse
+		r.Version = resourceVersion(r.Resource)
+		// Resources the client already holds at this version are not sent again, unless explicitly requested.
+		if subres == nil && versions[r.Name] == r.Version {
+			continue
+		}
+		deltaResponse = append(deltaResponse, r)
 	}
+
 	resp := &discovery.DeltaDiscoveryResponse{
 		TypeUrl:           w.TypeUrl,
 		SystemVersionInfo: currentVersion,
 		Nonce:             nonce(push.LedgerVersion),
 		Resources:         deltaResponse,
+		RemovedResources:  removed,
 	}
-	// We take the set of watched resources and anything not in the response is sent as RemovedResources
-	// This is similar to SotW, but done on the server side instead of the client.
-	cur := sets.NewSet(w.ResourceNames...)
-	cur.Delete(extractNames(originalResponse)...)
-	resp.RemovedResources = cur.SortedList()
 	if len(resp.RemovedResources) > 0 {
 		log.Infof("ADS:%v REMOVE %v", v3.GetShortType(w.TypeUrl), resp.RemovedResources)
 	}
 	if isWildcardTypeURL(w.TypeUrl) {
 		// this is probably a bad idea...
+		names := extractNames(res)
+		if usedDelta {
+			// Only the changed resources were generated, the other watched resources are unchanged.
+			watched.Delete(removed...)
+			watched.Insert(names...)
+			names = watched.SortedList()
+		}
 		con.proxy.Lock()
-		w.ResourceNames = extractNames(originalResponse)
+		w.ResourceNames = names
 		con.proxy.Unlock()
 	}
 
+	if len(resp.Resources) == 0 && len(resp.RemovedResources) == 0 && subscribe == nil && len(req.ConfigsUpdated) > 0 {
+		// Nothing changed for this client. Requests from the client (without ConfigsUpdated) are always answered,
+		// as the client waits for a response.
+		log.Debugf("%s: SKIP for node:%s, no changed resources", v3.GetShortType(w.TypeUrl), con.proxy.ID)
+		if s.StatusReporter != nil {
+			s.StatusReporter.RegisterEvent(con.ConID, w.TypeUrl, push.LedgerVersion)
+		}
+		return nil
+	}
+
 	if err := con.sendDelta(resp); err != nil {
 		recordSendError(w.TypeUrl, con.ConID, err)
 		return err
 	}
+	s.recorder.record(con, resp)
+
+	con.proxy.Lock()
+	if w.ResourceVersions == nil {
+		w.ResourceVersions = map[string]string{}
+	}
+	for _, r := range resp.Resources {
+		w.ResourceVersions[r.Name] = r.Version
+	}
+	for _, name := range resp.RemovedResources {
+		delete(w.ResourceVersions, name)
+	}
+	con.proxy.Unlock()
 
 	// Some types handle logs inside Generate, skip them here
 	// TODO because we filter out after the fact, SkipLogTypes report wrong info
@@ -505,16 +575,35 @@ func (s *DiscoveryServer) pushDeltaXds(con *Connection, push *model.PushContext,
 	if _, f := SkipLogTypes[w.TypeUrl]; !f {
 		if log.DebugEnabled() {
 			// Add additional information to logs when debug mode enabled
-			log.Infof("%s: PUSH for node:%s resources:%d size:%s nonce:%v version:%v",
-				v3.GetShortType(w.TypeUrl), con.proxy.ID, len(res), util.ByteCount(ResourceSize(res)), resp.Nonce, resp.SystemVersionInfo)
+			log.Infof("%s: PUSH for node:%s resources:%d unchanged:%d delta:%v size:%s nonce:%v version:%v",
+				v3.GetShortType(w.TypeUrl), con.proxy.ID, len(resp.Resources), len(res)-len(resp.Resources), usedDelta,
+				util.ByteCount(deltaResourceSize(resp.Resources)), resp.Nonce, resp.SystemVersionInfo)
 		} else {
-			log.Infof("%s: PUSH for node:%s resources:%d size:%s",
-				v3.GetShortType(w.TypeUrl), con.proxy.ID, len(res), util.ByteCount(ResourceSize(res)))
+			log.Infof("%s: PUSH for node:%s resources:%d unchanged:%d size:%s",
+				v3.GetShortType(w.TypeUrl), con.proxy.ID, len(resp.Resources), len(res)-len(resp.Resources),
+				util.ByteCount(deltaResourceSize(resp.Resources)))
 		}
 	}
 	return nil
 }
 
+// resourceVersion returns a version identifying the content of a resource. Resources are marshaled
+// deterministically, so the same resource always has the same version.
+func resourceVersion(r *any.Any) string {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(r.GetTypeUrl()))
+	_, _ = h.Write(r.GetValue())
+	return strconv.FormatUint(h.Sum64(), 16)
+}
+
+func deltaResourceSize(r []*discovery.Resource) int {
+	size := 0
+	for _, res := range r {
+		size += len(res.Resource.GetValue())
+	}
+	return size
+}
+
 func newDeltaConnection(peerAddr string, stream DeltaDiscoveryStream) *Connection {
 	return &Connection{
 		pushChannel:   make(chan *Event),
@@ -527,9 +616,8 @@ func newDeltaConnection(peerAddr string, stream DeltaDiscoveryStream) *Connectio
 	}
 }
 
-// just for experimentation
-// TODO: make generator return discovery.Resource; then we don't need to introspect the name
-func convertResponseToDelta(ver string, resources model.Resources) []*discovery.Resource {
+// convertResponseToDelta names the resources generated by generators which do not support Delta XDS.
+func convertResponseToDelta(resources model.Resources) []*discovery.Resource {
 	convert := []*discovery.Resource{}
 	for _, r := range resources {
 		var name string
@@ -561,7 +649,6 @@ func convertResponseToDelta(ver string, resources model.Resources) []*discovery.
 		}
 		c := &discovery.Resource{
 			Name:     name,
-			Version:  ver,
 			Resource: r,
 		}
 		convert = append(convert, c)
@@ -580,6 +667,14 @@ func deltaToSotwRequest(request *discovery.DeltaDiscoveryRequest) *discovery.Dis
 	}
 }
 
+func initialResourceVersions(request *discovery.DeltaDiscoveryRequest) map[string]string {
+	versions := make(map[string]string, len(request.InitialResourceVersions))
+	for name, version := range request.InitialResourceVersions {
+		versions[name] = version
+	}
+	return versions
+}
+
 func deltaWatchedResources(existing []string, request *discovery.DeltaDiscoveryRequest) []string {
 	res := sets.NewSet(existing...)
 	res.Insert(request.ResourceNamesSubscribe...)
@@ -20,8 +20,12 @@ import (
 
 	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
 
+	"istio.io/istio/pilot/pkg/model"
 	v3 "istio.io/istio/pilot/pkg/xds/v3"
 	"istio.io/istio/pilot/test/xdstest"
+	"istio.io/istio/pkg/config/host"
+	"istio.io/istio/pkg/config/protocol"
+	"istio.io/istio/pkg/config/schema/gvk"
 	"istio.io/istio/tests/util/leak"
 )
 
@@ -54,6 +58,89 @@ func TestDeltaAdsClusterUpdate(t *testing.T) {
 	sendEDSReqAndVerify([]string{"outbound|80||local.default.svc.cluster.local"}, nil, []string{"outbound|80||local.default.svc.cluster.local"})
 	// Only send the one that is requested
 	sendEDSReqAndVerify([]string{"outbound|81||local.default.svc.cluster.local"}, nil, []string{"outbound|81||local.default.svc.cluster.local"})
-	// TODO: should we just respond with nothing here? Probably...
-	sendEDSReqAndVerify(nil, []string{"outbound|81||local.default.svc.cluster.local"}, []string{"outbound|80||local.default.svc.cluster.local"})
+	// The remaining cluster is unchanged, so it is not sent again
+	ads.Request(&discovery.DeltaDiscoveryRequest{
+		ResourceNamesUnsubscribe: []string{"outbound|81||local.default.svc.cluster.local"},
+		ResponseNonce:            nonce,
+	})
+	ads.ExpectEmptyResponse()
+}
+
+func TestDeltaAdsIncrementalClusters(t *testing.T) {
+	s := NewFakeDiscoveryServer(t, FakeOptions{})
+	ads := s.ConnectDeltaADS().WithType(v3.ClusterType)
+	initial := ads.RequestResponseAck(nil)
+	if len(initial.Resources) == 0 {
+		t.Fatalf("expected initial clusters")
+	}
+
+	serviceUpdate := func(hostname string) {
+		s.Discovery.ConfigUpdate(&model.PushRequest{Full: true, ConfigsUpdated: map[model.ConfigKey]struct{}{
+			{Kind: gvk.ServiceEntry, Name: hostname, Namespace: "default"}: {},
+		}})
+	}
+	addService := func(hostname string, port int) {
+		s.Discovery.MemRegistry.AddService(host.Name(hostname), &model.Service{
+			Hostname: host.Name(hostname),
+			Address:  "10.11.0.1",
+			Ports: []*model.Port{{
+				Name:     "http-main",
+				Port:     port,
+				Protocol: protocol.HTTP,
+			}},
+			Attributes: model.ServiceAttributes{Namespace: "default"},
+		})
+		serviceUpdate(hostname)
+	}
+
+	// Only the clusters of the new service are sent
+	addService("delta.default.svc.cluster.local", 8080)
+	resp := ads.ExpectResponse()
+	if got := extractNames(resp.Resources); !reflect.DeepEqual(got, []string{"outbound|8080||delta.default.svc.cluster.local"}) {
+		t.Fatalf("expected only the new cluster, got %v", got)
+	}
+	if len(resp.RemovedResources) != 0 {
+		t.Fatalf("expected no removed clusters, got %v", resp.RemovedResources)
+	}
+
+	// A push for a service which did not change sends nothing
+	serviceUpdate("delta.default.svc.cluster.local")
+	ads.ExpectNoResponse()
+
+	// Changing the port removes the old cluster
+	addService("delta.default.svc.cluster.local", 9090)
+	resp = ads.ExpectResponse()
+	if got := extractNames(resp.Resources); !reflect.DeepEqual(got, []string{"outbound|9090||delta.default.svc.cluster.local"}) {
+		t.Fatalf("expected only the updated cluster, got %v", got)
+	}
+	if !reflect.DeepEqual(resp.RemovedResources, []string{"outbound|8080||delta.default.svc.cluster.local"}) {
+		t.Fatalf("expected old cluster to be removed, got %v", resp.RemovedResources)
+	}
+
+	// Removing the service removes its clusters
+	s.Discovery.MemRegistry.RemoveService("delta.default.svc.cluster.local")
+	serviceUpdate("delta.default.svc.cluster.local")
+	resp = ads.ExpectResponse()
+	if len(resp.Resources) != 0 {
+		t.Fatalf("expected no clusters, got %v", extractNames(resp.Resources))
+	}
+	if !reflect.DeepEqual(resp.RemovedResources, []string{"outbound|9090||delta.default.svc.cluster.local"}) {
+		t.Fatalf("expected cluster to be removed, got %v", resp.RemovedResources)
+	}
+}
+
+func TestDeltaAdsInitialResourceVersions(t *testing.T) {
+	s := NewFakeDiscoveryServer(t, FakeOptions{})
+	ads := s.ConnectDeltaADS().WithType(v3.ClusterType)
+	initial := ads.RequestResponseAck(nil)
+	ads.Cleanup()
+
+	// Reconnecting with the versions of the clusters we hold, nothing is sent again.
+	versions := map[string]string{}
+	for _, r := range initial.Resources {
+		versions[r.Name] = r.Version
+	}
+	ads = s.ConnectDeltaADS().WithType(v3.ClusterType)
+	ads.Request(&discovery.DeltaDiscoveryRequest{InitialResourceVersions: versions})
+	ads.ExpectEmptyResponse()
 }
@@ -138,7 +138,7 @@ func (a *DeltaAdsTest) ExpectResponse() *discovery.DeltaDiscoveryResponse {
 	case <-time.After(a.timeout):
 		a.t.Fatalf("did not get response in time")
 	case resp := <-a.responses:
-		if resp == nil || len(resp.Resources) == 0 {
+		if resp == nil || (len(resp.Resources) == 0 && len(resp.RemovedResources) == 0) {
 			a.t.Fatalf("got empty response")
 		}
 		return resp
@@ -148,6 +148,25 @@ func (a *DeltaAdsTest) ExpectResponse() *discovery.DeltaDiscoveryResponse {
 	return nil
 }
 
+// ExpectEmptyResponse waits until a response is received and ensures it contains no changes
+func (a *DeltaAdsTest) ExpectEmptyResponse() {
+	a.t.Helper()
+	select {
+	case <-time.After(a.timeout):
+		a.t.Fatalf("did not get response in time")
+	case resp := <-a.responses:
+		if resp == nil {
+			a.t.Fatalf("got nil response")
+		}
+		if len(resp.Resources) != 0 || len(resp.RemovedResources) != 0 {
+			a.t.Fatalf("expected empty response, got resources %v and removed resources %v",
+				extractNames(resp.Resources), resp.RemovedResources)
+		}
+	case err := <-a.error:
+		a.t.Fatalf("got error: %v", err)
+	}
+}
+
 // ExpectError waits until an error is received and returns it
 func (a *DeltaAdsTest) ExpectError() error {
 	a.t.Helper()
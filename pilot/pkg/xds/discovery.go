@@ -17,6 +17,7 @@ package xds
 import (
 	"context"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -146,6 +147,12 @@ type DiscoveryServer struct {
 	// Cache for XDS resources
 	Cache model.XdsCache
 
+	// recorder records the xDS streams of selected proxies. It is nil if recording is disabled.
+	recorder *streamRecorder
+
+	// pushHistory keeps the recent pushes and the events that triggered them, for debugging.
+	pushHistory *pushHistory
+
 	// JwtKeyResolver holds a reference to the JWT key resolver instance.
 	JwtKeyResolver *model.JwksResolver
 }
@@ -182,7 +189,6 @@ func NewDiscoveryServer(env *model.Environment, plugins []string, instanceID str
 		InboundUpdates:          atomic.NewInt64(0),
 		CommittedUpdates:        atomic.NewInt64(0),
 		pushChannel:             make(chan *model.PushRequest, 10),
-		pushQueue:               NewPushQueue(),
 		debugHandlers:           map[string]string{},
 		adsClients:              map[string]*Connection{},
 		debounceOptions: debounceOptions{
@@ -190,10 +196,13 @@ func NewDiscoveryServer(env *model.Environment, plugins []string, instanceID str
 			debounceMax:       features.DebounceMax,
 			enableEDSDebounce: features.EnableEDSDebounce.Get(),
 		},
-		Cache:      model.DisabledCache{},
-		instanceID: instanceID,
+		Cache:       model.DisabledCache{},
+		instanceID:  instanceID,
+		pushHistory: newPushHistory(features.PushHistorySize),
 	}
 
+	out.pushQueue = NewPriorityPushQueue(out.pushPriority)
+
 	out.initJwksResolver()
 
 	out.initGenerators(env, systemNameSpace)
@@ -204,6 +213,10 @@ func NewDiscoveryServer(env *model.Environment, plugins []string, instanceID str
 
 	out.ConfigGenerator = core.NewConfigGenerator(plugins, out.Cache)
 
+	if features.XDSRecordingDir != "" {
+		out.recorder = newStreamRecorder(features.XDSRecordingDir, strings.Split(features.XDSRecordProxies, ","))
+	}
+
 	return out
 }
 
@@ -306,6 +319,7 @@ func (s *DiscoveryServer) periodicRefreshMetrics(stopCh <-chan struct{}) {
 func (s *DiscoveryServer) Push(req *model.PushRequest) {
 	if !req.Full {
 		req.Push = s.globalPushContext()
+		s.pushHistory.addPush(versionInfo(), req)
 		s.AdsPushAll(versionInfo(), req)
 		return
 	}
@@ -332,6 +346,7 @@ func (s *DiscoveryServer) Push(req *model.PushRequest) {
 	versionMutex.Unlock()
 
 	req.Push = push
+	s.pushHistory.addPush(versionLocal, req)
 	s.AdsPushAll(versionLocal, req)
 }
 
@@ -357,6 +372,7 @@ func (s *DiscoveryServer) globalPushContext() *model.PushContext {
 func (s *DiscoveryServer) ConfigUpdate(req *model.PushRequest) {
 	inboundConfigUpdates.Increment()
 	s.InboundUpdates.Inc()
+	s.pushHistory.addTrigger(req.Traced(""))
 	s.pushChannel <- req
 }
 
@@ -518,6 +534,19 @@ func (s *DiscoveryServer) initPushContext(req *model.PushRequest, oldPushContext
 	return push, nil
 }
 
+// pushPriority classifies a push to a connection. Endpoint only updates are pushed first, so endpoint churn
+// propagates quickly even when a large config change causes full pushes to all proxies. Gateways are pushed
+// before sidecars, as they usually serve traffic for many workloads.
+func (s *DiscoveryServer) pushPriority(con *Connection, req *model.PushRequest) PushPriority {
+	if !req.Full {
+		return PriorityEndpoint
+	}
+	if con.proxy != nil && con.proxy.Type == model.Router {
+		return PriorityGateway
+	}
+	return PrioritySidecar
+}
+
 func (s *DiscoveryServer) sendPushes(stopCh <-chan struct{}) {
 	doSendPushes(stopCh, s.concurrentPushLimit, s.pushQueue)
 }
@@ -482,3 +482,27 @@ func TestShouldRespond(t *testing.T) {
 		})
 	}
 }
+
+func TestPushPriority(t *testing.T) {
+	s := &DiscoveryServer{}
+	sidecar := &Connection{proxy: &model.Proxy{Type: model.SidecarProxy}}
+	gateway := &Connection{proxy: &model.Proxy{Type: model.Router}}
+	tests := []struct {
+		name       string
+		connection *Connection
+		request    *model.PushRequest
+		want       PushPriority
+	}{
+		{"sidecar incremental", sidecar, &model.PushRequest{Full: false}, PriorityEndpoint},
+		{"gateway incremental", gateway, &model.PushRequest{Full: false}, PriorityEndpoint},
+		{"gateway full", gateway, &model.PushRequest{Full: true}, PriorityGateway},
+		{"sidecar full", sidecar, &model.PushRequest{Full: true}, PrioritySidecar},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := s.pushPriority(tt.connection, tt.request); got != tt.want {
+				t.Fatalf("got priority %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
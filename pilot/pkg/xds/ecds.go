@@ -15,14 +15,26 @@
 package xds
 
 import (
+	udpa "github.com/cncf/udpa/go/udpa/type/v1"
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	wasm "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/wasm/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/conversion"
+	"github.com/golang/protobuf/ptypes"
+
 	"istio.io/istio/pilot/pkg/model"
 	"istio.io/istio/pilot/pkg/networking/util"
+	"istio.io/istio/pilot/pkg/secrets"
+	"istio.io/istio/pkg/config/constants"
 	"istio.io/istio/pkg/config/schema/gvk"
 )
 
+const wasmHTTPFilterType = "type.googleapis.com/envoy.extensions.filters.http.wasm.v3.Wasm"
+
 // EcdsGenerator generates ECDS configuration.
 type EcdsGenerator struct {
 	Server *DiscoveryServer
+	// SecretController resolves the image pull secrets of Wasm modules. If nil, pull secrets are not resolved.
+	SecretController secrets.MulticlusterController
 }
 
 var _ model.XdsResourceGenerator = &EcdsGenerator{}
@@ -60,7 +72,65 @@ func (e *EcdsGenerator) Generate(proxy *model.Proxy, push *model.PushContext, w
 
 	resources := make(model.Resources, 0, len(ec))
 	for _, c := range ec {
+		e.resolveImagePullSecret(proxy, c)
 		resources = append(resources, util.MessageToAny(c))
 	}
 	return resources, nil
 }
+
+// resolveImagePullSecret replaces the name of the image pull secret of a Wasm filter with the content of the secret,
+// which the agent uses to pull the module. As for SDS, the secret must be in the namespace of the proxy, and the proxy
+// must be authorized to read secrets. Secret changes are picked up on the next ECDS push.
+func (e *EcdsGenerator) resolveImagePullSecret(proxy *model.Proxy, ec *core.TypedExtensionConfig) {
+	ts := &udpa.TypedStruct{}
+	// nolint: staticcheck
+	if err := ptypes.UnmarshalAny(ec.GetTypedConfig(), ts); err != nil || ts.TypeUrl != wasmHTTPFilterType {
+		return
+	}
+	wasmFilter := &wasm.Wasm{}
+	if err := conversion.StructToMessage(ts.Value, wasmFilter); err != nil {
+		return
+	}
+	envs := wasmFilter.GetConfig().GetVmConfig().GetEnvironmentVariables()
+	name, ok := envs.GetKeyValues()[constants.WasmImagePullSecretNameEnv]
+	if !ok {
+		return
+	}
+	delete(envs.KeyValues, constants.WasmImagePullSecretNameEnv)
+	if cred := e.dockerCredential(proxy, name); cred != nil {
+		envs.KeyValues[constants.WasmImagePullSecretEnv] = string(cred)
+	}
+	value, err := conversion.MessageToStruct(wasmFilter)
+	if err != nil {
+		log.Warnf("failed to convert Wasm filter %v: %v", ec.GetName(), err)
+		return
+	}
+	ts.Value = value
+	ec.TypedConfig = util.MessageToAny(ts)
+}
+
+func (e *EcdsGenerator) dockerCredential(proxy *model.Proxy, name string) []byte {
+	if e.SecretController == nil {
+		log.Warnf("cannot resolve image pull secret %s for proxy %v: secrets are not available", name, proxy.ID)
+		return nil
+	}
+	if proxy.VerifiedIdentity == nil {
+		log.Warnf("proxy %v is not authorized to receive image pull secret %s. "+
+			"Ensure you are connecting over TLS port and are authenticated.", proxy.ID, name)
+		return nil
+	}
+	secrets, err := e.SecretController.ForCluster(proxy.Metadata.ClusterID)
+	if err != nil {
+		log.Warnf("proxy %v is from an unknown cluster, cannot retrieve image pull secret %s: %v", proxy.ID, name, err)
+		return nil
+	}
+	if err := secrets.Authorize(proxy.VerifiedIdentity.ServiceAccount, proxy.VerifiedIdentity.Namespace); err != nil {
+		log.Warnf("proxy %v is not authorized to receive image pull secret %s: %v", proxy.ID, name, err)
+		return nil
+	}
+	cred := secrets.GetDockerCredential(name, proxy.ConfigNamespace)
+	if cred == nil {
+		log.Warnf("image pull secret %s/%s for proxy %v not found", proxy.ConfigNamespace, name, proxy.ID)
+	}
+	return cred
+}
@@ -16,11 +16,24 @@ package xds_test
 import (
 	"testing"
 
+	udpa "github.com/cncf/udpa/go/udpa/type/v1"
 	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	wasm "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/wasm/v3"
 	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/conversion"
+	"github.com/golang/protobuf/ptypes"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
 
+	"istio.io/istio/pilot/pkg/model"
+	kubesecrets "istio.io/istio/pilot/pkg/secrets/kube"
 	"istio.io/istio/pilot/pkg/xds"
 	v3 "istio.io/istio/pilot/pkg/xds/v3"
+	"istio.io/istio/pkg/config/constants"
+	"istio.io/istio/pkg/kube"
+	"istio.io/istio/pkg/spiffe"
 )
 
 func TestECDS(t *testing.T) {
@@ -47,3 +60,98 @@ func TestECDS(t *testing.T) {
 		t.Errorf("extension config name got %v want %v", ec.Name, wantExtensionConfigName)
 	}
 }
+
+const ecdsPullSecretConfig = `apiVersion: networking.istio.io/v1alpha3
+kind: EnvoyFilter
+metadata:
+  name: test
+  namespace: istio-system
+spec:
+  configPatches:
+  - applyTo: EXTENSION_CONFIG
+    patch:
+      operation: ADD
+      value:
+        name: extension-config
+        typed_config:
+          "@type": type.googleapis.com/udpa.type.v1.TypedStruct
+          type_url: type.googleapis.com/envoy.extensions.filters.http.wasm.v3.Wasm
+          value:
+            config:
+              vm_config:
+                environment_variables:
+                  key_values:
+                    ISTIO_META_WASM_IMAGE_PULL_SECRET_NAME: pull
+                code:
+                  remote:
+                    http_uri:
+                      uri: oci://registry.example.com/plugin
+`
+
+func TestECDSImagePullSecret(t *testing.T) {
+	pullSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "pull", Namespace: "default"},
+		Type:       corev1.SecretTypeDockerConfigJson,
+		Data:       map[string][]byte{corev1.DockerConfigJsonKey: []byte(`{"auths":{}}`)},
+	}
+	s := xds.NewFakeDiscoveryServer(t, xds.FakeOptions{
+		ConfigString:      ecdsPullSecretConfig,
+		KubernetesObjects: []runtime.Object{pullSecret},
+		KubeClientModifier: func(c kube.Client) {
+			kubesecrets.DisableAuthorizationForTest(c.Kube().(*fake.Clientset))
+		},
+	})
+	gen := s.Discovery.Generators[v3.ExtensionConfigurationType]
+
+	cases := []struct {
+		name   string
+		proxy  *model.Proxy
+		secret string
+	}{
+		{
+			name:   "authorized",
+			proxy:  &model.Proxy{VerifiedIdentity: &spiffe.Identity{Namespace: "default"}, ConfigNamespace: "default"},
+			secret: `{"auths":{}}`,
+		},
+		{
+			name:  "unauthenticated",
+			proxy: &model.Proxy{ConfigNamespace: "default"},
+		},
+		{
+			name:  "other namespace",
+			proxy: &model.Proxy{VerifiedIdentity: &spiffe.Identity{Namespace: "other"}, ConfigNamespace: "other"},
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := gen.Generate(s.SetupProxy(tt.proxy), s.PushContext(),
+				&model.WatchedResource{ResourceNames: []string{"extension-config"}}, &model.PushRequest{Full: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(res) != 1 {
+				t.Fatalf("expected a single extension config, got %v", res)
+			}
+			ec := &corev3.TypedExtensionConfig{}
+			if err := res[0].UnmarshalTo(ec); err != nil {
+				t.Fatal(err)
+			}
+			ts := &udpa.TypedStruct{}
+			// nolint: staticcheck
+			if err := ptypes.UnmarshalAny(ec.GetTypedConfig(), ts); err != nil {
+				t.Fatal(err)
+			}
+			wasmFilter := &wasm.Wasm{}
+			if err := conversion.StructToMessage(ts.Value, wasmFilter); err != nil {
+				t.Fatal(err)
+			}
+			envs := wasmFilter.GetConfig().GetVmConfig().GetEnvironmentVariables().GetKeyValues()
+			if _, ok := envs[constants.WasmImagePullSecretNameEnv]; ok {
+				t.Errorf("the secret name must not be forwarded: %v", envs)
+			}
+			if got := envs[constants.WasmImagePullSecretEnv]; got != tt.secret {
+				t.Errorf("got pull secret %q, want %q", got, tt.secret)
+			}
+		})
+	}
+}
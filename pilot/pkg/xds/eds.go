@@ -96,7 +96,7 @@ func (s *DiscoveryServer) EDSUpdate(clusterID, serviceName string, namespace str
 	// Update the endpoint shards
 	fp := s.edsCacheUpdate(clusterID, serviceName, namespace, istioEndpoints)
 	// Trigger a push
-	s.ConfigUpdate(&model.PushRequest{
+	pushReq := &model.PushRequest{
 		Full: fp,
 		ConfigsUpdated: map[model.ConfigKey]struct{}{{
 			Kind:      gvk.ServiceEntry,
@@ -104,7 +104,8 @@ func (s *DiscoveryServer) EDSUpdate(clusterID, serviceName string, namespace str
 			Namespace: namespace,
 		}: {}},
 		Reason: []model.TriggerReason{model.EndpointUpdate},
-	})
+	}
+	s.ConfigUpdate(pushReq.Traced("registry/" + clusterID))
 }
 
 // EDSCacheUpdate computes destination address membership across all clusters and networks.
@@ -331,7 +332,7 @@ type EdsGenerator struct {
 	Server *DiscoveryServer
 }
 
-var _ model.XdsResourceGenerator = &EdsGenerator{}
+var _ model.XdsDeltaResourceGenerator = &EdsGenerator{}
 
 // Map of all configs that do not impact EDS
 var skippedEdsConfigs = map[config.GroupVersionKind]struct{}{
@@ -408,6 +409,17 @@ func (eds *EdsGenerator) Generate(proxy *model.Proxy, push *model.PushContext, w
 	return resources, nil
 }
 
+// GenerateDeltas generates the endpoints of the updated services on incremental pushes. The endpoints of other
+// clusters are unchanged, so unlike full pushes, clusters missing from the response are not removed.
+func (eds *EdsGenerator) GenerateDeltas(proxy *model.Proxy, push *model.PushContext, req *model.PushRequest,
+	w *model.WatchedResource) (model.DeltaResources, model.DeletedResources, bool, error) {
+	resources, err := eds.Generate(proxy, push, w, req)
+	if err != nil || resources == nil {
+		return nil, nil, false, err
+	}
+	return convertResponseToDelta(resources), nil, !req.Full, nil
+}
+
 func getOutlierDetectionAndLoadBalancerSettings(
 	destinationRule *networkingapi.DestinationRule,
 	portNumber int,
@@ -39,6 +39,8 @@ import (
 	kubesecrets "istio.io/istio/pilot/pkg/secrets/kube"
 	"istio.io/istio/pilot/pkg/serviceregistry"
 	kube "istio.io/istio/pilot/pkg/serviceregistry/kube/controller"
+	"istio.io/istio/pilot/pkg/snapshot"
+	"istio.io/istio/pilot/pkg/xds/recording"
 	v3 "istio.io/istio/pilot/pkg/xds/v3"
 	"istio.io/istio/pilot/test/xdstest"
 	"istio.io/istio/pkg/adsc"
@@ -82,6 +84,10 @@ type FakeOptions struct {
 
 	// EnableFakeXDSUpdater will use a XDSUpdater that can be used to watch events
 	EnableFakeXDSUpdater bool
+
+	// If provided, the configs and services of the snapshot will be used, in addition to the other
+	// configs and objects. The mesh config and networks of the snapshot are used unless provided.
+	Snapshot *snapshot.Snapshot
 }
 
 type FakeDiscoveryServer struct {
@@ -100,6 +106,16 @@ func NewFakeDiscoveryServer(t test.Failer, opts FakeOptions) *FakeDiscoveryServe
 		close(stop)
 	})
 
+	if opts.Snapshot != nil {
+		if opts.MeshConfig == nil {
+			opts.MeshConfig = opts.Snapshot.MeshConfig
+		}
+		if opts.NetworksWatcher == nil && opts.Snapshot.MeshNetworks != nil {
+			opts.NetworksWatcher = mesh.NewFixedNetworksWatcher(opts.Snapshot.MeshNetworks)
+		}
+		opts.Configs = append(append([]config.Config{}, opts.Configs...), opts.Snapshot.Configs...)
+	}
+
 	m := opts.MeshConfig
 	if m == nil {
 		def := mesh.DefaultMeshConfig()
@@ -174,8 +190,15 @@ func NewFakeDiscoveryServer(t test.Failer, opts FakeOptions) *FakeDiscoveryServe
 		registries = append(registries, k8s)
 	}
 
+	var snapshotRegistry *snapshot.Registry
+	if opts.Snapshot != nil {
+		snapshotRegistry = snapshot.NewRegistry(opts.Snapshot, string(serviceregistry.Snapshot), xdsUpdater)
+		registries = append(registries, snapshotRegistry)
+	}
+
 	sc := kubesecrets.NewMulticluster(defaultKubeClient, "", "", stop)
 	s.Generators[v3.SecretType] = NewSecretGen(sc, s.Cache)
+	s.Generators[v3.ExtensionConfigurationType] = &EcdsGenerator{Server: s, SecretController: sc}
 	defaultKubeClient.RunAndWait(stop)
 
 	ingr := ingress.NewController(defaultKubeClient, mesh.NewFixedWatcher(m), kube.Options{
@@ -268,6 +291,10 @@ func NewFakeDiscoveryServer(t test.Failer, opts FakeOptions) *FakeDiscoveryServe
 		cg.Registry.HasSynced,
 		cg.Store().HasSynced)
 	cg.ServiceEntryRegistry.ResyncEDS()
+	if snapshotRegistry != nil {
+		// the registries are not run, push the endpoints of the snapshot
+		snapshotRegistry.ResyncEDS()
+	}
 
 	// Send an update. This ensures that even if there are no configs provided, the push context is
 	// initialized.
@@ -330,6 +357,22 @@ func (f *FakeDiscoveryServer) ConnectDeltaADS() *DeltaAdsTest {
 	return NewDeltaAdsTest(f.t, conn)
 }
 
+// Replay sends the requests of a recording to the server, and returns the resulting stream. See recording.Replay.
+func (f *FakeDiscoveryServer) Replay(entries []recording.Entry, wait time.Duration) []recording.Entry {
+	conn, err := grpc.Dial("buffcon", grpc.WithInsecure(), grpc.WithBlock(), grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+		return f.Listener.Dial()
+	}))
+	if err != nil {
+		f.t.Fatalf("failed to connect: %v", err)
+	}
+	defer conn.Close()
+	out, err := recording.Replay(context.Background(), conn, entries, wait)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	return out
+}
+
 // Connect starts an ADS connection to the server using adsc. It will automatically be cleaned up when the test ends
 // watch can be configured to determine the resources to watch initially, and wait can be configured to determine what
 // resources we should initially wait for.
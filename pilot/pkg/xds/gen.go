@@ -122,6 +122,7 @@ func (s *DiscoveryServer) pushXds(con *Connection, push *model.PushContext,
 		recordSendError(w.TypeUrl, con.ConID, err)
 		return err
 	}
+	s.recorder.record(con, resp)
 
 	// Some types handle logs inside Generate, skip them here
 	if _, f := SkipLogTypes[w.TypeUrl]; !f {
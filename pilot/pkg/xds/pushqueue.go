@@ -20,6 +20,42 @@ import (
 	"istio.io/istio/pilot/pkg/model"
 )
 
+// PushPriority is the class of a push in the PushQueue. Lower values are dequeued first.
+type PushPriority int
+
+const (
+	// PriorityEndpoint is used for incremental pushes, which only update endpoints. These are small, and delaying
+	// them means traffic keeps being sent to endpoints that are gone, so they are never queued behind full pushes.
+	PriorityEndpoint PushPriority = iota
+	// PriorityGateway is used for full pushes to gateways, which typically serve traffic for many workloads.
+	PriorityGateway
+	// PrioritySidecar is used for all other pushes.
+	PrioritySidecar
+
+	numPushPriorities = int(PrioritySidecar) + 1
+)
+
+func (p PushPriority) String() string {
+	switch p {
+	case PriorityEndpoint:
+		return "endpoint"
+	case PriorityGateway:
+		return "gateway"
+	case PrioritySidecar:
+		return "sidecar"
+	default:
+		return "unknown"
+	}
+}
+
+// maxPushStarvation is the number of times a non-empty priority class may be passed over in favor of a higher
+// priority class before one of its connections is dequeued. This bounds the delay of low priority pushes when
+// higher priority pushes are continuously enqueued.
+const maxPushStarvation = 10
+
+// PushClassifier determines the priority of a push to a connection.
+type PushClassifier func(con *Connection, req *model.PushRequest) PushPriority
+
 type PushQueue struct {
 	cond *sync.Cond
 
@@ -27,8 +63,17 @@ type PushQueue struct {
 	// the PushRequest will be merged.
 	pending map[*Connection]*model.PushRequest
 
-	// queue maintains ordering of the queue
-	queue []*Connection
+	// queues maintains ordering of the queue, with one queue per priority class.
+	queues [numPushPriorities][]*Connection
+
+	// priority stores the priority class each pending connection is queued in.
+	priority map[*Connection]PushPriority
+
+	// skipped counts how many times each non-empty priority class was passed over since it was last dequeued from.
+	skipped [numPushPriorities]int
+
+	// classify determines the priority class of a push. If nil, all pushes have the same priority.
+	classify PushClassifier
 
 	// processing stores all connections that have been Dequeue(), but not MarkDone().
 	// The value stored will be initially be nil, but may be populated if the connection is Enqueue().
@@ -38,16 +83,33 @@ type PushQueue struct {
 	shuttingDown bool
 }
 
+// NewPushQueue creates a queue where all pushes have the same priority, and are dequeued in order.
 func NewPushQueue() *PushQueue {
+	return NewPriorityPushQueue(nil)
+}
+
+// NewPriorityPushQueue creates a queue which dequeues pushes by the priority class assigned by classify.
+// Within a priority class, pushes are dequeued in order.
+func NewPriorityPushQueue(classify PushClassifier) *PushQueue {
 	return &PushQueue{
 		pending:    make(map[*Connection]*model.PushRequest),
+		priority:   make(map[*Connection]PushPriority),
 		processing: make(map[*Connection]*model.PushRequest),
+		classify:   classify,
 		cond:       sync.NewCond(&sync.Mutex{}),
 	}
 }
 
+func (p *PushQueue) priorityOf(con *Connection, request *model.PushRequest) PushPriority {
+	if p.classify == nil {
+		return PrioritySidecar
+	}
+	return p.classify(con, request)
+}
+
 // Enqueue will mark a proxy as pending a push. If it is already pending, pushInfo will be merged.
-// ServiceEntry updates will be added together, and full will be set if either were full
+// ServiceEntry updates will be added together, and full will be set if either were full.
+// A merged push keeps the highest priority of the pushes it is made of.
 func (p *PushQueue) Enqueue(con *Connection, pushRequest *model.PushRequest) {
 	p.cond.L.Lock()
 	defer p.cond.L.Unlock()
@@ -64,38 +126,97 @@ func (p *PushQueue) Enqueue(con *Connection, pushRequest *model.PushRequest) {
 
 	if request, f := p.pending[con]; f {
 		p.pending[con] = request.Merge(pushRequest)
+		if prio := p.priorityOf(con, pushRequest); prio < p.priority[con] {
+			// Move the connection to the back of the higher priority queue.
+			p.removeFromQueue(con, p.priority[con])
+			p.priority[con] = prio
+			p.queues[prio] = append(p.queues[prio], con)
+		}
 		return
 	}
 
-	p.pending[con] = pushRequest
-	p.queue = append(p.queue, con)
+	p.add(con, pushRequest)
+}
+
+// add queues a connection which is not already pending. It must be called with the lock held.
+func (p *PushQueue) add(con *Connection, request *model.PushRequest) {
+	prio := p.priorityOf(con, request)
+	p.pending[con] = request
+	p.priority[con] = prio
+	p.queues[prio] = append(p.queues[prio], con)
 	// Signal waiters on Dequeue that a new item is available
 	p.cond.Signal()
 }
 
+func (p *PushQueue) removeFromQueue(con *Connection, prio PushPriority) {
+	q := p.queues[prio]
+	for i, c := range q {
+		if c == con {
+			copy(q[i:], q[i+1:])
+			// Clear the last element so the connection may be GCed, see Dequeue.
+			q[len(q)-1] = nil
+			p.queues[prio] = q[:len(q)-1]
+			return
+		}
+	}
+}
+
+// next selects the priority class to dequeue from. The highest priority non-empty class is used,
+// unless a lower priority class has been passed over maxPushStarvation times.
+func (p *PushQueue) next() (PushPriority, bool) {
+	selected, starved := -1, -1
+	for prio := 0; prio < numPushPriorities; prio++ {
+		if len(p.queues[prio]) == 0 {
+			p.skipped[prio] = 0
+			continue
+		}
+		if selected == -1 {
+			selected = prio
+		} else if p.skipped[prio] >= maxPushStarvation && (starved == -1 || p.skipped[prio] > p.skipped[starved]) {
+			starved = prio
+		}
+	}
+	if selected == -1 {
+		return 0, false
+	}
+	if starved != -1 {
+		selected = starved
+	}
+	for prio := 0; prio < numPushPriorities; prio++ {
+		if prio == selected {
+			p.skipped[prio] = 0
+		} else if len(p.queues[prio]) > 0 {
+			p.skipped[prio]++
+		}
+	}
+	return PushPriority(selected), true
+}
+
 // Remove a proxy from the queue. If there are no proxies ready to be removed, this will block
 func (p *PushQueue) Dequeue() (con *Connection, request *model.PushRequest, shutdown bool) {
 	p.cond.L.Lock()
 	defer p.cond.L.Unlock()
 
 	// Block until there is one to remove. Enqueue will signal when one is added.
-	for len(p.queue) == 0 && !p.shuttingDown {
+	for p.length() == 0 && !p.shuttingDown {
 		p.cond.Wait()
 	}
 
-	if len(p.queue) == 0 {
+	prio, ok := p.next()
+	if !ok {
 		// We must be shutting down.
 		return nil, nil, true
 	}
 
-	con = p.queue[0]
+	con = p.queues[prio][0]
 	// The underlying array will still exist, despite the slice changing, so the object may not GC without this
 	// See https://github.com/grpc/grpc-go/issues/4758
-	p.queue[0] = nil
-	p.queue = p.queue[1:]
+	p.queues[prio][0] = nil
+	p.queues[prio] = p.queues[prio][1:]
 
 	request = p.pending[con]
 	delete(p.pending, con)
+	delete(p.priority, con)
 
 	// Mark the connection as in progress
 	p.processing[con] = nil
@@ -112,17 +233,23 @@ func (p *PushQueue) MarkDone(con *Connection) {
 	// If the info is present, that means Enqueue was called while connection was not yet marked done.
 	// This means we need to add it back to the queue.
 	if request != nil {
-		p.pending[con] = request
-		p.queue = append(p.queue, con)
-		p.cond.Signal()
+		p.add(con, request)
+	}
+}
+
+func (p *PushQueue) length() int {
+	n := 0
+	for _, q := range p.queues {
+		n += len(q)
 	}
+	return n
 }
 
 // Get number of pending proxies
 func (p *PushQueue) Pending() int {
 	p.cond.L.Lock()
 	defer p.cond.L.Unlock()
-	return len(p.queue)
+	return p.length()
 }
 
 // ShutDown will cause queue to ignore all new items added to it. As soon as the
@@ -295,6 +295,100 @@ func TestProxyQueue(t *testing.T) {
 	})
 }
 
+func TestPriorityPushQueue(t *testing.T) {
+	proxies := make([]*Connection, 0, 20)
+	for p := 0; p < 20; p++ {
+		proxies = append(proxies, &Connection{ConID: fmt.Sprintf("proxy-%d", p)})
+	}
+	gateways := map[*Connection]bool{proxies[1]: true}
+	classify := func(con *Connection, req *model.PushRequest) PushPriority {
+		if !req.Full {
+			return PriorityEndpoint
+		}
+		if gateways[con] {
+			return PriorityGateway
+		}
+		return PrioritySidecar
+	}
+
+	t.Run("higher priority first", func(t *testing.T) {
+		p := NewPriorityPushQueue(classify)
+		defer p.ShutDown()
+
+		p.Enqueue(proxies[0], &model.PushRequest{Full: true})
+		p.Enqueue(proxies[1], &model.PushRequest{Full: true})
+		p.Enqueue(proxies[2], &model.PushRequest{Full: false})
+
+		ExpectDequeue(t, p, proxies[2])
+		ExpectDequeue(t, p, proxies[1])
+		ExpectDequeue(t, p, proxies[0])
+		ExpectTimeout(t, p)
+	})
+
+	t.Run("merge promotes", func(t *testing.T) {
+		p := NewPriorityPushQueue(classify)
+		defer p.ShutDown()
+
+		p.Enqueue(proxies[0], &model.PushRequest{Full: true})
+		p.Enqueue(proxies[2], &model.PushRequest{Full: true})
+		p.Enqueue(proxies[3], &model.PushRequest{Full: false})
+		// An endpoint update for a connection already pending a full push moves it ahead.
+		p.Enqueue(proxies[2], &model.PushRequest{Full: false})
+
+		ExpectDequeue(t, p, proxies[3])
+		_, info, _ := p.Dequeue()
+		if !info.Full {
+			t.Fatalf("expected merged push to be full")
+		}
+		ExpectDequeue(t, p, proxies[0])
+		ExpectTimeout(t, p)
+	})
+
+	t.Run("merge does not demote", func(t *testing.T) {
+		p := NewPriorityPushQueue(classify)
+		defer p.ShutDown()
+
+		p.Enqueue(proxies[0], &model.PushRequest{Full: true})
+		p.Enqueue(proxies[2], &model.PushRequest{Full: false})
+		p.Enqueue(proxies[2], &model.PushRequest{Full: true})
+
+		ExpectDequeue(t, p, proxies[2])
+		ExpectDequeue(t, p, proxies[0])
+		ExpectTimeout(t, p)
+	})
+
+	t.Run("markdone requeues by priority", func(t *testing.T) {
+		p := NewPriorityPushQueue(classify)
+		defer p.ShutDown()
+
+		p.Enqueue(proxies[0], &model.PushRequest{Full: true})
+		ExpectDequeue(t, p, proxies[0])
+		p.Enqueue(proxies[0], &model.PushRequest{Full: false})
+		p.Enqueue(proxies[2], &model.PushRequest{Full: true})
+		p.MarkDone(proxies[0])
+
+		ExpectDequeue(t, p, proxies[0])
+		ExpectDequeue(t, p, proxies[2])
+		ExpectTimeout(t, p)
+	})
+
+	t.Run("starvation", func(t *testing.T) {
+		p := NewPriorityPushQueue(classify)
+		defer p.ShutDown()
+
+		p.Enqueue(proxies[0], &model.PushRequest{Full: true})
+		// Keep the endpoint queue busy; the full push must still be dequeued after maxPushStarvation endpoint pushes.
+		for i := 2; i < 20; i++ {
+			p.Enqueue(proxies[i], &model.PushRequest{Full: false})
+		}
+		for i := 2; i < 2+maxPushStarvation; i++ {
+			ExpectDequeue(t, p, proxies[i])
+		}
+		ExpectDequeue(t, p, proxies[0])
+		ExpectDequeue(t, p, proxies[2+maxPushStarvation])
+	})
+}
+
 // TestPushQueueLeak is a regression test for https://github.com/grpc/grpc-go/issues/4758
 func TestPushQueueLeak(t *testing.T) {
 	ds := NewFakeDiscoveryServer(t, FakeOptions{})
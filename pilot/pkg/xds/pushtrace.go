@@ -0,0 +1,201 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package xds
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"istio.io/istio/pilot/pkg/model"
+)
+
+const (
+	// maxTrackedResources bounds the number of resources counted for each trigger reason. Events for
+	// further resources are counted as otherResources.
+	maxTrackedResources = 1000
+	otherResources      = "other"
+)
+
+// pushHistory keeps the most recent pushes along with the events that triggered them, and counts the
+// events by reason and resource, to find the changes responsible for frequent pushes.
+type pushHistory struct {
+	mu sync.Mutex
+	// pushes is a ring buffer of the most recent pushes; next is the position of the next push.
+	pushes   []pushRecord
+	next     int
+	triggers map[model.TriggerReason]*triggerCounts
+}
+
+type pushRecord struct {
+	Time           time.Time             `json:"time"`
+	Version        string                `json:"version"`
+	Full           bool                  `json:"full"`
+	Reasons        []model.TriggerReason `json:"reasons"`
+	ConfigsUpdated int                   `json:"configsUpdated"`
+	Trace          []model.PushTrigger   `json:"trace"`
+	TraceDropped   int                   `json:"traceDropped,omitempty"`
+}
+
+type triggerCounts struct {
+	total     int64
+	resources map[string]int64
+}
+
+func newPushHistory(size int) *pushHistory {
+	if size < 1 {
+		size = 1
+	}
+	return &pushHistory{
+		pushes:   make([]pushRecord, 0, size),
+		triggers: map[model.TriggerReason]*triggerCounts{},
+	}
+}
+
+// addTrigger counts the event behind a push request, before it is debounced.
+func (h *pushHistory) addTrigger(req *model.PushRequest) {
+	reasons := req.Reason
+	if len(reasons) == 0 {
+		reasons = []model.TriggerReason{model.UnknownTrigger}
+	}
+	source := ""
+	if len(req.Trace) > 0 {
+		source = req.Trace[0].Source
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, reason := range reasons {
+		c := h.triggers[reason]
+		if c == nil {
+			c = &triggerCounts{resources: map[string]int64{}}
+			h.triggers[reason] = c
+		}
+		c.total++
+		if len(req.ConfigsUpdated) == 0 {
+			// Global changes are attributed to their source instead
+			if source != "" {
+				c.add(source)
+			}
+			continue
+		}
+		for key := range req.ConfigsUpdated {
+			c.add(key.String())
+		}
+	}
+}
+
+func (c *triggerCounts) add(resource string) {
+	if _, f := c.resources[resource]; !f && len(c.resources) >= maxTrackedResources {
+		resource = otherResources
+	}
+	c.resources[resource]++
+}
+
+// addPush records a push, once it has been debounced.
+func (h *pushHistory) addPush(version string, req *model.PushRequest) {
+	r := pushRecord{
+		Time:           time.Now(),
+		Version:        version,
+		Full:           req.Full,
+		Reasons:        req.Reason,
+		ConfigsUpdated: len(req.ConfigsUpdated),
+		Trace:          req.Trace,
+		TraceDropped:   req.TraceDropped,
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.pushes) < cap(h.pushes) {
+		h.pushes = append(h.pushes, r)
+	} else {
+		h.pushes[h.next] = r
+	}
+	h.next = (h.next + 1) % cap(h.pushes)
+}
+
+type resourceCount struct {
+	Resource string `json:"resource"`
+	Count    int64  `json:"count"`
+}
+
+type triggerSummary struct {
+	Total        int64           `json:"total"`
+	TopResources []resourceCount `json:"topResources"`
+}
+
+type pushHistoryDebug struct {
+	// Pushes are the most recent pushes, newest first.
+	Pushes []pushRecord `json:"pushes"`
+	// Triggers summarizes the events that triggered pushes since istiod started, by reason.
+	Triggers map[model.TriggerReason]triggerSummary `json:"triggers"`
+}
+
+// snapshot returns the recent pushes, and the top resources of each trigger reason.
+func (h *pushHistory) snapshot(top int) pushHistoryDebug {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	out := pushHistoryDebug{
+		Pushes:   make([]pushRecord, 0, len(h.pushes)),
+		Triggers: make(map[model.TriggerReason]triggerSummary, len(h.triggers)),
+	}
+	for i := 1; i <= len(h.pushes); i++ {
+		out.Pushes = append(out.Pushes, h.pushes[(h.next-i+len(h.pushes))%len(h.pushes)])
+	}
+	for reason, c := range h.triggers {
+		counts := make([]resourceCount, 0, len(c.resources))
+		for r, n := range c.resources {
+			counts = append(counts, resourceCount{Resource: r, Count: n})
+		}
+		sort.Slice(counts, func(i, j int) bool {
+			if counts[i].Count != counts[j].Count {
+				return counts[i].Count > counts[j].Count
+			}
+			return counts[i].Resource < counts[j].Resource
+		})
+		if len(counts) > top {
+			counts = counts[:top]
+		}
+		out.Triggers[reason] = triggerSummary{Total: c.total, TopResources: counts}
+	}
+	return out
+}
+
+// pushHistoryz shows the recent pushes with the events that triggered them, and the resources that
+// triggered the most pushes for each reason. The number of resources shown is set with ?top=, and
+// defaults to 10.
+func (s *DiscoveryServer) pushHistoryz(w http.ResponseWriter, req *http.Request) {
+	top := 10
+	if t := req.URL.Query().Get("top"); t != "" {
+		n, err := strconv.Atoi(t)
+		if err != nil || n < 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte("top must be a non-negative number"))
+			return
+		}
+		top = n
+	}
+	b, err := json.MarshalIndent(s.pushHistory.snapshot(top), "  ", "  ")
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = fmt.Fprintf(w, "unable to marshal push history: %v", err)
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+	_, _ = w.Write(b)
+}
@@ -0,0 +1,117 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package xds
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pkg/config/schema/gvk"
+)
+
+func configUpdate(reason model.TriggerReason, names ...string) *model.PushRequest {
+	req := &model.PushRequest{Full: true, Reason: []model.TriggerReason{reason}}
+	if len(names) > 0 {
+		req.ConfigsUpdated = map[model.ConfigKey]struct{}{}
+		for _, n := range names {
+			req.ConfigsUpdated[model.ConfigKey{Kind: gvk.VirtualService, Name: n, Namespace: "ns"}] = struct{}{}
+		}
+	}
+	return req.Traced("test")
+}
+
+func TestPushHistory(t *testing.T) {
+	h := newPushHistory(3)
+	for i := 0; i < 5; i++ {
+		h.addPush(fmt.Sprint(i), configUpdate(model.ConfigUpdate))
+	}
+	got := []string{}
+	for _, p := range h.snapshot(10).Pushes {
+		got = append(got, p.Version)
+	}
+	if want := []string{"4", "3", "2"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected the latest pushes %v, got %v", want, got)
+	}
+	if tr := h.snapshot(10).Pushes[0].Trace; len(tr) != 1 || tr[0].Source != "test" {
+		t.Fatalf("expected push trace, got %v", tr)
+	}
+}
+
+func TestPushHistoryTriggers(t *testing.T) {
+	h := newPushHistory(1)
+	for i := 0; i < 3; i++ {
+		h.addTrigger(configUpdate(model.ConfigUpdate, "a"))
+	}
+	h.addTrigger(configUpdate(model.ConfigUpdate, "a", "b"))
+	h.addTrigger(configUpdate(model.ConfigUpdate, "c"))
+	h.addTrigger(configUpdate(model.GlobalUpdate))
+
+	got := h.snapshot(2).Triggers
+	want := map[model.TriggerReason]triggerSummary{
+		model.ConfigUpdate: {
+			Total: 5,
+			TopResources: []resourceCount{
+				{Resource: "VirtualService/ns/a", Count: 4},
+				{Resource: "VirtualService/ns/b", Count: 1},
+			},
+		},
+		model.GlobalUpdate: {
+			Total:        1,
+			TopResources: []resourceCount{{Resource: "test", Count: 1}},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %+v, got %+v", want, got)
+	}
+
+	for i := 0; i < maxTrackedResources+1; i++ {
+		h.addTrigger(configUpdate(model.ServiceUpdate, fmt.Sprint(i)))
+	}
+	h.addTrigger(configUpdate(model.ServiceUpdate, "more"))
+	top := h.snapshot(1).Triggers[model.ServiceUpdate].TopResources
+	if len(top) != 1 || top[0] != (resourceCount{Resource: otherResources, Count: 2}) {
+		t.Fatalf("expected untracked resources to be counted together, got %v", top)
+	}
+}
+
+func TestPushHistoryz(t *testing.T) {
+	s := NewFakeDiscoveryServer(t, FakeOptions{})
+	s.Discovery.ConfigUpdate(configUpdate(model.ConfigUpdate, "a"))
+	s.Discovery.ConfigUpdate(configUpdate(model.ConfigUpdate, "b"))
+
+	rr := httptest.NewRecorder()
+	s.Discovery.pushHistoryz(rr, httptest.NewRequest("GET", "/debug/push_history?top=1", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", rr.Code, rr.Body.String())
+	}
+	got := pushHistoryDebug{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if c := got.Triggers[model.ConfigUpdate]; c.Total < 2 || len(c.TopResources) != 1 {
+		t.Fatalf("unexpected triggers %+v", got.Triggers)
+	}
+
+	rr = httptest.NewRecorder()
+	s.Discovery.pushHistoryz(rr, httptest.NewRequest("GET", "/debug/push_history?top=x", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected bad request, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,182 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package xds
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+
+	"istio.io/istio/pilot/pkg/xds/recording"
+)
+
+// streamRecorder records the xDS streams of selected proxies, identified by proxy ID, to files. Only
+// connections established while a proxy is selected are recorded, from their first request, so
+// each recording holds a complete stream that can be replayed.
+type streamRecorder struct {
+	dir string
+
+	mu sync.RWMutex
+	// proxies holds the IDs of the proxies to record.
+	proxies map[string]struct{}
+	// active holds the recording of each recorded connection, keyed by connection ID.
+	active map[string]*activeRecording
+}
+
+type activeRecording struct {
+	proxyID  string
+	path     string
+	recorder *recording.Recorder
+}
+
+func newStreamRecorder(dir string, proxies []string) *streamRecorder {
+	r := &streamRecorder{
+		dir:     dir,
+		proxies: map[string]struct{}{},
+		active:  map[string]*activeRecording{},
+	}
+	for _, p := range proxies {
+		if p = strings.TrimSpace(p); p != "" {
+			r.proxies[p] = struct{}{}
+		}
+	}
+	return r
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^a-zA-Z0-9._-]`)
+
+// openConnection starts the recording of a new connection, if its proxy is selected for recording.
+// It is called when the connection is initialized, before its first request is processed.
+func (r *streamRecorder) openConnection(con *Connection) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, selected := r.proxies[con.proxy.ID]; !selected {
+		return
+	}
+	path := filepath.Join(r.dir, unsafeFileChars.ReplaceAllString(con.ConID, "_")+".jsonl")
+	rec, err := recording.Create(path, con.ConID)
+	if err != nil {
+		log.Warnf("failed to start recording xDS stream of %s: %v", con.ConID, err)
+		return
+	}
+	log.Infof("recording xDS stream of %s to %s", con.ConID, path)
+	r.active[con.ConID] = &activeRecording{proxyID: con.proxy.ID, path: path, recorder: rec}
+}
+
+// record writes msg to the recording of the connection, if it is recorded.
+func (r *streamRecorder) record(con *Connection, msg proto.Message) {
+	if r == nil {
+		return
+	}
+	r.mu.RLock()
+	ar := r.active[con.ConID]
+	r.mu.RUnlock()
+	if ar == nil {
+		return
+	}
+	if err := ar.recorder.Record(msg); err != nil {
+		log.Warnf("failed to record xDS message for %s: %v", con.ConID, err)
+	}
+}
+
+// closeConnection finishes the recording of a closed connection.
+func (r *streamRecorder) closeConnection(con *Connection) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	ar := r.active[con.ConID]
+	delete(r.active, con.ConID)
+	r.mu.Unlock()
+	if ar != nil {
+		_ = ar.recorder.Close()
+	}
+}
+
+// stop stops recording the proxy, and finishes the recordings of its connections.
+func (r *streamRecorder) stop(proxyID string) {
+	r.mu.Lock()
+	delete(r.proxies, proxyID)
+	var closing []*activeRecording
+	for conID, ar := range r.active {
+		if ar.proxyID == proxyID {
+			closing = append(closing, ar)
+			delete(r.active, conID)
+		}
+	}
+	r.mu.Unlock()
+	for _, ar := range closing {
+		_ = ar.recorder.Close()
+	}
+}
+
+type recordingStatus struct {
+	Directory string `json:"directory"`
+	// Proxies are the IDs of the proxies that are recorded when they connect.
+	Proxies []string `json:"proxies"`
+	// Recordings are the files being written, keyed by connection ID.
+	Recordings map[string]string `json:"recordings"`
+}
+
+// recordz starts or stops recording the xDS streams of a proxy, and lists the active recordings.
+// Recording starts with the next connection of the proxy: the streams already open are not recorded.
+func (s *DiscoveryServer) recordz(w http.ResponseWriter, req *http.Request) {
+	r := s.recorder
+	if r == nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte("recording is disabled, set PILOT_XDS_RECORDING_DIR to enable it"))
+		return
+	}
+	_ = req.ParseForm()
+	if proxyID := req.Form.Get("proxyID"); proxyID != "" {
+		if req.Form.Get("stop") != "" {
+			r.stop(proxyID)
+		} else {
+			r.mu.Lock()
+			r.proxies[proxyID] = struct{}{}
+			r.mu.Unlock()
+		}
+	}
+
+	r.mu.RLock()
+	st := recordingStatus{Directory: r.dir, Proxies: []string{}, Recordings: map[string]string{}}
+	for p := range r.proxies {
+		st.Proxies = append(st.Proxies, p)
+	}
+	for conID, ar := range r.active {
+		st.Recordings[conID] = ar.path
+	}
+	r.mu.RUnlock()
+	sort.Strings(st.Proxies)
+
+	b, err := json.MarshalIndent(st, "  ", "  ")
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = fmt.Fprintf(w, "unable to marshal recording status: %v", err)
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+	_, _ = w.Write(b)
+}
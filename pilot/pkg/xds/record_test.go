@@ -0,0 +1,97 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package xds
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+
+	"istio.io/istio/pilot/pkg/xds/recording"
+	v3 "istio.io/istio/pilot/pkg/xds/v3"
+	"istio.io/istio/pkg/test/util/retry"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	dir := t.TempDir()
+	s := NewFakeDiscoveryServer(t, FakeOptions{})
+	s.Discovery.recorder = newStreamRecorder(dir, nil)
+
+	// Streams opened before the proxy is selected are not recorded, even once it is
+	early := s.ConnectADS().WithType(v3.ClusterType)
+	early.RequestResponseAck(nil)
+
+	// Select the proxy through the debug endpoint
+	rr := httptest.NewRecorder()
+	s.Discovery.recordz(rr, httptest.NewRequest("GET", "/debug/recordz?proxyID=test.default", nil))
+	if !strings.Contains(rr.Body.String(), `"test.default"`) {
+		t.Fatalf("proxy not selected: %s", rr.Body.String())
+	}
+
+	early.RequestResponseAck(&discovery.DiscoveryRequest{TypeUrl: v3.ListenerType})
+
+	ads := s.ConnectADS().WithType(v3.ClusterType)
+	ads.RequestResponseAck(nil)
+	// Not recorded
+	s.ConnectADS().WithType(v3.ClusterType).WithID("sidecar~1.1.1.2~other.default~default.svc.cluster.local").RequestResponseAck(nil)
+
+	var entries []recording.Entry
+	retry.UntilSuccessOrFail(t, func() error {
+		files, err := filepath.Glob(filepath.Join(dir, "*.jsonl"))
+		if err != nil || len(files) != 1 {
+			return fmt.Errorf("expected a single recording, got %v: %v", files, err)
+		}
+		entries, err = recording.ReadFile(files[0])
+		if err != nil {
+			return err
+		}
+		if len(entries) != 3 {
+			return fmt.Errorf("expected request, response and ack, got %d entries", len(entries))
+		}
+		return nil
+	}, retry.Timeout(time.Second*5))
+	if entries[0].Kind != recording.Request || entries[1].Kind != recording.Response || entries[2].Kind != recording.Request {
+		t.Fatalf("unexpected entries %v", entries)
+	}
+	if issues := recording.Validate(entries); len(issues) != 0 {
+		t.Fatalf("unexpected issues %v", issues)
+	}
+
+	s.Discovery.recorder.stop("test.default")
+	s.Discovery.recorder.mu.RLock()
+	active := len(s.Discovery.recorder.active)
+	s.Discovery.recorder.mu.RUnlock()
+	if active != 0 {
+		t.Fatalf("recording should be stopped")
+	}
+
+	replayed := s.Replay(entries, 100*time.Millisecond)
+	if len(replayed) != 3 {
+		t.Fatalf("expected request, response and ack, got %v", replayed)
+	}
+	resp := replayed[1].Message.(*discovery.DiscoveryResponse)
+	ack := replayed[2].Message.(*discovery.DiscoveryRequest)
+	if ack.ResponseNonce != resp.Nonce {
+		t.Fatalf("ack nonce %q should match the replayed response %q", ack.ResponseNonce, resp.Nonce)
+	}
+	if len(resp.Resources) != len(entries[1].Message.(*discovery.DiscoveryResponse).Resources) {
+		t.Fatalf("replayed response differs from the recording")
+	}
+}
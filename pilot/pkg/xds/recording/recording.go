@@ -0,0 +1,212 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package recording records the messages exchanged on an xDS stream, so the stream can be inspected,
+// validated and replayed offline.
+//
+// A recording is a file with one JSON object per line, each holding a single message. Messages are
+// stored in their binary encoding, so resources are replayed exactly as they were sent.
+package recording
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	"github.com/golang/protobuf/proto"
+)
+
+// Kind is the type of a recorded message.
+type Kind string
+
+const (
+	Request       Kind = "request"
+	Response      Kind = "response"
+	DeltaRequest  Kind = "deltaRequest"
+	DeltaResponse Kind = "deltaResponse"
+)
+
+// Entry is a single recorded message.
+type Entry struct {
+	Time time.Time
+	// ConnectionID identifies the stream the message was sent on.
+	ConnectionID string
+	Kind         Kind
+	// Message is a DiscoveryRequest, DiscoveryResponse, DeltaDiscoveryRequest or DeltaDiscoveryResponse,
+	// depending on Kind.
+	Message proto.Message
+}
+
+// entryJSON is the serialized form of an Entry. The type URL and nonce are duplicated from the message
+// so recordings can be searched without decoding them.
+type entryJSON struct {
+	Time         time.Time `json:"time"`
+	ConnectionID string    `json:"connectionID"`
+	Kind         Kind      `json:"kind"`
+	TypeURL      string    `json:"typeUrl,omitempty"`
+	Nonce        string    `json:"nonce,omitempty"`
+	Message      []byte    `json:"message"`
+}
+
+// NewEntry returns an entry recording msg, which must be one of the xDS request or response types.
+func NewEntry(connectionID string, msg proto.Message) (Entry, error) {
+	e := Entry{Time: time.Now(), ConnectionID: connectionID, Message: msg}
+	switch msg.(type) {
+	case *discovery.DiscoveryRequest:
+		e.Kind = Request
+	case *discovery.DiscoveryResponse:
+		e.Kind = Response
+	case *discovery.DeltaDiscoveryRequest:
+		e.Kind = DeltaRequest
+	case *discovery.DeltaDiscoveryResponse:
+		e.Kind = DeltaResponse
+	default:
+		return Entry{}, fmt.Errorf("cannot record message of type %T", msg)
+	}
+	return e, nil
+}
+
+// TypeURL returns the type URL of the recorded message.
+func (e Entry) TypeURL() string {
+	if m, ok := e.Message.(interface{ GetTypeUrl() string }); ok {
+		return m.GetTypeUrl()
+	}
+	return ""
+}
+
+// Nonce returns the nonce of a recorded response, or the response nonce of a recorded request.
+func (e Entry) Nonce() string {
+	switch m := e.Message.(type) {
+	case *discovery.DiscoveryRequest:
+		return m.GetResponseNonce()
+	case *discovery.DiscoveryResponse:
+		return m.GetNonce()
+	case *discovery.DeltaDiscoveryRequest:
+		return m.GetResponseNonce()
+	case *discovery.DeltaDiscoveryResponse:
+		return m.GetNonce()
+	}
+	return ""
+}
+
+func (e Entry) MarshalJSON() ([]byte, error) {
+	b, err := proto.Marshal(e.Message)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(entryJSON{
+		Time:         e.Time,
+		ConnectionID: e.ConnectionID,
+		Kind:         e.Kind,
+		TypeURL:      e.TypeURL(),
+		Nonce:        e.Nonce(),
+		Message:      b,
+	})
+}
+
+func (e *Entry) UnmarshalJSON(b []byte) error {
+	raw := entryJSON{}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	var msg proto.Message
+	switch raw.Kind {
+	case Request:
+		msg = &discovery.DiscoveryRequest{}
+	case Response:
+		msg = &discovery.DiscoveryResponse{}
+	case DeltaRequest:
+		msg = &discovery.DeltaDiscoveryRequest{}
+	case DeltaResponse:
+		msg = &discovery.DeltaDiscoveryResponse{}
+	default:
+		return fmt.Errorf("unknown message kind %q", raw.Kind)
+	}
+	if err := proto.Unmarshal(raw.Message, msg); err != nil {
+		return fmt.Errorf("failed to decode %s: %v", raw.Kind, err)
+	}
+	*e = Entry{Time: raw.Time, ConnectionID: raw.ConnectionID, Kind: raw.Kind, Message: msg}
+	return nil
+}
+
+// Recorder writes the messages of a single stream. It is safe for concurrent use.
+type Recorder struct {
+	mu           sync.Mutex
+	w            io.WriteCloser
+	enc          *json.Encoder
+	connectionID string
+}
+
+// NewRecorder returns a Recorder writing the messages of the connection to w.
+func NewRecorder(w io.WriteCloser, connectionID string) *Recorder {
+	return &Recorder{w: w, enc: json.NewEncoder(w), connectionID: connectionID}
+}
+
+// Create returns a Recorder appending the messages of the connection to the file at path. As the
+// recorded responses may contain secrets, the file is only readable by its owner.
+func Create(path string, connectionID string) (*Recorder, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return NewRecorder(f, connectionID), nil
+}
+
+// Record writes msg to the recording.
+func (r *Recorder) Record(msg proto.Message) error {
+	e, err := NewEntry(r.connectionID, msg)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.enc.Encode(e)
+}
+
+// Close closes the underlying writer.
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.w.Close()
+}
+
+// Read reads all entries of a recording.
+func Read(r io.Reader) ([]Entry, error) {
+	dec := json.NewDecoder(r)
+	var entries []Entry
+	for {
+		e := Entry{}
+		if err := dec.Decode(&e); err != nil {
+			if err == io.EOF {
+				return entries, nil
+			}
+			return nil, fmt.Errorf("entry %d: %v", len(entries), err)
+		}
+		entries = append(entries, e)
+	}
+}
+
+// ReadFile reads all entries of the recording at path.
+func ReadFile(path string) ([]Entry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Read(f)
+}
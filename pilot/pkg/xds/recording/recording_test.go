@@ -0,0 +1,228 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package recording
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	cluster "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	route "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/any"
+	status "google.golang.org/genproto/googleapis/rpc/status"
+
+	"istio.io/istio/pilot/pkg/networking/util"
+	v3 "istio.io/istio/pilot/pkg/xds/v3"
+)
+
+func clusters(nonce string, names ...string) *discovery.DiscoveryResponse {
+	resp := &discovery.DiscoveryResponse{TypeUrl: v3.ClusterType, Nonce: nonce}
+	for _, n := range names {
+		resp.Resources = append(resp.Resources, util.MessageToAny(&cluster.Cluster{
+			Name:                 n,
+			ClusterDiscoveryType: &cluster.Cluster_Type{Type: cluster.Cluster_EDS},
+		}))
+	}
+	return resp
+}
+
+func routes(nonce string, clusters ...string) *discovery.DiscoveryResponse {
+	vh := &route.VirtualHost{Name: "vh", Domains: []string{"*"}}
+	for _, c := range clusters {
+		vh.Routes = append(vh.Routes, &route.Route{
+			Match:  &route.RouteMatch{PathSpecifier: &route.RouteMatch_Prefix{Prefix: "/"}},
+			Action: &route.Route_Route{Route: &route.RouteAction{ClusterSpecifier: &route.RouteAction_Cluster{Cluster: c}}},
+		})
+	}
+	return &discovery.DiscoveryResponse{
+		TypeUrl:   v3.RouteType,
+		Nonce:     nonce,
+		Resources: []*any.Any{util.MessageToAny(&route.RouteConfiguration{Name: "80", VirtualHosts: []*route.VirtualHost{vh}})},
+	}
+}
+
+type nopCloser struct {
+	*bytes.Buffer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+func record(t *testing.T, msgs ...proto.Message) []Entry {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	rec := NewRecorder(nopCloser{buf}, "con-1")
+	for _, m := range msgs {
+		if err := rec.Record(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	entries, err := Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return entries
+}
+
+func TestRecordRead(t *testing.T) {
+	msgs := []proto.Message{
+		&discovery.DiscoveryRequest{TypeUrl: v3.ClusterType},
+		clusters("n1", "a"),
+		&discovery.DeltaDiscoveryRequest{TypeUrl: v3.ListenerType, ResourceNamesSubscribe: []string{"l"}},
+		&discovery.DeltaDiscoveryResponse{TypeUrl: v3.ListenerType, Nonce: "n2", RemovedResources: []string{"old"}},
+	}
+	entries := record(t, msgs...)
+	if len(entries) != len(msgs) {
+		t.Fatalf("got %d entries, want %d", len(entries), len(msgs))
+	}
+	kinds := []Kind{Request, Response, DeltaRequest, DeltaResponse}
+	for i, e := range entries {
+		if e.ConnectionID != "con-1" || e.Kind != kinds[i] {
+			t.Errorf("entry %d: got %s/%s", i, e.ConnectionID, e.Kind)
+		}
+		if !proto.Equal(e.Message, msgs[i]) {
+			t.Errorf("entry %d: got %v, want %v", i, e.Message, msgs[i])
+		}
+	}
+	if entries[3].Nonce() != "n2" || entries[3].TypeURL() != v3.ListenerType {
+		t.Errorf("got nonce %q type %q", entries[3].Nonce(), entries[3].TypeURL())
+	}
+}
+
+func TestReadInvalid(t *testing.T) {
+	if _, err := Read(strings.NewReader(`{"kind":"unknown"}`)); err == nil {
+		t.Fatal("expected error")
+	}
+	if _, err := NewEntry("con", &cluster.Cluster{}); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestCreate(t *testing.T) {
+	path := t.TempDir() + "/stream.jsonl"
+	for i := 0; i < 2; i++ {
+		rec, err := Create(path, "con")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := rec.Record(clusters("n", "a")); err != nil {
+			t.Fatal(err)
+		}
+		if err := rec.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	entries, err := ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("recordings should be appended, got %d entries", len(entries))
+	}
+	if b, _ := ioutil.ReadFile(path); !bytes.Contains(b, []byte(`"typeUrl":"`+v3.ClusterType+`"`)) {
+		t.Fatalf("type URL should be readable without decoding: %s", b)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	cases := []struct {
+		name string
+		msgs []proto.Message
+		want []string
+	}{
+		{
+			name: "valid",
+			msgs: []proto.Message{
+				&discovery.DiscoveryRequest{TypeUrl: v3.ClusterType},
+				clusters("c1", "a", "b"),
+				&discovery.DiscoveryRequest{TypeUrl: v3.ClusterType, ResponseNonce: "c1"},
+				routes("r1", "a", "b"),
+			},
+		},
+		{
+			name: "nack",
+			msgs: []proto.Message{
+				clusters("c1", "a"),
+				&discovery.DiscoveryRequest{TypeUrl: v3.ClusterType, ResponseNonce: "c1", ErrorDetail: &status.Status{Message: "bad"}},
+			},
+			want: []string{"entry 0: CDS nonce=c1: rejected by the proxy in entry 1: bad"},
+		},
+		{
+			name: "duplicate",
+			msgs: []proto.Message{clusters("c1", "a", "a")},
+			want: []string{"entry 0: CDS nonce=c1 resource=a: duplicate resource"},
+		},
+		{
+			name: "invalid",
+			msgs: []proto.Message{clusters("c1", "")},
+			want: []string{"entry 0: CDS nonce=c1: invalid resource"},
+		},
+		{
+			name: "unknown cluster",
+			msgs: []proto.Message{
+				clusters("c1", "a"),
+				routes("r1", "a", "b"),
+				// Only reported once
+				routes("r2", "a", "b"),
+				// Fixed by adding the cluster
+				clusters("c2", "a", "b"),
+				// Reported again once the cluster is removed
+				clusters("c3", "a"),
+			},
+			want: []string{
+				`entry 1: RDS nonce=r1 resource=80: route refers to unknown cluster "b"`,
+				`entry 4: CDS nonce=c3 resource=80: route refers to unknown cluster "b"`,
+			},
+		},
+		{
+			name: "delta",
+			msgs: []proto.Message{
+				&discovery.DeltaDiscoveryResponse{
+					TypeUrl: v3.ClusterType,
+					Nonce:   "c1",
+					Resources: []*discovery.Resource{
+						{Name: "a", Resource: clusters("", "a").Resources[0]},
+						{Name: "x", Resource: clusters("", "b").Resources[0]},
+					},
+				},
+				&discovery.DeltaDiscoveryResponse{TypeUrl: v3.ClusterType, Nonce: "c2", RemovedResources: []string{"a"}},
+				routes("r1", "a", "b"),
+			},
+			want: []string{
+				`entry 0: CDS nonce=c1 resource=x: resource is named "b"`,
+				`entry 2: RDS nonce=r1 resource=80: route refers to unknown cluster "a"`,
+				`entry 2: RDS nonce=r1 resource=80: route refers to unknown cluster "b"`,
+			},
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			issues := Validate(record(t, tt.msgs...))
+			if len(issues) != len(tt.want) {
+				t.Fatalf("got issues %v, want %v", issues, tt.want)
+			}
+			for i, issue := range issues {
+				if !strings.HasPrefix(issue.String(), tt.want[i]) {
+					t.Errorf("got issue %q, want %q", issue, tt.want[i])
+				}
+			}
+		})
+	}
+}
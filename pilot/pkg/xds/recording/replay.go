@@ -0,0 +1,139 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package recording
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+)
+
+// replayConnectionID is the connection ID of the entries returned by Replay.
+const replayConnectionID = "replay"
+
+// Replay sends the requests of a recording to the xDS server of conn, in order, and returns the resulting
+// stream. After each request, responses are collected until none is received for the wait duration. As
+// the server generates new nonces, the response nonce of each replayed request is replaced with the nonce
+// of the latest response of the same type.
+func Replay(ctx context.Context, conn grpc.ClientConnInterface, entries []Entry, wait time.Duration) ([]Entry, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	client := discovery.NewAggregatedDiscoveryServiceClient(conn)
+	var ads discovery.AggregatedDiscoveryService_StreamAggregatedResourcesClient
+	var delta discovery.AggregatedDiscoveryService_DeltaAggregatedResourcesClient
+	responses := make(chan proto.Message)
+	errs := make(chan error)
+
+	nonces := map[string]string{}
+	var out []Entry
+	add := func(msg proto.Message) error {
+		e, err := NewEntry(replayConnectionID, msg)
+		if err != nil {
+			return err
+		}
+		out = append(out, e)
+		return nil
+	}
+
+	for _, e := range entries {
+		switch e.Kind {
+		case Request:
+			if ads == nil {
+				stream, err := client.StreamAggregatedResources(ctx)
+				if err != nil {
+					return out, err
+				}
+				ads = stream
+				go receive(ctx, func() (proto.Message, error) { return stream.Recv() }, responses, errs)
+			}
+			req := proto.Clone(e.Message).(*discovery.DiscoveryRequest)
+			if req.ResponseNonce != "" {
+				req.ResponseNonce = nonces[req.TypeUrl]
+			}
+			if err := add(req); err != nil {
+				return out, err
+			}
+			if err := ads.Send(req); err != nil {
+				return out, err
+			}
+		case DeltaRequest:
+			if delta == nil {
+				stream, err := client.DeltaAggregatedResources(ctx)
+				if err != nil {
+					return out, err
+				}
+				delta = stream
+				go receive(ctx, func() (proto.Message, error) { return stream.Recv() }, responses, errs)
+			}
+			req := proto.Clone(e.Message).(*discovery.DeltaDiscoveryRequest)
+			if req.ResponseNonce != "" {
+				req.ResponseNonce = nonces[req.TypeUrl]
+			}
+			if err := add(req); err != nil {
+				return out, err
+			}
+			if err := delta.Send(req); err != nil {
+				return out, err
+			}
+		default:
+			// Responses are generated again by the server.
+			continue
+		}
+
+	collect:
+		for {
+			select {
+			case msg := <-responses:
+				switch resp := msg.(type) {
+				case *discovery.DiscoveryResponse:
+					nonces[resp.TypeUrl] = resp.Nonce
+				case *discovery.DeltaDiscoveryResponse:
+					nonces[resp.TypeUrl] = resp.Nonce
+				}
+				if err := add(msg); err != nil {
+					return out, err
+				}
+			case err := <-errs:
+				return out, fmt.Errorf("replayed stream failed: %v", err)
+			case <-time.After(wait):
+				break collect
+			}
+		}
+	}
+	return out, nil
+}
+
+// receive forwards the messages received by recv until it fails or ctx is done.
+func receive(ctx context.Context, recv func() (proto.Message, error), responses chan<- proto.Message, errs chan<- error) {
+	for {
+		msg, err := recv()
+		if err != nil {
+			select {
+			case errs <- err:
+			case <-ctx.Done():
+			}
+			return
+		}
+		select {
+		case responses <- msg:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,237 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package recording
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	endpoint "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
+	route "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	"github.com/golang/protobuf/ptypes/any"
+	status "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoregistry"
+
+	v3 "istio.io/istio/pilot/pkg/xds/v3"
+	// Register all Envoy types, so the resources sent by istiod can be decoded.
+	_ "istio.io/istio/pkg/config/xds"
+)
+
+// Issue is a problem found in a recording.
+type Issue struct {
+	// Index is the position of the offending entry in the recording.
+	Index   int
+	TypeURL string
+	Nonce   string
+	// Resource is the name of the offending resource, if any.
+	Resource string
+	Message  string
+}
+
+func (i Issue) String() string {
+	s := fmt.Sprintf("entry %d: %s nonce=%s", i.Index, v3.GetShortType(i.TypeURL), i.Nonce)
+	if i.Resource != "" {
+		s += fmt.Sprintf(" resource=%s", i.Resource)
+	}
+	return s + ": " + i.Message
+}
+
+// Validate checks the responses of a recording the way a proxy would, without running one. It reports
+// the responses the proxy rejected, resources that cannot be decoded, fail validation, have the wrong
+// type or are duplicated, and routes that refer to clusters the proxy did not have at the time.
+func Validate(entries []Entry) []Issue {
+	v := &validator{
+		responses: map[string]int{},
+		routes:    map[string]*route.RouteConfiguration{},
+		dangling:  map[string]struct{}{},
+	}
+	for i, e := range entries {
+		switch m := e.Message.(type) {
+		case *discovery.DiscoveryRequest:
+			v.checkRequest(i, m.TypeUrl, m.ResponseNonce, m.ErrorDetail)
+		case *discovery.DeltaDiscoveryRequest:
+			v.checkRequest(i, m.TypeUrl, m.ResponseNonce, m.ErrorDetail)
+		case *discovery.DiscoveryResponse:
+			v.responses[m.Nonce] = i
+			resources := map[string]proto.Message{}
+			for _, r := range m.Resources {
+				name, msg := v.decode(i, m.TypeUrl, m.Nonce, r)
+				if msg == nil {
+					continue
+				}
+				if _, f := resources[name]; f {
+					v.report(i, m.TypeUrl, m.Nonce, name, "duplicate resource")
+				}
+				resources[name] = msg
+			}
+			v.apply(i, m.TypeUrl, m.Nonce, resources, nil, true)
+		case *discovery.DeltaDiscoveryResponse:
+			v.responses[m.Nonce] = i
+			resources := map[string]proto.Message{}
+			for _, r := range m.Resources {
+				name, msg := v.decode(i, m.TypeUrl, m.Nonce, r.Resource)
+				if msg == nil {
+					continue
+				}
+				if name != r.Name {
+					v.report(i, m.TypeUrl, m.Nonce, r.Name, fmt.Sprintf("resource is named %q", name))
+				}
+				if _, f := resources[r.Name]; f {
+					v.report(i, m.TypeUrl, m.Nonce, r.Name, "duplicate resource")
+				}
+				resources[r.Name] = msg
+			}
+			v.apply(i, m.TypeUrl, m.Nonce, resources, m.RemovedResources, false)
+		}
+	}
+	return v.issues
+}
+
+type validator struct {
+	issues []Issue
+	// responses holds the index of each response, by nonce.
+	responses map[string]int
+	// clusters holds the names of the clusters the proxy has. It is nil until the first CDS response.
+	clusters map[string]struct{}
+	routes   map[string]*route.RouteConfiguration
+	// dangling holds the route to cluster references already reported, so each is only reported once.
+	dangling map[string]struct{}
+}
+
+func (v *validator) report(index int, typeURL, nonce, resource, msg string) {
+	v.issues = append(v.issues, Issue{Index: index, TypeURL: typeURL, Nonce: nonce, Resource: resource, Message: msg})
+}
+
+// checkRequest reports the response rejected by a request, if any.
+func (v *validator) checkRequest(index int, typeURL, nonce string, detail *status.Status) {
+	if detail == nil {
+		return
+	}
+	if ri, f := v.responses[nonce]; f {
+		v.report(ri, typeURL, nonce, "", fmt.Sprintf("rejected by the proxy in entry %d: %s", index, detail.GetMessage()))
+		return
+	}
+	v.report(index, typeURL, nonce, "", "rejected an unknown response: "+detail.GetMessage())
+}
+
+// decode returns the name and content of a resource, or a nil message if it cannot be decoded.
+// Resources of types that are not known to this binary are skipped.
+func (v *validator) decode(index int, typeURL, nonce string, r *any.Any) (string, proto.Message) {
+	if v3.IsEnvoyType(typeURL) && r.GetTypeUrl() != typeURL {
+		v.report(index, typeURL, nonce, "", fmt.Sprintf("resource has type %s", r.GetTypeUrl()))
+		return "", nil
+	}
+	msg, err := r.UnmarshalNew()
+	if err != nil {
+		if !errors.Is(err, protoregistry.NotFound) {
+			v.report(index, typeURL, nonce, "", fmt.Sprintf("failed to decode resource: %v", err))
+		}
+		return "", nil
+	}
+	name := resourceName(msg)
+	if pgv, ok := msg.(interface{ Validate() error }); ok {
+		if err := pgv.Validate(); err != nil {
+			v.report(index, typeURL, nonce, name, fmt.Sprintf("invalid resource: %v", err))
+		}
+	}
+	return name, msg
+}
+
+func resourceName(msg proto.Message) string {
+	switch m := msg.(type) {
+	case *endpoint.ClusterLoadAssignment:
+		return m.GetClusterName()
+	case interface{ GetName() string }:
+		return m.GetName()
+	}
+	return ""
+}
+
+// apply updates the clusters and routes the proxy has, and checks the references between them. State of
+// the world responses replace all resources of their type.
+func (v *validator) apply(index int, typeURL, nonce string, resources map[string]proto.Message, removed []string, replace bool) {
+	switch typeURL {
+	case v3.ClusterType:
+		if replace || v.clusters == nil {
+			v.clusters = map[string]struct{}{}
+		}
+		for name := range resources {
+			v.clusters[name] = struct{}{}
+		}
+		for _, name := range removed {
+			delete(v.clusters, name)
+		}
+	case v3.RouteType:
+		if replace {
+			v.routes = map[string]*route.RouteConfiguration{}
+		}
+		for name, msg := range resources {
+			v.routes[name] = msg.(*route.RouteConfiguration)
+		}
+		for _, name := range removed {
+			delete(v.routes, name)
+		}
+	default:
+		return
+	}
+	v.checkReferences(index, typeURL, nonce)
+}
+
+func (v *validator) checkReferences(index int, typeURL, nonce string) {
+	if v.clusters == nil {
+		return
+	}
+	names := make([]string, 0, len(v.routes))
+	for name := range v.routes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	dangling := map[string]struct{}{}
+	for _, name := range names {
+		for _, c := range routeClusters(v.routes[name]) {
+			if _, f := v.clusters[c]; f {
+				continue
+			}
+			key := name + "/" + c
+			dangling[key] = struct{}{}
+			if _, f := v.dangling[key]; !f {
+				v.report(index, typeURL, nonce, name, fmt.Sprintf("route refers to unknown cluster %q", c))
+			}
+		}
+	}
+	v.dangling = dangling
+}
+
+func routeClusters(rc *route.RouteConfiguration) []string {
+	var clusters []string
+	for _, vh := range rc.GetVirtualHosts() {
+		for _, r := range vh.GetRoutes() {
+			action := r.GetRoute()
+			if action == nil {
+				continue
+			}
+			if c := action.GetCluster(); c != "" {
+				clusters = append(clusters, c)
+			}
+			for _, wc := range action.GetWeightedClusters().GetClusters() {
+				clusters = append(clusters, wc.GetName())
+			}
+		}
+	}
+	return clusters
+}
@@ -0,0 +1,128 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package xds_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/snapshot"
+	"istio.io/istio/pilot/pkg/xds"
+	"istio.io/istio/pilot/test/xdstest"
+)
+
+const snapshotKubeObjects = `apiVersion: v1
+kind: Service
+metadata:
+  name: app
+  namespace: default
+spec:
+  clusterIP: 10.0.0.1
+  selector:
+    app: app
+  ports:
+  - name: http
+    port: 80
+    targetPort: 8080
+---
+apiVersion: v1
+kind: Endpoints
+metadata:
+  name: app
+  namespace: default
+subsets:
+- addresses:
+  - ip: 1.2.3.4
+  - ip: 1.2.3.5
+  ports:
+  - name: http
+    port: 8080
+`
+
+const snapshotConfigs = `apiVersion: networking.istio.io/v1alpha3
+kind: ServiceEntry
+metadata:
+  name: external
+  namespace: default
+spec:
+  hosts:
+  - external.example.com
+  ports:
+  - number: 443
+    name: tls
+    protocol: TLS
+  resolution: STATIC
+  endpoints:
+  - address: 2.2.2.2
+---
+apiVersion: networking.istio.io/v1alpha3
+kind: DestinationRule
+metadata:
+  name: app
+  namespace: default
+spec:
+  host: app.default.svc.cluster.local
+  subsets:
+  - name: v1
+    labels:
+      version: v1
+`
+
+func TestSnapshot(t *testing.T) {
+	s := xds.NewFakeDiscoveryServer(t, xds.FakeOptions{
+		KubernetesObjectString: snapshotKubeObjects,
+		ConfigString:           snapshotConfigs,
+	})
+
+	// export the snapshot from the debug handler, as it would be from istiod
+	req, err := http.NewRequest("GET", "/debug/snapshot", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	s.Discovery.AddDebugHandlers(mux, false, nil)
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("failed to export the snapshot: %d %s", rr.Code, rr.Body.String())
+	}
+	snap, err := snapshot.Read(bytes.NewReader(rr.Body.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	imported := xds.NewFakeDiscoveryServer(t, xds.FakeOptions{Snapshot: snap})
+
+	proxy := &model.Proxy{Metadata: &model.NodeMetadata{Labels: map[string]string{"app": "app"}}}
+	if got, want := xdstest.MapKeys(xdstest.ExtractClusters(imported.Clusters(imported.SetupProxy(proxy)))),
+		xdstest.MapKeys(xdstest.ExtractClusters(s.Clusters(s.SetupProxy(proxy)))); !reflect.DeepEqual(got, want) {
+		t.Errorf("clusters mismatch: got %v, want %v", got, want)
+	}
+	if got, want := xdstest.ExtractListenerNames(imported.Listeners(imported.SetupProxy(proxy))),
+		xdstest.ExtractListenerNames(s.Listeners(s.SetupProxy(proxy))); !reflect.DeepEqual(got, want) {
+		t.Errorf("listeners mismatch: got %v, want %v", got, want)
+	}
+	if got, want := xdstest.ExtractLoadAssignments(imported.Endpoints(imported.SetupProxy(proxy))),
+		xdstest.ExtractLoadAssignments(s.Endpoints(s.SetupProxy(proxy))); !reflect.DeepEqual(got, want) {
+		t.Errorf("endpoints mismatch: got %v, want %v", got, want)
+	}
+	if got := xdstest.ExtractLoadAssignments(imported.Endpoints(imported.SetupProxy(proxy)))["outbound|80||app.default.svc.cluster.local"]; len(got) != 2 {
+		t.Errorf("expected the 2 endpoints of the snapshot, got %v", got)
+	}
+}
@@ -21,10 +21,12 @@ import (
 	"testing"
 	"time"
 
+	"github.com/golang/protobuf/proto"
 	"github.com/golang/protobuf/ptypes/any"
 	"go.uber.org/atomic"
 
 	"istio.io/istio/pilot/pkg/model"
+	v3 "istio.io/istio/pilot/pkg/xds/v3"
 	"istio.io/istio/pkg/config"
 	"istio.io/istio/pkg/config/schema/gvk"
 	"istio.io/istio/pkg/test/util/retry"
@@ -88,131 +90,245 @@ func TestXdsCache(t *testing.T) {
 		_, tok, _ := c.Get(entry)
 		c.Add(entry, tok, value)
 	}
-	t.Run("simple", func(t *testing.T) {
-		c := model.NewLenientXdsCache()
+	caches := map[string]func() model.XdsCache{
+		"lru":     model.NewLenientXdsCache,
+		"bytes":   func() model.XdsCache { return model.NewLenientByteXdsCache(1<<20, false) },
+		"sharded": func() model.XdsCache { return model.NewLenientByteXdsCache(1<<20, true) },
+	}
+	for name, newCache := range caches {
+		newCache := newCache
+		t.Run(name, func(t *testing.T) {
+			t.Run("simple", func(t *testing.T) {
+				c := newCache()
 
-		addWithToken(c, ep1, any1)
-		if !reflect.DeepEqual(c.Keys(), []string{ep1.Key()}) {
-			t.Fatalf("unexpected keys: %v, want %v", c.Keys(), ep1.Key())
-		}
-		if got, _, _ := c.Get(ep1); got != any1 {
-			t.Fatalf("unexpected result: %v, want %v", got, any1)
-		}
+				addWithToken(c, ep1, any1)
+				if !reflect.DeepEqual(c.Keys(), []string{ep1.Key()}) {
+					t.Fatalf("unexpected keys: %v, want %v", c.Keys(), ep1.Key())
+				}
+				if got, _, _ := c.Get(ep1); got != any1 {
+					t.Fatalf("unexpected result: %v, want %v", got, any1)
+				}
 
-		addWithToken(c, ep1, any2)
-		if got, _, _ := c.Get(ep1); got != any2 {
-			t.Fatalf("unexpected result: %v, want %v", got, any2)
-		}
+				addWithToken(c, ep1, any2)
+				if got, _, _ := c.Get(ep1); got != any2 {
+					t.Fatalf("unexpected result: %v, want %v", got, any2)
+				}
 
-		c.Clear(map[model.ConfigKey]struct{}{{Kind: gvk.ServiceEntry, Name: "foo.com"}: {}})
-		if _, _, f := c.Get(ep1); f {
-			t.Fatalf("unexpected result, found key when not expected: %v", c.Keys())
-		}
-	})
+				c.Clear(map[model.ConfigKey]struct{}{{Kind: gvk.ServiceEntry, Name: "foo.com"}: {}})
+				if _, _, f := c.Get(ep1); f {
+					t.Fatalf("unexpected result, found key when not expected: %v", c.Keys())
+				}
+			})
 
-	t.Run("multiple hostnames", func(t *testing.T) {
-		c := model.NewLenientXdsCache()
-		addWithToken(c, ep1, any1)
-		addWithToken(c, ep2, any2)
+			t.Run("multiple hostnames", func(t *testing.T) {
+				c := newCache()
+				addWithToken(c, ep1, any1)
+				addWithToken(c, ep2, any2)
 
-		if got, _, _ := c.Get(ep1); got != any1 {
-			t.Fatalf("unexpected result: %v, want %v", got, any1)
-		}
-		if got, _, _ := c.Get(ep2); got != any2 {
-			t.Fatalf("unexpected result: %v, want %v", got, any2)
-		}
-		c.Clear(map[model.ConfigKey]struct{}{{Kind: gvk.ServiceEntry, Name: "foo.com"}: {}})
-		if _, _, f := c.Get(ep1); f {
-			t.Fatalf("unexpected result, found key when not expected: %v", c.Keys())
-		}
-		if _, _, f := c.Get(ep2); f {
-			t.Fatalf("unexpected result, found key when not expected: %v", c.Keys())
-		}
-	})
+				if got, _, _ := c.Get(ep1); got != any1 {
+					t.Fatalf("unexpected result: %v, want %v", got, any1)
+				}
+				if got, _, _ := c.Get(ep2); got != any2 {
+					t.Fatalf("unexpected result: %v, want %v", got, any2)
+				}
+				c.Clear(map[model.ConfigKey]struct{}{{Kind: gvk.ServiceEntry, Name: "foo.com"}: {}})
+				if _, _, f := c.Get(ep1); f {
+					t.Fatalf("unexpected result, found key when not expected: %v", c.Keys())
+				}
+				if _, _, f := c.Get(ep2); f {
+					t.Fatalf("unexpected result, found key when not expected: %v", c.Keys())
+				}
+			})
 
-	t.Run("multiple destinationRules", func(t *testing.T) {
-		c := model.NewLenientXdsCache()
-		ep1 := ep1
-		ep1.destinationRule = &config.Config{Meta: config.Meta{Name: "a", Namespace: "b"}}
-		ep2 := ep2
-		ep2.destinationRule = &config.Config{Meta: config.Meta{Name: "b", Namespace: "b"}}
-		addWithToken(c, ep1, any1)
-		addWithToken(c, ep2, any2)
-		if got, _, _ := c.Get(ep1); got != any1 {
-			t.Fatalf("unexpected result: %v, want %v", got, any1)
-		}
-		if got, _, _ := c.Get(ep2); got != any2 {
-			t.Fatalf("unexpected result: %v, want %v", got, any2)
-		}
-		c.Clear(map[model.ConfigKey]struct{}{{Kind: gvk.DestinationRule, Name: "a", Namespace: "b"}: {}})
-		if _, _, f := c.Get(ep1); f {
-			t.Fatalf("unexpected result, found key when not expected: %v", c.Keys())
+			t.Run("multiple destinationRules", func(t *testing.T) {
+				c := newCache()
+				ep1 := ep1
+				ep1.destinationRule = &config.Config{Meta: config.Meta{Name: "a", Namespace: "b"}}
+				ep2 := ep2
+				ep2.destinationRule = &config.Config{Meta: config.Meta{Name: "b", Namespace: "b"}}
+				addWithToken(c, ep1, any1)
+				addWithToken(c, ep2, any2)
+				if got, _, _ := c.Get(ep1); got != any1 {
+					t.Fatalf("unexpected result: %v, want %v", got, any1)
+				}
+				if got, _, _ := c.Get(ep2); got != any2 {
+					t.Fatalf("unexpected result: %v, want %v", got, any2)
+				}
+				c.Clear(map[model.ConfigKey]struct{}{{Kind: gvk.DestinationRule, Name: "a", Namespace: "b"}: {}})
+				if _, _, f := c.Get(ep1); f {
+					t.Fatalf("unexpected result, found key when not expected: %v", c.Keys())
+				}
+				if got, _, _ := c.Get(ep2); got != any2 {
+					t.Fatalf("unexpected result: %v, want %v", got, any2)
+				}
+				c.Clear(map[model.ConfigKey]struct{}{{Kind: gvk.DestinationRule, Name: "b", Namespace: "b"}: {}})
+				if _, _, f := c.Get(ep1); f {
+					t.Fatalf("unexpected result, found key when not expected: %v", c.Keys())
+				}
+				if _, _, f := c.Get(ep2); f {
+					t.Fatalf("unexpected result, found key when not expected: %v", c.Keys())
+				}
+			})
+
+			t.Run("clear all", func(t *testing.T) {
+				c := newCache()
+				addWithToken(c, ep1, any1)
+				addWithToken(c, ep2, any2)
+
+				c.ClearAll()
+				if len(c.Keys()) != 0 {
+					t.Fatalf("expected no keys, got: %v", c.Keys())
+				}
+				if _, _, f := c.Get(ep1); f {
+					t.Fatalf("unexpected result, found key when not expected: %v", c.Keys())
+				}
+				if _, _, f := c.Get(ep2); f {
+					t.Fatalf("unexpected result, found key when not expected: %v", c.Keys())
+				}
+			})
+
+			t.Run("dependent type clears all", func(t *testing.T) {
+				c := newCache()
+				addWithToken(c, ep1, any1)
+				addWithToken(c, ep2, any2)
+
+				c.Clear(map[model.ConfigKey]struct{}{{Kind: gvk.PeerAuthentication}: {}})
+				if len(c.Keys()) != 0 {
+					t.Fatalf("expected no keys, got: %v", c.Keys())
+				}
+				if _, _, f := c.Get(ep1); f {
+					t.Fatalf("unexpected result, found key when not expected: %v", c.Keys())
+				}
+				if _, _, f := c.Get(ep2); f {
+					t.Fatalf("unexpected result, found key when not expected: %v", c.Keys())
+				}
+			})
+
+			t.Run("write without token", func(t *testing.T) {
+				c := newCache()
+				c.Add(ep1, 0, any1)
+				if len(c.Keys()) != 0 {
+					t.Fatalf("expected no keys, got: %v", c.Keys())
+				}
+			})
+
+			t.Run("write with evicted token", func(t *testing.T) {
+				c := newCache()
+				addWithToken(c, ep1, any1)
+				if len(c.Keys()) != 1 {
+					t.Fatalf("expected 1 keys, got: %v", c.Keys())
+				}
+				_, tok, _ := c.Get(ep1)
+				c.ClearAll()
+				c.Add(ep1, tok, any1)
+				if len(c.Keys()) != 0 {
+					t.Fatalf("expected no keys, got: %v", c.Keys())
+				}
+			})
+		})
+	}
+}
+
+func TestByteXdsCache(t *testing.T) {
+	ep := func(i int) EndpointBuilder {
+		return EndpointBuilder{clusterName: fmt.Sprintf("outbound|%d||foo.com", i), service: &model.Service{Hostname: "foo.com"}}
+	}
+	secret := SecretResource{Type: "kubernetes", Name: "cert", Namespace: "default"}
+	addWithToken := func(c model.XdsCache, entry model.XdsCacheEntry, value *any.Any) {
+		_, tok, _ := c.Get(entry)
+		c.Add(entry, tok, value)
+	}
+	found := func(c model.XdsCache, entry model.XdsCacheEntry) bool {
+		_, _, f := c.Get(entry)
+		return f
+	}
+	// values are much larger than the tokens stored by Get, which also count against the budget
+	endpoints := &any.Any{TypeUrl: v3.EndpointType, Value: make([]byte, 1000)}
+	secretValue := &any.Any{TypeUrl: v3.SecretType, Value: make([]byte, 1000)}
+	epSize := int64(proto.Size(endpoints))
+	secretSize := int64(proto.Size(secretValue))
+
+	t.Run("evicts least recently used", func(t *testing.T) {
+		c := model.NewLenientByteXdsCache(3*epSize, false)
+		addWithToken(c, ep(1), endpoints)
+		addWithToken(c, ep(2), endpoints)
+		addWithToken(c, ep(3), endpoints)
+		// Read ep(1), so ep(2) is the least recently used
+		if !found(c, ep(1)) {
+			t.Fatalf("expected %v to be cached", ep(1).Key())
 		}
-		if got, _, _ := c.Get(ep2); got != any2 {
-			t.Fatalf("unexpected result: %v, want %v", got, any2)
+		addWithToken(c, ep(4), endpoints)
+		want := model.XdsCacheStats{Entries: 3, Bytes: 3 * epSize}
+		if got := c.Stats()[v3.EndpointType]; got != want {
+			t.Fatalf("unexpected stats: %+v, want %+v", got, want)
 		}
-		c.Clear(map[model.ConfigKey]struct{}{{Kind: gvk.DestinationRule, Name: "b", Namespace: "b"}: {}})
-		if _, _, f := c.Get(ep1); f {
-			t.Fatalf("unexpected result, found key when not expected: %v", c.Keys())
+		for _, i := range []int{1, 3, 4} {
+			if !found(c, ep(i)) {
+				t.Fatalf("expected %v to be cached", ep(i).Key())
+			}
 		}
-		if _, _, f := c.Get(ep2); f {
-			t.Fatalf("unexpected result, found key when not expected: %v", c.Keys())
+		// checked last, as the token stored by the miss takes space
+		if found(c, ep(2)) {
+			t.Fatalf("expected %v to be evicted", ep(2).Key())
 		}
 	})
 
-	t.Run("clear all", func(t *testing.T) {
-		c := model.NewLenientXdsCache()
-		addWithToken(c, ep1, any1)
-		addWithToken(c, ep2, any2)
-
-		c.ClearAll()
-		if len(c.Keys()) != 0 {
-			t.Fatalf("expected no keys, got: %v", c.Keys())
-		}
-		if _, _, f := c.Get(ep1); f {
-			t.Fatalf("unexpected result, found key when not expected: %v", c.Keys())
+	t.Run("value larger than budget", func(t *testing.T) {
+		c := model.NewLenientByteXdsCache(2*epSize, false)
+		addWithToken(c, ep(1), endpoints)
+		addWithToken(c, ep(2), &any.Any{TypeUrl: v3.EndpointType, Value: make([]byte, 10000)})
+		if !found(c, ep(1)) {
+			t.Fatalf("expected %v to be cached", ep(1).Key())
 		}
-		if _, _, f := c.Get(ep2); f {
-			t.Fatalf("unexpected result, found key when not expected: %v", c.Keys())
+		if found(c, ep(2)) {
+			t.Fatalf("expected %v to not be cached", ep(2).Key())
 		}
 	})
 
-	t.Run("dependent type clears all", func(t *testing.T) {
-		c := model.NewLenientXdsCache()
-		addWithToken(c, ep1, any1)
-		addWithToken(c, ep2, any2)
-
-		c.Clear(map[model.ConfigKey]struct{}{{Kind: gvk.PeerAuthentication}: {}})
-		if len(c.Keys()) != 0 {
-			t.Fatalf("expected no keys, got: %v", c.Keys())
+	t.Run("tokens count against budget", func(t *testing.T) {
+		c := model.NewLenientByteXdsCache(2*epSize, false)
+		addWithToken(c, ep(0), endpoints)
+		// entries that are read but never written
+		for i := 1; i <= 1000; i++ {
+			c.Get(ep(i))
 		}
-		if _, _, f := c.Get(ep1); f {
-			t.Fatalf("unexpected result, found key when not expected: %v", c.Keys())
+		if keys := c.Keys(); len(keys) >= 1000 {
+			t.Fatalf("expected tokens to be evicted, got %d keys", len(keys))
 		}
-		if _, _, f := c.Get(ep2); f {
-			t.Fatalf("unexpected result, found key when not expected: %v", c.Keys())
+		if found(c, ep(0)) {
+			t.Fatalf("expected %v to be evicted by the more recent tokens", ep(0).Key())
 		}
 	})
 
-	t.Run("write without token", func(t *testing.T) {
-		c := model.NewLenientXdsCache()
-		c.Add(ep1, 0, any1)
-		if len(c.Keys()) != 0 {
-			t.Fatalf("expected no keys, got: %v", c.Keys())
+	t.Run("unsharded evicts across types", func(t *testing.T) {
+		c := model.NewLenientByteXdsCache(2*epSize+secretSize, false)
+		addWithToken(c, secret, secretValue)
+		addWithToken(c, ep(1), endpoints)
+		addWithToken(c, ep(2), endpoints)
+		addWithToken(c, ep(3), endpoints)
+		if found(c, secret) {
+			t.Fatalf("expected %v to be evicted", secret.Key())
 		}
 	})
 
-	t.Run("write with evicted token", func(t *testing.T) {
-		c := model.NewLenientXdsCache()
-		addWithToken(c, ep1, any1)
-		if len(c.Keys()) != 1 {
-			t.Fatalf("expected 1 keys, got: %v", c.Keys())
+	t.Run("sharded evicts written type first", func(t *testing.T) {
+		c := model.NewLenientByteXdsCache(2*epSize+secretSize, true)
+		addWithToken(c, secret, secretValue)
+		addWithToken(c, ep(1), endpoints)
+		addWithToken(c, ep(2), endpoints)
+		addWithToken(c, ep(3), endpoints)
+		want := map[string]model.XdsCacheStats{
+			v3.EndpointType: {Entries: 2, Bytes: 2 * epSize},
+			v3.SecretType:   {Entries: 1, Bytes: secretSize},
 		}
-		_, tok, _ := c.Get(ep1)
-		c.ClearAll()
-		c.Add(ep1, tok, any1)
-		if len(c.Keys()) != 0 {
-			t.Fatalf("expected no keys, got: %v", c.Keys())
+		if got := c.Stats(); !reflect.DeepEqual(got, want) {
+			t.Fatalf("unexpected stats: %+v, want %+v", got, want)
+		}
+		if !found(c, secret) {
+			t.Fatalf("expected %v to be cached", secret.Key())
+		}
+		if found(c, ep(1)) {
+			t.Fatalf("expected %v to be evicted", ep(1).Key())
 		}
 	})
 }
@@ -0,0 +1,114 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Tool to validate and replay xDS streams recorded by istiod.
+//
+// Streams are recorded by setting PILOT_XDS_RECORDING_DIR on istiod, and selecting the proxies to record
+// with PILOT_XDS_RECORD_PROXIES or the /debug/recordz?proxyID=<pod>.<namespace> endpoint.
+//
+// To check the recorded responses the way a proxy would, reporting NACKs, invalid resources and routes
+// referring to unknown clusters:
+// ```bash
+// go run ./pilot/tools/replay --recording /tmp/xds/sidecar~10.0.0.1~httpbin.default~default.svc.cluster.local-1.jsonl
+// ```
+//
+// To send the recorded requests to a running istiod, such as a local pilot-discovery loaded with the config to
+// test or a port-forwarded istiod, and check its responses instead:
+// ```bash
+// kubectl port-forward -n istio-system deploy/istiod 15010 &
+// go run ./pilot/tools/replay --recording recording.jsonl --xds-address localhost:15010 --output replayed.jsonl
+// ```
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"google.golang.org/grpc"
+
+	"istio.io/istio/pilot/pkg/xds/recording"
+)
+
+var (
+	recordingFile = flag.String("recording", "", "Path of the recorded xDS stream")
+	xdsAddress    = flag.String("xds-address", "", "Plaintext xDS address of an istiod, such as localhost:15010. If set, the "+
+		"recorded requests are replayed against this server, and its responses are validated instead of the recorded ones.")
+	outputFile = flag.String("output", "", "If set, the replayed stream is written to this path")
+	wait       = flag.Duration("wait", 100*time.Millisecond,
+		"How long to wait for more responses after each replayed request")
+)
+
+func replay(entries []recording.Entry, address string) ([]recording.Entry, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	conn, err := grpc.DialContext(ctx, address, grpc.WithInsecure(), grpc.WithBlock())
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %v", address, err)
+	}
+	defer conn.Close()
+	return recording.Replay(context.Background(), conn, entries, *wait)
+}
+
+func write(path string, entries []recording.Entry) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	rec := recording.NewRecorder(f, "")
+	for _, e := range entries {
+		if err := rec.Record(e.Message); err != nil {
+			_ = rec.Close()
+			return err
+		}
+	}
+	return rec.Close()
+}
+
+func main() {
+	flag.Parse()
+	if *recordingFile == "" {
+		fmt.Fprintln(os.Stderr, "--recording is required")
+		os.Exit(2)
+	}
+	entries, err := recording.ReadFile(*recordingFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to read recording: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *xdsAddress != "" {
+		if entries, err = replay(entries, *xdsAddress); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to replay recording: %v\n", err)
+			os.Exit(1)
+		}
+		if *outputFile != "" {
+			if err := write(*outputFile, entries); err != nil {
+				fmt.Fprintf(os.Stderr, "failed to write replayed stream: %v\n", err)
+				os.Exit(1)
+			}
+		}
+	}
+
+	issues := recording.Validate(entries)
+	fmt.Printf("%d messages, %d issues\n", len(entries), len(issues))
+	for _, i := range issues {
+		fmt.Println(i)
+	}
+	if len(issues) > 0 {
+		os.Exit(1)
+	}
+}
@@ -113,6 +113,11 @@ type Config struct {
 	ResponseHandler ResponseHandler
 
 	GrpcOpts []grpc.DialOption
+
+	// Delta enables the incremental xDS protocol, using DeltaAggregatedResources instead of the state of the
+	// world StreamAggregatedResources. Received resources are accumulated per type, so the Wait*, Get* and Save
+	// helpers behave the same in both modes.
+	Delta bool
 }
 
 // ADSC implements a basic client for ADS, for use in stress tests and tools
@@ -121,6 +126,8 @@ type ADSC struct {
 	// Stream is the GRPC connection stream, allowing direct GRPC send operations.
 	// Set after Dial is called.
 	stream discovery.AggregatedDiscoveryService_StreamAggregatedResourcesClient
+	// deltaStream is the GRPC stream used instead of stream when Config.Delta is set.
+	deltaStream discovery.AggregatedDiscoveryService_DeltaAggregatedResourcesClient
 	// xds client used to create a stream
 	client discovery.AggregatedDiscoveryServiceClient
 	conn   *grpc.ClientConn
@@ -196,6 +203,24 @@ type ADSC struct {
 	sync     map[string]time.Time
 	syncCh   chan string
 	Locality *core.Locality
+
+	// deltaMutex protects delta. It may be acquired while holding mutex, but not the other way around.
+	deltaMutex sync.Mutex
+	// delta holds the state of each type when using the delta protocol, keyed by type URL.
+	delta map[string]*deltaState
+}
+
+// deltaState tracks the resources and subscriptions of a single type over a delta stream.
+type deltaState struct {
+	// subscribed holds the subscribed resource names. It is nil until the type is first requested on the
+	// current stream, and empty for wildcard subscriptions.
+	subscribed map[string]struct{}
+	// resources holds all received resources that have not been removed, keyed by name.
+	resources map[string]*discovery.Resource
+	// removed holds the resource names removed by the last response.
+	removed []string
+	// nonce is the nonce of the last response, which must be sent with subsequent requests.
+	nonce string
 }
 
 type ResponseHandler interface {
@@ -239,6 +264,7 @@ func New(discoveryAddr string, opts *Config) (*ADSC, error) {
 		syncCh:      make(chan string, len(collections.Pilot.All())),
 		sync:        map[string]time.Time{},
 		errChan:     make(chan error, 10),
+		delta:       map[string]*deltaState{},
 	}
 
 	if opts.Namespace == "" {
@@ -374,7 +400,12 @@ func (a *ADSC) Close() {
 func (a *ADSC) Run() error {
 	var err error
 	a.client = discovery.NewAggregatedDiscoveryServiceClient(a.conn)
-	a.stream, err = a.client.StreamAggregatedResources(context.Background())
+	if a.cfg.Delta {
+		a.deltaStream, err = a.client.DeltaAggregatedResources(context.Background())
+		a.resetDeltaSubscriptions()
+	} else {
+		a.stream, err = a.client.StreamAggregatedResources(context.Background())
+	}
 	if err != nil {
 		return err
 	}
@@ -392,7 +423,11 @@ func (a *ADSC) Run() error {
 
 	a.RecvWg.Add(1)
 
-	go a.handleRecv()
+	if a.cfg.Delta {
+		go a.handleDeltaRecv()
+	} else {
+		go a.handleRecv()
+	}
 	return nil
 }
 
@@ -429,121 +464,143 @@ func (a *ADSC) reconnect() {
 
 func (a *ADSC) handleRecv() {
 	for {
-		var err error
 		msg, err := a.stream.Recv()
 		if err != nil {
-			a.RecvWg.Done()
-			adscLog.Infof("Connection closed for node %v with err: %v", a.nodeID, err)
-			a.errChan <- err
-			// if 'reconnect' enabled - schedule a new Run
-			if a.cfg.BackoffPolicy != nil {
-				time.AfterFunc(a.cfg.BackoffPolicy.NextBackOff(), a.reconnect)
-			} else {
-				a.Close()
-				a.WaitClear()
-				a.Updates <- ""
-				a.XDSUpdates <- nil
-				close(a.errChan)
-			}
+			a.handleRecvError(err)
 			return
 		}
-
-		// Group-value-kind - used for high level api generator.
-		gvk := strings.SplitN(msg.TypeUrl, "/", 3)
-
 		adscLog.Info("Received ", a.url, " type ", msg.TypeUrl,
 			" cnt=", len(msg.Resources), " nonce=", msg.Nonce)
-		if a.cfg.ResponseHandler != nil {
-			a.cfg.ResponseHandler.HandleResponse(a, msg)
+		a.handleResponse(msg)
+	}
+}
+
+func (a *ADSC) handleDeltaRecv() {
+	for {
+		msg, err := a.deltaStream.Recv()
+		if err != nil {
+			a.handleRecvError(err)
+			return
 		}
+		adscLog.Info("Received delta ", a.url, " type ", msg.TypeUrl,
+			" cnt=", len(msg.Resources), " removed=", len(msg.RemovedResources), " nonce=", msg.Nonce)
+		a.handleResponse(a.applyDelta(msg))
+	}
+}
+
+func (a *ADSC) handleRecvError(err error) {
+	a.RecvWg.Done()
+	adscLog.Infof("Connection closed for node %v with err: %v", a.nodeID, err)
+	a.errChan <- err
+	// if 'reconnect' enabled - schedule a new Run
+	if a.cfg.BackoffPolicy != nil {
+		time.AfterFunc(a.cfg.BackoffPolicy.NextBackOff(), a.reconnect)
+	} else {
+		a.Close()
+		a.WaitClear()
+		a.Updates <- ""
+		a.XDSUpdates <- nil
+		close(a.errChan)
+	}
+}
+
+// handleResponse processes a response containing all resources of its type. For the delta protocol,
+// this is the accumulated state rather than the delta itself.
+func (a *ADSC) handleResponse(msg *discovery.DiscoveryResponse) {
+	var err error
+	// Group-value-kind - used for high level api generator.
+	gvk := strings.SplitN(msg.TypeUrl, "/", 3)
+
+	if a.cfg.ResponseHandler != nil {
+		a.cfg.ResponseHandler.HandleResponse(a, msg)
+	}
 
-		if msg.TypeUrl == collections.IstioMeshV1Alpha1MeshConfig.Resource().GroupVersionKind().String() &&
-			len(msg.Resources) > 0 {
-			rsc := msg.Resources[0]
-			m := &v1alpha1.MeshConfig{}
-			err = proto.Unmarshal(rsc.Value, m)
+	if msg.TypeUrl == collections.IstioMeshV1Alpha1MeshConfig.Resource().GroupVersionKind().String() &&
+		len(msg.Resources) > 0 {
+		rsc := msg.Resources[0]
+		m := &v1alpha1.MeshConfig{}
+		err = proto.Unmarshal(rsc.Value, m)
+		if err != nil {
+			adscLog.Warn("Failed to unmarshal mesh config", err)
+		}
+		a.Mesh = m
+		if a.LocalCacheDir != "" {
+			// TODO: use jsonpb
+			strResponse, err := json.MarshalIndent(m, "  ", "  ")
 			if err != nil {
-				adscLog.Warn("Failed to unmarshal mesh config", err)
+				return
 			}
-			a.Mesh = m
-			if a.LocalCacheDir != "" {
-				// TODO: use jsonpb
-				strResponse, err := json.MarshalIndent(m, "  ", "  ")
-				if err != nil {
-					continue
-				}
-				err = ioutil.WriteFile(a.LocalCacheDir+"_mesh.json", strResponse, 0o644)
-				if err != nil {
-					continue
-				}
+			err = ioutil.WriteFile(a.LocalCacheDir+"_mesh.json", strResponse, 0o644)
+			if err != nil {
+				return
 			}
-			continue
 		}
+		return
+	}
 
-		// Process the resources.
-		listeners := []*listener.Listener{}
-		clusters := []*cluster.Cluster{}
-		routes := []*route.RouteConfiguration{}
-		eds := []*endpoint.ClusterLoadAssignment{}
-		a.VersionInfo[msg.TypeUrl] = msg.VersionInfo
-		switch msg.TypeUrl {
-		case v3.ListenerType:
-			for _, rsc := range msg.Resources {
-				valBytes := rsc.Value
-				ll := &listener.Listener{}
-				_ = proto.Unmarshal(valBytes, ll)
-				listeners = append(listeners, ll)
-			}
-			a.handleLDS(listeners)
-		case v3.ClusterType:
-			for _, rsc := range msg.Resources {
-				valBytes := rsc.Value
-				cl := &cluster.Cluster{}
-				_ = proto.Unmarshal(valBytes, cl)
-				clusters = append(clusters, cl)
-			}
-			a.handleCDS(clusters)
-		case v3.EndpointType:
-			for _, rsc := range msg.Resources {
-				valBytes := rsc.Value
-				el := &endpoint.ClusterLoadAssignment{}
-				_ = proto.Unmarshal(valBytes, el)
-				eds = append(eds, el)
-			}
-			a.handleEDS(eds)
-		case v3.RouteType:
-			for _, rsc := range msg.Resources {
-				valBytes := rsc.Value
-				rl := &route.RouteConfiguration{}
-				_ = proto.Unmarshal(valBytes, rl)
-				routes = append(routes, rl)
-			}
-			a.handleRDS(routes)
-		default:
-			a.handleMCP(gvk, msg.Resources)
+	// Process the resources.
+	listeners := []*listener.Listener{}
+	clusters := []*cluster.Cluster{}
+	routes := []*route.RouteConfiguration{}
+	eds := []*endpoint.ClusterLoadAssignment{}
+	a.VersionInfo[msg.TypeUrl] = msg.VersionInfo
+	switch msg.TypeUrl {
+	case v3.ListenerType:
+		for _, rsc := range msg.Resources {
+			valBytes := rsc.Value
+			ll := &listener.Listener{}
+			_ = proto.Unmarshal(valBytes, ll)
+			listeners = append(listeners, ll)
+		}
+		a.handleLDS(listeners)
+	case v3.ClusterType:
+		for _, rsc := range msg.Resources {
+			valBytes := rsc.Value
+			cl := &cluster.Cluster{}
+			_ = proto.Unmarshal(valBytes, cl)
+			clusters = append(clusters, cl)
+		}
+		a.handleCDS(clusters)
+	case v3.EndpointType:
+		for _, rsc := range msg.Resources {
+			valBytes := rsc.Value
+			el := &endpoint.ClusterLoadAssignment{}
+			_ = proto.Unmarshal(valBytes, el)
+			eds = append(eds, el)
+		}
+		a.handleEDS(eds)
+	case v3.RouteType:
+		for _, rsc := range msg.Resources {
+			valBytes := rsc.Value
+			rl := &route.RouteConfiguration{}
+			_ = proto.Unmarshal(valBytes, rl)
+			routes = append(routes, rl)
 		}
+		a.handleRDS(routes)
+	default:
+		a.handleMCP(gvk, msg.Resources)
+	}
 
-		// If we got no resource - still save to the store with empty name/namespace, to notify sync
-		// This scheme also allows us to chunk large responses !
+	// If we got no resource - still save to the store with empty name/namespace, to notify sync
+	// This scheme also allows us to chunk large responses !
 
-		// TODO: add hook to inject nacks
+	// TODO: add hook to inject nacks
 
-		a.mutex.Lock()
-		if len(gvk) == 3 {
-			gt := config.GroupVersionKind{Group: gvk[0], Version: gvk[1], Kind: gvk[2]}
-			if _, exist := a.sync[gt.String()]; !exist {
-				a.sync[gt.String()] = time.Now()
-				a.syncCh <- gt.String()
-			}
+	a.mutex.Lock()
+	if len(gvk) == 3 {
+		gt := config.GroupVersionKind{Group: gvk[0], Version: gvk[1], Kind: gvk[2]}
+		if _, exist := a.sync[gt.String()]; !exist {
+			a.sync[gt.String()] = time.Now()
+			a.syncCh <- gt.String()
 		}
-		a.Received[msg.TypeUrl] = msg
-		a.ack(msg)
-		a.mutex.Unlock()
+	}
+	a.Received[msg.TypeUrl] = msg
+	a.ack(msg)
+	a.mutex.Unlock()
 
-		select {
-		case a.XDSUpdates <- msg:
-		default:
-		}
+	select {
+	case a.XDSUpdates <- msg:
+	default:
 	}
 }
 
@@ -774,6 +831,15 @@ func (a *ADSC) Send(req *discovery.DiscoveryRequest) error {
 		a.sendNodeMeta = false
 	}
 	req.ResponseNonce = time.Now().String()
+	return a.send(req)
+}
+
+// send sends req on the active stream. In delta mode, the request is converted to a delta request
+// which updates the subscriptions of its type to match the requested resource names.
+func (a *ADSC) send(req *discovery.DiscoveryRequest) error {
+	if a.cfg.Delta {
+		return a.sendDelta(req)
+	}
 	return a.stream.Send(req)
 }
 
@@ -794,7 +860,7 @@ func (a *ADSC) handleEDS(eds []*endpoint.ClusterLoadAssignment) {
 	}
 	if a.InitialLoad == 0 {
 		// first load - Envoy loads listeners after endpoints
-		_ = a.stream.Send(&discovery.DiscoveryRequest{
+		_ = a.send(&discovery.DiscoveryRequest{
 			Node:    a.node(),
 			TypeUrl: v3.ListenerType,
 		})
@@ -972,7 +1038,7 @@ func XdsInitialRequests() []*discovery.DiscoveryRequest {
 // it will start watching RDS and LDS.
 func (a *ADSC) Watch() {
 	a.watchTime = time.Now()
-	_ = a.stream.Send(&discovery.DiscoveryRequest{
+	_ = a.send(&discovery.DiscoveryRequest{
 		Node:    a.node(),
 		TypeUrl: v3.ClusterType,
 	})
@@ -994,14 +1060,14 @@ func ConfigInitialRequests() []*discovery.DiscoveryRequest {
 
 // WatchConfig will use the new experimental API watching, similar with MCP.
 func (a *ADSC) WatchConfig() {
-	_ = a.stream.Send(&discovery.DiscoveryRequest{
+	_ = a.send(&discovery.DiscoveryRequest{
 		ResponseNonce: time.Now().String(),
 		Node:          a.node(),
 		TypeUrl:       collections.IstioMeshV1Alpha1MeshConfig.Resource().GroupVersionKind().String(),
 	})
 
 	for _, sch := range collections.Pilot.All() {
-		_ = a.stream.Send(&discovery.DiscoveryRequest{
+		_ = a.send(&discovery.DiscoveryRequest{
 			ResponseNonce: time.Now().String(),
 			Node:          a.node(),
 			TypeUrl:       sch.Resource().GroupVersionKind().String(),
@@ -1037,7 +1103,7 @@ func (a *ADSC) sendRsc(typeurl string, rsc []string) {
 		version = ex.VersionInfo
 		nonce = ex.Nonce
 	}
-	_ = a.stream.Send(&discovery.DiscoveryRequest{
+	_ = a.send(&discovery.DiscoveryRequest{
 		ResponseNonce: nonce,
 		VersionInfo:   version,
 		Node:          a.node(),
@@ -1047,6 +1113,14 @@ func (a *ADSC) sendRsc(typeurl string, rsc []string) {
 }
 
 func (a *ADSC) ack(msg *discovery.DiscoveryResponse) {
+	if a.cfg.Delta {
+		// Delta acks only carry the nonce; subscriptions are unchanged.
+		_ = a.deltaStream.Send(&discovery.DeltaDiscoveryRequest{
+			ResponseNonce: msg.Nonce,
+			TypeUrl:       msg.TypeUrl,
+		})
+		return
+	}
 	var resources []string
 	if msg.TypeUrl == v3.EndpointType {
 		for c := range a.edsClusters {
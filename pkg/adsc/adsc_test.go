@@ -37,6 +37,8 @@ import (
 	networking "istio.io/api/networking/v1alpha3"
 	"istio.io/istio/pilot/pkg/config/memory"
 	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/networking/util"
+	v3 "istio.io/istio/pilot/pkg/xds/v3"
 	"istio.io/istio/pkg/config/schema/collections"
 )
 
@@ -48,8 +50,13 @@ func (t *testAdscRunServer) StreamAggregatedResources(stream xdsapi.AggregatedDi
 	return StreamHandler(stream)
 }
 
-func (t *testAdscRunServer) DeltaAggregatedResources(xdsapi.AggregatedDiscoveryService_DeltaAggregatedResourcesServer) error {
-	return nil
+var DeltaStreamHandler func(stream xdsapi.AggregatedDiscoveryService_DeltaAggregatedResourcesServer) error
+
+func (t *testAdscRunServer) DeltaAggregatedResources(stream xdsapi.AggregatedDiscoveryService_DeltaAggregatedResourcesServer) error {
+	if DeltaStreamHandler == nil {
+		return nil
+	}
+	return DeltaStreamHandler(stream)
 }
 
 func TestADSC_Run(t *testing.T) {
@@ -147,6 +154,149 @@ func TestADSC_Run(t *testing.T) {
 	}
 }
 
+func TestADSC_RunDelta(t *testing.T) {
+	staticCluster := &cluster.Cluster{
+		Name:                 "static",
+		ClusterDiscoveryType: &cluster.Cluster_Type{Type: cluster.Cluster_STATIC},
+	}
+	edsCluster := &cluster.Cluster{
+		Name:                 "eds",
+		ClusterDiscoveryType: &cluster.Cluster_Type{Type: cluster.Cluster_EDS},
+	}
+	toResource := func(c *cluster.Cluster) *xdsapi.Resource {
+		return &xdsapi.Resource{Name: c.Name, Version: "1", Resource: util.MessageToAny(c)}
+	}
+	expectRequest := func(stream xdsapi.AggregatedDiscoveryService_DeltaAggregatedResourcesServer,
+		typeURL, nonce string, subscribe []string) {
+		req, err := stream.Recv()
+		if err != nil {
+			t.Errorf("failed to receive request: %v", err)
+			return
+		}
+		if req.TypeUrl != typeURL || req.ResponseNonce != nonce || !cmp.Equal(req.ResourceNamesSubscribe, subscribe) {
+			t.Errorf("unexpected request: got %v/%v/%v, want %v/%v/%v", req.TypeUrl, req.ResponseNonce, req.ResourceNamesSubscribe,
+				typeURL, nonce, subscribe)
+		}
+	}
+	DeltaStreamHandler = func(stream xdsapi.AggregatedDiscoveryService_DeltaAggregatedResourcesServer) error {
+		expectRequest(stream, v3.ClusterType, "", nil)
+		_ = stream.Send(&xdsapi.DeltaDiscoveryResponse{
+			TypeUrl:   v3.ClusterType,
+			Nonce:     "1",
+			Resources: []*xdsapi.Resource{toResource(staticCluster), toResource(edsCluster)},
+		})
+		// The EDS cluster is subscribed to before the CDS response is acked.
+		expectRequest(stream, v3.EndpointType, "", []string{"eds"})
+		expectRequest(stream, v3.ClusterType, "1", nil)
+		_ = stream.Send(&xdsapi.DeltaDiscoveryResponse{
+			TypeUrl:          v3.ClusterType,
+			Nonce:            "2",
+			RemovedResources: []string{"eds"},
+		})
+		expectRequest(stream, v3.ClusterType, "2", nil)
+		return nil
+	}
+	defer func() { DeltaStreamHandler = nil }()
+
+	l, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Unable to listen with tcp err %v", err)
+	}
+	xds := grpc.NewServer()
+	xdsapi.RegisterAggregatedDiscoveryServiceServer(xds, new(testAdscRunServer))
+	go func() {
+		_ = xds.Serve(l)
+	}()
+	defer xds.GracefulStop()
+
+	adsc := &ADSC{
+		Received:    make(map[string]*xdsapi.DiscoveryResponse),
+		Updates:     make(chan string),
+		XDSUpdates:  make(chan *xdsapi.DiscoveryResponse),
+		RecvWg:      sync.WaitGroup{},
+		VersionInfo: map[string]string{},
+		url:         l.Addr().String(),
+		cfg: &Config{
+			Delta:                    true,
+			InitialDiscoveryRequests: []*xdsapi.DiscoveryRequest{{TypeUrl: v3.ClusterType}},
+		},
+	}
+	if err := adsc.Dial(); err != nil {
+		t.Fatalf("Dial error: %v", err)
+	}
+	if err := adsc.Run(); err != nil {
+		t.Fatalf("ADSC: failed running %v", err)
+	}
+	adsc.RecvWg.Wait()
+
+	if got := adsc.GetClusters(); len(got) != 1 || got["static"] == nil {
+		t.Errorf("unexpected clusters: %v", got)
+	}
+	if got := adsc.GetEdsClusters(); len(got) != 0 {
+		t.Errorf("unexpected eds clusters: %v", got)
+	}
+	if got := adsc.GetRemovedResources(v3.ClusterType); !cmp.Equal(got, []string{"eds"}) {
+		t.Errorf("unexpected removed clusters: %v", got)
+	}
+	if got := adsc.GetSubscribedResources(v3.EndpointType); !cmp.Equal(got, []string{"eds"}) {
+		t.Errorf("unexpected endpoint subscriptions: %v", got)
+	}
+	if got := adsc.Received[v3.ClusterType].GetNonce(); got != "2" {
+		t.Errorf("unexpected nonce: %v", got)
+	}
+}
+
+func TestADSC_sendDelta(t *testing.T) {
+	adsc := &ADSC{cfg: &Config{Delta: true}}
+	adsc.delta = map[string]*deltaState{
+		v3.EndpointType: {
+			resources: map[string]*xdsapi.Resource{"a": {Name: "a", Version: "v1"}, "b": {Name: "b", Version: "v2"}},
+			nonce:     "stale",
+		},
+	}
+	adsc.resetDeltaSubscriptions()
+	sent := []*xdsapi.DeltaDiscoveryRequest{}
+	adsc.deltaStream = &fakeDeltaStream{send: func(req *xdsapi.DeltaDiscoveryRequest) {
+		sent = append(sent, req)
+	}}
+
+	_ = adsc.sendDelta(&xdsapi.DiscoveryRequest{TypeUrl: v3.EndpointType, ResourceNames: []string{"a", "b"}})
+	adsc.applyDelta(&xdsapi.DeltaDiscoveryResponse{TypeUrl: v3.EndpointType, Nonce: "1"})
+	_ = adsc.sendDelta(&xdsapi.DiscoveryRequest{TypeUrl: v3.EndpointType, ResourceNames: []string{"a", "b"}})
+	_ = adsc.sendDelta(&xdsapi.DiscoveryRequest{TypeUrl: v3.EndpointType, ResourceNames: []string{"a", "c"}})
+
+	want := []*xdsapi.DeltaDiscoveryRequest{
+		{
+			TypeUrl:                 v3.EndpointType,
+			ResourceNamesSubscribe:  []string{"a", "b"},
+			InitialResourceVersions: map[string]string{"a": "v1", "b": "v2"},
+		},
+		// The unchanged request is not sent
+		{
+			TypeUrl:                  v3.EndpointType,
+			ResponseNonce:            "1",
+			ResourceNamesSubscribe:   []string{"c"},
+			ResourceNamesUnsubscribe: []string{"b"},
+		},
+	}
+	if !cmp.Equal(sent, want, protocmp.Transform()) {
+		t.Fatalf("unexpected requests: %v", cmp.Diff(sent, want, protocmp.Transform()))
+	}
+	if got := adsc.GetSubscribedResources(v3.EndpointType); !cmp.Equal(got, []string{"a", "c"}) {
+		t.Fatalf("unexpected subscriptions: %v", got)
+	}
+}
+
+type fakeDeltaStream struct {
+	xdsapi.AggregatedDiscoveryService_DeltaAggregatedResourcesClient
+	send func(req *xdsapi.DeltaDiscoveryRequest)
+}
+
+func (f *fakeDeltaStream) Send(req *xdsapi.DeltaDiscoveryRequest) error {
+	f.send(req)
+	return nil
+}
+
 func TestADSC_Save(t *testing.T) {
 	tests := []struct {
 		desc         string
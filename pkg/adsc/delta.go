@@ -0,0 +1,155 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adsc
+
+import (
+	"sort"
+
+	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	"github.com/golang/protobuf/ptypes/any"
+)
+
+// deltaStateLocked returns the delta state of typeURL, creating it if needed. deltaMutex must be held.
+func (a *ADSC) deltaStateLocked(typeURL string) *deltaState {
+	if a.delta == nil {
+		a.delta = map[string]*deltaState{}
+	}
+	st := a.delta[typeURL]
+	if st == nil {
+		st = &deltaState{resources: map[string]*discovery.Resource{}}
+		a.delta[typeURL] = st
+	}
+	return st
+}
+
+// resetDeltaSubscriptions forgets the subscriptions and nonces of the previous stream, so each type is
+// requested again on a new stream. Received resources are kept, and reported to the server as initial
+// resource versions.
+func (a *ADSC) resetDeltaSubscriptions() {
+	a.deltaMutex.Lock()
+	defer a.deltaMutex.Unlock()
+	for _, st := range a.delta {
+		st.subscribed = nil
+		st.nonce = ""
+	}
+}
+
+// sendDelta converts a state of the world request to a delta request. The first request for a type
+// subscribes to the requested names, or to all resources if none are requested. Subsequent requests
+// subscribe to new names and unsubscribe from names that are no longer requested; if nothing changed,
+// no request is sent.
+func (a *ADSC) sendDelta(req *discovery.DiscoveryRequest) error {
+	a.deltaMutex.Lock()
+	st := a.deltaStateLocked(req.TypeUrl)
+	dr := &discovery.DeltaDiscoveryRequest{
+		Node:          req.Node,
+		TypeUrl:       req.TypeUrl,
+		ResponseNonce: st.nonce,
+	}
+	if st.subscribed == nil {
+		st.subscribed = map[string]struct{}{}
+		dr.ResourceNamesSubscribe = req.ResourceNames
+		dr.InitialResourceVersions = map[string]string{}
+		for name, r := range st.resources {
+			dr.InitialResourceVersions[name] = r.Version
+		}
+	} else {
+		want := map[string]struct{}{}
+		for _, name := range req.ResourceNames {
+			want[name] = struct{}{}
+			if _, f := st.subscribed[name]; !f {
+				dr.ResourceNamesSubscribe = append(dr.ResourceNamesSubscribe, name)
+			}
+		}
+		for name := range st.subscribed {
+			if _, f := want[name]; !f {
+				dr.ResourceNamesUnsubscribe = append(dr.ResourceNamesUnsubscribe, name)
+			}
+		}
+		if len(dr.ResourceNamesSubscribe) == 0 && len(dr.ResourceNamesUnsubscribe) == 0 {
+			a.deltaMutex.Unlock()
+			return nil
+		}
+	}
+	for _, name := range dr.ResourceNamesSubscribe {
+		st.subscribed[name] = struct{}{}
+	}
+	for _, name := range dr.ResourceNamesUnsubscribe {
+		delete(st.subscribed, name)
+		delete(st.resources, name)
+	}
+	a.deltaMutex.Unlock()
+	return a.deltaStream.Send(dr)
+}
+
+// applyDelta updates the state of the response type, and returns a state of the world response
+// holding all resources of the type, sorted by name.
+func (a *ADSC) applyDelta(msg *discovery.DeltaDiscoveryResponse) *discovery.DiscoveryResponse {
+	a.deltaMutex.Lock()
+	defer a.deltaMutex.Unlock()
+	st := a.deltaStateLocked(msg.TypeUrl)
+	for _, r := range msg.Resources {
+		st.resources[r.Name] = r
+	}
+	for _, name := range msg.RemovedResources {
+		delete(st.resources, name)
+	}
+	st.removed = msg.RemovedResources
+	st.nonce = msg.Nonce
+
+	names := make([]string, 0, len(st.resources))
+	for name := range st.resources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	resources := make([]*any.Any, 0, len(names))
+	for _, name := range names {
+		resources = append(resources, st.resources[name].Resource)
+	}
+	return &discovery.DiscoveryResponse{
+		VersionInfo: msg.SystemVersionInfo,
+		TypeUrl:     msg.TypeUrl,
+		Nonce:       msg.Nonce,
+		Resources:   resources,
+	}
+}
+
+// GetSubscribedResources returns the resource names subscribed to for typeURL, when using the delta
+// protocol. It is empty for wildcard subscriptions.
+func (a *ADSC) GetSubscribedResources(typeURL string) []string {
+	a.deltaMutex.Lock()
+	defer a.deltaMutex.Unlock()
+	st := a.delta[typeURL]
+	if st == nil {
+		return nil
+	}
+	names := make([]string, 0, len(st.subscribed))
+	for name := range st.subscribed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// GetRemovedResources returns the resource names removed by the last delta response for typeURL.
+func (a *ADSC) GetRemovedResources(typeURL string) []string {
+	a.deltaMutex.Lock()
+	defer a.deltaMutex.Unlock()
+	st := a.delta[typeURL]
+	if st == nil {
+		return nil
+	}
+	return st.removed
+}
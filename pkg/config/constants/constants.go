@@ -85,6 +85,9 @@ const (
 	// The data name in the ConfigMap of each namespace storing the root cert of non-Kube CA.
 	CACertNamespaceConfigMapDataName = "root-cert.pem"
 
+	// The data name in the ConfigMap of each namespace storing the certificate revocation list of non-Kube CA.
+	CACRLNamespaceConfigMapDataName = "ca-crl.pem"
+
 	// PodInfoLabelsPath is the filepath that pod labels will be stored
 	// This is typically set by the downward API
 	PodInfoLabelsPath = "./etc/istio/pod/labels"
@@ -133,4 +136,12 @@ const (
 
 	// TrustworthyJWTPath is the defaut 3P token to authenticate with third party services
 	TrustworthyJWTPath = "./var/run/secrets/tokens/istio-token"
+
+	// WasmImagePullSecretNameEnv is the Wasm VM environment variable naming the kubernetes.io/dockerconfigjson
+	// Secret, in the namespace of the proxy, used to pull modules from OCI registries. Istiod resolves it.
+	WasmImagePullSecretNameEnv = "ISTIO_META_WASM_IMAGE_PULL_SECRET_NAME"
+
+	// WasmImagePullSecretEnv is the Wasm VM environment variable carrying the content of the pull secret, in
+	// Docker config.json format. It is consumed by the agent and never forwarded to Envoy.
+	WasmImagePullSecretEnv = "ISTIO_META_WASM_IMAGE_PULL_SECRET"
 )
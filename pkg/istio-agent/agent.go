@@ -138,6 +138,10 @@ type AgentOptions struct {
 	ProxyIPAddresses []string
 
 	DownstreamGrpcOptions []grpc.ServerOption
+
+	// WasmModuleCacheMaxSize is the maximum total size in bytes of the Wasm modules cached by the agent.
+	// Zero uses the default size, and a negative value removes the limit.
+	WasmModuleCacheMaxSize int64
 }
 
 // NewAgent hosts the functionality for local SDS and XDS. This consists of the local SDS server and
@@ -326,6 +330,10 @@ func (a *Agent) newSecretManager() (*cache.SecretManagerClient, error) {
 			log.Infof("Using CA %s cert with certs: %s", a.secOpts.CAEndpoint, caCertFile)
 		}
 	}
+	// Istiod distributes the revocation list of its CA in the same config map as the root.
+	if a.secOpts.CRLFilePath == "" && a.FindRootCAForCA() == path.Join(CitadelCACertPath, constants.CACertNamespaceConfigMapDataName) {
+		a.secOpts.CRLFilePath = path.Join(CitadelCACertPath, constants.CACRLNamespaceConfigMapDataName)
+	}
 
 	// Will use TLS unless the reserved 15010 port is used ( istiod on an ipsec/secure VPC)
 	// rootCert may be nil - in which case the system roots are used, and the CA is expected to have public key
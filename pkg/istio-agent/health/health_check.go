@@ -103,6 +103,16 @@ func NewWorkloadHealthChecker(cfg *v1alpha3.ReadinessProbe, envoyProbe ready.Pro
 		probers = append(probers, &EnvoyProber{envoyProbe})
 	}
 	probers = append(probers, prober)
+	return newWorkloadHealthChecker(cfg, AggregateProber{Probes: probers})
+}
+
+// NewProberHealthChecker creates a health checker running prober with the delay, period, timeout and
+// thresholds of cfg. The health check method of cfg is ignored.
+func NewProberHealthChecker(cfg *v1alpha3.ReadinessProbe, prober Prober) *WorkloadHealthChecker {
+	return newWorkloadHealthChecker(fillInDefaults(cfg, nil), prober)
+}
+
+func newWorkloadHealthChecker(cfg *v1alpha3.ReadinessProbe, prober Prober) *WorkloadHealthChecker {
 	return &WorkloadHealthChecker{
 		config: applicationHealthCheckConfig{
 			InitialDelay:   time.Duration(cfg.InitialDelaySeconds) * time.Second,
@@ -111,7 +121,7 @@ func NewWorkloadHealthChecker(cfg *v1alpha3.ReadinessProbe, envoyProbe ready.Pro
 			SuccessThresh:  int(cfg.SuccessThreshold),
 			FailThresh:     int(cfg.FailureThreshold),
 		},
-		prober: AggregateProber{Probes: probers},
+		prober: prober,
 	}
 }
 
@@ -25,6 +25,9 @@ import (
 	"strconv"
 	"time"
 
+	"google.golang.org/grpc"
+	grpchealth "google.golang.org/grpc/health/grpc_health_v1"
+
 	"istio.io/api/networking/v1alpha3"
 	"istio.io/istio/pilot/cmd/pilot-agent/status"
 	"istio.io/istio/pilot/cmd/pilot-agent/status/ready"
@@ -162,6 +165,39 @@ func (t *TCPProber) Probe(timeout time.Duration) (ProbeResult, error) {
 	return Healthy, nil
 }
 
+// GRPCProber checks the health of the target with the gRPC health checking protocol.
+type GRPCProber struct {
+	Host string
+	Port uint32
+	// Service is the name of the service to check, or empty for the overall health of the server.
+	Service string
+}
+
+var _ Prober = &GRPCProber{}
+
+func (g *GRPCProber) Probe(timeout time.Duration) (ProbeResult, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	conn, err := grpc.DialContext(ctx, net.JoinHostPort(g.Host, strconv.Itoa(int(g.Port))), grpc.WithInsecure(), grpc.WithBlock())
+	// if we cant connect, count as fail
+	if err != nil {
+		return Unhealthy, err
+	}
+	defer func() {
+		if err := conn.Close(); err != nil {
+			healthCheckLog.Errorf("Unable to close gRPC connection: %v", err)
+		}
+	}()
+	res, err := grpchealth.NewHealthClient(conn).Check(ctx, &grpchealth.HealthCheckRequest{Service: g.Service})
+	if err != nil {
+		return Unhealthy, err
+	}
+	if res.Status != grpchealth.HealthCheckResponse_SERVING {
+		return Unhealthy, fmt.Errorf("status was not SERVING, bad status %v", res.Status)
+	}
+	return Healthy, nil
+}
+
 type ExecProber struct {
 	Config *v1alpha3.ExecHealthCheckConfig
 }
@@ -24,6 +24,10 @@ import (
 	"testing"
 	"time"
 
+	"google.golang.org/grpc"
+	grpchealth "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
 	"istio.io/api/networking/v1alpha3"
 	"istio.io/istio/tests/util/leak"
 )
@@ -124,6 +128,53 @@ func TestTcpProber(t *testing.T) {
 	}
 }
 
+func TestGRPCProber(t *testing.T) {
+	tests := []struct {
+		desc                string
+		service             string
+		expectedProbeResult ProbeResult
+	}{
+		{
+			desc:                "Healthy",
+			expectedProbeResult: Healthy,
+		},
+		{
+			desc:                "Unhealthy - Not serving",
+			service:             "not-serving",
+			expectedProbeResult: Unhealthy,
+		},
+		{
+			desc:                "Unhealthy - Unknown service",
+			service:             "unknown",
+			expectedProbeResult: Unhealthy,
+		},
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	healthServer := grpchealth.NewServer()
+	healthServer.SetServingStatus("not-serving", healthpb.HealthCheckResponse_NOT_SERVING)
+	server := grpc.NewServer()
+	healthpb.RegisterHealthServer(server, healthServer)
+	go func() {
+		_ = server.Serve(l)
+	}()
+	defer server.Stop()
+	port := uint32(l.Addr().(*net.TCPAddr).Port)
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			grpcProber := &GRPCProber{Host: "127.0.0.1", Port: port, Service: tt.service}
+			got, err := grpcProber.Probe(time.Second)
+			if got != tt.expectedProbeResult || (got == Healthy) != (err == nil) {
+				t.Errorf("%s: got: %v, expected: %v, got error: %v", tt.desc, got, tt.expectedProbeResult, err)
+			}
+		})
+	}
+}
+
 func TestExecProber(t *testing.T) {
 	tests := []struct {
 		desc                string
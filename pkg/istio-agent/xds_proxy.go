@@ -124,6 +124,8 @@ func initXdsProxy(ia *Agent) (*XdsProxy, error) {
 	if ia.cfg.IsIPv6 {
 		localHostAddr = localHostIPv6
 	}
+	wasmOptions := wasm.DefaultOptions()
+	wasmOptions.MaxCacheSize = ia.cfg.WasmModuleCacheMaxSize
 	envoyProbe := &ready.Probe{
 		AdminPort:     uint16(ia.proxyConfig.ProxyAdminPort),
 		LocalHostAddr: localHostAddr,
@@ -136,7 +138,7 @@ func initXdsProxy(ia *Agent) (*XdsProxy, error) {
 		healthChecker:         health.NewWorkloadHealthChecker(ia.proxyConfig.ReadinessProbe, envoyProbe, ia.cfg.ProxyIPAddresses, ia.cfg.IsIPv6),
 		xdsHeaders:            ia.cfg.XDSHeaders,
 		xdsUdsPath:            ia.cfg.XdsUdsPath,
-		wasmCache:             wasm.NewLocalFileCache(constants.IstioDataDir, wasm.DefaultWasmModulePurgeInteval, wasm.DefaultWasmModuleExpiry),
+		wasmCache:             wasm.NewLocalFileCache(constants.IstioDataDir, wasmOptions),
 		proxyAddresses:        ia.cfg.ProxyIPAddresses,
 		downstreamGrpcOptions: ia.cfg.DownstreamGrpcOptions,
 	}
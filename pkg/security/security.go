@@ -53,9 +53,20 @@ const (
 	// TODO: change all the pilot one reference definition here instead.
 	WorkloadKeyCertResourceName = "default"
 
+	// NamedSecretResourcePrefix is the prefix of the resource names of the named secrets: the key and
+	// certificate of the secret <name> are requested as named://<name>, and its root certificate as
+	// named://<name>-cacert.
+	NamedSecretResourcePrefix = "named://"
+
+	// NamedSecretRootSuffix is the suffix of the resource names of the root certificates of the named secrets.
+	NamedSecretRootSuffix = "-cacert"
+
 	// Credential fetcher type
-	GCE  = "GoogleComputeEngine"
-	Mock = "Mock" // testing only
+	GCE     = "GoogleComputeEngine"
+	AWS     = "AmazonEC2"
+	Azure   = "AzureVM"
+	JWTFile = "JWTFile"
+	Mock    = "Mock" // testing only
 )
 
 // TODO: For 1.8, make sure MeshConfig is updated with those settings,
@@ -116,9 +127,13 @@ type Options struct {
 	ClusterID string
 
 	// The type of Elliptical Signature algorithm to use
-	// when generating private keys. Currently only ECDSA is supported.
+	// when generating private keys: ECDSA, or RSA_PSS for RSA keys signing with RSA-PSS.
 	ECCSigAlg string
 
+	// CSRDNSNames are the DNS names requested as SANs of the workload certificate, in addition
+	// to its SPIFFE identity. The CA only issues the DNS names allowed by its CSR policy.
+	CSRDNSNames []string
+
 	// FileMountedCerts indicates whether the proxy is using file
 	// mounted certs created by a foreign CA. Refresh is managed by the external
 	// CA, by updating the Secret or VM file. We will watch the file for changes
@@ -167,6 +182,74 @@ type Options struct {
 	// Delay in reading certificates from file after the change is detected. This is useful in cases
 	// where the write operation of key and cert take longer.
 	FileDebounceDuration time.Duration
+
+	// CRLFilePath is the path of the certificate revocation lists distributed with the workload root
+	// cert. If the file exists, revoked peer certificates are rejected.
+	CRLFilePath string
+
+	// KeyProvider is the provider of the private keys of workload certificates: empty for keys held in
+	// memory, "pkcs11" for keys held by a PKCS#11 token, or "envelope" for keys encrypted at rest.
+	KeyProvider string
+
+	// PKCS11Module is the path of the PKCS#11 module of the "pkcs11" key provider.
+	PKCS11Module string
+
+	// PKCS11TokenLabel is the label of the token holding the keys of the "pkcs11" key provider.
+	PKCS11TokenLabel string
+
+	// PKCS11PinFile is the file holding the user PIN of the token of the "pkcs11" key provider.
+	PKCS11PinFile string
+
+	// KeyEncryptionKeyFile is the file holding the key wrapping the data keys which encrypt
+	// private keys at rest with the "envelope" key provider.
+	KeyEncryptionKeyFile string
+
+	// NamedSecrets are the secrets, by name, served over SDS in addition to the workload certificate,
+	// such as a client certificate for calling an external API.
+	NamedSecrets map[string]NamedSecret
+}
+
+// NamedSecret is the source of a named secret: either files or a Kubernetes Secret.
+type NamedSecret struct {
+	// CertificatePath is the file of the certificate chain of the secret.
+	CertificatePath string `json:"certificate,omitempty"`
+
+	// PrivateKeyPath is the file of the private key of the secret.
+	PrivateKeyPath string `json:"privateKey,omitempty"`
+
+	// CaCertificatePath is the file of the root certificate of the secret.
+	CaCertificatePath string `json:"caCertificates,omitempty"`
+
+	// KubernetesSecret is the name of the Kubernetes Secret of the secret, in the namespace of the
+	// workload. It is read with the credentials of the service account of the pod.
+	KubernetesSecret string `json:"kubernetesSecret,omitempty"`
+}
+
+// Validate returns an error if the source of the secret is not either files or a Kubernetes Secret.
+func (s NamedSecret) Validate() error {
+	files := s.CertificatePath != "" || s.PrivateKeyPath != "" || s.CaCertificatePath != ""
+	switch {
+	case files && s.KubernetesSecret != "":
+		return fmt.Errorf("files and a Kubernetes Secret are mutually exclusive")
+	case !files && s.KubernetesSecret == "":
+		return fmt.Errorf("neither files nor a Kubernetes Secret are set")
+	case (s.CertificatePath == "") != (s.PrivateKeyPath == ""):
+		return fmt.Errorf("the certificate and private key files must be set together")
+	}
+	return nil
+}
+
+// NamedSecretFromResourceName returns the name of the named secret of an SDS resource, and whether the
+// resource is its root certificate. If the resource is not a named secret, false is returned.
+func NamedSecretFromResourceName(resourceName string) (name string, root bool, ok bool) {
+	if !strings.HasPrefix(resourceName, NamedSecretResourcePrefix) {
+		return "", false, false
+	}
+	name = strings.TrimPrefix(resourceName, NamedSecretResourcePrefix)
+	if strings.HasSuffix(name, NamedSecretRootSuffix) {
+		name, root = strings.TrimSuffix(name, NamedSecretRootSuffix), true
+	}
+	return name, root, name != ""
 }
 
 // TokenManager contains methods for generating token.
@@ -244,6 +327,9 @@ type SecretItem struct {
 
 	RootCert []byte
 
+	// CRL is the PEM encoded certificate revocation list for the root cert, if any.
+	CRL []byte
+
 	// ResourceName passed from envoy SDS discovery request.
 	// "ROOTCA" for root cert request, "default" for key/cert request.
 	ResourceName string
@@ -251,13 +337,26 @@ type SecretItem struct {
 	CreatedTime time.Time
 
 	ExpireTime time.Time
+
+	// PrivateKeyProvider is set instead of PrivateKey when the key cannot be exported,
+	// for Envoy to use the key through its private key provider.
+	PrivateKeyProvider *PrivateKeyProvider
+}
+
+// PrivateKeyProvider identifies a private key held by a key provider, such as a PKCS#11 token.
+type PrivateKeyProvider struct {
+	// ProviderName is the name of the Envoy private key provider.
+	ProviderName string
+
+	// Config is the configuration of the Envoy private key provider locating the key.
+	Config map[string]string
 }
 
 type CredFetcher interface {
 	// GetPlatformCredential fetches workload credential provided by the platform.
 	GetPlatformCredential() (string, error)
 
-	// GetType returns credential fetcher type. Currently the supported type is "GoogleComputeEngine".
+	// GetType returns credential fetcher type, one of "GoogleComputeEngine", "AmazonEC2", "AzureVM" or "JWTFile".
 	GetType() string
 
 	// The name of the IdentityProvider that can authenticate the workload credential.
@@ -15,13 +15,18 @@
 package wasm
 
 import (
+	"context"
 	"crypto/sha256"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -36,22 +41,58 @@ const (
 
 	// DefaultWasmModuleExpiry is the default duration for least recently touched Wasm module to become stale.
 	DefaultWasmModuleExpiry = 24 * time.Hour
+
+	// DefaultWasmModuleCacheMaxSize is the default byte budget of the local Wasm module files.
+	DefaultWasmModuleCacheMaxSize = 1 << 30
+
+	// indexFileName is the name of the file persisting the cache index, so modules survive agent restarts.
+	indexFileName = "wasm-cache-index.json"
 )
 
+// moduleFileName matches the names of module files written by the cache, which are named after their checksum.
+var moduleFileName = regexp.MustCompile(`^[0-9a-f]{64}\.wasm$`)
+
+// Options contains the configuration of a LocalFileCache.
+type Options struct {
+	// PurgeInterval is the interval for periodic stale Wasm module clean up.
+	PurgeInterval time.Duration
+	// ModuleExpiry is the duration for least recently touched Wasm module to become stale.
+	ModuleExpiry time.Duration
+	// MaxCacheSize is the maximum total size in bytes of the local Wasm module files. When it is exceeded,
+	// least recently used modules are evicted. Zero uses DefaultWasmModuleCacheMaxSize, and a negative value
+	// removes the limit.
+	MaxCacheSize int64
+}
+
+// DefaultOptions returns the default LocalFileCache configuration.
+func DefaultOptions() Options {
+	return Options{
+		PurgeInterval: DefaultWasmModulePurgeInteval,
+		ModuleExpiry:  DefaultWasmModuleExpiry,
+		MaxCacheSize:  DefaultWasmModuleCacheMaxSize,
+	}
+}
+
 // Cache models a Wasm module cache.
 type Cache interface {
-	Get(url, checksum string, timeout time.Duration) (string, error)
+	// Get returns the path of the local Wasm module file fetched from url. pullSecret holds
+	// registry credentials in Docker config.json format, and is only used for oci:// urls.
+	Get(url, checksum string, timeout time.Duration, pullSecret []byte) (string, error)
 	Cleanup()
 }
 
 // LocalFileCache for downloaded Wasm modules. Currently it stores the Wasm module as local file.
+// The cache index is persisted alongside the modules, so it is rebuilt from the directory on start up.
 type LocalFileCache struct {
 	// Map from Wasm module checksum to cache entry.
-	modules map[cacheKey]cacheEntry
+	modules map[cacheKey]*cacheEntry
 
 	// http fetcher fetches Wasm module with HTTP get.
 	httpFetcher *HTTPFetcher
 
+	// image fetcher fetches Wasm module stored as OCI image with the distribution API.
+	imageFetcher *ImageFetcher
+
 	// directory path used to store Wasm module.
 	dir string
 
@@ -62,6 +103,9 @@ type LocalFileCache struct {
 	purgeInterval    time.Duration
 	wasmModuleExpiry time.Duration
 
+	// maxCacheSize is the byte budget of the module files, or negative if unbounded.
+	maxCacheSize int64
+
 	// stopChan currently is only used by test
 	stopChan chan struct{}
 }
@@ -80,18 +124,38 @@ type cacheEntry struct {
 
 	// Last time that this local Wasm module is referenced.
 	last time.Time
+
+	// Size of the module file in bytes.
+	size int64
+}
+
+// indexEntry is the persisted form of a cache entry. Module paths are stored relative to the cache directory.
+type indexEntry struct {
+	DownloadURL string    `json:"downloadURL"`
+	Checksum    string    `json:"checksum"`
+	Module      string    `json:"module"`
+	Last        time.Time `json:"last"`
 }
 
 // NewLocalFileCache create a new Wasm module cache which downloads and stores Wasm module files locally.
-func NewLocalFileCache(dir string, purgeInterval, moduleExpiry time.Duration) *LocalFileCache {
+// Modules stored in dir by a previous instance of the cache are reused.
+func NewLocalFileCache(dir string, options Options) *LocalFileCache {
+	if options.MaxCacheSize == 0 {
+		options.MaxCacheSize = DefaultWasmModuleCacheMaxSize
+	}
 	cache := &LocalFileCache{
 		httpFetcher:      NewHTTPFetcher(),
-		modules:          make(map[cacheKey]cacheEntry),
+		imageFetcher:     NewImageFetcher(),
+		modules:          make(map[cacheKey]*cacheEntry),
 		dir:              dir,
-		purgeInterval:    purgeInterval,
-		wasmModuleExpiry: moduleExpiry,
+		purgeInterval:    options.PurgeInterval,
+		wasmModuleExpiry: options.ModuleExpiry,
+		maxCacheSize:     options.MaxCacheSize,
 		stopChan:         make(chan struct{}),
 	}
+	cache.mux.Lock()
+	cache.loadIndex()
+	cache.mux.Unlock()
 	go func() {
 		cache.purge()
 	}()
@@ -99,7 +163,7 @@ func NewLocalFileCache(dir string, purgeInterval, moduleExpiry time.Duration) *L
 }
 
 // Get returns path the local Wasm module file.
-func (c *LocalFileCache) Get(downloadURL, checksum string, timeout time.Duration) (string, error) {
+func (c *LocalFileCache) Get(downloadURL, checksum string, timeout time.Duration, pullSecret []byte) (string, error) {
 	url, err := url.Parse(downloadURL)
 	if err != nil {
 		return "", fmt.Errorf("fail to parse Wasm module fetch url: %s", downloadURL)
@@ -143,14 +207,96 @@ func (c *LocalFileCache) Get(downloadURL, checksum string, timeout time.Duration
 		}
 
 		return f, nil
+	case "oci":
+		return c.getImage(url, checksum, timeout, pullSecret)
 	default:
 		return "", fmt.Errorf("unsupported Wasm module downloading URL scheme: %v", url.Scheme)
 	}
 }
 
-// Cleanup closes background Wasm module purge routine.
+// getImage returns the path of the Wasm module stored in an OCI image. Modules are cached by the digest
+// of the image manifest rather than the reference, so a tag moving to a new image results in a new fetch.
+func (c *LocalFileCache) getImage(u *url.URL, checksum string, timeout time.Duration, pullSecret []byte) (string, error) {
+	ref, err := parseImageReference(u)
+	if err != nil {
+		return "", err
+	}
+	// When the image is referenced by digest, the cached module can be used without asking the registry.
+	if ref.isDigest() {
+		if modulePath := c.getEntry(imageCacheKey(ref, ref.reference)); modulePath != "" {
+			return checkImageChecksum(ref, modulePath, ref.reference, checksum)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), fetchTimeout(timeout))
+	defer cancel()
+	session, err := c.imageFetcher.newSession(ref, pullSecret)
+	if err != nil {
+		wasmRemoteFetchCount.With(resultTag.Value(downloadFailure)).Increment()
+		return "", err
+	}
+	m, digest, err := session.fetchManifest(ctx)
+	if err != nil {
+		wasmRemoteFetchCount.With(resultTag.Value(downloadFailure)).Increment()
+		return "", err
+	}
+	key := imageCacheKey(ref, digest)
+	if !ref.isDigest() {
+		if modulePath := c.getEntry(key); modulePath != "" {
+			return checkImageChecksum(ref, modulePath, digest, checksum)
+		}
+	}
+
+	b, err := session.fetchModule(ctx, m)
+	if err != nil {
+		wasmRemoteFetchCount.With(resultTag.Value(downloadFailure)).Increment()
+		return "", err
+	}
+
+	dChecksum := fmt.Sprintf("%x", sha256.Sum256(b))
+	if !imageChecksumMatches(checksum, dChecksum, digest) {
+		wasmRemoteFetchCount.With(resultTag.Value(checksumMismatch)).Increment()
+		return "", fmt.Errorf("module pulled from %v has checksum %v and image digest %v, which do not match: %v", ref, dChecksum, digest, checksum)
+	}
+
+	wasmRemoteFetchCount.With(resultTag.Value(fetchSuccess)).Increment()
+
+	f := filepath.Join(c.dir, fmt.Sprintf("%s.wasm", dChecksum))
+	if err := c.addEntry(key, b, f); err != nil {
+		return "", err
+	}
+	return f, nil
+}
+
+// checkImageChecksum verifies the checksum against a cached module. Module files are named after their checksum.
+func checkImageChecksum(ref imageReference, modulePath, digest, checksum string) (string, error) {
+	dChecksum := strings.TrimSuffix(filepath.Base(modulePath), ".wasm")
+	if !imageChecksumMatches(checksum, dChecksum, digest) {
+		return "", fmt.Errorf("module cached for %v has checksum %v and image digest %v, which do not match: %v", ref, dChecksum, digest, checksum)
+	}
+	return modulePath, nil
+}
+
+// imageChecksumMatches returns true if the provided checksum is empty, or is either the checksum
+// of the module itself or the digest of the image manifest.
+func imageChecksumMatches(checksum, moduleChecksum, digest string) bool {
+	return checksum == "" || checksum == moduleChecksum || strings.TrimPrefix(checksum, "sha256:") == strings.TrimPrefix(digest, "sha256:")
+}
+
+// imageCacheKey keys modules stored in images by repository and manifest digest.
+func imageCacheKey(ref imageReference, digest string) cacheKey {
+	return cacheKey{
+		downloadURL: "oci://" + ref.registry + "/" + ref.repository,
+		checksum:    digest,
+	}
+}
+
+// Cleanup closes background Wasm module purge routine, and persists the last touched time of the modules.
 func (c *LocalFileCache) Cleanup() {
 	close(c.stopChan)
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.saveIndex()
 }
 
 func (c *LocalFileCache) addEntry(key cacheKey, wasmModule []byte, f string) error {
@@ -169,12 +315,15 @@ func (c *LocalFileCache) addEntry(key cacheKey, wasmModule []byte, f string) err
 		return err
 	}
 
-	ce := cacheEntry{
+	ce := &cacheEntry{
 		modulePath: f,
 		last:       time.Now(),
+		size:       int64(len(wasmModule)),
 	}
 	c.modules[key] = ce
-	wasmCacheEntries.Record(float64(len(c.modules)))
+	c.evictLocked(ce)
+	c.recordCacheSize()
+	c.saveIndex()
 	return nil
 }
 
@@ -193,6 +342,171 @@ func (c *LocalFileCache) getEntry(key cacheKey) string {
 	return modulePath
 }
 
+// evictLocked removes least recently used entries until the module files fit in the byte budget.
+// keep is the entry that was just added, which is never evicted, even if it exceeds the budget by itself.
+func (c *LocalFileCache) evictLocked(keep *cacheEntry) {
+	if c.maxCacheSize <= 0 || c.totalSizeLocked() <= c.maxCacheSize {
+		return
+	}
+	keys := make([]cacheKey, 0, len(c.modules))
+	for k := range c.modules {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return c.modules[keys[i]].last.Before(c.modules[keys[j]].last)
+	})
+	for _, k := range keys {
+		if c.totalSizeLocked() <= c.maxCacheSize {
+			return
+		}
+		if c.modules[k] == keep || c.modules[k].modulePath == keep.modulePath {
+			continue
+		}
+		if err := c.removeEntryLocked(k); err != nil {
+			wasmLog.Errorf("failed to evict Wasm module %v: %v", c.modules[k].modulePath, err)
+			continue
+		}
+		wasmCacheEvictionCount.With(reasonTag.Value(evictionSize)).Increment()
+	}
+	if size := c.totalSizeLocked(); size > c.maxCacheSize {
+		wasmLog.Warnf("Wasm module cache size %d bytes exceeds the maximum %d bytes", size, c.maxCacheSize)
+	}
+}
+
+// removeEntryLocked deletes the entry, and its module file if no other entry refers to the same file.
+func (c *LocalFileCache) removeEntryLocked(key cacheKey) error {
+	ce := c.modules[key]
+	shared := false
+	for k, other := range c.modules {
+		if k != key && other.modulePath == ce.modulePath {
+			shared = true
+			break
+		}
+	}
+	if !shared {
+		if err := os.Remove(ce.modulePath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	delete(c.modules, key)
+	return nil
+}
+
+// totalSizeLocked returns the total size of the module files. Entries may share a file, for example
+// when the same module is referenced by several URLs, so each file is only counted once.
+func (c *LocalFileCache) totalSizeLocked() int64 {
+	seen := map[string]struct{}{}
+	var size int64
+	for _, ce := range c.modules {
+		if _, ok := seen[ce.modulePath]; ok {
+			continue
+		}
+		seen[ce.modulePath] = struct{}{}
+		size += ce.size
+	}
+	return size
+}
+
+func (c *LocalFileCache) recordCacheSize() {
+	wasmCacheEntries.Record(float64(len(c.modules)))
+	wasmCacheSize.Record(float64(c.totalSizeLocked()))
+}
+
+// loadIndex rebuilds the cache entries from the index persisted in the cache directory. Entries whose
+// module file is gone are dropped, and module files no entry refers to are removed.
+func (c *LocalFileCache) loadIndex() {
+	b, err := ioutil.ReadFile(filepath.Join(c.dir, indexFileName))
+	if err != nil && !os.IsNotExist(err) {
+		wasmLog.Warnf("failed to read Wasm module cache index: %v", err)
+	}
+	var entries []indexEntry
+	if len(b) > 0 {
+		if err := json.Unmarshal(b, &entries); err != nil {
+			wasmLog.Warnf("failed to parse Wasm module cache index, discarding it: %v", err)
+			entries = nil
+		}
+	}
+	for _, e := range entries {
+		// Only trust module files named by the cache itself, so a modified index cannot point elsewhere.
+		if !moduleFileName.MatchString(e.Module) {
+			continue
+		}
+		f := filepath.Join(c.dir, e.Module)
+		info, err := os.Stat(f)
+		if err != nil {
+			continue
+		}
+		c.modules[cacheKey{downloadURL: e.DownloadURL, checksum: e.Checksum}] = &cacheEntry{
+			modulePath: f,
+			last:       e.Last,
+			size:       info.Size(),
+		}
+	}
+
+	files, err := ioutil.ReadDir(c.dir)
+	if err != nil {
+		wasmLog.Warnf("failed to list Wasm module cache directory: %v", err)
+	}
+	referenced := map[string]struct{}{}
+	for _, ce := range c.modules {
+		referenced[ce.modulePath] = struct{}{}
+	}
+	for _, fi := range files {
+		f := filepath.Join(c.dir, fi.Name())
+		if _, ok := referenced[f]; ok || !moduleFileName.MatchString(fi.Name()) {
+			continue
+		}
+		if err := os.Remove(f); err != nil {
+			wasmLog.Warnf("failed to remove unreferenced Wasm module %v: %v", f, err)
+		}
+	}
+
+	if len(c.modules) > 0 {
+		wasmLog.Infof("loaded %d Wasm modules from cache directory %v", len(c.modules), c.dir)
+	}
+	c.evictLocked(&cacheEntry{})
+	c.recordCacheSize()
+	c.saveIndex()
+}
+
+// saveIndex persists the cache entries. The index is written to a temporary file and renamed, so a
+// crash never leaves a partially written index behind. Without any entries, the index is removed.
+func (c *LocalFileCache) saveIndex() {
+	f := filepath.Join(c.dir, indexFileName)
+	if len(c.modules) == 0 {
+		if err := os.Remove(f); err != nil && !os.IsNotExist(err) {
+			wasmLog.Warnf("failed to remove Wasm module cache index: %v", err)
+		}
+		return
+	}
+	entries := make([]indexEntry, 0, len(c.modules))
+	for k, ce := range c.modules {
+		entries = append(entries, indexEntry{
+			DownloadURL: k.downloadURL,
+			Checksum:    k.checksum,
+			Module:      filepath.Base(ce.modulePath),
+			Last:        ce.last,
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Module < entries[j].Module ||
+			(entries[i].Module == entries[j].Module && entries[i].DownloadURL < entries[j].DownloadURL)
+	})
+	b, err := json.Marshal(entries)
+	if err != nil {
+		wasmLog.Warnf("failed to marshal Wasm module cache index: %v", err)
+		return
+	}
+	tmp := f + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0644); err != nil {
+		wasmLog.Warnf("failed to write Wasm module cache index: %v", err)
+		return
+	}
+	if err := os.Rename(tmp, f); err != nil {
+		wasmLog.Warnf("failed to write Wasm module cache index: %v", err)
+	}
+}
+
 // Purge periodically clean up the stale Wasm modules local file and the cache map.
 func (c *LocalFileCache) purge() {
 	ticker := time.NewTicker(c.purgeInterval)
@@ -201,18 +515,23 @@ func (c *LocalFileCache) purge() {
 		select {
 		case <-ticker.C:
 			c.mux.Lock()
+			purged := false
 			for k, m := range c.modules {
 				if m.expired(c.wasmModuleExpiry) {
 					// The module has not be touched for expiry duration, delete it from the map as well as the local dir.
-					if err := os.Remove(m.modulePath); err != nil {
+					if err := c.removeEntryLocked(k); err != nil {
 						wasmLog.Errorf("failed to purge Wasm module %v: %v", m.modulePath, err)
 					} else {
-						delete(c.modules, k)
+						purged = true
+						wasmCacheEvictionCount.With(reasonTag.Value(evictionExpiry)).Increment()
 						wasmLog.Debugf("successfully removed stale Wasm module %v", m.modulePath)
 					}
 				}
 			}
-			wasmCacheEntries.Record(float64(len(c.modules)))
+			c.recordCacheSize()
+			if purged {
+				c.saveIndex()
+			}
 			c.mux.Unlock()
 		case <-c.stopChan:
 			// Currently this will only happen in test.
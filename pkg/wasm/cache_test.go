@@ -20,6 +20,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"path/filepath"
 	"strings"
 	"testing"
@@ -78,12 +79,12 @@ func TestWasmCache(t *testing.T) {
 		{
 			name:                 "invalid scheme",
 			initialCachedModules: map[cacheKey]cacheEntry{},
-			fetchURL:             "oci://abc",
+			fetchURL:             "ftp://abc",
 			purgeInterval:        DefaultWasmModulePurgeInteval,
 			wasmModuleExpiry:     DefaultWasmModuleExpiry,
 			checksum:             dataCheckSum,
 			wantFileName:         fmt.Sprintf("%x.wasm", dataCheckSum),
-			wantErrorMsgPrefix:   "unsupported Wasm module downloading URL scheme: oci",
+			wantErrorMsgPrefix:   "unsupported Wasm module downloading URL scheme: ftp",
 			wantServerReqNum:     0,
 		},
 		{
@@ -138,7 +139,7 @@ func TestWasmCache(t *testing.T) {
 	for _, c := range cases {
 		t.Run(c.name, func(t *testing.T) {
 			tmpDir := t.TempDir()
-			cache := NewLocalFileCache(tmpDir, c.purgeInterval, c.wasmModuleExpiry)
+			cache := NewLocalFileCache(tmpDir, Options{PurgeInterval: c.purgeInterval, ModuleExpiry: c.wasmModuleExpiry})
 			defer close(cache.stopChan)
 			tsNumRequest = 0
 
@@ -150,7 +151,7 @@ func TestWasmCache(t *testing.T) {
 					t.Fatalf("failed to write initial wasm module file %v", err)
 				}
 				cache.modules[cacheKey{downloadURL: k.downloadURL, checksum: k.checksum}] =
-					cacheEntry{modulePath: filePath, last: time.Now()}
+					&cacheEntry{modulePath: filePath, last: time.Now()}
 			}
 			cache.mux.Unlock()
 
@@ -168,7 +169,7 @@ func TestWasmCache(t *testing.T) {
 				}
 			}
 
-			gotFilePath, gotErr := cache.Get(c.fetchURL, fmt.Sprintf("%x", c.checksum), 0)
+			gotFilePath, gotErr := cache.Get(c.fetchURL, fmt.Sprintf("%x", c.checksum), 0, nil)
 			wantFilePath := filepath.Join(tmpDir, c.wantFileName)
 			if c.wantErrorMsgPrefix != "" {
 				if gotErr == nil {
@@ -191,7 +192,7 @@ func TestWasmCache(t *testing.T) {
 
 func TestWasmCacheMissChecksum(t *testing.T) {
 	tmpDir := t.TempDir()
-	cache := NewLocalFileCache(tmpDir, DefaultWasmModulePurgeInteval, DefaultWasmModuleExpiry)
+	cache := NewLocalFileCache(tmpDir, DefaultOptions())
 	defer close(cache.stopChan)
 
 	gotNumRequest := 0
@@ -210,7 +211,7 @@ func TestWasmCacheMissChecksum(t *testing.T) {
 
 	// Get wasm module three times, since checksum is not specified, it will be fetched from module server every time.
 	// 1st time
-	gotFilePath, err := cache.Get(ts.URL, "", 0)
+	gotFilePath, err := cache.Get(ts.URL, "", 0, nil)
 	if err != nil {
 		t.Fatalf("failed to download Wasm module: %v", err)
 	}
@@ -219,7 +220,7 @@ func TestWasmCacheMissChecksum(t *testing.T) {
 	}
 
 	// 2nd time
-	gotFilePath, err = cache.Get(ts.URL, "", 0)
+	gotFilePath, err = cache.Get(ts.URL, "", 0, nil)
 	if err != nil {
 		t.Fatalf("failed to download Wasm module: %v", err)
 	}
@@ -228,7 +229,7 @@ func TestWasmCacheMissChecksum(t *testing.T) {
 	}
 
 	// 3rd time
-	gotFilePath, err = cache.Get(ts.URL, "", 0)
+	gotFilePath, err = cache.Get(ts.URL, "", 0, nil)
 	if err != nil {
 		t.Fatalf("failed to download Wasm module: %v", err)
 	}
@@ -241,3 +242,126 @@ func TestWasmCacheMissChecksum(t *testing.T) {
 		t.Errorf("wasm download call got %v want %v", gotNumRequest, wantNumRequest)
 	}
 }
+
+func TestWasmCachePersistence(t *testing.T) {
+	var tsNumRequest int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tsNumRequest++
+		fmt.Fprintln(w, "data"+r.URL.Path)
+	}))
+	defer ts.Close()
+	dataCheckSum := fmt.Sprintf("%x", sha256.Sum256([]byte("data/\n")))
+	tmpDir := t.TempDir()
+
+	cache := NewLocalFileCache(tmpDir, DefaultOptions())
+	wantFilePath, err := cache.Get(ts.URL, dataCheckSum, 0, nil)
+	if err != nil {
+		t.Fatalf("failed to download Wasm module: %v", err)
+	}
+	cache.Cleanup()
+
+	// A module file which is not in the index, for example left behind by a crash, is removed on start up.
+	orphan := filepath.Join(tmpDir, fmt.Sprintf("%x.wasm", sha256.Sum256([]byte("orphan"))))
+	if err := ioutil.WriteFile(orphan, []byte("orphan"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// A new cache on the same directory serves the module without downloading it again.
+	cache = NewLocalFileCache(tmpDir, DefaultOptions())
+	defer cache.Cleanup()
+	gotFilePath, err := cache.Get(ts.URL, dataCheckSum, 0, nil)
+	if err != nil {
+		t.Fatalf("failed to get Wasm module: %v", err)
+	}
+	if gotFilePath != wantFilePath {
+		t.Errorf("wasm module path got %v want %v", gotFilePath, wantFilePath)
+	}
+	if tsNumRequest != 1 {
+		t.Errorf("test server request number got %v, want 1", tsNumRequest)
+	}
+	if _, err := os.Stat(orphan); !os.IsNotExist(err) {
+		t.Errorf("expected unreferenced module %v to be removed, got %v", orphan, err)
+	}
+}
+
+func TestWasmCacheMaxSize(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Each module is 10 bytes.
+		fmt.Fprintf(w, "module-%s", strings.TrimPrefix(r.URL.Path, "/"))
+	}))
+	defer ts.Close()
+	tmpDir := t.TempDir()
+	cache := NewLocalFileCache(tmpDir, Options{
+		PurgeInterval: DefaultWasmModulePurgeInteval,
+		ModuleExpiry:  DefaultWasmModuleExpiry,
+		MaxCacheSize:  25,
+	})
+	defer cache.Cleanup()
+
+	get := func(name string) string {
+		t.Helper()
+		p, err := cache.Get(ts.URL+"/"+name, "", 0, nil)
+		if err != nil {
+			t.Fatalf("failed to download Wasm module %v: %v", name, err)
+		}
+		return p
+	}
+	lookup := func(name string) bool {
+		cache.mux.Lock()
+		defer cache.mux.Unlock()
+		for k := range cache.modules {
+			if k.downloadURL == ts.URL+"/"+name {
+				return true
+			}
+		}
+		return false
+	}
+
+	a := get("aaa")
+	get("bbb")
+	// Touch a, so b is the least recently used module.
+	cache.getEntry(cacheKey{downloadURL: ts.URL + "/aaa", checksum: fmt.Sprintf("%x", sha256.Sum256([]byte("module-aaa")))})
+	get("ccc")
+
+	if lookup("bbb") {
+		t.Errorf("expected least recently used module to be evicted")
+	}
+	if !lookup("aaa") || !lookup("ccc") {
+		t.Errorf("expected recently used modules to be kept")
+	}
+	if _, err := os.Stat(a); err != nil {
+		t.Errorf("expected module file %v to be kept: %v", a, err)
+	}
+	files, err := filepath.Glob(filepath.Join(tmpDir, "*.wasm"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Errorf("got %d module files, want 2: %v", len(files), files)
+	}
+}
+
+func TestWasmCacheMaxSizeDefault(t *testing.T) {
+	cases := []struct {
+		name string
+		size int64
+		want int64
+	}{
+		{name: "zero uses default", size: 0, want: DefaultWasmModuleCacheMaxSize},
+		{name: "negative is unbounded", size: -1, want: -1},
+		{name: "explicit", size: 100, want: 100},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			cache := NewLocalFileCache(t.TempDir(), Options{
+				PurgeInterval: DefaultWasmModulePurgeInteval,
+				ModuleExpiry:  DefaultWasmModuleExpiry,
+				MaxCacheSize:  c.size,
+			})
+			defer cache.Cleanup()
+			if cache.maxCacheSize != c.want {
+				t.Errorf("got max cache size %d, want %d", cache.maxCacheSize, c.want)
+			}
+		})
+	}
+}
@@ -27,12 +27,19 @@ import (
 	"github.com/golang/protobuf/ptypes/any"
 	"go.uber.org/atomic"
 	"google.golang.org/protobuf/types/known/anypb"
+
+	"istio.io/istio/pkg/config/constants"
 )
 
 const (
 	apiTypePrefix      = "type.googleapis.com/"
 	typedStructType    = apiTypePrefix + "udpa.type.v1.TypedStruct"
 	wasmHTTPFilterType = apiTypePrefix + "envoy.extensions.filters.http.wasm.v3.Wasm"
+
+	// WasmSecretEnv is the name of the Wasm VM environment variable carrying the pull secret for
+	// modules stored in OCI registries, in Docker config.json format. It is consumed by the agent
+	// and never forwarded to Envoy.
+	WasmSecretEnv = constants.WasmImagePullSecretEnv
 )
 
 // MaybeConvertWasmExtensionConfig converts any presence of module remote download to local file.
@@ -133,6 +140,25 @@ func convert(resource *any.Any, cache Cache) (newExtensionConfig *any.Any, sendN
 		return
 	}
 
+	// The pull secret is consumed by the agent, so it is removed from the config forwarded to Envoy,
+	// including when the plugin fails open.
+	var pullSecret []byte
+	if envs := wasmHTTPFilterConfig.Config.GetVmConfig().GetEnvironmentVariables(); envs != nil {
+		if secret, ok := envs.KeyValues[WasmSecretEnv]; ok {
+			pullSecret = []byte(secret)
+			delete(envs.KeyValues, WasmSecretEnv)
+			stripped, err := marshalTypedStruct(ec, wasmStruct.TypeUrl, wasmHTTPFilterConfig)
+			if err != nil {
+				// Never forward the secret: Nack the config instead.
+				status = marshalFailure
+				sendNack = true
+				wasmLog.Errorf("failed to marshal Wasm HTTP filter without the pull secret: %v", err)
+				return
+			}
+			newExtensionConfig = stripped
+		}
+	}
+
 	if wasmHTTPFilterConfig.Config.GetVmConfig().GetCode().GetRemote() == nil {
 		wasmLog.Debugf("no remote load found in Wasm HTTP filter %+v", wasmHTTPFilterConfig)
 		return
@@ -156,7 +182,7 @@ func convert(resource *any.Any, cache Cache) (newExtensionConfig *any.Any, sendN
 	if remote.GetHttpUri().Timeout != nil {
 		timeout = remote.GetHttpUri().Timeout.AsDuration()
 	}
-	f, err := cache.Get(httpURI.GetUri(), remote.GetSha256(), timeout)
+	f, err := cache.Get(httpURI.GetUri(), remote.GetSha256(), timeout, pullSecret)
 	if err != nil {
 		status = fetchFailure
 		wasmLog.Errorf("cannot fetch Wasm module %v: %v", remote.GetHttpUri().GetUri(), err)
@@ -196,3 +222,19 @@ func convert(resource *any.Any, cache Cache) (newExtensionConfig *any.Any, sendN
 	sendNack = false
 	return
 }
+
+// marshalTypedStruct returns the extension config ec with the Wasm HTTP filter wasmHTTPFilterConfig,
+// wrapped in a TypedStruct of type typeURL.
+func marshalTypedStruct(ec *core.TypedExtensionConfig, typeURL string, wasmHTTPFilterConfig *wasm.Wasm) (*any.Any, error) {
+	value, err := conversion.MessageToStruct(wasmHTTPFilterConfig)
+	if err != nil {
+		return nil, err
+	}
+	// nolint: staticcheck
+	typedConfig, err := ptypes.MarshalAny(&udpa.TypedStruct{TypeUrl: typeURL, Value: value})
+	if err != nil {
+		return nil, err
+	}
+	out := &core.TypedExtensionConfig{Name: ec.GetName(), TypedConfig: typedConfig}
+	return anypb.New(out)
+}
@@ -25,6 +25,7 @@ import (
 	wasm "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/wasm/v3"
 	v3 "github.com/envoyproxy/go-control-plane/envoy/extensions/wasm/v3"
 	"github.com/envoyproxy/go-control-plane/pkg/conversion"
+	"github.com/golang/protobuf/ptypes"
 	"github.com/golang/protobuf/ptypes/any"
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/types/known/structpb"
@@ -34,7 +35,7 @@ import (
 
 type mockCache struct{}
 
-func (c *mockCache) Get(downloadURL, checksum string, timeout time.Duration) (string, error) {
+func (c *mockCache) Get(downloadURL, checksum string, timeout time.Duration, pullSecret []byte) (string, error) {
 	url, _ := url.Parse(downloadURL)
 	query := url.Query()
 
@@ -167,6 +168,66 @@ func TestWasmConvert(t *testing.T) {
 	}
 }
 
+func TestWasmConvertPullSecret(t *testing.T) {
+	cases := []struct {
+		name     string
+		uri      string
+		failOpen bool
+		wantNack bool
+	}{
+		{name: "remote load success", uri: "http://test?module=test.wasm"},
+		{name: "remote load fail open", uri: "http://test?module=test.wasm&error=download-error", failOpen: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			input := buildTypedStructExtensionConfig("pull-secret", &wasm.Wasm{
+				Config: &v3.PluginConfig{
+					Vm: &v3.PluginConfig_VmConfig{
+						VmConfig: &v3.VmConfig{
+							Code: &core.AsyncDataSource{Specifier: &core.AsyncDataSource_Remote{
+								Remote: &core.RemoteDataSource{HttpUri: &core.HttpUri{Uri: c.uri}},
+							}},
+							EnvironmentVariables: &v3.EnvironmentVariables{
+								KeyValues: map[string]string{WasmSecretEnv: "secret", "KEY": "value"},
+							},
+						},
+					},
+					FailOpen: c.failOpen,
+				},
+			})
+			resources := []*any.Any{util.MessageToAny(input)}
+			if gotNack := MaybeConvertWasmExtensionConfig(resources, &mockCache{}); gotNack != c.wantNack {
+				t.Fatalf("wasm config conversion send nack got %v want %v", gotNack, c.wantNack)
+			}
+
+			ec := &core.TypedExtensionConfig{}
+			if err := resources[0].UnmarshalTo(ec); err != nil {
+				t.Fatal(err)
+			}
+			wasmHTTPFilterConfig := &wasm.Wasm{}
+			if ec.GetTypedConfig().TypeUrl == typedStructType {
+				ts := &udpa.TypedStruct{}
+				// nolint: staticcheck
+				if err := ptypes.UnmarshalAny(ec.GetTypedConfig(), ts); err != nil {
+					t.Fatal(err)
+				}
+				if err := conversion.StructToMessage(ts.Value, wasmHTTPFilterConfig); err != nil {
+					t.Fatal(err)
+				}
+			} else if err := ec.GetTypedConfig().UnmarshalTo(wasmHTTPFilterConfig); err != nil {
+				t.Fatal(err)
+			}
+			envs := wasmHTTPFilterConfig.GetConfig().GetVmConfig().GetEnvironmentVariables().GetKeyValues()
+			if _, ok := envs[WasmSecretEnv]; ok {
+				t.Errorf("pull secret forwarded to Envoy: %v", envs)
+			}
+			if envs["KEY"] != "value" {
+				t.Errorf("expected other environment variables to be kept, got %v", envs)
+			}
+		})
+	}
+}
+
 func buildTypedStructExtensionConfig(name string, wasm *wasm.Wasm) *core.TypedExtensionConfig {
 	ws, _ := conversion.MessageToStruct(wasm)
 	return &core.TypedExtensionConfig{
@@ -0,0 +1,492 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wasm
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+const (
+	// Media types of manifests, as defined by the OCI image spec and Docker registry API.
+	ociManifestMediaType    = "application/vnd.oci.image.manifest.v1+json"
+	ociIndexMediaType       = "application/vnd.oci.image.index.v1+json"
+	dockerManifestMediaType = "application/vnd.docker.distribution.manifest.v2+json"
+	dockerListMediaType     = "application/vnd.docker.distribution.manifest.list.v2+json"
+
+	// Media types of layers containing the Wasm binary itself.
+	wasmLayerMediaType       = "application/vnd.module.wasm.content.layer.v1+wasm"
+	wasmOCILayerMediaType    = "application/vnd.wasm.content.layer.v1+wasm"
+	ociTarGzipLayerMediaType = "application/vnd.oci.image.layer.v1.tar+gzip"
+	dockerLayerMediaType     = "application/vnd.docker.image.rootfs.diff.tar.gzip"
+
+	// wasmFileName is the name of the Wasm binary in image layers that are file system tarballs.
+	wasmFileName = "plugin.wasm"
+
+	dockerHubRegistry    = "docker.io"
+	dockerHubAPIRegistry = "registry-1.docker.io"
+	dockerHubAuthKey     = "https://index.docker.io/v1/"
+
+	// maxManifestSize bounds the size of manifests we are willing to read. Registries commonly limit to 4MB.
+	maxManifestSize = 4 * 1024 * 1024
+	// maxModuleSize bounds the size of the layers, and of the Wasm binary extracted from them, that we are willing
+	// to hold in memory.
+	maxModuleSize = 256 * 1024 * 1024
+)
+
+var manifestAcceptHeader = strings.Join([]string{
+	ociManifestMediaType, ociIndexMediaType, dockerManifestMediaType, dockerListMediaType,
+}, ", ")
+
+// ImageFetcher fetches Wasm modules stored in OCI compliant registries, using the Docker/OCI distribution API.
+type ImageFetcher struct {
+	client *http.Client
+}
+
+// NewImageFetcher creates a new fetcher for Wasm modules stored as OCI images.
+func NewImageFetcher() *ImageFetcher {
+	return &ImageFetcher{
+		client: &http.Client{},
+	}
+}
+
+// imageReference is a parsed image reference, such as oci://gcr.io/project/plugin:v1.
+type imageReference struct {
+	// registry is the host (and port) of the registry API.
+	registry string
+	// repository is the name of the repository within the registry.
+	repository string
+	// reference is a tag, or a digest of the form sha256:<hex>.
+	reference string
+}
+
+func (r imageReference) isDigest() bool {
+	return strings.HasPrefix(r.reference, "sha256:")
+}
+
+func (r imageReference) String() string {
+	sep := ":"
+	if r.isDigest() {
+		sep = "@"
+	}
+	return r.registry + "/" + r.repository + sep + r.reference
+}
+
+// parseImageReference parses an oci:// URL into a reference. Images without a tag or digest default
+// to the "latest" tag, and Docker Hub short names are expanded like the Docker CLI does.
+func parseImageReference(u *url.URL) (imageReference, error) {
+	ref := imageReference{
+		registry: u.Host,
+	}
+	name := strings.TrimPrefix(u.Path, "/")
+	if ref.registry == "" || name == "" {
+		return ref, fmt.Errorf("invalid image reference %q: must be of the form oci://<registry>/<repository>[:tag|@digest]", u.String())
+	}
+	if i := strings.Index(name, "@"); i >= 0 {
+		ref.reference = name[i+1:]
+		name = name[:i]
+		if !strings.HasPrefix(ref.reference, "sha256:") || len(ref.reference) != len("sha256:")+64 {
+			return ref, fmt.Errorf("invalid image reference %q: unsupported digest %q", u.String(), ref.reference)
+		}
+	} else if i := strings.LastIndex(name, ":"); i >= 0 && !strings.Contains(name[i:], "/") {
+		ref.reference = name[i+1:]
+		name = name[:i]
+	} else {
+		ref.reference = "latest"
+	}
+	if name == "" || ref.reference == "" {
+		return ref, fmt.Errorf("invalid image reference %q", u.String())
+	}
+	if ref.registry == dockerHubRegistry {
+		ref.registry = dockerHubAPIRegistry
+		if !strings.Contains(name, "/") {
+			name = "library/" + name
+		}
+	}
+	ref.repository = name
+	return ref, nil
+}
+
+// descriptor describes a blob or manifest referenced by a manifest.
+type descriptor struct {
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+	Size      int64  `json:"size"`
+}
+
+// manifest covers image manifests as well as image indexes (manifest lists).
+type manifest struct {
+	MediaType string       `json:"mediaType"`
+	Layers    []descriptor `json:"layers"`
+	Manifests []descriptor `json:"manifests"`
+}
+
+// imageSession holds the state for fetching a single image, including any token obtained from the registry.
+type imageSession struct {
+	client      *http.Client
+	ref         imageReference
+	credentials *registryCredentials
+	// authorization is the value of the Authorization header sent to the registry, if any.
+	authorization string
+}
+
+// newSession prepares to fetch the image. pullSecret is the content of a Docker config.json
+// (kubernetes.io/dockerconfigjson secret) holding the registry credentials, and may be empty.
+func (f *ImageFetcher) newSession(ref imageReference, pullSecret []byte) (*imageSession, error) {
+	creds, err := credentialsForRegistry(pullSecret, ref.registry)
+	if err != nil {
+		return nil, err
+	}
+	return &imageSession{
+		client:      f.client,
+		ref:         ref,
+		credentials: creds,
+	}, nil
+}
+
+// fetchManifest resolves the image reference to an image manifest, and returns the manifest along with its digest.
+// The digest identifies the image content regardless of the tag used to reference it.
+func (s *imageSession) fetchManifest(ctx context.Context) (*manifest, string, error) {
+	body, digest, err := s.getManifest(ctx, s.ref.reference)
+	if err != nil {
+		return nil, "", err
+	}
+	if s.ref.isDigest() && digest != s.ref.reference {
+		return nil, "", fmt.Errorf("manifest of %v has digest %v, which does not match the reference", s.ref, digest)
+	}
+	m := &manifest{}
+	if err := json.Unmarshal(body, m); err != nil {
+		return nil, "", fmt.Errorf("failed to parse manifest of %v: %v", s.ref, err)
+	}
+	if m.MediaType == ociIndexMediaType || m.MediaType == dockerListMediaType || (len(m.Manifests) > 0 && len(m.Layers) == 0) {
+		// Wasm modules are platform independent, so any entry of an index will do.
+		if len(m.Manifests) == 0 {
+			return nil, "", fmt.Errorf("image index of %v has no manifests", s.ref)
+		}
+		child := m.Manifests[0].Digest
+		body, digest, err = s.getManifest(ctx, child)
+		if err != nil {
+			return nil, "", err
+		}
+		if digest != child {
+			return nil, "", fmt.Errorf("manifest %v of %v has digest %v, which does not match the index", child, s.ref, digest)
+		}
+		m = &manifest{}
+		if err := json.Unmarshal(body, m); err != nil {
+			return nil, "", fmt.Errorf("failed to parse manifest %v of %v: %v", child, s.ref, err)
+		}
+	}
+	return m, digest, nil
+}
+
+func (s *imageSession) getManifest(ctx context.Context, reference string) ([]byte, string, error) {
+	resp, err := s.get(ctx, "manifests/"+reference, manifestAcceptHeader)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxManifestSize))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read manifest of %v: %v", s.ref, err)
+	}
+	return body, fmt.Sprintf("sha256:%x", sha256.Sum256(body)), nil
+}
+
+// fetchModule downloads the Wasm binary from the image layers, verifying the layer digest.
+func (s *imageSession) fetchModule(ctx context.Context, m *manifest) ([]byte, error) {
+	for _, layer := range m.Layers {
+		switch layer.MediaType {
+		case wasmLayerMediaType, wasmOCILayerMediaType:
+			return s.fetchBlob(ctx, layer)
+		case ociTarGzipLayerMediaType, dockerLayerMediaType:
+			b, err := s.fetchBlob(ctx, layer)
+			if err != nil {
+				return nil, err
+			}
+			module, err := extractWasmFromTarGzip(b)
+			if err != nil {
+				return nil, fmt.Errorf("layer %v of %v: %v", layer.Digest, s.ref, err)
+			}
+			if module != nil {
+				return module, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("image %v does not contain a Wasm module layer or a layer with %v", s.ref, wasmFileName)
+}
+
+func (s *imageSession) fetchBlob(ctx context.Context, d descriptor) ([]byte, error) {
+	if !strings.HasPrefix(d.Digest, "sha256:") {
+		return nil, fmt.Errorf("layer of %v has unsupported digest %q", s.ref, d.Digest)
+	}
+	if d.Size > maxModuleSize {
+		return nil, fmt.Errorf("layer %v of %v is too large: %d bytes, at most %d are allowed", d.Digest, s.ref, d.Size, maxModuleSize)
+	}
+	resp, err := s.get(ctx, "blobs/"+d.Digest, "")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxModuleSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read layer %v of %v: %v", d.Digest, s.ref, err)
+	}
+	if len(body) > maxModuleSize {
+		return nil, fmt.Errorf("layer %v of %v is larger than %d bytes", d.Digest, s.ref, maxModuleSize)
+	}
+	if got := fmt.Sprintf("sha256:%x", sha256.Sum256(body)); got != d.Digest {
+		return nil, fmt.Errorf("layer of %v has digest %v, which does not match the manifest: %v", s.ref, got, d.Digest)
+	}
+	return body, nil
+}
+
+// get sends a GET request to the registry API, authenticating when challenged by the registry.
+func (s *imageSession) get(ctx context.Context, p, accept string) (*http.Response, error) {
+	u := "https://" + s.ref.registry + "/v2/" + s.ref.repository + "/" + p
+	for attempt := 0; attempt < 2; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+		if err != nil {
+			return nil, err
+		}
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		if s.authorization != "" {
+			req.Header.Set("Authorization", s.authorization)
+		}
+		resp, err := s.client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode == http.StatusOK {
+			return resp, nil
+		}
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusUnauthorized && attempt == 0 {
+			if err := s.authenticate(ctx, resp.Header.Get("WWW-Authenticate")); err != nil {
+				return nil, fmt.Errorf("failed to authenticate to %v: %v", s.ref.registry, err)
+			}
+			continue
+		}
+		return nil, fmt.Errorf("request to %v failed: status code %v, body %v", u, resp.StatusCode, string(body))
+	}
+	return nil, fmt.Errorf("request to %v failed: unauthorized", u)
+}
+
+// authenticate handles a WWW-Authenticate challenge from the registry, as described in
+// https://docs.docker.com/registry/spec/auth/token/.
+func (s *imageSession) authenticate(ctx context.Context, challenge string) error {
+	scheme, params := parseChallenge(challenge)
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if s.credentials == nil {
+			return errors.New("registry requires credentials, but no pull secret was provided")
+		}
+		s.authorization = "Basic " + s.credentials.basicAuth()
+		return nil
+	case "bearer":
+		realm := params["realm"]
+		if realm == "" {
+			return errors.New("bearer challenge is missing realm")
+		}
+		tokenURL, err := url.Parse(realm)
+		if err != nil {
+			return fmt.Errorf("invalid token realm %q: %v", realm, err)
+		}
+		q := tokenURL.Query()
+		if service := params["service"]; service != "" {
+			q.Set("service", service)
+		}
+		scope := params["scope"]
+		if scope == "" {
+			scope = "repository:" + s.ref.repository + ":pull"
+		}
+		q.Set("scope", scope)
+		tokenURL.RawQuery = q.Encode()
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, tokenURL.String(), nil)
+		if err != nil {
+			return err
+		}
+		if s.credentials != nil {
+			req.Header.Set("Authorization", "Basic "+s.credentials.basicAuth())
+		}
+		resp, err := s.client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("token request failed: status code %v", resp.StatusCode)
+		}
+		token := struct {
+			Token       string `json:"token"`
+			AccessToken string `json:"access_token"`
+		}{}
+		if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+			return fmt.Errorf("failed to parse token response: %v", err)
+		}
+		t := token.Token
+		if t == "" {
+			t = token.AccessToken
+		}
+		if t == "" {
+			return errors.New("token response did not contain a token")
+		}
+		s.authorization = "Bearer " + t
+		return nil
+	default:
+		return fmt.Errorf("unsupported authentication challenge %q", challenge)
+	}
+}
+
+// parseChallenge parses a WWW-Authenticate header such as
+// Bearer realm="https://auth.docker.io/token",service="registry.docker.io".
+func parseChallenge(challenge string) (string, map[string]string) {
+	params := map[string]string{}
+	parts := strings.SplitN(strings.TrimSpace(challenge), " ", 2)
+	if len(parts) < 2 {
+		return parts[0], params
+	}
+	rest := parts[1]
+	for rest != "" {
+		eq := strings.Index(rest, "=")
+		if eq < 0 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(rest[:eq]))
+		rest = strings.TrimSpace(rest[eq+1:])
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				value, rest = rest[1:], ""
+			} else {
+				value, rest = rest[1:end+1], rest[end+2:]
+			}
+		} else if comma := strings.Index(rest, ","); comma >= 0 {
+			value, rest = rest[:comma], rest[comma:]
+		} else {
+			value, rest = rest, ""
+		}
+		params[key] = value
+		rest = strings.TrimPrefix(strings.TrimSpace(rest), ",")
+	}
+	return parts[0], params
+}
+
+type registryCredentials struct {
+	username string
+	password string
+}
+
+func (c *registryCredentials) basicAuth() string {
+	return base64.StdEncoding.EncodeToString([]byte(c.username + ":" + c.password))
+}
+
+// credentialsForRegistry finds the credentials for the registry in a Docker config.json.
+func credentialsForRegistry(pullSecret []byte, registry string) (*registryCredentials, error) {
+	if len(pullSecret) == 0 {
+		return nil, nil
+	}
+	config := struct {
+		Auths map[string]struct {
+			Auth     string `json:"auth"`
+			Username string `json:"username"`
+			Password string `json:"password"`
+		} `json:"auths"`
+	}{}
+	if err := json.Unmarshal(pullSecret, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse image pull secret: %v", err)
+	}
+	for key, auth := range config.Auths {
+		if registryHost(key) != registry && !(registry == dockerHubAPIRegistry && key == dockerHubAuthKey) {
+			continue
+		}
+		if auth.Username != "" || auth.Password != "" {
+			return &registryCredentials{username: auth.Username, password: auth.Password}, nil
+		}
+		decoded, err := base64.StdEncoding.DecodeString(auth.Auth)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode image pull secret auth for %v: %v", key, err)
+		}
+		parts := strings.SplitN(string(decoded), ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid image pull secret auth for %v", key)
+		}
+		return &registryCredentials{username: parts[0], password: parts[1]}, nil
+	}
+	return nil, nil
+}
+
+// registryHost normalizes the keys of a Docker config.json, which may be URLs, to a registry host.
+func registryHost(key string) string {
+	key = strings.TrimPrefix(strings.TrimPrefix(key, "https://"), "http://")
+	if i := strings.Index(key, "/"); i >= 0 {
+		key = key[:i]
+	}
+	return key
+}
+
+// extractWasmFromTarGzip returns the Wasm binary from a gzipped file system tarball, or nil if there is none.
+func extractWasmFromTarGzip(b []byte) ([]byte, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress layer: %v", err)
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read layer: %v", err)
+		}
+		if h.Typeflag == tar.TypeReg && path.Base(h.Name) == wasmFileName {
+			module, err := ioutil.ReadAll(io.LimitReader(tr, maxModuleSize+1))
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %v: %v", wasmFileName, err)
+			}
+			if len(module) > maxModuleSize {
+				return nil, fmt.Errorf("%v is larger than %d bytes", wasmFileName, maxModuleSize)
+			}
+			return module, nil
+		}
+	}
+}
+
+// fetchTimeout applies the default timeout used by the HTTP fetcher when none is specified.
+func fetchTimeout(timeout time.Duration) time.Duration {
+	if timeout == 0 {
+		return 5 * time.Second
+	}
+	return timeout
+}
@@ -0,0 +1,315 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wasm
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestParseImageReference(t *testing.T) {
+	digest := "sha256:" + strings.Repeat("a", 64)
+	cases := []struct {
+		url     string
+		want    imageReference
+		wantErr bool
+	}{
+		{
+			url:  "oci://gcr.io/project/plugin:v1",
+			want: imageReference{registry: "gcr.io", repository: "project/plugin", reference: "v1"},
+		},
+		{
+			url:  "oci://localhost:5000/plugin",
+			want: imageReference{registry: "localhost:5000", repository: "plugin", reference: "latest"},
+		},
+		{
+			url:  "oci://gcr.io/project/plugin@" + digest,
+			want: imageReference{registry: "gcr.io", repository: "project/plugin", reference: digest},
+		},
+		{
+			url:  "oci://docker.io/plugin:v2",
+			want: imageReference{registry: "registry-1.docker.io", repository: "library/plugin", reference: "v2"},
+		},
+		{
+			url:     "oci://gcr.io/project/plugin@sha256:abc",
+			wantErr: true,
+		},
+		{
+			url:     "oci://gcr.io",
+			wantErr: true,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.url, func(t *testing.T) {
+			u, err := url.Parse(c.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := parseImageReference(u)
+			if c.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != c.want {
+				t.Fatalf("got %+v, want %+v", got, c.want)
+			}
+		})
+	}
+}
+
+// fakeRegistry is a minimal stand-in for an OCI registry, requiring token authentication.
+type fakeRegistry struct {
+	mu        sync.Mutex
+	server    *httptest.Server
+	username  string
+	password  string
+	manifests map[string][]byte
+	blobs     map[string][]byte
+	tags      map[string]string
+	requests  int
+}
+
+func newFakeRegistry(t *testing.T) *fakeRegistry {
+	r := &fakeRegistry{
+		username:  "user",
+		password:  "pass",
+		manifests: map[string][]byte{},
+		blobs:     map[string][]byte{},
+		tags:      map[string]string{},
+	}
+	r.server = httptest.NewTLSServer(http.HandlerFunc(r.serveHTTP))
+	t.Cleanup(r.server.Close)
+	return r
+}
+
+func (r *fakeRegistry) host() string {
+	return strings.TrimPrefix(r.server.URL, "https://")
+}
+
+func (r *fakeRegistry) pullSecret() []byte {
+	auth := base64.StdEncoding.EncodeToString([]byte(r.username + ":" + r.password))
+	return []byte(fmt.Sprintf(`{"auths":{%q:{"auth":%q}}}`, r.host(), auth))
+}
+
+// push adds an image with a single layer to the registry, and points the tag at it.
+func (r *fakeRegistry) push(t *testing.T, tag, mediaType string, layer []byte) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	layerDigest := fmt.Sprintf("sha256:%x", sha256.Sum256(layer))
+	r.blobs[layerDigest] = layer
+	m, err := json.Marshal(manifest{
+		MediaType: ociManifestMediaType,
+		Layers:    []descriptor{{MediaType: mediaType, Digest: layerDigest, Size: int64(len(layer))}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := fmt.Sprintf("sha256:%x", sha256.Sum256(m))
+	r.manifests[digest] = m
+	r.tags[tag] = digest
+	return digest
+}
+
+func (r *fakeRegistry) serveHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests++
+	if req.URL.Path == "/token" {
+		user, pass, ok := req.BasicAuth()
+		if !ok || user != r.username || pass != r.password || req.URL.Query().Get("scope") != "repository:plugin:pull" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, `{"token":"valid-token"}`)
+		return
+	}
+	if req.Header.Get("Authorization") != "Bearer valid-token" {
+		w.Header().Set("WWW-Authenticate",
+			fmt.Sprintf(`Bearer realm="%s/token",service="fake",scope="repository:plugin:pull"`, r.server.URL))
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	switch {
+	case strings.HasPrefix(req.URL.Path, "/v2/plugin/manifests/"):
+		ref := strings.TrimPrefix(req.URL.Path, "/v2/plugin/manifests/")
+		if d, ok := r.tags[ref]; ok {
+			ref = d
+		}
+		m, ok := r.manifests[ref]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", ociManifestMediaType)
+		_, _ = w.Write(m)
+	case strings.HasPrefix(req.URL.Path, "/v2/plugin/blobs/"):
+		b, ok := r.blobs[strings.TrimPrefix(req.URL.Path, "/v2/plugin/blobs/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write(b)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (r *fakeRegistry) numRequests() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.requests
+}
+
+func tarGzip(t *testing.T, name string, content []byte) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write(content); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestWasmCacheImage(t *testing.T) {
+	registry := newFakeRegistry(t)
+	tmpDir := t.TempDir()
+	cache := NewLocalFileCache(tmpDir, DefaultOptions())
+	defer close(cache.stopChan)
+	cache.imageFetcher.client = registry.server.Client()
+
+	v1 := []byte("module-v1")
+	v2 := []byte("module-v2")
+	v1Digest := registry.push(t, "latest", wasmLayerMediaType, v1)
+	wantPath1 := filepath.Join(tmpDir, fmt.Sprintf("%x.wasm", sha256.Sum256(v1)))
+	wantPath2 := filepath.Join(tmpDir, fmt.Sprintf("%x.wasm", sha256.Sum256(v2)))
+	ref := "oci://" + registry.host() + "/plugin"
+
+	if _, err := cache.Get(ref, "", 0, nil); err == nil {
+		t.Fatalf("expected fetch without pull secret to fail")
+	}
+
+	got, err := cache.Get(ref, "", 0, registry.pullSecret())
+	if err != nil {
+		t.Fatalf("failed to pull Wasm module: %v", err)
+	}
+	if got != wantPath1 {
+		t.Errorf("wasm module path got %v want %v", got, wantPath1)
+	}
+
+	// The module is cached by digest: pulling by digest does not contact the registry.
+	before := registry.numRequests()
+	got, err = cache.Get(ref+"@"+v1Digest, "", 0, registry.pullSecret())
+	if err != nil {
+		t.Fatalf("failed to pull Wasm module by digest: %v", err)
+	}
+	if got != wantPath1 {
+		t.Errorf("wasm module path got %v want %v", got, wantPath1)
+	}
+	if n := registry.numRequests() - before; n != 0 {
+		t.Errorf("expected cache hit without registry requests, got %v requests", n)
+	}
+
+	// Moving the tag results in the new module being fetched, as a tar+gzip layer this time.
+	registry.push(t, "latest", ociTarGzipLayerMediaType, tarGzip(t, "plugin.wasm", v2))
+	got, err = cache.Get(ref+":latest", fmt.Sprintf("%x", sha256.Sum256(v2)), 0, registry.pullSecret())
+	if err != nil {
+		t.Fatalf("failed to pull Wasm module after tag moved: %v", err)
+	}
+	if got != wantPath2 {
+		t.Errorf("wasm module path got %v want %v", got, wantPath2)
+	}
+
+	// Checksum mismatches are rejected.
+	if _, err := cache.Get(ref+"@"+v1Digest, fmt.Sprintf("%x", sha256.Sum256(v2)), 0, registry.pullSecret()); err == nil {
+		t.Errorf("expected checksum mismatch error")
+	}
+}
+
+func TestWasmCacheImageCorruptLayer(t *testing.T) {
+	registry := newFakeRegistry(t)
+	cache := NewLocalFileCache(t.TempDir(), DefaultOptions())
+	defer close(cache.stopChan)
+	cache.imageFetcher.client = registry.server.Client()
+
+	registry.push(t, "v1", wasmLayerMediaType, []byte("module"))
+	registry.mu.Lock()
+	for d := range registry.blobs {
+		registry.blobs[d] = []byte("tampered")
+	}
+	registry.mu.Unlock()
+
+	_, err := cache.Get("oci://"+registry.host()+"/plugin:v1", "", 0, registry.pullSecret())
+	if err == nil || !strings.Contains(err.Error(), "does not match the manifest") {
+		t.Fatalf("expected digest verification error, got %v", err)
+	}
+}
+
+func TestWasmCacheImageTooLarge(t *testing.T) {
+	registry := newFakeRegistry(t)
+	cache := NewLocalFileCache(t.TempDir(), DefaultOptions())
+	defer close(cache.stopChan)
+	cache.imageFetcher.client = registry.server.Client()
+
+	// The layer claims to exceed the module size limit: it is rejected before being downloaded.
+	layer := []byte("module")
+	registry.push(t, "v1", wasmLayerMediaType, layer)
+	registry.mu.Lock()
+	m, err := json.Marshal(manifest{
+		MediaType: ociManifestMediaType,
+		Layers: []descriptor{{
+			MediaType: wasmLayerMediaType,
+			Digest:    fmt.Sprintf("sha256:%x", sha256.Sum256(layer)),
+			Size:      maxModuleSize + 1,
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := fmt.Sprintf("sha256:%x", sha256.Sum256(m))
+	registry.manifests[digest] = m
+	registry.tags["v1"] = digest
+	registry.mu.Unlock()
+
+	_, err = cache.Get("oci://"+registry.host()+"/plugin:v1", "", 0, registry.pullSecret())
+	if err == nil || !strings.Contains(err.Error(), "too large") {
+		t.Fatalf("expected module size error, got %v", err)
+	}
+}
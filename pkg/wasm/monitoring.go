@@ -29,11 +29,16 @@ const (
 	marshalFailure      = "marshal_failure"
 	fetchFailure        = "fetch_failure"
 	missRemoteFetchHint = "miss_remote_fetch_hint"
+
+	// For cache eviction metric.
+	evictionSize   = "size"
+	evictionExpiry = "expiry"
 )
 
 var (
 	hitTag    = monitoring.MustCreateLabel("hit")
 	resultTag = monitoring.MustCreateLabel("result")
+	reasonTag = monitoring.MustCreateLabel("reason")
 
 	wasmCacheEntries = monitoring.NewGauge(
 		"wasm_cache_entries",
@@ -46,6 +51,17 @@ var (
 		monitoring.WithLabels(hitTag),
 	)
 
+	wasmCacheSize = monitoring.NewGauge(
+		"wasm_cache_size_bytes",
+		"total size in bytes of the Wasm modules stored in the local cache.",
+	)
+
+	wasmCacheEvictionCount = monitoring.NewSum(
+		"wasm_cache_eviction_count",
+		"number of Wasm modules evicted from the local cache, by reason: size for exceeding the cache size limit, expiry for staleness.",
+		monitoring.WithLabels(reasonTag),
+	)
+
 	wasmRemoteFetchCount = monitoring.NewSum(
 		"wasm_remote_fetch_count",
 		"number of Wasm remote fetches and results, including success, download failure, and checksum mismatch.",
@@ -69,6 +85,8 @@ func init() {
 	monitoring.MustRegister(
 		wasmCacheEntries,
 		wasmCacheLookupCount,
+		wasmCacheSize,
+		wasmCacheEvictionCount,
 		wasmRemoteFetchCount,
 		wasmConfigConversionCount,
 		wasmConfigConversionDuration,
@@ -26,6 +26,12 @@ func NewCredFetcher(credtype, trustdomain, jwtPath, identityProvider string) (se
 	switch credtype {
 	case security.GCE:
 		return plugin.CreateGCEPlugin(trustdomain, jwtPath, identityProvider), nil
+	case security.AWS:
+		return plugin.CreateAWSPlugin(trustdomain, jwtPath, identityProvider), nil
+	case security.Azure:
+		return plugin.CreateAzurePlugin(trustdomain, jwtPath, identityProvider), nil
+	case security.JWTFile:
+		return plugin.CreateJWTFilePlugin(jwtPath, identityProvider), nil
 	case security.Mock: // for test only
 		return plugin.CreateMockPlugin("test_token"), nil
 	default:
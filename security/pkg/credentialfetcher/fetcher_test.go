@@ -40,6 +40,27 @@ func TestNewCredFetcher(t *testing.T) {
 			expectedToken:    "",
 			expectedIdp:      "GoogleComputeEngine",
 		},
+		"aws test": {
+			fetcherType:      security.AWS,
+			trustdomain:      "cluster.local",
+			jwtPath:          "/var/run/secrets/tokens/istio-token",
+			identityProvider: security.AWS,
+			expectedIdp:      "AmazonEC2",
+		},
+		"azure test": {
+			fetcherType:      security.Azure,
+			trustdomain:      "cluster.local",
+			jwtPath:          "/var/run/secrets/tokens/istio-token",
+			identityProvider: security.Azure,
+			expectedIdp:      "AzureVM",
+		},
+		"jwt file test": {
+			fetcherType:      security.JWTFile,
+			trustdomain:      "cluster.local",
+			jwtPath:          "/var/run/secrets/tokens/istio-token",
+			identityProvider: "https://oidc.example.com",
+			expectedIdp:      "https://oidc.example.com",
+		},
 		"mock test": {
 			fetcherType:      security.Mock,
 			trustdomain:      "",
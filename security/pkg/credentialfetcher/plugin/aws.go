@@ -0,0 +1,148 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// This is AWS plugin of credentialfetcher.
+package plugin
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+
+	"istio.io/istio/pkg/security"
+	"istio.io/pkg/log"
+)
+
+var awscredLog = log.RegisterScope("awscred", "AWS credential fetcher for istio agent", 0)
+
+const (
+	// AWSTokenPrefix is the prefix of the credentials carrying a presigned STS GetCallerIdentity request.
+	AWSTokenPrefix = "aws-sts."
+
+	// AWSServerIDHeader is the header binding a presigned request to the trust domain of the Istiod it is
+	// sent to. It is signed, but not carried by the credential: Istiod sets it to its own trust domain when
+	// sending the request to STS, so a request presigned for another trust domain fails verification.
+	AWSServerIDHeader = "X-Istio-Server-Id"
+
+	// AWSCredentialExpiry is the validity of the presigned requests. Istiod rejects longer validities.
+	AWSCredentialExpiry = 15 * time.Minute
+
+	// awsDefaultRegion is the region signing the requests sent to the global STS endpoint, if the
+	// region of the VM is not configured.
+	awsDefaultRegion = "us-east-1"
+)
+
+// EncodeAWSCallerIdentity returns the credential carrying a presigned STS GetCallerIdentity request.
+func EncodeAWSCallerIdentity(presignedURL string) string {
+	return AWSTokenPrefix + base64.RawURLEncoding.EncodeToString([]byte(presignedURL))
+}
+
+// DecodeAWSCallerIdentity returns the presigned STS GetCallerIdentity request carried by a credential
+// built by EncodeAWSCallerIdentity.
+func DecodeAWSCallerIdentity(token string) (*url.URL, error) {
+	if !strings.HasPrefix(token, AWSTokenPrefix) {
+		return nil, fmt.Errorf("the credential is not an AWS caller identity")
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(token, AWSTokenPrefix))
+	if err != nil {
+		return nil, fmt.Errorf("malformed AWS caller identity: %v", err)
+	}
+	u, err := url.Parse(string(raw))
+	if err != nil {
+		return nil, fmt.Errorf("malformed AWS caller identity request: %v", err)
+	}
+	return u, nil
+}
+
+// The plugin object.
+type AWSPlugin struct {
+	// serverID is the trust domain of the Istiod the credentials are presented to.
+	serverID string
+
+	// The location to save the identity credential
+	jwtPath string
+
+	// identity provider
+	identityProvider string
+
+	// config overrides the configuration of the AWS session, for testing.
+	config *aws.Config
+	// mutex lock is required to avoid race condition when updating the credential file.
+	tokenMutex sync.Mutex
+}
+
+// CreateAWSPlugin creates an AWS credential fetcher plugin. Return the pointer to the created plugin.
+func CreateAWSPlugin(trustDomain, jwtPath, identityProvider string) *AWSPlugin {
+	return &AWSPlugin{
+		serverID:         trustDomain,
+		jwtPath:          jwtPath,
+		identityProvider: identityProvider,
+	}
+}
+
+// GetPlatformCredential presigns an STS GetCallerIdentity request with the credentials of the IAM role of
+// the instance, and writes the resulting credential to jwtPath. Istiod sends the request to STS to learn
+// the role, so the credential expires with the request, after AWSCredentialExpiry.
+// Note: the credentials are found by the default chain of the AWS SDK, e.g. from the instance metadata
+// service of an EC2 VM.
+func (p *AWSPlugin) GetPlatformCredential() (string, error) {
+	p.tokenMutex.Lock()
+	defer p.tokenMutex.Unlock()
+
+	if p.jwtPath == "" {
+		return "", fmt.Errorf("jwtPath is unset")
+	}
+	sess, err := session.NewSession(p.config)
+	if err != nil {
+		return "", fmt.Errorf("failed to create the AWS session: %v", err)
+	}
+	cfg := aws.NewConfig()
+	if aws.StringValue(sess.Config.Region) == "" {
+		cfg = cfg.WithRegion(awsDefaultRegion)
+	}
+	req, _ := sts.New(sess, cfg).GetCallerIdentityRequest(&sts.GetCallerIdentityInput{})
+	req.HTTPRequest.Header.Set(AWSServerIDHeader, p.serverID)
+	presigned, err := req.Presign(AWSCredentialExpiry)
+	if err != nil {
+		awscredLog.Errorf("Failed to presign the caller identity request: %v", err)
+		return "", err
+	}
+	token := EncodeAWSCallerIdentity(presigned)
+	awscredLog.Debugf("Got AWS caller identity: %d", len(token))
+	if err := ioutil.WriteFile(p.jwtPath, []byte(token), 0640); err != nil {
+		awscredLog.Errorf("Encountered error when writing vm identity credential: %v", err)
+		return "", err
+	}
+	return token, nil
+}
+
+// GetType returns credential fetcher type.
+func (p *AWSPlugin) GetType() string {
+	return security.AWS
+}
+
+// GetIdentityProvider returns the name of the identity provider that can authenticate the workload credential.
+func (p *AWSPlugin) GetIdentityProvider() string {
+	return p.identityProvider
+}
+
+func (p *AWSPlugin) Stop() {}
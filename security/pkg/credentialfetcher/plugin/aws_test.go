@@ -0,0 +1,83 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugin
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+)
+
+func TestAWSPlugin(t *testing.T) {
+	jwtPath := filepath.Join(t.TempDir(), "istio-token")
+	p := CreateAWSPlugin("cluster.local", jwtPath, "AmazonEC2")
+	p.config = aws.NewConfig().
+		WithCredentials(credentials.NewStaticCredentials("AKIDEXAMPLE", "secret", "session-token")).
+		WithRegion("us-west-2")
+
+	token, err := p.GetPlatformCredential()
+	if err != nil {
+		t.Fatalf("GetPlatformCredential() returns err: %v", err)
+	}
+	if !strings.HasPrefix(token, AWSTokenPrefix) {
+		t.Errorf("expected an AWS caller identity, got %s", token)
+	}
+	if saved, err := ioutil.ReadFile(jwtPath); err != nil || string(saved) != token {
+		t.Errorf("%s has credential %s, want %s (%v)", jwtPath, saved, token, err)
+	}
+
+	u, err := DecodeAWSCallerIdentity(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Scheme != "https" || !strings.HasPrefix(u.Host, "sts.") || !strings.HasSuffix(u.Host, ".amazonaws.com") {
+		t.Errorf("unexpected STS endpoint %s", u.Host)
+	}
+	q := u.Query()
+	if q.Get("Action") != "GetCallerIdentity" || q.Get("X-Amz-Security-Token") != "session-token" {
+		t.Errorf("unexpected request %s", u)
+	}
+	if !strings.Contains(q.Get("X-Amz-SignedHeaders"), strings.ToLower(AWSServerIDHeader)) {
+		t.Errorf("the server ID header is not signed: %s", q.Get("X-Amz-SignedHeaders"))
+	}
+	if q.Get("X-Amz-Expires") != strconv.Itoa(int(AWSCredentialExpiry.Seconds())) {
+		t.Errorf("unexpected expiry %s", q.Get("X-Amz-Expires"))
+	}
+}
+
+func TestAWSPluginErrors(t *testing.T) {
+	p := CreateAWSPlugin("cluster.local", "", "AmazonEC2")
+	if _, err := p.GetPlatformCredential(); err == nil || err.Error() != "jwtPath is unset" {
+		t.Errorf("expected an error without jwtPath, got %v", err)
+	}
+}
+
+func TestDecodeAWSCallerIdentity(t *testing.T) {
+	for _, token := range []string{
+		"",
+		"a.b",
+		AWSTokenPrefix + "!",
+		AWSTokenPrefix + "JQ",
+	} {
+		if _, err := DecodeAWSCallerIdentity(token); err == nil {
+			t.Errorf("expected an error decoding %q", token)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// This is Azure plugin of credentialfetcher.
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"istio.io/istio/pkg/security"
+	"istio.io/pkg/log"
+)
+
+var azurecredLog = log.RegisterScope("azurecred", "Azure credential fetcher for istio agent", 0)
+
+// azureMetadataEndpoint is the address of the Azure instance metadata service.
+var azureMetadataEndpoint = "http://169.254.169.254"
+
+// The plugin object.
+type AzurePlugin struct {
+	// aud is the resource the managed identity token is requested for.
+	// For more info: https://docs.microsoft.com/en-us/azure/active-directory/managed-identities-azure-resources/how-to-use-vm-token
+	aud string
+
+	// The location to save the identity token
+	jwtPath string
+
+	// identity provider
+	identityProvider string
+
+	endpoint    string
+	client      *http.Client
+	tokenCache  string
+	tokenExpiry time.Time
+	// mutex lock is required to avoid race condition when updating token file and token cache.
+	tokenMutex sync.Mutex
+}
+
+// CreateAzurePlugin creates an Azure credential fetcher plugin. Return the pointer to the created plugin.
+func CreateAzurePlugin(audience, jwtPath, identityProvider string) *AzurePlugin {
+	return &AzurePlugin{
+		aud:              audience,
+		jwtPath:          jwtPath,
+		identityProvider: identityProvider,
+		endpoint:         azureMetadataEndpoint,
+		client:           &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+type azureTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	// ExpiresOn is the expiration time of the token, in seconds since the epoch.
+	ExpiresOn string `json:"expires_on"`
+}
+
+// GetPlatformCredential fetches a token of the managed identity of the VM from the Azure instance metadata
+// service, and writes it to jwtPath. The token is cached until its remaining lifetime is below the grace period.
+// Note: this function only works in an Azure VM environment.
+func (p *AzurePlugin) GetPlatformCredential() (string, error) {
+	p.tokenMutex.Lock()
+	defer p.tokenMutex.Unlock()
+
+	if p.jwtPath == "" {
+		return "", fmt.Errorf("jwtPath is unset")
+	}
+	if p.tokenCache != "" && time.Now().Before(p.tokenExpiry.Add(-gracePeriod)) {
+		return p.tokenCache, nil
+	}
+
+	uri := fmt.Sprintf("%s/metadata/identity/oauth2/token?api-version=2018-02-01&resource=%s",
+		p.endpoint, url.QueryEscape(p.aud))
+	req, err := http.NewRequest(http.MethodGet, uri, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata", "true")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		azurecredLog.Errorf("Failed to get managed identity token from metadata server: %v", err)
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		azurecredLog.Errorf("Failed to get managed identity token from metadata server: status %d", resp.StatusCode)
+		return "", fmt.Errorf("status %d from the metadata server: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	tokenResp := &azureTokenResponse{}
+	if err := json.Unmarshal(body, tokenResp); err != nil || tokenResp.AccessToken == "" {
+		return "", fmt.Errorf("invalid token response from the metadata server: %v", err)
+	}
+	expiresOn, err := strconv.ParseInt(tokenResp.ExpiresOn, 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("invalid token expiration %q: %v", tokenResp.ExpiresOn, err)
+	}
+
+	azurecredLog.Debugf("Got Azure managed identity token: %d", len(tokenResp.AccessToken))
+	if err := ioutil.WriteFile(p.jwtPath, []byte(tokenResp.AccessToken), 0640); err != nil {
+		azurecredLog.Errorf("Encountered error when writing vm identity token: %v", err)
+		return "", err
+	}
+	// Update token cache.
+	p.tokenCache = tokenResp.AccessToken
+	p.tokenExpiry = time.Unix(expiresOn, 0)
+	return p.tokenCache, nil
+}
+
+// GetType returns credential fetcher type.
+func (p *AzurePlugin) GetType() string {
+	return security.Azure
+}
+
+// GetIdentityProvider returns the name of the identity provider that can authenticate the workload credential.
+func (p *AzurePlugin) GetIdentityProvider() string {
+	return p.identityProvider
+}
+
+func (p *AzurePlugin) Stop() {}
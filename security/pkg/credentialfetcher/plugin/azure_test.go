@@ -0,0 +1,122 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeAzureMetadataServer serves managed identity tokens of the Azure instance metadata service.
+type fakeAzureMetadataServer struct {
+	server *httptest.Server
+
+	mutex     sync.Mutex
+	calls     int
+	expiresIn time.Duration
+}
+
+func newFakeAzureMetadataServer(t *testing.T, expiresIn time.Duration) *fakeAzureMetadataServer {
+	f := &fakeAzureMetadataServer{expiresIn: expiresIn}
+	f.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata") != "true" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error": "invalid_request", "error_description": "Required metadata header not specified"}`))
+			return
+		}
+		if r.URL.Path != "/metadata/identity/oauth2/token" || r.URL.Query().Get("api-version") == "" {
+			t.Errorf("unexpected request for %s", r.URL)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.URL.Query().Get("resource") != "api://cluster.local" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error": "invalid_resource"}`))
+			return
+		}
+		f.mutex.Lock()
+		defer f.mutex.Unlock()
+		f.calls++
+		_ = json.NewEncoder(w).Encode(&azureTokenResponse{
+			AccessToken: fmt.Sprintf("%s%d", fakeTokenPrefix, f.calls),
+			ExpiresOn:   strconv.FormatInt(time.Now().Add(f.expiresIn).Unix(), 10),
+		})
+	}))
+	return f
+}
+
+func TestAzurePlugin(t *testing.T) {
+	testCases := map[string]struct {
+		expiresIn      time.Duration
+		expectedTokens []string
+	}{
+		"token is cached": {
+			expiresIn:      time.Hour,
+			expectedTokens: []string{fakeTokenPrefix + "1", fakeTokenPrefix + "1", fakeTokenPrefix + "1"},
+		},
+		"token in grace period is refreshed": {
+			expiresIn:      10 * time.Minute,
+			expectedTokens: []string{fakeTokenPrefix + "1", fakeTokenPrefix + "2", fakeTokenPrefix + "3"},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			ms := newFakeAzureMetadataServer(t, tc.expiresIn)
+			defer ms.server.Close()
+			jwtPath := filepath.Join(t.TempDir(), "istio-token")
+			p := CreateAzurePlugin("api://cluster.local", jwtPath, "AzureVM")
+			p.endpoint = ms.server.URL
+
+			for i, want := range tc.expectedTokens {
+				token, err := p.GetPlatformCredential()
+				if err != nil {
+					t.Fatalf("#%d call to GetPlatformCredential() returns err: %v", i, err)
+				}
+				if token != want {
+					t.Errorf("#%d call to GetPlatformCredential() returns token: %s, want: %s", i, token, want)
+				}
+			}
+			want := tc.expectedTokens[len(tc.expectedTokens)-1]
+			if saved, err := ioutil.ReadFile(jwtPath); err != nil || string(saved) != want {
+				t.Errorf("%s has token %s, want %s (%v)", jwtPath, saved, want, err)
+			}
+		})
+	}
+}
+
+func TestAzurePluginErrors(t *testing.T) {
+	ms := newFakeAzureMetadataServer(t, time.Hour)
+	defer ms.server.Close()
+
+	p := CreateAzurePlugin("api://cluster.local", "", "AzureVM")
+	p.endpoint = ms.server.URL
+	if _, err := p.GetPlatformCredential(); err == nil || err.Error() != "jwtPath is unset" {
+		t.Errorf("expected an error without jwtPath, got %v", err)
+	}
+
+	p = CreateAzurePlugin("api://other", filepath.Join(t.TempDir(), "istio-token"), "AzureVM")
+	p.endpoint = ms.server.URL
+	if _, err := p.GetPlatformCredential(); err == nil {
+		t.Error("expected an error for an unknown resource")
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// This is the JWT file plugin of credentialfetcher.
+package plugin
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"istio.io/istio/pkg/security"
+	"istio.io/istio/security/pkg/util"
+	"istio.io/pkg/log"
+)
+
+var filecredLog = log.RegisterScope("filecred", "JWT file credential fetcher for istio agent", 0)
+
+// The plugin object.
+type JWTFilePlugin struct {
+	// The location of the OIDC token, which is rotated by an external process
+	// such as a kubelet projected volume or a cloud identity agent.
+	jwtPath string
+
+	// identity provider
+	identityProvider string
+}
+
+// CreateJWTFilePlugin creates a credential fetcher plugin reading the token in jwtPath.
+// Return the pointer to the created plugin.
+func CreateJWTFilePlugin(jwtPath, identityProvider string) *JWTFilePlugin {
+	return &JWTFilePlugin{
+		jwtPath:          jwtPath,
+		identityProvider: identityProvider,
+	}
+}
+
+// GetPlatformCredential reads the current token from jwtPath. The file is read on every call so that
+// the token rotated in place is picked up. An expired token is rejected, since it would only be refused by the CA.
+func (p *JWTFilePlugin) GetPlatformCredential() (string, error) {
+	if p.jwtPath == "" {
+		return "", fmt.Errorf("jwtPath is unset")
+	}
+	data, err := ioutil.ReadFile(p.jwtPath)
+	if err != nil {
+		filecredLog.Errorf("Failed to read the token from %s: %v", p.jwtPath, err)
+		return "", err
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", fmt.Errorf("no token in %s", p.jwtPath)
+	}
+	if exp, err := util.GetExp(token); err == nil && !exp.IsZero() && time.Now().After(exp) {
+		return "", fmt.Errorf("the token in %s expired at %v", p.jwtPath, exp)
+	}
+	filecredLog.Debugf("Read token from %s: %d", p.jwtPath, len(token))
+	return token, nil
+}
+
+// GetType returns credential fetcher type.
+func (p *JWTFilePlugin) GetType() string {
+	return security.JWTFile
+}
+
+// GetIdentityProvider returns the name of the identity provider that can authenticate the workload credential.
+func (p *JWTFilePlugin) GetIdentityProvider() string {
+	return p.identityProvider
+}
+
+func (p *JWTFilePlugin) Stop() {}
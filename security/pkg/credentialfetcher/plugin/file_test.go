@@ -0,0 +1,67 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugin
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func fakeJWT(exp time.Time) string {
+	claims := fmt.Sprintf(`{"iss": "https://oidc.example.com", "sub": "system:serviceaccount:foo:bar", "exp": %d}`, exp.Unix())
+	return "eyJhbGciOiJSUzI1NiJ9." + base64.RawURLEncoding.EncodeToString([]byte(claims)) + ".c2lnbmF0dXJl"
+}
+
+func TestJWTFilePlugin(t *testing.T) {
+	jwtPath := filepath.Join(t.TempDir(), "istio-token")
+	p := CreateJWTFilePlugin(jwtPath, "https://oidc.example.com")
+
+	if _, err := p.GetPlatformCredential(); err == nil {
+		t.Error("expected an error without a token file")
+	}
+
+	// The token is read again after it is rotated.
+	for _, token := range []string{fakeJWT(time.Now().Add(time.Hour)), fakeJWT(time.Now().Add(2 * time.Hour))} {
+		if err := ioutil.WriteFile(jwtPath, []byte(token+"\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		got, err := p.GetPlatformCredential()
+		if err != nil {
+			t.Fatalf("GetPlatformCredential() returns err: %v", err)
+		}
+		if got != token {
+			t.Errorf("GetPlatformCredential() returns token: %s, want: %s", got, token)
+		}
+	}
+
+	if err := ioutil.WriteFile(jwtPath, []byte(fakeJWT(time.Now().Add(-time.Minute))), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.GetPlatformCredential(); err == nil || !strings.Contains(err.Error(), "expired") {
+		t.Errorf("expected an expired token to be rejected, got %v", err)
+	}
+
+	if err := ioutil.WriteFile(jwtPath, []byte("\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.GetPlatformCredential(); err == nil {
+		t.Error("expected an error for an empty token file")
+	}
+}
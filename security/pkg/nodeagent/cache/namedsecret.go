@@ -0,0 +1,195 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"fmt"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	informersv1 "k8s.io/client-go/informers/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	kubecache "k8s.io/client-go/tools/cache"
+
+	"istio.io/istio/pkg/security"
+)
+
+// The keys of the certificates in the Kubernetes Secrets, as for the credentialName of Gateways.
+const (
+	genericSecretCert   = "cert"
+	genericSecretKey    = "key"
+	genericSecretCaCert = "cacert"
+	tlsSecretCert       = "tls.crt"
+	tlsSecretKey        = "tls.key"
+	tlsSecretCaCert     = "ca.crt"
+)
+
+// generateNamedSecret returns the key and certificate, or the root certificate if root is set, of the
+// named secret name. Like the file certificates, the named secrets are not cached: the files, or the
+// Kubernetes Secrets, are watched to push their changes instead.
+func (sc *SecretManagerClient) generateNamedSecret(name string, root bool, resourceName string) (*security.SecretItem, error) {
+	source, ok := sc.configOptions.NamedSecrets[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown named secret %s", name)
+	}
+
+	var sitem *security.SecretItem
+	var err error
+	switch {
+	case source.KubernetesSecret != "":
+		sitem, err = sc.generateKubernetesSecret(source.KubernetesSecret, root, resourceName)
+	case root && source.CaCertificatePath != "":
+		if sitem, err = sc.generateRootCertFromExistingFile(source.CaCertificatePath, resourceName, false); err == nil {
+			sc.addFileWatcher(source.CaCertificatePath, resourceName)
+		}
+	case !root && source.CertificatePath != "":
+		if sitem, err = sc.generateKeyCertFromExistingFiles(source.CertificatePath, source.PrivateKeyPath, resourceName); err == nil {
+			// Adding cert is sufficient here as key can't change without changing the cert.
+			sc.addFileWatcher(source.CertificatePath, resourceName)
+		}
+	case root:
+		err = fmt.Errorf("named secret %s has no root certificate", name)
+	default:
+		err = fmt.Errorf("named secret %s has no certificate", name)
+	}
+	if err != nil {
+		cacheLog.Errorf("%s failed to generate named secret: %v", cacheLogPrefix(resourceName), err)
+		numFileSecretFailures.Increment()
+		return nil, err
+	}
+	cacheLog.WithLabels("resource", resourceName).Info("read named secret")
+	return sitem, nil
+}
+
+// generateKubernetesSecret returns the secret item of the Kubernetes Secret secretName.
+func (sc *SecretManagerClient) generateKubernetesSecret(secretName string, root bool, resourceName string) (*security.SecretItem, error) {
+	secret, err := sc.getKubernetesSecret(secretName)
+	if err != nil {
+		return nil, err
+	}
+	source := fmt.Sprintf("secret %s/%s", secret.Namespace, secret.Name)
+	if root {
+		rootCert := secret.Data[genericSecretCaCert]
+		if len(rootCert) == 0 {
+			rootCert = secret.Data[tlsSecretCaCert]
+		}
+		if len(rootCert) == 0 {
+			return nil, fmt.Errorf("%s has no root certificate", source)
+		}
+		return &security.SecretItem{
+			ResourceName: resourceName,
+			RootCert:     rootCert,
+		}, nil
+	}
+	cert, key := secret.Data[genericSecretCert], secret.Data[genericSecretKey]
+	if len(cert) == 0 {
+		cert, key = secret.Data[tlsSecretCert], secret.Data[tlsSecretKey]
+	}
+	if len(cert) == 0 || len(key) == 0 {
+		return nil, fmt.Errorf("%s has no certificate and private key", source)
+	}
+	return sc.loadKeyCertSecretItem(cert, key, source, resourceName)
+}
+
+// getKubernetesSecret returns the Kubernetes Secret secretName of the namespace of the workload,
+// from the informer watching it.
+func (sc *SecretManagerClient) getKubernetesSecret(secretName string) (*v1.Secret, error) {
+	informer, err := sc.kubernetesSecretInformer(secretName)
+	if err != nil {
+		return nil, err
+	}
+	namespace := sc.configOptions.WorkloadNamespace
+	if err := waitForInformerSync(informer, sc.stop); err != nil {
+		return nil, fmt.Errorf("failed to read secret %s/%s: %v", namespace, secretName, err)
+	}
+	obj, exists, err := informer.GetStore().GetByKey(namespace + "/" + secretName)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("secret %s/%s not found", namespace, secretName)
+	}
+	return obj.(*v1.Secret), nil
+}
+
+// kubernetesSecretInformer returns the informer of the Kubernetes Secret secretName, starting it on
+// the first request. The named secrets of the Kubernetes Secret are pushed when it changes.
+func (sc *SecretManagerClient) kubernetesSecretInformer(secretName string) (kubecache.SharedIndexInformer, error) {
+	sc.kubeSecretMutex.Lock()
+	defer sc.kubeSecretMutex.Unlock()
+	if informer, ok := sc.kubeSecrets[secretName]; ok {
+		return informer, nil
+	}
+
+	if sc.kubeClient == nil {
+		config, err := rest.InClusterConfig()
+		if err != nil {
+			return nil, fmt.Errorf("failed to create the Kubernetes client: %v", err)
+		}
+		if sc.kubeClient, err = kubernetes.NewForConfig(config); err != nil {
+			return nil, fmt.Errorf("failed to create the Kubernetes client: %v", err)
+		}
+	}
+	informer := informersv1.NewFilteredSecretInformer(sc.kubeClient, sc.configOptions.WorkloadNamespace, 0,
+		kubecache.Indexers{}, func(options *metav1.ListOptions) {
+			options.FieldSelector = fields.OneTermEqualSelector("metadata.name", secretName).String()
+		})
+	notify := func(obj interface{}) {
+		if key, _ := kubecache.DeletionHandlingMetaNamespaceKeyFunc(obj); key != sc.configOptions.WorkloadNamespace+"/"+secretName {
+			return
+		}
+		cacheLog.Infof("event for secret %s/%s, pushing to proxy", sc.configOptions.WorkloadNamespace, secretName)
+		for name, source := range sc.configOptions.NamedSecrets {
+			if source.KubernetesSecret == secretName {
+				sc.CallUpdateCallback(security.NamedSecretResourcePrefix + name)
+				sc.CallUpdateCallback(security.NamedSecretResourcePrefix + name + security.NamedSecretRootSuffix)
+			}
+		}
+	}
+	informer.AddEventHandler(kubecache.ResourceEventHandlerFuncs{
+		AddFunc:    notify,
+		UpdateFunc: func(_, obj interface{}) { notify(obj) },
+		DeleteFunc: notify,
+	})
+	go informer.Run(sc.stop)
+	sc.kubeSecrets[secretName] = informer
+	return informer, nil
+}
+
+// waitForInformerSync waits for the informer to sync, at most totalTimeout. An informer which could
+// not sync, such as if the service account is not allowed to read the secret, keeps retrying.
+func waitForInformerSync(informer kubecache.SharedIndexInformer, stop <-chan struct{}) error {
+	if informer.HasSynced() {
+		return nil
+	}
+	done := make(chan struct{})
+	defer close(done)
+	timeout := make(chan struct{})
+	go func() {
+		defer close(timeout)
+		select {
+		case <-stop:
+		case <-done:
+		case <-time.After(totalTimeout):
+		}
+	}()
+	if !kubecache.WaitForCacheSync(timeout, informer.HasSynced) {
+		return fmt.Errorf("timed out waiting for the secret to sync")
+	}
+	return nil
+}
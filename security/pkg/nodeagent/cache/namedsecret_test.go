@@ -0,0 +1,141 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"istio.io/istio/pkg/file"
+	"istio.io/istio/pkg/security"
+	"istio.io/istio/pkg/testcerts"
+)
+
+func TestNamedSecrets(t *testing.T) {
+	dir := t.TempDir()
+	for _, f := range []string{"root-cert.pem", "key.pem", "cert-chain.pem"} {
+		if err := file.AtomicCopy(filepath.Join("./testdata", f), dir, f); err != nil {
+			t.Fatal(err)
+		}
+	}
+	certChain, err := ioutil.ReadFile(filepath.Join(dir, "cert-chain.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateKey, err := ioutil.ReadFile(filepath.Join(dir, "key.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rootCert, err := ioutil.ReadFile(filepath.Join(dir, "root-cert.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u := NewUpdateTracker(t)
+	sc := createCache(t, nil, u.Callback, security.Options{
+		WorkloadNamespace: "default",
+		NamedSecrets: map[string]security.NamedSecret{
+			"partner-file": {
+				CertificatePath:   filepath.Join(dir, "cert-chain.pem"),
+				PrivateKeyPath:    filepath.Join(dir, "key.pem"),
+				CaCertificatePath: filepath.Join(dir, "root-cert.pem"),
+			},
+			"partner-kube": {KubernetesSecret: "partner"},
+			"missing":      {KubernetesSecret: "missing"},
+		},
+	})
+	client := fake.NewSimpleClientset(&v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "partner", Namespace: "default"},
+		Data: map[string][]byte{
+			"tls.crt": testcerts.ServerCert,
+			"tls.key": testcerts.ServerKey,
+			"ca.crt":  testcerts.CACert,
+		},
+	})
+	sc.kubeClient = client
+
+	t.Run("file", func(t *testing.T) {
+		checkSecret(t, sc, "named://partner-file", security.SecretItem{
+			ResourceName:     "named://partner-file",
+			CertificateChain: certChain,
+			PrivateKey:       privateKey,
+		})
+		checkSecret(t, sc, "named://partner-file-cacert", security.SecretItem{
+			ResourceName: "named://partner-file-cacert",
+			RootCert:     rootCert,
+		})
+		u.Expect(map[string]int{})
+
+		if err := file.AtomicWrite(filepath.Join(dir, "key.pem"), testcerts.RotatedKey, os.FileMode(0o644)); err != nil {
+			t.Fatal(err)
+		}
+		if err := file.AtomicWrite(filepath.Join(dir, "cert-chain.pem"), testcerts.RotatedCert, os.FileMode(0o644)); err != nil {
+			t.Fatal(err)
+		}
+		u.Expect(map[string]int{"named://partner-file": 1})
+		checkSecret(t, sc, "named://partner-file", security.SecretItem{
+			ResourceName:     "named://partner-file",
+			CertificateChain: testcerts.RotatedCert,
+			PrivateKey:       testcerts.RotatedKey,
+		})
+		u.Reset()
+	})
+
+	t.Run("kubernetes", func(t *testing.T) {
+		checkSecret(t, sc, "named://partner-kube", security.SecretItem{
+			ResourceName:     "named://partner-kube",
+			CertificateChain: testcerts.ServerCert,
+			PrivateKey:       testcerts.ServerKey,
+		})
+		checkSecret(t, sc, "named://partner-kube-cacert", security.SecretItem{
+			ResourceName: "named://partner-kube-cacert",
+			RootCert:     testcerts.CACert,
+		})
+		// The secret is pushed once it is first read by the informer.
+		u.Expect(map[string]int{"named://partner-kube": 1, "named://partner-kube-cacert": 1})
+
+		if _, err := client.CoreV1().Secrets("default").Update(context.TODO(), &v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "partner", Namespace: "default"},
+			Data: map[string][]byte{
+				"cert":   testcerts.RotatedCert,
+				"key":    testcerts.RotatedKey,
+				"cacert": testcerts.CACert,
+			},
+		}, metav1.UpdateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		u.Expect(map[string]int{"named://partner-kube": 2, "named://partner-kube-cacert": 2})
+		checkSecret(t, sc, "named://partner-kube", security.SecretItem{
+			ResourceName:     "named://partner-kube",
+			CertificateChain: testcerts.RotatedCert,
+			PrivateKey:       testcerts.RotatedKey,
+		})
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		for _, resourceName := range []string{"named://unknown", "named://missing"} {
+			if _, err := sc.GenerateSecret(resourceName); err == nil {
+				t.Errorf("expected an error for %s", resourceName)
+			}
+		}
+	})
+}
@@ -17,6 +17,8 @@ package cache
 
 import (
 	"bytes"
+	"crypto/x509"
+	"encoding/pem"
 	"fmt"
 	"io/ioutil"
 	"path/filepath"
@@ -26,6 +28,8 @@ import (
 
 	"github.com/cenkalti/backoff"
 	"github.com/fsnotify/fsnotify"
+	"k8s.io/client-go/kubernetes"
+	kubecache "k8s.io/client-go/tools/cache"
 
 	"istio.io/istio/pilot/pkg/model"
 	"istio.io/istio/pkg/file"
@@ -33,6 +37,7 @@ import (
 	"istio.io/istio/pkg/security"
 	"istio.io/istio/pkg/spiffe"
 	"istio.io/istio/security/pkg/monitoring"
+	"istio.io/istio/security/pkg/nodeagent/keyprovider"
 	nodeagentutil "istio.io/istio/security/pkg/nodeagent/util"
 	pkiutil "istio.io/istio/security/pkg/pki/util"
 	istiolog "istio.io/pkg/log"
@@ -59,16 +64,18 @@ const (
 // certificates. These are separated only due to the fact that Envoy has them separated.
 // Additionally, arbitrary certificates may be fetched from local files to support DestinationRule
 // and Gateway. Note that certificates stored externally will be sent from Istiod directly; the
-// in-agent SecretManagerClient has low privileges and cannot read Kubernetes Secrets or other
-// storage backends. Istiod is in charge of determining whether the agent (ie SecretManagerClient) or
+// in-agent SecretManagerClient has low privileges and only reads the Kubernetes Secrets of the
+// named secrets, with the credentials of the pod, and no other storage backends. Istiod is in charge of determining whether the agent (ie SecretManagerClient) or
 // Istiod will serve an SDS response, by selecting the appropriate cluster in the SDS configuration
 // it serves.
 //
-// SecretManagerClient supports two modes of retrieving certificate (potentially at the same time):
+// SecretManagerClient supports three modes of retrieving certificate (potentially at the same time):
 // * File based certificates. If certs are mounted under well-known path /etc/certs/{key,cert,root-cert.pem},
 //   requests for `default` and `ROOTCA` will automatically read from these files. Additionally,
 //   certificates from Gateway/DestinationRule can also be served. This is done by parsing resource
 //   names in accordance with model.SdsCertificateConfig (file-cert: and file-root:).
+// * Named secrets, requested as named://<name>, read from files or from the Kubernetes Secrets the
+//   service account of the pod is allowed to read, as configured in security.Options.NamedSecrets.
 // * On demand CSRs. This is used only for the `default` certificate. When this resource is
 //   requested, a CSR will be sent to the configured caClient.
 //
@@ -85,6 +92,9 @@ type SecretManagerClient struct {
 	// configOptions includes all configurable params for the cache.
 	configOptions *security.Options
 
+	// keyProvider generates the private keys of workload certificates, and loads the file mounted keys.
+	keyProvider keyprovider.Provider
+
 	// callback function to invoke when detecting secret change.
 	notifyCallback func(resourceName string)
 
@@ -113,6 +123,21 @@ type SecretManagerClient struct {
 	// Dynamically configured Trust Bundle
 	configTrustBundle []byte
 
+	// crlMutex protects crl and crlRefresh
+	crlMutex sync.RWMutex
+	// crl is the certificate revocation list last served with the workload root
+	crl []byte
+	// crlRefresh is the next update of the certificate revocation list the refresh of the workload root
+	// is scheduled for
+	crlRefresh time.Time
+
+	// kubeClient reads the Kubernetes Secrets of the named secrets. It is created on the first request
+	// of such a secret.
+	kubeClient kubernetes.Interface
+	// kubeSecrets are the informers of the Kubernetes Secrets of the named secrets, by secret name.
+	kubeSecrets     map[string]kubecache.SharedIndexInformer
+	kubeSecretMutex sync.Mutex
+
 	// queue maintains all certificate rotation events that need to be triggered when they are about to expire
 	queue queue.Delayed
 	stop  chan struct{}
@@ -163,8 +188,13 @@ type FileCert struct {
 
 // NewSecretManagerClient creates a new SecretManagerClient.
 func NewSecretManagerClient(caClient security.Client, options *security.Options) (*SecretManagerClient, error) {
+	keyProvider, err := keyprovider.New(options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the key provider: %v", err)
+	}
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
+		_ = keyProvider.Close()
 		return nil, err
 	}
 
@@ -172,6 +202,7 @@ func NewSecretManagerClient(caClient security.Client, options *security.Options)
 		queue:         queue.NewDelayed(queue.DelayQueueBuffer(0)),
 		caClient:      caClient,
 		configOptions: options,
+		keyProvider:   keyProvider,
 		existingCertificateFile: model.SdsCertificateConfig{
 			CertificatePath:   security.DefaultCertChainFilePath,
 			PrivateKeyPath:    security.DefaultKeyFilePath,
@@ -179,6 +210,7 @@ func NewSecretManagerClient(caClient security.Client, options *security.Options)
 		},
 		certWatcher: watcher,
 		fileCerts:   make(map[FileCert]struct{}),
+		kubeSecrets: make(map[string]kubecache.SharedIndexInformer),
 		stop:        make(chan struct{}),
 	}
 
@@ -192,6 +224,9 @@ func (sc *SecretManagerClient) Close() {
 	if sc.caClient != nil {
 		sc.caClient.Close()
 	}
+	if err := sc.keyProvider.Close(); err != nil {
+		cacheLog.Warnf("failed to close the key provider: %v", err)
+	}
 	close(sc.stop)
 }
 
@@ -220,16 +255,18 @@ func (sc *SecretManagerClient) getCachedSecret(resourceName string) (secret *sec
 			ns = &security.SecretItem{
 				ResourceName: resourceName,
 				RootCert:     rootCertBundle,
+				CRL:          sc.loadCRL(),
 			}
 			cacheLog.WithLabels("ttl", time.Until(c.ExpireTime)).Info("returned workload trust anchor from cache")
 
 		} else {
 			ns = &security.SecretItem{
-				ResourceName:     resourceName,
-				CertificateChain: c.CertificateChain,
-				PrivateKey:       c.PrivateKey,
-				ExpireTime:       c.ExpireTime,
-				CreatedTime:      c.CreatedTime,
+				ResourceName:       resourceName,
+				CertificateChain:   c.CertificateChain,
+				PrivateKey:         c.PrivateKey,
+				PrivateKeyProvider: c.PrivateKeyProvider,
+				ExpireTime:         c.ExpireTime,
+				CreatedTime:        c.CreatedTime,
 			}
 			cacheLog.WithLabels("ttl", time.Until(c.ExpireTime)).Info("returned workload certificate from cache")
 		}
@@ -253,7 +290,10 @@ func (sc *SecretManagerClient) GenerateSecret(resourceName string) (secret *secu
 		// if needed.
 		sc.outputMutex.Lock()
 		if resourceName == security.RootCertReqResourceName || resourceName == security.WorkloadKeyCertResourceName {
-			if err := nodeagentutil.OutputKeyCertToDir(sc.configOptions.OutputKeyCertToDir, secret.PrivateKey,
+			keyFile, err := sc.keyProvider.ExportKey(secret)
+			if err != nil {
+				cacheLog.Errorf("error when exporting the private key: %v", err)
+			} else if err := nodeagentutil.OutputKeyCertToDir(sc.configOptions.OutputKeyCertToDir, keyFile,
 				secret.CertificateChain, secret.RootCert); err != nil {
 				cacheLog.Errorf("error when output the resource: %v", err)
 			} else {
@@ -263,6 +303,10 @@ func (sc *SecretManagerClient) GenerateSecret(resourceName string) (secret *secu
 		sc.outputMutex.Unlock()
 	}()
 
+	if name, root, ok := security.NamedSecretFromResourceName(resourceName); ok {
+		return sc.generateNamedSecret(name, root, resourceName)
+	}
+
 	// First try to generate secret from file.
 	if sdsFromFile, ns, err := sc.generateFileSecret(resourceName); sdsFromFile {
 		if err != nil {
@@ -301,6 +345,7 @@ func (sc *SecretManagerClient) GenerateSecret(resourceName string) (secret *secu
 
 	if resourceName == security.RootCertReqResourceName {
 		ns.RootCert = sc.mergeConfigTrustBundle(ns.RootCert)
+		ns.CRL = sc.loadCRL()
 	} else {
 		// If periodic cert refresh resulted in discovery of a new root, trigger a ROOTCA request to refresh trust anchor
 		oldRoot := sc.cache.GetRoot()
@@ -309,6 +354,10 @@ func (sc *SecretManagerClient) GenerateSecret(resourceName string) (secret *secu
 			// We store the oldRoot only for comparison and not for serving
 			sc.cache.SetRoot(ns.RootCert)
 			sc.CallUpdateCallback(security.RootCertReqResourceName)
+		} else if sc.crlChanged() {
+			// The revocation list file may not have existed when it was last read, so it is not always watched.
+			cacheLog.Info("Certificate revocation list has changed")
+			sc.CallUpdateCallback(security.RootCertReqResourceName)
 		}
 	}
 
@@ -417,24 +466,35 @@ func (sc *SecretManagerClient) keyCertSecretItem(cert, key, resource string) (*s
 	if err != nil {
 		return nil, err
 	}
-	keyPEM, err := sc.readFileWithTimeout(key)
+	keyFile, err := sc.readFileWithTimeout(key)
 	if err != nil {
 		return nil, err
 	}
+	return sc.loadKeyCertSecretItem(certChain, keyFile, "file "+key, resource)
+}
+
+// loadKeyCertSecretItem returns the secret item of the certificate chain and private key read from source.
+func (sc *SecretManagerClient) loadKeyCertSecretItem(certChain, key []byte, source, resource string) (*security.SecretItem, error) {
+	privateKey, err := sc.keyProvider.LoadKey(key)
+	if err != nil {
+		cacheLog.Errorf("failed to load the private key from %s: %v", source, err)
+		return nil, fmt.Errorf("failed to load the private key from %s: %v", source, err)
+	}
 
 	now := time.Now()
 	var certExpireTime time.Time
 	if certExpireTime, err = nodeagentutil.ParseCertAndGetExpiryTimestamp(certChain); err != nil {
-		cacheLog.Errorf("failed to extract expiration time in the certificate loaded from file: %v", err)
-		return nil, fmt.Errorf("failed to extract expiration time in the certificate loaded from file: %v", err)
+		cacheLog.Errorf("failed to extract expiration time in the certificate loaded from %s: %v", source, err)
+		return nil, fmt.Errorf("failed to extract expiration time in the certificate loaded from %s: %v", source, err)
 	}
 
 	return &security.SecretItem{
-		CertificateChain: certChain,
-		PrivateKey:       keyPEM,
-		ResourceName:     resource,
-		CreatedTime:      now,
-		ExpireTime:       certExpireTime,
+		CertificateChain:   certChain,
+		PrivateKey:         privateKey.PEM,
+		PrivateKeyProvider: privateKey.PrivateKeyProvider,
+		ResourceName:       resource,
+		CreatedTime:        now,
+		ExpireTime:         certExpireTime,
 	}, nil
 }
 
@@ -539,18 +599,25 @@ func (sc *SecretManagerClient) generateNewSecret(resourceName string) (*security
 		ServiceAccount: sc.configOptions.ServiceAccount,
 	}
 
-	cacheLog.Debugf("constructed host name for CSR: %s", csrHostName.String())
+	// The DNS names are requested as DNS SANs next to the SPIFFE identity.
+	csrHosts := strings.Join(append([]string{csrHostName.String()}, sc.configOptions.CSRDNSNames...), ",")
+	cacheLog.Debugf("constructed host names for CSR: %s", csrHosts)
 	options := pkiutil.CertOptions{
-		Host:       csrHostName.String(),
+		Host:       csrHosts,
 		RSAKeySize: keySize,
 		PKCS8Key:   sc.configOptions.Pkcs8Keys,
 		ECSigAlg:   pkiutil.SupportedECSignatureAlgorithms(sc.configOptions.ECCSigAlg),
 	}
 
 	// Generate the cert/key, send CSR to CA.
-	csrPEM, keyPEM, err := pkiutil.GenCSR(options)
+	privateKey, err := sc.keyProvider.GenerateKey(options)
+	if err != nil {
+		cacheLog.Errorf("%s failed to generate key for CSR: %v", logPrefix, err)
+		return nil, err
+	}
+	csrPEM, err := pkiutil.GenCSRWithSigner(options, privateKey.Signer)
 	if err != nil {
-		cacheLog.Errorf("%s failed to generate key and certificate for CSR: %v", logPrefix, err)
+		cacheLog.Errorf("%s failed to generate CSR: %v", logPrefix, err)
 		return nil, err
 	}
 
@@ -578,12 +645,13 @@ func (sc *SecretManagerClient) generateNewSecret(resourceName string) (*security
 
 	cacheLog.WithLabels("latency", time.Since(t0), "ttl", time.Until(expireTime)).Info("generated new workload certificate")
 	return &security.SecretItem{
-		CertificateChain: certChain,
-		PrivateKey:       keyPEM,
-		ResourceName:     resourceName,
-		CreatedTime:      time.Now(),
-		ExpireTime:       expireTime,
-		RootCert:         []byte(certChainPEM[len(certChainPEM)-1]),
+		CertificateChain:   certChain,
+		PrivateKey:         privateKey.PEM,
+		PrivateKeyProvider: privateKey.PrivateKeyProvider,
+		ResourceName:       resourceName,
+		CreatedTime:        time.Now(),
+		ExpireTime:         expireTime,
+		RootCert:           []byte(certChainPEM[len(certChainPEM)-1]),
 	}, nil
 }
 
@@ -719,3 +787,90 @@ func (sc *SecretManagerClient) UpdateConfigTrustBundle(trustBundle []byte) error
 func (sc *SecretManagerClient) mergeConfigTrustBundle(rootCert []byte) []byte {
 	return pkiutil.AppendCertByte(sc.getConfigTrustBundle(), rootCert)
 }
+
+// loadCRL reads the certificate revocation list distributed with the workload root, and records it
+// as the one served. Envoy rejects peers when a CRL expires, so a refresh of the root is scheduled for
+// the time it does. The CRL is loaded on every request of the root, but a single refresh is scheduled
+// for each next update.
+func (sc *SecretManagerClient) loadCRL() []byte {
+	crl, nextUpdate := sc.readCRL()
+	sc.crlMutex.Lock()
+	defer sc.crlMutex.Unlock()
+	sc.crl = crl
+	if crl != nil && !nextUpdate.Equal(sc.crlRefresh) {
+		sc.crlRefresh = nextUpdate
+		sc.queue.PushDelayed(func() error {
+			sc.crlMutex.RLock()
+			superseded := !nextUpdate.Equal(sc.crlRefresh)
+			sc.crlMutex.RUnlock()
+			if !superseded {
+				sc.CallUpdateCallback(security.RootCertReqResourceName)
+			}
+			return nil
+		}, time.Until(nextUpdate))
+	}
+	return crl
+}
+
+// crlChanged returns whether the certificate revocation list differs from the one last served.
+func (sc *SecretManagerClient) crlChanged() bool {
+	if sc.configOptions.CRLFilePath == "" {
+		return false
+	}
+	crl, _ := sc.readCRL()
+	sc.crlMutex.RLock()
+	defer sc.crlMutex.RUnlock()
+	return !bytes.Equal(crl, sc.crl)
+}
+
+// readCRL returns the certificate revocation list, and the time it must be updated by. Nil is returned
+// if there is no usable CRL: Envoy rejects certificates of CAs without a CRL, so none is used when other
+// trust anchors are configured, or when it has expired.
+func (sc *SecretManagerClient) readCRL() ([]byte, time.Time) {
+	crlPath := sc.configOptions.CRLFilePath
+	if crlPath == "" {
+		return nil, time.Time{}
+	}
+	crl, err := ioutil.ReadFile(crlPath)
+	if err != nil || len(crl) == 0 {
+		return nil, time.Time{}
+	}
+	sc.addFileWatcher(crlPath, security.RootCertReqResourceName)
+	if len(sc.getConfigTrustBundle()) > 0 {
+		cacheLog.Warnf("ignoring certificate revocation list %s, as additional trust anchors are configured", crlPath)
+		return nil, time.Time{}
+	}
+	nextUpdate, err := validateCRL(crl, time.Now())
+	if err != nil {
+		cacheLog.Warnf("ignoring certificate revocation list %s: %v", crlPath, err)
+		return nil, time.Time{}
+	}
+	return crl, nextUpdate
+}
+
+// validateCRL checks that the PEM encoded CRLs can be parsed and have not expired, and returns the
+// earliest time one of them expires.
+func validateCRL(crlPEM []byte, now time.Time) (time.Time, error) {
+	var nextUpdate time.Time
+	for rest := crlPEM; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		crl, err := x509.ParseCRL(block.Bytes)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("failed to parse CRL: %v", err)
+		}
+		if crl.HasExpired(now) {
+			return time.Time{}, fmt.Errorf("CRL of %v expired at %v", crl.TBSCertList.Issuer, crl.TBSCertList.NextUpdate)
+		}
+		if nextUpdate.IsZero() || crl.TBSCertList.NextUpdate.Before(nextUpdate) {
+			nextUpdate = crl.TBSCertList.NextUpdate
+		}
+	}
+	if nextUpdate.IsZero() {
+		return time.Time{}, fmt.Errorf("no CRL found")
+	}
+	return nextUpdate, nil
+}
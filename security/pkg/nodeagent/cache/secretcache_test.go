@@ -16,8 +16,13 @@ package cache
 
 import (
 	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
 	"fmt"
 	"io/ioutil"
+	"math/big"
 	"os"
 	"path/filepath"
 	"reflect"
@@ -32,6 +37,7 @@ import (
 	"istio.io/istio/pkg/test/util/retry"
 	"istio.io/istio/pkg/testcerts"
 	"istio.io/istio/security/pkg/nodeagent/caclient/providers/mock"
+	pkiutil "istio.io/istio/security/pkg/pki/util"
 	"istio.io/istio/tests/util/leak"
 	"istio.io/pkg/log"
 )
@@ -108,6 +114,47 @@ func testWorkloadAgentGenerateSecret(t *testing.T, isUsingPluginProvider bool) {
 	}
 }
 
+// csrRecorder records the CSRs sent to the CA.
+type csrRecorder struct {
+	*mock.CAClient
+	csrs [][]byte
+}
+
+func (c *csrRecorder) CSRSign(csrPEM []byte, certValidTTLInSec int64) ([]string, error) {
+	c.csrs = append(c.csrs, csrPEM)
+	return c.CAClient.CSRSign(csrPEM, certValidTTLInSec)
+}
+
+func TestWorkloadAgentGenerateSecretDNSNames(t *testing.T) {
+	fakeCACli, err := mock.NewMockCAClient(time.Hour)
+	if err != nil {
+		t.Fatalf("Error creating Mock CA client: %v", err)
+	}
+	caClient := &csrRecorder{CAClient: fakeCACli}
+	sc := createCache(t, caClient, func(resourceName string) {}, security.Options{
+		TrustDomain:       "cluster.local",
+		WorkloadNamespace: "istio-system",
+		ServiceAccount:    "ingressgateway",
+		CSRDNSNames:       []string{"bookinfo.example.com", "*.example.com"},
+	})
+	if _, err := sc.GenerateSecret(security.WorkloadKeyCertResourceName); err != nil {
+		t.Fatalf("Failed to get secrets: %v", err)
+	}
+	if len(caClient.csrs) != 1 {
+		t.Fatalf("expected 1 CSR, got %d", len(caClient.csrs))
+	}
+	csr, err := pkiutil.ParsePemEncodedCSR(caClient.csrs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"bookinfo.example.com", "*.example.com"}; !reflect.DeepEqual(csr.DNSNames, want) {
+		t.Errorf("got DNS names %v, want %v", csr.DNSNames, want)
+	}
+	if len(csr.URIs) != 1 || csr.URIs[0].String() != "spiffe://cluster.local/ns/istio-system/sa/ingressgateway" {
+		t.Errorf("unexpected URIs %v", csr.URIs)
+	}
+}
+
 type UpdateTracker struct {
 	t    *testing.T
 	hits map[string]int
@@ -474,7 +521,8 @@ func verifySecret(t *testing.T, gotSecret *security.SecretItem, expectedSecret *
 			gotSecret.ResourceName)
 	}
 	cfg, ok := model.SdsCertificateConfigFromResourceName(expectedSecret.ResourceName)
-	if expectedSecret.ResourceName == security.RootCertReqResourceName || (ok && cfg.IsRootCertificate()) {
+	_, namedRoot, _ := security.NamedSecretFromResourceName(expectedSecret.ResourceName)
+	if expectedSecret.ResourceName == security.RootCertReqResourceName || (ok && cfg.IsRootCertificate()) || namedRoot {
 		if !bytes.Equal(expectedSecret.RootCert, gotSecret.RootCert) {
 			t.Fatalf("root cert: expected %v but got %v", expectedSecret.RootCert,
 				gotSecret.RootCert)
@@ -594,3 +642,130 @@ func TestProxyConfigAnchors(t *testing.T) {
 		RootCert:     rootCert,
 	})
 }
+
+func signCRL(t *testing.T, nextUpdate time.Time) []byte {
+	t.Helper()
+	certPEM, keyPEM, err := pkiutil.GenCertKeyFromOptions(pkiutil.CertOptions{
+		TTL:          time.Hour,
+		Org:          "MyOrg",
+		IsCA:         true,
+		IsSelfSigned: true,
+		RSAKeySize:   2048,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := pkiutil.ParsePemEncodedCertificate(certPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := pkiutil.ParsePemEncodedKey(keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:     big.NewInt(1),
+		ThisUpdate: nextUpdate.Add(-time.Hour),
+		NextUpdate: nextUpdate,
+	}, cert, key.(crypto.Signer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: der})
+}
+
+func TestCRL(t *testing.T) {
+	fakeCACli, err := mock.NewMockCAClient(time.Hour)
+	if err != nil {
+		t.Fatalf("Error creating Mock CA client: %v", err)
+	}
+	crlPath := filepath.Join(t.TempDir(), "ca-crl.pem")
+	u := NewUpdateTracker(t)
+	sc := createCache(t, fakeCACli, u.Callback, security.Options{CRLFilePath: crlPath})
+
+	if _, err := sc.GenerateSecret(security.WorkloadKeyCertResourceName); err != nil {
+		t.Fatal(err)
+	}
+	root, err := sc.GenerateSecret(security.RootCertReqResourceName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root.CRL != nil {
+		t.Fatalf("expected no CRL without the file, got %s", root.CRL)
+	}
+
+	crl := signCRL(t, time.Now().Add(time.Hour))
+	if err := ioutil.WriteFile(crlPath, crl, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if !sc.crlChanged() {
+		t.Fatal("expected the CRL to be changed")
+	}
+	root, err = sc.GenerateSecret(security.RootCertReqResourceName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(root.CRL, crl) {
+		t.Fatalf("expected CRL %s, got %s", crl, root.CRL)
+	}
+
+	// Envoy rejects all peers with an expired CRL, so it is not served
+	if err := ioutil.WriteFile(crlPath, signCRL(t, time.Now().Add(-time.Minute)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	root, err = sc.GenerateSecret(security.RootCertReqResourceName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root.CRL != nil {
+		t.Fatalf("expected no CRL once expired, got %s", root.CRL)
+	}
+}
+
+func TestCRLRefresh(t *testing.T) {
+	fakeCACli, err := mock.NewMockCAClient(time.Hour)
+	if err != nil {
+		t.Fatalf("Error creating Mock CA client: %v", err)
+	}
+	crlPath := filepath.Join(t.TempDir(), "ca-crl.pem")
+	if err := ioutil.WriteFile(crlPath, signCRL(t, time.Now().Add(2*time.Second)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	u := NewUpdateTracker(t)
+	sc := createCache(t, fakeCACli, u.Callback, security.Options{CRLFilePath: crlPath})
+
+	// The CRL is loaded on every request of the root, but the root is refreshed once when it expires
+	for i := 0; i < 3; i++ {
+		if sc.loadCRL() == nil {
+			t.Fatal("expected the CRL to be served")
+		}
+	}
+	retry.UntilSuccessOrFail(t, func() error {
+		u.mu.Lock()
+		defer u.mu.Unlock()
+		if u.hits[security.RootCertReqResourceName] == 0 {
+			return fmt.Errorf("the root was not refreshed")
+		}
+		return nil
+	}, retry.Timeout(5*time.Second))
+	time.Sleep(100 * time.Millisecond)
+	u.Expect(map[string]int{security.RootCertReqResourceName: 1})
+}
+
+func TestValidateCRL(t *testing.T) {
+	now := time.Now()
+	first, second := now.Add(time.Hour), now.Add(2*time.Hour)
+	nextUpdate, err := validateCRL(append(signCRL(t, second), signCRL(t, first)...), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !nextUpdate.Equal(first.UTC().Truncate(time.Second)) {
+		t.Fatalf("expected next update %v, got %v", first, nextUpdate)
+	}
+	if _, err := validateCRL([]byte("not a crl"), now); err == nil {
+		t.Fatal("expected error for missing CRL")
+	}
+	if _, err := validateCRL(signCRL(t, first), second); err == nil {
+		t.Fatal("expected error for expired CRL")
+	}
+}
@@ -0,0 +1,197 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package keyprovider
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+
+	"istio.io/istio/pkg/security"
+)
+
+const (
+	// encryptedKeyBlockType is the PEM block type of the private keys encrypted by EncryptKey.
+	encryptedKeyBlockType = "ISTIO ENCRYPTED PRIVATE KEY"
+	// wrappedKeyHeader is the PEM header holding the wrapped data key of an encrypted private key.
+	wrappedKeyHeader = "Wrapped-Key"
+
+	dataKeySize = 32
+)
+
+// KeyWrapper wraps the data keys encrypting private keys, as the key encryption key of a KMS does.
+type KeyWrapper interface {
+	WrapKey(dataKey []byte) ([]byte, error)
+	UnwrapKey(wrappedKey []byte) ([]byte, error)
+}
+
+// aesKeyWrapper wraps data keys with a local AES-256 key encryption key.
+type aesKeyWrapper struct {
+	aead cipher.AEAD
+}
+
+// NewLocalKeyWrapper returns a KeyWrapper using the AES-256 key encryption key in kekFile,
+// either raw or base64 encoded.
+func NewLocalKeyWrapper(kekFile string) (KeyWrapper, error) {
+	kek, err := ioutil.ReadFile(kekFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the key encryption key: %v", err)
+	}
+	if len(kek) != dataKeySize {
+		decoded, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(kek)))
+		if err != nil || len(decoded) != dataKeySize {
+			return nil, fmt.Errorf("the key encryption key in %s is not a %d bytes key", kekFile, dataKeySize)
+		}
+		kek = decoded
+	}
+	aead, err := newAEAD(kek)
+	if err != nil {
+		return nil, err
+	}
+	return &aesKeyWrapper{aead: aead}, nil
+}
+
+func (w *aesKeyWrapper) WrapKey(dataKey []byte) ([]byte, error) {
+	return seal(w.aead, dataKey)
+}
+
+func (w *aesKeyWrapper) UnwrapKey(wrappedKey []byte) ([]byte, error) {
+	return open(w.aead, wrappedKey)
+}
+
+// EncryptKey encrypts keyPEM with a new data key, which is wrapped by wrapper and kept with the encrypted key.
+func EncryptKey(keyPEM []byte, wrapper KeyWrapper) ([]byte, error) {
+	dataKey := make([]byte, dataKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, err
+	}
+	defer zero(dataKey)
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	ciphertext, err := seal(aead, keyPEM)
+	if err != nil {
+		return nil, err
+	}
+	wrappedKey, err := wrapper.WrapKey(dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to wrap the data key: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{
+		Type:    encryptedKeyBlockType,
+		Headers: map[string]string{wrappedKeyHeader: base64.StdEncoding.EncodeToString(wrappedKey)},
+		Bytes:   ciphertext,
+	}), nil
+}
+
+// DecryptKey returns the PEM encoded private key encrypted by EncryptKey.
+func DecryptKey(encryptedPEM []byte, wrapper KeyWrapper) ([]byte, error) {
+	block, _ := pem.Decode(encryptedPEM)
+	if block == nil || block.Type != encryptedKeyBlockType {
+		return nil, fmt.Errorf("no encrypted private key")
+	}
+	wrappedKey, err := base64.StdEncoding.DecodeString(block.Headers[wrappedKeyHeader])
+	if err != nil || len(wrappedKey) == 0 {
+		return nil, fmt.Errorf("no wrapped data key in the encrypted private key")
+	}
+	dataKey, err := wrapper.UnwrapKey(wrappedKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap the data key: %v", err)
+	}
+	defer zero(dataKey)
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	keyPEM, err := open(aead, block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt the private key: %v", err)
+	}
+	return keyPEM, nil
+}
+
+// envelopeProvider holds the keys in process memory, and encrypts them with a data key wrapped by a
+// KeyWrapper when they are written to disk. Encrypted key files are decrypted when loaded.
+type envelopeProvider struct {
+	memoryProvider
+	wrapper KeyWrapper
+}
+
+func newEnvelopeProvider(options *security.Options) (Provider, error) {
+	if options.KeyEncryptionKeyFile == "" {
+		return nil, fmt.Errorf("the key encryption key file is required by the %s key provider", Envelope)
+	}
+	wrapper, err := NewLocalKeyWrapper(options.KeyEncryptionKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	return &envelopeProvider{wrapper: wrapper}, nil
+}
+
+func (p *envelopeProvider) LoadKey(keyFile []byte) (*Key, error) {
+	if block, _ := pem.Decode(keyFile); block == nil || block.Type != encryptedKeyBlockType {
+		keyLog.Debugf("loading a private key which is not encrypted")
+		return p.memoryProvider.LoadKey(keyFile)
+	}
+	keyPEM, err := DecryptKey(keyFile, p.wrapper)
+	if err != nil {
+		return nil, err
+	}
+	return &Key{PEM: keyPEM}, nil
+}
+
+func (p *envelopeProvider) ExportKey(secret *security.SecretItem) ([]byte, error) {
+	if len(secret.PrivateKey) == 0 {
+		return nil, nil
+	}
+	return EncryptKey(secret.PrivateKey, p.wrapper)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal returns the nonce followed by the encrypted plaintext.
+func seal(aead cipher.AEAD, plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func open(aead cipher.AEAD, ciphertext []byte) ([]byte, error) {
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+	nonce := ciphertext[:aead.NonceSize()]
+	return aead.Open(nil, nonce, ciphertext[aead.NonceSize():], nil)
+}
+
+func zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package keyprovider
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"istio.io/istio/pkg/security"
+	pkiutil "istio.io/istio/security/pkg/pki/util"
+)
+
+func writeKEK(t *testing.T, encode bool) string {
+	t.Helper()
+	kek := make([]byte, dataKeySize)
+	if _, err := rand.Read(kek); err != nil {
+		t.Fatal(err)
+	}
+	if encode {
+		kek = []byte(base64.StdEncoding.EncodeToString(kek) + "\n")
+	}
+	kekFile := filepath.Join(t.TempDir(), "kek")
+	if err := ioutil.WriteFile(kekFile, kek, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return kekFile
+}
+
+func TestEnvelopeProvider(t *testing.T) {
+	for name, encode := range map[string]bool{"raw key encryption key": false, "base64 key encryption key": true} {
+		t.Run(name, func(t *testing.T) {
+			p, err := New(&security.Options{KeyProvider: Envelope, KeyEncryptionKeyFile: writeKEK(t, encode)})
+			if err != nil {
+				t.Fatalf("failed to create the envelope key provider: %v", err)
+			}
+			defer p.Close()
+
+			options := pkiutil.CertOptions{Host: testHost, RSAKeySize: 2048}
+			key, err := p.GenerateKey(options)
+			if err != nil {
+				t.Fatalf("GenerateKey error: %v", err)
+			}
+			checkCSR(t, options, key.Signer)
+
+			encrypted, err := p.ExportKey(&security.SecretItem{PrivateKey: key.PEM})
+			if err != nil {
+				t.Fatalf("ExportKey error: %v", err)
+			}
+			if bytes.Contains(encrypted, key.PEM) || !bytes.Contains(encrypted, []byte(encryptedKeyBlockType)) {
+				t.Fatalf("expected the exported key to be encrypted, got %s", encrypted)
+			}
+			loaded, err := p.LoadKey(encrypted)
+			if err != nil {
+				t.Fatalf("LoadKey error: %v", err)
+			}
+			if !bytes.Equal(loaded.PEM, key.PEM) {
+				t.Errorf("expected the decrypted key to be the generated key, got %s", loaded.PEM)
+			}
+
+			// Keys which are not encrypted, such as the keys of gateways, are loaded as is.
+			if loaded, err := p.LoadKey(key.PEM); err != nil || !bytes.Equal(loaded.PEM, key.PEM) {
+				t.Errorf("expected the plain key to be loaded, got %v %v", loaded, err)
+			}
+		})
+	}
+}
+
+func TestEnvelopeDecryptErrors(t *testing.T) {
+	wrapper, err := NewLocalKeyWrapper(writeKEK(t, false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherWrapper, err := NewLocalKeyWrapper(writeKEK(t, false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted, err := EncryptKey([]byte("private key"), wrapper)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decrypted, err := DecryptKey(encrypted, wrapper); err != nil || string(decrypted) != "private key" {
+		t.Fatalf("expected the key to be decrypted, got %s %v", decrypted, err)
+	}
+	if _, err := DecryptKey(encrypted, otherWrapper); err == nil {
+		t.Error("expected an error unwrapping the data key with another key encryption key")
+	}
+
+	tampered := bytes.Replace(encrypted, []byte("\n\n"), []byte("\n\nAA"), 1)
+	if _, err := DecryptKey(tampered, wrapper); err == nil {
+		t.Error("expected an error decrypting a tampered key")
+	}
+	if _, err := DecryptKey([]byte("not a key"), wrapper); err == nil {
+		t.Error("expected an error without an encrypted key")
+	}
+
+	shortKEK := filepath.Join(t.TempDir(), "kek")
+	if err := ioutil.WriteFile(shortKEK, []byte("short"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewLocalKeyWrapper(shortKEK); err == nil {
+		t.Error("expected an error for a short key encryption key")
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package keyprovider generates and protects the private keys of workload certificates.
+package keyprovider
+
+import (
+	"crypto"
+	"fmt"
+
+	"istio.io/istio/pkg/security"
+	pkiutil "istio.io/istio/security/pkg/pki/util"
+	"istio.io/pkg/log"
+)
+
+var keyLog = log.RegisterScope("keyprovider", "Workload private key provider", 0)
+
+const (
+	// Memory is the default key provider, holding the keys in process memory.
+	Memory = ""
+	// PKCS11 is the key provider holding the keys in a PKCS#11 token.
+	PKCS11 = "pkcs11"
+	// Envelope is the key provider encrypting the keys at rest with a wrapped data key.
+	Envelope = "envelope"
+)
+
+// Key is a private key of a workload certificate.
+type Key struct {
+	// Signer signs with the key. It is only set for generated keys, to sign their CSR.
+	Signer crypto.Signer
+
+	// PEM is the PEM encoded key, given to Envoy inline. It is empty if the key cannot be exported.
+	PEM []byte
+
+	// PrivateKeyProvider locates the key for Envoy if the key cannot be exported.
+	PrivateKeyProvider *security.PrivateKeyProvider
+}
+
+// Provider generates the private keys of workload certificates, and gives them to Envoy.
+type Provider interface {
+	// GenerateKey generates a private key of the type set by options.
+	GenerateKey(options pkiutil.CertOptions) (*Key, error)
+
+	// LoadKey returns the key read from a key file, such as a file mounted key. Plain PEM encoded keys are
+	// always accepted, so that the certificates of gateways keep being read from files.
+	LoadKey(keyFile []byte) (*Key, error)
+
+	// ExportKey returns the key of secret as written to a key file, or nil if it is not written.
+	ExportKey(secret *security.SecretItem) ([]byte, error)
+
+	// Close releases the resources held by the provider.
+	Close() error
+}
+
+// New creates the key provider set by options.
+func New(options *security.Options) (Provider, error) {
+	if options == nil {
+		return &memoryProvider{}, nil
+	}
+	switch options.KeyProvider {
+	case Memory:
+		return &memoryProvider{}, nil
+	case PKCS11:
+		return newPKCS11Provider(options)
+	case Envelope:
+		return newEnvelopeProvider(options)
+	default:
+		return nil, fmt.Errorf("unknown key provider %q", options.KeyProvider)
+	}
+}
+
+// memoryProvider holds the keys in process memory, giving them to Envoy inline.
+type memoryProvider struct{}
+
+func (p *memoryProvider) GenerateKey(options pkiutil.CertOptions) (*Key, error) {
+	signer, err := pkiutil.GenerateKey(options)
+	if err != nil {
+		return nil, fmt.Errorf("key generation failed (%v)", err)
+	}
+	keyPEM, err := pkiutil.EncodePrivateKey(signer, options.PKCS8Key)
+	if err != nil {
+		return nil, err
+	}
+	return &Key{Signer: signer, PEM: keyPEM}, nil
+}
+
+func (p *memoryProvider) LoadKey(keyFile []byte) (*Key, error) {
+	return &Key{PEM: keyFile}, nil
+}
+
+func (p *memoryProvider) ExportKey(secret *security.SecretItem) ([]byte, error) {
+	return secret.PrivateKey, nil
+}
+
+func (p *memoryProvider) Close() error {
+	return nil
+}
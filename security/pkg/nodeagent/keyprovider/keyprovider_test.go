@@ -0,0 +1,101 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package keyprovider
+
+import (
+	"crypto"
+	"testing"
+
+	"istio.io/istio/pkg/security"
+	pkiutil "istio.io/istio/security/pkg/pki/util"
+)
+
+const testHost = "spiffe://cluster.local/ns/default/sa/default"
+
+// checkCSR checks a CSR signed by the key can be created, and the key is the one of the CSR.
+func checkCSR(t *testing.T, options pkiutil.CertOptions, signer crypto.Signer) {
+	t.Helper()
+	csrPEM, err := pkiutil.GenCSRWithSigner(options, signer)
+	if err != nil {
+		t.Fatalf("failed to create the CSR: %v", err)
+	}
+	csr, err := pkiutil.ParsePemEncodedCSR(csrPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := csr.CheckSignature(); err != nil {
+		t.Errorf("invalid CSR signature: %v", err)
+	}
+	if !samePublicKey(csr.PublicKey, signer.Public()) {
+		t.Errorf("the CSR is not for the generated key")
+	}
+}
+
+func samePublicKey(a, b crypto.PublicKey) bool {
+	return a.(interface{ Equal(crypto.PublicKey) bool }).Equal(b)
+}
+
+func TestMemoryProvider(t *testing.T) {
+	p, err := New(&security.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	options := pkiutil.CertOptions{Host: testHost, ECSigAlg: pkiutil.EcdsaSigAlg, PKCS8Key: true}
+	key, err := p.GenerateKey(options)
+	if err != nil {
+		t.Fatalf("GenerateKey error: %v", err)
+	}
+	if key.PrivateKeyProvider != nil {
+		t.Errorf("unexpected private key provider %v", key.PrivateKeyProvider)
+	}
+	parsed, err := pkiutil.ParsePemEncodedKey(key.PEM)
+	if err != nil {
+		t.Fatalf("invalid PEM encoded key: %v", err)
+	}
+	if !samePublicKey(parsed.(crypto.Signer).Public(), key.Signer.Public()) {
+		t.Errorf("the PEM encoded key is not the generated key")
+	}
+	checkCSR(t, options, key.Signer)
+
+	if exported, err := p.ExportKey(&security.SecretItem{PrivateKey: key.PEM}); err != nil || string(exported) != string(key.PEM) {
+		t.Errorf("expected the key to be exported as is, got %s %v", exported, err)
+	}
+	if loaded, err := p.LoadKey(key.PEM); err != nil || string(loaded.PEM) != string(key.PEM) {
+		t.Errorf("expected the key to be loaded as is, got %v %v", loaded, err)
+	}
+
+	if _, err := p.GenerateKey(pkiutil.CertOptions{Host: testHost, RSAKeySize: 1024}); err == nil {
+		t.Error("expected an error for a small RSA key")
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	for name, options := range map[string]*security.Options{
+		"unknown provider":        {KeyProvider: "tpm"},
+		"envelope without key":    {KeyProvider: Envelope},
+		"envelope missing key":    {KeyProvider: Envelope, KeyEncryptionKeyFile: "/does/not/exist"},
+		"pkcs11 without module":   {KeyProvider: PKCS11, PKCS11TokenLabel: "istio"},
+		"pkcs11 without token":    {KeyProvider: PKCS11, PKCS11Module: "/usr/lib/softhsm/libsofthsm2.so"},
+		"pkcs11 without bindings": {KeyProvider: PKCS11, PKCS11Module: "/usr/lib/softhsm/libsofthsm2.so", PKCS11TokenLabel: "istio"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := New(options); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
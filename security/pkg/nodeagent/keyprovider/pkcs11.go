@@ -0,0 +1,205 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package keyprovider
+
+import (
+	"bytes"
+	"crypto"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"istio.io/istio/pkg/security"
+	pkiutil "istio.io/istio/security/pkg/pki/util"
+)
+
+const (
+	// pkcs11URIScheme is the scheme of the RFC 7512 URIs of the keys held by a PKCS#11 token.
+	pkcs11URIScheme = "pkcs11:"
+
+	// keepKeyPairs is the number of key pairs kept on the token, so that the key of the certificate
+	// being replaced is still usable by Envoy until it gets the new certificate.
+	keepKeyPairs = 2
+)
+
+// Token is the subset of a PKCS#11 token used by the key provider. The private keys of the key pairs
+// generated on the token never leave it, and Envoy uses them through their label.
+type Token interface {
+	// GenerateKeyPair generates on the token a key pair of the type set by options, labeled label.
+	GenerateKeyPair(label string, options pkiutil.CertOptions) (crypto.Signer, error)
+
+	// FindKeyPair returns the key pair labeled label.
+	FindKeyPair(label string) (crypto.Signer, error)
+
+	// DestroyKeyPair removes the key pair labeled label from the token.
+	DestroyKeyPair(label string) error
+
+	// Close logs out of the token.
+	Close() error
+}
+
+// TokenOpener opens the token labeled tokenLabel of the PKCS#11 module at modulePath, logging in with pin.
+type TokenOpener func(modulePath, tokenLabel, pin string) (Token, error)
+
+var (
+	tokenOpenerMutex sync.RWMutex
+	tokenOpener      TokenOpener
+)
+
+// RegisterTokenOpener sets the binding of PKCS#11 modules, such as SoftHSM, used by the pkcs11 key provider.
+// It is called by the binding when it is linked in the agent, since it requires cgo.
+func RegisterTokenOpener(opener TokenOpener) {
+	tokenOpenerMutex.Lock()
+	defer tokenOpenerMutex.Unlock()
+	tokenOpener = opener
+}
+
+// pkcs11Provider generates the keys on a PKCS#11 token, and gives Envoy the label of the key
+// through the "pkcs11" private key provider.
+type pkcs11Provider struct {
+	token      Token
+	module     string
+	tokenLabel string
+	pinFile    string
+
+	mutex sync.Mutex
+	// labels are the labels of the key pairs generated on the token, the most recent last.
+	labels []string
+}
+
+func newPKCS11Provider(options *security.Options) (Provider, error) {
+	if options.PKCS11Module == "" || options.PKCS11TokenLabel == "" {
+		return nil, fmt.Errorf("the PKCS#11 module and token label are required by the %s key provider", PKCS11)
+	}
+	tokenOpenerMutex.RLock()
+	opener := tokenOpener
+	tokenOpenerMutex.RUnlock()
+	if opener == nil {
+		return nil, fmt.Errorf("no PKCS#11 binding is linked in this build")
+	}
+	var pin []byte
+	if options.PKCS11PinFile != "" {
+		var err error
+		if pin, err = ioutil.ReadFile(options.PKCS11PinFile); err != nil {
+			return nil, fmt.Errorf("failed to read the PKCS#11 PIN: %v", err)
+		}
+	}
+	token, err := opener(options.PKCS11Module, options.PKCS11TokenLabel, string(bytes.TrimSpace(pin)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the PKCS#11 token %s: %v", options.PKCS11TokenLabel, err)
+	}
+	keyLog.Infof("using the PKCS#11 token %s of %s", options.PKCS11TokenLabel, options.PKCS11Module)
+	return &pkcs11Provider{
+		token:      token,
+		module:     options.PKCS11Module,
+		tokenLabel: options.PKCS11TokenLabel,
+		pinFile:    options.PKCS11PinFile,
+	}, nil
+}
+
+func (p *pkcs11Provider) GenerateKey(options pkiutil.CertOptions) (*Key, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	label := fmt.Sprintf("istio-workload-%d", time.Now().UnixNano())
+	signer, err := p.token.GenerateKeyPair(label, options)
+	if err != nil {
+		return nil, fmt.Errorf("key generation on the PKCS#11 token failed (%v)", err)
+	}
+	p.labels = append(p.labels, label)
+	for len(p.labels) > keepKeyPairs {
+		if err := p.token.DestroyKeyPair(p.labels[0]); err != nil {
+			keyLog.Warnf("failed to destroy the key pair %s: %v", p.labels[0], err)
+		}
+		p.labels = p.labels[1:]
+	}
+	return &Key{Signer: signer, PrivateKeyProvider: p.privateKeyProvider(label)}, nil
+}
+
+// LoadKey returns the key pair of the token identified by a "pkcs11:" URI in keyFile, or the PEM encoded key.
+func (p *pkcs11Provider) LoadKey(keyFile []byte) (*Key, error) {
+	uri := strings.TrimSpace(string(keyFile))
+	if !strings.HasPrefix(uri, pkcs11URIScheme) {
+		return &Key{PEM: keyFile}, nil
+	}
+	attributes, err := parsePKCS11URI(uri)
+	if err != nil {
+		return nil, err
+	}
+	if token, ok := attributes["token"]; ok && token != p.tokenLabel {
+		return nil, fmt.Errorf("the key %s is not on the token %s", uri, p.tokenLabel)
+	}
+	label := attributes["object"]
+	if label == "" {
+		return nil, fmt.Errorf("no object label in %s", uri)
+	}
+	signer, err := p.token.FindKeyPair(label)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find the key pair %s: %v", label, err)
+	}
+	return &Key{Signer: signer, PrivateKeyProvider: p.privateKeyProvider(label)}, nil
+}
+
+// ExportKey returns the "pkcs11:" URI of the key pair of secret.
+func (p *pkcs11Provider) ExportKey(secret *security.SecretItem) ([]byte, error) {
+	if secret.PrivateKeyProvider == nil {
+		return secret.PrivateKey, nil
+	}
+	return []byte(fmt.Sprintf("%stoken=%s;object=%s;type=private", pkcs11URIScheme,
+		url.PathEscape(p.tokenLabel), url.PathEscape(secret.PrivateKeyProvider.Config["key_label"]))), nil
+}
+
+func (p *pkcs11Provider) Close() error {
+	return p.token.Close()
+}
+
+func (p *pkcs11Provider) privateKeyProvider(label string) *security.PrivateKeyProvider {
+	return &security.PrivateKeyProvider{
+		ProviderName: PKCS11,
+		Config: map[string]string{
+			"module":      p.module,
+			"token_label": p.tokenLabel,
+			"key_label":   label,
+			"pin_file":    p.pinFile,
+		},
+	}
+}
+
+// parsePKCS11URI returns the path attributes of a RFC 7512 PKCS#11 URI.
+func parsePKCS11URI(uri string) (map[string]string, error) {
+	path := strings.TrimPrefix(uri, pkcs11URIScheme)
+	if i := strings.Index(path, "?"); i >= 0 {
+		path = path[:i]
+	}
+	attributes := map[string]string{}
+	for _, attribute := range strings.Split(path, ";") {
+		if attribute == "" {
+			continue
+		}
+		kv := strings.SplitN(attribute, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid attribute %q in %s", attribute, uri)
+		}
+		value, err := url.PathUnescape(kv[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid attribute %q in %s: %v", attribute, uri, err)
+		}
+		attributes[kv[0]] = value
+	}
+	return attributes, nil
+}
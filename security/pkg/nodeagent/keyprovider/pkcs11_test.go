@@ -0,0 +1,191 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package keyprovider
+
+import (
+	"crypto"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+
+	"istio.io/istio/pkg/security"
+	pkiutil "istio.io/istio/security/pkg/pki/util"
+)
+
+// softToken is a software token standing in for a PKCS#11 module such as SoftHSM.
+type softToken struct {
+	mutex    sync.Mutex
+	keyPairs map[string]crypto.Signer
+	closed   bool
+}
+
+func (s *softToken) GenerateKeyPair(label string, options pkiutil.CertOptions) (crypto.Signer, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	signer, err := pkiutil.GenerateKey(options)
+	if err != nil {
+		return nil, err
+	}
+	s.keyPairs[label] = signer
+	return signer, nil
+}
+
+func (s *softToken) FindKeyPair(label string) (crypto.Signer, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	signer, ok := s.keyPairs[label]
+	if !ok {
+		return nil, fmt.Errorf("no key pair %s", label)
+	}
+	return signer, nil
+}
+
+func (s *softToken) DestroyKeyPair(label string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.keyPairs, label)
+	return nil
+}
+
+func (s *softToken) Close() error {
+	s.closed = true
+	return nil
+}
+
+func registerSoftToken(t *testing.T) *softToken {
+	token := &softToken{keyPairs: map[string]crypto.Signer{}}
+	RegisterTokenOpener(func(modulePath, tokenLabel, pin string) (Token, error) {
+		if tokenLabel != "istio" || pin != "1234" {
+			return nil, fmt.Errorf("CKR_PIN_INCORRECT")
+		}
+		return token, nil
+	})
+	t.Cleanup(func() {
+		RegisterTokenOpener(nil)
+	})
+	return token
+}
+
+func TestPKCS11Provider(t *testing.T) {
+	token := registerSoftToken(t)
+	pinFile := filepath.Join(t.TempDir(), "pin")
+	if err := ioutil.WriteFile(pinFile, []byte("1234\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	options := &security.Options{
+		KeyProvider:      PKCS11,
+		PKCS11Module:     "/usr/lib/softhsm/libsofthsm2.so",
+		PKCS11TokenLabel: "istio",
+		PKCS11PinFile:    pinFile,
+	}
+	p, err := New(options)
+	if err != nil {
+		t.Fatalf("failed to create the PKCS#11 key provider: %v", err)
+	}
+
+	certOptions := pkiutil.CertOptions{Host: testHost, ECSigAlg: pkiutil.EcdsaSigAlg}
+	key, err := p.GenerateKey(certOptions)
+	if err != nil {
+		t.Fatalf("GenerateKey error: %v", err)
+	}
+	if len(key.PEM) != 0 {
+		t.Errorf("expected the key not to be exported, got %s", key.PEM)
+	}
+	checkCSR(t, certOptions, key.Signer)
+	label := key.PrivateKeyProvider.Config["key_label"]
+	expectedProvider := &security.PrivateKeyProvider{
+		ProviderName: "pkcs11",
+		Config: map[string]string{
+			"module":      "/usr/lib/softhsm/libsofthsm2.so",
+			"token_label": "istio",
+			"key_label":   label,
+			"pin_file":    pinFile,
+		},
+	}
+	if !reflect.DeepEqual(key.PrivateKeyProvider, expectedProvider) {
+		t.Errorf("expected the private key provider %v, got %v", expectedProvider, key.PrivateKeyProvider)
+	}
+
+	// The key written to disk is the URI of the key pair on the token.
+	uri, err := p.ExportKey(&security.SecretItem{PrivateKeyProvider: key.PrivateKeyProvider})
+	if err != nil {
+		t.Fatalf("ExportKey error: %v", err)
+	}
+	if string(uri) != "pkcs11:token=istio;object="+label+";type=private" {
+		t.Errorf("unexpected key URI %s", uri)
+	}
+	loaded, err := p.LoadKey(append(uri, '\n'))
+	if err != nil {
+		t.Fatalf("LoadKey error: %v", err)
+	}
+	if loaded.Signer != key.Signer || !reflect.DeepEqual(loaded.PrivateKeyProvider, expectedProvider) {
+		t.Errorf("expected the key pair %s to be loaded, got %v", label, loaded)
+	}
+	if loaded, err := p.LoadKey([]byte("plain key")); err != nil || string(loaded.PEM) != "plain key" {
+		t.Errorf("expected the plain key to be loaded, got %v %v", loaded, err)
+	}
+	for _, invalid := range []string{
+		"pkcs11:token=other;object=" + label,
+		"pkcs11:token=istio",
+		"pkcs11:object=unknown",
+		"pkcs11:object",
+	} {
+		if _, err := p.LoadKey([]byte(invalid)); err == nil {
+			t.Errorf("expected an error loading %s", invalid)
+		}
+	}
+
+	// Only the key pairs of the current and the previous certificates are kept on the token.
+	for i := 0; i < 3; i++ {
+		if _, err := p.GenerateKey(certOptions); err != nil {
+			t.Fatalf("GenerateKey error: %v", err)
+		}
+	}
+	if len(token.keyPairs) != keepKeyPairs {
+		t.Errorf("expected %d key pairs on the token, got %d", keepKeyPairs, len(token.keyPairs))
+	}
+	if _, err := token.FindKeyPair(label); err == nil {
+		t.Errorf("expected the key pair %s to be destroyed", label)
+	}
+
+	if err := p.Close(); err != nil || !token.closed {
+		t.Errorf("expected the token to be closed, got %v", err)
+	}
+}
+
+func TestPKCS11ProviderWrongPin(t *testing.T) {
+	registerSoftToken(t)
+	if _, err := New(&security.Options{
+		KeyProvider:      PKCS11,
+		PKCS11Module:     "/usr/lib/softhsm/libsofthsm2.so",
+		PKCS11TokenLabel: "istio",
+	}); err == nil {
+		t.Error("expected an error logging in without the PIN")
+	}
+}
+
+func TestParsePKCS11URI(t *testing.T) {
+	attributes, err := parsePKCS11URI("pkcs11:token=my%20token;object=key;type=private?pin-source=file:/pin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{"token": "my token", "object": "key", "type": "private"}
+	if !reflect.DeepEqual(attributes, expected) {
+		t.Errorf("expected %v, got %v", expected, attributes)
+	}
+}
@@ -25,6 +25,7 @@ import (
 	tls "github.com/envoyproxy/go-control-plane/envoy/extensions/transport_sockets/tls/v3"
 	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
 	sds "github.com/envoyproxy/go-control-plane/envoy/service/secret/v3"
+	structpb "github.com/golang/protobuf/ptypes/struct"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -207,36 +208,65 @@ func toEnvoySecret(s *security.SecretItem) *tls.Secret {
 	}
 
 	cfg, ok := model.SdsCertificateConfigFromResourceName(s.ResourceName)
-	if s.ResourceName == security.RootCertReqResourceName || (ok && cfg.IsRootCertificate()) {
-		secret.Type = &tls.Secret_ValidationContext{
-			ValidationContext: &tls.CertificateValidationContext{
-				TrustedCa: &core.DataSource{
-					Specifier: &core.DataSource_InlineBytes{
-						InlineBytes: s.RootCert,
-					},
+	_, namedRoot, _ := security.NamedSecretFromResourceName(s.ResourceName)
+	if s.ResourceName == security.RootCertReqResourceName || (ok && cfg.IsRootCertificate()) || namedRoot {
+		validationContext := &tls.CertificateValidationContext{
+			TrustedCa: &core.DataSource{
+				Specifier: &core.DataSource_InlineBytes{
+					InlineBytes: s.RootCert,
 				},
 			},
 		}
-	} else {
-		secret.Type = &tls.Secret_TlsCertificate{
-			TlsCertificate: &tls.TlsCertificate{
-				CertificateChain: &core.DataSource{
-					Specifier: &core.DataSource_InlineBytes{
-						InlineBytes: s.CertificateChain,
-					},
+		if len(s.CRL) > 0 {
+			// Peers presenting a revoked certificate are rejected.
+			validationContext.Crl = &core.DataSource{
+				Specifier: &core.DataSource_InlineBytes{
+					InlineBytes: s.CRL,
 				},
-				PrivateKey: &core.DataSource{
-					Specifier: &core.DataSource_InlineBytes{
-						InlineBytes: s.PrivateKey,
-					},
+			}
+		}
+		secret.Type = &tls.Secret_ValidationContext{
+			ValidationContext: validationContext,
+		}
+	} else {
+		tlsCertificate := &tls.TlsCertificate{
+			CertificateChain: &core.DataSource{
+				Specifier: &core.DataSource_InlineBytes{
+					InlineBytes: s.CertificateChain,
 				},
 			},
 		}
+		if s.PrivateKeyProvider != nil {
+			// The private key does not leave the key provider, Envoy signs through its private key provider.
+			tlsCertificate.PrivateKeyProvider = toEnvoyPrivateKeyProvider(s.PrivateKeyProvider)
+		} else {
+			tlsCertificate.PrivateKey = &core.DataSource{
+				Specifier: &core.DataSource_InlineBytes{
+					InlineBytes: s.PrivateKey,
+				},
+			}
+		}
+		secret.Type = &tls.Secret_TlsCertificate{
+			TlsCertificate: tlsCertificate,
+		}
 	}
 
 	return secret
 }
 
+func toEnvoyPrivateKeyProvider(p *security.PrivateKeyProvider) *tls.PrivateKeyProvider {
+	fields := make(map[string]*structpb.Value, len(p.Config))
+	for k, v := range p.Config {
+		fields[k] = &structpb.Value{Kind: &structpb.Value_StringValue{StringValue: v}}
+	}
+	return &tls.PrivateKeyProvider{
+		ProviderName: p.ProviderName,
+		ConfigType: &tls.PrivateKeyProvider_TypedConfig{
+			TypedConfig: util.MessageToAny(&structpb.Struct{Fields: fields}),
+		},
+	}
+}
+
 func pushLog(names []string, err error) {
 	if err != nil {
 		return
@@ -20,6 +20,8 @@ import (
 	"testing"
 
 	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	"github.com/golang/protobuf/ptypes"
+	structpb "github.com/golang/protobuf/ptypes/struct"
 	"github.com/google/go-cmp/cmp"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
@@ -78,6 +80,7 @@ type Expectation struct {
 	CertChain    []byte
 	Key          []byte
 	RootCert     []byte
+	CRL          []byte
 }
 
 func (s *TestServer) Verify(resp *discovery.DiscoveryResponse, expectations ...Expectation) *discovery.DiscoveryResponse {
@@ -93,6 +96,7 @@ func (s *TestServer) Verify(resp *discovery.DiscoveryResponse, expectations ...E
 			Key:          scrt.GetTlsCertificate().GetPrivateKey().GetInlineBytes(),
 			CertChain:    scrt.GetTlsCertificate().GetCertificateChain().GetInlineBytes(),
 			RootCert:     scrt.GetValidationContext().GetTrustedCa().GetInlineBytes(),
+			CRL:          scrt.GetValidationContext().GetCrl().GetInlineBytes(),
 		}
 		if diff := cmp.Diff(e, r); diff != "" {
 			s.t.Fatalf("got diff: %v", diff)
@@ -287,6 +291,23 @@ func TestSDS(t *testing.T) {
 		})
 		c.ExpectNoResponse()
 	})
+	t.Run("push root with crl", func(t *testing.T) {
+		s := setupSDS(t)
+		root := s.Connect()
+		s.Verify(root.RequestResponseAck(&discovery.DiscoveryRequest{ResourceNames: []string{rootResourceName}}), expectRoot)
+
+		crl := []byte{05}
+		s.UpdateSecret(rootResourceName, &ca2.SecretItem{
+			RootCert:     fakeRootCert,
+			CRL:          crl,
+			ResourceName: rootResourceName,
+		})
+		s.Verify(root.ExpectResponse(), Expectation{
+			ResourceName: rootResourceName,
+			RootCert:     fakeRootCert,
+			CRL:          crl,
+		})
+	})
 	t.Run("nack", func(t *testing.T) {
 		s := setupSDS(t)
 		c := s.Connect()
@@ -310,3 +331,29 @@ func setupConnection(socket string) (*grpc.ClientConn, error) {
 
 	return conn, nil
 }
+
+func TestToEnvoySecretPrivateKeyProvider(t *testing.T) {
+	secret := toEnvoySecret(&ca2.SecretItem{
+		CertificateChain: fakeCertificateChain,
+		ResourceName:     testResourceName,
+		PrivateKeyProvider: &ca2.PrivateKeyProvider{
+			ProviderName: "pkcs11",
+			Config:       map[string]string{"key_label": "istio-workload-1"},
+		},
+	})
+	cert := secret.GetTlsCertificate()
+	if cert.GetPrivateKey() != nil {
+		t.Errorf("expected no inline private key, got %v", cert.GetPrivateKey())
+	}
+	provider := cert.GetPrivateKeyProvider()
+	if provider.GetProviderName() != "pkcs11" {
+		t.Fatalf("expected the pkcs11 private key provider, got %v", provider)
+	}
+	config := &structpb.Struct{}
+	if err := ptypes.UnmarshalAny(provider.GetTypedConfig(), config); err != nil {
+		t.Fatal(err)
+	}
+	if got := config.Fields["key_label"].GetStringValue(); got != "istio-workload-1" {
+		t.Errorf("expected the key label istio-workload-1, got %q", got)
+	}
+}
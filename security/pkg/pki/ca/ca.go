@@ -16,6 +16,9 @@ package ca
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/x509"
 	"encoding/pem"
 	"fmt"
@@ -86,6 +89,12 @@ type IstioCAOptions struct {
 
 	// Config for creating self-signed root cert rotator.
 	RotatorConfig *SelfSignedCARootCertRotatorConfig
+
+	// Config for creating the plugged-in cert rotator. It is nil if the CA does not use plugged-in certs.
+	PluggedCertRotatorConfig *PluggedCertRotatorConfig
+
+	// CRLValidity is the time the CRLs signed by the CA are valid for. It defaults to DefaultCRLValidity.
+	CRLValidity time.Duration
 }
 
 // NewSelfSignedIstioCAOptions returns a new IstioCAOptions instance using self-signed certificate.
@@ -93,7 +102,11 @@ func NewSelfSignedIstioCAOptions(ctx context.Context,
 	rootCertGracePeriodPercentile int, caCertTTL, rootCertCheckInverval, defaultCertTTL,
 	maxCertTTL time.Duration, org string, dualUse bool, namespace string,
 	readCertRetryInterval time.Duration, client corev1.CoreV1Interface,
-	rootCertFile string, enableJitter bool, caRSAKeySize int) (caOpts *IstioCAOptions, err error) {
+	rootCertFile string, enableJitter bool, caRSAKeySize int,
+	caKeyAlg util.SupportedECSignatureAlgorithms) (caOpts *IstioCAOptions, err error) {
+	if err := util.ValidateSigAlg(caKeyAlg); err != nil {
+		return nil, fmt.Errorf("invalid key algorithm for self-signed CA: %v", err)
+	}
 	// For the first time the CA is up, if readSigningCertOnly is unset,
 	// it generates a self-signed key/cert pair and write it to CASecret.
 	// For subsequent restart, CA will reads key/cert from CASecret.
@@ -142,6 +155,7 @@ func NewSelfSignedIstioCAOptions(ctx context.Context,
 			IsCA:         true,
 			IsSelfSigned: true,
 			RSAKeySize:   caRSAKeySize,
+			ECSigAlg:     caKeyAlg,
 			IsDualUse:    dualUse,
 		}
 		pemCert, pemKey, ckErr := util.GenCertKeyFromOptions(options)
@@ -228,19 +242,33 @@ func NewPluggedCertIstioCAOptions(certChainFile, signingCertFile, signingKeyFile
 	if err != nil {
 		return nil, err
 	}
-	block, _ := pem.Decode(b)
+	if err := checkSigningCert(b); err != nil {
+		return nil, err
+	}
+
+	caOpts.PluggedCertRotatorConfig = &PluggedCertRotatorConfig{
+		certChainFile:   certChainFile,
+		signingCertFile: signingCertFile,
+		signingKeyFile:  signingKeyFile,
+		rootCertFile:    rootCertFile,
+	}
+	return caOpts, nil
+}
+
+// checkSigningCert returns an error if the PEM encoded certificate cannot sign other certificates.
+func checkSigningCert(certPEM []byte) error {
+	block, _ := pem.Decode(certPEM)
 	if block == nil {
-		return nil, fmt.Errorf("invalid PEM encoded certificate")
+		return fmt.Errorf("invalid PEM encoded certificate")
 	}
 	cert, err := x509.ParseCertificate(block.Bytes)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse X.509 certificate")
+		return fmt.Errorf("failed to parse X.509 certificate")
 	}
 	if !cert.IsCA {
-		return nil, fmt.Errorf("certificate is not authorized to sign other certificates")
+		return fmt.Errorf("certificate is not authorized to sign other certificates")
 	}
-
-	return caOpts, nil
+	return nil
 }
 
 // IstioCA generates keys and certificates for Istio identities.
@@ -256,20 +284,32 @@ type IstioCA struct {
 	// rootCertRotator periodically rotates self-signed root cert for CA. It is nil
 	// if CA is not self-signed CA.
 	rootCertRotator *SelfSignedCARootCertRotator
+
+	// pluggedCertRotator watches the plugged-in certs of the CA. It is nil if the CA does not use
+	// plugged-in certs, or their rotation is disabled.
+	pluggedCertRotator *PluggedCertRotator
+
+	// revocationList holds the certificates revoked by the CA.
+	revocationList *revocationList
 }
 
 // NewIstioCA returns a new IstioCA instance.
 func NewIstioCA(opts *IstioCAOptions) (*IstioCA, error) {
 	ca := &IstioCA{
-		maxCertTTL:    opts.MaxCertTTL,
-		keyCertBundle: opts.KeyCertBundle,
-		livenessProbe: probe.NewProbe(),
-		caRSAKeySize:  opts.CARSAKeySize,
+		maxCertTTL:     opts.MaxCertTTL,
+		keyCertBundle:  opts.KeyCertBundle,
+		livenessProbe:  probe.NewProbe(),
+		caRSAKeySize:   opts.CARSAKeySize,
+		revocationList: newRevocationList(opts.CRLValidity),
 	}
 
 	if opts.CAType == selfSignedCA && opts.RotatorConfig.CheckInterval > time.Duration(0) {
 		ca.rootCertRotator = NewSelfSignedCARootCertRotator(opts.RotatorConfig, ca)
 	}
+	if opts.CAType == pluggedCertCA && opts.PluggedCertRotatorConfig != nil &&
+		opts.PluggedCertRotatorConfig.CheckInterval > time.Duration(0) {
+		ca.pluggedCertRotator = NewPluggedCertRotator(opts.PluggedCertRotatorConfig, ca)
+	}
 
 	// if CA cert becomes invalid before workload cert it's going to cause workload cert to be invalid too,
 	// however citatel won't rotate if that happens, this function will prevent that using cert chain TTL as
@@ -288,6 +328,28 @@ func (ca *IstioCA) Run(stopChan chan struct{}) {
 		// Start root cert rotator in a separate goroutine.
 		go ca.rootCertRotator.Run(stopChan)
 	}
+	if ca.pluggedCertRotator != nil {
+		// Start plugged-in cert rotator in a separate goroutine.
+		go ca.pluggedCertRotator.Run(stopChan)
+	}
+}
+
+// SetPluggedRootCertsHandler sets the handler called with the trusted roots when the rotation of the plugged-in
+// certs changes them, both when the new roots are added and when the previous roots are removed. It must be set
+// before Run.
+func (ca *IstioCA) SetPluggedRootCertsHandler(handler func(rootCerts []byte)) {
+	if ca.pluggedCertRotator != nil {
+		ca.pluggedCertRotator.rootCertsHandler = handler
+	}
+}
+
+// PluggedCertRotationStatus returns the state of the rotation of the plugged-in certs, or nil if they
+// are not rotated.
+func (ca *IstioCA) PluggedCertRotationStatus() *PluggedCertRotationStatus {
+	if ca.pluggedCertRotator == nil {
+		return nil
+	}
+	return ca.pluggedCertRotator.Status()
 }
 
 // Sign takes a PEM-encoded CSR, subject IDs and lifetime, and returns a signed certificate. If forCA is true,
@@ -319,8 +381,14 @@ func (ca *IstioCA) GenKeyCert(hostnames []string, certTTL time.Duration, checkLi
 	// use the type of private key the CA uses to generate an intermediate CA of that type (e.g. CA cert using RSA will
 	// cause intermediate CAs using RSA to be generated)
 	_, signingKey, _, _ := ca.keyCertBundle.GetAll()
-	if util.IsSupportedECPrivateKey(signingKey) {
+	switch k := (*signingKey).(type) {
+	case *ecdsa.PrivateKey:
 		opts.ECSigAlg = util.EcdsaSigAlg
+		if k.Curve == elliptic.P384() {
+			opts.ECSigAlg = util.EcdsaP384SigAlg
+		}
+	case ed25519.PrivateKey:
+		opts.ECSigAlg = util.Ed25519SigAlg
 	}
 
 	csrPEM, privPEM, err := util.GenCSR(opts)
@@ -368,6 +436,9 @@ func (ca *IstioCA) sign(csrPEM []byte, subjectIDs []string, requestedLifetime ti
 	if err != nil {
 		return nil, caerror.NewError(caerror.CSRError, err)
 	}
+	if err := util.CheckPublicKey(csr.PublicKey); err != nil {
+		return nil, caerror.NewError(caerror.CSRError, err)
+	}
 
 	lifetime := requestedLifetime
 	// If the requested requestedLifetime is non-positive, apply the default TTL.
@@ -384,6 +455,7 @@ func (ca *IstioCA) sign(csrPEM []byte, subjectIDs []string, requestedLifetime ti
 	if err != nil {
 		return nil, caerror.NewError(caerror.CertGenError, err)
 	}
+	ca.revocationList.recordIssued(certBytes, subjectIDs)
 
 	block := &pem.Block{
 		Type:  "CERTIFICATE",
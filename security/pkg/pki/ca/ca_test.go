@@ -17,8 +17,12 @@ package ca
 import (
 	"bytes"
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/pem"
 	"io/ioutil"
 	"reflect"
 	"testing"
@@ -100,7 +104,7 @@ func TestCreateSelfSignedIstioCAWithoutSecret(t *testing.T) {
 	caopts, err := NewSelfSignedIstioCAOptions(context.Background(),
 		0, caCertTTL, rootCertCheckInverval, defaultCertTTL,
 		maxCertTTL, org, false, caNamespace, -1, client.CoreV1(),
-		rootCertFile, false, rsaKeySize)
+		rootCertFile, false, rsaKeySize, "")
 	if err != nil {
 		t.Fatalf("Failed to create a self-signed CA Options: %v", err)
 	}
@@ -151,6 +155,73 @@ func TestCreateSelfSignedIstioCAWithoutSecret(t *testing.T) {
 	}
 }
 
+func TestCreateSelfSignedIstioCAKeyAlgorithms(t *testing.T) {
+	cases := map[util.SupportedECSignatureAlgorithms]x509.PublicKeyAlgorithm{
+		util.EcdsaP384SigAlg: x509.ECDSA,
+		util.Ed25519SigAlg:   x509.Ed25519,
+		util.RsaPssSigAlg:    x509.RSA,
+	}
+	for alg, pubAlg := range cases {
+		client := fake.NewSimpleClientset()
+		caopts, err := NewSelfSignedIstioCAOptions(context.Background(),
+			0, time.Hour, time.Hour, 30*time.Minute, time.Hour, "test.ca.Org", false, "default", -1, client.CoreV1(),
+			"", false, 2048, alg)
+		if err != nil {
+			t.Fatalf("%s: failed to create a self-signed CA Options: %v", alg, err)
+		}
+		ca, err := NewIstioCA(caopts)
+		if err != nil {
+			t.Fatalf("%s: failed to create a self-signed CA: %v", alg, err)
+		}
+		signingCert, _, _, _ := ca.GetCAKeyCertBundle().GetAll()
+		if signingCert.PublicKeyAlgorithm != pubAlg {
+			t.Errorf("%s: unexpected CA key algorithm %v", alg, signingCert.PublicKeyAlgorithm)
+		}
+
+		// The intermediate CA keys generated by the CA have the same type.
+		certPEM, _, err := ca.GenKeyCert([]string{"host1"}, time.Hour, false)
+		if err != nil {
+			t.Fatalf("%s: GenKeyCert error: %v", alg, err)
+		}
+		cert, err := util.ParsePemEncodedCertificate(certPEM)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cert.PublicKeyAlgorithm != pubAlg {
+			t.Errorf("%s: unexpected key algorithm %v", alg, cert.PublicKeyAlgorithm)
+		}
+		if alg == util.RsaPssSigAlg && cert.SignatureAlgorithm != x509.SHA256WithRSAPSS {
+			t.Errorf("%s: expected an RSA-PSS signature, got %v", alg, cert.SignatureAlgorithm)
+		}
+	}
+
+	if _, err := NewSelfSignedIstioCAOptions(context.Background(),
+		0, time.Hour, time.Hour, 30*time.Minute, time.Hour, "test.ca.Org", false, "default", -1,
+		fake.NewSimpleClientset().CoreV1(), "", false, 2048, "DSA"); err == nil {
+		t.Error("expected an error for an unsupported key algorithm")
+	}
+}
+
+func TestSignCSRUnsupportedKey(t *testing.T) {
+	ca, err := createCA(time.Hour, "")
+	if err != nil {
+		t.Fatalf("Failed to create a plugged-cert CA: %v", err)
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csrDER, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csrPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csrDER})
+	_, err = ca.Sign(csrPEM, []string{"spiffe://cluster.local/ns/foo/sa/bar"}, time.Hour, false)
+	if err == nil || err.(*caerror.Error).ErrorType() != "CSR_ERROR" {
+		t.Errorf("expected a CSR error for a P521 key, got %v", err)
+	}
+}
+
 func TestCreateSelfSignedIstioCAWithSecret(t *testing.T) {
 	rootCertPem := cert1Pem
 	// Use the same signing cert and root cert for self-signed CA.
@@ -177,7 +248,7 @@ func TestCreateSelfSignedIstioCAWithSecret(t *testing.T) {
 	caopts, err := NewSelfSignedIstioCAOptions(context.Background(),
 		0, caCertTTL, rootCertCheckInverval, defaultCertTTL, maxCertTTL,
 		org, false, caNamespace, -1, client.CoreV1(),
-		rootCertFile, false, rsaKeySize)
+		rootCertFile, false, rsaKeySize, "")
 	if err != nil {
 		t.Fatalf("Failed to create a self-signed CA Options: %v", err)
 	}
@@ -233,7 +304,7 @@ func TestCreateSelfSignedIstioCAReadSigningCertOnly(t *testing.T) {
 	defer cancel0()
 	_, err := NewSelfSignedIstioCAOptions(ctx0, 0,
 		caCertTTL, defaultCertTTL, rootCertCheckInverval, maxCertTTL, org, false,
-		caNamespace, time.Millisecond*10, client.CoreV1(), rootCertFile, false, rsaKeySize)
+		caNamespace, time.Millisecond*10, client.CoreV1(), rootCertFile, false, rsaKeySize, "")
 	if err == nil {
 		t.Errorf("Expected error, but succeeded.")
 	} else if err.Error() != expectedErr {
@@ -252,7 +323,7 @@ func TestCreateSelfSignedIstioCAReadSigningCertOnly(t *testing.T) {
 	defer cancel1()
 	caopts, err := NewSelfSignedIstioCAOptions(ctx1, 0,
 		caCertTTL, defaultCertTTL, rootCertCheckInverval, maxCertTTL, org, false,
-		caNamespace, time.Millisecond*10, client.CoreV1(), rootCertFile, false, rsaKeySize)
+		caNamespace, time.Millisecond*10, client.CoreV1(), rootCertFile, false, rsaKeySize, "")
 	if err != nil {
 		t.Errorf("Unexpected error: %v", err)
 	}
@@ -453,7 +524,7 @@ func TestSignCSRForCA(t *testing.T) {
 		}
 
 		fields := &util.VerifyFields{
-			KeyUsage: x509.KeyUsageCertSign,
+			KeyUsage: x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
 			IsCA:     true,
 			Host:     subjectID,
 		}
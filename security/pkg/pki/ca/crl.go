@@ -0,0 +1,268 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ca
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// CRLID is the name of the file holding the certificate revocation list of the CA.
+	CRLID = "ca-crl.pem"
+
+	// DefaultCRLValidity is the default time a CRL is valid for. The CRL is signed again after half of it.
+	DefaultCRLValidity = 7 * 24 * time.Hour
+)
+
+// RevokedCert is a certificate revoked by the CA.
+type RevokedCert struct {
+	// SerialNumber is the hex encoded serial number of the certificate.
+	SerialNumber   string    `json:"serialNumber"`
+	RevocationTime time.Time `json:"revocationTime"`
+}
+
+type issuedCert struct {
+	serial   *big.Int
+	notAfter time.Time
+}
+
+// revocationList holds the certificates revoked by the CA, and the CRL listing them.
+type revocationList struct {
+	mu       sync.Mutex
+	validity time.Duration
+	// issued holds the unexpired certificates issued by this CA, by subject ID, so they can be
+	// revoked by identity.
+	issued map[string][]issuedCert
+	// revoked holds the revoked certificates, by hex encoded serial number.
+	revoked map[string]pkix.RevokedCertificate
+	number  int64
+	crlPEM  []byte
+	// signedBy is the certificate that signed crlPEM.
+	signedBy *x509.Certificate
+	// refreshAt is the time the CRL is signed again, even if nothing was revoked.
+	refreshAt time.Time
+}
+
+func newRevocationList(validity time.Duration) *revocationList {
+	if validity <= 0 {
+		validity = DefaultCRLValidity
+	}
+	return &revocationList{
+		validity: validity,
+		issued:   map[string][]issuedCert{},
+		revoked:  map[string]pkix.RevokedCertificate{},
+	}
+}
+
+// recordIssued remembers a signed certificate, so it can be revoked by subject ID.
+func (r *revocationList) recordIssued(certDER []byte, subjectIDs []string) {
+	cert, err := x509.ParseCertificate(certDER)
+	if err != nil {
+		return
+	}
+	now := time.Now()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, id := range subjectIDs {
+		certs := r.issued[id][:0]
+		for _, c := range r.issued[id] {
+			if c.notAfter.After(now) {
+				certs = append(certs, c)
+			}
+		}
+		r.issued[id] = append(certs, issuedCert{serial: cert.SerialNumber, notAfter: cert.NotAfter})
+	}
+}
+
+// revokeLocked adds the serial numbers to the revoked certificates, and returns whether any was added.
+func (r *revocationList) revokeLocked(serials []*big.Int, at time.Time) bool {
+	changed := false
+	for _, s := range serials {
+		key := s.Text(16)
+		if _, f := r.revoked[key]; f {
+			continue
+		}
+		r.revoked[key] = pkix.RevokedCertificate{SerialNumber: s, RevocationTime: at}
+		changed = true
+	}
+	if changed {
+		// Sign the CRL again on next use
+		r.crlPEM = nil
+	}
+	return changed
+}
+
+// pruneLocked forgets the certificates that have expired, as they are rejected regardless of the CRL.
+func (r *revocationList) pruneLocked(now time.Time) {
+	for id, certs := range r.issued {
+		kept := certs[:0]
+		for _, c := range certs {
+			if c.notAfter.After(now) {
+				kept = append(kept, c)
+			}
+		}
+		if len(kept) == 0 {
+			delete(r.issued, id)
+		} else {
+			r.issued[id] = kept
+		}
+	}
+}
+
+// Revoke revokes the certificates with the given serial numbers, and signs a new CRL.
+func (ca *IstioCA) Revoke(serials ...*big.Int) error {
+	r := ca.revocationList
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.revokeLocked(serials, time.Now()) {
+		return nil
+	}
+	pkiCaLog.Infof("revoked certificates %v", serials)
+	return ca.signCRLLocked()
+}
+
+// RevokeIdentity revokes all unexpired certificates this CA issued to the subject ID, such as a SPIFFE ID,
+// and returns their serial numbers. Only certificates issued since the CA started are known.
+func (ca *IstioCA) RevokeIdentity(subjectID string) ([]*big.Int, error) {
+	r := ca.revocationList
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pruneLocked(time.Now())
+	serials := make([]*big.Int, 0, len(r.issued[subjectID]))
+	for _, c := range r.issued[subjectID] {
+		serials = append(serials, c.serial)
+	}
+	if !r.revokeLocked(serials, time.Now()) {
+		return serials, nil
+	}
+	pkiCaLog.Infof("revoked certificates %v of %s", serials, subjectID)
+	return serials, ca.signCRLLocked()
+}
+
+// MergeCRL adds the certificates revoked by a PEM encoded CRL, such as the CRL persisted by another
+// replica of the CA, and returns whether any certificate was added.
+func (ca *IstioCA) MergeCRL(crlPEM []byte) (bool, error) {
+	var revoked []pkix.RevokedCertificate
+	for rest := crlPEM; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		crl, err := x509.ParseCRL(block.Bytes)
+		if err != nil {
+			return false, fmt.Errorf("failed to parse CRL: %v", err)
+		}
+		revoked = append(revoked, crl.TBSCertList.RevokedCertificates...)
+	}
+
+	r := ca.revocationList
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	changed := false
+	for _, rc := range revoked {
+		changed = r.revokeLocked([]*big.Int{rc.SerialNumber}, rc.RevocationTime) || changed
+	}
+	if !changed {
+		return false, nil
+	}
+	return true, ca.signCRLLocked()
+}
+
+// GetCRLPem returns the PEM encoded CRL signed by the CA. The CRL is signed again when half of its
+// validity has elapsed, or when the signing certificate changed.
+func (ca *IstioCA) GetCRLPem() ([]byte, error) {
+	r := ca.revocationList
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	signingCert, _, _, _ := ca.keyCertBundle.GetAll()
+	if r.crlPEM == nil || !time.Now().Before(r.refreshAt) || signingCert == nil || !signingCert.Equal(r.signedBy) {
+		if err := ca.signCRLLocked(); err != nil {
+			return nil, err
+		}
+	}
+	return r.crlPEM, nil
+}
+
+// RevokedCerts returns the certificates revoked by the CA, ordered by revocation time.
+func (ca *IstioCA) RevokedCerts() []RevokedCert {
+	r := ca.revocationList
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([]RevokedCert, 0, len(r.revoked))
+	for key, rc := range r.revoked {
+		out = append(out, RevokedCert{SerialNumber: key, RevocationTime: rc.RevocationTime})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].RevocationTime.Equal(out[j].RevocationTime) {
+			return out[i].RevocationTime.Before(out[j].RevocationTime)
+		}
+		return out[i].SerialNumber < out[j].SerialNumber
+	})
+	return out
+}
+
+// signCRLLocked signs a new CRL with the signing key of the CA. The revocationList lock must be held.
+func (ca *IstioCA) signCRLLocked() error {
+	r := ca.revocationList
+	signingCert, signingKey, _, _ := ca.keyCertBundle.GetAll()
+	if signingCert == nil || signingKey == nil {
+		return fmt.Errorf("Istio CA is not ready") // nolint
+	}
+	if signingCert.KeyUsage&x509.KeyUsageCRLSign == 0 {
+		return fmt.Errorf("the CA certificate is not allowed to sign CRLs, as it does not have the cRLSign key usage")
+	}
+	signer, ok := (*signingKey).(crypto.Signer)
+	if !ok {
+		return fmt.Errorf("the CA key of type %T cannot sign CRLs", *signingKey)
+	}
+
+	now := time.Now()
+	revoked := make([]pkix.RevokedCertificate, 0, len(r.revoked))
+	for key, rc := range r.revoked {
+		// Certificates revoked before the max TTL have expired, and no longer need to be listed.
+		if ca.maxCertTTL > 0 && rc.RevocationTime.Add(ca.maxCertTTL).Before(now) {
+			delete(r.revoked, key)
+			continue
+		}
+		revoked = append(revoked, rc)
+	}
+	sort.Slice(revoked, func(i, j int) bool {
+		return revoked[i].SerialNumber.Cmp(revoked[j].SerialNumber) < 0
+	})
+	r.number++
+	der, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:              big.NewInt(r.number),
+		ThisUpdate:          now,
+		NextUpdate:          now.Add(r.validity),
+		RevokedCertificates: revoked,
+	}, signingCert, signer)
+	if err != nil {
+		return fmt.Errorf("failed to sign CRL: %v", err)
+	}
+	r.crlPEM = pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: der})
+	r.signedBy = signingCert
+	r.refreshAt = now.Add(r.validity / 2)
+	return nil
+}
@@ -0,0 +1,166 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ca
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"istio.io/istio/security/pkg/pki/util"
+)
+
+func parseCRL(t *testing.T, ca *IstioCA) *pkix.CertificateList {
+	t.Helper()
+	crlPEM, err := ca.GetCRLPem()
+	if err != nil {
+		t.Fatalf("GetCRLPem error: %v", err)
+	}
+	block, _ := pem.Decode(crlPEM)
+	if block == nil || block.Type != "X509 CRL" {
+		t.Fatalf("invalid CRL PEM %s", crlPEM)
+	}
+	crl, err := x509.ParseCRL(block.Bytes)
+	if err != nil {
+		t.Fatalf("ParseCRL error: %v", err)
+	}
+	signingCert, _, _, _ := ca.GetCAKeyCertBundle().GetAll()
+	if err := signingCert.CheckCRLSignature(crl); err != nil {
+		t.Fatalf("CRL is not signed by the CA: %v", err)
+	}
+	return crl
+}
+
+func revokedSerialNumbers(crl *pkix.CertificateList) []string {
+	serials := []string{}
+	for _, rc := range crl.TBSCertList.RevokedCertificates {
+		serials = append(serials, rc.SerialNumber.Text(16))
+	}
+	return serials
+}
+
+func signWorkload(t *testing.T, ca *IstioCA, subjectID string) *x509.Certificate {
+	t.Helper()
+	csrPEM, _, err := util.GenCSR(util.CertOptions{Host: subjectID, RSAKeySize: 2048})
+	if err != nil {
+		t.Fatalf("GenCSR error: %v", err)
+	}
+	certPEM, err := ca.Sign(csrPEM, []string{subjectID}, time.Hour, false)
+	if err != nil {
+		t.Fatalf("Sign error: %v", err)
+	}
+	cert, err := util.ParsePemEncodedCertificate(certPEM)
+	if err != nil {
+		t.Fatalf("ParsePemEncodedCertificate error: %v", err)
+	}
+	return cert
+}
+
+func TestRevoke(t *testing.T) {
+	ca, err := createCA(24*time.Hour, "")
+	if err != nil {
+		t.Fatalf("createCA error: %v", err)
+	}
+	if crl := parseCRL(t, ca); len(crl.TBSCertList.RevokedCertificates) != 0 {
+		t.Fatalf("expected an empty CRL, got %v", revokedSerialNumbers(crl))
+	}
+
+	foo := "spiffe://cluster.local/ns/foo/sa/foo"
+	bar := "spiffe://cluster.local/ns/bar/sa/bar"
+	foo1, foo2, barCert := signWorkload(t, ca, foo), signWorkload(t, ca, foo), signWorkload(t, ca, bar)
+
+	if err := ca.Revoke(barCert.SerialNumber); err != nil {
+		t.Fatalf("Revoke error: %v", err)
+	}
+	crl := parseCRL(t, ca)
+	if got, want := revokedSerialNumbers(crl), []string{barCert.SerialNumber.Text(16)}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected revoked %v, got %v", want, got)
+	}
+	if crl.TBSCertList.NextUpdate.Sub(crl.TBSCertList.ThisUpdate) != DefaultCRLValidity {
+		t.Fatalf("unexpected CRL validity %v", crl.TBSCertList.NextUpdate.Sub(crl.TBSCertList.ThisUpdate))
+	}
+
+	serials, err := ca.RevokeIdentity(foo)
+	if err != nil {
+		t.Fatalf("RevokeIdentity error: %v", err)
+	}
+	if want := []*big.Int{foo1.SerialNumber, foo2.SerialNumber}; !reflect.DeepEqual(serials, want) {
+		t.Fatalf("expected %v to be revoked, got %v", want, serials)
+	}
+	if got := revokedSerialNumbers(parseCRL(t, ca)); len(got) != 3 {
+		t.Fatalf("expected 3 revoked certificates, got %v", got)
+	}
+	if got := ca.RevokedCerts(); len(got) != 3 || got[0].SerialNumber != barCert.SerialNumber.Text(16) {
+		t.Fatalf("expected revoked certificates ordered by revocation time, got %v", got)
+	}
+
+	// Revoking again does not change the CRL
+	before, _ := ca.GetCRLPem()
+	if serials, err := ca.RevokeIdentity(foo); err != nil || len(serials) != 2 {
+		t.Fatalf("RevokeIdentity again: %v %v", serials, err)
+	}
+	if after, _ := ca.GetCRLPem(); string(before) != string(after) {
+		t.Fatal("expected the CRL to be unchanged")
+	}
+	if serials, err := ca.RevokeIdentity("spiffe://cluster.local/ns/unknown/sa/unknown"); err != nil || len(serials) != 0 {
+		t.Fatalf("expected nothing to be revoked for an unknown identity, got %v %v", serials, err)
+	}
+}
+
+func TestMergeCRL(t *testing.T) {
+	ca1, err := createCA(24*time.Hour, "")
+	if err != nil {
+		t.Fatalf("createCA error: %v", err)
+	}
+	ca2, err := createCA(24*time.Hour, "")
+	if err != nil {
+		t.Fatalf("createCA error: %v", err)
+	}
+	if err := ca1.Revoke(big.NewInt(10), big.NewInt(11)); err != nil {
+		t.Fatalf("Revoke error: %v", err)
+	}
+	crl1, _ := ca1.GetCRLPem()
+	changed, err := ca2.MergeCRL(crl1)
+	if err != nil || !changed {
+		t.Fatalf("expected the CRL to be merged, got %v %v", changed, err)
+	}
+	if got, want := revokedSerialNumbers(parseCRL(t, ca2)), []string{"a", "b"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected revoked %v, got %v", want, got)
+	}
+	if changed, err := ca2.MergeCRL(crl1); err != nil || changed {
+		t.Fatalf("expected merging again to be a no-op, got %v %v", changed, err)
+	}
+	if _, err := ca2.MergeCRL([]byte("-----BEGIN X509 CRL-----\nZm9v\n-----END X509 CRL-----\n")); err == nil {
+		t.Fatal("expected an error for an invalid CRL")
+	}
+}
+
+func TestCRLRequiresCRLSign(t *testing.T) {
+	ca, err := createCA(24*time.Hour, "")
+	if err != nil {
+		t.Fatalf("createCA error: %v", err)
+	}
+	// Older CA certificates are only allowed to sign certificates.
+	signingCert, _, _, _ := ca.GetCAKeyCertBundle().GetAll()
+	signingCert.KeyUsage &^= x509.KeyUsageCRLSign
+	if _, err := ca.GetCRLPem(); err == nil || !strings.Contains(err.Error(), "cRLSign") {
+		t.Fatalf("expected an error about the missing key usage, got %v", err)
+	}
+}
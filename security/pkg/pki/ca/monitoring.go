@@ -0,0 +1,53 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ca
+
+import (
+	"istio.io/pkg/monitoring"
+)
+
+var (
+	phaseTag = monitoring.MustCreateLabel("phase")
+
+	pluggedCertRotationPhase = monitoring.NewGauge(
+		"citadel_plugged_cert_rotation_phase",
+		"Whether the rotation of the plugged-in CA certs is in the phase: Stable, Propagating or Overlap.",
+		monitoring.WithLabels(phaseTag),
+	)
+
+	pluggedCertRotationCounts = monitoring.NewSum(
+		"citadel_plugged_cert_rotation_count",
+		"The number of times the CA started signing with new plugged-in certs.",
+	)
+
+	pluggedCertRotationErrorCounts = monitoring.NewSum(
+		"citadel_plugged_cert_rotation_err_count",
+		"The number of errors occurred when reading or using new plugged-in certs.",
+	)
+
+	pluggedCertTrustedRoots = monitoring.NewGauge(
+		"citadel_plugged_cert_trusted_roots",
+		"The number of root certs trusted by the CA, which includes the previous roots during a rotation.",
+	)
+)
+
+func init() {
+	monitoring.MustRegister(
+		pluggedCertRotationPhase,
+		pluggedCertRotationCounts,
+		pluggedCertRotationErrorCounts,
+		pluggedCertTrustedRoots,
+	)
+}
@@ -0,0 +1,403 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ca
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"istio.io/istio/security/pkg/pki/util"
+	"istio.io/pkg/filewatcher"
+	"istio.io/pkg/log"
+)
+
+var pluggedCertRotatorLog = log.RegisterScope("pluggedcertrotator", "Plugged-in CA cert rotator log", 0)
+
+// RotationPhase is the phase of the rotation of the plugged-in CA certificates.
+type RotationPhase string
+
+const (
+	// RotationStable means the CA signs with the plugged-in certificate, and only its roots are trusted.
+	RotationStable RotationPhase = "Stable"
+	// RotationPropagating means the roots of new plugged-in certificates are trusted, while the CA still signs
+	// with the previous certificate until the new roots are distributed to the workloads.
+	RotationPropagating RotationPhase = "Propagating"
+	// RotationOverlap means the CA signs with the new plugged-in certificate, while the previous roots are
+	// still trusted until the workload certificates they verify are rotated.
+	RotationOverlap RotationPhase = "Overlap"
+
+	// pluggedCertDebounceDelay is the delay before reading the plugged-in certificates after a file event,
+	// since the files of a Secret are not all updated at once.
+	pluggedCertDebounceDelay = 100 * time.Millisecond
+)
+
+// PluggedCertRotatorConfig is the configuration of the rotation of the plugged-in CA certificates.
+type PluggedCertRotatorConfig struct {
+	certChainFile   string
+	signingCertFile string
+	signingKeyFile  string
+	rootCertFile    string
+
+	// CheckInterval is the interval the plugged-in certificates are read at, in addition to the file events.
+	// Setting it to zero or a negative value disables the rotation.
+	CheckInterval time.Duration
+	// RootCertPropagation is the time new roots are trusted before the CA signs with the new certificate.
+	RootCertPropagation time.Duration
+	// RootCertOverlap is the time the previous roots are trusted after the CA signs with the new certificate.
+	RootCertOverlap time.Duration
+}
+
+// PluggedCertRotationStatus is the state of the rotation of the plugged-in CA certificates.
+type PluggedCertRotationStatus struct {
+	Phase RotationPhase `json:"phase"`
+	// PhaseEnd is the time the Propagating or Overlap phase ends.
+	PhaseEnd     *time.Time    `json:"phaseEnd,omitempty"`
+	SigningCert  *CertSummary  `json:"signingCert,omitempty"`
+	TrustedRoots []CertSummary `json:"trustedRoots"`
+	// LastRotation is the time the CA last started signing with new plugged-in certificates.
+	LastRotation *time.Time `json:"lastRotation,omitempty"`
+	// LastError is the error reading the last plugged-in certificates, which are then not used.
+	LastError string `json:"lastError,omitempty"`
+}
+
+// CertSummary identifies a CA certificate.
+type CertSummary struct {
+	Subject      string    `json:"subject"`
+	SerialNumber string    `json:"serialNumber"`
+	NotAfter     time.Time `json:"notAfter"`
+}
+
+// pluggedCerts are the PEM encoded plugged-in certificates and key.
+type pluggedCerts struct {
+	cert, key, certChain, rootCerts []byte
+}
+
+// PluggedCertRotator watches the plugged-in CA certificates, such as the files mounted from the 'cacerts' Secret,
+// and swaps the signing certificate of the CA when they change. When the roots change, the new roots are trusted
+// for RootCertPropagation before the new certificate is used, and the previous roots are trusted for
+// RootCertOverlap after, so that workloads keep trusting each other during the rotation.
+type PluggedCertRotator struct {
+	config *PluggedCertRotatorConfig
+	ca     *IstioCA
+
+	// now returns the current time, replaced in tests.
+	now            func() time.Time
+	newFileWatcher filewatcher.NewFileWatcherFunc
+	// rootCertsHandler is called with the trusted roots when they change, to distribute them.
+	rootCertsHandler func(rootCerts []byte)
+
+	mutex sync.Mutex
+	// digest is the digest of the last plugged-in certificates read.
+	digest [sha256.Size]byte
+	// latest are the last valid plugged-in certificates read.
+	latest       *pluggedCerts
+	phase        RotationPhase
+	phaseEnd     time.Time
+	lastRotation time.Time
+	lastError    error
+}
+
+// NewPluggedCertRotator returns a new rotator of the plugged-in certificates of ca, which are the
+// certificates currently in its KeyCertBundle.
+func NewPluggedCertRotator(config *PluggedCertRotatorConfig, ca *IstioCA) *PluggedCertRotator {
+	r := &PluggedCertRotator{
+		config:         config,
+		ca:             ca,
+		now:            time.Now,
+		newFileWatcher: filewatcher.NewWatcher,
+		phase:          RotationStable,
+	}
+	if files, err := r.readFiles(); err == nil {
+		r.digest = files.digest()
+		r.latest = files
+	}
+	r.recordMetrics()
+	return r
+}
+
+// Run watches the plugged-in certificates until stopCh is closed.
+func (r *PluggedCertRotator) Run(stopCh chan struct{}) {
+	watcher := r.newFileWatcher()
+	defer watcher.Close()
+	events := make(chan struct{}, 1)
+	for _, file := range r.files() {
+		if err := watcher.Add(file); err != nil {
+			pluggedCertRotatorLog.Warnf("failed to watch %s, it is read every %s: %v", file, r.config.CheckInterval, err)
+			continue
+		}
+		go func(fileEvents chan fsnotify.Event) {
+			for {
+				select {
+				case <-fileEvents:
+					select {
+					case events <- struct{}{}:
+					default:
+					}
+				case <-stopCh:
+					return
+				}
+			}
+		}(watcher.Events(file))
+	}
+
+	ticker := time.NewTicker(r.config.CheckInterval)
+	defer ticker.Stop()
+	var debounceC <-chan time.Time
+	for {
+		select {
+		case <-events:
+			if debounceC == nil {
+				debounceC = time.After(pluggedCertDebounceDelay)
+			}
+		case <-debounceC:
+			debounceC = nil
+			r.checkAndRotate()
+		case <-ticker.C:
+			r.checkAndRotate()
+		case <-stopCh:
+			pluggedCertRotatorLog.Info("Received stop signal, so stop the plugged-in cert rotator.")
+			return
+		}
+	}
+}
+
+// Status returns the state of the rotation.
+func (r *PluggedCertRotator) Status() *PluggedCertRotationStatus {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	cert, _, _, rootCerts := r.ca.GetCAKeyCertBundle().GetAllPem()
+	status := &PluggedCertRotationStatus{
+		Phase:        r.phase,
+		TrustedRoots: summarizeCerts(rootCerts),
+	}
+	if r.phase != RotationStable {
+		phaseEnd := r.phaseEnd
+		status.PhaseEnd = &phaseEnd
+	}
+	if summaries := summarizeCerts(cert); len(summaries) > 0 {
+		status.SigningCert = &summaries[0]
+	}
+	if !r.lastRotation.IsZero() {
+		lastRotation := r.lastRotation
+		status.LastRotation = &lastRotation
+	}
+	if r.lastError != nil {
+		status.LastError = r.lastError.Error()
+	}
+	return status
+}
+
+// checkAndRotate reads the plugged-in certificates, and moves the rotation to its next phase. The root cert
+// handler is called once the trusted roots changed.
+func (r *PluggedCertRotator) checkAndRotate() {
+	rootCerts := r.ca.GetCAKeyCertBundle().GetRootCertPem()
+	r.rotate()
+	if newRootCerts := r.ca.GetCAKeyCertBundle().GetRootCertPem(); !bytes.Equal(rootCerts, newRootCerts) &&
+		r.rootCertsHandler != nil {
+		r.rootCertsHandler(newRootCerts)
+	}
+}
+
+func (r *PluggedCertRotator) rotate() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	defer r.recordMetrics()
+	now := r.now()
+
+	files, err := r.readFiles()
+	if err != nil {
+		r.fail(err)
+	} else if digest := files.digest(); digest != r.digest {
+		r.digest = digest
+		if err := files.verify(); err != nil {
+			r.fail(err)
+		} else {
+			r.lastError = nil
+			r.latest = files
+			r.startRotation(now)
+			return
+		}
+	}
+
+	if r.phase != RotationStable && !now.Before(r.phaseEnd) {
+		switch r.phase {
+		case RotationPropagating:
+			r.useLatest(now)
+		case RotationOverlap:
+			r.untrustPreviousRoots()
+		}
+	}
+}
+
+// startRotation trusts the roots of the latest certificates, and uses them right away if no new root has to be
+// propagated first.
+func (r *PluggedCertRotator) startRotation(now time.Time) {
+	cert, key, certChain, trustedRoots := r.ca.GetCAKeyCertBundle().GetAllPem()
+	added := subtractCerts(r.latest.rootCerts, trustedRoots)
+	if len(added) == 0 || r.config.RootCertPropagation <= 0 {
+		r.useLatest(now)
+		return
+	}
+	roots := append(append([]byte{}, trustedRoots...), added...)
+	if err := r.ca.GetCAKeyCertBundle().VerifyAndSetAll(cert, key, certChain, roots); err != nil {
+		r.fail(fmt.Errorf("failed to trust the new root certificates: %v", err))
+		return
+	}
+	r.phase, r.phaseEnd = RotationPropagating, now.Add(r.config.RootCertPropagation)
+	pluggedCertRotatorLog.Infof("Trusting the new root certificates, the new CA certificate is used after %s",
+		r.phaseEnd.Format(time.RFC3339))
+}
+
+// useLatest signs with the latest certificates, still trusting the previous roots during the overlap.
+func (r *PluggedCertRotator) useLatest(now time.Time) {
+	_, _, _, trustedRoots := r.ca.GetCAKeyCertBundle().GetAllPem()
+	previous := subtractCerts(trustedRoots, r.latest.rootCerts)
+	overlap := len(previous) > 0 && r.config.RootCertOverlap > 0
+	roots := r.latest.rootCerts
+	if overlap {
+		roots = append(append([]byte{}, r.latest.rootCerts...), previous...)
+	}
+	if err := r.ca.GetCAKeyCertBundle().VerifyAndSetAll(r.latest.cert, r.latest.key, r.latest.certChain, roots); err != nil {
+		r.fail(fmt.Errorf("failed to use the new CA certificate: %v", err))
+		return
+	}
+	r.lastRotation = now
+	pluggedCertRotationCounts.Increment()
+	if overlap {
+		r.phase, r.phaseEnd = RotationOverlap, now.Add(r.config.RootCertOverlap)
+		pluggedCertRotatorLog.Infof("Using the new CA certificate, the previous root certificates are trusted until %s",
+			r.phaseEnd.Format(time.RFC3339))
+		return
+	}
+	r.phase, r.phaseEnd = RotationStable, time.Time{}
+	pluggedCertRotatorLog.Info("Using the new CA certificate.")
+}
+
+// untrustPreviousRoots only trusts the roots of the latest certificates at the end of the overlap.
+func (r *PluggedCertRotator) untrustPreviousRoots() {
+	cert, key, certChain, _ := r.ca.GetCAKeyCertBundle().GetAllPem()
+	if err := r.ca.GetCAKeyCertBundle().VerifyAndSetAll(cert, key, certChain, r.latest.rootCerts); err != nil {
+		r.fail(fmt.Errorf("failed to remove the previous root certificates: %v", err))
+		return
+	}
+	r.phase, r.phaseEnd = RotationStable, time.Time{}
+	pluggedCertRotatorLog.Info("Plugged-in CA cert rotation is completed, the previous root certificates are no longer trusted.")
+}
+
+func (r *PluggedCertRotator) fail(err error) {
+	if r.lastError == nil || r.lastError.Error() != err.Error() {
+		pluggedCertRotatorLog.Errorf("Plugged-in CA cert rotation failed, keep using the current certificates: %v", err)
+	}
+	r.lastError = err
+	pluggedCertRotationErrorCounts.Increment()
+}
+
+func (r *PluggedCertRotator) recordMetrics() {
+	for _, phase := range []RotationPhase{RotationStable, RotationPropagating, RotationOverlap} {
+		value := 0.0
+		if phase == r.phase {
+			value = 1
+		}
+		pluggedCertRotationPhase.With(phaseTag.Value(string(phase))).Record(value)
+	}
+	pluggedCertTrustedRoots.Record(float64(len(splitCerts(r.ca.GetCAKeyCertBundle().GetRootCertPem()))))
+}
+
+func (r *PluggedCertRotator) files() []string {
+	return []string{r.config.signingCertFile, r.config.signingKeyFile, r.config.certChainFile, r.config.rootCertFile}
+}
+
+func (r *PluggedCertRotator) readFiles() (*pluggedCerts, error) {
+	var contents [4][]byte
+	for i, file := range r.files() {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		contents[i] = b
+	}
+	return &pluggedCerts{cert: contents[0], key: contents[1], certChain: contents[2], rootCerts: contents[3]}, nil
+}
+
+func (c *pluggedCerts) digest() [sha256.Size]byte {
+	return sha256.Sum256(bytes.Join([][]byte{c.cert, c.key, c.certChain, c.rootCerts}, []byte{0}))
+}
+
+// verify returns an error if the certificates cannot be used by the CA. The files of a Secret being updated may
+// not match yet, in which case they are read again on the next event.
+func (c *pluggedCerts) verify() error {
+	if err := util.Verify(c.cert, c.key, c.certChain, c.rootCerts); err != nil {
+		return err
+	}
+	return checkSigningCert(c.cert)
+}
+
+// splitCerts returns the DER encoded certificates of certsPEM.
+func splitCerts(certsPEM []byte) [][]byte {
+	var certs [][]byte
+	for {
+		var block *pem.Block
+		block, certsPEM = pem.Decode(certsPEM)
+		if block == nil {
+			return certs
+		}
+		if block.Type == "CERTIFICATE" {
+			certs = append(certs, block.Bytes)
+		}
+	}
+}
+
+// subtractCerts returns the PEM encoded certificates of a which are not in b.
+func subtractCerts(a, b []byte) []byte {
+	var out []byte
+	bCerts := splitCerts(b)
+	for _, cert := range splitCerts(a) {
+		found := false
+		for _, bCert := range bCerts {
+			if bytes.Equal(cert, bCert) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			out = append(out, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert})...)
+		}
+	}
+	return out
+}
+
+func summarizeCerts(certsPEM []byte) []CertSummary {
+	summaries := []CertSummary{}
+	for _, der := range splitCerts(certsPEM) {
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			continue
+		}
+		summaries = append(summaries, CertSummary{
+			Subject:      cert.Subject.String(),
+			SerialNumber: cert.SerialNumber.Text(16),
+			NotAfter:     cert.NotAfter,
+		})
+	}
+	return summaries
+}
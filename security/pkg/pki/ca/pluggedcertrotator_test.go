@@ -0,0 +1,191 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ca
+
+import (
+	"bytes"
+	"crypto/x509"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"istio.io/istio/security/pkg/pki/util"
+)
+
+type testCACert struct {
+	certPEM, keyPEM []byte
+	cert            *x509.Certificate
+	key             interface{}
+}
+
+func genTestCACert(t *testing.T, org string, signer *testCACert) *testCACert {
+	t.Helper()
+	options := util.CertOptions{
+		IsCA:         true,
+		IsSelfSigned: signer == nil,
+		TTL:          time.Hour,
+		Org:          org,
+		RSAKeySize:   2048,
+	}
+	if signer != nil {
+		options.SignerCert, options.SignerPriv = signer.cert, signer.key
+	}
+	certPEM, keyPEM, err := util.GenCertKeyFromOptions(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := util.ParsePemEncodedCertificate(certPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := util.ParsePemEncodedKey(keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCACert{certPEM: certPEM, keyPEM: keyPEM, cert: cert, key: key}
+}
+
+func writePluggedCerts(t *testing.T, dir string, intermediate *testCACert, roots ...*testCACert) {
+	t.Helper()
+	var rootCerts []byte
+	for _, root := range roots {
+		rootCerts = append(rootCerts, root.certPEM...)
+	}
+	for file, content := range map[string][]byte{
+		CaCertID:       intermediate.certPEM,
+		caPrivateKeyID: intermediate.keyPEM,
+		CertChainID:    intermediate.certPEM,
+		RootCertID:     rootCerts,
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, file), content, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestPluggedCertRotator(t *testing.T) {
+	root1 := genTestCACert(t, "root 1", nil)
+	root2 := genTestCACert(t, "root 2", nil)
+	int1 := genTestCACert(t, "intermediate 1", root1)
+	int1b := genTestCACert(t, "intermediate 1b", root1)
+	int2 := genTestCACert(t, "intermediate 2", root2)
+
+	dir := t.TempDir()
+	writePluggedCerts(t, dir, int1, root1)
+	caOpts, err := NewPluggedCertIstioCAOptions(filepath.Join(dir, CertChainID), filepath.Join(dir, CaCertID),
+		filepath.Join(dir, caPrivateKeyID), filepath.Join(dir, RootCertID), time.Hour, time.Hour, 2048)
+	if err != nil {
+		t.Fatalf("failed to create the plugged-cert CA options: %v", err)
+	}
+	caOpts.PluggedCertRotatorConfig.CheckInterval = time.Minute
+	caOpts.PluggedCertRotatorConfig.RootCertPropagation = time.Hour
+	caOpts.PluggedCertRotatorConfig.RootCertOverlap = 24 * time.Hour
+	ca, err := NewIstioCA(caOpts)
+	if err != nil {
+		t.Fatalf("failed to create the plugged-cert CA: %v", err)
+	}
+	rotator := ca.pluggedCertRotator
+	now := time.Now()
+	rotator.now = func() time.Time { return now }
+	distributedRoots := root1.certPEM
+	ca.SetPluggedRootCertsHandler(func(rootCerts []byte) {
+		distributedRoots = rootCerts
+	})
+
+	expectState := func(phase RotationPhase, signing *testCACert, roots ...*testCACert) {
+		t.Helper()
+		rotator.checkAndRotate()
+		status := ca.PluggedCertRotationStatus()
+		if status.Phase != phase {
+			t.Errorf("expected the %s phase, got %s", phase, status.Phase)
+		}
+		cert, _, _, rootCerts := ca.GetCAKeyCertBundle().GetAllPem()
+		if !bytes.Equal(cert, signing.certPEM) {
+			t.Errorf("expected the CA to sign with %s, got %v", signing.cert.Subject, status.SigningCert)
+		}
+		var expectedRoots []byte
+		for _, root := range roots {
+			expectedRoots = append(expectedRoots, root.certPEM...)
+		}
+		if !bytes.Equal(rootCerts, expectedRoots) {
+			t.Errorf("expected %d trusted roots, got %v", len(roots), status.TrustedRoots)
+		}
+		if !bytes.Equal(distributedRoots, expectedRoots) {
+			t.Errorf("expected the %d trusted roots to be distributed, got %v", len(roots), summarizeCerts(distributedRoots))
+		}
+	}
+
+	expectState(RotationStable, int1, root1)
+
+	// A new intermediate from the same root is used right away.
+	writePluggedCerts(t, dir, int1b, root1)
+	expectState(RotationStable, int1b, root1)
+
+	// Files which do not match, as while a Secret is being updated, are not used.
+	if err := ioutil.WriteFile(filepath.Join(dir, CaCertID), int2.certPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	expectState(RotationStable, int1b, root1)
+	if status := ca.PluggedCertRotationStatus(); status.LastError == "" {
+		t.Error("expected an error for the files which do not match")
+	}
+
+	// A new root is trusted before the new intermediate is used, and the previous root after.
+	writePluggedCerts(t, dir, int2, root2)
+	expectState(RotationPropagating, int1b, root1, root2)
+	if status := ca.PluggedCertRotationStatus(); status.LastError != "" || !status.PhaseEnd.Equal(now.Add(time.Hour)) {
+		t.Errorf("unexpected status %+v", status)
+	}
+	now = now.Add(time.Hour)
+	expectState(RotationOverlap, int2, root2, root1)
+	if _, err := ca.Sign(genTestCSR(t), []string{"spiffe://cluster.local/ns/default/sa/default"}, 0, false); err != nil {
+		t.Errorf("failed to sign with the new intermediate: %v", err)
+	}
+	now = now.Add(23 * time.Hour)
+	expectState(RotationOverlap, int2, root2, root1)
+	now = now.Add(time.Hour)
+	expectState(RotationStable, int2, root2)
+	if status := ca.PluggedCertRotationStatus(); status.PhaseEnd != nil || !status.LastRotation.Equal(now.Add(-24*time.Hour)) {
+		t.Errorf("unexpected status %+v", status)
+	}
+}
+
+func TestPluggedCertRotatorDisabled(t *testing.T) {
+	root := genTestCACert(t, "root", nil)
+	dir := t.TempDir()
+	writePluggedCerts(t, dir, genTestCACert(t, "intermediate", root), root)
+	caOpts, err := NewPluggedCertIstioCAOptions(filepath.Join(dir, CertChainID), filepath.Join(dir, CaCertID),
+		filepath.Join(dir, caPrivateKeyID), filepath.Join(dir, RootCertID), time.Hour, time.Hour, 2048)
+	if err != nil {
+		t.Fatalf("failed to create the plugged-cert CA options: %v", err)
+	}
+	ca, err := NewIstioCA(caOpts)
+	if err != nil {
+		t.Fatalf("failed to create the plugged-cert CA: %v", err)
+	}
+	if ca.PluggedCertRotationStatus() != nil {
+		t.Error("expected no rotation without a check interval")
+	}
+}
+
+func genTestCSR(t *testing.T) []byte {
+	t.Helper()
+	csr, _, err := util.GenCSR(util.CertOptions{Host: "spiffe://cluster.local/ns/default/sa/default", RSAKeySize: 2048})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return csr
+}
@@ -0,0 +1,447 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ra
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	raerror "istio.io/istio/security/pkg/pki/error"
+	"istio.io/istio/security/pkg/pki/util"
+)
+
+const (
+	acmeStatusValid   = "valid"
+	acmeStatusInvalid = "invalid"
+
+	// acmePollInterval is the interval of polling an order until its certificate is issued.
+	acmePollInterval = time.Second
+)
+
+// ACMERA integrated with an external CA using the ACME protocol (RFC 8555).
+// Challenges are not solved, so the ACME account must be pre-authorized for the identities, as is common with
+// private ACME servers using external account binding. SPIFFE IDs are ordered as identifiers of type "uri",
+// which the ACME server must support. ACME does not issue CA certificates.
+type ACMERA struct {
+	client        *http.Client
+	keyCertBundle *util.KeyCertBundle
+	raOpts        *IstioRAOptions
+	accountKey    *ecdsa.PrivateKey
+
+	// accountMu protects the directory and account, which are set once
+	accountMu  sync.Mutex
+	directory  *acmeDirectory
+	accountURL string
+
+	// nonceMu protects nonces
+	nonceMu sync.Mutex
+	nonces  []string
+}
+
+type acmeDirectory struct {
+	NewNonce   string `json:"newNonce"`
+	NewAccount string `json:"newAccount"`
+	NewOrder   string `json:"newOrder"`
+}
+
+type acmeIdentifier struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type acmeOrder struct {
+	Status         string           `json:"status"`
+	Identifiers    []acmeIdentifier `json:"identifiers,omitempty"`
+	NotAfter       string           `json:"notAfter,omitempty"`
+	Authorizations []string         `json:"authorizations,omitempty"`
+	Finalize       string           `json:"finalize,omitempty"`
+	Certificate    string           `json:"certificate,omitempty"`
+}
+
+type acmeAuthorization struct {
+	Status     string         `json:"status"`
+	Identifier acmeIdentifier `json:"identifier"`
+}
+
+type acmeProblem struct {
+	Type   string `json:"type"`
+	Detail string `json:"detail"`
+}
+
+func (p *acmeProblem) Error() string {
+	return fmt.Sprintf("%s: %s", p.Type, p.Detail)
+}
+
+// NewACMERA : Create a RA that interfaces with an ACME server
+func NewACMERA(raOpts *IstioRAOptions) (*ACMERA, error) {
+	keyCertBundle, err := util.NewKeyCertBundleWithRootCertFromFile(raOpts.CaCertFile)
+	if err != nil {
+		return nil, raerror.NewError(raerror.CAInitFail, fmt.Errorf("error processing Certificate Bundle for ACME RA"))
+	}
+	if raOpts.CaAddress == "" {
+		return nil, raerror.NewError(raerror.CAInitFail, fmt.Errorf("the ACME directory URL is required"))
+	}
+	client, err := newHTTPClient(raOpts.CaServerRootCertFile)
+	if err != nil {
+		return nil, raerror.NewError(raerror.CAInitFail, fmt.Errorf("error creating the ACME client: %v", err))
+	}
+	if raOpts.ACMEAccountKeyFile == "" {
+		return nil, raerror.NewError(raerror.CAInitFail, fmt.Errorf("the ACME account key file is required"))
+	}
+	accountKey, err := loadOrCreateACMEAccountKey(raOpts.ACMEAccountKeyFile)
+	if err != nil {
+		return nil, raerror.NewError(raerror.CAInitFail, err)
+	}
+	return &ACMERA{
+		client:        client,
+		raOpts:        raOpts,
+		keyCertBundle: keyCertBundle,
+		accountKey:    accountKey,
+	}, nil
+}
+
+// loadOrCreateACMEAccountKey loads the ACME account key from the file, or generates it and writes it to the file
+// if the file does not exist.
+func loadOrCreateACMEAccountKey(keyFile string) (*ecdsa.PrivateKey, error) {
+	b, err := ioutil.ReadFile(keyFile)
+	if os.IsNotExist(err) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		der, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+		if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+			return nil, fmt.Errorf("failed to write the ACME account key: %v", err)
+		}
+		return key, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the ACME account key: %v", err)
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, fmt.Errorf("invalid PEM encoded ACME account key in %s", keyFile)
+	}
+	key, err := x509.ParseECPrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ACME account key in %s: %v", keyFile, err)
+	}
+	if key.Curve != elliptic.P256() {
+		return nil, fmt.Errorf("the ACME account key in %s must be a P-256 key", keyFile)
+	}
+	return key, nil
+}
+
+// Sign takes a PEM-encoded CSR, subject IDs and lifetime, and returns a certificate issued by the ACME server,
+// followed by the intermediate certificates.
+func (r *ACMERA) Sign(csrPEM []byte, subjectIDs []string, requestedLifetime time.Duration, forCA bool) ([]byte, error) {
+	if forCA {
+		return nil, raerror.NewError(raerror.CSRError, fmt.Errorf("ACME does not issue CA certificates"))
+	}
+	lifetime, err := validateRequest(r.raOpts, csrPEM, subjectIDs, requestedLifetime)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(csrPEM)
+	if block == nil {
+		return nil, raerror.NewError(raerror.CSRError, fmt.Errorf("invalid PEM encoded CSR"))
+	}
+	certChain, err := r.issue(block.Bytes, subjectIDs, time.Now().Add(lifetime))
+	if err != nil {
+		return nil, raerror.NewError(raerror.CertGenError, err)
+	}
+	return certChain, nil
+}
+
+func (r *ACMERA) issue(csrDER []byte, subjectIDs []string, notAfter time.Time) ([]byte, error) {
+	dir, kid, err := r.ensureAccount()
+	if err != nil {
+		return nil, err
+	}
+
+	order := &acmeOrder{NotAfter: notAfter.UTC().Format(time.RFC3339)}
+	for _, id := range subjectIDs {
+		idType := "dns"
+		if u, err := url.Parse(id); err == nil && u.Scheme != "" {
+			idType = "uri"
+		}
+		order.Identifiers = append(order.Identifiers, acmeIdentifier{Type: idType, Value: id})
+	}
+	resp, body, err := r.post(dir, dir.NewOrder, kid, order)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create order: %v", err)
+	}
+	orderURL := resp.Header.Get("Location")
+	order = &acmeOrder{}
+	if err := json.Unmarshal(body, order); err != nil {
+		return nil, fmt.Errorf("invalid order: %v", err)
+	}
+
+	for _, authzURL := range order.Authorizations {
+		_, body, err := r.post(dir, authzURL, kid, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get authorization: %v", err)
+		}
+		authz := &acmeAuthorization{}
+		if err := json.Unmarshal(body, authz); err != nil {
+			return nil, fmt.Errorf("invalid authorization: %v", err)
+		}
+		if authz.Status != acmeStatusValid {
+			return nil, fmt.Errorf("authorization of %s is %s, the ACME account must be pre-authorized",
+				authz.Identifier.Value, authz.Status)
+		}
+	}
+
+	if _, body, err = r.post(dir, order.Finalize, kid, map[string]string{"csr": base64.RawURLEncoding.EncodeToString(csrDER)}); err != nil {
+		return nil, fmt.Errorf("failed to finalize order: %v", err)
+	}
+	deadline := time.Now().Add(signTimeout)
+	for {
+		order = &acmeOrder{}
+		if err := json.Unmarshal(body, order); err != nil {
+			return nil, fmt.Errorf("invalid order: %v", err)
+		}
+		if order.Status == acmeStatusValid && order.Certificate != "" {
+			break
+		}
+		if order.Status == acmeStatusInvalid {
+			return nil, fmt.Errorf("order %s is invalid", orderURL)
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out waiting for order %s, which is %s", orderURL, order.Status)
+		}
+		time.Sleep(acmePollInterval)
+		if _, body, err = r.post(dir, orderURL, kid, nil); err != nil {
+			return nil, fmt.Errorf("failed to get order: %v", err)
+		}
+	}
+
+	if _, body, err = r.post(dir, order.Certificate, kid, nil); err != nil {
+		return nil, fmt.Errorf("failed to download certificate: %v", err)
+	}
+	return buildCertChain(body)
+}
+
+// ensureAccount fetches the directory and registers the account, if not done yet, and returns them.
+func (r *ACMERA) ensureAccount() (*acmeDirectory, string, error) {
+	r.accountMu.Lock()
+	defer r.accountMu.Unlock()
+	if r.directory == nil {
+		resp, err := r.client.Get(r.raOpts.CaAddress)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to get ACME directory: %v", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, "", fmt.Errorf("failed to get ACME directory: status %d", resp.StatusCode)
+		}
+		dir := &acmeDirectory{}
+		if err := json.NewDecoder(resp.Body).Decode(dir); err != nil {
+			return nil, "", fmt.Errorf("invalid ACME directory: %v", err)
+		}
+		r.directory = dir
+	}
+	if r.accountURL != "" {
+		return r.directory, r.accountURL, nil
+	}
+
+	account := map[string]interface{}{"termsOfServiceAgreed": true}
+	if r.raOpts.ACMEEABKeyID != "" {
+		eab, err := r.externalAccountBinding(r.directory.NewAccount)
+		if err != nil {
+			return nil, "", err
+		}
+		account["externalAccountBinding"] = eab
+	}
+	resp, _, err := r.post(r.directory, r.directory.NewAccount, "", account)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to register ACME account: %v", err)
+	}
+	if r.accountURL = resp.Header.Get("Location"); r.accountURL == "" {
+		return nil, "", fmt.Errorf("failed to register ACME account: no account URL")
+	}
+	return r.directory, r.accountURL, nil
+}
+
+// externalAccountBinding returns the JWS binding the account key to the external account.
+func (r *ACMERA) externalAccountBinding(newAccountURL string) (json.RawMessage, error) {
+	encodedKey, err := ioutil.ReadFile(r.raOpts.ACMEEABKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the external account binding key: %v", err)
+	}
+	hmacKey, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(strings.TrimSpace(string(encodedKey)), "="))
+	if err != nil {
+		return nil, fmt.Errorf("invalid external account binding key: %v", err)
+	}
+	protected, err := json.Marshal(map[string]string{"alg": "HS256", "kid": r.raOpts.ACMEEABKeyID, "url": newAccountURL})
+	if err != nil {
+		return nil, err
+	}
+	payload, err := json.Marshal(r.jwk())
+	if err != nil {
+		return nil, err
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(protected) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	mac := hmac.New(sha256.New, hmacKey)
+	mac.Write([]byte(signingInput))
+	return json.Marshal(map[string]string{
+		"protected": base64.RawURLEncoding.EncodeToString(protected),
+		"payload":   base64.RawURLEncoding.EncodeToString(payload),
+		"signature": base64.RawURLEncoding.EncodeToString(mac.Sum(nil)),
+	})
+}
+
+func (r *ACMERA) jwk() map[string]string {
+	pub := r.accountKey.PublicKey
+	size := (pub.Curve.Params().BitSize + 7) / 8
+	return map[string]string{
+		"crv": pub.Curve.Params().Name,
+		"kty": "EC",
+		"x":   base64.RawURLEncoding.EncodeToString(padBytes(pub.X.Bytes(), size)),
+		"y":   base64.RawURLEncoding.EncodeToString(padBytes(pub.Y.Bytes(), size)),
+	}
+}
+
+func padBytes(b []byte, size int) []byte {
+	if len(b) >= size {
+		return b
+	}
+	return append(make([]byte, size-len(b)), b...)
+}
+
+// post sends a JWS signed POST to the ACME server, or a POST-as-GET if payload is nil. The account is
+// identified by kid, or by its key when registering it. A request rejected for a bad nonce is retried
+// once, as the nonce may have expired.
+func (r *ACMERA) post(dir *acmeDirectory, target string, kid string, payload interface{}) (*http.Response, []byte, error) {
+	resp, body, err := r.postOnce(dir, target, kid, payload)
+	if p, ok := err.(*acmeProblem); ok && p.Type == "urn:ietf:params:acme:error:badNonce" {
+		resp, body, err = r.postOnce(dir, target, kid, payload)
+	}
+	return resp, body, err
+}
+
+func (r *ACMERA) postOnce(dir *acmeDirectory, target string, kid string, payload interface{}) (*http.Response, []byte, error) {
+	nonce, err := r.nonce(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	protected := map[string]interface{}{"alg": "ES256", "nonce": nonce, "url": target}
+	if kid != "" {
+		protected["kid"] = kid
+	} else {
+		protected["jwk"] = r.jwk()
+	}
+	protectedJSON, err := json.Marshal(protected)
+	if err != nil {
+		return nil, nil, err
+	}
+	encodedPayload := ""
+	if payload != nil {
+		payloadJSON, err := json.Marshal(payload)
+		if err != nil {
+			return nil, nil, err
+		}
+		encodedPayload = base64.RawURLEncoding.EncodeToString(payloadJSON)
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(protectedJSON) + "." + encodedPayload
+	digest := sha256.Sum256([]byte(signingInput))
+	sigR, sigS, err := ecdsa.Sign(rand.Reader, r.accountKey, digest[:])
+	if err != nil {
+		return nil, nil, err
+	}
+	signature := append(padBytes(sigR.Bytes(), 32), padBytes(sigS.Bytes(), 32)...)
+	jws, err := json.Marshal(map[string]string{
+		"protected": base64.RawURLEncoding.EncodeToString(protectedJSON),
+		"payload":   encodedPayload,
+		"signature": base64.RawURLEncoding.EncodeToString(signature),
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	resp, err := r.client.Post(target, "application/jose+json", bytes.NewReader(jws))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	if n := resp.Header.Get("Replay-Nonce"); n != "" {
+		r.nonceMu.Lock()
+		r.nonces = append(r.nonces, n)
+		r.nonceMu.Unlock()
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp.StatusCode >= 400 {
+		problem := &acmeProblem{}
+		if err := json.Unmarshal(body, problem); err != nil || problem.Type == "" {
+			return nil, nil, fmt.Errorf("status %d: %s", resp.StatusCode, body)
+		}
+		return nil, nil, problem
+	}
+	return resp, body, nil
+}
+
+// nonce returns a nonce returned by a previous response, or a new one.
+func (r *ACMERA) nonce(dir *acmeDirectory) (string, error) {
+	r.nonceMu.Lock()
+	if n := len(r.nonces); n > 0 {
+		nonce := r.nonces[n-1]
+		r.nonces = r.nonces[:n-1]
+		r.nonceMu.Unlock()
+		return nonce, nil
+	}
+	r.nonceMu.Unlock()
+	resp, err := r.client.Head(dir.NewNonce)
+	if err != nil {
+		return "", fmt.Errorf("failed to get nonce: %v", err)
+	}
+	resp.Body.Close()
+	nonce := resp.Header.Get("Replay-Nonce")
+	if nonce == "" {
+		return "", fmt.Errorf("failed to get nonce: status %d", resp.StatusCode)
+	}
+	return nonce, nil
+}
+
+// SignWithCertChain is similar to Sign but returns the leaf cert and the entire cert chain.
+func (r *ACMERA) SignWithCertChain(csrPEM []byte, subjectIDs []string, ttl time.Duration, forCA bool) ([]byte, error) {
+	return signWithCertChain(r, csrPEM, subjectIDs, ttl, forCA)
+}
+
+// GetCAKeyCertBundle returns the KeyCertBundle for the CA.
+func (r *ACMERA) GetCAKeyCertBundle() *util.KeyCertBundle {
+	return r.keyCertBundle
+}
@@ -0,0 +1,292 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ra
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeACME is a minimal ACME server, with accounts pre-authorized for every identifier unless pendingAuthz is set.
+type fakeACME struct {
+	t      *testing.T
+	signer *testSigner
+	server *httptest.Server
+
+	mu           sync.Mutex
+	nonce        int
+	nonces       map[string]bool
+	accountKey   *ecdsa.PublicKey
+	eab          bool
+	badNonce     bool
+	pendingAuthz bool
+	order        *acmeOrder
+	cert         []byte
+}
+
+type fakeJWS struct {
+	Protected string `json:"protected"`
+	Payload   string `json:"payload"`
+	Signature string `json:"signature"`
+}
+
+func newFakeACME(t *testing.T, s *testSigner) *fakeACME {
+	f := &fakeACME{t: t, signer: s, nonces: map[string]bool{}}
+	f.server = httptest.NewServer(http.HandlerFunc(f.handle))
+	return f
+}
+
+func (f *fakeACME) newNonce() string {
+	f.nonce++
+	n := fmt.Sprintf("nonce-%d", f.nonce)
+	f.nonces[n] = true
+	return n
+}
+
+func (f *fakeACME) problem(w http.ResponseWriter, status int, problemType string) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(&acmeProblem{Type: "urn:ietf:params:acme:error:" + problemType, Detail: problemType})
+}
+
+// verify checks the JWS of a request and returns its decoded payload.
+func (f *fakeACME) verify(req *http.Request) ([]byte, string, bool) {
+	jws := &fakeJWS{}
+	if err := json.NewDecoder(req.Body).Decode(jws); err != nil {
+		return nil, "", false
+	}
+	protectedJSON, _ := base64.RawURLEncoding.DecodeString(jws.Protected)
+	protected := struct {
+		Alg   string            `json:"alg"`
+		Nonce string            `json:"nonce"`
+		URL   string            `json:"url"`
+		Kid   string            `json:"kid"`
+		JWK   map[string]string `json:"jwk"`
+	}{}
+	if err := json.Unmarshal(protectedJSON, &protected); err != nil || protected.Alg != "ES256" {
+		return nil, "", false
+	}
+	if !f.nonces[protected.Nonce] || protected.URL != f.server.URL+req.URL.Path {
+		f.t.Errorf("invalid nonce or url in %s", protectedJSON)
+		return nil, "", false
+	}
+	delete(f.nonces, protected.Nonce)
+
+	key := f.accountKey
+	if protected.JWK != nil {
+		x, _ := base64.RawURLEncoding.DecodeString(protected.JWK["x"])
+		y, _ := base64.RawURLEncoding.DecodeString(protected.JWK["y"])
+		key = &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+	} else if protected.Kid != f.server.URL+"/account/1" {
+		f.t.Errorf("unexpected kid %q", protected.Kid)
+		return nil, "", false
+	}
+	sig, _ := base64.RawURLEncoding.DecodeString(jws.Signature)
+	digest := sha256.Sum256([]byte(jws.Protected + "." + jws.Payload))
+	if key == nil || len(sig) != 64 ||
+		!ecdsa.Verify(key, digest[:], new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])) {
+		f.t.Errorf("invalid JWS signature")
+		return nil, "", false
+	}
+	if protected.JWK != nil {
+		f.accountKey = key
+	}
+	payload, _ := base64.RawURLEncoding.DecodeString(jws.Payload)
+	return payload, protected.Kid, true
+}
+
+func (f *fakeACME) handle(w http.ResponseWriter, req *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	base := f.server.URL
+	if req.URL.Path == "/directory" {
+		_ = json.NewEncoder(w).Encode(&acmeDirectory{NewNonce: base + "/nonce", NewAccount: base + "/account", NewOrder: base + "/order"})
+		return
+	}
+	w.Header().Set("Replay-Nonce", f.newNonce())
+	if req.URL.Path == "/nonce" {
+		return
+	}
+	payload, _, ok := f.verify(req)
+	if !ok {
+		f.problem(w, http.StatusBadRequest, "malformed")
+		return
+	}
+
+	switch req.URL.Path {
+	case "/account":
+		account := map[string]json.RawMessage{}
+		_ = json.Unmarshal(payload, &account)
+		if _, ok := account["externalAccountBinding"]; ok != f.eab {
+			f.problem(w, http.StatusUnauthorized, "externalAccountRequired")
+			return
+		}
+		w.Header().Set("Location", base+"/account/1")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"status":"valid"}`))
+	case "/order":
+		if f.badNonce {
+			f.badNonce = false
+			f.problem(w, http.StatusBadRequest, "badNonce")
+			return
+		}
+		f.order = &acmeOrder{}
+		_ = json.Unmarshal(payload, f.order)
+		f.order.Status = "pending"
+		f.order.Authorizations = []string{base + "/authz/1"}
+		f.order.Finalize = base + "/finalize/1"
+		w.Header().Set("Location", base+"/order/1")
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(f.order)
+	case "/authz/1":
+		status := acmeStatusValid
+		if f.pendingAuthz {
+			status = "pending"
+		}
+		_ = json.NewEncoder(w).Encode(&acmeAuthorization{Status: status, Identifier: f.order.Identifiers[0]})
+	case "/finalize/1":
+		finalize := map[string]string{}
+		_ = json.Unmarshal(payload, &finalize)
+		csrDER, _ := base64.RawURLEncoding.DecodeString(finalize["csr"])
+		notAfter, _ := time.Parse(time.RFC3339, f.order.NotAfter)
+		var ids []string
+		for _, id := range f.order.Identifiers {
+			if id.Type != "uri" {
+				f.t.Errorf("unexpected identifier %v", id)
+			}
+			ids = append(ids, id.Value)
+		}
+		f.cert = f.signer.sign(f.t, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csrDER}),
+			ids, time.Until(notAfter).Round(time.Minute), false)
+		// The certificate is issued asynchronously, so the order is polled.
+		f.order.Status = "processing"
+		_ = json.NewEncoder(w).Encode(f.order)
+	case "/order/1":
+		f.order.Status = acmeStatusValid
+		f.order.Certificate = base + "/cert/1"
+		_ = json.NewEncoder(w).Encode(f.order)
+	case "/cert/1":
+		w.Header().Set("Content-Type", "application/pem-certificate-chain")
+		_, _ = w.Write(f.cert)
+	default:
+		f.problem(w, http.StatusNotFound, "malformed")
+	}
+}
+
+func TestACMERA(t *testing.T) {
+	s := newTestSigner(t)
+	acme := newFakeACME(t, s)
+	defer acme.server.Close()
+	acme.eab = true
+	acme.badNonce = true
+
+	opts := s.raOptions(t, ExtCAACME)
+	opts.CaAddress = acme.server.URL + "/directory"
+	opts.ACMEAccountKeyFile = filepath.Join(t.TempDir(), "account.key")
+	opts.ACMEEABKeyID = "kid-1"
+	opts.ACMEEABKeyFile = filepath.Join(t.TempDir(), "eab")
+	if err := ioutil.WriteFile(opts.ACMEEABKeyFile, []byte(base64.RawURLEncoding.EncodeToString([]byte("hmac"))), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	ra, err := NewIstioRA(opts)
+	if err != nil {
+		t.Fatalf("failed to create the ACME RA: %v", err)
+	}
+	csrPEM := createFakeCsr(t)
+	subjectIDs := []string{testCsrHostName}
+
+	cert, err := ra.Sign(csrPEM, subjectIDs, 90*time.Minute, false)
+	if err != nil {
+		t.Fatalf("Sign error: %v", err)
+	}
+	verifyCert(t, cert, subjectIDs, 90*time.Minute, false)
+
+	if _, err := ra.Sign(csrPEM, subjectIDs, time.Hour, true); err == nil {
+		t.Error("expected CA certificates to be rejected")
+	}
+	if _, err := ra.Sign(csrPEM, subjectIDs, 3*time.Hour, false); err == nil {
+		t.Error("expected a lifetime above the max TTL to be rejected")
+	}
+
+	acme.mu.Lock()
+	acme.pendingAuthz = true
+	acme.mu.Unlock()
+	if _, err := ra.Sign(csrPEM, subjectIDs, time.Hour, false); err == nil || !strings.Contains(err.Error(), "pre-authorized") {
+		t.Errorf("expected a pending authorization to be rejected, got %v", err)
+	}
+}
+
+func TestACMERAExternalAccountRequired(t *testing.T) {
+	s := newTestSigner(t)
+	acme := newFakeACME(t, s)
+	defer acme.server.Close()
+	acme.eab = true
+
+	opts := s.raOptions(t, ExtCAACME)
+	opts.CaAddress = acme.server.URL + "/directory"
+	opts.ACMEAccountKeyFile = filepath.Join(t.TempDir(), "account.key")
+	ra, err := NewACMERA(opts)
+	if err != nil {
+		t.Fatalf("failed to create the ACME RA: %v", err)
+	}
+	if _, err := ra.Sign(createFakeCsr(t), []string{testCsrHostName}, time.Hour, false); err == nil ||
+		!strings.Contains(err.Error(), "externalAccountRequired") {
+		t.Errorf("expected the account registration to fail, got %v", err)
+	}
+}
+
+func TestACMERAAccountKey(t *testing.T) {
+	s := newTestSigner(t)
+	opts := s.raOptions(t, ExtCAACME)
+	opts.CaAddress = "https://acme.example.com/directory"
+	if _, err := NewACMERA(opts); err == nil {
+		t.Error("expected the ACME account key file to be required")
+	}
+
+	// The generated key is persisted, and reused by the next RA.
+	opts.ACMEAccountKeyFile = filepath.Join(t.TempDir(), "account.key")
+	first, err := NewACMERA(opts)
+	if err != nil {
+		t.Fatalf("failed to create the ACME RA: %v", err)
+	}
+	second, err := NewACMERA(opts)
+	if err != nil {
+		t.Fatalf("failed to create the ACME RA with the persisted key: %v", err)
+	}
+	if !first.accountKey.Equal(second.accountKey) {
+		t.Error("expected the persisted ACME account key to be reused")
+	}
+
+	if err := ioutil.WriteFile(opts.ACMEAccountKeyFile, []byte("invalid"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewACMERA(opts); err == nil {
+		t.Error("expected an invalid ACME account key to be rejected")
+	}
+}
@@ -14,7 +14,13 @@
 package ra
 
 import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
 	"fmt"
+	"io/ioutil"
+	"net/http"
 	"time"
 
 	certificatesv1beta1 "k8s.io/client-go/kubernetes/typed/certificates/v1beta1"
@@ -50,6 +56,27 @@ type IstioRAOptions struct {
 	K8sClient certificatesv1beta1.CertificatesV1beta1Interface
 	// TrustDomain
 	TrustDomain string
+	// CaAddress : Address of the external CA: the Vault server, the ACME directory URL or the gRPC address of the
+	// signer plugin
+	CaAddress string
+	// CaServerRootCertFile : File containing PEM encoded root certificates verifying the TLS certificate of CaAddress.
+	// The system roots are used if empty.
+	CaServerRootCertFile string
+	// VaultTokenFile : File containing the Vault token. It is read for every request, so the token can be rotated
+	VaultTokenFile string
+	// VaultPKIPath : Mount path of the Vault PKI secrets engine
+	VaultPKIPath string
+	// VaultRole : Vault PKI role signing the workload certificates
+	VaultRole string
+	// ACMEEABKeyID : Key identifier of the ACME external account binding, if required by the ACME server
+	ACMEEABKeyID string
+	// ACMEEABKeyFile : File containing the base64url encoded HMAC key of the ACME external account binding
+	ACMEEABKeyFile string
+	// ACMEAccountKeyFile : File containing the PEM encoded P-256 key of the ACME account. The key is generated and
+	// written to the file if it does not exist, so the same account is used across restarts
+	ACMEAccountKeyFile string
+	// PluginCommand : Command and arguments of the signer plugin run for every CSR
+	PluginCommand []string
 }
 
 const (
@@ -59,6 +86,21 @@ const (
 	// ExtCAGrpc : Integration with external CA using Istio CA gRPC API
 	ExtCAGrpc CaExternalType = "ISTIOD_RA_ISTIO_API"
 
+	// ExtCAVault : Integrate with external CA using the Vault PKI secrets engine API
+	ExtCAVault CaExternalType = "ISTIOD_RA_VAULT_API"
+
+	// ExtCAACME : Integrate with external CA using the ACME protocol
+	ExtCAACME CaExternalType = "ISTIOD_RA_ACME"
+
+	// ExtCAExec : Integrate with external CA by running a signer plugin command
+	ExtCAExec CaExternalType = "ISTIOD_RA_EXEC"
+
+	// DefaultVaultPKIPath : Default mount path of the Vault PKI secrets engine
+	DefaultVaultPKIPath = "pki"
+
+	// signTimeout : Timeout of signing a CSR with an external CA
+	signTimeout = 30 * time.Second
+
 	// DefaultExtCACertDir : Location of external CA certificate
 	DefaultExtCACertDir string = "./etc/external-ca-cert"
 )
@@ -92,22 +134,65 @@ func ValidateCSR(csrPEM []byte, subjectIDs []string) bool {
 // NewIstioRA is a factory method that returns an RA that implements the RegistrationAuthority functionality.
 // the caOptions defines the external provider
 func NewIstioRA(opts *IstioRAOptions) (RegistrationAuthority, error) {
-	if opts.ExternalCAType == ExtCAK8s {
+	switch opts.ExternalCAType {
+	case ExtCAK8s:
 		istioRA, err := NewKubernetesRA(opts)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create an K8s CA: %v", err)
 		}
 		return istioRA, err
+	case ExtCAVault:
+		istioRA, err := NewVaultRA(opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create a Vault CA: %v", err)
+		}
+		return istioRA, err
+	case ExtCAACME:
+		istioRA, err := NewACMERA(opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create an ACME CA: %v", err)
+		}
+		return istioRA, err
+	case ExtCAExec:
+		istioRA, err := NewExecRA(opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create an exec plugin CA: %v", err)
+		}
+		return istioRA, err
+	case ExtCAGrpc:
+		istioRA, err := NewGrpcRA(opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create a gRPC plugin CA: %v", err)
+		}
+		return istioRA, err
 	}
 	return nil, fmt.Errorf("invalid CA Name %s", opts.ExternalCAType)
 }
 
+// signWithCertChain signs the CSR with the RA, and appends the cert chain of the RA to the signed cert.
+func signWithCertChain(r RegistrationAuthority, csrPEM []byte, subjectIDs []string, ttl time.Duration, forCA bool) ([]byte, error) {
+	cert, err := r.Sign(csrPEM, subjectIDs, ttl, forCA)
+	if err != nil {
+		return nil, err
+	}
+	chainPem := r.GetCAKeyCertBundle().GetCertChainPem()
+	if len(chainPem) > 0 {
+		cert = append(cert, chainPem...)
+	}
+	return cert, nil
+}
+
 // preSign : Validation checks to execute before signing certificates
 func preSign(raOpts *IstioRAOptions, csrPEM []byte, subjectIDs []string, requestedLifetime time.Duration, forCA bool) (time.Duration, error) {
 	if forCA {
 		return requestedLifetime, raerror.NewError(raerror.CSRError,
 			fmt.Errorf("unable to generate CA certifificates"))
 	}
+	return validateRequest(raOpts, csrPEM, subjectIDs, requestedLifetime)
+}
+
+// validateRequest : Validation checks of the CSR identities and lifetime, for RAs which can also sign CA certificates
+func validateRequest(raOpts *IstioRAOptions, csrPEM []byte, subjectIDs []string, requestedLifetime time.Duration) (time.Duration, error) {
 	if !ValidateCSR(csrPEM, subjectIDs) {
 		return requestedLifetime, raerror.NewError(raerror.CSRError, fmt.Errorf(
 			"unable to validate SAN Identities in CSR"))
@@ -124,3 +209,54 @@ func preSign(raOpts *IstioRAOptions, csrPEM []byte, subjectIDs []string, request
 	}
 	return lifetime, nil
 }
+
+// newHTTPClient : HTTP client for the external CA, trusting the roots in rootCertFile, or the system roots if empty
+func newHTTPClient(rootCertFile string) (*http.Client, error) {
+	tlsConfig := &tls.Config{}
+	if rootCertFile != "" {
+		rootCerts, err := ioutil.ReadFile(rootCertFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(rootCerts) {
+			return nil, fmt.Errorf("no certificate found in %s", rootCertFile)
+		}
+	}
+	return &http.Client{
+		Timeout:   signTimeout,
+		Transport: &http.Transport{TLSClientConfig: tlsConfig, Proxy: http.ProxyFromEnvironment},
+	}, nil
+}
+
+// buildCertChain : PEM encoded leaf certificate followed by the intermediate certificates of the chain. Root
+// certificates are dropped, as the root cert of the RA is appended to the chain returned to workloads.
+func buildCertChain(certs ...[]byte) ([]byte, error) {
+	var chain bytes.Buffer
+	for _, c := range certs {
+		for rest := c; ; {
+			var block *pem.Block
+			block, rest = pem.Decode(rest)
+			if block == nil {
+				break
+			}
+			if block.Type != "CERTIFICATE" {
+				continue
+			}
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			if chain.Len() > 0 && bytes.Equal(cert.RawIssuer, cert.RawSubject) && cert.CheckSignatureFrom(cert) == nil {
+				continue
+			}
+			if err := pem.Encode(&chain, block); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if chain.Len() == 0 {
+		return nil, fmt.Errorf("no certificate found")
+	}
+	return chain.Bytes(), nil
+}
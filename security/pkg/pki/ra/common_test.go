@@ -0,0 +1,139 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ra
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"istio.io/istio/security/pkg/pki/util"
+)
+
+// testSigner stands in for the external CA, signing CSRs with a self-signed root.
+type testSigner struct {
+	rootCert *x509.Certificate
+	rootKey  crypto.PrivateKey
+	rootPEM  []byte
+	keyPEM   []byte
+}
+
+func newTestSigner(t *testing.T) *testSigner {
+	t.Helper()
+	rootPEM, keyPEM, err := util.GenCertKeyFromOptions(util.CertOptions{
+		Host:         "external-ca",
+		Org:          "external-ca",
+		TTL:          24 * time.Hour,
+		RSAKeySize:   2048,
+		IsCA:         true,
+		IsSelfSigned: true,
+	})
+	if err != nil {
+		t.Fatalf("failed to create the root cert: %v", err)
+	}
+	rootCert, err := util.ParsePemEncodedCertificate(rootPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rootKey, err := util.ParsePemEncodedKey(keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testSigner{rootCert: rootCert, rootKey: rootKey, rootPEM: rootPEM, keyPEM: keyPEM}
+}
+
+// raOptions returns the options of a RA trusting the root of the signer.
+func (s *testSigner) raOptions(t *testing.T, caType CaExternalType) *IstioRAOptions {
+	t.Helper()
+	caCertFile := filepath.Join(t.TempDir(), "root-cert.pem")
+	if err := ioutil.WriteFile(caCertFile, s.rootPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return &IstioRAOptions{
+		ExternalCAType: caType,
+		DefaultCertTTL: time.Hour,
+		MaxCertTTL:     2 * time.Hour,
+		CaCertFile:     caCertFile,
+		TrustDomain:    "cluster.local",
+	}
+}
+
+// sign returns the PEM encoded certificate signed for the CSR, followed by the root cert.
+func (s *testSigner) sign(t *testing.T, csrPEM []byte, subjectIDs []string, ttl time.Duration, forCA bool) []byte {
+	t.Helper()
+	csr, err := util.ParsePemEncodedCSR(csrPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := util.GenCertFromCSR(csr, s.rootCert, csr.PublicKey, s.rootKey, subjectIDs, ttl, forCA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), s.rootPEM...)
+}
+
+// verifyCert checks the chain returned by a RA is the leaf certificate with the requested identities and lifetime.
+func verifyCert(t *testing.T, certChain []byte, subjectIDs []string, ttl time.Duration, forCA bool) {
+	t.Helper()
+	block, rest := pem.Decode(certChain)
+	if block == nil {
+		t.Fatalf("no certificate in %s", certChain)
+	}
+	if extra, _ := pem.Decode(rest); extra != nil {
+		t.Fatalf("expected the root cert to be dropped from the chain, got %s", certChain)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids, err := util.ExtractIDs(cert.Extensions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ids, subjectIDs) {
+		t.Errorf("expected subject IDs %v, got %v", subjectIDs, ids)
+	}
+	if got := cert.NotAfter.Sub(cert.NotBefore); got < ttl-time.Minute || got > ttl+time.Minute {
+		t.Errorf("expected a lifetime of %v, got %v", ttl, got)
+	}
+	if cert.IsCA != forCA {
+		t.Errorf("expected IsCA %v, got %v", forCA, cert.IsCA)
+	}
+}
+
+func TestBuildCertChain(t *testing.T) {
+	s := newTestSigner(t)
+	csrPEM := createFakeCsr(t)
+	leaf := s.sign(t, csrPEM, []string{testCsrHostName}, time.Hour, false)
+
+	chain, err := buildCertChain(leaf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifyCert(t, chain, []string{testCsrHostName}, time.Hour, false)
+
+	// A self-signed certificate is kept when it is the leaf.
+	if chain, err := buildCertChain(s.rootPEM); err != nil || string(chain) != string(s.rootPEM) {
+		t.Errorf("expected the root cert, got %s %v", chain, err)
+	}
+	if _, err := buildCertChain([]byte("not a certificate")); err == nil {
+		t.Error("expected an error without certificates")
+	}
+}
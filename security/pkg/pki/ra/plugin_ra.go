@@ -0,0 +1,199 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ra
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+
+	pb "istio.io/api/security/v1alpha1"
+	raerror "istio.io/istio/security/pkg/pki/error"
+	"istio.io/istio/security/pkg/pki/util"
+)
+
+const (
+	// PluginSubjectIDsKey : gRPC metadata key of the subject IDs the signer plugin must set in the certificate
+	PluginSubjectIDsKey = "subject-ids"
+	// PluginForCAKey : gRPC metadata key set to "true" when the signer plugin must sign a CA certificate
+	PluginForCAKey = "for-ca"
+)
+
+// PluginSignRequest : Request written as JSON to the standard input of the exec signer plugin. The plugin writes
+// the PEM encoded certificate, followed by its intermediate certificates, to the standard output.
+type PluginSignRequest struct {
+	// CSR : PEM encoded CSR
+	CSR string `json:"csr"`
+	// SubjectIDs : Identities to set as the SANs of the certificate
+	SubjectIDs []string `json:"subjectIDs"`
+	// TTLSeconds : Lifetime of the certificate
+	TTLSeconds int64 `json:"ttlSeconds"`
+	// ForCA : Whether to sign a CA certificate
+	ForCA bool `json:"forCA"`
+}
+
+// ExecRA integrated with an external CA by running a local signer plugin command for every CSR
+type ExecRA struct {
+	keyCertBundle *util.KeyCertBundle
+	raOpts        *IstioRAOptions
+}
+
+// NewExecRA : Create a RA that runs a signer plugin command
+func NewExecRA(raOpts *IstioRAOptions) (*ExecRA, error) {
+	keyCertBundle, err := util.NewKeyCertBundleWithRootCertFromFile(raOpts.CaCertFile)
+	if err != nil {
+		return nil, raerror.NewError(raerror.CAInitFail, fmt.Errorf("error processing Certificate Bundle for exec RA"))
+	}
+	if len(raOpts.PluginCommand) == 0 {
+		return nil, raerror.NewError(raerror.CAInitFail, fmt.Errorf("the signer plugin command is required"))
+	}
+	return &ExecRA{
+		raOpts:        raOpts,
+		keyCertBundle: keyCertBundle,
+	}, nil
+}
+
+// Sign takes a PEM-encoded CSR, subject IDs and lifetime, and returns the certificate chain written by the plugin.
+func (r *ExecRA) Sign(csrPEM []byte, subjectIDs []string, requestedLifetime time.Duration, forCA bool) ([]byte, error) {
+	lifetime, err := validateRequest(r.raOpts, csrPEM, subjectIDs, requestedLifetime)
+	if err != nil {
+		return nil, err
+	}
+	req, err := json.Marshal(&PluginSignRequest{
+		CSR:        string(csrPEM),
+		SubjectIDs: subjectIDs,
+		TTLSeconds: int64(lifetime.Seconds()),
+		ForCA:      forCA,
+	})
+	if err != nil {
+		return nil, raerror.NewError(raerror.CertGenError, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), signTimeout)
+	defer cancel()
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, r.raOpts.PluginCommand[0], r.raOpts.PluginCommand[1:]...)
+	cmd.Stdin = bytes.NewReader(req)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, raerror.NewError(raerror.CertGenError,
+			fmt.Errorf("signer plugin failed: %v: %s", err, strings.TrimSpace(stderr.String())))
+	}
+	certChain, err := buildCertChain(stdout.Bytes())
+	if err != nil {
+		return nil, raerror.NewError(raerror.CertGenError, fmt.Errorf("invalid signer plugin output: %v", err))
+	}
+	return certChain, nil
+}
+
+// SignWithCertChain is similar to Sign but returns the leaf cert and the entire cert chain.
+func (r *ExecRA) SignWithCertChain(csrPEM []byte, subjectIDs []string, ttl time.Duration, forCA bool) ([]byte, error) {
+	return signWithCertChain(r, csrPEM, subjectIDs, ttl, forCA)
+}
+
+// GetCAKeyCertBundle returns the KeyCertBundle for the CA.
+func (r *ExecRA) GetCAKeyCertBundle() *util.KeyCertBundle {
+	return r.keyCertBundle
+}
+
+// GrpcRA integrated with an external CA serving the Istio CA gRPC API, such as a local signer plugin listening
+// on a unix socket. The subject IDs and whether to sign a CA certificate are sent as gRPC metadata.
+type GrpcRA struct {
+	conn          *grpc.ClientConn
+	client        pb.IstioCertificateServiceClient
+	keyCertBundle *util.KeyCertBundle
+	raOpts        *IstioRAOptions
+}
+
+// NewGrpcRA : Create a RA that interfaces with a signer serving the Istio CA gRPC API
+func NewGrpcRA(raOpts *IstioRAOptions) (*GrpcRA, error) {
+	keyCertBundle, err := util.NewKeyCertBundleWithRootCertFromFile(raOpts.CaCertFile)
+	if err != nil {
+		return nil, raerror.NewError(raerror.CAInitFail, fmt.Errorf("error processing Certificate Bundle for gRPC RA"))
+	}
+	if raOpts.CaAddress == "" {
+		return nil, raerror.NewError(raerror.CAInitFail, fmt.Errorf("the address of the signer is required"))
+	}
+	// Without a root cert, the signer is expected to be local, such as on a unix socket.
+	transport := grpc.WithInsecure()
+	if raOpts.CaServerRootCertFile != "" {
+		creds, err := credentials.NewClientTLSFromFile(raOpts.CaServerRootCertFile, "")
+		if err != nil {
+			return nil, raerror.NewError(raerror.CAInitFail, fmt.Errorf("error loading the signer root cert: %v", err))
+		}
+		transport = grpc.WithTransportCredentials(creds)
+	}
+	conn, err := grpc.Dial(raOpts.CaAddress, transport)
+	if err != nil {
+		return nil, raerror.NewError(raerror.CAInitFail, fmt.Errorf("failed to connect to %s: %v", raOpts.CaAddress, err))
+	}
+	return &GrpcRA{
+		conn:          conn,
+		client:        pb.NewIstioCertificateServiceClient(conn),
+		raOpts:        raOpts,
+		keyCertBundle: keyCertBundle,
+	}, nil
+}
+
+// Sign takes a PEM-encoded CSR, subject IDs and lifetime, and returns the certificate chain signed by the signer.
+func (r *GrpcRA) Sign(csrPEM []byte, subjectIDs []string, requestedLifetime time.Duration, forCA bool) ([]byte, error) {
+	lifetime, err := validateRequest(r.raOpts, csrPEM, subjectIDs, requestedLifetime)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), signTimeout)
+	defer cancel()
+	md := metadata.Pairs(PluginForCAKey, strconv.FormatBool(forCA))
+	for _, id := range subjectIDs {
+		md.Append(PluginSubjectIDsKey, id)
+	}
+	resp, err := r.client.CreateCertificate(metadata.NewOutgoingContext(ctx, md), &pb.IstioCertificateRequest{
+		Csr:              string(csrPEM),
+		ValidityDuration: int64(lifetime.Seconds()),
+	})
+	if err != nil {
+		return nil, raerror.NewError(raerror.CertGenError, fmt.Errorf("signer failed: %v", err))
+	}
+	certChain, err := buildCertChain([]byte(strings.Join(resp.CertChain, "\n")))
+	if err != nil {
+		return nil, raerror.NewError(raerror.CertGenError, fmt.Errorf("invalid signer response: %v", err))
+	}
+	return certChain, nil
+}
+
+// SignWithCertChain is similar to Sign but returns the leaf cert and the entire cert chain.
+func (r *GrpcRA) SignWithCertChain(csrPEM []byte, subjectIDs []string, ttl time.Duration, forCA bool) ([]byte, error) {
+	return signWithCertChain(r, csrPEM, subjectIDs, ttl, forCA)
+}
+
+// GetCAKeyCertBundle returns the KeyCertBundle for the CA.
+func (r *GrpcRA) GetCAKeyCertBundle() *util.KeyCertBundle {
+	return r.keyCertBundle
+}
+
+// Close closes the connection to the signer.
+func (r *GrpcRA) Close() error {
+	return r.conn.Close()
+}
@@ -0,0 +1,168 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ra
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	pb "istio.io/api/security/v1alpha1"
+	"istio.io/istio/security/pkg/pki/util"
+)
+
+// TestSignerPluginProcess is not a real test. It is the signer plugin run by the exec RA, which signs with the
+// root cert and key given as arguments after "--".
+func TestSignerPluginProcess(t *testing.T) {
+	args := os.Args
+	for len(args) > 0 && args[0] != "--" {
+		args = args[1:]
+	}
+	if len(args) != 3 {
+		return
+	}
+	rootPEM, _ := ioutil.ReadFile(args[1])
+	keyPEM, _ := ioutil.ReadFile(args[2])
+	rootCert, _ := util.ParsePemEncodedCertificate(rootPEM)
+	rootKey, _ := util.ParsePemEncodedKey(keyPEM)
+	s := &testSigner{rootCert: rootCert, rootKey: rootKey, rootPEM: rootPEM}
+
+	req := &PluginSignRequest{}
+	if err := json.NewDecoder(os.Stdin).Decode(req); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid request: %v", err)
+		os.Exit(1)
+	}
+	if strings.Contains(req.SubjectIDs[0], "denied") {
+		fmt.Fprint(os.Stderr, "identity is not allowed")
+		os.Exit(2)
+	}
+	fmt.Print(string(s.sign(t, []byte(req.CSR), req.SubjectIDs, time.Duration(req.TTLSeconds)*time.Second, req.ForCA)))
+	os.Exit(0)
+}
+
+func TestExecRA(t *testing.T) {
+	s := newTestSigner(t)
+	opts := s.raOptions(t, ExtCAExec)
+	keyFile := filepath.Join(t.TempDir(), "root-key.pem")
+	if err := ioutil.WriteFile(keyFile, s.keyPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	opts.PluginCommand = []string{os.Args[0], "-test.run=TestSignerPluginProcess", "--", opts.CaCertFile, keyFile}
+	ra, err := NewIstioRA(opts)
+	if err != nil {
+		t.Fatalf("failed to create the exec RA: %v", err)
+	}
+	csrPEM := createFakeCsr(t)
+	subjectIDs := []string{testCsrHostName}
+
+	cert, err := ra.Sign(csrPEM, subjectIDs, 90*time.Minute, false)
+	if err != nil {
+		t.Fatalf("Sign error: %v", err)
+	}
+	verifyCert(t, cert, subjectIDs, 90*time.Minute, false)
+
+	cert, err = ra.Sign(csrPEM, subjectIDs, 0, true)
+	if err != nil {
+		t.Fatalf("Sign CA error: %v", err)
+	}
+	verifyCert(t, cert, subjectIDs, opts.DefaultCertTTL, true)
+
+	if _, err := ra.Sign(csrPEM, subjectIDs, 3*time.Hour, false); err == nil {
+		t.Error("expected a lifetime above the max TTL to be rejected")
+	}
+
+	deniedID := "spiffe://cluster.local/ns/denied/sa/denied"
+	deniedCSR, _, err := util.GenCSR(util.CertOptions{Host: deniedID, RSAKeySize: 2048})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ra.Sign(deniedCSR, []string{deniedID}, time.Hour, false); err == nil ||
+		!strings.Contains(err.Error(), "identity is not allowed") {
+		t.Errorf("expected the plugin error, got %v", err)
+	}
+}
+
+// fakeGrpcSigner is a signer serving the Istio CA gRPC API.
+type fakeGrpcSigner struct {
+	pb.UnimplementedIstioCertificateServiceServer
+	t      *testing.T
+	signer *testSigner
+}
+
+func (f *fakeGrpcSigner) CreateCertificate(ctx context.Context, req *pb.IstioCertificateRequest) (*pb.IstioCertificateResponse, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	subjectIDs := md.Get(PluginSubjectIDsKey)
+	if len(subjectIDs) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "no subject IDs")
+	}
+	forCA := len(md.Get(PluginForCAKey)) == 1 && md.Get(PluginForCAKey)[0] == strconv.FormatBool(true)
+	chain := f.signer.sign(f.t, []byte(req.Csr), subjectIDs, time.Duration(req.ValidityDuration)*time.Second, forCA)
+	leaf := string(chain[:len(chain)-len(f.signer.rootPEM)])
+	return &pb.IstioCertificateResponse{CertChain: []string{leaf, string(f.signer.rootPEM)}}, nil
+}
+
+func TestGrpcRA(t *testing.T) {
+	s := newTestSigner(t)
+	socket := filepath.Join(t.TempDir(), "signer.sock")
+	lis, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	server := grpc.NewServer()
+	t.Cleanup(server.Stop)
+	pb.RegisterIstioCertificateServiceServer(server, &fakeGrpcSigner{t: t, signer: s})
+	go func() {
+		_ = server.Serve(lis)
+	}()
+
+	opts := s.raOptions(t, ExtCAGrpc)
+	opts.CaAddress = "unix://" + socket
+	ra, err := NewGrpcRA(opts)
+	if err != nil {
+		t.Fatalf("failed to create the gRPC RA: %v", err)
+	}
+	defer ra.Close()
+	csrPEM := createFakeCsr(t)
+	subjectIDs := []string{testCsrHostName}
+
+	cert, err := ra.Sign(csrPEM, subjectIDs, 90*time.Minute, false)
+	if err != nil {
+		t.Fatalf("Sign error: %v", err)
+	}
+	verifyCert(t, cert, subjectIDs, 90*time.Minute, false)
+
+	cert, err = ra.SignWithCertChain(csrPEM, subjectIDs, 0, true)
+	if err != nil {
+		t.Fatalf("Sign CA error: %v", err)
+	}
+	verifyCert(t, cert, subjectIDs, opts.DefaultCertTTL, true)
+
+	if _, err := ra.Sign(csrPEM, []string{"spiffe://cluster.local/ns/other/sa/other"}, time.Hour, false); err == nil {
+		t.Error("expected a CSR not matching the subject IDs to be rejected")
+	}
+}
@@ -0,0 +1,168 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ra
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	raerror "istio.io/istio/security/pkg/pki/error"
+	"istio.io/istio/security/pkg/pki/util"
+)
+
+// VaultRA integrated with an external CA using the PKI secrets engine API of HashiCorp Vault.
+// Workload certificates are signed by the sign/<role> endpoint, so the role must allow the SPIFFE URI SANs
+// and not require a common name. CA certificates are signed by the root/sign-intermediate endpoint.
+type VaultRA struct {
+	client        *http.Client
+	keyCertBundle *util.KeyCertBundle
+	raOpts        *IstioRAOptions
+}
+
+type vaultSignRequest struct {
+	CSR               string `json:"csr"`
+	URISANs           string `json:"uri_sans,omitempty"`
+	AltNames          string `json:"alt_names,omitempty"`
+	TTL               string `json:"ttl"`
+	Format            string `json:"format"`
+	ExcludeCNFromSANs bool   `json:"exclude_cn_from_sans,omitempty"`
+	UseCSRValues      bool   `json:"use_csr_values,omitempty"`
+}
+
+type vaultSignResponse struct {
+	Data struct {
+		Certificate string   `json:"certificate"`
+		IssuingCA   string   `json:"issuing_ca"`
+		CAChain     []string `json:"ca_chain"`
+	} `json:"data"`
+	Errors []string `json:"errors"`
+}
+
+// NewVaultRA : Create a RA that interfaces with the Vault PKI secrets engine
+func NewVaultRA(raOpts *IstioRAOptions) (*VaultRA, error) {
+	keyCertBundle, err := util.NewKeyCertBundleWithRootCertFromFile(raOpts.CaCertFile)
+	if err != nil {
+		return nil, raerror.NewError(raerror.CAInitFail, fmt.Errorf("error processing Certificate Bundle for Vault RA"))
+	}
+	if raOpts.CaAddress == "" || raOpts.VaultRole == "" {
+		return nil, raerror.NewError(raerror.CAInitFail, fmt.Errorf("the Vault address and role are required"))
+	}
+	client, err := newHTTPClient(raOpts.CaServerRootCertFile)
+	if err != nil {
+		return nil, raerror.NewError(raerror.CAInitFail, fmt.Errorf("error creating the Vault client: %v", err))
+	}
+	return &VaultRA{
+		client:        client,
+		raOpts:        raOpts,
+		keyCertBundle: keyCertBundle,
+	}, nil
+}
+
+func (r *VaultRA) vaultSign(path string, req *vaultSignRequest) ([]byte, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	httpReq, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(r.raOpts.CaAddress, "/")+"/v1/"+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if r.raOpts.VaultTokenFile != "" {
+		token, err := ioutil.ReadFile(r.raOpts.VaultTokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the Vault token: %v", err)
+		}
+		httpReq.Header.Set("X-Vault-Token", strings.TrimSpace(string(token)))
+	}
+	resp, err := r.client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	signResp := &vaultSignResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(signResp); err != nil {
+		return nil, fmt.Errorf("invalid response from Vault (status %d): %v", resp.StatusCode, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("vault returned status %d: %s", resp.StatusCode, strings.Join(signResp.Errors, "; "))
+	}
+	chain := []byte(signResp.Data.Certificate)
+	if len(signResp.Data.CAChain) > 0 {
+		for _, c := range signResp.Data.CAChain {
+			chain = append(append(chain, '\n'), c...)
+		}
+	} else if signResp.Data.IssuingCA != "" {
+		chain = append(append(chain, '\n'), signResp.Data.IssuingCA...)
+	}
+	return buildCertChain(chain)
+}
+
+// Sign takes a PEM-encoded CSR, subject IDs and lifetime, and returns a certificate signed by Vault, followed by
+// the intermediate certificates.
+func (r *VaultRA) Sign(csrPEM []byte, subjectIDs []string, requestedLifetime time.Duration, forCA bool) ([]byte, error) {
+	lifetime, err := validateRequest(r.raOpts, csrPEM, subjectIDs, requestedLifetime)
+	if err != nil {
+		return nil, err
+	}
+	req := &vaultSignRequest{
+		CSR:    string(csrPEM),
+		TTL:    fmt.Sprintf("%ds", int64(lifetime.Seconds())),
+		Format: "pem",
+	}
+	var uris, dnsNames []string
+	for _, id := range subjectIDs {
+		if u, err := url.Parse(id); err == nil && u.Scheme != "" {
+			uris = append(uris, id)
+		} else {
+			dnsNames = append(dnsNames, id)
+		}
+	}
+	req.URISANs = strings.Join(uris, ",")
+	req.AltNames = strings.Join(dnsNames, ",")
+
+	pkiPath := r.raOpts.VaultPKIPath
+	if pkiPath == "" {
+		pkiPath = DefaultVaultPKIPath
+	}
+	path := pkiPath + "/sign/" + r.raOpts.VaultRole
+	if forCA {
+		path = pkiPath + "/root/sign-intermediate"
+		req.UseCSRValues = true
+	} else {
+		req.ExcludeCNFromSANs = true
+	}
+	certChain, err := r.vaultSign(strings.Trim(path, "/"), req)
+	if err != nil {
+		return nil, raerror.NewError(raerror.CertGenError, err)
+	}
+	return certChain, nil
+}
+
+// SignWithCertChain is similar to Sign but returns the leaf cert and the entire cert chain.
+func (r *VaultRA) SignWithCertChain(csrPEM []byte, subjectIDs []string, ttl time.Duration, forCA bool) ([]byte, error) {
+	return signWithCertChain(r, csrPEM, subjectIDs, ttl, forCA)
+}
+
+// GetCAKeyCertBundle returns the KeyCertBundle for the CA.
+func (r *VaultRA) GetCAKeyCertBundle() *util.KeyCertBundle {
+	return r.keyCertBundle
+}
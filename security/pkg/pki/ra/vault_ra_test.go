@@ -0,0 +1,120 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ra
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newFakeVault returns a server implementing the sign endpoints of the Vault PKI secrets engine.
+func newFakeVault(t *testing.T, s *testSigner, token string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("X-Vault-Token") != token {
+			w.WriteHeader(http.StatusForbidden)
+			_ = json.NewEncoder(w).Encode(map[string][]string{"errors": {"permission denied"}})
+			return
+		}
+		signReq := &vaultSignRequest{}
+		if err := json.NewDecoder(req.Body).Decode(signReq); err != nil {
+			t.Errorf("invalid request: %v", err)
+		}
+		forCA := false
+		switch req.URL.Path {
+		case "/v1/pki/sign/istio":
+			if !signReq.ExcludeCNFromSANs {
+				t.Errorf("expected the CN to be excluded from the SANs")
+			}
+		case "/v1/pki/root/sign-intermediate":
+			forCA = true
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_ = json.NewEncoder(w).Encode(map[string][]string{"errors": {"no handler for route"}})
+			return
+		}
+		if signReq.Format != "pem" || signReq.AltNames != "" {
+			t.Errorf("unexpected request %+v", signReq)
+		}
+		ttl, err := time.ParseDuration(signReq.TTL)
+		if err != nil {
+			t.Errorf("invalid ttl %q", signReq.TTL)
+		}
+		chain := s.sign(t, []byte(signReq.CSR), strings.Split(signReq.URISANs, ","), ttl, forCA)
+		resp := &vaultSignResponse{}
+		resp.Data.Certificate = string(chain[:len(chain)-len(s.rootPEM)])
+		resp.Data.IssuingCA = string(s.rootPEM)
+		_ = json.NewEncoder(w).Encode(resp)
+	}))
+}
+
+func TestVaultRA(t *testing.T) {
+	s := newTestSigner(t)
+	server := newFakeVault(t, s, "secret")
+	defer server.Close()
+
+	opts := s.raOptions(t, ExtCAVault)
+	opts.CaAddress = server.URL
+	opts.VaultRole = "istio"
+	opts.VaultTokenFile = filepath.Join(t.TempDir(), "token")
+	if err := ioutil.WriteFile(opts.VaultTokenFile, []byte("secret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	ra, err := NewIstioRA(opts)
+	if err != nil {
+		t.Fatalf("failed to create the Vault RA: %v", err)
+	}
+	csrPEM := createFakeCsr(t)
+	subjectIDs := []string{testCsrHostName}
+
+	cert, err := ra.Sign(csrPEM, subjectIDs, 90*time.Minute, false)
+	if err != nil {
+		t.Fatalf("Sign error: %v", err)
+	}
+	verifyCert(t, cert, subjectIDs, 90*time.Minute, false)
+
+	cert, err = ra.Sign(csrPEM, subjectIDs, 0, true)
+	if err != nil {
+		t.Fatalf("Sign CA error: %v", err)
+	}
+	verifyCert(t, cert, subjectIDs, opts.DefaultCertTTL, true)
+
+	if _, err := ra.Sign(csrPEM, subjectIDs, 3*time.Hour, false); err == nil {
+		t.Error("expected a lifetime above the max TTL to be rejected")
+	}
+	if _, err := ra.Sign(csrPEM, []string{"spiffe://cluster.local/ns/other/sa/other"}, time.Hour, false); err == nil {
+		t.Error("expected a CSR not matching the subject IDs to be rejected")
+	}
+
+	if err := ioutil.WriteFile(opts.VaultTokenFile, []byte("rotated"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ra.Sign(csrPEM, subjectIDs, time.Hour, false); err == nil || !strings.Contains(err.Error(), "permission denied") {
+		t.Errorf("expected the rotated token to be rejected, got %v", err)
+	}
+}
+
+func TestNewVaultRAValidation(t *testing.T) {
+	opts := newTestSigner(t).raOptions(t, ExtCAVault)
+	opts.CaAddress = "https://vault:8200"
+	if _, err := NewVaultRA(opts); err == nil {
+		t.Error("expected an error without a Vault role")
+	}
+}
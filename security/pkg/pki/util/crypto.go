@@ -17,6 +17,7 @@ package util
 import (
 	"crypto"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/pem"
@@ -104,7 +105,7 @@ func GetRSAKeySize(privKey crypto.PrivateKey) (int, error) {
 func IsSupportedECPrivateKey(privKey *crypto.PrivateKey) bool {
 	switch (*privKey).(type) {
 	// this should agree with var SupportedECSignatureAlgorithms
-	case *ecdsa.PrivateKey:
+	case *ecdsa.PrivateKey, ed25519.PrivateKey:
 		return true
 	default:
 		return false
@@ -321,6 +321,7 @@ func TestGetRSAKeySize(t *testing.T) {
 func TestIsSupportedECPrivateKey(t *testing.T) {
 	_, ed25519PrivKey, _ := ed25519.GenerateKey(nil)
 	ecdsaPrivKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	rsaPrivKey, _ := rsa.GenerateKey(rand.Reader, 2048)
 
 	cases := map[string]struct {
 		key         crypto.PrivateKey
@@ -332,6 +333,10 @@ func TestIsSupportedECPrivateKey(t *testing.T) {
 		},
 		"ED25519": {
 			key:         ed25519PrivKey,
+			isSupported: true,
+		},
+		"RSA": {
+			key:         rsaPrivKey,
 			isSupported: false,
 		},
 	}
@@ -39,14 +39,31 @@ import (
 )
 
 // SupportedECSignatureAlgorithms are the types of EC Signature Algorithms
-// to be used in key generation (e.g. ECDSA or ED2551)
+// to be used in key generation (e.g. ECDSA or ED2551), or RSA-PSS.
 type SupportedECSignatureAlgorithms string
 
 const (
-	// only ECDSA using P256 is currently supported
+	// EcdsaSigAlg generates ECDSA keys using P256
 	EcdsaSigAlg SupportedECSignatureAlgorithms = "ECDSA"
+	// EcdsaP384SigAlg generates ECDSA keys using P384
+	EcdsaP384SigAlg SupportedECSignatureAlgorithms = "ECDSA_P384"
+	// Ed25519SigAlg generates Ed25519 keys, which are always encoded with PKCS#8
+	Ed25519SigAlg SupportedECSignatureAlgorithms = "ED25519"
+	// RsaPssSigAlg generates RSA keys of RSAKeySize, which sign with RSA-PSS instead of PKCS#1 v1.5
+	RsaPssSigAlg SupportedECSignatureAlgorithms = "RSA_PSS"
 )
 
+// ValidateSigAlg returns an error if the signature algorithm is not supported. Empty means RSA.
+func ValidateSigAlg(alg SupportedECSignatureAlgorithms) error {
+	switch alg {
+	case "", EcdsaSigAlg, EcdsaP384SigAlg, Ed25519SigAlg, RsaPssSigAlg:
+		return nil
+	default:
+		return fmt.Errorf("unsupported signature algorithm %q, supported algorithms are %s, %s, %s and %s",
+			alg, EcdsaSigAlg, EcdsaP384SigAlg, Ed25519SigAlg, RsaPssSigAlg)
+	}
+}
+
 // CertOptions contains options for generating a new certificate.
 type CertOptions struct {
 	// Comma-separated hostnames and IPs to generate a certificate for.
@@ -94,8 +111,8 @@ type CertOptions struct {
 	PKCS8Key bool
 
 	// The type of Elliptical Signature algorithm to use
-	// when generating private keys. Currently only ECDSA is supported.
-	// If empty, RSA is used, otherwise ECC is used.
+	// when generating private keys: ECDSA with P256 or P384, or Ed25519.
+	// If empty or RSA-PSS, RSA is used, otherwise ECC is used.
 	ECSigAlg SupportedECSignatureAlgorithms
 
 	// Subjective Alternative Name values.
@@ -109,29 +126,71 @@ func GenCertKeyFromOptions(options CertOptions) (pemCert []byte, pemKey []byte,
 	// private key will be used to sign this certificate in the self-signed
 	// case, otherwise the certificate is signed by the signer private key
 	// as specified in the CertOptions.
-	if options.ECSigAlg != "" {
-		var ecPriv *ecdsa.PrivateKey
-
-		switch options.ECSigAlg {
-		case EcdsaSigAlg:
-			ecPriv, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
-			if err != nil {
-				return nil, nil, fmt.Errorf("cert generation fails at EC key generation (%v)", err)
-			}
-		default:
+	priv, err := GenerateKey(options)
+	if err != nil {
+		if err == errUnsupportedSigAlg {
 			return nil, nil, errors.New("cert generation fails due to unsupported EC signature algorithm")
 		}
-		return genCert(options, ecPriv, &ecPriv.PublicKey)
+		return nil, nil, fmt.Errorf("cert generation fails at key generation (%v)", err)
+	}
+	return genCert(options, priv, priv.Public())
+}
+
+var errUnsupportedSigAlg = errors.New("unsupported signature algorithm")
+
+// GenerateKey generates the private key of the type set by options.ECSigAlg, or an RSA key of options.RSAKeySize.
+func GenerateKey(options CertOptions) (crypto.Signer, error) {
+	switch options.ECSigAlg {
+	case EcdsaSigAlg:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case EcdsaP384SigAlg:
+		return ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case Ed25519SigAlg:
+		_, priv, err := ed25519.GenerateKey(rand.Reader)
+		return priv, err
+	case "", RsaPssSigAlg:
+		if options.RSAKeySize < minimumRsaKeySize {
+			return nil, fmt.Errorf("requested key size does not meet the minimum requied size of %d (requested: %d)",
+				minimumRsaKeySize, options.RSAKeySize)
+		}
+		return rsa.GenerateKey(rand.Reader, options.RSAKeySize)
+	default:
+		return nil, errUnsupportedSigAlg
 	}
+}
 
-	if options.RSAKeySize < minimumRsaKeySize {
-		return nil, nil, fmt.Errorf("requested key size does not meet the minimum requied size of %d (requested: %d)", minimumRsaKeySize, options.RSAKeySize)
+// signatureAlgorithm returns the algorithm to sign certificates with signerKey. A CA with an RSA key signed with
+// RSA-PSS, such as a self-signed CA created with RsaPssSigAlg, keeps signing with RSA-PSS. Otherwise the default
+// algorithm of the key is used.
+func signatureAlgorithm(signerCert *x509.Certificate, signerKey crypto.PrivateKey) x509.SignatureAlgorithm {
+	if _, ok := signerKey.(*rsa.PrivateKey); !ok || signerCert == nil {
+		return x509.UnknownSignatureAlgorithm
 	}
-	rsaPriv, err := rsa.GenerateKey(rand.Reader, options.RSAKeySize)
-	if err != nil {
-		return nil, nil, fmt.Errorf("cert generation fails at RSA key generation (%v)", err)
+	switch signerCert.SignatureAlgorithm {
+	case x509.SHA256WithRSAPSS, x509.SHA384WithRSAPSS, x509.SHA512WithRSAPSS:
+		return x509.SHA256WithRSAPSS
+	default:
+		return x509.UnknownSignatureAlgorithm
+	}
+}
+
+// CheckPublicKey returns an error if the CA does not sign certificates for the public key: RSA keys must have at
+// least 2048 bits, and ECDSA keys must use P256 or P384.
+func CheckPublicKey(pub interface{}) error {
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		if k.N.BitLen() < minimumRsaKeySize {
+			return fmt.Errorf("RSA key size %d is below the minimum of %d", k.N.BitLen(), minimumRsaKeySize)
+		}
+	case *ecdsa.PublicKey:
+		if k.Curve != elliptic.P256() && k.Curve != elliptic.P384() {
+			return fmt.Errorf("unsupported ECDSA curve %s", k.Curve.Params().Name)
+		}
+	case ed25519.PublicKey:
+	default:
+		return fmt.Errorf("unsupported public key type %T", pub)
 	}
-	return genCert(options, rsaPriv, &rsaPriv.PublicKey)
+	return nil
 }
 
 func genCert(options CertOptions, priv interface{}, key interface{}) ([]byte, []byte, error) {
@@ -142,6 +201,7 @@ func genCert(options CertOptions, priv interface{}, key interface{}) ([]byte, []
 	signerCert, signerKey := template, crypto.PrivateKey(priv)
 	if !options.IsSelfSigned {
 		signerCert, signerKey = options.SignerCert, options.SignerPriv
+		template.SignatureAlgorithm = signatureAlgorithm(signerCert, signerKey)
 	}
 	certBytes, err := x509.CreateCertificate(rand.Reader, template, signerCert, key, signerKey)
 	if err != nil {
@@ -205,6 +265,10 @@ func GetCertOptionsFromExistingCert(certBytes []byte) (opts CertOptions, err err
 	if len(orgs) > 0 {
 		opts.Org = orgs[0]
 	}
+	switch cert.SignatureAlgorithm {
+	case x509.SHA256WithRSAPSS, x509.SHA384WithRSAPSS, x509.SHA512WithRSAPSS:
+		opts.ECSigAlg = RsaPssSigAlg
+	}
 	// TODO(JimmyCYJ): parse other fields from certificate, e.g. CommonName.
 	return opts, nil
 }
@@ -215,6 +279,9 @@ func MergeCertOptions(defaultOpts, deltaOpts CertOptions) CertOptions {
 	if len(deltaOpts.Org) > 0 {
 		defaultOpts.Org = deltaOpts.Org
 	}
+	if len(deltaOpts.ECSigAlg) > 0 {
+		defaultOpts.ECSigAlg = deltaOpts.ECSigAlg
+	}
 	// TODO(JimmyCYJ): merge other fields, e.g. Host, IsDualUse, etc.
 	return defaultOpts
 }
@@ -226,6 +293,7 @@ func GenCertFromCSR(csr *x509.CertificateRequest, signingCert *x509.Certificate,
 	if err != nil {
 		return nil, err
 	}
+	tmpl.SignatureAlgorithm = signatureAlgorithm(signingCert, signingKey)
 	return x509.CreateCertificate(rand.Reader, tmpl, signingCert, publicKey, signingKey)
 }
 
@@ -264,8 +332,9 @@ func genCertTemplateFromCSR(csr *x509.CertificateRequest, subjectIDs []string, t
 	var keyUsage x509.KeyUsage
 	extKeyUsages := []x509.ExtKeyUsage{}
 	if isCA {
-		// If the cert is a CA cert, the private key is allowed to sign other certificates.
-		keyUsage = x509.KeyUsageCertSign
+		// If the cert is a CA cert, the private key is allowed to sign other certificates, and the
+		// revocation lists for them.
+		keyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign
 	} else {
 		// Otherwise the private key is allowed for digital signature and key encipherment.
 		keyUsage = x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment
@@ -317,8 +386,9 @@ func genCertTemplateFromCSR(csr *x509.CertificateRequest, subjectIDs []string, t
 func genCertTemplateFromOptions(options CertOptions) (*x509.Certificate, error) {
 	var keyUsage x509.KeyUsage
 	if options.IsCA {
-		// If the cert is a CA cert, the private key is allowed to sign other certificates.
-		keyUsage = x509.KeyUsageCertSign
+		// If the cert is a CA cert, the private key is allowed to sign other certificates, and the
+		// revocation lists for them.
+		keyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign
 	} else {
 		// Otherwise the private key is allowed for digital signature and key encipherment.
 		keyUsage = x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment
@@ -369,7 +439,7 @@ func genCertTemplateFromOptions(options CertOptions) (*x509.Certificate, error)
 		dnsNames = nil
 	}
 
-	return &x509.Certificate{
+	template := &x509.Certificate{
 		SerialNumber:          serialNum,
 		Subject:               subject,
 		NotBefore:             notBefore,
@@ -380,7 +450,11 @@ func genCertTemplateFromOptions(options CertOptions) (*x509.Certificate, error)
 		BasicConstraintsValid: true,
 		ExtraExtensions:       exts,
 		DNSNames:              dnsNames,
-	}, nil
+	}
+	if options.IsSelfSigned && options.ECSigAlg == RsaPssSigAlg {
+		template.SignatureAlgorithm = x509.SHA256WithRSAPSS
+	}
+	return template, nil
 }
 
 func genSerialNum() (*big.Int, error) {
@@ -399,26 +473,31 @@ func encodePem(isCSR bool, csrOrCert []byte, priv interface{}, pkcs8 bool) (
 		encodeMsg = "CERTIFICATE REQUEST"
 	}
 	csrOrCertPem = pem.EncodeToMemory(&pem.Block{Type: encodeMsg, Bytes: csrOrCert})
+	if privPem, err = EncodePrivateKey(priv, pkcs8); err != nil {
+		return nil, nil, err
+	}
+	return
+}
 
-	var encodedKey []byte
-	if pkcs8 {
-		if encodedKey, err = x509.MarshalPKCS8PrivateKey(priv); err != nil {
-			return nil, nil, err
+// EncodePrivateKey returns the PEM encoding of priv, in PKCS#8 if pkcs8 is set.
+func EncodePrivateKey(priv interface{}, pkcs8 bool) ([]byte, error) {
+	// Ed25519 keys only have a PKCS#8 encoding.
+	if _, ok := priv.(ed25519.PrivateKey); ok || pkcs8 {
+		encodedKey, err := x509.MarshalPKCS8PrivateKey(priv)
+		if err != nil {
+			return nil, err
 		}
-		privPem = pem.EncodeToMemory(&pem.Block{Type: blockTypePKCS8PrivateKey, Bytes: encodedKey})
-	} else {
-		switch k := priv.(type) {
-		case *rsa.PrivateKey:
-			encodedKey = x509.MarshalPKCS1PrivateKey(k)
-			privPem = pem.EncodeToMemory(&pem.Block{Type: blockTypeRSAPrivateKey, Bytes: encodedKey})
-		case *ecdsa.PrivateKey:
-			encodedKey, err = x509.MarshalECPrivateKey(k)
-			if err != nil {
-				return nil, nil, err
-			}
-			privPem = pem.EncodeToMemory(&pem.Block{Type: blockTypeECPrivateKey, Bytes: encodedKey})
+		return pem.EncodeToMemory(&pem.Block{Type: blockTypePKCS8PrivateKey, Bytes: encodedKey}), nil
+	}
+	switch k := priv.(type) {
+	case *rsa.PrivateKey:
+		return pem.EncodeToMemory(&pem.Block{Type: blockTypeRSAPrivateKey, Bytes: x509.MarshalPKCS1PrivateKey(k)}), nil
+	case *ecdsa.PrivateKey:
+		encodedKey, err := x509.MarshalECPrivateKey(k)
+		if err != nil {
+			return nil, err
 		}
+		return pem.EncodeToMemory(&pem.Block{Type: blockTypeECPrivateKey, Bytes: encodedKey}), nil
 	}
-	err = nil
-	return
+	return nil, nil
 }
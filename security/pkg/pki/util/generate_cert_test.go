@@ -24,6 +24,7 @@ import (
 	"crypto/rsa"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/pem"
 	"strings"
 	"testing"
 	"time"
@@ -102,7 +103,7 @@ func TestGenCertKeyFromOptions(t *testing.T) {
 		NotBefore:   caCertNotBefore,
 		TTL:         caCertTTL,
 		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
-		KeyUsage:    x509.KeyUsageCertSign,
+		KeyUsage:    x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
 		IsCA:        true,
 		Org:         "MyOrg",
 		Host:        host,
@@ -970,3 +971,107 @@ func TestMergeCertOptions(t *testing.T) {
 			mergedCertOptions.IsDualUse, deltaCertOptions.IsDualUse)
 	}
 }
+
+func TestKeyAlgorithms(t *testing.T) {
+	algs := []SupportedECSignatureAlgorithms{"", RsaPssSigAlg, EcdsaSigAlg, EcdsaP384SigAlg, Ed25519SigAlg}
+	for _, caAlg := range algs {
+		caCertPem, caKeyPem, err := GenCertKeyFromOptions(CertOptions{
+			Host:         "spiffe://cluster.local/ns/istio-system/sa/istiod",
+			Org:          "MyOrg",
+			TTL:          time.Hour,
+			RSAKeySize:   2048,
+			ECSigAlg:     caAlg,
+			IsCA:         true,
+			IsSelfSigned: true,
+		})
+		if err != nil {
+			t.Fatalf("CA %q: failed to generate the CA cert: %v", caAlg, err)
+		}
+		bundle, err := NewVerifiedKeyCertBundleFromPem(caCertPem, caKeyPem, nil, caCertPem)
+		if err != nil {
+			t.Fatalf("CA %q: invalid key cert bundle: %v", caAlg, err)
+		}
+		opts, err := bundle.CertOptions()
+		if err != nil {
+			t.Fatalf("CA %q: failed to get cert options: %v", caAlg, err)
+		}
+		if opts.ECSigAlg != caAlg {
+			t.Errorf("CA %q: expected the key algorithm of the bundle to be %q, got %q", caAlg, caAlg, opts.ECSigAlg)
+		}
+		caCert, caKey, _, _ := bundle.GetAll()
+
+		// The root cert rotated with the existing key keeps the signature algorithm.
+		oldOpts, err := GetCertOptionsFromExistingCert(caCertPem)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rotatedPem, _, err := GenRootCertFromExistingKey(MergeCertOptions(CertOptions{
+			TTL: time.Hour, SignerPrivPem: caKeyPem, IsCA: true, IsSelfSigned: true,
+		}, oldOpts))
+		if err != nil {
+			t.Fatalf("CA %q: failed to rotate the root cert: %v", caAlg, err)
+		}
+		rotated, _ := ParsePemEncodedCertificate(rotatedPem)
+		if rotated.SignatureAlgorithm != caCert.SignatureAlgorithm {
+			t.Errorf("CA %q: expected the rotated root cert to be signed with %v, got %v",
+				caAlg, caCert.SignatureAlgorithm, rotated.SignatureAlgorithm)
+		}
+
+		for _, alg := range algs {
+			csrPem, keyPem, err := GenCSR(CertOptions{Host: "spiffe://cluster.local/ns/foo/sa/bar", RSAKeySize: 2048, ECSigAlg: alg})
+			if err != nil {
+				t.Fatalf("CSR %q: failed to generate the CSR: %v", alg, err)
+			}
+			csr, err := ParsePemEncodedCSR(csrPem)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := CheckPublicKey(csr.PublicKey); err != nil {
+				t.Errorf("CSR %q: unexpected error %v", alg, err)
+			}
+			der, err := GenCertFromCSR(csr, caCert, csr.PublicKey, *caKey, []string{"spiffe://cluster.local/ns/foo/sa/bar"},
+				time.Hour, false)
+			if err != nil {
+				t.Fatalf("CA %q, CSR %q: failed to sign: %v", caAlg, alg, err)
+			}
+			cert, err := x509.ParseCertificate(der)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if isPSS := cert.SignatureAlgorithm == x509.SHA256WithRSAPSS; isPSS != (caAlg == RsaPssSigAlg) {
+				t.Errorf("CA %q: unexpected signature algorithm %v", caAlg, cert.SignatureAlgorithm)
+			}
+			certPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+			if err := VerifyCertificate(keyPem, certPem, caCertPem, &VerifyFields{
+				Host:        "spiffe://cluster.local/ns/foo/sa/bar",
+				ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+				KeyUsage:    x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+			}); err != nil {
+				t.Errorf("CA %q, CSR %q: invalid certificate: %v", caAlg, alg, err)
+			}
+		}
+	}
+}
+
+func TestCheckPublicKey(t *testing.T) {
+	smallRSA, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p521, err := ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, pub := range map[string]interface{}{
+		"small RSA key": &smallRSA.PublicKey,
+		"P521 key":      &p521.PublicKey,
+		"unknown key":   "key",
+	} {
+		if err := CheckPublicKey(pub); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+	if err := ValidateSigAlg("DSA"); err == nil {
+		t.Error("expected an error for an unsupported signature algorithm")
+	}
+}
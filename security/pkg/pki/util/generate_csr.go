@@ -20,12 +20,10 @@ package util
 
 import (
 	"crypto"
-	"crypto/ecdsa"
-	"crypto/elliptic"
 	"crypto/rand"
-	"crypto/rsa"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/pem"
 	"errors"
 	"fmt"
 	"io/ioutil"
@@ -40,40 +38,37 @@ const minimumRsaKeySize = 2048
 
 // GenCSR generates a X.509 certificate sign request and private key with the given options.
 func GenCSR(options CertOptions) ([]byte, []byte, error) {
-	var priv interface{}
-	var err error
-	if options.ECSigAlg != "" {
-		switch options.ECSigAlg {
-		case EcdsaSigAlg:
-			priv, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
-			if err != nil {
-				return nil, nil, fmt.Errorf("EC key generation failed (%v)", err)
-			}
-		default:
+	priv, err := GenerateKey(options)
+	if err != nil {
+		if err == errUnsupportedSigAlg {
 			return nil, nil, errors.New("csr cert generation fails due to unsupported EC signature algorithm")
 		}
-	} else {
-		if options.RSAKeySize < minimumRsaKeySize {
-			return nil, nil, fmt.Errorf("requested key size does not meet the minimum requied size of %d (requested: %d)", minimumRsaKeySize, options.RSAKeySize)
-		}
-
-		priv, err = rsa.GenerateKey(rand.Reader, options.RSAKeySize)
-		if err != nil {
-			return nil, nil, fmt.Errorf("RSA key generation failed (%v)", err)
-		}
+		return nil, nil, fmt.Errorf("key generation failed (%v)", err)
 	}
-	template, err := GenCSRTemplate(options)
+	csr, err := GenCSRWithSigner(options, priv)
 	if err != nil {
-		return nil, nil, fmt.Errorf("CSR template creation failed (%v)", err)
+		return nil, nil, err
 	}
+	privKey, err := EncodePrivateKey(priv, options.PKCS8Key)
+	return csr, privKey, err
+}
 
-	csrBytes, err := x509.CreateCertificateRequest(rand.Reader, template, crypto.PrivateKey(priv))
+// GenCSRWithSigner generates a X.509 certificate sign request for the key of signer with the given options.
+// The private key is only used through signer, so it may be held by a hardware token.
+func GenCSRWithSigner(options CertOptions, signer crypto.Signer) ([]byte, error) {
+	template, err := GenCSRTemplate(options)
 	if err != nil {
-		return nil, nil, fmt.Errorf("CSR creation failed (%v)", err)
+		return nil, fmt.Errorf("CSR template creation failed (%v)", err)
+	}
+	if options.ECSigAlg == RsaPssSigAlg {
+		template.SignatureAlgorithm = x509.SHA256WithRSAPSS
 	}
 
-	csr, privKey, err := encodePem(true, csrBytes, priv, options.PKCS8Key)
-	return csr, privKey, err
+	csrBytes, err := x509.CreateCertificateRequest(rand.Reader, template, signer)
+	if err != nil {
+		return nil, fmt.Errorf("CSR creation failed (%v)", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csrBytes}), nil
 }
 
 // GenCSRTemplate generates a certificateRequest template with the given options.
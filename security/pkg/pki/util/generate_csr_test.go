@@ -16,6 +16,8 @@ package util
 
 import (
 	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/pem"
@@ -45,11 +47,33 @@ func TestGenCSR(t *testing.T) {
 				ECSigAlg: EcdsaSigAlg,
 			},
 		},
+		"GenCSR with EC P384": {
+			csrOptions: CertOptions{
+				Host:     "test_ca.com",
+				Org:      "MyOrg",
+				ECSigAlg: EcdsaP384SigAlg,
+			},
+		},
+		"GenCSR with Ed25519": {
+			csrOptions: CertOptions{
+				Host:     "test_ca.com",
+				Org:      "MyOrg",
+				ECSigAlg: Ed25519SigAlg,
+			},
+		},
+		"GenCSR with RSA-PSS": {
+			csrOptions: CertOptions{
+				Host:       "test_ca.com",
+				Org:        "MyOrg",
+				RSAKeySize: 2048,
+				ECSigAlg:   RsaPssSigAlg,
+			},
+		},
 		"GenCSR with EC errors due to invalid signature algorithm": {
 			csrOptions: CertOptions{
 				Host:     "test_ca.com",
 				Org:      "MyOrg",
-				ECSigAlg: "ED25519",
+				ECSigAlg: "DSA",
 			},
 			err: errors.New("csr cert generation fails due to unsupported EC signature algorithm"),
 		},
@@ -85,15 +109,30 @@ func TestGenCSR(t *testing.T) {
 		if !strings.HasSuffix(string(csr.Extensions[0].Value), "test_ca.com") {
 			t.Errorf("%s: csr host does not match", id)
 		}
-		if tc.csrOptions.ECSigAlg != "" {
-			if tc.csrOptions.ECSigAlg != EcdsaSigAlg {
-				t.Errorf("%s: Only ECDSA signature algorithms are currently supported", id)
+		switch tc.csrOptions.ECSigAlg {
+		case EcdsaSigAlg, EcdsaP384SigAlg:
+			pub, ok := csr.PublicKey.(*ecdsa.PublicKey)
+			if !ok {
+				t.Fatalf("%s: decoded PKCS#8 returned unexpected key type: %T", id, csr.PublicKey)
+			}
+			if curve := map[SupportedECSignatureAlgorithms]elliptic.Curve{
+				EcdsaSigAlg: elliptic.P256(), EcdsaP384SigAlg: elliptic.P384(),
+			}[tc.csrOptions.ECSigAlg]; pub.Curve != curve {
+				t.Errorf("%s: unexpected curve %s", id, pub.Curve.Params().Name)
+			}
+		case Ed25519SigAlg:
+			if reflect.TypeOf(csr.PublicKey) != reflect.TypeOf(ed25519.PublicKey{}) {
+				t.Errorf("%s: decoded PKCS#8 returned unexpected key type: %T", id, csr.PublicKey)
+			}
+		case RsaPssSigAlg:
+			if csr.SignatureAlgorithm != x509.SHA256WithRSAPSS {
+				t.Errorf("%s: expected an RSA-PSS signature, got %v", id, csr.SignatureAlgorithm)
 			}
-			if reflect.TypeOf(csr.PublicKey) != reflect.TypeOf(&ecdsa.PublicKey{}) {
+			fallthrough
+		default:
+			if reflect.TypeOf(csr.PublicKey) != reflect.TypeOf(&rsa.PublicKey{}) {
 				t.Errorf("%s: decoded PKCS#8 returned unexpected key type: %T", id, csr.PublicKey)
 			}
-		} else if reflect.TypeOf(csr.PublicKey) != reflect.TypeOf(&rsa.PublicKey{}) {
-			t.Errorf("%s: decoded PKCS#8 returned unexpected key type: %T", id, csr.PublicKey)
 		}
 	}
 }
@@ -21,6 +21,8 @@ package util
 import (
 	"crypto"
 	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/rsa"
 	"crypto/tls"
 	"crypto/x509"
@@ -188,15 +190,23 @@ func (b *KeyCertBundle) CertOptions() (*CertOptions, error) {
 		IsDualUse: ids[0] == b.cert.Subject.CommonName,
 	}
 
-	switch (*b.privKey).(type) {
+	switch k := (*b.privKey).(type) {
 	case *rsa.PrivateKey:
 		size, err := GetRSAKeySize(*b.privKey)
 		if err != nil {
 			return nil, fmt.Errorf("failed to get RSA key size: %v", err)
 		}
 		opts.RSAKeySize = size
+		if signatureAlgorithm(b.cert, *b.privKey) == x509.SHA256WithRSAPSS {
+			opts.ECSigAlg = RsaPssSigAlg
+		}
 	case *ecdsa.PrivateKey:
 		opts.ECSigAlg = EcdsaSigAlg
+		if k.Curve == elliptic.P384() {
+			opts.ECSigAlg = EcdsaP384SigAlg
+		}
+	case ed25519.PrivateKey:
+		opts.ECSigAlg = Ed25519SigAlg
 	default:
 		return nil, errors.New("unknown private key type")
 	}
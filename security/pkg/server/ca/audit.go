@@ -0,0 +1,320 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ca
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"sync"
+	"time"
+)
+
+// AuditRecord is the record of a certificate issued by the CA server.
+type AuditRecord struct {
+	Time time.Time `json:"time"`
+	// SerialNumber is the hex serial number of the certificate.
+	SerialNumber    string   `json:"serialNumber"`
+	SubjectAltNames []string `json:"subjectAltNames"`
+	// Requester is the identities of the caller, as authenticated by Authenticator.
+	Requester     []string `json:"requester"`
+	Authenticator string   `json:"authenticator"`
+	// TTL is the validity duration of the certificate, in seconds.
+	TTL      int64  `json:"ttl"`
+	SourceIP string `json:"sourceIP"`
+}
+
+// AuditSink receives the records of the certificates issued by the CA server, such as to store
+// them out of istiod.
+type AuditSink interface {
+	Write(record *AuditRecord) error
+	Close() error
+}
+
+// QueryableAuditSink is an AuditSink whose records can be read back, to search all the records rather than
+// the recent ones kept in memory.
+type QueryableAuditSink interface {
+	AuditSink
+	// Query returns the records, oldest first, for which match returns true.
+	Query(match func(record *AuditRecord) bool) ([]*AuditRecord, error)
+}
+
+// AuditLog writes the records of the certificates issued by the CA server to its sinks, and keeps
+// the most recent ones in memory to be queried.
+type AuditLog struct {
+	sinks []AuditSink
+
+	mutex sync.RWMutex
+	// recent is a ring buffer of the most recent records, the oldest at next once it is full.
+	recent []*AuditRecord
+	next   int
+	full   bool
+}
+
+// NewAuditLog returns an AuditLog keeping the last capacity records in memory.
+func NewAuditLog(capacity int, sinks ...AuditSink) *AuditLog {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &AuditLog{
+		sinks:  sinks,
+		recent: make([]*AuditRecord, capacity),
+	}
+}
+
+// Record appends record to the log. Errors of the sinks are logged and counted, but do not fail the
+// issuance of the certificate.
+func (l *AuditLog) Record(record *AuditRecord) {
+	for _, sink := range l.sinks {
+		if err := sink.Write(record); err != nil {
+			serverCaLog.Errorf("failed to write the audit record of certificate %s: %v", record.SerialNumber, err)
+			auditErrorCounts.Increment()
+		}
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.recent[l.next] = record
+	l.next = (l.next + 1) % len(l.recent)
+	if l.next == 0 {
+		l.full = true
+	}
+}
+
+// Query returns the recent records, oldest first, of the certificates issued to or requested by
+// identity if it is not empty, and with the hex serial number serial if it is not empty. If all is
+// true, the records of the first QueryableAuditSink are searched instead of the ones kept in memory.
+func (l *AuditLog) Query(identity, serial string, all bool) ([]*AuditRecord, error) {
+	var sn *big.Int
+	if serial != "" {
+		var ok bool
+		if sn, ok = new(big.Int).SetString(serial, 16); !ok {
+			return nil, fmt.Errorf("invalid hex serial number %q", serial)
+		}
+	}
+	match := func(record *AuditRecord) bool {
+		if identity != "" && !contains(record.SubjectAltNames, identity) && !contains(record.Requester, identity) {
+			return false
+		}
+		if sn != nil {
+			if recordSN, ok := new(big.Int).SetString(record.SerialNumber, 16); !ok || recordSN.Cmp(sn) != 0 {
+				return false
+			}
+		}
+		return true
+	}
+	if all {
+		for _, sink := range l.sinks {
+			if q, ok := sink.(QueryableAuditSink); ok {
+				return q.Query(match)
+			}
+		}
+	}
+
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	records := []*AuditRecord{}
+	start := 0
+	if l.full {
+		start = l.next
+	}
+	for i := 0; i < len(l.recent); i++ {
+		record := l.recent[(start+i)%len(l.recent)]
+		if record == nil {
+			break
+		}
+		if match(record) {
+			records = append(records, record)
+		}
+	}
+	return records, nil
+}
+
+// Close closes the sinks of the log.
+func (l *AuditLog) Close() error {
+	var errs []error
+	for _, sink := range l.sinks {
+		if err := sink.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to close the audit sinks: %v", errs)
+	}
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// FileAuditSink appends the records as JSON lines to a file. The file is rotated once it reaches
+// maxSize bytes: the rotated files are suffixed with .1, the most recent, to .<maxBackups>.
+// At least one rotated file is kept, so that rotating never deletes the records just written.
+type FileAuditSink struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	mutex sync.Mutex
+	file  *os.File
+	size  int64
+}
+
+// NewFileAuditSink returns a FileAuditSink appending the records to the file at path.
+func NewFileAuditSink(path string, maxSize int64, maxBackups int) (*FileAuditSink, error) {
+	if maxBackups < 1 {
+		maxBackups = 1
+	}
+	s := &FileAuditSink{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *FileAuditSink) open() error {
+	file, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open the audit log %s: %v", s.path, err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return fmt.Errorf("failed to stat the audit log %s: %v", s.path, err)
+	}
+	s.file, s.size = file, info.Size()
+	return nil
+}
+
+func (s *FileAuditSink) Write(record *AuditRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var rotateErr error
+	if s.maxSize > 0 && s.size > 0 && s.size+int64(len(line)) > s.maxSize {
+		rotateErr = s.rotate()
+	}
+	n, err := s.file.Write(line)
+	s.size += int64(n)
+	if err != nil {
+		return err
+	}
+	return rotateErr
+}
+
+func (s *FileAuditSink) rotate() error {
+	if err := s.file.Close(); err != nil {
+		return err
+	}
+	err := s.renameBackups()
+	// The file is reopened even if it could not be renamed, so that the records are still appended to it.
+	if openErr := s.open(); openErr != nil {
+		return openErr
+	}
+	return err
+}
+
+func (s *FileAuditSink) renameBackups() error {
+	for i := s.maxBackups - 1; i > 0; i-- {
+		if err := os.Rename(fmt.Sprintf("%s.%d", s.path, i), fmt.Sprintf("%s.%d", s.path, i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return os.Rename(s.path, s.path+".1")
+}
+
+var _ QueryableAuditSink = &FileAuditSink{}
+
+// Query reads the rotated files, oldest first, then the current file. Records written while reading
+// are not returned.
+func (s *FileAuditSink) Query(match func(record *AuditRecord) bool) ([]*AuditRecord, error) {
+	files, size, err := s.openFiles()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		for _, f := range files {
+			_ = f.Close()
+		}
+	}()
+	records := []*AuditRecord{}
+	for i, f := range files {
+		var r io.Reader = f
+		if i == len(files)-1 {
+			r = io.LimitReader(f, size)
+		}
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			record := &AuditRecord{}
+			if err := json.Unmarshal(scanner.Bytes(), record); err != nil {
+				return nil, fmt.Errorf("invalid record in the audit log %s: %v", f.Name(), err)
+			}
+			if match(record) {
+				records = append(records, record)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read the audit log %s: %v", f.Name(), err)
+		}
+	}
+	return records, nil
+}
+
+// openFiles opens the rotated files, oldest first, and the current file, returning the size of the
+// current file. The lock is only held while opening, so that the files are not rotated meanwhile,
+// and the records are read without blocking the writes.
+func (s *FileAuditSink) openFiles() ([]*os.File, int64, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var files []*os.File
+	for i := s.maxBackups; i >= 0; i-- {
+		path := s.path
+		if i > 0 {
+			path = fmt.Sprintf("%s.%d", s.path, i)
+		}
+		f, err := os.Open(path)
+		if os.IsNotExist(err) && i > 0 {
+			continue
+		}
+		if err != nil {
+			for _, f := range files {
+				_ = f.Close()
+			}
+			return nil, 0, fmt.Errorf("failed to open the audit log %s: %v", path, err)
+		}
+		files = append(files, f)
+	}
+	return files, s.size, nil
+}
+
+func (s *FileAuditSink) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.file.Close()
+}
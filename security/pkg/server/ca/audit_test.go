@@ -0,0 +1,253 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ca
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/peer"
+
+	pb "istio.io/api/security/v1alpha1"
+	"istio.io/istio/pkg/security"
+	mockca "istio.io/istio/security/pkg/pki/ca/mock"
+	"istio.io/istio/security/pkg/pki/util"
+)
+
+func TestCreateCertificateAudit(t *testing.T) {
+	certPEM, _, err := util.GenCertKeyFromOptions(util.CertOptions{
+		Host:         "spiffe://cluster.local/ns/default/sa/default",
+		NotBefore:    time.Now(),
+		TTL:          time.Hour,
+		IsSelfSigned: true,
+		RSAKeySize:   2048,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := util.ParsePemEncodedCertificate(certPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auditFile := filepath.Join(t.TempDir(), "audit.log")
+	sink, err := NewFileAuditSink(auditFile, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &Server{
+		ca: &mockca.FakeCA{
+			SignedCert:    certPEM,
+			KeyCertBundle: util.NewKeyCertBundleFromPem(nil, nil, []byte("cert_chain"), []byte("root_cert")),
+		},
+		Authenticators: []security.Authenticator{&mockAuthenticator{identities: []string{"spiffe://cluster.local/ns/default/sa/default"}}},
+		monitoring:     newMonitoringMetrics(),
+		AuditLog:       NewAuditLog(10, sink),
+	}
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 50000}})
+	if _, err := server.CreateCertificate(ctx, &pb.IstioCertificateRequest{Csr: "dumb CSR"}); err != nil {
+		t.Fatalf("CreateCertificate error: %v", err)
+	}
+	if err := server.AuditLog.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := server.AuditLog.Query("spiffe://cluster.local/ns/default/sa/default", "", false)
+	if err != nil || len(records) != 1 {
+		t.Fatalf("expected the record of the certificate, got %v %v", records, err)
+	}
+	record := records[0]
+	expected := &AuditRecord{
+		Time:            record.Time,
+		SerialNumber:    cert.SerialNumber.Text(16),
+		SubjectAltNames: []string{"spiffe://cluster.local/ns/default/sa/default"},
+		Requester:       []string{"spiffe://cluster.local/ns/default/sa/default"},
+		Authenticator:   "mockAuthenticator",
+		TTL:             3600,
+		SourceIP:        "10.0.0.1",
+	}
+	if !reflect.DeepEqual(record, expected) {
+		t.Errorf("expected the record %+v, got %+v", expected, record)
+	}
+
+	file, err := os.Open(auditFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	if !scanner.Scan() {
+		t.Fatal("expected the record in the audit log file")
+	}
+	written := &AuditRecord{}
+	if err := json.Unmarshal(scanner.Bytes(), written); err != nil {
+		t.Fatal(err)
+	}
+	if written.SerialNumber != expected.SerialNumber || written.SourceIP != expected.SourceIP {
+		t.Errorf("expected the record %+v in the audit log file, got %+v", expected, written)
+	}
+}
+
+func TestAuditLogQuery(t *testing.T) {
+	l := NewAuditLog(3)
+	for i, r := range []*AuditRecord{
+		{SerialNumber: "1", SubjectAltNames: []string{"spiffe://td/ns/a/sa/a"}},
+		{SerialNumber: "2", SubjectAltNames: []string{"spiffe://td/ns/b/sa/b"}},
+		{SerialNumber: "3", SubjectAltNames: []string{"spiffe://td/ns/a/sa/a"}},
+		{SerialNumber: "0a", SubjectAltNames: []string{"spiffe://td/ns/b/sa/b"}, Requester: []string{"spiffe://td/ns/a/sa/a"}},
+	} {
+		r.Time = time.Unix(int64(i), 0)
+		l.Record(r)
+	}
+
+	serials := func(identity, serial string) []string {
+		t.Helper()
+		records, err := l.Query(identity, serial, false)
+		if err != nil {
+			t.Fatalf("Query(%q, %q) error: %v", identity, serial, err)
+		}
+		serials := []string{}
+		for _, r := range records {
+			serials = append(serials, r.SerialNumber)
+		}
+		return serials
+	}
+	// Only the last 3 records are kept, oldest first.
+	if got := serials("", ""); !reflect.DeepEqual(got, []string{"2", "3", "0a"}) {
+		t.Errorf("unexpected records %v", got)
+	}
+	if got := serials("spiffe://td/ns/a/sa/a", ""); !reflect.DeepEqual(got, []string{"3", "0a"}) {
+		t.Errorf("unexpected records of spiffe://td/ns/a/sa/a %v", got)
+	}
+	if got := serials("", "A"); !reflect.DeepEqual(got, []string{"0a"}) {
+		t.Errorf("unexpected records with serial A %v", got)
+	}
+	if _, err := l.Query("", "not hex", false); err == nil {
+		t.Error("expected an error for an invalid serial")
+	}
+}
+
+func TestFileAuditSinkRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	record := &AuditRecord{SerialNumber: "1"}
+	line, _ := json.Marshal(record)
+	// Each file holds 2 records.
+	sink, err := NewFileAuditSink(path, int64(2*(len(line)+1)), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 7; i++ {
+		if err := sink.Write(record); err != nil {
+			t.Fatalf("Write error: %v", err)
+		}
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for file, size := range map[string]int{path: 1, path + ".1": 2, path + ".2": 2, path + ".3": -1} {
+		info, err := os.Stat(file)
+		if size < 0 {
+			if !os.IsNotExist(err) {
+				t.Errorf("expected only 2 rotated files, got %s", file)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size() != int64(size*(len(line)+1)) {
+			t.Errorf("expected %d records in %s, got %d bytes", size, file, info.Size())
+		}
+	}
+}
+
+func TestFileAuditSinkNoBackups(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	record := &AuditRecord{SerialNumber: "1"}
+	line, _ := json.Marshal(record)
+	// Without backups, the rotated records are still kept in a single rotated file.
+	sink, err := NewFileAuditSink(path, int64(2*(len(line)+1)), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := sink.Write(record); err != nil {
+			t.Fatalf("Write error: %v", err)
+		}
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for file, size := range map[string]int{path: 1, path + ".1": 2} {
+		info, err := os.Stat(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size() != int64(size*(len(line)+1)) {
+			t.Errorf("expected %d records in %s, got %d bytes", size, file, info.Size())
+		}
+	}
+}
+
+func TestAuditLogQueryFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	line, _ := json.Marshal(&AuditRecord{SerialNumber: "1", SubjectAltNames: []string{"spiffe://td/ns/a/sa/a"}})
+	// Each file holds 2 records, and only the last record is kept in memory.
+	sink, err := NewFileAuditSink(path, int64(2*(len(line)+1)), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := NewAuditLog(1, sink)
+	defer l.Close()
+	for i, r := range []*AuditRecord{
+		{SerialNumber: "1", SubjectAltNames: []string{"spiffe://td/ns/a/sa/a"}},
+		{SerialNumber: "2", SubjectAltNames: []string{"spiffe://td/ns/b/sa/b"}},
+		{SerialNumber: "3", SubjectAltNames: []string{"spiffe://td/ns/a/sa/a"}},
+		{SerialNumber: "4", SubjectAltNames: []string{"spiffe://td/ns/a/sa/a"}},
+		{SerialNumber: "5", SubjectAltNames: []string{"spiffe://td/ns/b/sa/b"}},
+	} {
+		r.Time = time.Unix(int64(i), 0).UTC()
+		l.Record(r)
+	}
+
+	serials := func(identity string, all bool) []string {
+		t.Helper()
+		records, err := l.Query(identity, "", all)
+		if err != nil {
+			t.Fatalf("Query(%q, %v) error: %v", identity, all, err)
+		}
+		serials := []string{}
+		for _, r := range records {
+			serials = append(serials, r.SerialNumber)
+		}
+		return serials
+	}
+	if got := serials("spiffe://td/ns/a/sa/a", false); !reflect.DeepEqual(got, []string{}) {
+		t.Errorf("unexpected recent records %v", got)
+	}
+	// The rotated files are searched, oldest first.
+	if got := serials("spiffe://td/ns/a/sa/a", true); !reflect.DeepEqual(got, []string{"1", "3", "4"}) {
+		t.Errorf("unexpected records in the files %v", got)
+	}
+	if got := serials("", true); !reflect.DeepEqual(got, []string{"1", "2", "3", "4", "5"}) {
+		t.Errorf("unexpected records in the files %v", got)
+	}
+}
@@ -0,0 +1,196 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authenticate
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"istio.io/istio/pkg/security"
+	"istio.io/istio/security/pkg/credentialfetcher/plugin"
+)
+
+const (
+	AWSIdentityAuthenticatorType = "AWSIdentityAuthenticator"
+
+	// awsClockSkew is the tolerated skew between the clocks of Istiod and of the VMs signing the requests.
+	awsClockSkew = 5 * time.Minute
+	// maxSTSResponseSize bounds the responses read from STS.
+	maxSTSResponseSize = 1 << 16
+)
+
+// stsHost matches the global, regional and FIPS endpoints of STS, which are the only hosts the presigned
+// requests are sent to.
+var stsHost = regexp.MustCompile(`^sts(-fips)?(\.[a-z0-9-]+)?\.amazonaws\.com(\.cn)?$`)
+
+// assumedRoleARN matches the ARNs of the sessions of IAM roles, such as the instance role of an EC2 VM.
+var assumedRoleARN = regexp.MustCompile(`^arn:(aws[a-z-]*):sts::([0-9]{12}):assumed-role/([^/]+)/.+$`)
+
+// AWSIdentityAuthenticator authenticates VMs with the STS GetCallerIdentity requests presigned by the
+// AmazonEC2 credential fetcher of their agent. The requests are sent to STS, which returns the IAM role
+// of the VM, so the credentials expire with the signature of the requests.
+type AWSIdentityAuthenticator struct {
+	trustDomain string
+	// identities is keyed by IAM role ARN, e.g. "arn:aws:iam::123456789012:role/my-role", or by the ARN of
+	// other IAM principals.
+	identities PlatformIdentities
+
+	client *http.Client
+	// endpoint overrides the address the requests are sent to, for testing.
+	endpoint string
+	now      func() time.Time
+}
+
+var _ security.Authenticator = &AWSIdentityAuthenticator{}
+
+// NewAWSIdentityAuthenticator creates an authenticator of presigned STS GetCallerIdentity requests.
+func NewAWSIdentityAuthenticator(identities PlatformIdentities, trustDomain string) *AWSIdentityAuthenticator {
+	return &AWSIdentityAuthenticator{
+		trustDomain: trustDomain,
+		identities:  identities,
+		client: &http.Client{
+			Timeout: 5 * time.Second,
+			// STS does not redirect, and following a redirect would send the request elsewhere.
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		now: time.Now,
+	}
+}
+
+type getCallerIdentityResponse struct {
+	Result struct {
+		Arn     string `xml:"Arn"`
+		Account string `xml:"Account"`
+	} `xml:"GetCallerIdentityResult"`
+}
+
+// Authenticate sends the presigned request in the bearer token to STS, and returns the identity mapped
+// to the IAM principal which signed it.
+func (a *AWSIdentityAuthenticator) Authenticate(ctx context.Context) (*security.Caller, error) {
+	bearerToken, err := security.ExtractBearerToken(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("ID token extraction error: %v", err)
+	}
+	u, err := plugin.DecodeAWSCallerIdentity(bearerToken)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.validateRequest(u); err != nil {
+		return nil, fmt.Errorf("invalid AWS caller identity request: %v", err)
+	}
+	arn, err := a.callerIdentity(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	id, err := a.identities.identity(a.trustDomain, principal(arn))
+	if err != nil {
+		return nil, err
+	}
+	return &security.Caller{
+		AuthSource: security.AuthSourceIDToken,
+		Identities: []string{id},
+	}, nil
+}
+
+// validateRequest checks the presigned request is a fresh GetCallerIdentity request to STS, signed for
+// the trust domain of Istiod.
+func (a *AWSIdentityAuthenticator) validateRequest(u *url.URL) error {
+	if u.Scheme != "https" || u.Port() != "" || !stsHost.MatchString(u.Hostname()) {
+		return fmt.Errorf("%s is not an STS endpoint", u.Host)
+	}
+	q := u.Query()
+	if q.Get("Action") != "GetCallerIdentity" {
+		return fmt.Errorf("unexpected action %q", q.Get("Action"))
+	}
+	if !strings.Contains(";"+q.Get("X-Amz-SignedHeaders")+";", ";"+strings.ToLower(plugin.AWSServerIDHeader)+";") {
+		return fmt.Errorf("the request is not signed for an Istiod")
+	}
+	date, err := time.Parse("20060102T150405Z", q.Get("X-Amz-Date"))
+	if err != nil {
+		return fmt.Errorf("invalid signing date: %v", err)
+	}
+	expires, err := strconv.Atoi(q.Get("X-Amz-Expires"))
+	if err != nil {
+		return fmt.Errorf("invalid expiry: %v", err)
+	}
+	if validity := time.Duration(expires) * time.Second; validity <= 0 || validity > plugin.AWSCredentialExpiry {
+		return fmt.Errorf("the validity %v exceeds %v", validity, plugin.AWSCredentialExpiry)
+	}
+	now := a.now()
+	if date.After(now.Add(awsClockSkew)) {
+		return fmt.Errorf("the request is signed in the future")
+	}
+	if now.After(date.Add(time.Duration(expires) * time.Second)) {
+		return fmt.Errorf("the request expired")
+	}
+	return nil
+}
+
+// callerIdentity sends the request to STS, and returns the ARN of the caller.
+func (a *AWSIdentityAuthenticator) callerIdentity(ctx context.Context, u *url.URL) (string, error) {
+	target := u.String()
+	if a.endpoint != "" {
+		target = a.endpoint + "?" + u.RawQuery
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Host = u.Host
+	req.Header.Set(plugin.AWSServerIDHeader, a.trustDomain)
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to get the AWS caller identity: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxSTSResponseSize))
+	if err != nil {
+		return "", fmt.Errorf("failed to read the AWS caller identity: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("the AWS caller identity is rejected by STS with status %d", resp.StatusCode)
+	}
+	identity := &getCallerIdentityResponse{}
+	if err := xml.Unmarshal(body, identity); err != nil {
+		return "", fmt.Errorf("failed to parse the AWS caller identity: %v", err)
+	}
+	if identity.Result.Arn == "" {
+		return "", fmt.Errorf("no ARN in the AWS caller identity")
+	}
+	return identity.Result.Arn, nil
+}
+
+// principal returns the ARN of the IAM role of a role session, or the ARN of other IAM principals.
+func principal(arn string) string {
+	if m := assumedRoleARN.FindStringSubmatch(arn); m != nil {
+		return fmt.Sprintf("arn:%s:iam::%s:role/%s", m[1], m[2], m[3])
+	}
+	return arn
+}
+
+func (a *AWSIdentityAuthenticator) AuthenticatorType() string {
+	return AWSIdentityAuthenticatorType
+}
@@ -0,0 +1,165 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authenticate
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/metadata"
+
+	"istio.io/istio/pkg/security"
+	"istio.io/istio/security/pkg/credentialfetcher/plugin"
+)
+
+const awsCallerIdentityResponse = `<GetCallerIdentityResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <GetCallerIdentityResult>
+    <Arn>%s</Arn>
+    <UserId>AROAEXAMPLE:i-0000000000000001</UserId>
+    <Account>123456789012</Account>
+  </GetCallerIdentityResult>
+</GetCallerIdentityResponse>`
+
+// presignedRequest returns a credential carrying a request to host signed at date, for the expiry and
+// signed headers. The signature itself is verified by the fake STS server, by its value.
+func presignedRequest(host string, date time.Time, expires int, signedHeaders, signature string) string {
+	q := url.Values{}
+	q.Set("Action", "GetCallerIdentity")
+	q.Set("Version", "2011-06-15")
+	q.Set("X-Amz-Algorithm", "AWS4-HMAC-SHA256")
+	q.Set("X-Amz-Date", date.UTC().Format("20060102T150405Z"))
+	q.Set("X-Amz-Expires", fmt.Sprint(expires))
+	q.Set("X-Amz-SignedHeaders", signedHeaders)
+	q.Set("X-Amz-Signature", signature)
+	return plugin.EncodeAWSCallerIdentity("https://" + host + "/?" + q.Encode())
+}
+
+func TestAWSIdentityAuthenticate(t *testing.T) {
+	// The fake STS server returns the ARN keyed by the signature of the request, if it is sent with the
+	// server ID of the authenticator.
+	arns := map[string]string{
+		"role":    "arn:aws:sts::123456789012:assumed-role/web/i-0000000000000001",
+		"other":   "arn:aws:sts::123456789012:assumed-role/other/i-0000000000000002",
+		"user":    "arn:aws:iam::123456789012:user/admin",
+		"invalid": "",
+	}
+	sts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		arn, f := arns[r.URL.Query().Get("X-Amz-Signature")]
+		if !f || r.Header.Get(plugin.AWSServerIDHeader) != "cluster.local" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		_, _ = fmt.Fprintf(w, awsCallerIdentityResponse, arn)
+	}))
+	defer sts.Close()
+
+	authenticator := NewAWSIdentityAuthenticator(PlatformIdentities{
+		"arn:aws:iam::123456789012:role/web":   "vm/web",
+		"arn:aws:iam::123456789012:user/admin": "vm/admin",
+	}, "cluster.local")
+	authenticator.endpoint = sts.URL
+	now := time.Now()
+	authenticator.now = func() time.Time { return now }
+
+	signed := "host;x-istio-server-id"
+	tests := map[string]struct {
+		token      string
+		expectErr  bool
+		expectedID string
+	}{
+		"No bearer token": {
+			expectErr: true,
+		},
+		"Not a caller identity": {
+			token:     "header.payload.signature",
+			expectErr: true,
+		},
+		"Role identity": {
+			token:      presignedRequest("sts.amazonaws.com", now.Add(-time.Minute), 900, signed, "role"),
+			expectedID: "spiffe://cluster.local/ns/vm/sa/web",
+		},
+		"Regional endpoint": {
+			token:      presignedRequest("sts.us-west-2.amazonaws.com", now, 900, signed, "role"),
+			expectedID: "spiffe://cluster.local/ns/vm/sa/web",
+		},
+		"User identity": {
+			token:      presignedRequest("sts.amazonaws.com", now, 900, signed, "user"),
+			expectedID: "spiffe://cluster.local/ns/vm/sa/admin",
+		},
+		"Unmapped role": {
+			token:     presignedRequest("sts.amazonaws.com", now, 900, signed, "other"),
+			expectErr: true,
+		},
+		"Rejected by STS": {
+			token:     presignedRequest("sts.amazonaws.com", now, 900, signed, "forged"),
+			expectErr: true,
+		},
+		"No ARN": {
+			token:     presignedRequest("sts.amazonaws.com", now, 900, signed, "invalid"),
+			expectErr: true,
+		},
+		"Not STS": {
+			token:     presignedRequest("attacker.example.com", now, 900, signed, "role"),
+			expectErr: true,
+		},
+		"Not signed for Istiod": {
+			token:     presignedRequest("sts.amazonaws.com", now, 900, "host", "role"),
+			expectErr: true,
+		},
+		"Expired": {
+			token:     presignedRequest("sts.amazonaws.com", now.Add(-16*time.Minute), 900, signed, "role"),
+			expectErr: true,
+		},
+		"Long validity": {
+			token:     presignedRequest("sts.amazonaws.com", now, 7*24*3600, signed, "role"),
+			expectErr: true,
+		},
+		"Signed in the future": {
+			token:     presignedRequest("sts.amazonaws.com", now.Add(time.Hour), 900, signed, "role"),
+			expectErr: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			md := metadata.MD{}
+			if tc.token != "" {
+				md.Append("authorization", bearerTokenPrefix+tc.token)
+			}
+			ctx := metadata.NewIncomingContext(context.Background(), md)
+
+			actualCaller, err := authenticator.Authenticate(ctx)
+			if gotErr := err != nil; gotErr != tc.expectErr {
+				t.Fatalf("gotErr (%v) whereas expectErr (%v)", err, tc.expectErr)
+			}
+			if tc.expectErr {
+				return
+			}
+			expectedCaller := &security.Caller{
+				AuthSource: security.AuthSourceIDToken,
+				Identities: []string{tc.expectedID},
+			}
+			if !reflect.DeepEqual(actualCaller, expectedCaller) {
+				t.Errorf("unexpected caller (want %v but got %v)", expectedCaller, actualCaller)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authenticate
+
+import (
+	"context"
+	"fmt"
+
+	oidc "github.com/coreos/go-oidc"
+
+	"istio.io/api/security/v1beta1"
+	"istio.io/istio/pkg/security"
+)
+
+const (
+	AzureIdentityAuthenticatorType = "AzureIdentityAuthenticator"
+)
+
+// AzureIdentityAuthenticator authenticates Azure VMs with the managed identity tokens fetched by the
+// AzureVM credential fetcher of their agent.
+type AzureIdentityAuthenticator struct {
+	trustDomain string
+	audiences   []string
+	verifier    *oidc.IDTokenVerifier
+	// identities is keyed by the resource ID or the object ID of the managed identity.
+	identities PlatformIdentities
+}
+
+var _ security.Authenticator = &AzureIdentityAuthenticator{}
+
+// azureClaims are the claims of Azure AD tokens identifying a managed identity.
+type azureClaims struct {
+	// ObjectID is the object ID of the service principal of the managed identity.
+	ObjectID string `json:"oid"`
+	// ResourceID is the resource ID of the managed identity.
+	ResourceID string `json:"xms_mirid"`
+}
+
+// NewAzureIdentityAuthenticator creates an authenticator of the managed identity tokens issued by the
+// Azure AD tenant of jwtRule, e.g. "https://sts.windows.net/<tenant ID>/".
+func NewAzureIdentityAuthenticator(jwtRule *v1beta1.JWTRule, identities PlatformIdentities,
+	trustDomain string) (*AzureIdentityAuthenticator, error) {
+	verifier, err := newVerifier(jwtRule)
+	if err != nil {
+		return nil, err
+	}
+	return &AzureIdentityAuthenticator{
+		trustDomain: trustDomain,
+		audiences:   jwtRule.Audiences,
+		verifier:    verifier,
+		identities:  identities,
+	}, nil
+}
+
+// Authenticate verifies the managed identity token in the bearer token, and returns the identity mapped
+// to the managed identity.
+func (a *AzureIdentityAuthenticator) Authenticate(ctx context.Context) (*security.Caller, error) {
+	bearerToken, err := security.ExtractBearerToken(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("ID token extraction error: %v", err)
+	}
+	idToken, err := a.verifier.Verify(ctx, bearerToken)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify the managed identity token (error %v)", err)
+	}
+	// Azure AD sets "aud" to the single resource the token is requested for.
+	if !checkAudience(idToken.Audience, a.audiences) {
+		return nil, fmt.Errorf("invalid audiences %v", idToken.Audience)
+	}
+	claims := &azureClaims{}
+	if err := idToken.Claims(claims); err != nil {
+		return nil, fmt.Errorf("failed to extract claims from the managed identity token: %v", err)
+	}
+	var platformIdentities []string
+	if claims.ResourceID != "" {
+		platformIdentities = append(platformIdentities, claims.ResourceID)
+	}
+	if claims.ObjectID != "" {
+		platformIdentities = append(platformIdentities, claims.ObjectID)
+	}
+	id, err := a.identities.identity(a.trustDomain, platformIdentities...)
+	if err != nil {
+		return nil, err
+	}
+	return &security.Caller{
+		AuthSource: security.AuthSourceIDToken,
+		Identities: []string{id},
+	}, nil
+}
+
+func (a *AzureIdentityAuthenticator) AuthenticatorType() string {
+	return AzureIdentityAuthenticatorType
+}
@@ -0,0 +1,121 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authenticate
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/metadata"
+	jose "gopkg.in/square/go-jose.v2"
+
+	"istio.io/api/security/v1beta1"
+	"istio.io/istio/pkg/security"
+)
+
+func TestAzureIdentityAuthenticate(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate a private key: %v", err)
+	}
+	key := jose.JSONWebKey{Algorithm: string(jose.RS256), Key: rsaKey}
+	keySet := jose.JSONWebKeySet{}
+	keySet.Keys = append(keySet.Keys, key.Public())
+	server := httptest.NewServer(&jwksServer{key: keySet, t: t})
+	defer server.Close()
+
+	resourceID := "/subscriptions/sub/resourcegroups/rg/providers/Microsoft.ManagedIdentity/userAssignedIdentities/reviews"
+	authenticator, err := NewAzureIdentityAuthenticator(
+		&v1beta1.JWTRule{Issuer: server.URL, JwksUri: server.URL, Audiences: []string{"api://cluster.local"}},
+		PlatformIdentities{
+			resourceID:                             "bookinfo/reviews",
+			"11111111-1111-1111-1111-111111111111": "bookinfo/ratings",
+		}, "cluster.local")
+	if err != nil {
+		t.Fatalf("failed to create the Azure authenticator: %v", err)
+	}
+
+	token := func(aud, oid, mirid string, exp time.Time) string {
+		claims := fmt.Sprintf(`{"iss": %q, "aud": %q, "sub": %q, "oid": %q, "xms_mirid": %q, "exp": %d}`,
+			server.URL, aud, oid, oid, mirid, exp.Unix())
+		jwt, err := generateJWT(&key, []byte(claims))
+		if err != nil {
+			t.Fatalf("failed to generate JWT: %v", err)
+		}
+		return jwt
+	}
+	valid := time.Now().Add(time.Hour)
+
+	tests := map[string]struct {
+		token      string
+		expectErr  bool
+		expectedID string
+	}{
+		"No bearer token": {
+			expectErr: true,
+		},
+		"Identity resource ID": {
+			token:      token("api://cluster.local", "22222222-2222-2222-2222-222222222222", resourceID, valid),
+			expectedID: "spiffe://cluster.local/ns/bookinfo/sa/reviews",
+		},
+		"Identity object ID": {
+			token:      token("api://cluster.local", "11111111-1111-1111-1111-111111111111", "", valid),
+			expectedID: "spiffe://cluster.local/ns/bookinfo/sa/ratings",
+		},
+		"Unmapped identity": {
+			token:     token("api://cluster.local", "33333333-3333-3333-3333-333333333333", "", valid),
+			expectErr: true,
+		},
+		"Wrong audience": {
+			token:     token("https://management.azure.com/", "11111111-1111-1111-1111-111111111111", "", valid),
+			expectErr: true,
+		},
+		"Expired token": {
+			token:     token("api://cluster.local", "11111111-1111-1111-1111-111111111111", "", time.Now().Add(-time.Hour)),
+			expectErr: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			md := metadata.MD{}
+			if tc.token != "" {
+				md.Append("authorization", bearerTokenPrefix+tc.token)
+			}
+			ctx := metadata.NewIncomingContext(context.Background(), md)
+
+			actualCaller, err := authenticator.Authenticate(ctx)
+			if gotErr := err != nil; gotErr != tc.expectErr {
+				t.Fatalf("gotErr (%v) whereas expectErr (%v)", err, tc.expectErr)
+			}
+			if tc.expectErr {
+				return
+			}
+			expectedCaller := &security.Caller{
+				AuthSource: security.AuthSourceIDToken,
+				Identities: []string{tc.expectedID},
+			}
+			if !reflect.DeepEqual(actualCaller, expectedCaller) {
+				t.Errorf("unexpected caller (want %v but got %v)", expectedCaller, actualCaller)
+			}
+		})
+	}
+}
@@ -14,7 +14,48 @@
 
 package authenticate
 
+import (
+	"fmt"
+	"strings"
+)
+
 const (
 	// IdentityTemplate is the SPIFFE format template of the identity.
 	IdentityTemplate = "spiffe://%s/ns/%s/sa/%s"
 )
+
+// PlatformIdentities maps the identities given to VMs by their platform, such as an AWS account or an
+// Azure managed identity, to the "<namespace>/<service account>" of the workloads running on them.
+type PlatformIdentities map[string]string
+
+// ParsePlatformIdentities parses a comma separated list of "<platform identity>=<namespace>/<service account>".
+func ParsePlatformIdentities(mapping string) (PlatformIdentities, error) {
+	identities := PlatformIdentities{}
+	for _, entry := range strings.Split(mapping, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		kv := strings.SplitN(entry, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("invalid platform identity mapping %q", entry)
+		}
+		nsSA := strings.Split(kv[1], "/")
+		if len(nsSA) != 2 || nsSA[0] == "" || nsSA[1] == "" {
+			return nil, fmt.Errorf("invalid namespace and service account in %q, expected <namespace>/<service account>", entry)
+		}
+		identities[kv[0]] = kv[1]
+	}
+	return identities, nil
+}
+
+// identity returns the SPIFFE identity mapped to the first of the platform identities found.
+func (p PlatformIdentities) identity(trustDomain string, platformIdentities ...string) (string, error) {
+	for _, id := range platformIdentities {
+		if nsSA, ok := p[id]; ok {
+			parts := strings.Split(nsSA, "/")
+			return fmt.Sprintf(IdentityTemplate, trustDomain, parts[0], parts[1]), nil
+		}
+	}
+	return "", fmt.Errorf("no workload identity is mapped to %v", platformIdentities)
+}
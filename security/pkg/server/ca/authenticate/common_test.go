@@ -16,6 +16,7 @@ package authenticate
 
 import (
 	"context"
+	"reflect"
 	"testing"
 
 	"google.golang.org/grpc/metadata"
@@ -86,3 +87,27 @@ func TestExtractBearerToken(t *testing.T) {
 		}
 	}
 }
+
+func TestParsePlatformIdentities(t *testing.T) {
+	identities, err := ParsePlatformIdentities("123456789012=vm/default, 123456789012/i-0001=vm/special,")
+	if err != nil {
+		t.Fatalf("failed to parse the platform identities: %v", err)
+	}
+	expected := PlatformIdentities{"123456789012": "vm/default", "123456789012/i-0001": "vm/special"}
+	if !reflect.DeepEqual(identities, expected) {
+		t.Errorf("expected %v, got %v", expected, identities)
+	}
+	if id, err := identities.identity("cluster.local", "123456789012/i-0001", "123456789012"); err != nil ||
+		id != "spiffe://cluster.local/ns/vm/sa/special" {
+		t.Errorf("unexpected identity %q (%v)", id, err)
+	}
+	if _, err := identities.identity("cluster.local", "210987654321"); err == nil {
+		t.Error("expected an error for an unmapped identity")
+	}
+
+	for _, invalid := range []string{"123456789012", "=vm/default", "123456789012=vm", "123456789012=vm/a/b", "123456789012=/sa"} {
+		if _, err := ParsePlatformIdentities(invalid); err == nil {
+			t.Errorf("expected an error parsing %q", invalid)
+		}
+	}
+}
@@ -41,6 +41,19 @@ var _ security.Authenticator = &JwtAuthenticator{}
 // K8S is created with --service-account-issuer, service-account-signing-key-file and service-account-api-audiences
 // which enable OIDC.
 func NewJwtAuthenticator(jwtRule *v1beta1.JWTRule, trustDomain string) (*JwtAuthenticator, error) {
+	verifier, err := newVerifier(jwtRule)
+	if err != nil {
+		return nil, err
+	}
+	return &JwtAuthenticator{
+		trustDomain: trustDomain,
+		verifier:    verifier,
+		audiences:   jwtRule.Audiences,
+	}, nil
+}
+
+// newVerifier returns the verifier of the tokens of the issuer of jwtRule.
+func newVerifier(jwtRule *v1beta1.JWTRule) (*oidc.IDTokenVerifier, error) {
 	issuer := jwtRule.GetIssuer()
 	jwksURL := jwtRule.GetJwksUri()
 	// The key of a JWT issuer may change, so the key may need to be updated.
@@ -60,11 +73,7 @@ func NewJwtAuthenticator(jwtRule *v1beta1.JWTRule, trustDomain string) (*JwtAuth
 		keySet := oidc.NewRemoteKeySet(context.Background(), jwksURL)
 		verifier = oidc.NewVerifier(issuer, keySet, &oidc.Config{SkipClientIDCheck: true})
 	}
-	return &JwtAuthenticator{
-		trustDomain: trustDomain,
-		verifier:    verifier,
-		audiences:   jwtRule.Audiences,
-	}, nil
+	return verifier, nil
 }
 
 // Authenticate - based on the old OIDC authenticator for mesh expansion.
@@ -0,0 +1,227 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ca
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"sigs.k8s.io/yaml"
+
+	"istio.io/istio/pkg/security"
+	"istio.io/istio/pkg/spiffe"
+)
+
+// Key types of the CSRs, as set in CSRPolicy.AllowedKeyTypes.
+const (
+	KeyTypeRSA     = "RSA"
+	KeyTypeECDSA   = "ECDSA"
+	KeyTypeED25519 = "ED25519"
+)
+
+var keyTypes = map[x509.PublicKeyAlgorithm]string{
+	x509.RSA:     KeyTypeRSA,
+	x509.ECDSA:   KeyTypeECDSA,
+	x509.Ed25519: KeyTypeED25519,
+}
+
+// Duration is a time.Duration encoded as a string such as "1h" in the CSR policies.
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("invalid duration %s: %v", b, err)
+	}
+	duration, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(duration)
+	return nil
+}
+
+// CSRPolicy restricts the certificates the CA server issues to the workloads of a namespace.
+type CSRPolicy struct {
+	// AllowedSANs are the patterns, in the syntax of path.Match, of the SANs of the certificates, such
+	// as spiffe://cluster.local/ns/istio-system/sa/* or *.example.com. If empty, any identity of the
+	// caller is allowed.
+	AllowedSANs []string `json:"allowedSANs,omitempty"`
+	// MaxTTL is the maximum TTL of the certificates, the TTL of the certificates requested without one
+	// or with a longer one. If zero, the TTL is only limited by the CA.
+	MaxTTL Duration `json:"maxTTL,omitempty"`
+	// AllowedKeyTypes are the types of the keys of the CSRs, RSA, ECDSA or ED25519. If empty, any type
+	// is allowed.
+	AllowedKeyTypes []string `json:"allowedKeyTypes,omitempty"`
+	// AllowDNSSANs allows the DNS SANs of the CSRs matching AllowedSANs to be added to the certificates,
+	// such as for ingress gateways. Otherwise the CSRs with DNS SANs are denied.
+	AllowDNSSANs bool `json:"allowDNSSANs,omitempty"`
+}
+
+// CSRPolicies are the policies of the CSRs of each namespace.
+type CSRPolicies struct {
+	// Default is the policy of the namespaces without one. If nil, the CSRs of these namespaces are
+	// not restricted.
+	Default *CSRPolicy `json:"default,omitempty"`
+	// Namespaces are the policies of the namespaces.
+	Namespaces map[string]*CSRPolicy `json:"namespaces,omitempty"`
+}
+
+// ParseCSRPolicies parses and validates the CSR policies in YAML or JSON.
+func ParseCSRPolicies(b []byte) (*CSRPolicies, error) {
+	policies := &CSRPolicies{}
+	if err := yaml.UnmarshalStrict(b, policies); err != nil {
+		return nil, fmt.Errorf("failed to parse the CSR policies: %v", err)
+	}
+	if err := policies.Default.validate(); err != nil {
+		return nil, fmt.Errorf("invalid default CSR policy: %v", err)
+	}
+	for ns, policy := range policies.Namespaces {
+		if err := policy.validate(); err != nil {
+			return nil, fmt.Errorf("invalid CSR policy of namespace %s: %v", ns, err)
+		}
+	}
+	return policies, nil
+}
+
+func (p *CSRPolicy) validate() error {
+	if p == nil {
+		return nil
+	}
+	for _, pattern := range p.AllowedSANs {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid SAN pattern %q: %v", pattern, err)
+		}
+	}
+	if p.MaxTTL < 0 {
+		return fmt.Errorf("negative max TTL %v", time.Duration(p.MaxTTL))
+	}
+	for _, keyType := range p.AllowedKeyTypes {
+		switch strings.ToUpper(keyType) {
+		case KeyTypeRSA, KeyTypeECDSA, KeyTypeED25519:
+		default:
+			return fmt.Errorf("unknown key type %q", keyType)
+		}
+	}
+	return nil
+}
+
+// CSRAuthorizer authorizes the CSRs according to the CSR policies of the namespaces of the callers.
+// The policies can be updated while the CA server is running.
+type CSRAuthorizer struct {
+	mutex    sync.RWMutex
+	policies *CSRPolicies
+}
+
+// NewCSRAuthorizer returns a CSRAuthorizer with the policies.
+func NewCSRAuthorizer(policies *CSRPolicies) *CSRAuthorizer {
+	return &CSRAuthorizer{policies: policies}
+}
+
+// SetPolicies replaces the policies of the authorizer.
+func (a *CSRAuthorizer) SetPolicies(policies *CSRPolicies) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.policies = policies
+}
+
+// policy returns the policy of the namespace of the first SPIFFE identity of caller, or the default
+// policy.
+func (a *CSRAuthorizer) policy(caller *security.Caller) *CSRPolicy {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	if a.policies == nil {
+		return nil
+	}
+	for _, identity := range caller.Identities {
+		id, err := spiffe.ParseIdentity(identity)
+		if err != nil {
+			continue
+		}
+		if policy, ok := a.policies.Namespaces[id.Namespace]; ok {
+			return policy
+		}
+		break
+	}
+	return a.policies.Default
+}
+
+// Authorize evaluates the policy of caller for csr, requested with ttl. It returns the SANs and the
+// TTL of the certificate to issue, or an error if the CSR is denied.
+func (a *CSRAuthorizer) Authorize(caller *security.Caller, csr *x509.CertificateRequest, ttl time.Duration) (
+	[]string, time.Duration, error) {
+	policy := a.policy(caller)
+	if policy == nil {
+		return caller.Identities, ttl, nil
+	}
+
+	if len(policy.AllowedKeyTypes) > 0 {
+		keyType, ok := keyTypes[csr.PublicKeyAlgorithm]
+		if !ok || !containsFold(policy.AllowedKeyTypes, keyType) {
+			return nil, 0, fmt.Errorf("key type %v is not allowed", csr.PublicKeyAlgorithm)
+		}
+	}
+
+	if policy.MaxTTL > 0 && (ttl <= 0 || ttl > time.Duration(policy.MaxTTL)) {
+		ttl = time.Duration(policy.MaxTTL)
+	}
+
+	sans := make([]string, 0, len(caller.Identities)+len(csr.DNSNames))
+	for _, identity := range caller.Identities {
+		if len(policy.AllowedSANs) > 0 && !matchesAny(policy.AllowedSANs, identity) {
+			return nil, 0, fmt.Errorf("identity %s is not allowed", identity)
+		}
+		sans = append(sans, identity)
+	}
+	for _, dnsName := range csr.DNSNames {
+		if !policy.AllowDNSSANs {
+			return nil, 0, fmt.Errorf("DNS SANs are not allowed")
+		}
+		if !matchesAny(policy.AllowedSANs, dnsName) {
+			return nil, 0, fmt.Errorf("DNS SAN %s is not allowed", dnsName)
+		}
+		if !contains(sans, dnsName) {
+			sans = append(sans, dnsName)
+		}
+	}
+	return sans, ttl, nil
+}
+
+func matchesAny(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, value); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,167 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ca
+
+import (
+	"crypto/x509"
+	"reflect"
+	"testing"
+	"time"
+
+	"istio.io/istio/pkg/security"
+)
+
+const testCSRPolicies = `
+default:
+  maxTTL: 24h
+namespaces:
+  istio-ingress:
+    allowDNSSANs: true
+    allowedSANs:
+    - spiffe://cluster.local/ns/istio-ingress/sa/*
+    - "*.example.com"
+  payments:
+    maxTTL: 1h
+    allowedKeyTypes: [ECDSA]
+    allowedSANs:
+    - spiffe://cluster.local/ns/payments/sa/api
+`
+
+func TestParseCSRPolicies(t *testing.T) {
+	policies, err := ParseCSRPolicies([]byte(testCSRPolicies))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if policies.Default == nil || policies.Default.MaxTTL != Duration(24*time.Hour) {
+		t.Errorf("unexpected default policy %+v", policies.Default)
+	}
+	if len(policies.Namespaces) != 2 || !policies.Namespaces["istio-ingress"].AllowDNSSANs {
+		t.Errorf("unexpected namespace policies %+v", policies.Namespaces)
+	}
+
+	for _, invalid := range []string{
+		"default:\n  maxTTL: 1 hour",
+		"default:\n  maxTTL: -1h",
+		"default:\n  allowedKeyTypes: [DSA]",
+		"namespaces:\n  foo:\n    allowedSANs: ['[']",
+		"namespaces:\n  foo:\n    unknown: true",
+	} {
+		if _, err := ParseCSRPolicies([]byte(invalid)); err == nil {
+			t.Errorf("expected an error for the policies %q", invalid)
+		}
+	}
+}
+
+func TestCSRAuthorizer(t *testing.T) {
+	policies, err := ParseCSRPolicies([]byte(testCSRPolicies))
+	if err != nil {
+		t.Fatal(err)
+	}
+	authorizer := NewCSRAuthorizer(policies)
+
+	cases := []struct {
+		name         string
+		identity     string
+		csr          *x509.CertificateRequest
+		ttl          time.Duration
+		expectedSANs []string
+		expectedTTL  time.Duration
+		expectErr    bool
+	}{
+		{
+			name:         "default policy limits the TTL",
+			identity:     "spiffe://cluster.local/ns/default/sa/default",
+			csr:          &x509.CertificateRequest{PublicKeyAlgorithm: x509.RSA},
+			ttl:          48 * time.Hour,
+			expectedSANs: []string{"spiffe://cluster.local/ns/default/sa/default"},
+			expectedTTL:  24 * time.Hour,
+		},
+		{
+			name:         "default policy sets the TTL",
+			identity:     "spiffe://cluster.local/ns/default/sa/default",
+			csr:          &x509.CertificateRequest{PublicKeyAlgorithm: x509.RSA},
+			expectedSANs: []string{"spiffe://cluster.local/ns/default/sa/default"},
+			expectedTTL:  24 * time.Hour,
+		},
+		{
+			name:      "default policy denies DNS SANs",
+			identity:  "spiffe://cluster.local/ns/default/sa/default",
+			csr:       &x509.CertificateRequest{PublicKeyAlgorithm: x509.RSA, DNSNames: []string{"foo.example.com"}},
+			expectErr: true,
+		},
+		{
+			name:     "allowed DNS SANs",
+			identity: "spiffe://cluster.local/ns/istio-ingress/sa/gateway",
+			csr: &x509.CertificateRequest{
+				PublicKeyAlgorithm: x509.ECDSA,
+				DNSNames:           []string{"foo.example.com", "bar.example.com"},
+			},
+			ttl:          48 * time.Hour,
+			expectedSANs: []string{"spiffe://cluster.local/ns/istio-ingress/sa/gateway", "foo.example.com", "bar.example.com"},
+			expectedTTL:  48 * time.Hour,
+		},
+		{
+			name:      "DNS SAN not matching the patterns",
+			identity:  "spiffe://cluster.local/ns/istio-ingress/sa/gateway",
+			csr:       &x509.CertificateRequest{PublicKeyAlgorithm: x509.ECDSA, DNSNames: []string{"foo.example.org"}},
+			expectErr: true,
+		},
+		{
+			name:         "allowed key type",
+			identity:     "spiffe://cluster.local/ns/payments/sa/api",
+			csr:          &x509.CertificateRequest{PublicKeyAlgorithm: x509.ECDSA},
+			ttl:          2 * time.Hour,
+			expectedSANs: []string{"spiffe://cluster.local/ns/payments/sa/api"},
+			expectedTTL:  time.Hour,
+		},
+		{
+			name:      "denied key type",
+			identity:  "spiffe://cluster.local/ns/payments/sa/api",
+			csr:       &x509.CertificateRequest{PublicKeyAlgorithm: x509.RSA},
+			expectErr: true,
+		},
+		{
+			name:      "denied identity",
+			identity:  "spiffe://cluster.local/ns/payments/sa/batch",
+			csr:       &x509.CertificateRequest{PublicKeyAlgorithm: x509.ECDSA},
+			expectErr: true,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			sans, ttl, err := authorizer.Authorize(&security.Caller{Identities: []string{c.identity}}, c.csr, c.ttl)
+			if c.expectErr {
+				if err == nil {
+					t.Fatalf("expected the CSR to be denied, got SANs %v", sans)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Authorize error: %v", err)
+			}
+			if !reflect.DeepEqual(sans, c.expectedSANs) || ttl != c.expectedTTL {
+				t.Errorf("expected SANs %v and TTL %v, got %v and %v", c.expectedSANs, c.expectedTTL, sans, ttl)
+			}
+		})
+	}
+
+	// Without policies, the CSRs are not restricted.
+	authorizer.SetPolicies(nil)
+	sans, ttl, err := authorizer.Authorize(&security.Caller{Identities: []string{"spiffe://cluster.local/ns/payments/sa/batch"}},
+		&x509.CertificateRequest{PublicKeyAlgorithm: x509.RSA, DNSNames: []string{"foo.example.com"}}, 48*time.Hour)
+	if err != nil || !reflect.DeepEqual(sans, []string{"spiffe://cluster.local/ns/payments/sa/batch"}) || ttl != 48*time.Hour {
+		t.Errorf("expected the CSR to be allowed as is, got %v %v %v", sans, ttl, err)
+	}
+}
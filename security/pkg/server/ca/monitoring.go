@@ -35,6 +35,11 @@ var (
 		"The number of authentication failures.",
 	)
 
+	authzErrorCounts = monitoring.NewSum(
+		"citadel_server_authorization_failure_count",
+		"The number of CSRs denied by the CSR policies.",
+	)
+
 	csrParsingErrorCounts = monitoring.NewSum(
 		"citadel_server_csr_parsing_err_count",
 		"The number of errors occurred when parsing the CSR.",
@@ -56,6 +61,11 @@ var (
 		"The number of certificates issuances that have succeeded.",
 	)
 
+	auditErrorCounts = monitoring.NewSum(
+		"citadel_server_audit_err_count",
+		"The number of errors occurred when writing the audit records of the issued certificates.",
+	)
+
 	rootCertExpiryTimestamp = monitoring.NewGauge(
 		"citadel_server_root_cert_expiry_timestamp",
 		"The unix timestamp, in seconds, when Citadel root cert will expire. "+
@@ -72,10 +82,12 @@ func init() {
 	monitoring.MustRegister(
 		csrCounts,
 		authnErrorCounts,
+		authzErrorCounts,
 		csrParsingErrorCounts,
 		idExtractionErrorCounts,
 		certSignErrorCounts,
 		successCounts,
+		auditErrorCounts,
 		rootCertExpiryTimestamp,
 		certChainExpiryTimestamp,
 	)
@@ -85,6 +97,7 @@ func init() {
 type monitoringMetrics struct {
 	CSR               monitoring.Metric
 	AuthnError        monitoring.Metric
+	AuthzError        monitoring.Metric
 	Success           monitoring.Metric
 	CSRError          monitoring.Metric
 	IDExtractionError monitoring.Metric
@@ -96,6 +109,7 @@ func newMonitoringMetrics() monitoringMetrics {
 	return monitoringMetrics{
 		CSR:               csrCounts,
 		AuthnError:        authnErrorCounts,
+		AuthzError:        authzErrorCounts,
 		Success:           successCounts,
 		CSRError:          csrParsingErrorCounts,
 		IDExtractionError: idExtractionErrorCounts,
@@ -16,6 +16,7 @@ package ca
 
 import (
 	"fmt"
+	"net"
 	"time"
 
 	"golang.org/x/net/context"
@@ -51,6 +52,10 @@ type Server struct {
 	Authenticators []security.Authenticator
 	ca             CertificateAuthority
 	serverCertTTL  time.Duration
+	// AuditLog records the issued certificates, if set.
+	AuditLog *AuditLog
+	// CSRAuthorizer authorizes the CSRs before they are signed, if set.
+	CSRAuthorizer *CSRAuthorizer
 }
 
 func getConnectionAddress(ctx context.Context) string {
@@ -64,24 +69,37 @@ func getConnectionAddress(ctx context.Context) string {
 
 // CreateCertificate handles an incoming certificate signing request (CSR). It does
 // authentication and authorization. Upon validated, signs a certificate that:
-// the SAN is the identity of the caller in authentication result.
+// the SAN is the identity of the caller in authentication result, and the DNS SANs of the CSR if allowed by
+// the CSR policy of the caller.
 // the subject public key is the public key in the CSR.
-// the validity duration is the ValidityDuration in request, or default value if the given duration is invalid.
+// the validity duration is the ValidityDuration in request, or default value if the given duration is invalid,
+// at most the max TTL of the CSR policy of the caller.
 // it is signed by the CA signing key.
 func (s *Server) CreateCertificate(ctx context.Context, request *pb.IstioCertificateRequest) (
 	*pb.IstioCertificateResponse, error) {
 	s.monitoring.CSR.Increment()
-	caller := Authenticate(ctx, s.Authenticators)
+	caller, authenticator := authenticateCaller(ctx, s.Authenticators)
 	if caller == nil {
 		s.monitoring.AuthnError.Increment()
 		return nil, status.Error(codes.Unauthenticated, "request authenticate failure")
 	}
 
-	// TODO: Call authorizer.
+	subjectIDs, ttl := caller.Identities, time.Duration(request.ValidityDuration)*time.Second
+	if s.CSRAuthorizer != nil {
+		csr, err := util.ParsePemEncodedCSR([]byte(request.Csr))
+		if err != nil {
+			s.monitoring.CSRError.Increment()
+			return nil, status.Errorf(codes.InvalidArgument, "CSR parsing error (%v)", err)
+		}
+		if subjectIDs, ttl, err = s.CSRAuthorizer.Authorize(caller, csr, ttl); err != nil {
+			serverCaLog.Warnf("CSR of %v denied: %v", caller.Identities, err)
+			s.monitoring.AuthzError.Increment()
+			return nil, status.Errorf(codes.PermissionDenied, "CSR authorization failure (%v)", err)
+		}
+	}
 
 	_, _, certChainBytes, rootCertBytes := s.ca.GetCAKeyCertBundle().GetAll()
-	cert, signErr := s.ca.Sign(
-		[]byte(request.Csr), caller.Identities, time.Duration(request.ValidityDuration)*time.Second, false)
+	cert, signErr := s.ca.Sign([]byte(request.Csr), subjectIDs, ttl, false)
 	if signErr != nil {
 		serverCaLog.Errorf("CSR signing error (%v)", signErr.Error())
 		s.monitoring.GetCertSignError(signErr.(*caerror.Error).ErrorType()).Increment()
@@ -97,9 +115,40 @@ func (s *Server) CreateCertificate(ctx context.Context, request *pb.IstioCertifi
 	}
 	s.monitoring.Success.Increment()
 	serverCaLog.Debug("CSR successfully signed.")
+	if s.AuditLog != nil {
+		s.AuditLog.Record(newAuditRecord(ctx, cert, caller, authenticator))
+	}
 	return response, nil
 }
 
+// newAuditRecord returns the audit record of the certificate certPEM issued to caller.
+func newAuditRecord(ctx context.Context, certPEM []byte, caller *security.Caller, authenticator string) *AuditRecord {
+	record := &AuditRecord{
+		Time:          time.Now(),
+		Requester:     caller.Identities,
+		Authenticator: authenticator,
+		SourceIP:      getConnectionAddress(ctx),
+	}
+	if host, _, err := net.SplitHostPort(record.SourceIP); err == nil {
+		record.SourceIP = host
+	}
+	cert, err := util.ParsePemEncodedCertificate(certPEM)
+	if err != nil {
+		serverCaLog.Warnf("failed to parse the issued certificate for the audit record: %v", err)
+		return record
+	}
+	record.SerialNumber = cert.SerialNumber.Text(16)
+	record.TTL = int64(cert.NotAfter.Sub(cert.NotBefore) / time.Second)
+	record.SubjectAltNames = append(record.SubjectAltNames, cert.DNSNames...)
+	for _, uri := range cert.URIs {
+		record.SubjectAltNames = append(record.SubjectAltNames, uri.String())
+	}
+	for _, ip := range cert.IPAddresses {
+		record.SubjectAltNames = append(record.SubjectAltNames, ip.String())
+	}
+	return record
+}
+
 func recordCertsExpiry(keyCertBundle *util.KeyCertBundle) {
 	rootCertExpiry, err := keyCertBundle.ExtractRootCertExpiryTimestamp()
 	if err != nil {
@@ -142,6 +191,12 @@ func New(ca CertificateAuthority, ttl time.Duration,
 // authenticate goes through a list of authenticators (provided client cert, k8s jwt, and ID token)
 // and authenticates if one of them is valid.
 func Authenticate(ctx context.Context, auth []security.Authenticator) *security.Caller {
+	caller, _ := authenticateCaller(ctx, auth)
+	return caller
+}
+
+// authenticateCaller is Authenticate, also returning the type of the authenticator of the caller.
+func authenticateCaller(ctx context.Context, auth []security.Authenticator) (*security.Caller, string) {
 	// TODO: apply different authenticators in specific order / according to configuration.
 	var errMsg string
 	for id, authn := range auth {
@@ -151,9 +206,9 @@ func Authenticate(ctx context.Context, auth []security.Authenticator) *security.
 		}
 		if u != nil && err == nil {
 			serverCaLog.Debugf("Authentication successful through auth source %v", u.AuthSource)
-			return u
+			return u, authn.AuthenticatorType()
 		}
 	}
 	serverCaLog.Warnf("Authentication failed for %v: %s", getConnectionAddress(ctx), errMsg)
-	return nil
+	return nil, ""
 }